@@ -30,6 +30,9 @@ type ABI struct {
 	Constructor Method
 	Methods     map[string]Method
 	Events      map[string]Event
+
+	Fallback *Method // Function invoked for calls matching no method, nil if undefined
+	Receive  *Method // Function invoked for plain ether transfers, nil if undefined
 }
 
 // JSON returns a parsed ABI interface and error if it failed.
@@ -128,6 +131,16 @@ func (abi *ABI) UnmarshalJSON(data []byte) error {
 				Anonymous: field.Anonymous,
 				Inputs:    field.Inputs,
 			}
+		case "fallback":
+			if abi.Fallback != nil {
+				return fmt.Errorf("abi: only one fallback function is allowed")
+			}
+			abi.Fallback = &Method{}
+		case "receive":
+			if abi.Receive != nil {
+				return fmt.Errorf("abi: only one receive function is allowed")
+			}
+			abi.Receive = &Method{}
 		}
 	}
 
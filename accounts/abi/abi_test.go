@@ -56,7 +56,7 @@ const jsondata2 = `
 ]`
 
 func TestReader(t *testing.T) {
-	Uint256, _ := NewType("uint256")
+	Uint256, _ := NewType("uint256", "", nil)
 	exp := ABI{
 		Methods: map[string]Method{
 			"balance": {
@@ -177,7 +177,7 @@ func TestTestSlice(t *testing.T) {
 }
 
 func TestMethodSignature(t *testing.T) {
-	String, _ := NewType("string")
+	String, _ := NewType("string", "", nil)
 	m := Method{"foo", false, []Argument{{"bar", String, false}, {"baz", String, false}}, nil}
 	exp := "foo(string,string)"
 	if m.Sig() != exp {
@@ -189,7 +189,7 @@ func TestMethodSignature(t *testing.T) {
 		t.Errorf("expected ids to match %x != %x", m.Id(), idexp)
 	}
 
-	uintt, _ := NewType("uint256")
+	uintt, _ := NewType("uint256", "", nil)
 	m = Method{"foo", false, []Argument{{"bar", uintt, false}}, nil}
 	exp = "foo(uint256)"
 	if m.Sig() != exp {
@@ -560,6 +560,36 @@ func TestDefaultFunctionParsing(t *testing.T) {
 	}
 }
 
+func TestFallbackReceiveParsing(t *testing.T) {
+	const definition = `[
+	{ "type" : "function", "name" : "balance", "constant" : true },
+	{ "type" : "fallback", "payable" : true },
+	{ "type" : "receive", "stateMutability" : "payable" }]`
+
+	abi, err := JSON(strings.NewReader(definition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if abi.Fallback == nil {
+		t.Error("expected fallback function to be present")
+	}
+	if abi.Receive == nil {
+		t.Error("expected receive function to be present")
+	}
+	if len(abi.Methods) != 1 {
+		t.Errorf("expected 1 method, got %d", len(abi.Methods))
+	}
+	if _, err := JSON(strings.NewReader(`[{ "type" : "fallback" }, { "type" : "fallback" }]`)); err == nil {
+		t.Error("expected error for duplicate fallback functions")
+	}
+	if abi, err = JSON(strings.NewReader(`[{ "name" : "balance" }]`)); err != nil {
+		t.Fatal(err)
+	}
+	if abi.Fallback != nil || abi.Receive != nil {
+		t.Error("expected no fallback or receive function")
+	}
+}
+
 func TestBareEvents(t *testing.T) {
 	const definition = `[
 	{ "type" : "event", "name" : "balance" },
@@ -567,8 +597,8 @@ func TestBareEvents(t *testing.T) {
 	{ "type" : "event", "name" : "args", "inputs" : [{ "indexed":false, "name":"arg0", "type":"uint256" }, { "indexed":true, "name":"arg1", "type":"address" }] }
 	]`
 
-	arg0, _ := NewType("uint256")
-	arg1, _ := NewType("address")
+	arg0, _ := NewType("uint256", "", nil)
+	arg1, _ := NewType("address", "", nil)
 
 	expectedEvents := map[string]struct {
 		Anonymous bool
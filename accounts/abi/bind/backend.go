@@ -39,6 +39,10 @@ var (
 	// This error is returned by WaitDeployed if contract creation leaves an
 	// empty contract behind.
 	ErrNoCodeAfterDeploy = errors.New("no contract code after deployment")
+
+	// ErrNoChainHead is returned when attempting to follow contract events on a
+	// backend that doesn't implement ChainHeadReader.
+	ErrNoChainHead = errors.New("backend does not support chain head tracking")
 )
 
 // ContractCaller defines the methods needed to allow operating with contract on a read
@@ -98,6 +102,26 @@ type ContractFilterer interface {
 	SubscribeFilterLogs(ctx context.Context, query etsc.FilterQuery, ch chan<- types.Log) (etsc.Subscription, error)
 }
 
+// ChainHeadReader defines the methods needed to track the canonical chain, used
+// to wait for log confirmations and to detect chain reorganisations.
+// FollowLogs will try to discover this interface on the contract filterer. If
+// the backend does not support it, FollowLogs returns ErrNoChainHead.
+type ChainHeadReader interface {
+	// HeaderByNumber returns a canonical block header from the current chain. If
+	// number is nil, the latest known header is returned.
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+
+	// SubscribeNewHead subscribes to notifications about the current blockchain head.
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (etsc.Subscription, error)
+}
+
+// WatchBackend defines the methods needed by an EventWatcher to reliably follow
+// the logs of a contract across disconnects and chain reorganisations.
+type WatchBackend interface {
+	ContractFilterer
+	ChainHeadReader
+}
+
 // DeployBackend wraps the operations needed by WaitMined and WaitDeployed.
 type DeployBackend interface {
 	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
@@ -42,11 +42,20 @@ import (
 	"github.com/ETSC3259/etsc/rpc"
 )
 
-// This nil assignment ensures compile time that SimulatedBackend implements bind.ContractBackend.
-var _ bind.ContractBackend = (*SimulatedBackend)(nil)
+// These nil assignments ensure compile time that SimulatedBackend implements
+// bind.ContractBackend as well as the chain access interfaces of a real node.
+var (
+	_ bind.ContractBackend       = (*SimulatedBackend)(nil)
+	_ bind.WatchBackend          = (*SimulatedBackend)(nil)
+	_ etsc.ChainReader           = (*SimulatedBackend)(nil)
+	_ etsc.TransactionReader     = (*SimulatedBackend)(nil)
+	_ etsc.ChainStateReader      = (*SimulatedBackend)(nil)
+	_ etsc.PendingStateReader    = (*SimulatedBackend)(nil)
+	_ etsc.PendingContractCaller = (*SimulatedBackend)(nil)
+)
 
-var errBlockNumberUnsupported = errors.New("SimulatedBackend cannot access blocks other than the latest block")
 var errGasEstimationFailed = errors.New("gas required exceeds allowance or always failing transaction")
+var errPendingBlockDirty = errors.New("pending block contains transactions")
 
 // SimulatedBackend implements bind.ContractBackend, simulating a blockchain in
 // the background. Its main purpose is to allow easily testing contract bindings.
@@ -69,7 +78,13 @@ func NewSimulatedBackend(alloc core.GenesisAlloc, gasLimit uint64) *SimulatedBac
 	database := etscdb.NewMemDatabase()
 	genesis := core.Genesis{Config: params.AllEtschashProtocolChanges, GasLimit: gasLimit, Alloc: alloc}
 	genesis.MustCommit(database)
-	blockchain, _ := core.NewBlockChain(database, nil, genesis.Config, etschash.NewFaker(), vm.Config{}, nil)
+	// Keep the state of every block around to support historical queries and
+	// forks, and never reorg to a side chain of equal difficulty to keep tests
+	// deterministic.
+	cacheConfig := &core.CacheConfig{Disabled: true}
+	preserve := func(*types.Block) bool { return true }
+
+	blockchain, _ := core.NewBlockChain(database, cacheConfig, genesis.Config, etschash.NewFaker(), vm.Config{}, preserve)
 
 	backend := &SimulatedBackend{
 		database:   database,
@@ -77,12 +92,13 @@ func NewSimulatedBackend(alloc core.GenesisAlloc, gasLimit uint64) *SimulatedBac
 		config:     genesis.Config,
 		events:     filters.NewEventSystem(new(event.TypeMux), &filterBackend{database, blockchain}, false),
 	}
-	backend.rollback()
+	backend.rollback(blockchain.CurrentBlock())
 	return backend
 }
 
 // Commit imports all the pending transactions as a single block and starts a
-// fresh new state.
+// fresh new state on top of it. After a Fork, the imported block extends the
+// side chain, which becomes canonical once it's heavier than the current one.
 func (b *SimulatedBackend) Commit() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -90,7 +106,7 @@ func (b *SimulatedBackend) Commit() {
 	if _, err := b.blockchain.InsertChain([]*types.Block{b.pendingBlock}); err != nil {
 		panic(err) // This cannot happen unless the simulator is wrong, fail in that case
 	}
-	b.rollback()
+	b.rollback(b.pendingBlock)
 }
 
 // Rollback aborts all pending transactions, reverting to the last committed state.
@@ -98,26 +114,66 @@ func (b *SimulatedBackend) Rollback() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	b.rollback()
+	b.rollback(b.pendingParent())
+}
+
+// Fork discards all pending transactions and starts building the next blocks on
+// top of the given ancestor, creating a side chain to simulate reorgs. Once the
+// side chain grows heavier than the canonical one through subsequent Commits, it
+// becomes the new canonical chain and all subscriptions are notified as they
+// would be on a live network. Until then, calls and state queries still operate
+// on the canonical chain.
+func (b *SimulatedBackend) Fork(ctx context.Context, parentHash common.Hash) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.pendingBlock.Transactions()) != 0 {
+		return errPendingBlockDirty
+	}
+	parent := b.blockchain.GetBlockByHash(parentHash)
+	if parent == nil {
+		return etsc.NotFound
+	}
+	b.rollback(parent)
+	return nil
 }
 
-func (b *SimulatedBackend) rollback() {
-	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), etschash.NewFaker(), b.database, 1, func(int, *core.BlockGen) {})
+// rollback discards the pending block and starts a fresh one on top of parent.
+func (b *SimulatedBackend) rollback(parent *types.Block) {
+	blocks, _ := core.GenerateChain(b.config, parent, etschash.NewFaker(), b.database, 1, func(int, *core.BlockGen) {})
 	statedb, _ := b.blockchain.State()
 
 	b.pendingBlock = blocks[0]
 	b.pendingState, _ = state.New(b.pendingBlock.Root(), statedb.Database())
 }
 
+// pendingParent returns the block the pending block is being built on.
+func (b *SimulatedBackend) pendingParent() *types.Block {
+	return b.blockchain.GetBlock(b.pendingBlock.ParentHash(), b.pendingBlock.NumberU64()-1)
+}
+
+// stateByBlockNumber retrieves the state at the given canonical block, nil meaning
+// the latest one.
+func (b *SimulatedBackend) stateByBlockNumber(blockNumber *big.Int) (*state.StateDB, error) {
+	if blockNumber == nil || blockNumber.Cmp(b.blockchain.CurrentBlock().Number()) == 0 {
+		return b.blockchain.State()
+	}
+	block := b.blockchain.GetBlockByNumber(blockNumber.Uint64())
+	if block == nil {
+		return nil, etsc.NotFound
+	}
+	return b.blockchain.StateAt(block.Root())
+}
+
 // CodeAt returns the code associated with a certain account in the blockchain.
 func (b *SimulatedBackend) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if blockNumber != nil && blockNumber.Cmp(b.blockchain.CurrentBlock().Number()) != 0 {
-		return nil, errBlockNumberUnsupported
+	statedb, err := b.stateByBlockNumber(blockNumber)
+	if err != nil {
+		return nil, err
 	}
-	statedb, _ := b.blockchain.State()
 	return statedb.GetCode(contract), nil
 }
 
@@ -126,10 +182,10 @@ func (b *SimulatedBackend) BalanceAt(ctx context.Context, contract common.Addres
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if blockNumber != nil && blockNumber.Cmp(b.blockchain.CurrentBlock().Number()) != 0 {
-		return nil, errBlockNumberUnsupported
+	statedb, err := b.stateByBlockNumber(blockNumber)
+	if err != nil {
+		return nil, err
 	}
-	statedb, _ := b.blockchain.State()
 	return statedb.GetBalance(contract), nil
 }
 
@@ -138,10 +194,10 @@ func (b *SimulatedBackend) NonceAt(ctx context.Context, contract common.Address,
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if blockNumber != nil && blockNumber.Cmp(b.blockchain.CurrentBlock().Number()) != 0 {
-		return 0, errBlockNumberUnsupported
+	statedb, err := b.stateByBlockNumber(blockNumber)
+	if err != nil {
+		return 0, err
 	}
-	statedb, _ := b.blockchain.State()
 	return statedb.GetNonce(contract), nil
 }
 
@@ -150,20 +206,151 @@ func (b *SimulatedBackend) StorageAt(ctx context.Context, contract common.Addres
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if blockNumber != nil && blockNumber.Cmp(b.blockchain.CurrentBlock().Number()) != 0 {
-		return nil, errBlockNumberUnsupported
+	statedb, err := b.stateByBlockNumber(blockNumber)
+	if err != nil {
+		return nil, err
 	}
-	statedb, _ := b.blockchain.State()
 	val := statedb.GetState(contract, key)
 	return val[:], nil
 }
 
+// BlockByHash returns the block with the given hash, even if it's not part of
+// the canonical chain.
+func (b *SimulatedBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if block := b.blockchain.GetBlockByHash(hash); block != nil {
+		return block, nil
+	}
+	return nil, etsc.NotFound
+}
+
+// BlockByNumber returns a block from the current canonical chain. If number is
+// nil, the latest known block is returned.
+func (b *SimulatedBackend) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if number == nil {
+		return b.blockchain.CurrentBlock(), nil
+	}
+	if block := b.blockchain.GetBlockByNumber(number.Uint64()); block != nil {
+		return block, nil
+	}
+	return nil, etsc.NotFound
+}
+
+// HeaderByHash returns the block header with the given hash, even if it's not
+// part of the canonical chain.
+func (b *SimulatedBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if header := b.blockchain.getsceaderByHash(hash); header != nil {
+		return header, nil
+	}
+	return nil, etsc.NotFound
+}
+
+// HeaderByNumber returns a block header from the current canonical chain. If
+// number is nil, the latest known header is returned.
+func (b *SimulatedBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if number == nil {
+		return b.blockchain.CurrentHeader(), nil
+	}
+	header := b.blockchain.getsceaderByNumber(number.Uint64())
+	if header == nil {
+		return nil, etsc.NotFound
+	}
+	return header, nil
+}
+
+// TransactionCount returns the number of transactions in the given block, which
+// may also be the pending one.
+func (b *SimulatedBackend) TransactionCount(ctx context.Context, blockHash common.Hash) (uint, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if blockHash == b.pendingBlock.Hash() {
+		return uint(b.pendingBlock.Transactions().Len()), nil
+	}
+	block := b.blockchain.GetBlockByHash(blockHash)
+	if block == nil {
+		return 0, etsc.NotFound
+	}
+	return uint(block.Transactions().Len()), nil
+}
+
+// TransactionInBlock returns the transaction at the given index in the given
+// block, which may also be the pending one.
+func (b *SimulatedBackend) TransactionInBlock(ctx context.Context, blockHash common.Hash, index uint) (*types.Transaction, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	block := b.pendingBlock
+	if blockHash != block.Hash() {
+		if block = b.blockchain.GetBlockByHash(blockHash); block == nil {
+			return nil, etsc.NotFound
+		}
+	}
+	txs := block.Transactions()
+	if uint(len(txs)) <= index {
+		return nil, etsc.NotFound
+	}
+	return txs[index], nil
+}
+
+// TransactionByHash returns the transaction with the given hash, either from the
+// pending block or from the canonical chain.
+func (b *SimulatedBackend) TransactionByHash(ctx context.Context, txHash common.Hash) (*types.Transaction, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if tx := b.pendingBlock.Transaction(txHash); tx != nil {
+		return tx, true, nil
+	}
+	if tx, _, _, _ := rawdb.ReadTransaction(b.database, txHash); tx != nil {
+		return tx, false, nil
+	}
+	return nil, false, etsc.NotFound
+}
+
 // TransactionReceipt returns the receipt of a transaction.
 func (b *SimulatedBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
 	receipt, _, _, _ := rawdb.ReadReceipt(b.database, txHash)
 	return receipt, nil
 }
 
+// PendingBalanceAt returns the wei balance of an account in the pending state.
+func (b *SimulatedBackend) PendingBalanceAt(ctx context.Context, account common.Address) (*big.Int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.pendingState.GetBalance(account), nil
+}
+
+// PendingStorageAt returns the value of key in the storage of an account in the
+// pending state.
+func (b *SimulatedBackend) PendingStorageAt(ctx context.Context, account common.Address, key common.Hash) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	val := b.pendingState.GetState(account, key)
+	return val[:], nil
+}
+
+// PendingTransactionCount returns the number of transactions in the pending block.
+func (b *SimulatedBackend) PendingTransactionCount(ctx context.Context) (uint, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return uint(b.pendingBlock.Transactions().Len()), nil
+}
+
 // PendingCodeAt returns the code associated with an account in the pending state.
 func (b *SimulatedBackend) PendingCodeAt(ctx context.Context, contract common.Address) ([]byte, error) {
 	b.mu.Lock()
@@ -177,14 +364,17 @@ func (b *SimulatedBackend) CallContract(ctx context.Context, call etsc.CallMsg,
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if blockNumber != nil && blockNumber.Cmp(b.blockchain.CurrentBlock().Number()) != 0 {
-		return nil, errBlockNumberUnsupported
+	block := b.blockchain.CurrentBlock()
+	if blockNumber != nil {
+		if block = b.blockchain.GetBlockByNumber(blockNumber.Uint64()); block == nil {
+			return nil, etsc.NotFound
+		}
 	}
-	state, err := b.blockchain.State()
+	state, err := b.blockchain.StateAt(block.Root())
 	if err != nil {
 		return nil, err
 	}
-	rval, _, _, err := b.callContract(ctx, call, b.blockchain.CurrentBlock(), state)
+	rval, _, _, err := b.callContract(ctx, call, block, state)
 	return rval, err
 }
 
@@ -306,7 +496,7 @@ func (b *SimulatedBackend) SendTransaction(ctx context.Context, tx *types.Transa
 		panic(fmt.Errorf("invalid transaction nonce: got %d, want %d", tx.Nonce(), nonce))
 	}
 
-	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), etschash.NewFaker(), b.database, 1, func(number int, block *core.BlockGen) {
+	blocks, _ := core.GenerateChain(b.config, b.pendingParent(), etschash.NewFaker(), b.database, 1, func(number int, block *core.BlockGen) {
 		for _, tx := range b.pendingBlock.Transactions() {
 			block.AddTxWithChain(b.blockchain, tx)
 		}
@@ -387,11 +577,39 @@ func (b *SimulatedBackend) SubscribeFilterLogs(ctx context.Context, query etsc.F
 	}), nil
 }
 
+// SubscribeNewHead returns a subscription delivering the header of every block
+// imported into the simulated chain.
+func (b *SimulatedBackend) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (etsc.Subscription, error) {
+	// Subscribe to new chain heads
+	sink := make(chan *types.Header)
+	sub := b.events.SubscribeNewHeads(sink)
+
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case head := <-sink:
+				select {
+				case ch <- head:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
 // AdjustTime adds a time shift to the simulated clock.
 func (b *SimulatedBackend) AdjustTime(adjustment time.Duration) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), etschash.NewFaker(), b.database, 1, func(number int, block *core.BlockGen) {
+	blocks, _ := core.GenerateChain(b.config, b.pendingParent(), etschash.NewFaker(), b.database, 1, func(number int, block *core.BlockGen) {
 		for _, tx := range b.pendingBlock.Transactions() {
 			block.AddTx(tx)
 		}
@@ -405,6 +623,52 @@ func (b *SimulatedBackend) AdjustTime(adjustment time.Duration) error {
 	return nil
 }
 
+// TraceTransaction re-executes a mined transaction on top of the state it was
+// originally executed on, feeding every step of the execution into tracer. The
+// results can be retrieved from the tracer afterwards, e.g. the struct logs of
+// a vm.StructLogger.
+func (b *SimulatedBackend) TraceTransaction(ctx context.Context, txHash common.Hash, tracer vm.Tracer) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tx, blockHash, blockNumber, index := rawdb.ReadTransaction(b.database, txHash)
+	if tx == nil {
+		return etsc.NotFound
+	}
+	block := b.blockchain.GetBlock(blockHash, blockNumber)
+	if block == nil {
+		return fmt.Errorf("block %x not found", blockHash)
+	}
+	parent := b.blockchain.GetBlock(block.ParentHash(), blockNumber-1)
+	if parent == nil {
+		return fmt.Errorf("parent %x not found", block.ParentHash())
+	}
+	statedb, err := b.blockchain.StateAt(parent.Root())
+	if err != nil {
+		return err
+	}
+	// Replay the transactions preceding the traced one, then trace it
+	signer := types.MakeSigner(b.config, block.Number())
+
+	for i, tx := range block.Transactions()[:index+1] {
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			return err
+		}
+		vmConfig := vm.Config{}
+		if uint64(i) == index {
+			vmConfig = vm.Config{Debug: true, Tracer: tracer}
+		}
+		vmenv := vm.NewEVM(core.NewEVMContext(msg, block.Header(), b.blockchain, nil), statedb, b.config, vmConfig)
+		if _, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(tx.Gas())); err != nil {
+			return fmt.Errorf("tx %x failed: %v", tx.Hash(), err)
+		}
+		// Ensure any modifications are committed to the state
+		statedb.Finalise(true)
+	}
+	return nil
+}
+
 // callmsg implements core.Message to allow passing it as a transaction simulator.
 type callmsg struct {
 	etsc.CallMsg
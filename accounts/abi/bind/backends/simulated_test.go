@@ -0,0 +1,238 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package backends
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ETSC3259/etsc"
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/core"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/core/vm"
+	"github.com/ETSC3259/etsc/crypto"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr    = crypto.PubkeyToAddress(testKey.PublicKey)
+	testBalance = big.NewInt(10000000000)
+
+	// testCode deploys a contract emitting an empty log on every call
+	testCode = common.FromHex("6006600c60003960066000f360006000a000")
+)
+
+func newTestBackend() *SimulatedBackend {
+	return NewSimulatedBackend(core.GenesisAlloc{testAddr: {Balance: testBalance}}, 10000000)
+}
+
+// sendTestTx signs a transaction with the test key and adds it to the pending block.
+func sendTestTx(t *testing.T, sim *SimulatedBackend, nonce uint64, to *common.Address, value int64, data []byte) *types.Transaction {
+	t.Helper()
+
+	var tx *types.Transaction
+	if to == nil {
+		tx = types.NewContractCreation(nonce, big.NewInt(value), 100000, big.NewInt(1), data)
+	} else {
+		tx = types.NewTransaction(nonce, *to, big.NewInt(value), 100000, big.NewInt(1), data)
+	}
+	tx, _ = types.SignTx(tx, types.HomesteadSigner{}, testKey)
+	if err := sim.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatalf("failed to send transaction: %v", err)
+	}
+	return tx
+}
+
+// Tests that blocks, headers and transactions can be retrieved both from the
+// pending block and the chain.
+func TestSimulatedBlockAccess(t *testing.T) {
+	sim := newTestBackend()
+	ctx := context.Background()
+
+	tx := sendTestTx(t, sim, 0, &common.Address{1}, 1, nil)
+	if have, pending, err := sim.TransactionByHash(ctx, tx.Hash()); err != nil || !pending || have.Hash() != tx.Hash() {
+		t.Fatalf("pending transaction mismatch: have (%v, %v, %v), want (%x, true, nil)", have, pending, err, tx.Hash())
+	}
+	if count, err := sim.PendingTransactionCount(ctx); err != nil || count != 1 {
+		t.Fatalf("pending transaction count mismatch: have (%d, %v), want (1, nil)", count, err)
+	}
+	sim.Commit()
+
+	if have, pending, err := sim.TransactionByHash(ctx, tx.Hash()); err != nil || pending || have.Hash() != tx.Hash() {
+		t.Fatalf("mined transaction mismatch: have (%v, %v, %v), want (%x, false, nil)", have, pending, err, tx.Hash())
+	}
+	block, err := sim.BlockByNumber(ctx, big.NewInt(1))
+	if err != nil {
+		t.Fatalf("failed to retrieve block: %v", err)
+	}
+	if latest, _ := sim.BlockByNumber(ctx, nil); latest.Hash() != block.Hash() {
+		t.Fatalf("latest block mismatch: have %x, want %x", latest.Hash(), block.Hash())
+	}
+	if have, _ := sim.BlockByHash(ctx, block.Hash()); have.Hash() != block.Hash() {
+		t.Fatalf("block by hash mismatch: have %x, want %x", have.Hash(), block.Hash())
+	}
+	if header, _ := sim.HeaderByHash(ctx, block.Hash()); header.Hash() != block.Hash() {
+		t.Fatalf("header by hash mismatch: have %x, want %x", header.Hash(), block.Hash())
+	}
+	if count, err := sim.TransactionCount(ctx, block.Hash()); err != nil || count != 1 {
+		t.Fatalf("transaction count mismatch: have (%d, %v), want (1, nil)", count, err)
+	}
+	if have, err := sim.TransactionInBlock(ctx, block.Hash(), 0); err != nil || have.Hash() != tx.Hash() {
+		t.Fatalf("transaction in block mismatch: have (%v, %v), want %x", have, err, tx.Hash())
+	}
+	if _, err := sim.TransactionInBlock(ctx, block.Hash(), 1); err != etsc.NotFound {
+		t.Fatalf("out of bounds transaction error mismatch: have %v, want %v", err, etsc.NotFound)
+	}
+	if _, err := sim.BlockByNumber(ctx, big.NewInt(2)); err != etsc.NotFound {
+		t.Fatalf("future block error mismatch: have %v, want %v", err, etsc.NotFound)
+	}
+}
+
+// Tests that the state of past blocks can be queried.
+func TestSimulatedHistoricalState(t *testing.T) {
+	sim := newTestBackend()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		sendTestTx(t, sim, uint64(i), &common.Address{1}, 1, nil)
+		sim.Commit()
+	}
+	for number := int64(0); number <= 3; number++ {
+		balance, err := sim.BalanceAt(ctx, common.Address{1}, big.NewInt(number))
+		if err != nil {
+			t.Fatalf("block %d: failed to retrieve balance: %v", number, err)
+		}
+		if balance.Int64() != number {
+			t.Errorf("block %d: balance mismatch: have %v, want %d", number, balance, number)
+		}
+		nonce, err := sim.NonceAt(ctx, testAddr, big.NewInt(number))
+		if err != nil {
+			t.Fatalf("block %d: failed to retrieve nonce: %v", number, err)
+		}
+		if nonce != uint64(number) {
+			t.Errorf("block %d: nonce mismatch: have %d, want %d", number, nonce, number)
+		}
+	}
+	if _, err := sim.BalanceAt(ctx, common.Address{1}, big.NewInt(4)); err != etsc.NotFound {
+		t.Fatalf("future state error mismatch: have %v, want %v", err, etsc.NotFound)
+	}
+}
+
+// Tests that forking off an ancestor and building a heavier side chain results
+// in a reorg, notifying head subscribers about the new chain.
+func TestSimulatedFork(t *testing.T) {
+	sim := newTestBackend()
+	ctx := context.Background()
+
+	heads := make(chan *types.Header, 16)
+	sub, err := sim.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		t.Fatalf("failed to subscribe to new heads: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	// Mine two blocks, the second one containing a transfer
+	sim.Commit()
+	fork, _ := sim.HeaderByNumber(ctx, nil)
+
+	tx := sendTestTx(t, sim, 0, &common.Address{1}, 1, nil)
+	sim.Commit()
+	orig, _ := sim.HeaderByNumber(ctx, nil)
+
+	// Fork off the first block and mine a side chain without the transfer
+	sendTestTx(t, sim, 1, &common.Address{2}, 1, nil)
+	if err := sim.Fork(ctx, fork.Hash()); err != errPendingBlockDirty {
+		t.Fatalf("dirty fork error mismatch: have %v, want %v", err, errPendingBlockDirty)
+	}
+	sim.Rollback()
+	if err := sim.Fork(ctx, fork.Hash()); err != nil {
+		t.Fatalf("failed to fork: %v", err)
+	}
+	sim.Commit()
+	if head, _ := sim.HeaderByNumber(ctx, nil); head.Hash() != orig.Hash() {
+		t.Fatalf("side chain of equal length became canonical")
+	}
+	sim.Commit()
+
+	head, _ := sim.HeaderByNumber(ctx, nil)
+	if head.Number.Uint64() != 3 {
+		t.Fatalf("head number mismatch: have %d, want 3", head.Number)
+	}
+	if header, _ := sim.HeaderByNumber(ctx, big.NewInt(2)); header.Hash() == orig.Hash() {
+		t.Fatalf("original block still canonical after reorg")
+	}
+	if _, _, err := sim.TransactionByHash(ctx, tx.Hash()); err != etsc.NotFound {
+		t.Fatalf("reorged transaction error mismatch: have %v, want %v", err, etsc.NotFound)
+	}
+	if balance, _ := sim.BalanceAt(ctx, common.Address{1}, nil); balance.Sign() != 0 {
+		t.Fatalf("reorged transfer still applied: balance %v", balance)
+	}
+	// The orphaned block should still be retrievable by hash
+	if _, err := sim.BlockByHash(ctx, orig.Hash()); err != nil {
+		t.Fatalf("failed to retrieve orphaned block: %v", err)
+	}
+	// Head subscribers should have been notified of the new canonical head
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case header := <-heads:
+			if header.Hash() == head.Hash() {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("new head %x not announced", head.Hash())
+		}
+	}
+}
+
+// Tests that mined transactions can be re-executed with a tracer.
+func TestSimulatedTraceTransaction(t *testing.T) {
+	sim := newTestBackend()
+	ctx := context.Background()
+
+	sendTestTx(t, sim, 0, nil, 0, testCode)
+	sim.Commit()
+
+	contract := crypto.CreateAddress(testAddr, 0)
+	sendTestTx(t, sim, 1, &common.Address{1}, 1, nil)
+	tx := sendTestTx(t, sim, 2, &contract, 0, nil)
+	sim.Commit()
+
+	tracer := vm.NewStructLogger(nil)
+	if err := sim.TraceTransaction(ctx, tx.Hash(), tracer); err != nil {
+		t.Fatalf("failed to trace transaction: %v", err)
+	}
+	var ops []vm.OpCode
+	for _, log := range tracer.StructLogs() {
+		ops = append(ops, log.Op)
+	}
+	want := []vm.OpCode{vm.PUSH1, vm.PUSH1, vm.LOG0, vm.STOP}
+	if len(ops) != len(want) {
+		t.Fatalf("trace length mismatch: have %v, want %v", ops, want)
+	}
+	for i := range ops {
+		if ops[i] != want[i] {
+			t.Fatalf("trace mismatch: have %v, want %v", ops, want)
+		}
+	}
+	if err := sim.TraceTransaction(ctx, common.Hash{1}, tracer); err != etsc.NotFound {
+		t.Fatalf("missing transaction error mismatch: have %v, want %v", err, etsc.NotFound)
+	}
+}
@@ -72,6 +72,16 @@ type WatchOpts struct {
 	Context context.Context // Network context to support cancellation and timeouts (nil = no timeout)
 }
 
+// FollowOpts is the collection of options to fine tune following events within a
+// bound contract across disconnects and chain reorganisations.
+type FollowOpts struct {
+	Start         *uint64    // Start of the queried range if no checkpoint is stored (nil = latest)
+	Confirmations uint64     // Number of blocks to wait on top of an event before delivering it
+	Checkpoint    Checkpoint // Storage for the last processed block (nil = in memory)
+
+	Context context.Context // Network context to support cancellation and timeouts (nil = no timeout)
+}
+
 // BoundContract is the base wrapper object that reflects a contract on the
 // etsc network. It contains a collection of methods that are used by the
 // higher level contract bindings to operate.
@@ -174,6 +184,12 @@ func (c *BoundContract) Transact(opts *TransactOpts, method string, params ...in
 	return c.transact(opts, &c.address, input)
 }
 
+// RawTransact initiates a transaction with the given raw calldata as input. It is
+// usually used to invoke the fallback function of a contract.
+func (c *BoundContract) RawTransact(opts *TransactOpts, calldata []byte) (*types.Transaction, error) {
+	return c.transact(opts, &c.address, calldata)
+}
+
 // Transfer initiates a plain transaction to move funds to the contract, calling
 // its default method if one is available.
 func (c *BoundContract) Transfer(opts *TransactOpts) (*types.Transaction, error) {
@@ -324,6 +340,47 @@ func (c *BoundContract) WatchLogs(opts *WatchOpts, name string, query ...[]inter
 	return logs, sub, nil
 }
 
+// FollowLogs subscribes to contract logs through an EventWatcher, resuming from
+// the checkpoint and redelivering logs with Removed set if their block is
+// reorganised out. The filterer needs to implement ChainHeadReader, otherwise
+// ErrNoChainHead is returned.
+func (c *BoundContract) FollowLogs(opts *FollowOpts, name string, query ...[]interface{}) (chan types.Log, event.Subscription, error) {
+	// Don't crash on a lazy user
+	if opts == nil {
+		opts = new(FollowOpts)
+	}
+	backend, ok := c.filterer.(WatchBackend)
+	if !ok {
+		return nil, nil, ErrNoChainHead
+	}
+	// Append the event selector to the query parameters and construct the topic set
+	query = append([][]interface{}{{c.abi.Events[name].Id()}}, query...)
+
+	topics, err := makeTopics(query...)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Start the background watcher
+	logs := make(chan types.Log, 128)
+
+	config := WatcherConfig{
+		Query: etsc.FilterQuery{
+			Addresses: []common.Address{c.address},
+			Topics:    topics,
+		},
+		Checkpoint:    opts.Checkpoint,
+		Confirmations: opts.Confirmations,
+	}
+	if opts.Start != nil {
+		config.Query.FromBlock = new(big.Int).SetUint64(*opts.Start)
+	}
+	sub, err := NewEventWatcher(backend, config).Watch(opts.Context, logs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return logs, sub, nil
+}
+
 // UnpackLog unpacks a retrieved log into the provided output structure.
 func (c *BoundContract) UnpackLog(out interface{}, event string, log types.Log) error {
 	if len(log.Data) > 0 {
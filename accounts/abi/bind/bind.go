@@ -22,9 +22,11 @@ package bind
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"go/format"
 	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 	"unicode"
@@ -45,9 +47,18 @@ const (
 // to be used as is in client code, but rather as an intermediate struct which
 // enforces compile time type safety and naming convention opposed to having to
 // manually maintain hard coded strings that break on runtime.
-func Bind(types []string, abis []string, bytecodes []string, pkg string, lang Lang) (string, error) {
+//
+// All contracts are bound into the same package, sharing the Go types generated
+// for identical structs. The libs map associates library placeholder patterns
+// (see LibraryPattern) with the types of the contracts they stand for. Library
+// placeholders in the bytecode of a contract become address parameters of its
+// deploy method, which can also deploy any library bound in the same call.
+func Bind(types []string, abis []string, bytecodes []string, pkg string, lang Lang, libs map[string]string) (string, error) {
 	// Process each individual contract requested binding
-	contracts := make(map[string]*tmplContract)
+	var (
+		contracts = make(map[string]*tmplContract)
+		structs   = make(map[string]*tmplStruct)
+	)
 
 	for i := 0; i < len(types); i++ {
 		// Parse the actual ABI to generate the binding for
@@ -63,6 +74,18 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 			return r
 		}, abis[i])
 
+		// Generate the structs for all tuple arguments. The ABI is walked in a
+		// sorted order to keep the names of anonymous structs stable.
+		for _, args := range sortedArguments(evmABI) {
+			for _, arg := range args {
+				if hasStruct(arg.Type) {
+					if lang != LangGo {
+						return "", errors.New("binding of tuple arguments is only supported for Go")
+					}
+					bindStructTypeGo(arg.Type, structs)
+				}
+			}
+		}
 		// Extract the call and transact methods; events; and sort them alphabetically
 		var (
 			calls     = make(map[string]*tmplMethod)
@@ -117,6 +140,9 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 			// Append the event to the accumulator list
 			events[original.Name] = &tmplEvent{Original: original, Normalized: normalized}
 		}
+		if _, exist := contracts[types[i]]; exist {
+			return "", fmt.Errorf("duplicate contract type %s", types[i])
+		}
 		contracts[types[i]] = &tmplContract{
 			Type:        capitalise(types[i]),
 			InputABI:    strings.Replace(strippedABI, "\"", "\\\"", -1),
@@ -125,12 +151,32 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 			Calls:       calls,
 			Transacts:   transacts,
 			Events:      events,
+			Fallback:    evmABI.Fallback != nil,
+			Receive:     evmABI.Receive != nil,
+		}
+	}
+	// Resolve the libraries each contract needs to be linked against, now that the
+	// bindings of all of them are known
+	if lang == LangGo {
+		for _, contract := range contracts {
+			for _, pattern := range libraryPatterns(contract.InputBin) {
+				lib := &tmplLibrary{Pattern: pattern, Name: "lib" + pattern[:8]}
+				if name, ok := libs[pattern]; ok {
+					kind := capitalise(name)
+					lib.Name = strings.ToLower(kind[:1]) + kind[1:] + "Addr"
+					if bound := contracts[name]; bound != nil && bound.InputBin != "" {
+						lib.Contract = bound
+					}
+				}
+				contract.Libraries = append(contract.Libraries, lib)
+			}
 		}
 	}
 	// Generate the contract template data content and render it
 	data := &tmplData{
 		Package:   pkg,
 		Contracts: contracts,
+		Structs:   structs,
 	}
 	buffer := new(bytes.Buffer)
 
@@ -157,9 +203,105 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 	return buffer.String(), nil
 }
 
+// sortedArguments returns the argument lists of the constructor, all methods and
+// all events of the given ABI in a deterministic order.
+func sortedArguments(evmABI abi.ABI) []abi.Arguments {
+	all := []abi.Arguments{evmABI.Constructor.Inputs}
+
+	methods := make([]string, 0, len(evmABI.Methods))
+	for name := range evmABI.Methods {
+		methods = append(methods, name)
+	}
+	sort.Strings(methods)
+	for _, name := range methods {
+		all = append(all, evmABI.Methods[name].Inputs, evmABI.Methods[name].Outputs)
+	}
+	events := make([]string, 0, len(evmABI.Events))
+	for name := range evmABI.Events {
+		events = append(events, name)
+	}
+	sort.Strings(events)
+	for _, name := range events {
+		all = append(all, evmABI.Events[name].Inputs)
+	}
+	return all
+}
+
+// hasStruct returns an indicator whether the given type is struct, struct slice
+// or struct array.
+func hasStruct(t abi.Type) bool {
+	switch t.T {
+	case abi.SliceTy, abi.ArrayTy:
+		return hasStruct(*t.Elem)
+	case abi.TupleTy:
+		return true
+	default:
+		return false
+	}
+}
+
+// structKey identifies a tuple by its source name and its fields, so that all
+// occurrences of the same struct share a single binding.
+func structKey(kind abi.Type) string {
+	switch kind.T {
+	case abi.TupleTy:
+		fields := make([]string, len(kind.TupleElems))
+		for i, elem := range kind.TupleElems {
+			fields[i] = structKey(*elem) + " " + kind.TupleRawNames[i]
+		}
+		return kind.TupleRawName + "(" + strings.Join(fields, ",") + ")"
+	case abi.ArrayTy:
+		return fmt.Sprintf("%s[%d]", structKey(*kind.Elem), kind.Size)
+	case abi.SliceTy:
+		return structKey(*kind.Elem) + "[]"
+	default:
+		return kind.String()
+	}
+}
+
+// bindStructTypeGo registers the Go struct definitions needed to represent the
+// given type, including all nested tuples. Structs are named after their source
+// definition if the ABI carries it, otherwise a name is generated.
+func bindStructTypeGo(kind abi.Type, structs map[string]*tmplStruct) {
+	switch kind.T {
+	case abi.TupleTy:
+		key := structKey(kind)
+		if _, exist := structs[key]; exist {
+			return
+		}
+		fields := make([]*tmplField, len(kind.TupleElems))
+		for i, elem := range kind.TupleElems {
+			bindStructTypeGo(*elem, structs)
+			fields[i] = &tmplField{Type: bindTypeGo(*elem, structs), Name: abi.ToCamelCase(kind.TupleRawNames[i]), SolKind: *elem}
+		}
+		name := kind.TupleRawName
+		if name == "" {
+			name = fmt.Sprintf("Struct%d", len(structs))
+		}
+		// Distinct structs of different contracts may share a source name
+		for base, i := name, 0; structNameTaken(structs, name); i++ {
+			name = fmt.Sprintf("%s%d", base, i)
+		}
+		structs[key] = &tmplStruct{Name: name, Fields: fields}
+
+	case abi.ArrayTy, abi.SliceTy:
+		bindStructTypeGo(*kind.Elem, structs)
+	}
+}
+
+// structNameTaken reports whether a struct binding with the given name exists.
+func structNameTaken(structs map[string]*tmplStruct, name string) bool {
+	for _, s := range structs {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // bindType is a set of type binders that convert Solidity types to some supported
 // programming language types.
-var bindType = map[Lang]func(kind abi.Type) string{
+var bindType = map[Lang]func(kind abi.Type, structs map[string]*tmplStruct) string{
 	LangGo:   bindTypeGo,
 	LangJava: bindTypeJava,
 }
@@ -184,25 +326,22 @@ func wrapArray(stringKind string, innerLen int, innerMapping string) (string, []
 	return innerMapping, parts
 }
 
-// Translates the array sizes to a Go-lang declaration of a (nested) array of the inner type.
-// Simply returns the inner type if arraySizes is empty.
-func arrayBindingGo(inner string, arraySizes []string) string {
-	out := ""
-	//prepend all array sizes, from outer (end arraySizes) to inner (start arraySizes)
-	for i := len(arraySizes) - 1; i >= 0; i-- {
-		out += "[" + arraySizes[i] + "]"
-	}
-	out += inner
-	return out
-}
-
 // bindTypeGo converts a Solidity type to a Go one. Since there is no clear mapping
 // from all Solidity types to Go ones (e.g. uint17), those that cannot be exactly
-// mapped will use an upscaled type (e.g. *big.Int).
-func bindTypeGo(kind abi.Type) string {
-	stringKind := kind.String()
-	innerLen, innerMapping := bindUnnestedTypeGo(stringKind)
-	return arrayBindingGo(wrapArray(stringKind, innerLen, innerMapping))
+// mapped will use an upscaled type (e.g. *big.Int). Tuples map to the structs
+// registered by bindStructTypeGo.
+func bindTypeGo(kind abi.Type, structs map[string]*tmplStruct) string {
+	switch kind.T {
+	case abi.TupleTy:
+		return structs[structKey(kind)].Name
+	case abi.ArrayTy:
+		return fmt.Sprintf("[%d]", kind.Size) + bindTypeGo(*kind.Elem, structs)
+	case abi.SliceTy:
+		return "[]" + bindTypeGo(*kind.Elem, structs)
+	default:
+		_, inner := bindUnnestedTypeGo(kind.String())
+		return inner
+	}
 }
 
 // The inner function of bindTypeGo, this finds the inner type of stringKind.
@@ -247,7 +386,7 @@ func arrayBindingJava(inner string, arraySizes []string) string {
 // bindTypeJava converts a Solidity type to a Java one. Since there is no clear mapping
 // from all Solidity types to Java ones (e.g. uint17), those that cannot be exactly
 // mapped will use an upscaled type (e.g. BigDecimal).
-func bindTypeJava(kind abi.Type) string {
+func bindTypeJava(kind abi.Type, structs map[string]*tmplStruct) string {
 	stringKind := kind.String()
 	innerLen, innerMapping := bindUnnestedTypeJava(stringKind)
 	return arrayBindingJava(wrapArray(stringKind, innerLen, innerMapping))
@@ -310,16 +449,16 @@ func bindUnnestedTypeJava(stringKind string) (int, string) {
 
 // bindTopicType is a set of type binders that convert Solidity types to some
 // supported programming language topic types.
-var bindTopicType = map[Lang]func(kind abi.Type) string{
+var bindTopicType = map[Lang]func(kind abi.Type, structs map[string]*tmplStruct) string{
 	LangGo:   bindTopicTypeGo,
 	LangJava: bindTopicTypeJava,
 }
 
 // bindTypeGo converts a Solidity topic type to a Go one. It is almost the same
 // funcionality as for simple types, but dynamic types get converted to hashes.
-func bindTopicTypeGo(kind abi.Type) string {
-	bound := bindTypeGo(kind)
-	if bound == "string" || bound == "[]byte" {
+func bindTopicTypeGo(kind abi.Type, structs map[string]*tmplStruct) string {
+	bound := bindTypeGo(kind, structs)
+	if bound == "string" || bound == "[]byte" || kind.T == abi.TupleTy {
 		bound = "common.Hash"
 	}
 	return bound
@@ -327,8 +466,8 @@ func bindTopicTypeGo(kind abi.Type) string {
 
 // bindTypeGo converts a Solidity topic type to a Java one. It is almost the same
 // funcionality as for simple types, but dynamic types get converted to hashes.
-func bindTopicTypeJava(kind abi.Type) string {
-	bound := bindTypeJava(kind)
+func bindTopicTypeJava(kind abi.Type, structs map[string]*tmplStruct) string {
+	bound := bindTypeJava(kind, structs)
 	if bound == "String" || bound == "Bytes" {
 		bound = "Hash"
 	}
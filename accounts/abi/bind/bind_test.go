@@ -844,6 +844,34 @@ var bindTests = []struct {
 				t.Fatalf("unsubscribed simple event arrived: %v", event)
 			case <-time.After(250 * time.Millisecond):
 			}
+			// Test following the events with a confirmation requirement
+			follow := make(chan *EventerSimpleEvent, 16)
+			fsub, err := eventer.FollowSimpleEvent(&bind.FollowOpts{Confirmations: 1}, follow, nil, nil, nil)
+			if err != nil {
+				t.Fatalf("failed to follow simple events: %v", err)
+			}
+			defer fsub.Unsubscribe()
+
+			if _, err := eventer.RaiseSimpleEvent(auth, common.Address{253}, [32]byte{253}, true, big.NewInt(253)); err != nil {
+				t.Fatalf("failed to raise followed simple event: %v", err)
+			}
+			sim.Commit()
+
+			select {
+			case event := <-follow:
+				t.Fatalf("unconfirmed simple event arrived: %v", event)
+			case <-time.After(250 * time.Millisecond):
+			}
+			sim.Commit()
+
+			select {
+			case event := <-follow:
+				if event.Value.Uint64() != 253 || event.Raw.Removed {
+					t.Errorf("followed log content mismatch: have %v, want 253", event)
+				}
+			case <-time.After(250 * time.Millisecond):
+				t.Fatalf("followed simple event didn't arrive")
+			}
 		`,
 	},
 	{
@@ -921,6 +949,158 @@ var bindTests = []struct {
 			}
 		`,
 	},
+	// Tests that tuples are bound to generated structs
+	{
+		`Tuple`,
+		`
+			pragma solidity >=0.5.0;
+			pragma experimental ABIEncoderV2;
+
+			contract Tuple {
+				struct S { uint a; uint[] b; T[] c; }
+				struct T { uint x; uint y; }
+				struct Anon { uint p; bool q; } // internalType stripped from the ABI, as emitted by solc < 0.5.11
+
+				event TupleEvent(S a, T[2] b);
+
+				function func1(S memory a, T[2][] memory b) public pure returns (S memory, T[2][] memory) {
+					return (a, b);
+				}
+				function anon(Anon memory v) public {}
+			}
+		`,
+		``,
+		`[{"constant":true,"inputs":[{"components":[{"internalType":"uint256","name":"a","type":"uint256"},{"internalType":"uint256[]","name":"b","type":"uint256[]"},{"components":[{"internalType":"uint256","name":"x","type":"uint256"},{"internalType":"uint256","name":"y","type":"uint256"}],"internalType":"struct Tuple.T[]","name":"c","type":"tuple[]"}],"internalType":"struct Tuple.S","name":"a","type":"tuple"},{"components":[{"internalType":"uint256","name":"x","type":"uint256"},{"internalType":"uint256","name":"y","type":"uint256"}],"internalType":"struct Tuple.T[2][]","name":"b","type":"tuple[2][]"}],"name":"func1","outputs":[{"components":[{"internalType":"uint256","name":"a","type":"uint256"},{"internalType":"uint256[]","name":"b","type":"uint256[]"},{"components":[{"internalType":"uint256","name":"x","type":"uint256"},{"internalType":"uint256","name":"y","type":"uint256"}],"internalType":"struct Tuple.T[]","name":"c","type":"tuple[]"}],"internalType":"struct Tuple.S","name":"","type":"tuple"},{"components":[{"internalType":"uint256","name":"x","type":"uint256"},{"internalType":"uint256","name":"y","type":"uint256"}],"internalType":"struct Tuple.T[2][]","name":"","type":"tuple[2][]"}],"payable":false,"stateMutability":"pure","type":"function"},{"constant":false,"inputs":[{"components":[{"internalType":"uint256","name":"p","type":"uint256"},{"internalType":"bool","name":"q","type":"bool"}],"name":"v","type":"tuple"}],"name":"anon","outputs":[],"payable":false,"stateMutability":"nonpayable","type":"function"},{"anonymous":false,"inputs":[{"components":[{"internalType":"uint256","name":"a","type":"uint256"},{"internalType":"uint256[]","name":"b","type":"uint256[]"},{"components":[{"internalType":"uint256","name":"x","type":"uint256"},{"internalType":"uint256","name":"y","type":"uint256"}],"internalType":"struct Tuple.T[]","name":"c","type":"tuple[]"}],"indexed":false,"internalType":"struct Tuple.S","name":"a","type":"tuple"},{"components":[{"internalType":"uint256","name":"x","type":"uint256"},{"internalType":"uint256","name":"y","type":"uint256"}],"indexed":false,"internalType":"struct Tuple.T[2]","name":"b","type":"tuple[2]"}],"name":"TupleEvent","type":"event"}]`,
+		`
+			"math/big"
+			"reflect"
+			"strings"
+
+			"github.com/ETSC3259/etsc/accounts/abi"
+			"github.com/ETSC3259/etsc/accounts/abi/bind"
+			"github.com/ETSC3259/etsc/core/types"
+		`,
+		`
+			// The generated methods take and return the generated structs
+			var _ func(*bind.CallOpts, TupleS, [][2]TupleT) (TupleS, [][2]TupleT, error) = (&TupleCaller{}).Func1
+			var _ func(*bind.TransactOpts, Struct0) (*types.Transaction, error) = (&TupleTransactor{}).Anon
+			var _ = TupleTupleEvent{A: TupleS{}, B: [2]TupleT{}}
+
+			// Round trip the structs through the contract ABI. The outputs of
+			// func1 mirror its inputs, so the call data decodes into the returns.
+			parsed, err := abi.JSON(strings.NewReader(TupleABI))
+			if err != nil {
+				t.Fatalf("failed to parse ABI: %v", err)
+			}
+			s := TupleS{A: big.NewInt(1), B: []*big.Int{big.NewInt(2)}, C: []TupleT{{X: big.NewInt(3), Y: big.NewInt(4)}}}
+			ts := [][2]TupleT{{{X: big.NewInt(5), Y: big.NewInt(6)}, {X: big.NewInt(7), Y: big.NewInt(8)}}}
+			input, err := parsed.Pack("func1", s, ts)
+			if err != nil {
+				t.Fatalf("failed to pack structs: %v", err)
+			}
+			var (
+				outS  = new(TupleS)
+				outTs = new([][2]TupleT)
+			)
+			if err := parsed.Unpack(&[]interface{}{outS, outTs}, "func1", input[4:]); err != nil {
+				t.Fatalf("failed to unpack structs: %v", err)
+			}
+			if !reflect.DeepEqual(*outS, s) || !reflect.DeepEqual(*outTs, ts) {
+				t.Fatalf("struct mismatch: have %v %v, want %v %v", *outS, *outTs, s, ts)
+			}
+			if _, err := parsed.Pack("anon", Struct0{P: big.NewInt(1), Q: true}); err != nil {
+				t.Fatalf("failed to pack anonymous struct: %v", err)
+			}
+		`,
+	},
+}
+
+// bindMultiTests are bound like bindTests, but with several contracts generated
+// into a single binding, e.g. to link libraries or to share struct types.
+var bindMultiTests = []struct {
+	name      string
+	types     []string
+	bytecodes []string
+	abis      []string
+	libs      map[string]string
+	imports   string
+	tester    string
+}{
+	// Test that libraries are linked into deployed contracts, and deployed first if
+	// requested. The bytecode is hand assembled: Lib has an empty runtime, Main has
+	// one returning the linked library address on any call, also acting as a payable
+	// fallback. Identical structs across contracts share a single Go type.
+	{
+		`Linker`,
+		[]string{`Lib`, `Main`},
+		[]string{
+			`600180600b6000396000f300`,
+			`601d80600b6000396000f373__$415e10fb16bf6c50b12b2cb52e1147ae0a$__60005260206000f3`,
+		},
+		[]string{
+			`[{"constant":false,"inputs":[{"components":[{"name":"x","type":"uint256"}],"internalType":"struct Shared","name":"s","type":"tuple"}],"name":"f","outputs":[],"type":"function"},{"constant":false,"inputs":[{"components":[{"name":"y","type":"bool"}],"internalType":"struct Shared","name":"s","type":"tuple"}],"name":"h","outputs":[],"type":"function"}]`,
+			`[{"constant":true,"inputs":[],"name":"lib","outputs":[{"name":"","type":"address"}],"type":"function"},{"constant":false,"inputs":[{"components":[{"name":"x","type":"uint256"}],"internalType":"struct Shared","name":"s","type":"tuple"}],"name":"g","outputs":[],"type":"function"},{"payable":true,"type":"fallback"}]`,
+		},
+		map[string]string{`415e10fb16bf6c50b12b2cb52e1147ae0a`: `Lib`},
+		`
+			"context"
+			"math/big"
+
+			"github.com/ETSC3259/etsc/accounts/abi/bind"
+			"github.com/ETSC3259/etsc/accounts/abi/bind/backends"
+			"github.com/ETSC3259/etsc/common"
+			"github.com/ETSC3259/etsc/core"
+			"github.com/ETSC3259/etsc/core/types"
+			"github.com/ETSC3259/etsc/crypto"
+		`,
+		`
+			// Identical structs share a type, different ones with the same name don't
+			var _ func(*bind.TransactOpts, Shared) (*types.Transaction, error) = (&LibTransactor{}).F
+			var _ func(*bind.TransactOpts, Shared) (*types.Transaction, error) = (&MainTransactor{}).G
+			var _ func(*bind.TransactOpts, Shared0) (*types.Transaction, error) = (&LibTransactor{}).H
+
+			key, _ := crypto.GenerateKey()
+			auth := bind.NewKeyedTransactor(key)
+			sim := backends.NewSimulatedBackend(core.GenesisAlloc{auth.From: {Balance: big.NewInt(10000000000)}}, 10000000)
+
+			// Link against an existing library
+			lib := common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314")
+			_, _, linked, err := DeployMain(auth, sim, lib)
+			if err != nil {
+				t.Fatalf("Failed to deploy linked contract: %v", err)
+			}
+			sim.Commit()
+			if have, err := linked.Lib(nil); err != nil || have != lib {
+				t.Fatalf("Linked library mismatch: have %x, want %x (%v)", have, lib, err)
+			}
+			// Deploy a new library on demand, with explicit nonces
+			auth.Nonce = big.NewInt(1)
+			addr, tx, deployed, err := DeployMain(auth, sim, common.Address{})
+			if err != nil {
+				t.Fatalf("Failed to deploy contract with library: %v", err)
+			}
+			sim.Commit()
+			if tx.Nonce() != 2 || addr != crypto.CreateAddress(auth.From, 2) {
+				t.Fatalf("Contract nonce mismatch: have %d, want 2", tx.Nonce())
+			}
+			want := crypto.CreateAddress(auth.From, 1)
+			if have, err := deployed.Lib(nil); err != nil || have != want {
+				t.Fatalf("Deployed library mismatch: have %x, want %x (%v)", have, want, err)
+			}
+			if code, err := sim.CodeAt(context.Background(), want, nil); err != nil || len(code) != 1 {
+				t.Fatalf("Library code mismatch: have %x (%v)", code, err)
+			}
+			// Send some funds through the fallback function
+			auth.Nonce, auth.Value = nil, big.NewInt(100)
+			if _, err := deployed.Fallback(auth, []byte{0x01, 0x02}); err != nil {
+				t.Fatalf("Failed to invoke fallback: %v", err)
+			}
+			sim.Commit()
+			if balance, err := sim.BalanceAt(context.Background(), addr, nil); err != nil || balance.Int64() != 100 {
+				t.Fatalf("Contract balance mismatch: have %v, want 100 (%v)", balance, err)
+			}
+		`,
+	},
 }
 
 // Tests that packages generated by the binder can be successfully compiled and
@@ -945,7 +1125,7 @@ func TestBindings(t *testing.T) {
 	// Generate the test suite for all the contracts
 	for i, tt := range bindTests {
 		// Generate the binding and create a Go source file in the workspace
-		bind, err := Bind([]string{tt.name}, []string{tt.abi}, []string{tt.bytecode}, "bindtest", LangGo)
+		bind, err := Bind([]string{tt.name}, []string{tt.abi}, []string{tt.bytecode}, "bindtest", LangGo, nil)
 		if err != nil {
 			t.Fatalf("test %d: failed to generate binding: %v", i, err)
 		}
@@ -969,6 +1149,32 @@ func TestBindings(t *testing.T) {
 			t.Fatalf("test %d: failed to write tests: %v", i, err)
 		}
 	}
+	for i, tt := range bindMultiTests {
+		// Generate the binding and create a Go source file in the workspace
+		bind, err := Bind(tt.types, tt.abis, tt.bytecodes, "bindtest", LangGo, tt.libs)
+		if err != nil {
+			t.Fatalf("multi test %d: failed to generate binding: %v", i, err)
+		}
+		if err = ioutil.WriteFile(filepath.Join(pkg, strings.ToLower(tt.name)+".go"), []byte(bind), 0600); err != nil {
+			t.Fatalf("multi test %d: failed to write binding: %v", i, err)
+		}
+		// Generate the test file with the injected test code
+		code := fmt.Sprintf(`
+			package bindtest
+
+			import (
+				"testing"
+				%s
+			)
+
+			func Test%s(t *testing.T) {
+				%s
+			}
+		`, tt.imports, tt.name, tt.tester)
+		if err := ioutil.WriteFile(filepath.Join(pkg, strings.ToLower(tt.name)+"_test.go"), []byte(code), 0600); err != nil {
+			t.Fatalf("multi test %d: failed to write tests: %v", i, err)
+		}
+	}
 	// Test the entire package and report any failures
 	cmd := exec.Command(gocmd, "test", "-v", "-count", "1")
 	cmd.Dir = pkg
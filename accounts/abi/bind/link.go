@@ -0,0 +1,73 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind
+
+import (
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/crypto"
+)
+
+// libraryPlaceholder matches the placeholders solc leaves in the bytecode of a
+// contract for the addresses of the libraries it needs to be linked against.
+var libraryPlaceholder = regexp.MustCompile(`__\$([0-9a-fA-F]{34})\$__`)
+
+// LibraryPattern returns the placeholder pattern solc uses in bytecode for the
+// given fully qualified library name (e.g. "contracts/math.sol:SafeMath"): the
+// first 34 hex characters of the keccak256 hash of the name.
+func LibraryPattern(name string) string {
+	return common.Bytes2Hex(crypto.Keccak256([]byte(name)))[:34]
+}
+
+// libraryPatterns returns the distinct library placeholder patterns contained in
+// the given bytecode, in order of first appearance.
+func libraryPatterns(bytecode string) []string {
+	var (
+		patterns []string
+		seen     = make(map[string]bool)
+	)
+	for _, match := range libraryPlaceholder.FindAllStringSubmatch(bytecode, -1) {
+		pattern := strings.ToLower(match[1])
+		if !seen[pattern] {
+			seen[pattern] = true
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// LinkLibrary replaces all placeholders of the library with the given pattern in
+// the hex encoded bytecode with the library's address.
+func LinkLibrary(bytecode string, pattern string, library common.Address) string {
+	return strings.Replace(bytecode, "__$"+pattern+"$__", common.Bytes2Hex(library.Bytes()), -1)
+}
+
+// NextNonce returns the transaction options to use after the given transaction
+// was issued with opts. If opts carries an explicit nonce, a copy with the nonce
+// following the transaction's is returned, otherwise opts itself.
+func NextNonce(opts *TransactOpts, tx *types.Transaction) *TransactOpts {
+	if opts.Nonce == nil {
+		return opts
+	}
+	next := *opts
+	next.Nonce = new(big.Int).SetUint64(tx.Nonce() + 1)
+	return &next
+}
@@ -0,0 +1,511 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ETSC3259/etsc"
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/event"
+	"github.com/ETSC3259/etsc/log"
+)
+
+const (
+	defaultWatchPageSize     = 1024            // Default number of blocks queried at once while backfilling
+	defaultWatchReorgDepth   = 128             // Default number of recent blocks tracked for reorg detection
+	defaultWatchPollInterval = 5 * time.Second // Default interval to check for new blocks without notifications
+)
+
+var (
+	// errWatcherRunning is returned if an EventWatcher is asked to watch while a
+	// previous subscription is still active.
+	errWatcherRunning = errors.New("event watcher already running")
+
+	// errWatcherQuit is returned internally if the subscription is torn down while
+	// logs are being delivered.
+	errWatcherQuit = errors.New("event watcher quit")
+
+	// errPageReorged is returned internally if a page of logs was not served from
+	// the current canonical chain, in which case it's retried later.
+	errPageReorged = errors.New("chain reorganised during log retrieval")
+)
+
+// Checkpoint persists the progress of an EventWatcher, allowing it to resume
+// from the last processed block after a restart or a disconnect.
+type Checkpoint interface {
+	// Load returns the number of the last fully processed block. The boolean
+	// result is false if no progress was stored yet.
+	Load() (uint64, bool, error)
+
+	// Store records number as the last fully processed block.
+	Store(number uint64) error
+}
+
+// MemoryCheckpoint is a Checkpoint keeping the progress in memory only. The zero
+// value is ready to use.
+type MemoryCheckpoint struct {
+	number uint64
+	stored bool
+	lock   sync.Mutex
+}
+
+// Load returns the number of the last fully processed block, if any.
+func (c *MemoryCheckpoint) Load() (uint64, bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.number, c.stored, nil
+}
+
+// Store records number as the last fully processed block.
+func (c *MemoryCheckpoint) Store(number uint64) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.number, c.stored = number, true
+	return nil
+}
+
+// FileCheckpoint is a Checkpoint persisting the progress into a file, so that
+// watching can be resumed across process restarts.
+type FileCheckpoint struct {
+	path string
+	lock sync.Mutex
+}
+
+// NewFileCheckpoint creates a checkpoint stored in the file at path. The file is
+// created on the first Store.
+func NewFileCheckpoint(path string) *FileCheckpoint {
+	return &FileCheckpoint{path: path}
+}
+
+// Load returns the number of the last fully processed block, if any.
+func (c *FileCheckpoint) Load() (uint64, bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	blob, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	number, err := strconv.ParseUint(strings.TrimSpace(string(blob)), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid checkpoint %s: %v", c.path, err)
+	}
+	return number, true, nil
+}
+
+// Store records number as the last fully processed block. The file is replaced
+// atomically to avoid losing the progress on a crash.
+func (c *FileCheckpoint) Store(number uint64) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strconv.FormatUint(number, 10)+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// checkpointError wraps a failure to load or store the watcher progress. These
+// are fatal, as continuing would silently lose track of delivered logs.
+type checkpointError struct {
+	err error
+}
+
+func (e *checkpointError) Error() string {
+	return fmt.Sprintf("checkpoint failed: %v", e.err)
+}
+
+// WatcherConfig is the collection of options to fine tune an EventWatcher.
+type WatcherConfig struct {
+	Query         etsc.FilterQuery // Addresses and topics to watch, FromBlock is used if no checkpoint is stored (nil = latest)
+	Checkpoint    Checkpoint       // Storage for the last processed block (nil = in memory)
+	Confirmations uint64           // Number of blocks to wait on top of a log before delivering it
+	PageSize      uint64           // Maximum number of blocks to query at once while backfilling (0 = 1024)
+	ReorgDepth    uint64           // Number of recent blocks tracked to detect reorgs (0 = 128)
+	PollInterval  time.Duration    // Interval to check for new blocks and retry after failures (0 = 5s)
+}
+
+// watchedBlock is a recently processed block tracked for reorg detection, along
+// with the logs delivered from it.
+type watchedBlock struct {
+	number uint64
+	hash   common.Hash
+	logs   []types.Log
+}
+
+// EventWatcher follows the logs matching a filter query along the canonical
+// chain. Contrary to a plain log subscription, it
+//
+//   - stores the last processed block in a Checkpoint and resumes from there,
+//   - backfills missed blocks with bounded FilterLogs pages after a disconnect,
+//   - delivers logs only once they have the requested number of confirmations,
+//   - redelivers logs with Removed set when their block is reorganised out.
+//
+// Logs are delivered at least once: the checkpoint is updated after all logs of
+// a page were handed to the sink. Removal notifications are only possible for
+// blocks processed by the running watcher within the tracked reorg depth, so
+// setting some confirmations is recommended when resuming from a checkpoint.
+type EventWatcher struct {
+	backend WatchBackend
+	config  WatcherConfig
+
+	next   uint64         // Number of the next block to process
+	recent []watchedBlock // Recently processed blocks, sorted by number
+
+	running bool
+	lock    sync.Mutex
+}
+
+// NewEventWatcher creates a watcher following the logs matching the configured
+// query on the given backend.
+func NewEventWatcher(backend WatchBackend, config WatcherConfig) *EventWatcher {
+	if config.Checkpoint == nil {
+		config.Checkpoint = new(MemoryCheckpoint)
+	}
+	if config.PageSize == 0 {
+		config.PageSize = defaultWatchPageSize
+	}
+	if config.ReorgDepth == 0 {
+		config.ReorgDepth = defaultWatchReorgDepth
+	}
+	if config.PollInterval == 0 {
+		config.PollInterval = defaultWatchPollInterval
+	}
+	config.Query.BlockHash = nil
+	return &EventWatcher{
+		backend: backend,
+		config:  config,
+	}
+}
+
+// Watch starts delivering the matching logs into sink, returning a subscription
+// that can be used to tear down the watcher. Transient backend failures, including
+// a dropped head subscription, are retried; only checkpoint failures terminate
+// the subscription with an error.
+func (w *EventWatcher) Watch(ctx context.Context, sink chan<- types.Log) (event.Subscription, error) {
+	w.lock.Lock()
+	if w.running {
+		w.lock.Unlock()
+		return nil, errWatcherRunning
+	}
+	w.running = true
+	w.lock.Unlock()
+
+	ctx = ensureContext(ctx)
+	if err := w.init(ctx); err != nil {
+		w.stop()
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer w.stop()
+
+		// Abort any pending backend request when the subscription is torn down
+		loopCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		go func() {
+			select {
+			case <-quit:
+				cancel()
+			case <-loopCtx.Done():
+			}
+		}()
+		return w.loop(ctx, loopCtx, sink, quit)
+	}), nil
+}
+
+// stop marks the watcher as idle, allowing it to be restarted.
+func (w *EventWatcher) stop() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.running = false
+}
+
+// init determines the first block to process, resuming from the checkpoint if
+// one was stored.
+func (w *EventWatcher) init(ctx context.Context) error {
+	w.recent = nil
+
+	number, ok, err := w.config.Checkpoint.Load()
+	if err != nil {
+		return &checkpointError{err}
+	}
+	switch {
+	case ok:
+		w.next = number + 1
+	case w.config.Query.FromBlock != nil:
+		w.next = w.config.Query.FromBlock.Uint64()
+	default:
+		head, err := w.backend.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return err
+		}
+		w.next = head.Number.Uint64() + 1
+	}
+	return nil
+}
+
+// loop keeps the watcher in sync with the chain, triggered by new head events
+// or periodically if those are not available.
+func (w *EventWatcher) loop(parent, ctx context.Context, sink chan<- types.Log, quit <-chan struct{}) error {
+	var (
+		heads   = make(chan *types.Header)
+		trigger = make(chan struct{}, 1)
+		headSub etsc.Subscription
+		headErr <-chan error
+	)
+	// Head events only trigger a sync, coalesce them to never block the backend
+	go func() {
+		for {
+			select {
+			case <-heads:
+				select {
+				case trigger <- struct{}{}:
+				default:
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	defer func() {
+		if headSub != nil {
+			headSub.Unsubscribe()
+		}
+	}()
+	ticker := time.NewTicker(w.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// (Re)establish the head notifications if they were lost
+		if headSub == nil {
+			if sub, err := w.backend.SubscribeNewHead(ctx, heads); err == nil {
+				headSub, headErr = sub, sub.Err()
+			}
+		}
+		// Catch up with the chain, retrying transient failures on the next round
+		if err := w.sync(ctx, sink, quit); err != nil {
+			if _, ok := err.(*checkpointError); ok {
+				return err
+			}
+			if err == errWatcherQuit {
+				return nil
+			}
+			log.Debug("Failed to sync event watcher", "next", w.next, "err", err)
+		}
+		select {
+		case <-trigger:
+		case <-headErr:
+			// Head subscription dropped, any missed blocks are backfilled on resubscribe
+			headSub.Unsubscribe()
+			headSub, headErr = nil, nil
+		case <-ticker.C:
+		case <-quit:
+			return nil
+		case <-parent.Done():
+			return parent.Err()
+		}
+	}
+}
+
+// sync brings the watcher up to date with the confirmed part of the canonical
+// chain, unwinding any processed blocks that were reorganised out first.
+func (w *EventWatcher) sync(ctx context.Context, sink chan<- types.Log, quit <-chan struct{}) error {
+	head, err := w.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if head.Number.Uint64() < w.config.Confirmations {
+		return w.unwind(ctx, sink, quit)
+	}
+	target := head.Number.Uint64() - w.config.Confirmations
+
+	for {
+		if err := w.unwind(ctx, sink, quit); err != nil {
+			return err
+		}
+		if w.next > target {
+			return nil
+		}
+		end := w.next + w.config.PageSize - 1
+		if end > target || end < w.next {
+			end = target
+		}
+		if err := w.process(ctx, sink, quit, w.next, end, target); err != nil {
+			return err
+		}
+	}
+}
+
+// process retrieves and delivers the logs of a single page of blocks, tracking
+// the ones shallow enough to still be reorganised.
+func (w *EventWatcher) process(ctx context.Context, sink chan<- types.Log, quit <-chan struct{}, from, to, target uint64) error {
+	query := w.config.Query
+	query.FromBlock = new(big.Int).SetUint64(from)
+	query.ToBlock = new(big.Int).SetUint64(to)
+
+	logs, err := w.backend.FilterLogs(ctx, query)
+	if err != nil {
+		return err
+	}
+	anchor, err := w.backend.HeaderByNumber(ctx, query.ToBlock)
+	if err != nil {
+		return err
+	}
+	// Make sure the page was served from the current canonical chain, otherwise
+	// leave it to be retried after unwinding
+	blocks := groupLogs(logs)
+	for _, block := range blocks {
+		if block.number+w.config.ReorgDepth <= target {
+			continue
+		}
+		hash := anchor.Hash()
+		if block.number != to {
+			header, err := w.backend.HeaderByNumber(ctx, new(big.Int).SetUint64(block.number))
+			if err != nil && err != etsc.NotFound {
+				return err
+			}
+			if header == nil {
+				return errPageReorged
+			}
+			hash = header.Hash()
+		}
+		if block.hash != hash {
+			return errPageReorged
+		}
+	}
+	for _, block := range blocks {
+		for _, log := range block.logs {
+			if err := deliverLog(ctx, sink, quit, log); err != nil {
+				return err
+			}
+		}
+	}
+	// Track the delivered blocks and the end of the page to detect future reorgs
+	for _, block := range blocks {
+		if block.number+w.config.ReorgDepth > target {
+			w.recent = append(w.recent, block)
+		}
+	}
+	if n := len(w.recent); n == 0 || w.recent[n-1].number != to {
+		w.recent = append(w.recent, watchedBlock{number: to, hash: anchor.Hash()})
+	}
+	w.prune(target)
+
+	w.next = to + 1
+	if err := w.config.Checkpoint.Store(to); err != nil {
+		return &checkpointError{err}
+	}
+	return nil
+}
+
+// unwind checks the tracked blocks against the canonical chain and rolls back
+// the ones that were reorganised out, notifying the sink about their logs.
+func (w *EventWatcher) unwind(ctx context.Context, sink chan<- types.Log, quit <-chan struct{}) error {
+	// Find the newest tracked block still on the canonical chain. As blocks are
+	// chained by hash, everything below it is canonical too.
+	keep := len(w.recent)
+	for ; keep > 0; keep-- {
+		block := w.recent[keep-1]
+
+		header, err := w.backend.HeaderByNumber(ctx, new(big.Int).SetUint64(block.number))
+		if err != nil && err != etsc.NotFound {
+			return err
+		}
+		if header != nil && header.Hash() == block.hash {
+			break
+		}
+	}
+	if keep == len(w.recent) {
+		return nil
+	}
+	// Notify the sink about the removed logs, newest first
+	for i := len(w.recent) - 1; i >= keep; i-- {
+		logs := w.recent[i].logs
+		for j := len(logs) - 1; j >= 0; j-- {
+			log := logs[j]
+			log.Removed = true
+			if err := deliverLog(ctx, sink, quit, log); err != nil {
+				return err
+			}
+		}
+	}
+	// Rewind to reprocess everything after the last canonical block
+	next := w.recent[keep].number
+	if keep > 0 {
+		next = w.recent[keep-1].number + 1
+	}
+	w.recent, w.next = w.recent[:keep], next
+	if next > 0 {
+		if err := w.config.Checkpoint.Store(next - 1); err != nil {
+			return &checkpointError{err}
+		}
+	}
+	return nil
+}
+
+// prune drops the tracked blocks that are too deep to be reorganised, always
+// retaining the newest one as an anchor.
+func (w *EventWatcher) prune(target uint64) {
+	drop := 0
+	for drop < len(w.recent)-1 && w.recent[drop].number+w.config.ReorgDepth <= target {
+		drop++
+	}
+	w.recent = append(w.recent[:0], w.recent[drop:]...)
+}
+
+// groupLogs splits a list of logs, as returned by FilterLogs, by their blocks.
+func groupLogs(logs []types.Log) []watchedBlock {
+	var blocks []watchedBlock
+	for _, log := range logs {
+		if n := len(blocks); n == 0 || blocks[n-1].number != log.BlockNumber || blocks[n-1].hash != log.BlockHash {
+			blocks = append(blocks, watchedBlock{number: log.BlockNumber, hash: log.BlockHash})
+		}
+		blocks[len(blocks)-1].logs = append(blocks[len(blocks)-1].logs, log)
+	}
+	return blocks
+}
+
+// deliverLog hands a single log to the sink, aborting if the watcher is torn down.
+func deliverLog(ctx context.Context, sink chan<- types.Log, quit <-chan struct{}, log types.Log) error {
+	select {
+	case sink <- log:
+		return nil
+	case <-quit:
+		return errWatcherQuit
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,387 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ETSC3259/etsc"
+	"github.com/ETSC3259/etsc/accounts/abi/bind"
+	"github.com/ETSC3259/etsc/accounts/abi/bind/backends"
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/core"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/event"
+)
+
+var errChainOffline = errors.New("chain offline")
+
+// testChain is a minimal in-memory bind.WatchBackend whose canonical chain can be
+// extended and reorganised at will, with every block carrying a single log.
+type testChain struct {
+	blocks  []*types.Header
+	logs    map[common.Hash]types.Log
+	offline bool
+	feed    event.Feed
+	drop    chan struct{}
+	lock    sync.Mutex
+}
+
+func newTestChain() *testChain {
+	return &testChain{
+		blocks: []*types.Header{{Number: big.NewInt(0)}},
+		logs:   make(map[common.Hash]types.Log),
+		drop:   make(chan struct{}),
+	}
+}
+
+// extend appends n blocks on top of the canonical chain. The fork id is mixed
+// into the blocks to make them distinct from other branches.
+func (c *testChain) extend(n int, fork byte) {
+	c.lock.Lock()
+	for i := 0; i < n; i++ {
+		parent := c.blocks[len(c.blocks)-1]
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number, common.Big1),
+			Extra:      []byte{fork},
+		}
+		c.blocks = append(c.blocks, header)
+		c.logs[header.Hash()] = types.Log{
+			Topics:      []common.Hash{{fork}},
+			BlockNumber: header.Number.Uint64(),
+			BlockHash:   header.Hash(),
+		}
+	}
+	head := c.blocks[len(c.blocks)-1]
+	c.lock.Unlock()
+
+	c.feed.Send(head)
+}
+
+// reorg drops all canonical blocks above number and builds n new ones.
+func (c *testChain) reorg(number uint64, n int, fork byte) {
+	c.lock.Lock()
+	c.blocks = c.blocks[:number+1]
+	c.lock.Unlock()
+
+	c.extend(n, fork)
+}
+
+func (c *testChain) setOffline(offline bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if offline && !c.offline {
+		close(c.drop)
+	}
+	if !offline && c.offline {
+		c.drop = make(chan struct{})
+	}
+	c.offline = offline
+}
+
+func (c *testChain) FilterLogs(ctx context.Context, query etsc.FilterQuery) ([]types.Log, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.offline {
+		return nil, errChainOffline
+	}
+	var logs []types.Log
+	for n := query.FromBlock.Uint64(); n <= query.ToBlock.Uint64() && n < uint64(len(c.blocks)); n++ {
+		if log, ok := c.logs[c.blocks[n].Hash()]; ok {
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
+
+func (c *testChain) SubscribeFilterLogs(ctx context.Context, query etsc.FilterQuery, ch chan<- types.Log) (etsc.Subscription, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *testChain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.offline {
+		return nil, errChainOffline
+	}
+	if number == nil {
+		return c.blocks[len(c.blocks)-1], nil
+	}
+	if number.Uint64() >= uint64(len(c.blocks)) {
+		return nil, etsc.NotFound
+	}
+	return c.blocks[number.Uint64()], nil
+}
+
+func (c *testChain) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (etsc.Subscription, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.offline {
+		return nil, errChainOffline
+	}
+	sub, drop := c.feed.Subscribe(ch), c.drop
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		select {
+		case <-drop:
+			return errChainOffline
+		case err := <-sub.Err():
+			return err
+		case <-quit:
+			return nil
+		}
+	}), nil
+}
+
+// expectLogs waits for the given (block number, fork, removed) triplets to be
+// delivered by a watcher, in order.
+func expectLogs(t *testing.T, sink <-chan types.Log, want ...[3]uint64) {
+	t.Helper()
+
+	for i, w := range want {
+		select {
+		case log := <-sink:
+			if log.BlockNumber != w[0] || log.Topics[0] != (common.Hash{byte(w[1])}) || log.Removed != (w[2] == 1) {
+				t.Fatalf("log %d: have (%d, %x, %v), want (%d, %x, %v)", i, log.BlockNumber, log.Topics[0][0], log.Removed, w[0], w[1], w[2] == 1)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("log %d: timeout waiting for (%d, %x, %v)", i, w[0], w[1], w[2] == 1)
+		}
+	}
+	select {
+	case log := <-sink:
+		t.Fatalf("unexpected log (%d, %x, %v)", log.BlockNumber, log.Topics[0][0], log.Removed)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// Tests that logs of reorganised blocks are redelivered as removed, followed by
+// the logs of the new canonical blocks.
+func TestEventWatcherReorg(t *testing.T) {
+	chain := newTestChain()
+	chain.extend(5, 0xa)
+
+	watcher := bind.NewEventWatcher(chain, bind.WatcherConfig{
+		Query:        etsc.FilterQuery{FromBlock: big.NewInt(1)},
+		PollInterval: 10 * time.Millisecond,
+	})
+	sink := make(chan types.Log)
+	sub, err := watcher.Watch(nil, sink)
+	if err != nil {
+		t.Fatalf("failed to start watcher: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	expectLogs(t, sink, [3]uint64{1, 0xa, 0}, [3]uint64{2, 0xa, 0}, [3]uint64{3, 0xa, 0}, [3]uint64{4, 0xa, 0}, [3]uint64{5, 0xa, 0})
+
+	// Replace the last three blocks with a longer fork
+	chain.reorg(2, 4, 0xb)
+	expectLogs(t, sink,
+		[3]uint64{5, 0xa, 1}, [3]uint64{4, 0xa, 1}, [3]uint64{3, 0xa, 1},
+		[3]uint64{3, 0xb, 0}, [3]uint64{4, 0xb, 0}, [3]uint64{5, 0xb, 0}, [3]uint64{6, 0xb, 0},
+	)
+	// Replace the fork with a shorter one, nothing should be left dangling
+	chain.reorg(4, 1, 0xc)
+	expectLogs(t, sink, [3]uint64{6, 0xb, 1}, [3]uint64{5, 0xb, 1}, [3]uint64{5, 0xc, 0})
+}
+
+// Tests that logs are held back until they have enough confirmations, so that
+// shallow reorgs are never surfaced.
+func TestEventWatcherConfirmations(t *testing.T) {
+	chain := newTestChain()
+	chain.extend(5, 0xa)
+
+	watcher := bind.NewEventWatcher(chain, bind.WatcherConfig{
+		Query:         etsc.FilterQuery{FromBlock: big.NewInt(1)},
+		Confirmations: 2,
+		PollInterval:  10 * time.Millisecond,
+	})
+	sink := make(chan types.Log)
+	sub, err := watcher.Watch(nil, sink)
+	if err != nil {
+		t.Fatalf("failed to start watcher: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	expectLogs(t, sink, [3]uint64{1, 0xa, 0}, [3]uint64{2, 0xa, 0}, [3]uint64{3, 0xa, 0})
+
+	// Reorg the unconfirmed blocks, the watcher should not notice
+	chain.reorg(3, 2, 0xb)
+	expectLogs(t, sink)
+
+	chain.extend(2, 0xb)
+	expectLogs(t, sink, [3]uint64{4, 0xb, 0}, [3]uint64{5, 0xb, 0})
+}
+
+// Tests that the watcher keeps retrying while the backend is unreachable and
+// backfills all missed blocks in bounded pages once it's back.
+func TestEventWatcherDisconnect(t *testing.T) {
+	chain := newTestChain()
+	chain.extend(2, 0xa)
+
+	watcher := bind.NewEventWatcher(chain, bind.WatcherConfig{
+		Query:        etsc.FilterQuery{FromBlock: big.NewInt(1)},
+		PageSize:     2,
+		PollInterval: 10 * time.Millisecond,
+	})
+	sink := make(chan types.Log)
+	sub, err := watcher.Watch(nil, sink)
+	if err != nil {
+		t.Fatalf("failed to start watcher: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	expectLogs(t, sink, [3]uint64{1, 0xa, 0}, [3]uint64{2, 0xa, 0})
+
+	// Drop the backend, reorg and extend the chain while the watcher is blind
+	chain.setOffline(true)
+	time.Sleep(50 * time.Millisecond)
+	chain.reorg(1, 4, 0xb)
+	expectLogs(t, sink)
+
+	chain.setOffline(false)
+	expectLogs(t, sink,
+		[3]uint64{2, 0xa, 1},
+		[3]uint64{2, 0xb, 0}, [3]uint64{3, 0xb, 0}, [3]uint64{4, 0xb, 0}, [3]uint64{5, 0xb, 0},
+	)
+	select {
+	case err := <-sub.Err():
+		t.Fatalf("watcher failed: %v", err)
+	default:
+	}
+}
+
+// Tests that a watcher resumes from the last processed block stored in its
+// checkpoint, and that file checkpoints survive a restart.
+func TestEventWatcherCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bind-watcher-")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	chain := newTestChain()
+	chain.extend(3, 0xa)
+
+	config := bind.WatcherConfig{
+		Query:        etsc.FilterQuery{FromBlock: big.NewInt(1)},
+		Checkpoint:   bind.NewFileCheckpoint(filepath.Join(dir, "checkpoint")),
+		PollInterval: 10 * time.Millisecond,
+	}
+	sink := make(chan types.Log)
+	sub, err := bind.NewEventWatcher(chain, config).Watch(nil, sink)
+	if err != nil {
+		t.Fatalf("failed to start watcher: %v", err)
+	}
+	expectLogs(t, sink, [3]uint64{1, 0xa, 0}, [3]uint64{2, 0xa, 0}, [3]uint64{3, 0xa, 0})
+	sub.Unsubscribe()
+
+	if number, ok, err := config.Checkpoint.Load(); err != nil || !ok || number != 3 {
+		t.Fatalf("checkpoint mismatch: have (%d, %v, %v), want (3, true, nil)", number, ok, err)
+	}
+	// Extend the chain and restart with a fresh checkpoint on the same file
+	chain.extend(2, 0xa)
+
+	config.Checkpoint = bind.NewFileCheckpoint(filepath.Join(dir, "checkpoint"))
+	sub, err = bind.NewEventWatcher(chain, config).Watch(nil, sink)
+	if err != nil {
+		t.Fatalf("failed to restart watcher: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	expectLogs(t, sink, [3]uint64{4, 0xa, 0}, [3]uint64{5, 0xa, 0})
+}
+
+// Tests that the event watcher works against the simulated backend, following
+// logs emitted by a contract as new blocks are committed and reporting them as
+// removed when a side chain takes over.
+func TestEventWatcherSimulated(t *testing.T) {
+	var (
+		addr = crypto.PubkeyToAddress(testKey.PublicKey)
+		sim  = backends.NewSimulatedBackend(core.GenesisAlloc{addr: {Balance: big.NewInt(10000000000)}}, 10000000)
+	)
+	// Deploy a contract emitting an empty log on every call
+	code := common.FromHex("6006600c60003960066000f360006000a000")
+	tx, _ := types.SignTx(types.NewContractCreation(0, new(big.Int), 100000, big.NewInt(1), code), types.HomesteadSigner{}, testKey)
+	if err := sim.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatalf("failed to deploy contract: %v", err)
+	}
+	sim.Commit()
+	contract := crypto.CreateAddress(addr, 0)
+
+	watcher := bind.NewEventWatcher(sim, bind.WatcherConfig{
+		Query: etsc.FilterQuery{Addresses: []common.Address{contract}},
+	})
+	sink := make(chan types.Log)
+	sub, err := watcher.Watch(nil, sink)
+	if err != nil {
+		t.Fatalf("failed to start watcher: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	for nonce := uint64(1); nonce <= 3; nonce++ {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, contract, new(big.Int), 100000, big.NewInt(1), nil), types.HomesteadSigner{}, testKey)
+		if err := sim.SendTransaction(context.Background(), tx); err != nil {
+			t.Fatalf("failed to send transaction %d: %v", nonce, err)
+		}
+		sim.Commit()
+
+		select {
+		case log := <-sink:
+			if log.Address != contract || log.TxHash != tx.Hash() || log.BlockNumber != nonce+1 || log.Removed {
+				t.Fatalf("log %d mismatch: %+v", nonce, log)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timeout waiting for log %d", nonce)
+		}
+	}
+	// Fork off before the last two logs and build a heavier empty side chain
+	parent, err := sim.HeaderByNumber(context.Background(), big.NewInt(2))
+	if err != nil {
+		t.Fatalf("failed to retrieve fork point: %v", err)
+	}
+	if err := sim.Fork(context.Background(), parent.Hash()); err != nil {
+		t.Fatalf("failed to fork: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		sim.Commit()
+	}
+	for _, number := range []uint64{4, 3} {
+		select {
+		case log := <-sink:
+			if log.BlockNumber != number || !log.Removed {
+				t.Fatalf("removed log mismatch: have (%d, %v), want (%d, true)", log.BlockNumber, log.Removed, number)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timeout waiting for removed log of block %d", number)
+		}
+	}
+}
@@ -95,6 +95,14 @@ func TestEventId(t *testing.T) {
 				"check":   crypto.Keccak256Hash([]byte("check(address,uint256)")),
 			},
 		},
+		{
+			definition: `[
+			{ "type" : "event", "name" : "order", "inputs": [{ "name" : "o", "type": "tuple", "components": [{ "name": "maker", "type": "address" }, { "name": "amounts", "type": "uint256[2]" }] }, { "name": "legs", "type": "tuple[]", "components": [{ "name": "id", "type": "bytes32" }] }] }
+			]`,
+			expectations: map[string]common.Hash{
+				"order": crypto.Keccak256Hash([]byte("order((address,uint256[2]),(bytes32)[])")),
+			},
+		},
 	}
 
 	for _, test := range table {
@@ -131,6 +139,33 @@ func TestEventMultiValueWithArrayUnpack(t *testing.T) {
 	require.Equal(t, uint8(3), rst.Value2)
 }
 
+// TestEventStructUnpack verifies that tuple fields of events are decoded into
+// nested structs and that static tuples are counted like static arrays.
+func TestEventStructUnpack(t *testing.T) {
+	definition := `[{"name": "test", "type": "event", "inputs": [{"indexed": true, "name":"value1", "type":"uint8"},{"indexed": false, "name":"value2", "type":"tuple", "components": [{"name":"a", "type":"uint8"},{"name":"b", "type":"uint8[2]"}]},{"indexed": false, "name":"value3", "type":"uint8"}]}]`
+	type pair struct {
+		A uint8
+		B [2]uint8
+	}
+	type testStruct struct {
+		Value1 uint8
+		Value2 pair
+		Value3 uint8
+	}
+	abi, err := JSON(strings.NewReader(definition))
+	require.NoError(t, err)
+	var b bytes.Buffer
+	var i uint8 = 1
+	for ; i <= 4; i++ {
+		b.Write(packNum(reflect.ValueOf(i)))
+	}
+	var rst testStruct
+	require.NoError(t, abi.Unpack(&rst, "test", b.Bytes()))
+	require.Equal(t, uint8(0), rst.Value1)
+	require.Equal(t, pair{1, [2]uint8{2, 3}}, rst.Value2)
+	require.Equal(t, uint8(4), rst.Value3)
+}
+
 func TestEventTupleUnpack(t *testing.T) {
 
 	type EventTransfer struct {
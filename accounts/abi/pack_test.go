@@ -325,7 +325,7 @@ func TestPack(t *testing.T) {
 			common.Hex2Bytes("0000000000000000000000000000000000000000000000000000000000000006666f6f6261720000000000000000000000000000000000000000000000000000"),
 		},
 	} {
-		typ, err := NewType(test.typ)
+		typ, err := NewType(test.typ, "", nil)
 		if err != nil {
 			t.Fatalf("%v failed. Unexpected parse error: %v", i, err)
 		}
@@ -341,6 +341,80 @@ func TestPack(t *testing.T) {
 	}
 }
 
+func TestPackTuple(t *testing.T) {
+	type S struct {
+		A *big.Int
+		B bool
+	}
+	for i, test := range []struct {
+		def  string // ABI inputs JSON
+		args []interface{}
+		enc  string // solc encoded arguments
+	}{
+		{
+			`[{"name":"s","type":"tuple","components":[{"name":"a","type":"uint256"},{"name":"b","type":"bool"}]},{"name":"n","type":"uint256"}]`,
+			[]interface{}{S{big.NewInt(1), true}, big.NewInt(2)},
+			"000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002",
+		},
+		{
+			`[{"name":"s","type":"tuple","components":[{"name":"a","type":"uint256"},{"name":"s","type":"string"},{"name":"c","type":"uint256[]"}]}]`,
+			[]interface{}{struct {
+				A *big.Int
+				S string
+				C []*big.Int
+			}{big.NewInt(5), "hello", []*big.Int{big.NewInt(1), big.NewInt(2)}}},
+			"00000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000005000000000000000000000000000000000000000000000000000000000000006000000000000000000000000000000000000000000000000000000000000000a0000000000000000000000000000000000000000000000000000000000000000568656c6c6f000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002",
+		},
+		{
+			`[{"name":"s","type":"tuple[]","components":[{"name":"x","type":"uint256"},{"name":"y","type":"bytes"}]}]`,
+			[]interface{}{[]struct {
+				X *big.Int
+				Y []byte
+			}{{big.NewInt(1), []byte{1, 2}}, {big.NewInt(2), []byte{}}}},
+			"00000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000000c00000000000000000000000000000000000000000000000000000000000000001000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000000020102000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000400000000000000000000000000000000000000000000000000000000000000000",
+		},
+		{
+			`[{"name":"s","type":"tuple[2][]","components":[{"name":"x","type":"uint256"},{"name":"y","type":"uint256"}]}]`,
+			[]interface{}{[][2]struct{ X, Y *big.Int }{
+				{{big.NewInt(1), big.NewInt(2)}, {big.NewInt(3), big.NewInt(4)}},
+				{{big.NewInt(5), big.NewInt(6)}, {big.NewInt(7), big.NewInt(8)}},
+			}},
+			"0000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000300000000000000000000000000000000000000000000000000000000000000040000000000000000000000000000000000000000000000000000000000000005000000000000000000000000000000000000000000000000000000000000000600000000000000000000000000000000000000000000000000000000000000070000000000000000000000000000000000000000000000000000000000000008",
+		},
+		{
+			`[{"name":"s","type":"tuple[][2]","components":[{"name":"s","type":"string"}]}]`,
+			[]interface{}{[2][]struct{ S string }{{{"a"}}, {{"b"}, {"c"}}}},
+			"0000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000000e0000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000161000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000000a0000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000016200000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000016300000000000000000000000000000000000000000000000000000000000000",
+		},
+		{
+			`[{"name":"s","type":"tuple","components":[{"name":"inner","type":"tuple","components":[{"name":"x","type":"uint256"},{"name":"y","type":"uint256[]"}]},{"name":"owner","type":"address"}]},{"name":"n","type":"uint256"}]`,
+			[]interface{}{struct {
+				Inner struct {
+					X *big.Int
+					Y []*big.Int
+				}
+				Owner common.Address
+			}{struct {
+				X *big.Int
+				Y []*big.Int
+			}{big.NewInt(7), []*big.Int{big.NewInt(8)}}, common.HexToAddress("0101010101010101010101010101010101010101")}, big.NewInt(9)},
+			"00000000000000000000000000000000000000000000000000000000000000400000000000000000000000000000000000000000000000000000000000000009000000000000000000000000000000000000000000000000000000000000004000000000000000000000000001010101010101010101010101010101010101010000000000000000000000000000000000000000000000000000000000000007000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000008",
+		},
+	} {
+		abi, err := JSON(strings.NewReader(`[{"name":"method","type":"function","inputs":` + test.def + `}]`))
+		if err != nil {
+			t.Fatalf("test %d: invalid ABI: %v", i, err)
+		}
+		packed, err := abi.Methods["method"].Inputs.Pack(test.args...)
+		if err != nil {
+			t.Fatalf("test %d: pack error: %v", i, err)
+		}
+		if enc := common.Hex2Bytes(test.enc); !bytes.Equal(packed, enc) {
+			t.Errorf("test %d: encoding mismatch:\ngot  %x\nwant %x", i, packed, enc)
+		}
+	}
+}
+
 func TestMethodPack(t *testing.T) {
 	abi, err := JSON(strings.NewReader(jsondata2))
 	if err != nil {
@@ -81,12 +81,59 @@ func set(dst, src reflect.Value, output Argument) error {
 		dst.Set(src)
 	case dstType.Kind() == reflect.Ptr:
 		return set(dst.Elem(), src, output)
+	case dstType.Kind() == reflect.Struct && srcType.Kind() == reflect.Struct:
+		return setStruct(dst, src, output)
+	case dstType.Kind() == srcType.Kind() && (dstType.Kind() == reflect.Slice || dstType.Kind() == reflect.Array) && containsStruct(srcType):
+		return setList(dst, src, output)
 	default:
 		return fmt.Errorf("abi: cannot unmarshal %v in to %v", src.Type(), dst.Type())
 	}
 	return nil
 }
 
+// setStruct assigns the fields of an unpacked tuple to the equally named fields
+// of a user defined struct, e.g. one generated by abigen.
+func setStruct(dst, src reflect.Value, output Argument) error {
+	for i := 0; i < src.NumField(); i++ {
+		name := src.Type().Field(i).Name
+		field := dst.FieldByName(name)
+		if !field.IsValid() {
+			return fmt.Errorf("abi: field %s can't be found in the given value %v", name, dst.Type())
+		}
+		if err := set(field, src.Field(i), output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setList assigns a slice or array of unpacked tuples element by element.
+func setList(dst, src reflect.Value, output Argument) error {
+	if dst.Kind() == reflect.Array && dst.Len() != src.Len() {
+		return fmt.Errorf("abi: cannot unmarshal %v in to %v", src.Type(), dst.Type())
+	}
+	list := dst
+	if dst.Kind() == reflect.Slice {
+		list = reflect.MakeSlice(dst.Type(), src.Len(), src.Len())
+	}
+	for i := 0; i < src.Len(); i++ {
+		if err := set(list.Index(i), src.Index(i), output); err != nil {
+			return err
+		}
+	}
+	dst.Set(list)
+	return nil
+}
+
+// containsStruct reports whether the innermost element of a (nested) slice or
+// array type is a struct.
+func containsStruct(typ reflect.Type) bool {
+	for typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.Struct
+}
+
 // requireAssignable assures that `dest` is a pointer and it's not an interface.
 func requireAssignable(dst, src reflect.Value) error {
 	if dst.Kind() != reflect.Ptr && dst.Kind() != reflect.Interface {
@@ -97,7 +97,7 @@ func TestTypeRegexp(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		typ, err := NewType(tt.blob)
+		typ, err := NewType(tt.blob, "", nil)
 		if err != nil {
 			t.Errorf("type %q: failed to parse type string: %v", tt.blob, err)
 		}
@@ -107,6 +107,47 @@ func TestTypeRegexp(t *testing.T) {
 	}
 }
 
+func TestNewTupleType(t *testing.T) {
+	components := []ArgumentMarshaling{
+		{Name: "owner", Type: "address"},
+		{Name: "token_ids", Type: "uint256[]"},
+		{Name: "meta", Type: "tuple", InternalType: "struct Market.Meta", Components: []ArgumentMarshaling{{Name: "name", Type: "string"}}},
+	}
+	typ, err := NewType("tuple[2]", "struct Market.Order[2]", components)
+	if err != nil {
+		t.Fatal("failed to parse tuple type:", err)
+	}
+	if typ.T != ArrayTy || typ.Elem.T != TupleTy {
+		t.Fatalf("wrong type kinds: %d of %d", typ.T, typ.Elem.T)
+	}
+	if s := typ.String(); s != "(address,uint256[],(string))[2]" {
+		t.Errorf("wrong canonical type: %s", s)
+	}
+	tuple := typ.Elem
+	if tuple.TupleRawName != "MarketOrder" || tuple.TupleElems[2].TupleRawName != "MarketMeta" {
+		t.Errorf("wrong struct names: %q, %q", tuple.TupleRawName, tuple.TupleElems[2].TupleRawName)
+	}
+	if !reflect.DeepEqual(tuple.TupleRawNames, []string{"owner", "token_ids", "meta"}) {
+		t.Errorf("wrong field names: %v", tuple.TupleRawNames)
+	}
+	want := reflect.TypeOf([2]struct {
+		Owner    common.Address
+		TokenIds []*big.Int
+		Meta     struct{ Name string }
+	}{})
+	if typ.Type != want {
+		t.Errorf("wrong reflect type:\ngot  %v\nwant %v", typ.Type, want)
+	}
+
+	// Anonymous and colliding field names can't be represented as struct fields.
+	if _, err := NewType("tuple", "", []ArgumentMarshaling{{Name: "_", Type: "bool"}}); err == nil {
+		t.Error("expected error for anonymous tuple field")
+	}
+	if _, err := NewType("tuple", "", []ArgumentMarshaling{{Name: "a_b", Type: "bool"}, {Name: "aB", Type: "bool"}}); err == nil {
+		t.Error("expected error for duplicate tuple field")
+	}
+}
+
 func TestTypeCheck(t *testing.T) {
 	for i, test := range []struct {
 		typ   string
@@ -256,7 +297,7 @@ func TestTypeCheck(t *testing.T) {
 		{"invalidType", "", "unsupported arg type: invalidType"},
 		{"invalidSlice[]", "", "unsupported arg type: invalidSlice"},
 	} {
-		typ, err := NewType(test.typ)
+		typ, err := NewType(test.typ, "", nil)
 		if err != nil && len(test.err) == 0 {
 			t.Fatal("unexpected parse error:", err)
 		} else if err != nil && len(test.err) != 0 {
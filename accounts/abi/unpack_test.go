@@ -173,7 +173,7 @@ var unpackTests = []unpackTest{
 	// multi dimensional, if these pass, all types that don't require length prefix should pass
 	{
 		def:  `[{"type": "uint8[][]"}]`,
-		enc:  "00000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000008000000000000000000000000000000000000000000000000000000000000000E0000000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002",
+		enc:  "00000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000000a0000000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002",
 		want: [][]uint8{{1, 2}, {1, 2}},
 	},
 	{
@@ -183,7 +183,7 @@ var unpackTests = []unpackTest{
 	},
 	{
 		def:  `[{"type": "uint8[][2]"}]`,
-		enc:  "000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000000800000000000000000000000000000000000000000000000000000000000000001000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000001",
+		enc:  "0000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000000800000000000000000000000000000000000000000000000000000000000000001000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000001",
 		want: [2][]uint8{{1}, {1}},
 	},
 	{
@@ -331,6 +331,87 @@ var unpackTests = []unpackTest{
 		}{},
 		err: "abi: purely underscored output cannot unpack to struct",
 	},
+	// tuple types, encodings as produced by solc with ABIEncoderV2
+	{
+		def: `[{"name":"s","type":"tuple","components":[{"name":"a","type":"uint256"},{"name":"b","type":"bool"}]}]`,
+		enc: "00000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000001",
+		want: struct {
+			A *big.Int
+			B bool
+		}{big.NewInt(1), true},
+	},
+	{
+		def: `[{"name":"s","type":"tuple","components":[{"name":"a","type":"uint256"},{"name":"s","type":"string"},{"name":"c","type":"uint256[]"}]}]`,
+		enc: "00000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000005000000000000000000000000000000000000000000000000000000000000006000000000000000000000000000000000000000000000000000000000000000a0000000000000000000000000000000000000000000000000000000000000000568656c6c6f000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002",
+		want: struct {
+			A *big.Int
+			S string
+			C []*big.Int
+		}{big.NewInt(5), "hello", []*big.Int{big.NewInt(1), big.NewInt(2)}},
+	},
+	{
+		def: `[{"name":"s","type":"tuple[]","components":[{"name":"x","type":"uint256"},{"name":"y","type":"bytes"}]}]`,
+		enc: "00000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000000c00000000000000000000000000000000000000000000000000000000000000001000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000000020102000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000400000000000000000000000000000000000000000000000000000000000000000",
+		want: []struct {
+			X *big.Int
+			Y []byte
+		}{{big.NewInt(1), []byte{1, 2}}, {big.NewInt(2), []byte{}}},
+	},
+	{
+		def: `[{"name":"s","type":"tuple[2][]","components":[{"name":"x","type":"uint256"},{"name":"y","type":"uint256"}]}]`,
+		enc: "0000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000300000000000000000000000000000000000000000000000000000000000000040000000000000000000000000000000000000000000000000000000000000005000000000000000000000000000000000000000000000000000000000000000600000000000000000000000000000000000000000000000000000000000000070000000000000000000000000000000000000000000000000000000000000008",
+		want: [][2]struct {
+			X *big.Int
+			Y *big.Int
+		}{
+			{{big.NewInt(1), big.NewInt(2)}, {big.NewInt(3), big.NewInt(4)}},
+			{{big.NewInt(5), big.NewInt(6)}, {big.NewInt(7), big.NewInt(8)}},
+		},
+	},
+	{
+		def: `[{"name":"s","type":"tuple[][2]","components":[{"name":"s","type":"string"}]}]`,
+		enc: "0000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000000e0000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000161000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000000a0000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000016200000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000016300000000000000000000000000000000000000000000000000000000000000",
+		want: [2][]struct {
+			S string
+		}{{{"a"}}, {{"b"}, {"c"}}},
+	},
+	{
+		def: `[{"name":"s","type":"tuple","components":[{"name":"inner","type":"tuple","components":[{"name":"x","type":"uint256"},{"name":"y","type":"uint256[]"}]},{"name":"owner","type":"address"}]},{"name":"n","type":"uint256"}]`,
+		enc: "00000000000000000000000000000000000000000000000000000000000000400000000000000000000000000000000000000000000000000000000000000009000000000000000000000000000000000000000000000000000000000000004000000000000000000000000001010101010101010101010101010101010101010000000000000000000000000000000000000000000000000000000000000007000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000008",
+		want: struct {
+			S struct {
+				Inner struct {
+					X *big.Int
+					Y []*big.Int
+				}
+				Owner common.Address
+			}
+			N *big.Int
+		}{S: struct {
+			Inner struct {
+				X *big.Int
+				Y []*big.Int
+			}
+			Owner common.Address
+		}{struct {
+			X *big.Int
+			Y []*big.Int
+		}{big.NewInt(7), []*big.Int{big.NewInt(8)}}, common.HexToAddress("0101010101010101010101010101010101010101")}, N: big.NewInt(9)},
+	},
+	{
+		def: `[{"name":"s","type":"tuple","components":[{"name":"a","type":"uint256"},{"name":"b","type":"bool"}]},{"name":"n","type":"uint256"}]`,
+		enc: "000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002",
+		want: struct {
+			S struct {
+				A *big.Int
+				B bool
+			}
+			N *big.Int
+		}{struct {
+			A *big.Int
+			B bool
+		}{big.NewInt(1), true}, big.NewInt(2)},
+	},
 }
 
 func TestUnpack(t *testing.T) {
@@ -380,6 +461,44 @@ func methodMultiReturn(require *require.Assertions) (ABI, []byte, methodMultiOut
 	return abi, buff.Bytes(), expected
 }
 
+// TestUnpackTupleIntoStruct checks that tuples can be unpacked into named
+// struct types, like the ones generated by abigen.
+func TestUnpackTupleIntoStruct(t *testing.T) {
+	type Inner struct {
+		X *big.Int
+		Y []*big.Int
+	}
+	type Outer struct {
+		Inner Inner
+		Owner common.Address
+	}
+	def := `[{"name":"method","outputs":[{"name":"s","type":"tuple[]","components":[{"name":"inner","type":"tuple","components":[{"name":"x","type":"uint256"},{"name":"y","type":"uint256[]"}]},{"name":"owner","type":"address"}]}]}]`
+	abi, err := JSON(strings.NewReader(def))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Outer{
+		{Inner{big.NewInt(1), []*big.Int{big.NewInt(2), big.NewInt(3)}}, common.Address{1}},
+		{Inner{big.NewInt(4), []*big.Int{}}, common.Address{2}},
+	}
+	packed, err := abi.Methods["method"].Outputs.Pack(want)
+	if err != nil {
+		t.Fatal("pack error:", err)
+	}
+	var out []Outer
+	if err := abi.Unpack(&out, "method", packed); err != nil {
+		t.Fatal("unpack error:", err)
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("unpacked value mismatch:\ngot  %v\nwant %v", out, want)
+	}
+	// mismatching field names must be rejected
+	var bad []struct{ Foo *big.Int }
+	if err := abi.Unpack(&bad, "method", packed); err == nil {
+		t.Error("expected error for mismatching struct")
+	}
+}
+
 func TestMethodMultiReturn(t *testing.T) {
 	type reversed struct {
 		String string
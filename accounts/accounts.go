@@ -23,6 +23,7 @@ import (
 	etsc "github.com/ETSC3259/etsc"
 	"github.com/ETSC3259/etsc/common"
 	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/crypto"
 	"github.com/ETSC3259/etsc/event"
 )
 
@@ -113,6 +114,21 @@ type Wallet interface {
 	// the account in a keystore).
 	SignTx(account Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
 
+	// SignTypedData requests the wallet to sign EIP-712 typed structured data,
+	// given as the hash of its domain separator and the hash of its message struct.
+	// The signature is calculated over TypedDataHash(domainSeparator, messageHash).
+	//
+	// The two hashes are passed separately instead of the final digest so that
+	// hardware wallets may display them to the user before confirming.
+	//
+	// If the wallet requires additional authentication to sign the request (e.g.
+	// a password to decrypt the account, or a PIN code to verify the request),
+	// an AuthNeededError instance will be returned, containing infos for the user
+	// about which fields or actions are needed. The user may retry by providing
+	// the needed details via SignTypedDataWithPassphrase, or by other means (e.g.
+	// unlock the account in a keystore).
+	SignTypedData(account Account, domainSeparator, messageHash []byte) ([]byte, error)
+
 	// SignHashWithPassphrase requests the wallet to sign the given hash with the
 	// given passphrase as extra authentication information.
 	//
@@ -126,6 +142,38 @@ type Wallet interface {
 	// It looks up the account specified either solely via its address contained within,
 	// or optionally with the aid of any location metadata from the embedded URL field.
 	SignTxWithPassphrase(account Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+
+	// SignTypedDataWithPassphrase requests the wallet to sign EIP-712 typed
+	// structured data, with the given passphrase as extra authentication information.
+	//
+	// It looks up the account specified either solely via its address contained within,
+	// or optionally with the aid of any location metadata from the embedded URL field.
+	SignTypedDataWithPassphrase(account Account, passphrase string, domainSeparator, messageHash []byte) ([]byte, error)
+}
+
+// TypedDataHash calculates the EIP-712 digest of typed structured data from the
+// hash of its domain separator and the hash of its message struct.
+//
+// The hash is calculated as
+//   keccak256("\x19\x01" ‖ domainSeparator ‖ messageHash).
+func TypedDataHash(domainSeparator, messageHash []byte) []byte {
+	return crypto.Keccak256([]byte{0x19, 0x01}, domainSeparator, messageHash)
+}
+
+// Content types of the data payloads that can be signed via DataSigner.
+const (
+	MimetypeTextPlain = "text/plain"                  // Arbitrary data, signed with the personal message prefix
+	MimetypeClique    = "application/x-clique-header" // RLP encoded clique header, excluding the seal
+)
+
+// DataSigner is an optional interface implemented by wallets that sign whole data
+// payloads instead of precomputed hashes, such as remote signers which inspect the
+// content against their own policy before signing it. Produced signatures are in
+// the same [R || S || V] format (V being 0 or 1) as the ones of Wallet.SignHash.
+type DataSigner interface {
+	// SignData requests the wallet to sign the given data payload of the given
+	// content type, deriving the hash to sign according to the content type.
+	SignData(account Account, mimeType string, data []byte) ([]byte, error)
 }
 
 // Backend is a "wallet provider" that may contain a batch of accounts they can
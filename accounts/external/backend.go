@@ -0,0 +1,388 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package external implements an account backend delegating all signing to an
+// external signer (clef) through its external API.
+package external
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	etsc "github.com/ETSC3259/etsc"
+	"github.com/ETSC3259/etsc/accounts"
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/common/hexutil"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/event"
+	"github.com/ETSC3259/etsc/log"
+	"github.com/ETSC3259/etsc/rpc"
+)
+
+// ExternalScheme is the protocol scheme prefixing external signer wallet URLs.
+const ExternalScheme = "extapi"
+
+const (
+	// accountCacheLifetime is the time after which the accounts reported by the
+	// external signer are listed again, picking up any added or removed ones.
+	accountCacheLifetime = time.Minute
+
+	// accountErrorLifetime is the time after which a failed or denied listing of
+	// the accounts is retried.
+	accountErrorLifetime = 10 * time.Second
+)
+
+// errPasswordNotSupported is returned for all passphrase based operations, the
+// external signer manages its own credentials.
+var errPasswordNotSupported = errors.New("password-operations not supported on external signers")
+
+// requestDenied is the error message the external signer responds with if a
+// request was rejected by either its rules or its user.
+const requestDenied = "Request denied"
+
+// RequestDeniedError is returned by external signer wallets if the signer
+// declined to perform the requested operation.
+type RequestDeniedError struct {
+	Method string // External API method that was denied
+}
+
+// Error implements the standard error interface.
+func (err *RequestDeniedError) Error() string {
+	return fmt.Sprintf("external signer denied %s request", err.Method)
+}
+
+// ExternalBackend is an account backend wrapping a single external signer.
+type ExternalBackend struct {
+	signers []accounts.Wallet
+}
+
+// NewExternalBackend creates an account backend connected to the external
+// signer listening on the given endpoint (url or path to an IPC file).
+func NewExternalBackend(endpoint string) (*ExternalBackend, error) {
+	signer, err := NewExternalSigner(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &ExternalBackend{signers: []accounts.Wallet{signer}}, nil
+}
+
+// Wallets implements accounts.Backend, returning the external signer.
+func (eb *ExternalBackend) Wallets() []accounts.Wallet {
+	return eb.signers
+}
+
+// Subscribe implements accounts.Backend. The external signer is connected for
+// the lifetime of the backend, so no wallet events are ever emitted.
+func (eb *ExternalBackend) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+// ExternalSigner is a wallet forwarding account listing and signing requests to
+// an external signer. It never holds any keys itself, all signing policy is
+// enforced on the other side of the connection.
+type ExternalSigner struct {
+	client   *rpc.Client
+	endpoint string
+	status   string
+
+	cache       []accounts.Account // Accounts last reported by the external signer
+	cacheExpiry time.Time          // Time after which the accounts are listed again
+	cacheMu     sync.RWMutex       // Lock protecting the account cache
+}
+
+// NewExternalSigner connects to the external signer listening on the given
+// endpoint (url or path to an IPC file).
+func NewExternalSigner(endpoint string) (*ExternalSigner, error) {
+	client, err := rpc.Dial(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return newExternalSigner(client, endpoint)
+}
+
+// newExternalSigner wraps an established connection to an external signer,
+// checking that it actually speaks the external API.
+func newExternalSigner(client *rpc.Client, endpoint string) (*ExternalSigner, error) {
+	signer := &ExternalSigner{
+		client:   client,
+		endpoint: endpoint,
+	}
+	version, err := signer.version()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	signer.status = fmt.Sprintf("ok [version=%v]", version)
+	return signer, nil
+}
+
+// URL implements accounts.Wallet, returning the endpoint of the external signer.
+func (api *ExternalSigner) URL() accounts.URL {
+	return accounts.URL{Scheme: ExternalScheme, Path: api.endpoint}
+}
+
+// Status implements accounts.Wallet, returning the version of the external API.
+func (api *ExternalSigner) Status() (string, error) {
+	return api.status, nil
+}
+
+// Open implements accounts.Wallet. The external signer unlocks its accounts on
+// its own, so this is a noop.
+func (api *ExternalSigner) Open(passphrase string) error {
+	return nil
+}
+
+// Close implements accounts.Wallet. The connection to the external signer is
+// kept for the lifetime of the wallet, so this is a noop.
+func (api *ExternalSigner) Close() error {
+	return nil
+}
+
+// Accounts implements accounts.Wallet, returning the accounts the external
+// signer is willing to expose. Listing may require user approval on the signer
+// side, so the accounts are cached and only requested again once the cache
+// expires, even if none were reported. If listing fails, the previously reported
+// accounts are returned and the listing is retried after a shorter delay.
+func (api *ExternalSigner) Accounts() []accounts.Account {
+	api.cacheMu.RLock()
+	cache, fresh := api.cache, time.Now().Before(api.cacheExpiry)
+	api.cacheMu.RUnlock()
+
+	if fresh {
+		return cache
+	}
+	addresses, err := api.listAccounts()
+	if err != nil {
+		log.Error("Failed to list external signer accounts", "endpoint", api.endpoint, "err", err)
+
+		api.cacheMu.Lock()
+		api.cacheExpiry = time.Now().Add(accountErrorLifetime)
+		api.cacheMu.Unlock()
+		return cache
+	}
+	accs := make([]accounts.Account, len(addresses))
+	for i, addr := range addresses {
+		accs[i] = accounts.Account{Address: addr, URL: api.URL()}
+	}
+	api.cacheMu.Lock()
+	api.cache, api.cacheExpiry = accs, time.Now().Add(accountCacheLifetime)
+	api.cacheMu.Unlock()
+
+	return accs
+}
+
+// Contains implements accounts.Wallet, returning whether a particular account
+// is or is not exposed by the external signer.
+func (api *ExternalSigner) Contains(account accounts.Account) bool {
+	for _, acc := range api.Accounts() {
+		if acc.Address == account.Address && (account.URL == (accounts.URL{}) || account.URL == api.URL()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Derive implements accounts.Wallet, but is not supported by external signers.
+func (api *ExternalSigner) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	return accounts.Account{}, accounts.ErrNotSupported
+}
+
+// SelfDerive implements accounts.Wallet, but is a noop for external signers.
+func (api *ExternalSigner) SelfDerive(base accounts.DerivationPath, chain etsc.ChainStateReader) {
+}
+
+// SignHash implements accounts.Wallet. Signing arbitrary hashes would bypass
+// the signer's ability to inspect what it signs, so it is not supported; use
+// SignData instead.
+func (api *ExternalSigner) SignHash(account accounts.Account, hash []byte) ([]byte, error) {
+	return nil, accounts.ErrNotSupported
+}
+
+// SignData implements accounts.DataSigner, requesting the external signer to
+// sign the given data of the given content type.
+func (api *ExternalSigner) SignData(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+	var (
+		res    hexutil.Bytes
+		err    error
+		method string
+		addr   = common.NewMixedcaseAddress(account.Address)
+	)
+	switch mimeType {
+	case accounts.MimetypeTextPlain:
+		method = "account_sign"
+		err = api.client.Call(&res, method, &addr, hexutil.Bytes(data))
+	case accounts.MimetypeClique:
+		method = "account_signData"
+		err = api.client.Call(&res, method, mimeType, &addr, hexutil.Bytes(data))
+	default:
+		return nil, accounts.ErrNotSupported
+	}
+	if err != nil {
+		return nil, wrapError(method, err)
+	}
+	if len(res) != 65 {
+		return nil, fmt.Errorf("invalid signature length from external signer: %d", len(res))
+	}
+	// The external API returns signatures with V 27/28, transform it back to 0/1
+	if res[64] == 27 || res[64] == 28 {
+		res[64] -= 27
+	}
+	return res, nil
+}
+
+// SignTx implements accounts.Wallet, requesting the external signer to sign the
+// given transaction. The returned transaction is checked to be the requested one,
+// signed by the requested account for the requested chain.
+func (api *ExternalSigner) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	args := &sendTxArgs{
+		From:     common.NewMixedcaseAddress(account.Address),
+		Gas:      hexutil.Uint64(tx.Gas()),
+		GasPrice: hexutil.Big(*tx.GasPrice()),
+		Value:    hexutil.Big(*tx.Value()),
+		Nonce:    hexutil.Uint64(tx.Nonce()),
+		Data:     hexutil.Bytes(tx.Data()),
+	}
+	if to := tx.To(); to != nil {
+		addr := common.NewMixedcaseAddress(*to)
+		args.To = &addr
+	}
+	var res signTransactionResult
+	if err := api.client.Call(&res, "account_signTransaction", args, nil); err != nil {
+		return nil, wrapError("account_signTransaction", err)
+	}
+	signed := res.Tx
+	if signed == nil {
+		return nil, errors.New("external signer returned no transaction")
+	}
+	if err := checkSignedTx(tx, signed); err != nil {
+		return nil, err
+	}
+	var signer types.Signer = types.HomesteadSigner{}
+	if chainID != nil {
+		if !signed.Protected() || signed.ChainId().Cmp(chainID) != 0 {
+			return nil, fmt.Errorf("external signer chain mismatch: have %v, want %v", signed.ChainId(), chainID)
+		}
+		signer = types.NewEIP155Signer(chainID)
+	}
+	sender, err := types.Sender(signer, signed)
+	if err != nil {
+		return nil, err
+	}
+	if sender != account.Address {
+		return nil, fmt.Errorf("external signer sender mismatch: have %x, want %x", sender, account.Address)
+	}
+	return signed, nil
+}
+
+// SignTypedData implements accounts.Wallet, but is not supported by external
+// signers through this interface.
+func (api *ExternalSigner) SignTypedData(account accounts.Account, domainSeparator, messageHash []byte) ([]byte, error) {
+	return nil, accounts.ErrNotSupported
+}
+
+// SignHashWithPassphrase implements accounts.Wallet, but passphrases are not
+// supported by external signers.
+func (api *ExternalSigner) SignHashWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
+	return nil, errPasswordNotSupported
+}
+
+// SignTxWithPassphrase implements accounts.Wallet, but passphrases are not
+// supported by external signers.
+func (api *ExternalSigner) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return nil, errPasswordNotSupported
+}
+
+// SignTypedDataWithPassphrase implements accounts.Wallet, but passphrases are
+// not supported by external signers.
+func (api *ExternalSigner) SignTypedDataWithPassphrase(account accounts.Account, passphrase string, domainSeparator, messageHash []byte) ([]byte, error) {
+	return nil, errPasswordNotSupported
+}
+
+// checkSignedTx verifies that the transaction returned by the external signer
+// carries the same payload as the one requested to be signed.
+func checkSignedTx(tx, signed *types.Transaction) error {
+	mismatch := func(field string, have, want interface{}) error {
+		return fmt.Errorf("external signer %s mismatch: have %v, want %v", field, have, want)
+	}
+	switch {
+	case signed.Nonce() != tx.Nonce():
+		return mismatch("nonce", signed.Nonce(), tx.Nonce())
+	case (signed.To() == nil) != (tx.To() == nil) || (tx.To() != nil && *signed.To() != *tx.To()):
+		return mismatch("recipient", signed.To(), tx.To())
+	case signed.Value().Cmp(tx.Value()) != 0:
+		return mismatch("value", signed.Value(), tx.Value())
+	case signed.Gas() != tx.Gas():
+		return mismatch("gas", signed.Gas(), tx.Gas())
+	case signed.GasPrice().Cmp(tx.GasPrice()) != 0:
+		return mismatch("gas price", signed.GasPrice(), tx.GasPrice())
+	case !bytes.Equal(signed.Data(), tx.Data()):
+		return mismatch("data", hexutil.Bytes(signed.Data()), hexutil.Bytes(tx.Data()))
+	}
+	return nil
+}
+
+// listAccounts retrieves the addresses exposed by the external signer.
+func (api *ExternalSigner) listAccounts() ([]common.Address, error) {
+	var res []common.Address
+	if err := api.client.Call(&res, "account_list"); err != nil {
+		return nil, wrapError("account_list", err)
+	}
+	return res, nil
+}
+
+// version retrieves the external API version of the signer.
+func (api *ExternalSigner) version() (string, error) {
+	var version string
+	if err := api.client.Call(&version, "account_version"); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// wrapError converts a denial reported by the external signer into a typed
+// error, leaving any other error untouched.
+func wrapError(method string, err error) error {
+	if err.Error() == requestDenied {
+		return &RequestDeniedError{Method: method}
+	}
+	return err
+}
+
+// sendTxArgs is the transaction format expected by the external signer's
+// account_signTransaction method.
+type sendTxArgs struct {
+	From     common.MixedcaseAddress  `json:"from"`
+	To       *common.MixedcaseAddress `json:"to"`
+	Gas      hexutil.Uint64           `json:"gas"`
+	GasPrice hexutil.Big              `json:"gasPrice"`
+	Value    hexutil.Big              `json:"value"`
+	Nonce    hexutil.Uint64           `json:"nonce"`
+	Data     hexutil.Bytes            `json:"data"`
+}
+
+// signTransactionResult is the response of the external signer's
+// account_signTransaction method.
+type signTransactionResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
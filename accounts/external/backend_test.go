@@ -0,0 +1,305 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package external
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ETSC3259/etsc/accounts"
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/common/hexutil"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/rpc"
+)
+
+// TxArgs mirrors the transaction format of the external API.
+type TxArgs struct {
+	From     common.MixedcaseAddress  `json:"from"`
+	To       *common.MixedcaseAddress `json:"to"`
+	Gas      hexutil.Uint64           `json:"gas"`
+	GasPrice hexutil.Big              `json:"gasPrice"`
+	Value    hexutil.Big              `json:"value"`
+	Nonce    hexutil.Uint64           `json:"nonce"`
+	Data     hexutil.Bytes            `json:"data"`
+}
+
+// TxResult mirrors the signed transaction format of the external API.
+type TxResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
+
+// FakeSigner is a minimal external API implementation signing everything with
+// a single key, unless told to deny all requests.
+type FakeSigner struct {
+	key     *ecdsa.PrivateKey
+	chainID *big.Int
+	deny    bool
+	hide    bool
+	lists   int
+
+	tamper func(*TxArgs) // Modifies the requested transaction before signing
+}
+
+func (s *FakeSigner) Version() string {
+	return "4.2.0"
+}
+
+func (s *FakeSigner) List() ([]common.Address, error) {
+	s.lists++
+	if s.deny {
+		return nil, errors.New(requestDenied)
+	}
+	if s.hide {
+		return []common.Address{}, nil
+	}
+	return []common.Address{crypto.PubkeyToAddress(s.key.PublicKey)}, nil
+}
+
+func (s *FakeSigner) sign(hash []byte) (hexutil.Bytes, error) {
+	if s.deny {
+		return nil, errors.New(requestDenied)
+	}
+	sig, err := crypto.Sign(hash, s.key)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
+
+func (s *FakeSigner) Sign(addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error) {
+	return s.sign(textHash(data))
+}
+
+func (s *FakeSigner) SignData(contentType string, addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error) {
+	if contentType != accounts.MimetypeClique {
+		return nil, errors.New("unsupported content type")
+	}
+	return s.sign(crypto.Keccak256(data))
+}
+
+func (s *FakeSigner) SignTransaction(args TxArgs, methodSelector *string) (*TxResult, error) {
+	if s.deny {
+		return nil, errors.New(requestDenied)
+	}
+	if s.tamper != nil {
+		s.tamper(&args)
+	}
+	var tx *types.Transaction
+	if args.To == nil {
+		tx = types.NewContractCreation(uint64(args.Nonce), (*big.Int)(&args.Value), uint64(args.Gas), (*big.Int)(&args.GasPrice), args.Data)
+	} else {
+		tx = types.NewTransaction(uint64(args.Nonce), args.To.Address(), (*big.Int)(&args.Value), uint64(args.Gas), (*big.Int)(&args.GasPrice), args.Data)
+	}
+	signed, err := types.SignTx(tx, types.NewEIP155Signer(s.chainID), s.key)
+	if err != nil {
+		return nil, err
+	}
+	return &TxResult{Tx: signed}, nil
+}
+
+// textHash calculates the hash of a message signed with the personal message prefix.
+func textHash(data []byte) []byte {
+	msg := fmt.Sprintf("\x19etsc Signed Message:\n%d%s", len(data), data)
+	return crypto.Keccak256([]byte(msg))
+}
+
+func newTestSigner(t *testing.T) (*ExternalSigner, *FakeSigner) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := &FakeSigner{key: key, chainID: big.NewInt(1337)}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", backend); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := newExternalSigner(rpc.DialInProc(server), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, backend
+}
+
+// Tests that accounts are listed from the external signer and cached until the
+// cache expires.
+func TestExternalSignerAccounts(t *testing.T) {
+	signer, backend := newTestSigner(t)
+
+	if status, _ := signer.Status(); status != "ok [version=4.2.0]" {
+		t.Errorf("status mismatch: have %q", status)
+	}
+	want := crypto.PubkeyToAddress(backend.key.PublicKey)
+	for i := 0; i < 2; i++ {
+		accs := signer.Accounts()
+		if len(accs) != 1 || accs[0].Address != want {
+			t.Fatalf("accounts mismatch: have %v, want %x", accs, want)
+		}
+		if accs[0].URL != signer.URL() {
+			t.Errorf("account URL mismatch: have %v, want %v", accs[0].URL, signer.URL())
+		}
+	}
+	if backend.lists != 1 {
+		t.Errorf("account listing not cached: %d requests", backend.lists)
+	}
+	// Expire the cache and ensure the accounts are listed again, falling back to
+	// the stale ones if the listing fails
+	signer.cacheExpiry = time.Now()
+	if accs := signer.Accounts(); len(accs) != 1 || backend.lists != 2 {
+		t.Errorf("expired cache not refreshed: %d requests, accounts %v", backend.lists, accs)
+	}
+	signer.cacheExpiry = time.Now()
+	backend.deny = true
+	if accs := signer.Accounts(); len(accs) != 1 || backend.lists != 3 {
+		t.Errorf("stale accounts not returned: %d requests, accounts %v", backend.lists, accs)
+	}
+	// Ensure failed listings are not retried until the error backoff expires
+	if accs := signer.Accounts(); len(accs) != 1 || backend.lists != 3 {
+		t.Errorf("failed listing retried: %d requests, accounts %v", backend.lists, accs)
+	}
+	if wait := time.Until(signer.cacheExpiry); wait > accountErrorLifetime {
+		t.Errorf("error backoff too long: have %v, want at most %v", wait, accountErrorLifetime)
+	}
+	backend.deny = false
+	if !signer.Contains(accounts.Account{Address: want}) {
+		t.Errorf("signer doesn't contain its own account")
+	}
+	if signer.Contains(accounts.Account{Address: common.Address{1}}) {
+		t.Errorf("signer contains unknown account")
+	}
+	// Ensure an empty listing is cached too
+	signer.cacheExpiry = time.Now()
+	backend.hide, backend.lists = true, 0
+	for i := 0; i < 2; i++ {
+		if accs := signer.Accounts(); len(accs) != 0 {
+			t.Fatalf("hidden accounts reported: %v", accs)
+		}
+	}
+	if backend.lists != 1 {
+		t.Errorf("empty account listing not cached: %d requests", backend.lists)
+	}
+}
+
+// Tests that data and clique headers are signed by the external signer, and
+// that the returned signatures are in the [R || S || V] format with V 0/1.
+func TestExternalSignerSignData(t *testing.T) {
+	signer, backend := newTestSigner(t)
+	account := accounts.Account{Address: crypto.PubkeyToAddress(backend.key.PublicKey)}
+
+	tests := []struct {
+		mimeType string
+		hash     []byte
+	}{
+		{accounts.MimetypeTextPlain, textHash([]byte("hello"))},
+		{accounts.MimetypeClique, crypto.Keccak256([]byte("hello"))},
+	}
+	for _, tt := range tests {
+		sig, err := signer.SignData(account, tt.mimeType, []byte("hello"))
+		if err != nil {
+			t.Fatalf("%s: failed to sign: %v", tt.mimeType, err)
+		}
+		pubkey, err := crypto.SigToPub(tt.hash, sig)
+		if err != nil {
+			t.Fatalf("%s: failed to recover signer: %v", tt.mimeType, err)
+		}
+		if addr := crypto.PubkeyToAddress(*pubkey); addr != account.Address {
+			t.Errorf("%s: signer mismatch: have %x, want %x", tt.mimeType, addr, account.Address)
+		}
+	}
+	if _, err := signer.SignData(account, "application/x-unknown", nil); err != accounts.ErrNotSupported {
+		t.Errorf("unknown content type error mismatch: have %v, want %v", err, accounts.ErrNotSupported)
+	}
+	if _, err := signer.SignHash(account, make([]byte, 32)); err != accounts.ErrNotSupported {
+		t.Errorf("hash signing error mismatch: have %v, want %v", err, accounts.ErrNotSupported)
+	}
+}
+
+// Tests that transactions are signed by the external signer and verified to
+// have been signed by the right account on the right chain.
+func TestExternalSignerSignTx(t *testing.T) {
+	signer, backend := newTestSigner(t)
+	account := accounts.Account{Address: crypto.PubkeyToAddress(backend.key.PublicKey)}
+
+	tx := types.NewTransaction(1, common.Address{0x13, 0x37}, big.NewInt(1), 21000, big.NewInt(1), nil)
+	signed, err := signer.SignTx(account, tx, backend.chainID)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	if signed.Hash() == tx.Hash() {
+		t.Errorf("transaction not signed")
+	}
+	if _, err := signer.SignTx(account, tx, big.NewInt(1)); err == nil {
+		t.Errorf("chain mismatch not detected")
+	}
+	if _, err := signer.SignTx(accounts.Account{Address: common.Address{1}}, tx, backend.chainID); err == nil {
+		t.Errorf("sender mismatch not detected")
+	}
+	if _, err := signer.SignTxWithPassphrase(account, "", tx, backend.chainID); err != errPasswordNotSupported {
+		t.Errorf("passphrase signing error mismatch: have %v, want %v", err, errPasswordNotSupported)
+	}
+}
+
+// Tests that transactions modified by the external signer are rejected.
+func TestExternalSignerSignTxTampered(t *testing.T) {
+	signer, backend := newTestSigner(t)
+	account := accounts.Account{Address: crypto.PubkeyToAddress(backend.key.PublicKey)}
+
+	tests := map[string]func(*TxArgs){
+		"nonce":     func(args *TxArgs) { args.Nonce++ },
+		"recipient": func(args *TxArgs) { args.To = nil },
+		"value":     func(args *TxArgs) { args.Value = hexutil.Big(*big.NewInt(1000)) },
+		"gas":       func(args *TxArgs) { args.Gas++ },
+		"gas price": func(args *TxArgs) { args.GasPrice = hexutil.Big(*big.NewInt(1000)) },
+		"data":      func(args *TxArgs) { args.Data = hexutil.Bytes{0xde, 0xad} },
+	}
+	tx := types.NewTransaction(1, common.Address{0x13, 0x37}, big.NewInt(1), 21000, big.NewInt(1), nil)
+	for field, tamper := range tests {
+		backend.tamper = tamper
+		if _, err := signer.SignTx(account, tx, backend.chainID); err == nil || !strings.Contains(err.Error(), field+" mismatch") {
+			t.Errorf("%s: tampering error mismatch: have %v", field, err)
+		}
+	}
+}
+
+// Tests that denials by the external signer are surfaced as typed errors.
+func TestExternalSignerDenied(t *testing.T) {
+	signer, backend := newTestSigner(t)
+	account := accounts.Account{Address: crypto.PubkeyToAddress(backend.key.PublicKey)}
+	backend.deny = true
+
+	if accs := signer.Accounts(); len(accs) != 0 {
+		t.Errorf("denied listing returned accounts: %v", accs)
+	}
+	_, err := signer.SignData(account, accounts.MimetypeClique, []byte("hello"))
+	if denied, ok := err.(*RequestDeniedError); !ok || denied.Method != "account_signData" {
+		t.Errorf("data signing error mismatch: have %v", err)
+	}
+	tx := types.NewTransaction(1, common.Address{0x13, 0x37}, big.NewInt(1), 21000, big.NewInt(1), nil)
+	_, err = signer.SignTx(account, tx, backend.chainID)
+	if denied, ok := err.(*RequestDeniedError); !ok || denied.Method != "account_signTransaction" {
+		t.Errorf("transaction signing error mismatch: have %v", err)
+	}
+}
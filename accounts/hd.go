@@ -116,6 +116,17 @@ func ParseDerivationPath(path string) (DerivationPath, error) {
 	return result, nil
 }
 
+// DefaultDerivationPaths returns the derivation paths of the first n accounts
+// of the default base derivation path.
+func DefaultDerivationPaths(n int) []DerivationPath {
+	paths := make([]DerivationPath, n)
+	for i := range paths {
+		paths[i] = append(DerivationPath{}, DefaultBaseDerivationPath...)
+		paths[i][len(paths[i])-1] = uint32(i)
+	}
+	return paths
+}
+
 // String implements the stringer interface, converting a binary derivation path
 // to its canonical representation.
 func (path DerivationPath) String() string {
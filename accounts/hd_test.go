@@ -17,6 +17,7 @@
 package accounts
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 )
@@ -77,3 +78,20 @@ func TestHDPathParsing(t *testing.T) {
 		}
 	}
 }
+
+// Tests that the default derivation paths increment the last component of the
+// default base path, without aliasing each other.
+func TestDefaultDerivationPaths(t *testing.T) {
+	paths := DefaultDerivationPaths(3)
+	if len(paths) != 3 {
+		t.Fatalf("path count mismatch: have %d, want 3", len(paths))
+	}
+	for i, path := range paths {
+		if want := fmt.Sprintf("m/44'/60'/0'/0/%d", i); path.String() != want {
+			t.Errorf("path %d: mismatch: have %s, want %s", i, path, want)
+		}
+	}
+	if DefaultBaseDerivationPath.String() != "m/44'/60'/0'/0/0" {
+		t.Errorf("default base path modified: %s", DefaultBaseDerivationPath)
+	}
+}
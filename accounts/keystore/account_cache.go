@@ -69,6 +69,7 @@ type accountCache struct {
 	mu       sync.Mutex
 	all      accountsByURL
 	byAddr   map[common.Address][]accounts.Account
+	seeds    map[string][]accounts.Account // Accounts pinned to each seed file, keyed by path
 	throttle *time.Timer
 	notify   chan struct{}
 	fileC    fileCache
@@ -78,6 +79,7 @@ func newAccountCache(keydir string) (*accountCache, chan struct{}) {
 	ac := &accountCache{
 		keydir: keydir,
 		byAddr: make(map[common.Address][]accounts.Account),
+		seeds:  make(map[string][]accounts.Account),
 		notify: make(chan struct{}, 1),
 		fileC:  fileCache{all: mapset.NewThreadUnsafeSet()},
 	}
@@ -116,6 +118,71 @@ func (ac *accountCache) add(newAccount accounts.Account) {
 	ac.byAddr[newAccount.Address] = append(ac.byAddr[newAccount.Address], newAccount)
 }
 
+// addSeed sets the list of accounts pinned to a seed file, replacing any that
+// were previously tracked for it.
+func (ac *accountCache) addSeed(path string, pinned []accounts.Account) {
+	ac.deleteByFile(path)
+	for _, account := range pinned {
+		ac.add(account)
+	}
+	ac.mu.Lock()
+	ac.seeds[path] = pinned
+	ac.mu.Unlock()
+}
+
+// seedFiles returns the sorted paths of all seed files in the keystore.
+func (ac *accountCache) seedFiles() []string {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	files := make([]string, 0, len(ac.seeds))
+	for path := range ac.seeds {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// hasSeed reports whether the given path is a known seed file.
+func (ac *accountCache) hasSeed(path string) bool {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	_, ok := ac.seeds[path]
+	return ok
+}
+
+// seedAccounts returns the accounts pinned to the given seed file.
+func (ac *accountCache) seedAccounts(path string) []accounts.Account {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	cpy := make([]accounts.Account, len(ac.seeds[path]))
+	copy(cpy, ac.seeds[path])
+	return cpy
+}
+
+// seedPath resolves an account URL into the seed file it was derived from and
+// its derivation path within. Accounts backed by plain key files are rejected.
+func (ac *accountCache) seedPath(url accounts.URL) (string, accounts.DerivationPath, bool) {
+	i := strings.LastIndex(url.Path, "/m/")
+	if i < 0 {
+		return "", nil, false
+	}
+	ac.mu.Lock()
+	_, ok := ac.seeds[url.Path[:i]]
+	ac.mu.Unlock()
+
+	if !ok {
+		return "", nil, false
+	}
+	path, err := accounts.ParseDerivationPath(url.Path[i+1:])
+	if err != nil {
+		return "", nil, false
+	}
+	return url.Path[:i], path, true
+}
+
 // note: removed needs to be unique here (i.e. both File and Address must be set).
 func (ac *accountCache) delete(removed accounts.Account) {
 	ac.mu.Lock()
@@ -129,10 +196,24 @@ func (ac *accountCache) delete(removed accounts.Account) {
 	}
 }
 
-// deleteByFile removes an account referenced by the given path.
+// deleteByFile removes an account referenced by the given path, or all accounts
+// pinned to it if the path is a seed file.
 func (ac *accountCache) deleteByFile(path string) {
 	ac.mu.Lock()
 	defer ac.mu.Unlock()
+
+	if pinned, ok := ac.seeds[path]; ok {
+		for _, removed := range pinned {
+			ac.all = removeAccount(ac.all, removed)
+			if ba := removeAccount(ac.byAddr[removed.Address], removed); len(ba) == 0 {
+				delete(ac.byAddr, removed.Address)
+			} else {
+				ac.byAddr[removed.Address] = ba
+			}
+		}
+		delete(ac.seeds, path)
+		return
+	}
 	i := sort.Search(len(ac.all), func(i int) bool { return ac.all[i].URL.Path >= path })
 
 	if i < len(ac.all) && ac.all[i].URL.Path == path {
@@ -244,9 +325,19 @@ func (ac *accountCache) scanAccounts() error {
 	var (
 		buf = new(bufio.Reader)
 		key struct {
-			Address string `json:"address"`
+			Address string  `json:"address"`
+			HD      *hdJSON `json:"hd"`
 		}
 	)
+	// readSeed is invoked for files holding an HD seed instead of a single key
+	readSeed := func(path string) {
+		pinned, err := key.HD.parseAccounts(path)
+		if err != nil {
+			log.Debug("Failed to decode keystore seed", "path", path, "err", err)
+			return
+		}
+		ac.addSeed(path, pinned)
+	}
 	readAccount := func(path string) *accounts.Account {
 		fd, err := os.Open(path)
 		if err != nil {
@@ -256,12 +347,14 @@ func (ac *accountCache) scanAccounts() error {
 		defer fd.Close()
 		buf.Reset(fd)
 		// Parse the address.
-		key.Address = ""
+		key.Address, key.HD = "", nil
 		err = json.NewDecoder(buf).Decode(&key)
 		addr := common.HexToAddress(key.Address)
 		switch {
 		case err != nil:
 			log.Debug("Failed to decode keystore key", "path", path, "err", err)
+		case key.HD != nil:
+			readSeed(path)
 		case (addr == common.Address{}):
 			log.Debug("Failed to decode keystore key", "path", path, "err", "missing or zero address")
 		default:
@@ -36,7 +36,8 @@ import (
 )
 
 const (
-	version = 3
+	version   = 3
+	versionV4 = 4
 )
 
 type Key struct {
@@ -46,6 +47,21 @@ type Key struct {
 	// we only store privkey as pubkey/address can be derived from it
 	// privkey in this struct is always in plaintext
 	PrivateKey *ecdsa.PrivateKey
+
+	// Optional descriptive metadata, only stored in version 4 key files
+	Label string // Free form description of the key
+	Path  string // Derivation path the key originates from, if any
+
+	// format is the on-disk layout the key was decrypted from and is stored in
+	// when encrypted again. The zero value is a version 3 scrypt key file.
+	format KeyFormat
+}
+
+// Format returns the on-disk layout the key is stored in when encrypted again.
+// This is the layout it was decrypted from, except for legacy key files which
+// are upgraded to version 3 scrypt ones.
+func (k *Key) Format() KeyFormat {
+	return k.format.normalize()
 }
 
 type keyStore interface {
@@ -71,6 +87,15 @@ type encryptedKeyJSONV3 struct {
 	Version int        `json:"version"`
 }
 
+type encryptedKeyJSONV4 struct {
+	Address string       `json:"address"`
+	Crypto  cryptoJSONV4 `json:"crypto"`
+	Label   string       `json:"label,omitempty"`
+	Path    string       `json:"path,omitempty"`
+	Id      string       `json:"id"`
+	Version int          `json:"version"`
+}
+
 type encryptedKeyJSONV1 struct {
 	Address string     `json:"address"`
 	Crypto  CryptoJSON `json:"crypto"`
@@ -91,6 +116,21 @@ type cipherparamsJSON struct {
 	IV string `json:"iv"`
 }
 
+// cryptoJSONV4 is the encryption section of a version 4 key file, split into
+// separate modules for deriving the decryption key, verifying it and decrypting
+// the private key.
+type cryptoJSONV4 struct {
+	KDF      cryptoModuleJSON `json:"kdf"`
+	Checksum cryptoModuleJSON `json:"checksum"`
+	Cipher   cryptoModuleJSON `json:"cipher"`
+}
+
+type cryptoModuleJSON struct {
+	Function string                 `json:"function"`
+	Params   map[string]interface{} `json:"params"`
+	Message  string                 `json:"message"`
+}
+
 func (k *Key) MarshalJSON() (j []byte, err error) {
 	jStruct := plainKeyJSON{
 		hex.EncodeToString(k.Address[:]),
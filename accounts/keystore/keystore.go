@@ -23,13 +23,17 @@ package keystore
 import (
 	"crypto/ecdsa"
 	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math/big"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 
@@ -38,12 +42,17 @@ import (
 	"github.com/ETSC3259/etsc/core/types"
 	"github.com/ETSC3259/etsc/crypto"
 	"github.com/ETSC3259/etsc/event"
+	"github.com/pborman/uuid"
 )
 
 var (
 	ErrLocked  = accounts.NewAuthNeededError("password or unlock")
 	ErrNoMatch = errors.New("no key for given address or file")
 	ErrDecrypt = errors.New("could not decrypt key with given passphrase")
+
+	// ErrKeyMetadata is returned if a key with a label or derivation path is
+	// stored in a version 3 key file, which would silently drop the metadata.
+	ErrKeyMetadata = errors.New("version 3 key files cannot store key metadata")
 )
 
 // KeyStoreType is the reflect type of a keystore backend.
@@ -67,7 +76,8 @@ type KeyStore struct {
 	updateScope event.SubscriptionScope // Subscription scope tracking current live listeners
 	updating    bool                    // Whetsc the event notification loop is running
 
-	mu sync.RWMutex
+	mu       sync.RWMutex
+	seedLock sync.Mutex // Serializes rewrites of the accounts pinned in seed files
 }
 
 type unlocked struct {
@@ -108,11 +118,55 @@ func (ks *KeyStore) init(keydir string) {
 		m.cache.close()
 	})
 	// Create the initial list of wallets from the cache
-	accs := ks.cache.accounts()
-	ks.wallets = make([]accounts.Wallet, len(accs))
-	for i := 0; i < len(accs); i++ {
-		ks.wallets[i] = &keystoreWallet{account: accs[i], keystore: ks}
+	for _, source := range ks.walletSources() {
+		ks.wallets = append(ks.wallets, source.wallet(ks))
+	}
+}
+
+// walletSource is a key file or seed file in the keystore directory that should
+// be wrapped into a wallet.
+type walletSource struct {
+	url     accounts.URL      // URL of the file backing the wallet
+	account *accounts.Account // Account within the key file, nil for seed files
+}
+
+// wallet creates a new wallet wrapping the source file.
+func (s walletSource) wallet(ks *KeyStore) accounts.Wallet {
+	if s.account == nil {
+		return newSeedWallet(ks, s.url.Path)
+	}
+	return &keystoreWallet{account: *s.account, keystore: ks}
+}
+
+// matches reports whether an existing wallet is still a valid wrapper of the
+// source file.
+func (s walletSource) matches(wallet accounts.Wallet) bool {
+	switch wallet := wallet.(type) {
+	case *seedWallet:
+		return s.account == nil
+	case *keystoreWallet:
+		return s.account != nil && wallet.account == *s.account
+	}
+	return false
+}
+
+// walletSources retrieves the current list of key and seed files, sorted by URL.
+func (ks *KeyStore) walletSources() []walletSource {
+	var (
+		accs    = ks.cache.accounts()
+		seeds   = ks.cache.seedFiles()
+		sources = make([]walletSource, 0, len(accs)+len(seeds))
+	)
+	for i := range accs {
+		if _, _, ok := ks.cache.seedPath(accs[i].URL); !ok {
+			sources = append(sources, walletSource{url: accs[i].URL, account: &accs[i]})
+		}
 	}
+	for _, path := range seeds {
+		sources = append(sources, walletSource{url: accounts.URL{Scheme: KeyStoreScheme, Path: path}})
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].url.Cmp(sources[j].url) < 0 })
+	return sources
 }
 
 // Wallets implements accounts.Backend, returning all single-key wallets from the
@@ -132,34 +186,36 @@ func (ks *KeyStore) Wallets() []accounts.Wallet {
 // refreshWallets retrieves the current account list and based on that does any
 // necessary wallet refreshes.
 func (ks *KeyStore) refreshWallets() {
-	// Retrieve the current list of accounts
+	// Retrieve the current list of key and seed files
 	ks.mu.Lock()
-	accs := ks.cache.accounts()
+	sources := ks.walletSources()
 
 	// Transform the current list of wallets into the new one
-	wallets := make([]accounts.Wallet, 0, len(accs))
+	wallets := make([]accounts.Wallet, 0, len(sources))
 	events := []accounts.WalletEvent{}
 
-	for _, account := range accs {
-		// Drop wallets while they were in front of the next account
-		for len(ks.wallets) > 0 && ks.wallets[0].URL().Cmp(account.URL) < 0 {
+	for _, source := range sources {
+		// Drop wallets while they were in front of the next file
+		for len(ks.wallets) > 0 && ks.wallets[0].URL().Cmp(source.url) < 0 {
 			events = append(events, accounts.WalletEvent{Wallet: ks.wallets[0], Kind: accounts.WalletDropped})
 			ks.wallets = ks.wallets[1:]
 		}
-		// If there are no more wallets or the account is before the next, wrap new wallet
-		if len(ks.wallets) == 0 || ks.wallets[0].URL().Cmp(account.URL) > 0 {
-			wallet := &keystoreWallet{account: account, keystore: ks}
-
-			events = append(events, accounts.WalletEvent{Wallet: wallet, Kind: accounts.WalletArrived})
-			wallets = append(wallets, wallet)
-			continue
-		}
-		// If the account is the same as the first wallet, keep it
-		if ks.wallets[0].Accounts()[0] == account {
+		// If the file is the same as the first wallet, keep it
+		if len(ks.wallets) > 0 && ks.wallets[0].URL() == source.url && source.matches(ks.wallets[0]) {
 			wallets = append(wallets, ks.wallets[0])
 			ks.wallets = ks.wallets[1:]
 			continue
 		}
+		// If the file was replaced by different content, drop the stale wallet
+		if len(ks.wallets) > 0 && ks.wallets[0].URL() == source.url {
+			events = append(events, accounts.WalletEvent{Wallet: ks.wallets[0], Kind: accounts.WalletDropped})
+			ks.wallets = ks.wallets[1:]
+		}
+		// Otherwise wrap a new wallet around the file
+		wallet := source.wallet(ks)
+
+		events = append(events, accounts.WalletEvent{Wallet: wallet, Kind: accounts.WalletArrived})
+		wallets = append(wallets, wallet)
 	}
 	// Drop any leftover wallets and set the new batch
 	for _, wallet := range ks.wallets {
@@ -223,13 +279,17 @@ func (ks *KeyStore) HasAddress(addr common.Address) bool {
 	return ks.cache.hasAddress(addr)
 }
 
-// Accounts returns all key files present in the directory.
+// Accounts returns all key files present in the directory, along with the
+// accounts pinned to any seed files.
 func (ks *KeyStore) Accounts() []accounts.Account {
 	return ks.cache.accounts()
 }
 
 // Delete deletes the key matched by account if the passphrase is correct.
 // If the account contains no filename, the address must match a unique key.
+//
+// Accounts derived from a seed are unpinned from the seed file instead, which
+// itself is only deleted once its last pinned account is gone.
 func (ks *KeyStore) Delete(a accounts.Account, passphrase string) error {
 	// Decrypting the key isn't really necessary, but we do
 	// it anyway to check the password and zero out the key
@@ -241,6 +301,9 @@ func (ks *KeyStore) Delete(a accounts.Account, passphrase string) error {
 	if err != nil {
 		return err
 	}
+	if file, _, ok := ks.cache.seedPath(a.URL); ok {
+		return ks.unpinSeedAccount(file, a)
+	}
 	// The order is crucial here. The key is dropped from the
 	// cache after the file is gone so that a reload happening in
 	// between won't insert it into the cache again.
@@ -375,14 +438,40 @@ func (ks *KeyStore) Find(a accounts.Account) (accounts.Account, error) {
 }
 
 func (ks *KeyStore) getDecryptedKey(a accounts.Account, auth string) (accounts.Account, *Key, error) {
-	a, err := ks.Find(a)
+	found, err := ks.Find(a)
+	if err == ErrNoMatch {
+		found, err = ks.findDerived(a)
+	}
 	if err != nil {
-		return a, nil, err
+		return found, nil, err
+	}
+	a = found
+	if file, path, ok := ks.cache.seedPath(a.URL); ok {
+		key, err := ks.seedKey(file, path, auth)
+		if err == nil && key.Address != a.Address {
+			zeroKey(key.PrivateKey)
+			return a, nil, fmt.Errorf("key content mismatch: have account %x, want %x", key.Address, a.Address)
+		}
+		return a, key, err
 	}
 	key, err := ks.storage.GetKey(a.Address, a.URL.Path, auth)
 	return a, key, err
 }
 
+// findDerived resolves an account self-derived by an open seed wallet. These
+// accounts are not pinned to the seed file, so the account cache doesn't track
+// them.
+func (ks *KeyStore) findDerived(a accounts.Account) (accounts.Account, error) {
+	for _, wallet := range ks.Wallets() {
+		if w, ok := wallet.(*seedWallet); ok {
+			if path, err := w.resolve(a); err == nil {
+				return accounts.Account{Address: a.Address, URL: seedAccountURL(w.url.Path, path)}, nil
+			}
+		}
+	}
+	return accounts.Account{}, ErrNoMatch
+}
+
 func (ks *KeyStore) expire(addr common.Address, u *unlocked, timeout time.Duration) {
 	t := time.NewTimer(timeout)
 	defer t.Stop()
@@ -423,13 +512,17 @@ func (ks *KeyStore) Export(a accounts.Account, passphrase, newPassphrase string)
 	if err != nil {
 		return nil, err
 	}
-	var N, P int
+	N, P := ks.scryptParams()
+	return EncryptKeyFormat(key, newPassphrase, key.format, N, P)
+}
+
+// scryptParams returns the scrypt parameters to encrypt exported keys and seed
+// files with.
+func (ks *KeyStore) scryptParams() (int, int) {
 	if store, ok := ks.storage.(*keyStorePassphrase); ok {
-		N, P = store.scryptN, store.scryptP
-	} else {
-		N, P = StandardScryptN, StandardScryptP
+		return store.scryptN, store.scryptP
 	}
-	return EncryptKey(key, newPassphrase, N, P)
+	return StandardScryptN, StandardScryptP
 }
 
 // Import stores the given encrypted JSON key into the key directory.
@@ -463,12 +556,34 @@ func (ks *KeyStore) importKey(key *Key, passphrase string) (accounts.Account, er
 	return a, nil
 }
 
-// Update changes the passphrase of an existing account.
+// Update changes the passphrase of an existing account, keeping the format of
+// its key file. For accounts derived from a seed, the entire seed file is
+// re-encrypted.
 func (ks *KeyStore) Update(a accounts.Account, passphrase, newPassphrase string) error {
+	return ks.UpdateFormat(a, passphrase, newPassphrase, KeyFormat{})
+}
+
+// UpdateFormat changes the passphrase of an existing account and converts its
+// key file into the given format. Unset fields of the format are kept as they
+// are. The key files of accounts derived from a seed cannot be converted.
+func (ks *KeyStore) UpdateFormat(a accounts.Account, passphrase, newPassphrase string, format KeyFormat) error {
 	a, key, err := ks.getDecryptedKey(a, passphrase)
 	if err != nil {
 		return err
 	}
+	if file, _, ok := ks.cache.seedPath(a.URL); ok {
+		zeroKey(key.PrivateKey)
+		if format != (KeyFormat{}) {
+			return errSeedFormat
+		}
+		return ks.updateSeed(file, passphrase, newPassphrase)
+	}
+	defer zeroKey(key.PrivateKey)
+
+	key.format = key.format.Override(format)
+	if err := key.format.validate(); err != nil {
+		return err
+	}
 	return ks.storage.StoreKey(a.URL.Path, key, newPassphrase)
 }
 
@@ -484,6 +599,252 @@ func (ks *KeyStore) ImportPreSaleKey(keyJSON []byte, passphrase string) (account
 	return a, nil
 }
 
+// ImportMnemonic stores the seed of a BIP-39 mnemonic phrase, extended by the
+// optional BIP-39 password, into a new seed file in the key directory, encrypting
+// it with the passphrase. The accounts at the given derivation paths are pinned
+// to the new wallet, defaulting to the first account of the default base path.
+func (ks *KeyStore) ImportMnemonic(mnemonic, password, passphrase string, paths ...accounts.DerivationPath) ([]accounts.Account, error) {
+	secret, err := newMnemonicSecret(mnemonic, password)
+	if err != nil {
+		return nil, err
+	}
+	defer secret.zero()
+	return ks.importSeed(secret, seedTypeMnemonic, passphrase, paths)
+}
+
+// ImportSeed stores a raw BIP-32 seed into a new seed file in the key directory,
+// encrypting it with the passphrase. The accounts at the given derivation paths
+// are pinned to the new wallet, defaulting to the first account of the default
+// base path.
+func (ks *KeyStore) ImportSeed(seed []byte, passphrase string, paths ...accounts.DerivationPath) ([]accounts.Account, error) {
+	secret, err := newRawSecret(seed)
+	if err != nil {
+		return nil, err
+	}
+	defer secret.zero()
+	return ks.importSeed(secret, seedTypeRaw, passphrase, paths)
+}
+
+func (ks *KeyStore) importSeed(secret *seedSecret, kind string, passphrase string, paths []accounts.DerivationPath) ([]accounts.Account, error) {
+	if len(paths) == 0 {
+		paths = []accounts.DerivationPath{accounts.DefaultBaseDerivationPath}
+	}
+	// Derive all the requested accounts, refusing to shadow existing ones
+	hd := &hdJSON{Type: kind}
+	addrs := make([]common.Address, len(paths))
+	for i, path := range paths {
+		key, err := deriveKey(secret.seed, path)
+		if err != nil {
+			return nil, err
+		}
+		addrs[i] = crypto.PubkeyToAddress(key.PublicKey)
+		zeroKey(key)
+
+		if ks.cache.hasAddress(addrs[i]) {
+			return nil, fmt.Errorf("account %x already exists", addrs[i])
+		}
+		hd.Accounts = append(hd.Accounts, hdAccountJSON{Address: hex.EncodeToString(addrs[i][:]), Path: path.String()})
+	}
+	// Encrypt the seed and store it alongside the pinned accounts
+	N, P := ks.scryptParams()
+	seedjson, err := encryptSeed(secret, hd, passphrase, N, P)
+	if err != nil {
+		return nil, err
+	}
+	file := ks.storage.JoinPath(seedFileName(addrs[0]))
+	if err := writeKeyFile(file, seedjson); err != nil {
+		return nil, err
+	}
+	pinned, err := hd.parseAccounts(file)
+	if err != nil {
+		return nil, err
+	}
+	ks.cache.addSeed(file, pinned)
+	ks.refreshWallets()
+	return pinned, nil
+}
+
+// ExportMnemonic decrypts the seed file the given account was derived from and
+// returns its BIP-39 mnemonic phrase, along with the optional BIP-39 password.
+func (ks *KeyStore) ExportMnemonic(a accounts.Account, passphrase string) (mnemonic string, password string, err error) {
+	a, err = ks.Find(a)
+	if err != nil {
+		return "", "", err
+	}
+	file, _, ok := ks.cache.seedPath(a.URL)
+	if !ok {
+		return "", "", ErrNoMnemonic
+	}
+	secret, _, err := readSeed(file, passphrase)
+	if err != nil {
+		return "", "", err
+	}
+	defer secret.zero()
+
+	if mnemonic, err = secret.mnemonic(); err != nil {
+		return "", "", err
+	}
+	return mnemonic, secret.password, nil
+}
+
+// seedKey decrypts the given seed file and derives the key at the requested
+// derivation path.
+func (ks *KeyStore) seedKey(file string, path accounts.DerivationPath, auth string) (*Key, error) {
+	secret, _, err := readSeed(file, auth)
+	if err != nil {
+		return nil, err
+	}
+	defer secret.zero()
+
+	priv, err := deriveKey(secret.seed, path)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{
+		Id:         uuid.NewRandom(),
+		Address:    crypto.PubkeyToAddress(priv.PublicKey),
+		PrivateKey: priv,
+	}, nil
+}
+
+// updateSeed re-encrypts a seed file with a new passphrase.
+func (ks *KeyStore) updateSeed(file string, passphrase, newPassphrase string) error {
+	ks.seedLock.Lock()
+	defer ks.seedLock.Unlock()
+
+	secret, seed, err := readSeed(file, passphrase)
+	if err != nil {
+		return err
+	}
+	defer secret.zero()
+
+	N, P := ks.scryptParams()
+	seedjson, err := encryptSeed(secret, seed.HD, newPassphrase, N, P)
+	if err != nil {
+		return err
+	}
+	return writeKeyFile(file, seedjson)
+}
+
+// pinSeedAccount adds a derived account to the list of accounts stored in the
+// seed file. The encrypted seed itself is left untouched.
+func (ks *KeyStore) pinSeedAccount(file string, a accounts.Account, path accounts.DerivationPath) error {
+	ks.seedLock.Lock()
+	defer ks.seedLock.Unlock()
+
+	seed, err := readSeedFile(file)
+	if err != nil {
+		return err
+	}
+	for _, pinned := range seed.HD.Accounts {
+		if pinned.Path == path.String() {
+			return nil
+		}
+	}
+	seed.HD.Accounts = append(seed.HD.Accounts, hdAccountJSON{Address: hex.EncodeToString(a.Address[:]), Path: path.String()})
+	return ks.writeSeedAccounts(file, seed)
+}
+
+// unpinSeedAccount removes a derived account from the list of accounts stored in
+// the seed file. The seed itself is kept even if no accounts remain pinned, it
+// is only ever removed by DeleteWallet.
+func (ks *KeyStore) unpinSeedAccount(file string, a accounts.Account) error {
+	ks.seedLock.Lock()
+	defer ks.seedLock.Unlock()
+
+	seed, err := readSeedFile(file)
+	if err != nil {
+		return err
+	}
+	pinned, err := seed.HD.parseAccounts(file)
+	if err != nil {
+		return err
+	}
+	accs := seed.HD.Accounts[:0]
+	for i, account := range pinned {
+		if account != a {
+			accs = append(accs, seed.HD.Accounts[i])
+		}
+	}
+	seed.HD.Accounts = accs
+
+	if err := ks.writeSeedAccounts(file, seed); err != nil {
+		return err
+	}
+	ks.refreshWallets()
+	return nil
+}
+
+// DeleteWallet removes the seed file of a seed wallet from the key directory if
+// the passphrase is correct. This destroys the seed along with access to every
+// account derived from it, unless a backup of the mnemonic exists elsewhere.
+func (ks *KeyStore) DeleteWallet(url accounts.URL, passphrase string) error {
+	file := url.Path
+	if url.Scheme != KeyStoreScheme || !ks.cache.hasSeed(file) {
+		return accounts.ErrUnknownWallet
+	}
+	ks.seedLock.Lock()
+	defer ks.seedLock.Unlock()
+
+	// Decrypting the seed isn't really necessary, but we do it anyway to check
+	// the password and zero out the seed immediately afterwards.
+	secret, _, err := readSeed(file, passphrase)
+	if err != nil {
+		return err
+	}
+	secret.zero()
+
+	if err := os.Remove(file); err != nil {
+		return err
+	}
+	ks.cache.deleteByFile(file)
+	ks.refreshWallets()
+	return nil
+}
+
+// writeSeedAccounts persists a seed file with an updated list of pinned accounts
+// and refreshes the account cache with them.
+func (ks *KeyStore) writeSeedAccounts(file string, seed *encryptedSeedJSON) error {
+	pinned, err := seed.HD.parseAccounts(file)
+	if err != nil {
+		return err
+	}
+	seedjson, err := json.Marshal(seed)
+	if err != nil {
+		return err
+	}
+	if err := writeKeyFile(file, seedjson); err != nil {
+		return err
+	}
+	ks.cache.addSeed(file, pinned)
+	return nil
+}
+
+// readSeedFile loads a seed file without decrypting its secret.
+func readSeedFile(file string) (*encryptedSeedJSON, error) {
+	seedjson, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	seed := new(encryptedSeedJSON)
+	if err := json.Unmarshal(seedjson, seed); err != nil {
+		return nil, err
+	}
+	if seed.HD == nil {
+		return nil, errors.New("not a seed file")
+	}
+	return seed, nil
+}
+
+// readSeed loads and decrypts a seed file.
+func readSeed(file string, auth string) (*seedSecret, *encryptedSeedJSON, error) {
+	seedjson, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return decryptSeed(seedjson, auth)
+}
+
 // zeroKey zeroes a private key in memory.
 func zeroKey(k *ecdsa.PrivateKey) {
 	b := k.D.Bits()
@@ -21,6 +21,10 @@ the private key is encrypted and on disk uses another JSON encoding.
 
 The crypto is documented at https://github.com/etsc/wiki/wiki/Web3-Secret-Storage-Definition
 
+Version 4 key files split the crypto into separate kdf, checksum and cipher
+modules, additionally support Argon2id and can carry a descriptive label and the
+derivation path of the key, both covered by the checksum.
+
 */
 
 package keystore
@@ -30,6 +34,7 @@ import (
 	"crypto/aes"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -42,6 +47,7 @@ import (
 	"github.com/ETSC3259/etsc/common/math"
 	"github.com/ETSC3259/etsc/crypto"
 	"github.com/pborman/uuid"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/pbkdf2"
 	"golang.org/x/crypto/scrypt"
 )
@@ -67,8 +73,83 @@ const (
 
 	scryptR     = 8
 	scryptDKLen = 32
+
+	// Argon2id parameters of version 4 key files. The memory cost is derived from
+	// the scrypt N parameter, matching the memory usage of the scrypt KDF.
+	argon2Time    = 3
+	argon2Threads = 4
+	argon2DKLen   = 32
+
+	// Upper bounds of the Argon2id parameters accepted from key files, so that a
+	// crafted file can't exhaust the memory or CPU of the node. The memory bound
+	// (in KiB) allows for four times the standard cost.
+	argon2MaxTime    = 16
+	argon2MaxMemory  = 4 * StandardScryptN
+	argon2MaxThreads = 16
+
+	pbkdf2DKLen = 32
+
+	// Bounds of the derived key length accepted from key files. The MAC or the
+	// checksum covers the first 32 bytes, the KDFs allocate the whole length.
+	minDKLen = 32
+	maxDKLen = 64
+)
+
+// Key derivation functions supported by version 4 key files.
+const (
+	KDFScrypt   = "scrypt"
+	KDFPBKDF2   = "pbkdf2"
+	KDFArgon2id = "argon2id"
 )
 
+// KeyFormat describes the on-disk layout of an encrypted key file.
+type KeyFormat struct {
+	Version int    // Key file version, 3 or 4
+	KDF     string // Key derivation function, only configurable in version 4
+}
+
+// normalize fills in the defaults of unset fields.
+func (f KeyFormat) normalize() KeyFormat {
+	if f.Version == 0 {
+		f.Version = version
+	}
+	if f.KDF == "" {
+		f.KDF = KDFScrypt
+	}
+	return f
+}
+
+// Override returns the format changed by the set fields of o. Switching the
+// version without an explicit KDF falls back to the default scrypt.
+func (f KeyFormat) Override(o KeyFormat) KeyFormat {
+	f = f.normalize()
+	if o.Version != 0 && o.Version != f.Version {
+		f.Version, f.KDF = o.Version, KDFScrypt
+	}
+	if o.KDF != "" {
+		f.KDF = o.KDF
+	}
+	return f
+}
+
+// validate checks whether a key can be encrypted in the format.
+func (f KeyFormat) validate() error {
+	f = f.normalize()
+	switch f.Version {
+	case version:
+		if f.KDF != KDFScrypt {
+			return fmt.Errorf("KDF %s not supported in version %d key files", f.KDF, version)
+		}
+	case versionV4:
+		if f.KDF != KDFScrypt && f.KDF != KDFPBKDF2 && f.KDF != KDFArgon2id {
+			return fmt.Errorf("Unsupported KDF: %s", f.KDF)
+		}
+	default:
+		return fmt.Errorf("Version not supported: %v", f.Version)
+	}
+	return nil
+}
+
 type keyStorePassphrase struct {
 	keysDirPath string
 	scryptN     int
@@ -103,7 +184,7 @@ func StoreKey(dir, auth string, scryptN, scryptP int) (common.Address, error) {
 }
 
 func (ks keyStorePassphrase) StoreKey(filename string, key *Key, auth string) error {
-	keyjson, err := EncryptKey(key, auth, ks.scryptN, ks.scryptP)
+	keyjson, err := EncryptKeyFormat(key, auth, key.format, ks.scryptN, ks.scryptP)
 	if err != nil {
 		return err
 	}
@@ -196,6 +277,91 @@ func EncryptKey(key *Key, auth string, scryptN, scryptP int) ([]byte, error) {
 	return json.Marshal(encryptedKeyJSONV3)
 }
 
+// EncryptKeyFormat encrypts a key into a json blob of the given format, using a
+// KDF strength matching the specified scrypt parameters. Keys with a label or a
+// derivation path can't be stored in version 3, the metadata has to be cleared
+// first.
+func EncryptKeyFormat(key *Key, auth string, format KeyFormat, scryptN, scryptP int) ([]byte, error) {
+	if err := format.validate(); err != nil {
+		return nil, err
+	}
+	if format.normalize().Version == version && (key.Label != "" || key.Path != "") {
+		return nil, ErrKeyMetadata
+	}
+	if format = format.normalize(); format.Version == versionV4 {
+		return encryptKeyV4(key, auth, format.KDF, scryptN, scryptP)
+	}
+	return EncryptKey(key, auth, scryptN, scryptP)
+}
+
+// encryptKeyV4 encrypts a key and its descriptive metadata into a version 4
+// json blob, deriving the encryption key with the given KDF.
+func encryptKeyV4(key *Key, auth, kdf string, scryptN, scryptP int) ([]byte, error) {
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		panic("reading from crypto/rand failed: " + err.Error())
+	}
+	kdfParams := map[string]interface{}{"salt": hex.EncodeToString(salt)}
+	switch kdf {
+	case KDFScrypt:
+		kdfParams["n"] = scryptN
+		kdfParams["r"] = scryptR
+		kdfParams["p"] = scryptP
+		kdfParams["dklen"] = scryptDKLen
+	case KDFPBKDF2:
+		// Scale the iterations with the scrypt cost, 2^18 in the standard case
+		kdfParams["c"] = scryptN
+		kdfParams["prf"] = "hmac-sha256"
+		kdfParams["dklen"] = pbkdf2DKLen
+	case KDFArgon2id:
+		kdfParams["time"] = argon2Time
+		kdfParams["memory"] = scryptN // KiB, scrypt uses 128 * r * N bytes
+		kdfParams["threads"] = argon2Threads
+		kdfParams["dklen"] = argon2DKLen
+	default:
+		return nil, fmt.Errorf("Unsupported KDF: %s", kdf)
+	}
+	derivedKey, err := kdfKey(kdf, kdfParams, auth)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, aes.BlockSize) // 16
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		panic("reading from crypto/rand failed: " + err.Error())
+	}
+	keyBytes := math.PaddedBigBytes(key.PrivateKey.D, 32)
+	cipherText, err := aesCTRXOR(derivedKey[:16], keyBytes, iv)
+	if err != nil {
+		return nil, err
+	}
+	checksum := checksumV4(derivedKey, cipherText, key.Label, key.Path)
+
+	encryptedKeyJSONV4 := encryptedKeyJSONV4{
+		Address: hex.EncodeToString(key.Address[:]),
+		Crypto: cryptoJSONV4{
+			KDF: cryptoModuleJSON{
+				Function: kdf,
+				Params:   kdfParams,
+			},
+			Checksum: cryptoModuleJSON{
+				Function: "sha256",
+				Params:   map[string]interface{}{},
+				Message:  hex.EncodeToString(checksum),
+			},
+			Cipher: cryptoModuleJSON{
+				Function: "aes-128-ctr",
+				Params:   map[string]interface{}{"iv": hex.EncodeToString(iv)},
+				Message:  hex.EncodeToString(cipherText),
+			},
+		},
+		Label:   key.Label,
+		Path:    key.Path,
+		Id:      key.Id.String(),
+		Version: versionV4,
+	}
+	return json.Marshal(encryptedKeyJSONV4)
+}
+
 // DecryptKey decrypts a key from a json blob, returning the private key itself.
 func DecryptKey(keyjson []byte, auth string) (*Key, error) {
 	// Parse the json into a simple map to fetch the key version
@@ -203,9 +369,14 @@ func DecryptKey(keyjson []byte, auth string) (*Key, error) {
 	if err := json.Unmarshal(keyjson, &m); err != nil {
 		return nil, err
 	}
+	if _, ok := m["hd"]; ok {
+		return nil, errSeedFile
+	}
 	// Depending on the version try to parse one way or another
 	var (
 		keyBytes, keyId []byte
+		meta            encryptedKeyJSONV4
+		format          KeyFormat
 		err             error
 	)
 	if version, ok := m["version"].(string); ok && version == "1" {
@@ -214,6 +385,12 @@ func DecryptKey(keyjson []byte, auth string) (*Key, error) {
 			return nil, err
 		}
 		keyBytes, keyId, err = decryptKeyV1(k, auth)
+	} else if version, ok := m["version"].(float64); ok && version == versionV4 {
+		if err := json.Unmarshal(keyjson, &meta); err != nil {
+			return nil, err
+		}
+		keyBytes, keyId, err = decryptKeyV4(&meta, auth)
+		format = KeyFormat{Version: versionV4, KDF: meta.Crypto.KDF.Function}
 	} else {
 		k := new(encryptedKeyJSONV3)
 		if err := json.Unmarshal(keyjson, k); err != nil {
@@ -231,6 +408,9 @@ func DecryptKey(keyjson []byte, auth string) (*Key, error) {
 		Id:         uuid.UUID(keyId),
 		Address:    crypto.PubkeyToAddress(key.PublicKey),
 		PrivateKey: key,
+		Label:      meta.Label,
+		Path:       meta.Path,
+		format:     format,
 	}, nil
 }
 func DecryptDataV3(cryptoJson CryptoJSON, auth string) ([]byte, error) {
@@ -281,6 +461,63 @@ func decryptKeyV3(keyProtected *encryptedKeyJSONV3, auth string) (keyBytes []byt
 	return plainText, keyId, err
 }
 
+func decryptKeyV4(keyProtected *encryptedKeyJSONV4, auth string) (keyBytes []byte, keyId []byte, err error) {
+	keyId = uuid.Parse(keyProtected.Id)
+	plainText, err := decryptDataV4(keyProtected.Crypto, keyProtected.Label, keyProtected.Path, auth)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plainText, keyId, err
+}
+
+// checksumV4 computes the checksum of a version 4 key file, covering both the
+// ciphertext and the descriptive metadata of the key.
+func checksumV4(derivedKey, cipherText []byte, label, path string) []byte {
+	hasher := sha256.New()
+	hasher.Write(derivedKey[16:32])
+	hasher.Write(cipherText)
+	for _, meta := range []string{label, path} {
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(meta)))
+		hasher.Write(size[:])
+		hasher.Write([]byte(meta))
+	}
+	return hasher.Sum(nil)
+}
+
+func decryptDataV4(cryptoJson cryptoJSONV4, label, path, auth string) ([]byte, error) {
+	if cryptoJson.Cipher.Function != "aes-128-ctr" {
+		return nil, fmt.Errorf("Cipher not supported: %v", cryptoJson.Cipher.Function)
+	}
+	if cryptoJson.Checksum.Function != "sha256" {
+		return nil, fmt.Errorf("Checksum not supported: %v", cryptoJson.Checksum.Function)
+	}
+	checksum, err := hex.DecodeString(cryptoJson.Checksum.Message)
+	if err != nil {
+		return nil, err
+	}
+	ivHex, ok := cryptoJson.Cipher.Params["iv"].(string)
+	if !ok {
+		return nil, fmt.Errorf("missing cipher iv")
+	}
+	iv, err := hex.DecodeString(ivHex)
+	if err != nil {
+		return nil, err
+	}
+	cipherText, err := hex.DecodeString(cryptoJson.Cipher.Message)
+	if err != nil {
+		return nil, err
+	}
+	derivedKey, err := kdfKey(cryptoJson.KDF.Function, cryptoJson.KDF.Params, auth)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(checksumV4(derivedKey, cipherText, label, path), checksum) {
+		return nil, ErrDecrypt
+	}
+	return aesCTRXOR(derivedKey[:16], cipherText, iv)
+}
+
 func decryptKeyV1(keyProtected *encryptedKeyJSONV1, auth string) (keyBytes []byte, keyId []byte, err error) {
 	keyId = uuid.Parse(keyProtected.Id)
 	mac, err := hex.DecodeString(keyProtected.Crypto.MAC)
@@ -316,39 +553,111 @@ func decryptKeyV1(keyProtected *encryptedKeyJSONV1, auth string) (keyBytes []byt
 }
 
 func getKDFKey(cryptoJSON CryptoJSON, auth string) ([]byte, error) {
+	return kdfKey(cryptoJSON.KDF, cryptoJSON.KDFParams, auth)
+}
+
+// kdfKey derives the decryption key from the passphrase with the given KDF. All
+// parameters are checked, as they may originate from a crafted key file.
+func kdfKey(kdf string, params map[string]interface{}, auth string) ([]byte, error) {
 	authArray := []byte(auth)
-	salt, err := hex.DecodeString(cryptoJSON.KDFParams["salt"].(string))
+	saltHex, err := kdfString(params, "salt")
+	if err != nil {
+		return nil, err
+	}
+	salt, err := hex.DecodeString(saltHex)
 	if err != nil {
 		return nil, err
 	}
-	dkLen := ensureInt(cryptoJSON.KDFParams["dklen"])
+	dkLen, err := kdfInt(params, "dklen")
+	if err != nil {
+		return nil, err
+	}
+	if dkLen < minDKLen || dkLen > maxDKLen {
+		return nil, fmt.Errorf("Invalid derived key length %d (min %d, max %d)", dkLen, minDKLen, maxDKLen)
+	}
 
-	if cryptoJSON.KDF == keyHeaderKDF {
-		n := ensureInt(cryptoJSON.KDFParams["n"])
-		r := ensureInt(cryptoJSON.KDFParams["r"])
-		p := ensureInt(cryptoJSON.KDFParams["p"])
+	if kdf == keyHeaderKDF {
+		n, err := kdfInt(params, "n")
+		if err != nil {
+			return nil, err
+		}
+		r, err := kdfInt(params, "r")
+		if err != nil {
+			return nil, err
+		}
+		p, err := kdfInt(params, "p")
+		if err != nil {
+			return nil, err
+		}
 		return scrypt.Key(authArray, salt, n, r, p, dkLen)
 
-	} else if cryptoJSON.KDF == "pbkdf2" {
-		c := ensureInt(cryptoJSON.KDFParams["c"])
-		prf := cryptoJSON.KDFParams["prf"].(string)
+	} else if kdf == KDFPBKDF2 {
+		c, err := kdfInt(params, "c")
+		if err != nil {
+			return nil, err
+		}
+		prf, err := kdfString(params, "prf")
+		if err != nil {
+			return nil, err
+		}
 		if prf != "hmac-sha256" {
 			return nil, fmt.Errorf("Unsupported PBKDF2 PRF: %s", prf)
 		}
 		key := pbkdf2.Key(authArray, salt, c, dkLen, sha256.New)
 		return key, nil
+
+	} else if kdf == KDFArgon2id {
+		time, err := kdfInt(params, "time")
+		if err != nil {
+			return nil, err
+		}
+		memory, err := kdfInt(params, "memory")
+		if err != nil {
+			return nil, err
+		}
+		threads, err := kdfInt(params, "threads")
+		if err != nil {
+			return nil, err
+		}
+		if time < 1 || memory < 1 || threads < 1 {
+			return nil, fmt.Errorf("Invalid Argon2id parameters: time %d, memory %d, threads %d", time, memory, threads)
+		}
+		if time > argon2MaxTime || memory > argon2MaxMemory || threads > argon2MaxThreads {
+			return nil, fmt.Errorf("Argon2id parameters exceed limits: time %d (max %d), memory %d (max %d), threads %d (max %d)",
+				time, argon2MaxTime, memory, argon2MaxMemory, threads, argon2MaxThreads)
+		}
+		return argon2.IDKey(authArray, salt, uint32(time), uint32(memory), uint8(threads), uint32(dkLen)), nil
 	}
 
-	return nil, fmt.Errorf("Unsupported KDF: %s", cryptoJSON.KDF)
+	return nil, fmt.Errorf("Unsupported KDF: %s", kdf)
 }
 
-// TODO: can we do without this when unmarshalling dynamic JSON?
-// why do integers in KDF params end up as float64 and not int after
-// unmarshal?
-func ensureInt(x interface{}) int {
-	res, ok := x.(int)
-	if !ok {
-		res = int(x.(float64))
+// kdfInt retrieves an integer KDF parameter. Numbers unmarshalled from JSON are
+// float64s, while freshly generated parameters are ints.
+func kdfInt(params map[string]interface{}, name string) (int, error) {
+	switch x := params[name].(type) {
+	case int:
+		return x, nil
+	case float64:
+		if x != float64(int(x)) {
+			return 0, fmt.Errorf("Invalid KDF parameter %s: %v", name, x)
+		}
+		return int(x), nil
+	case nil:
+		return 0, fmt.Errorf("Missing KDF parameter %s", name)
+	default:
+		return 0, fmt.Errorf("Invalid KDF parameter %s: %v", name, x)
+	}
+}
+
+// kdfString retrieves a string KDF parameter.
+func kdfString(params map[string]interface{}, name string) (string, error) {
+	switch x := params[name].(type) {
+	case string:
+		return x, nil
+	case nil:
+		return "", fmt.Errorf("Missing KDF parameter %s", name)
+	default:
+		return "", fmt.Errorf("Invalid KDF parameter %s: %v", name, x)
 	}
-	return res
 }
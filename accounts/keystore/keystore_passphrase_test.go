@@ -17,6 +17,8 @@
 package keystore
 
 import (
+	"crypto/rand"
+	"encoding/json"
 	"io/ioutil"
 	"testing"
 
@@ -58,3 +60,158 @@ func TestKeyEncryptDecrypt(t *testing.T) {
 		}
 	}
 }
+
+// Tests that keys round trip through version 4 key files with all supported
+// KDFs, retaining their descriptive metadata.
+func TestKeyEncryptDecryptV4(t *testing.T) {
+	keyjson, err := ioutil.ReadFile("testdata/very-light-scrypt.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := DecryptKey(keyjson, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format := key.Format(); format != (KeyFormat{Version: 3, KDF: KDFScrypt}) {
+		t.Errorf("version 3 format mismatch: have %+v", format)
+	}
+	key.Label, key.Path = "savings", "m/44'/60'/0'/0/0"
+
+	for _, kdf := range []string{KDFScrypt, KDFPBKDF2, KDFArgon2id} {
+		format := KeyFormat{Version: 4, KDF: kdf}
+		keyjson, err := EncryptKeyFormat(key, "foo", format, veryLightScryptN, veryLightScryptP)
+		if err != nil {
+			t.Fatalf("%s: failed to encrypt key: %v", kdf, err)
+		}
+		if _, err := DecryptKey(keyjson, "bar"); err != ErrDecrypt {
+			t.Errorf("%s: bad password error mismatch: have %v, want %v", kdf, err, ErrDecrypt)
+		}
+		decrypted, err := DecryptKey(keyjson, "foo")
+		if err != nil {
+			t.Fatalf("%s: failed to decrypt key: %v", kdf, err)
+		}
+		if decrypted.Address != key.Address || decrypted.Id.String() != key.Id.String() {
+			t.Errorf("%s: key mismatch: have %x/%v, want %x/%v", kdf, decrypted.Address, decrypted.Id, key.Address, key.Id)
+		}
+		if decrypted.Label != key.Label || decrypted.Path != key.Path {
+			t.Errorf("%s: metadata mismatch: have %q/%q, want %q/%q", kdf, decrypted.Label, decrypted.Path, key.Label, key.Path)
+		}
+		if decrypted.Format() != format {
+			t.Errorf("%s: format mismatch: have %+v, want %+v", kdf, decrypted.Format(), format)
+		}
+		// Converting back to version 3 must refuse to drop the metadata
+		if _, err := EncryptKeyFormat(decrypted, "foo", KeyFormat{Version: 3}, veryLightScryptN, veryLightScryptP); err != ErrKeyMetadata {
+			t.Errorf("%s: metadata loss error mismatch: have %v, want %v", kdf, err, ErrKeyMetadata)
+		}
+		decrypted.Label, decrypted.Path = "", ""
+		keyjson, err = EncryptKeyFormat(decrypted, "foo", KeyFormat{Version: 3}, veryLightScryptN, veryLightScryptP)
+		if err != nil {
+			t.Fatalf("%s: failed to convert key to version 3: %v", kdf, err)
+		}
+		if decrypted, err = DecryptKey(keyjson, "foo"); err != nil {
+			t.Fatalf("%s: failed to decrypt converted key: %v", kdf, err)
+		}
+		if decrypted.Address != key.Address || decrypted.Format() != (KeyFormat{Version: 3, KDF: KDFScrypt}) {
+			t.Errorf("%s: converted key mismatch: have %x/%+v", kdf, decrypted.Address, decrypted.Format())
+		}
+	}
+	invalid := []KeyFormat{{Version: 3, KDF: KDFArgon2id}, {Version: 4, KDF: "bcrypt"}, {Version: 5}}
+	for _, format := range invalid {
+		if _, err := EncryptKeyFormat(key, "foo", format, veryLightScryptN, veryLightScryptP); err == nil {
+			t.Errorf("expected error for format %+v", format)
+		}
+	}
+}
+
+// Tests that a version 4 key file with tampered ciphertext or metadata fails
+// the checksum.
+func TestKeyChecksumV4(t *testing.T) {
+	key, err := newKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.Label, key.Path = "savings", "m/44'/60'/0'/0/0"
+
+	keyjson, err := EncryptKeyFormat(key, "foo", KeyFormat{Version: 4, KDF: KDFArgon2id}, veryLightScryptN, veryLightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampers := map[string]func(file *encryptedKeyJSONV4){
+		"ciphertext": func(file *encryptedKeyJSONV4) {
+			if file.Crypto.Cipher.Message[0] == '0' {
+				file.Crypto.Cipher.Message = "1" + file.Crypto.Cipher.Message[1:]
+			} else {
+				file.Crypto.Cipher.Message = "0" + file.Crypto.Cipher.Message[1:]
+			}
+		},
+		"label":    func(file *encryptedKeyJSONV4) { file.Label = "hot wallet" },
+		"path":     func(file *encryptedKeyJSONV4) { file.Path = "m/44'/60'/0'/0/1" },
+		"no path":  func(file *encryptedKeyJSONV4) { file.Path = "" },
+		"shifted":  func(file *encryptedKeyJSONV4) { file.Label, file.Path = file.Label+file.Path[:1], file.Path[1:] },
+		"no label": func(file *encryptedKeyJSONV4) { file.Label = "" },
+	}
+	for name, tamper := range tampers {
+		var file encryptedKeyJSONV4
+		if err := json.Unmarshal(keyjson, &file); err != nil {
+			t.Fatal(err)
+		}
+		tamper(&file)
+
+		tampered, err := json.Marshal(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DecryptKey(tampered, "foo"); err != ErrDecrypt {
+			t.Errorf("%s: tampered key error mismatch: have %v, want %v", name, err, ErrDecrypt)
+		}
+	}
+}
+
+// Tests that version 4 key files with excessive or malformed Argon2id parameters
+// are rejected before deriving the key.
+func TestKeyArgon2idLimitsV4(t *testing.T) {
+	key, err := newKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyjson, err := EncryptKeyFormat(key, "foo", KeyFormat{Version: 4, KDF: KDFArgon2id}, veryLightScryptN, veryLightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for param, value := range map[string]int{"time": argon2MaxTime + 1, "memory": 1 << 32, "threads": argon2MaxThreads + 1, "dklen": 1 << 32} {
+		var file encryptedKeyJSONV4
+		if err := json.Unmarshal(keyjson, &file); err != nil {
+			t.Fatal(err)
+		}
+		file.Crypto.KDF.Params[param] = value
+
+		crafted, err := json.Marshal(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DecryptKey(crafted, "foo"); err == nil || err == ErrDecrypt {
+			t.Errorf("%s: excessive parameter error mismatch: have %v", param, err)
+		}
+	}
+	// Missing or mistyped parameters must be reported as errors, not panic
+	for _, param := range []string{"salt", "dklen", "time", "memory", "threads"} {
+		for _, value := range []interface{}{nil, "1", 1.5, true} {
+			var file encryptedKeyJSONV4
+			if err := json.Unmarshal(keyjson, &file); err != nil {
+				t.Fatal(err)
+			}
+			if value == nil {
+				delete(file.Crypto.KDF.Params, param)
+			} else {
+				file.Crypto.KDF.Params[param] = value
+			}
+			crafted, err := json.Marshal(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := DecryptKey(crafted, "foo"); err == nil || err == ErrDecrypt {
+				t.Errorf("%s=%v: malformed parameter error mismatch: have %v", param, value, err)
+			}
+		}
+	}
+}
@@ -68,6 +68,93 @@ func TestKeyStore(t *testing.T) {
 	}
 }
 
+// Tests that accounts can be converted between key file formats, keeping their
+// format across plain passphrase updates.
+func TestKeyStoreUpdateFormat(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	a, err := ks.NewAccount("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	format := func() KeyFormat {
+		keyjson, err := ioutil.ReadFile(a.URL.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := DecryptKey(keyjson, "bar")
+		if err != nil {
+			t.Fatalf("failed to decrypt key file: %v", err)
+		}
+		return key.Format()
+	}
+	if err := ks.UpdateFormat(a, "foo", "bar", KeyFormat{Version: 4, KDF: KDFArgon2id}); err != nil {
+		t.Fatalf("failed to convert account: %v", err)
+	}
+	if have, want := format(), (KeyFormat{Version: 4, KDF: KDFArgon2id}); have != want {
+		t.Errorf("converted format mismatch: have %+v, want %+v", have, want)
+	}
+	if err := ks.Update(a, "bar", "bar"); err != nil {
+		t.Fatalf("failed to update account: %v", err)
+	}
+	if have, want := format(), (KeyFormat{Version: 4, KDF: KDFArgon2id}); have != want {
+		t.Errorf("updated format mismatch: have %+v, want %+v", have, want)
+	}
+	if err := ks.UpdateFormat(a, "bar", "bar", KeyFormat{Version: 3}); err != nil {
+		t.Fatalf("failed to convert account back: %v", err)
+	}
+	if have, want := format(), (KeyFormat{Version: 3, KDF: KDFScrypt}); have != want {
+		t.Errorf("reverted format mismatch: have %+v, want %+v", have, want)
+	}
+	if err := ks.UpdateFormat(a, "bar", "bar", KeyFormat{Version: 3, KDF: KDFPBKDF2}); err == nil {
+		t.Errorf("converted account into unsupported format")
+	}
+	if err := ks.Unlock(a, "bar"); err != nil {
+		t.Errorf("failed to unlock converted account: %v", err)
+	}
+}
+
+// Tests that converting a key with metadata to version 3 is refused instead of
+// silently dropping the metadata.
+func TestKeyStoreUpdateFormatMetadata(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	a, err := ks.NewAccount("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Store the key with a label, as no keystore method sets one
+	keyjson, err := ioutil.ReadFile(a.URL.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := DecryptKey(keyjson, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.Label = "savings"
+	if keyjson, err = EncryptKeyFormat(key, "foo", KeyFormat{Version: 4}, veryLightScryptN, veryLightScryptP); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(a.URL.Path, keyjson, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.UpdateFormat(a, "foo", "foo", KeyFormat{Version: 3}); err != ErrKeyMetadata {
+		t.Fatalf("metadata loss error mismatch: have %v, want %v", err, ErrKeyMetadata)
+	}
+	if keyjson, err = ioutil.ReadFile(a.URL.Path); err != nil {
+		t.Fatal(err)
+	}
+	if key, err = DecryptKey(keyjson, "foo"); err != nil {
+		t.Fatalf("failed to decrypt key file: %v", err)
+	}
+	if key.Label != "savings" || key.Format() != (KeyFormat{Version: 4, KDF: KDFScrypt}) {
+		t.Errorf("key file changed: label %q, format %+v", key.Label, key.Format())
+	}
+}
+
 func TestSign(t *testing.T) {
 	dir, ks := tmpKeyStore(t, true)
 	defer os.RemoveAll(dir)
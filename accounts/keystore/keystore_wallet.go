@@ -110,6 +110,15 @@ func (w *keystoreWallet) SignTx(account accounts.Account, tx *types.Transaction,
 	return w.keystore.SignTx(account, tx, chainID)
 }
 
+// SignTypedData implements accounts.Wallet, attempting to sign the EIP-712 digest
+// of the given domain separator and message hash with the given account. If the
+// wallet does not wrap this particular account, an error is returned to avoid
+// account leakage (even though in theory we may be able to sign via our shared
+// keystore backend).
+func (w *keystoreWallet) SignTypedData(account accounts.Account, domainSeparator, messageHash []byte) ([]byte, error) {
+	return w.SignHash(account, accounts.TypedDataHash(domainSeparator, messageHash))
+}
+
 // SignHashWithPassphrase implements accounts.Wallet, attempting to sign the
 // given hash with the given account using passphrase as extra authentication.
 func (w *keystoreWallet) SignHashWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
@@ -137,3 +146,10 @@ func (w *keystoreWallet) SignTxWithPassphrase(account accounts.Account, passphra
 	// Account seems valid, request the keystore to sign
 	return w.keystore.SignTxWithPassphrase(account, passphrase, tx, chainID)
 }
+
+// SignTypedDataWithPassphrase implements accounts.Wallet, attempting to sign the
+// EIP-712 digest of the given domain separator and message hash with the given
+// account using passphrase as extra authentication.
+func (w *keystoreWallet) SignTypedDataWithPassphrase(account accounts.Account, passphrase string, domainSeparator, messageHash []byte) ([]byte, error) {
+	return w.SignHashWithPassphrase(account, passphrase, accounts.TypedDataHash(domainSeparator, messageHash))
+}
@@ -0,0 +1,179 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/ETSC3259/etsc/accounts"
+	"github.com/ETSC3259/etsc/common/math"
+	"github.com/ETSC3259/etsc/crypto"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	ErrInvalidMnemonic = errors.New("invalid mnemonic")
+	ErrNoMnemonic      = errors.New("account not derived from a mnemonic")
+
+	errInvalidEntropy = errors.New("entropy must be 128 to 256 bits in 32 bit steps")
+	errInvalidChild   = errors.New("derived child key is invalid")
+)
+
+// bip39Words and bip39Index are the decoded English word list and its reverse
+// lookup table.
+var (
+	bip39Words = strings.Fields(bip39English)
+	bip39Index = make(map[string]int, len(bip39Words))
+)
+
+func init() {
+	for i, word := range bip39Words {
+		bip39Index[word] = i
+	}
+}
+
+// NewMnemonic generates a new BIP-39 mnemonic phrase encoding the given number
+// of random entropy bits (128, 160, 192, 224 or 256).
+func NewMnemonic(rand io.Reader, bits int) (string, error) {
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return "", errInvalidEntropy
+	}
+	entropy := make([]byte, bits/8)
+	if _, err := io.ReadFull(rand, entropy); err != nil {
+		return "", err
+	}
+	return entropyToMnemonic(entropy)
+}
+
+// entropyToMnemonic encodes the given entropy, followed by the leading bits of
+// its SHA256 hash as a checksum, into a sequence of 11 bit word indices.
+func entropyToMnemonic(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return "", errInvalidEntropy
+	}
+	checksum := sha256.Sum256(entropy)
+
+	data := new(big.Int).SetBytes(entropy)
+	data.Lsh(data, uint(bits/32))
+	data.Or(data, big.NewInt(int64(checksum[0]>>uint(8-bits/32))))
+
+	words := make([]string, (bits+bits/32)/11)
+	mask := big.NewInt(2047)
+	for i := len(words) - 1; i >= 0; i-- {
+		words[i] = bip39Words[new(big.Int).And(data, mask).Int64()]
+		data.Rsh(data, 11)
+	}
+	return strings.Join(words, " "), nil
+}
+
+// mnemonicToEntropy decodes a mnemonic phrase back into its entropy, verifying
+// the embedded checksum.
+func mnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(norm.NFKD.String(mnemonic))
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, ErrInvalidMnemonic
+	}
+	data := new(big.Int)
+	for _, word := range words {
+		index, ok := bip39Index[word]
+		if !ok {
+			return nil, fmt.Errorf("%v: unknown word %q", ErrInvalidMnemonic, word)
+		}
+		data.Lsh(data, 11)
+		data.Or(data, big.NewInt(int64(index)))
+	}
+	var (
+		csBits  = len(words) * 11 / 33
+		entBits = len(words)*11 - csBits
+	)
+	checksum := new(big.Int).And(data, big.NewInt(int64(1<<uint(csBits)-1)))
+	entropy := math.PaddedBigBytes(data.Rsh(data, uint(csBits)), entBits/8)
+
+	hash := sha256.Sum256(entropy)
+	if int64(hash[0]>>uint(8-csBits)) != checksum.Int64() {
+		return nil, fmt.Errorf("%v: checksum mismatch", ErrInvalidMnemonic)
+	}
+	return entropy, nil
+}
+
+// mnemonicToSeed converts a mnemonic phrase and optional BIP-39 password into
+// the 64 byte binary seed used as the root of BIP-32 derivation.
+func mnemonicToSeed(mnemonic, password string) []byte {
+	var (
+		phrase = norm.NFKD.String(strings.Join(strings.Fields(mnemonic), " "))
+		salt   = norm.NFKD.String("mnemonic" + password)
+	)
+	return pbkdf2.Key([]byte(phrase), []byte(salt), 2048, 64, sha512.New)
+}
+
+// deriveKey derives the private key at the given BIP-32 derivation path from
+// a binary seed.
+func deriveKey(seed []byte, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	key, chain := sum[:32], sum[32:]
+	n := crypto.S256().Params().N
+
+	if k := new(big.Int).SetBytes(key); k.Sign() == 0 || k.Cmp(n) >= 0 {
+		return nil, errInvalidChild
+	}
+	for _, index := range path {
+		// Assemble the child derivation input depending on hardening
+		var data []byte
+		if index >= 0x80000000 {
+			data = append([]byte{0}, key...)
+		} else {
+			priv, err := crypto.ToECDSA(key)
+			if err != nil {
+				return nil, err
+			}
+			data = crypto.CompressPubkey(&priv.PublicKey)
+		}
+		data = append(data, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(data[len(data)-4:], index)
+
+		mac := hmac.New(sha512.New, chain)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+
+		// Tweak the parent key, rejecting the (astronomically unlikely) invalid children
+		tweak := new(big.Int).SetBytes(sum[:32])
+		if tweak.Cmp(n) >= 0 {
+			return nil, errInvalidChild
+		}
+		child := tweak.Add(tweak, new(big.Int).SetBytes(key))
+		child.Mod(child, n)
+		if child.Sign() == 0 {
+			return nil, errInvalidChild
+		}
+		key, chain = math.PaddedBigBytes(child, 32), sum[32:]
+	}
+	return crypto.ToECDSA(key)
+}
@@ -0,0 +1,171 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package keystore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/ETSC3259/etsc/accounts"
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/crypto"
+)
+
+// Tests that mnemonics are encoded, decoded and stretched into seeds according
+// to the official BIP-39 test vectors (using the "TREZOR" password).
+func TestMnemonicVectors(t *testing.T) {
+	tests := []struct {
+		entropy  string
+		mnemonic string
+		seed     string
+	}{
+		{
+			"00000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+		},
+		{
+			"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			"legal winner thank year wave sausage worth useful legal winner thank yellow",
+			"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+		},
+		{
+			"80808080808080808080808080808080",
+			"letter advice cage absurd amount doctor acoustic avoid letter advice cage above",
+			"d71de856f81a8acc65e6fc851a38d4d7ec216fd0796d0a6827a3ad6ed5511a30fa280f12eb2e47ed2ac03b5c462a0358d18d69fe4f985ec81778c1b370b652a8",
+		},
+		{
+			"ffffffffffffffffffffffffffffffff",
+			"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+			"ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069",
+		},
+		{
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art",
+			"bda85446c68413707090a52022edd26a1c9462295029f2e60cd7c4f2bbd3097170af7a4d73245cafa9c3cca8d561a7c3de6f5d4a10be8ed2a5e608d68f92fcc8",
+		},
+	}
+	for i, tt := range tests {
+		entropy := common.FromHex(tt.entropy)
+
+		mnemonic, err := entropyToMnemonic(entropy)
+		if err != nil {
+			t.Fatalf("test %d: failed to encode entropy: %v", i, err)
+		}
+		if mnemonic != tt.mnemonic {
+			t.Errorf("test %d: mnemonic mismatch: have %q, want %q", i, mnemonic, tt.mnemonic)
+		}
+		decoded, err := mnemonicToEntropy(tt.mnemonic)
+		if err != nil {
+			t.Fatalf("test %d: failed to decode mnemonic: %v", i, err)
+		}
+		if hex.EncodeToString(decoded) != tt.entropy {
+			t.Errorf("test %d: entropy mismatch: have %x, want %s", i, decoded, tt.entropy)
+		}
+		if seed := hex.EncodeToString(mnemonicToSeed(tt.mnemonic, "TREZOR")); seed != tt.seed {
+			t.Errorf("test %d: seed mismatch: have %s, want %s", i, seed, tt.seed)
+		}
+	}
+}
+
+// Tests that malformed mnemonics are rejected.
+func TestMnemonicInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon etsc",
+	}
+	for i, mnemonic := range tests {
+		if _, err := mnemonicToEntropy(mnemonic); err == nil {
+			t.Errorf("test %d: invalid mnemonic %q accepted", i, mnemonic)
+		}
+	}
+}
+
+// Tests that freshly generated mnemonics round trip through their entropy.
+func TestNewMnemonic(t *testing.T) {
+	for _, bits := range []int{128, 160, 192, 224, 256} {
+		mnemonic, err := NewMnemonic(rand.Reader, bits)
+		if err != nil {
+			t.Fatalf("%d bits: failed to generate mnemonic: %v", bits, err)
+		}
+		if words := len(strings.Fields(mnemonic)); words != bits/32*3 {
+			t.Errorf("%d bits: word count mismatch: have %d, want %d", bits, words, bits/32*3)
+		}
+		entropy, err := mnemonicToEntropy(mnemonic)
+		if err != nil {
+			t.Fatalf("%d bits: failed to decode mnemonic: %v", bits, err)
+		}
+		if have, _ := entropyToMnemonic(entropy); have != mnemonic {
+			t.Errorf("%d bits: round trip mismatch: have %q, want %q", bits, have, mnemonic)
+		}
+	}
+	if _, err := NewMnemonic(rand.Reader, 100); err == nil {
+		t.Errorf("invalid entropy size accepted")
+	}
+}
+
+// Tests that keys are derived according to the official BIP-32 test vectors.
+func TestDeriveKeyVectors(t *testing.T) {
+	seed := common.FromHex("000102030405060708090a0b0c0d0e0f")
+
+	tests := []struct {
+		path string
+		key  string
+	}{
+		{"m", "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35"},
+		{"m/0'", "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+		{"m/0'/1", "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368"},
+		{"m/0'/1/2'", "cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca"},
+		{"m/0'/1/2'/2", "0f479245fb19a38a1954c5c7c0ebab2f9bdfd96a17563ef28a6a4b1a2a764ef4"},
+		{"m/0'/1/2'/2/1000000000", "471b76e389e528d6de6d816857e012c5455051cad6660850e58372a6c3e6e7c8"},
+	}
+	for i, tt := range tests {
+		var path accounts.DerivationPath
+		if tt.path != "m" {
+			var err error
+			if path, err = accounts.ParseDerivationPath(tt.path); err != nil {
+				t.Fatalf("test %d: invalid path %s: %v", i, tt.path, err)
+			}
+		}
+		key, err := deriveKey(seed, path)
+		if err != nil {
+			t.Fatalf("test %d: failed to derive %s: %v", i, tt.path, err)
+		}
+		if have := hex.EncodeToString(crypto.FromECDSA(key)); have != tt.key {
+			t.Errorf("test %d: key mismatch at %s: have %s, want %s", i, tt.path, have, tt.key)
+		}
+	}
+}
+
+// Tests that the default etsc account of a well known mnemonic is derived to the
+// address produced by other BIP-44 wallets.
+func TestDeriveDefaultAccount(t *testing.T) {
+	seed := mnemonicToSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+
+	key, err := deriveKey(seed, accounts.DefaultBaseDerivationPath)
+	if err != nil {
+		t.Fatalf("failed to derive default account: %v", err)
+	}
+	want := common.HexToAddress("0x9858EfFD232B4033E47d90003D41EC34EcaEda94")
+	if have := crypto.PubkeyToAddress(key.PublicKey); have != want {
+		t.Errorf("address mismatch: have %x, want %x", have, want)
+	}
+}
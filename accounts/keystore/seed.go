@@ -0,0 +1,206 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package keystore
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ETSC3259/etsc/accounts"
+	"github.com/ETSC3259/etsc/common"
+	"github.com/pborman/uuid"
+)
+
+const (
+	seedTypeMnemonic = "bip39" // Seed derived from a BIP-39 mnemonic phrase
+	seedTypeRaw      = "bip32" // Raw BIP-32 binary seed
+)
+
+var (
+	errSeedFile   = errors.New("file contains an HD seed, not a single key")
+	errSeedFormat = errors.New("format of seed files cannot be changed")
+)
+
+// encryptedSeedJSON is the on-disk format of a seed wallet. It reuses the
+// scrypt/AES envelope of the version 3 key files, but encrypts the HD secret
+// instead of a single private key and lists the accounts pinned to the wallet.
+// There is deliberately no top level address, so older keystores skip the file.
+type encryptedSeedJSON struct {
+	Crypto  CryptoJSON `json:"crypto"`
+	Id      string     `json:"id"`
+	Version int        `json:"version"`
+	HD      *hdJSON    `json:"hd"`
+}
+
+type hdJSON struct {
+	Type     string          `json:"type"`
+	Accounts []hdAccountJSON `json:"accounts"`
+}
+
+type hdAccountJSON struct {
+	Address string `json:"address"`
+	Path    string `json:"path"`
+}
+
+// seedSecretJSON is the plaintext content encrypted into a seed file.
+type seedSecretJSON struct {
+	Entropy  string `json:"entropy,omitempty"`
+	Password string `json:"password,omitempty"`
+	Seed     string `json:"seed,omitempty"`
+}
+
+// seedSecret is the decrypted secret of a seed wallet.
+type seedSecret struct {
+	entropy  []byte // Entropy of the BIP-39 mnemonic, nil for raw seeds
+	password string // Optional BIP-39 password extending the mnemonic
+	seed     []byte // Binary seed at the root of BIP-32 derivation
+}
+
+// newMnemonicSecret validates a BIP-39 mnemonic and converts it into a seed secret.
+func newMnemonicSecret(mnemonic, password string) (*seedSecret, error) {
+	entropy, err := mnemonicToEntropy(mnemonic)
+	if err != nil {
+		return nil, err
+	}
+	return &seedSecret{entropy: entropy, password: password, seed: mnemonicToSeed(mnemonic, password)}, nil
+}
+
+// newRawSecret wraps a binary BIP-32 seed into a seed secret.
+func newRawSecret(seed []byte) (*seedSecret, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("invalid seed length %d, want 16 to 64 bytes", len(seed))
+	}
+	return &seedSecret{seed: common.CopyBytes(seed)}, nil
+}
+
+// mnemonic reconstructs the BIP-39 phrase the secret was imported from.
+func (s *seedSecret) mnemonic() (string, error) {
+	if s.entropy == nil {
+		return "", ErrNoMnemonic
+	}
+	return entropyToMnemonic(s.entropy)
+}
+
+// zero wipes the secret material from memory.
+func (s *seedSecret) zero() {
+	for i := range s.entropy {
+		s.entropy[i] = 0
+	}
+	for i := range s.seed {
+		s.seed[i] = 0
+	}
+}
+
+// encryptSeed encrypts a seed secret using the specified scrypt parameters into
+// a json blob that can be decrypted later on.
+func encryptSeed(secret *seedSecret, hd *hdJSON, auth string, scryptN, scryptP int) ([]byte, error) {
+	plain := seedSecretJSON{Password: secret.password}
+	if secret.entropy != nil {
+		plain.Entropy = hex.EncodeToString(secret.entropy)
+	} else {
+		plain.Seed = hex.EncodeToString(secret.seed)
+	}
+	data, err := json.Marshal(plain)
+	if err != nil {
+		return nil, err
+	}
+	cryptoStruct, err := EncryptDataV3(data, []byte(auth), scryptN, scryptP)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&encryptedSeedJSON{
+		Crypto:  cryptoStruct,
+		Id:      uuid.NewRandom().String(),
+		Version: version,
+		HD:      hd,
+	})
+}
+
+// decryptSeed decrypts a seed wallet from a json blob, returning the secret
+// along with the parsed file content.
+func decryptSeed(seedjson []byte, auth string) (*seedSecret, *encryptedSeedJSON, error) {
+	file := new(encryptedSeedJSON)
+	if err := json.Unmarshal(seedjson, file); err != nil {
+		return nil, nil, err
+	}
+	if file.HD == nil {
+		return nil, nil, errors.New("not a seed file")
+	}
+	data, err := DecryptDataV3(file.Crypto, auth)
+	if err != nil {
+		return nil, nil, err
+	}
+	var plain seedSecretJSON
+	if err := json.Unmarshal(data, &plain); err != nil {
+		return nil, nil, err
+	}
+	switch file.HD.Type {
+	case seedTypeMnemonic:
+		entropy, err := hex.DecodeString(plain.Entropy)
+		if err != nil {
+			return nil, nil, err
+		}
+		mnemonic, err := entropyToMnemonic(entropy)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &seedSecret{entropy: entropy, password: plain.Password, seed: mnemonicToSeed(mnemonic, plain.Password)}, file, nil
+
+	case seedTypeRaw:
+		seed, err := hex.DecodeString(plain.Seed)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &seedSecret{seed: seed}, file, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unknown seed type %q", file.HD.Type)
+	}
+}
+
+// parseAccounts converts the pinned account list of a seed file into accounts
+// rooted at the given file path.
+func (hd *hdJSON) parseAccounts(file string) ([]accounts.Account, error) {
+	accs := make([]accounts.Account, 0, len(hd.Accounts))
+	for _, acc := range hd.Accounts {
+		if !common.IsHexAddress(acc.Address) {
+			return nil, fmt.Errorf("invalid account address %q", acc.Address)
+		}
+		path, err := accounts.ParseDerivationPath(acc.Path)
+		if err != nil {
+			return nil, err
+		}
+		accs = append(accs, accounts.Account{Address: common.HexToAddress(acc.Address), URL: seedAccountURL(file, path)})
+	}
+	return accs, nil
+}
+
+// seedFileName implements the naming convention for seed files:
+// UTC--<created_at UTC ISO8601>--seed-<primary address hex>
+func seedFileName(addr common.Address) string {
+	ts := time.Now().UTC()
+	return fmt.Sprintf("UTC--%s--seed-%s", toISO8601(ts), hex.EncodeToString(addr[:]))
+}
+
+// seedAccountURL returns the URL of an account derived from the seed file at
+// the given derivation path.
+func seedAccountURL(file string, path accounts.DerivationPath) accounts.URL {
+	return accounts.URL{Scheme: KeyStoreScheme, Path: fmt.Sprintf("%s/%s", file, path)}
+}
@@ -0,0 +1,432 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package keystore
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"sync"
+	"time"
+
+	etsc "github.com/ETSC3259/etsc"
+	"github.com/ETSC3259/etsc/accounts"
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/log"
+)
+
+// Minimum time between two account self-derivations on a seed wallet, avoiding
+// hammering the chain backend on every account listing.
+const seedDeriveThrottling = time.Second
+
+// seedWallet implements the accounts.Wallet interface for keystore files holding
+// a hierarchical deterministic seed instead of a single key. The accounts pinned
+// to the seed file are always listed, whereas deriving new ones requires opening
+// the wallet with the passphrase of the file. Opening the wallet doesn't unlock
+// any of its accounts, signing still requires unlocking them in the keystore.
+type seedWallet struct {
+	url      accounts.URL // Wallet URL, pointing to the seed file in the keystore
+	keystore *KeyStore    // Keystore where the seed file originates from
+
+	secret  *seedSecret                                // Decrypted seed while the wallet is open
+	derived []accounts.Account                         // Self-derived accounts not pinned to the seed file
+	paths   map[common.Address]accounts.DerivationPath // Derivation paths of the self-derived accounts
+
+	deriveNextPath accounts.DerivationPath // Next derivation path for account auto-discovery
+	deriveChain    etsc.ChainStateReader   // Blockchain state reader to discover used account with
+	deriveReq      chan chan struct{}      // Channel to request a self-derivation on
+	deriveQuit     chan chan struct{}      // Channel to terminate the self-deriver with
+
+	stateLock sync.RWMutex // Protects read and write access to the wallet struct fields
+}
+
+// newSeedWallet creates a closed wallet around the given seed file.
+func newSeedWallet(ks *KeyStore, path string) *seedWallet {
+	return &seedWallet{
+		url:      accounts.URL{Scheme: KeyStoreScheme, Path: path},
+		keystore: ks,
+		paths:    make(map[common.Address]accounts.DerivationPath),
+	}
+}
+
+// URL implements accounts.Wallet, returning the URL of the seed file.
+func (w *seedWallet) URL() accounts.URL {
+	return w.url
+}
+
+// Status implements accounts.Wallet, returning whether the seed of the wallet
+// is currently decrypted or not.
+func (w *seedWallet) Status() (string, error) {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	if w.secret != nil {
+		return "Unlocked", nil
+	}
+	return "Locked", nil
+}
+
+// Open implements accounts.Wallet, decrypting the seed with the passphrase of
+// the file so that new accounts can be derived.
+func (w *seedWallet) Open(passphrase string) error {
+	secret, _, err := readSeed(w.url.Path, passphrase)
+	if err != nil {
+		return err
+	}
+	w.stateLock.Lock()
+	if w.secret != nil {
+		w.stateLock.Unlock()
+		secret.zero()
+		return accounts.ErrWalletAlreadyOpen
+	}
+	w.secret = secret
+	w.deriveReq = make(chan chan struct{})
+	w.deriveQuit = make(chan chan struct{})
+
+	go w.selfDerive(w.deriveReq, w.deriveQuit)
+	w.stateLock.Unlock()
+
+	// Notify anyone listening for wallet events that a new wallet was opened
+	go w.keystore.updateFeed.Send(accounts.WalletEvent{Wallet: w, Kind: accounts.WalletOpened})
+	return nil
+}
+
+// Close implements accounts.Wallet, wiping the decrypted seed from memory and
+// forgetting about any self-derived accounts.
+func (w *seedWallet) Close() error {
+	// Terminate the self-derivations, waiting for any running one to finish
+	w.stateLock.Lock()
+	quit := w.deriveQuit
+	w.deriveReq, w.deriveQuit = nil, nil
+	w.stateLock.Unlock()
+
+	if quit != nil {
+		done := make(chan struct{})
+		quit <- done
+		<-done
+	}
+	// Wipe the seed and forget about the self-derived accounts
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	if w.secret != nil {
+		w.secret.zero()
+		w.secret = nil
+	}
+	w.derived = nil
+	w.paths = make(map[common.Address]accounts.DerivationPath)
+
+	return nil
+}
+
+// Accounts implements accounts.Wallet, returning the accounts pinned to the seed
+// file, followed by any accounts discovered via self-derivation. If the wallet
+// is open, the account list is periodically expanded based on current chain state.
+func (w *seedWallet) Accounts() []accounts.Account {
+	// Attempt self-derivation if it's running
+	w.stateLock.RLock()
+	reqs := w.deriveReq
+	w.stateLock.RUnlock()
+
+	reqc := make(chan struct{}, 1)
+	select {
+	case reqs <- reqc:
+		// Self-derivation request accepted, wait for it
+		<-reqc
+	default:
+		// Self-derivation offline, throttled or busy, skip
+	}
+	// Return whatever account list we ended up with
+	accs := w.keystore.cache.seedAccounts(w.url.Path)
+
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	for _, account := range w.derived {
+		if !containsAccount(accs, account.Address) {
+			accs = append(accs, account)
+		}
+	}
+	return accs
+}
+
+// selfDerive is an account derivation loop that upon request attempts to find
+// new non-zero accounts. It runs while the wallet is open, throttling requests
+// to avoid hammering the chain backend on every account listing.
+func (w *seedWallet) selfDerive(reqs chan chan struct{}, quit chan chan struct{}) {
+	for {
+		// Wait until either derivation or termination is requested
+		var reqc chan struct{}
+		select {
+		case done := <-quit:
+			close(done)
+			return
+		case reqc = <-reqs:
+		}
+		w.deriveAccounts()
+
+		// Notify the requester and loop after a bit of time (to avoid trashing)
+		reqc <- struct{}{}
+		select {
+		case done := <-quit:
+			close(done)
+			return
+		case <-time.After(seedDeriveThrottling):
+		}
+	}
+}
+
+// deriveAccounts discovers new non-zero accounts from the seed, stopping at the
+// first empty one (which is nonetheless added to the account list). The chain
+// is queried without holding the state lock, so a slow backend doesn't stall
+// the other users of the wallet.
+func (w *seedWallet) deriveAccounts() {
+	w.stateLock.RLock()
+	chain := w.deriveChain
+	nextPath := make(accounts.DerivationPath, len(w.deriveNextPath))
+	copy(nextPath, w.deriveNextPath)
+	w.stateLock.RUnlock()
+
+	if chain == nil {
+		return
+	}
+	var (
+		accs  []accounts.Account
+		paths []accounts.DerivationPath
+		ctx   = context.Background()
+	)
+	for {
+		// Derive the next account and check its status against the current chain state
+		address, err := w.deriveAddress(nextPath)
+		if err != nil {
+			log.Warn("Seed wallet account derivation failed", "url", w.url, "err", err)
+			break
+		}
+		balance, err := chain.BalanceAt(ctx, address, nil)
+		if err != nil {
+			log.Warn("Seed wallet balance retrieval failed", "url", w.url, "err", err)
+			break
+		}
+		nonce, err := chain.NonceAt(ctx, address, nil)
+		if err != nil {
+			log.Warn("Seed wallet nonce retrieval failed", "url", w.url, "err", err)
+			break
+		}
+		path := make(accounts.DerivationPath, len(nextPath))
+		copy(path, nextPath)
+
+		accs = append(accs, accounts.Account{Address: address, URL: seedAccountURL(w.url.Path, path)})
+		paths = append(paths, path)
+
+		// If the account is empty, stop self-derivation until it's used
+		if balance.Sign() == 0 && nonce == 0 {
+			break
+		}
+		nextPath[len(nextPath)-1]++
+	}
+	// Start tracking the accounts locally unless they're already known
+	pinned := w.keystore.cache.seedAccounts(w.url.Path)
+
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	if w.secret == nil {
+		return
+	}
+	for i, account := range accs {
+		if _, known := w.paths[account.Address]; !known && !containsAccount(pinned, account.Address) {
+			w.derived = append(w.derived, account)
+			w.paths[account.Address] = paths[i]
+
+			log.Info("Seed wallet discovered new account", "address", account.Address, "path", paths[i])
+		}
+	}
+	w.deriveNextPath = nextPath
+}
+
+// deriveAddress derives the address of the account at the given path from the
+// decrypted seed.
+func (w *seedWallet) deriveAddress(path accounts.DerivationPath) (common.Address, error) {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	if w.secret == nil {
+		return common.Address{}, accounts.ErrWalletClosed
+	}
+	key, err := deriveKey(w.secret.seed, path)
+	if err != nil {
+		return common.Address{}, err
+	}
+	defer zeroKey(key)
+	return crypto.PubkeyToAddress(key.PublicKey), nil
+}
+
+// Contains implements accounts.Wallet, returning whether a particular account is
+// or is not pinned to or self-derived by this wallet instance.
+func (w *seedWallet) Contains(account accounts.Account) bool {
+	_, err := w.resolve(account)
+	return err == nil
+}
+
+// resolve looks up the derivation path of an account tracked by the wallet.
+func (w *seedWallet) resolve(account accounts.Account) (accounts.DerivationPath, error) {
+	for _, pinned := range w.keystore.cache.seedAccounts(w.url.Path) {
+		if pinned.Address != account.Address {
+			continue
+		}
+		if account.URL != (accounts.URL{}) && account.URL != pinned.URL {
+			continue
+		}
+		if _, path, ok := w.keystore.cache.seedPath(pinned.URL); ok {
+			return path, nil
+		}
+	}
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	if path, ok := w.paths[account.Address]; ok {
+		if account.URL == (accounts.URL{}) || account.URL == seedAccountURL(w.url.Path, path) {
+			return path, nil
+		}
+	}
+	return nil, accounts.ErrUnknownAccount
+}
+
+// Derive implements accounts.Wallet, deriving a new account at the specific
+// derivation path. If pin is set to true, the account will be added to the list
+// of accounts stored in the seed file.
+func (w *seedWallet) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	w.stateLock.RLock()
+	if w.secret == nil {
+		w.stateLock.RUnlock()
+		return accounts.Account{}, accounts.ErrWalletClosed
+	}
+	key, err := deriveKey(w.secret.seed, path)
+	w.stateLock.RUnlock()
+
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	account := accounts.Account{
+		Address: crypto.PubkeyToAddress(key.PublicKey),
+		URL:     seedAccountURL(w.url.Path, path),
+	}
+	zeroKey(key)
+
+	if !pin {
+		return account, nil
+	}
+	return account, w.keystore.pinSeedAccount(w.url.Path, account, path)
+}
+
+// SelfDerive implements accounts.Wallet, trying to discover accounts that the
+// user used previously (based on the chain state), but ones that he/she did not
+// explicitly pin to the wallet manually. Self derivation only runs while the
+// wallet is open, in the background upon account listing (and even then throttled).
+func (w *seedWallet) SelfDerive(base accounts.DerivationPath, chain etsc.ChainStateReader) {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	w.deriveNextPath = make(accounts.DerivationPath, len(base))
+	copy(w.deriveNextPath[:], base[:])
+
+	w.deriveChain = chain
+}
+
+// SignHash implements accounts.Wallet, attempting to sign the given hash with
+// the given account. The account needs to be unlocked in the keystore, whether
+// the wallet is open or not.
+func (w *seedWallet) SignHash(account accounts.Account, hash []byte) ([]byte, error) {
+	if _, err := w.resolve(account); err != nil {
+		return nil, err
+	}
+	return w.keystore.SignHash(account, hash)
+}
+
+// SignTx implements accounts.Wallet, attempting to sign the given transaction
+// with the given account. The account needs to be unlocked in the keystore,
+// whether the wallet is open or not.
+func (w *seedWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	if _, err := w.resolve(account); err != nil {
+		return nil, err
+	}
+	return w.keystore.SignTx(account, tx, chainID)
+}
+
+// SignTypedData implements accounts.Wallet, attempting to sign the EIP-712 digest
+// of the given domain separator and message hash with the given account.
+func (w *seedWallet) SignTypedData(account accounts.Account, domainSeparator, messageHash []byte) ([]byte, error) {
+	return w.SignHash(account, accounts.TypedDataHash(domainSeparator, messageHash))
+}
+
+// SignHashWithPassphrase implements accounts.Wallet, attempting to sign the
+// given hash with the given account using passphrase to decrypt the seed.
+func (w *seedWallet) SignHashWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
+	path, err := w.resolve(account)
+	if err != nil {
+		return nil, err
+	}
+	key, err := w.keystore.seedKey(w.url.Path, path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(key.PrivateKey)
+	return crypto.Sign(hash, key.PrivateKey)
+}
+
+// SignTxWithPassphrase implements accounts.Wallet, attempting to sign the given
+// transaction with the given account using passphrase to decrypt the seed.
+func (w *seedWallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	path, err := w.resolve(account)
+	if err != nil {
+		return nil, err
+	}
+	key, err := w.keystore.seedKey(w.url.Path, path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(key.PrivateKey)
+	return signTx(tx, chainID, key.PrivateKey)
+}
+
+// SignTypedDataWithPassphrase implements accounts.Wallet, attempting to sign the
+// EIP-712 digest of the given domain separator and message hash with the given
+// account using passphrase to decrypt the seed.
+func (w *seedWallet) SignTypedDataWithPassphrase(account accounts.Account, passphrase string, domainSeparator, messageHash []byte) ([]byte, error) {
+	return w.SignHashWithPassphrase(account, passphrase, accounts.TypedDataHash(domainSeparator, messageHash))
+}
+
+// containsAccount reports whether an account list contains the given address.
+func containsAccount(accs []accounts.Account, address common.Address) bool {
+	for _, account := range accs {
+		if account.Address == address {
+			return true
+		}
+	}
+	return false
+}
+
+// signTx signs a transaction with EIP155 or homestead rules depending on the
+// presence of the chain ID.
+func signTx(tx *types.Transaction, chainID *big.Int, key *ecdsa.PrivateKey) (*types.Transaction, error) {
+	if chainID != nil {
+		return types.SignTx(tx, types.NewEIP155Signer(chainID), key)
+	}
+	return types.SignTx(tx, types.HomesteadSigner{}, key)
+}
@@ -0,0 +1,453 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package keystore
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ETSC3259/etsc/accounts"
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/crypto"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+// Tests that an imported mnemonic is stored as a single seed wallet, which is
+// picked up with all its pinned accounts by other keystores on the same folder.
+func TestSeedWalletImport(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	second := append(accounts.DerivationPath{}, accounts.DefaultBaseDerivationPath...)
+	second[len(second)-1] = 1
+
+	accs, err := ks.ImportMnemonic(testMnemonic, "", "foo", accounts.DefaultBaseDerivationPath, second)
+	if err != nil {
+		t.Fatalf("failed to import mnemonic: %v", err)
+	}
+	if len(accs) != 2 {
+		t.Fatalf("pinned account count mismatch: have %d, want 2", len(accs))
+	}
+	if want := common.HexToAddress("0x9858EfFD232B4033E47d90003D41EC34EcaEda94"); accs[0].Address != want {
+		t.Errorf("default account mismatch: have %x, want %x", accs[0].Address, want)
+	}
+	if _, err := ks.ImportMnemonic(testMnemonic, "", "foo"); err == nil {
+		t.Errorf("duplicate import succeeded")
+	}
+	// Ensure the seed file doesn't look like a plain key file
+	file := accs[0].URL.Path[:len(accs[0].URL.Path)-len(accounts.DefaultBaseDerivationPath.String())-1]
+	blob, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read seed file: %v", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(blob, &fields); err != nil {
+		t.Fatalf("failed to parse seed file: %v", err)
+	}
+	if _, ok := fields["address"]; ok {
+		t.Errorf("seed file contains top level address")
+	}
+	if _, err := DecryptKey(blob, "foo"); err != errSeedFile {
+		t.Errorf("seed file decryption error mismatch: have %v, want %v", err, errSeedFile)
+	}
+	// Ensure a fresh keystore finds the same wallet and accounts
+	for i, store := range []*KeyStore{ks, NewKeyStore(dir, veryLightScryptN, veryLightScryptP)} {
+		wallets := store.Wallets()
+		if len(wallets) != 1 {
+			t.Fatalf("store %d: wallet count mismatch: have %d, want 1", i, len(wallets))
+		}
+		if url := wallets[0].URL(); url != (accounts.URL{Scheme: KeyStoreScheme, Path: file}) {
+			t.Errorf("store %d: wallet URL mismatch: have %v, want %v", i, url, file)
+		}
+		if have := wallets[0].Accounts(); len(have) != 2 || have[0] != accs[0] || have[1] != accs[1] {
+			t.Errorf("store %d: wallet accounts mismatch: have %v, want %v", i, have, accs)
+		}
+		if have := store.Accounts(); len(have) != 2 {
+			t.Errorf("store %d: keystore account count mismatch: have %d, want 2", i, len(have))
+		}
+	}
+}
+
+// Tests that accounts can only be derived from open seed wallets, and that
+// pinned accounts are persisted into the seed file.
+func TestSeedWalletDerive(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	if _, err := ks.ImportMnemonic(testMnemonic, "", "foo"); err != nil {
+		t.Fatalf("failed to import mnemonic: %v", err)
+	}
+	wallet := ks.Wallets()[0]
+
+	path := accounts.DerivationPath{0x80000000 + 44, 0x80000000 + 60, 0x80000000 + 1, 0, 0}
+	if _, err := wallet.Derive(path, true); err != accounts.ErrWalletClosed {
+		t.Fatalf("closed derivation error mismatch: have %v, want %v", err, accounts.ErrWalletClosed)
+	}
+	if err := wallet.Open("bar"); err != ErrDecrypt {
+		t.Fatalf("open with bad passphrase error mismatch: have %v, want %v", err, ErrDecrypt)
+	}
+	if err := wallet.Open("foo"); err != nil {
+		t.Fatalf("failed to open wallet: %v", err)
+	}
+	if status, _ := wallet.Status(); status != "Unlocked" {
+		t.Errorf("status mismatch: have %s, want Unlocked", status)
+	}
+	// Derive an account without pinning, then with pinning
+	account, err := wallet.Derive(path, false)
+	if err != nil {
+		t.Fatalf("failed to derive account: %v", err)
+	}
+	if wallet.Contains(account) || len(wallet.Accounts()) != 1 {
+		t.Errorf("unpinned account tracked by wallet")
+	}
+	if pinned, err := wallet.Derive(path, true); err != nil || pinned != account {
+		t.Fatalf("pinned derivation mismatch: have %v (%v), want %v", pinned, err, account)
+	}
+	if !wallet.Contains(account) || len(wallet.Accounts()) != 2 {
+		t.Errorf("pinned account not tracked by wallet")
+	}
+	// Ensure the derivation survives a restart
+	accs := NewKeyStore(dir, veryLightScryptN, veryLightScryptP).Wallets()[0].Accounts()
+	if len(accs) != 2 || accs[1] != account {
+		t.Errorf("persisted accounts mismatch: have %v, want second %v", accs, account)
+	}
+	if err := wallet.Close(); err != nil {
+		t.Fatalf("failed to close wallet: %v", err)
+	}
+	if status, _ := wallet.Status(); status != "Locked" {
+		t.Errorf("status mismatch: have %s, want Locked", status)
+	}
+}
+
+// Tests that seed accounts can be signed with by opening the wallet, unlocking
+// the account or supplying the passphrase.
+func TestSeedWalletSign(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	accs, err := ks.ImportMnemonic(testMnemonic, "", "foo")
+	if err != nil {
+		t.Fatalf("failed to import mnemonic: %v", err)
+	}
+	account, wallet := accs[0], ks.Wallets()[0]
+
+	verify := func(sig []byte, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+		pub, err := crypto.SigToPub(testSigData, sig)
+		if err != nil {
+			t.Fatalf("failed to recover signer: %v", err)
+		}
+		if signer := crypto.PubkeyToAddress(*pub); signer != account.Address {
+			t.Fatalf("signer mismatch: have %x, want %x", signer, account.Address)
+		}
+	}
+	if _, err := wallet.SignHash(account, testSigData); err != ErrLocked {
+		t.Fatalf("locked signing error mismatch: have %v, want %v", err, ErrLocked)
+	}
+	if _, err := wallet.SignHashWithPassphrase(account, "bar", testSigData); err != ErrDecrypt {
+		t.Fatalf("bad passphrase signing error mismatch: have %v, want %v", err, ErrDecrypt)
+	}
+	verify(wallet.SignHashWithPassphrase(account, "foo", testSigData))
+	verify(ks.SignHashWithPassphrase(account, "foo", testSigData))
+
+	if err := ks.Unlock(account, "foo"); err != nil {
+		t.Fatalf("failed to unlock account: %v", err)
+	}
+	verify(wallet.SignHash(account, testSigData))
+	verify(ks.SignHash(account, testSigData))
+	ks.Lock(account.Address)
+
+	// Opening the wallet must not unlock its accounts
+	if err := wallet.Open("foo"); err != nil {
+		t.Fatalf("failed to open wallet: %v", err)
+	}
+	if _, err := wallet.SignHash(account, testSigData); err != ErrLocked {
+		t.Fatalf("open wallet signing error mismatch: have %v, want %v", err, ErrLocked)
+	}
+	if _, err := wallet.SignHash(accounts.Account{Address: common.Address{1}}, testSigData); err != accounts.ErrUnknownAccount {
+		t.Errorf("foreign account signing error mismatch: have %v, want %v", err, accounts.ErrUnknownAccount)
+	}
+}
+
+// Tests that mnemonics can be exported from seed wallets, and that the seed file
+// passphrase can be changed.
+func TestSeedWalletExportUpdate(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	accs, err := ks.ImportMnemonic(testMnemonic, "TREZOR", "foo")
+	if err != nil {
+		t.Fatalf("failed to import mnemonic: %v", err)
+	}
+	if _, _, err := ks.ExportMnemonic(accs[0], "bar"); err != ErrDecrypt {
+		t.Fatalf("bad passphrase export error mismatch: have %v, want %v", err, ErrDecrypt)
+	}
+	mnemonic, password, err := ks.ExportMnemonic(accs[0], "foo")
+	if err != nil {
+		t.Fatalf("failed to export mnemonic: %v", err)
+	}
+	if mnemonic != testMnemonic || password != "TREZOR" {
+		t.Errorf("exported mnemonic mismatch: have %q/%q, want %q/%q", mnemonic, password, testMnemonic, "TREZOR")
+	}
+	if err := ks.Update(accs[0], "foo", "bar"); err != nil {
+		t.Fatalf("failed to update passphrase: %v", err)
+	}
+	if _, _, err := ks.ExportMnemonic(accs[0], "foo"); err != ErrDecrypt {
+		t.Errorf("old passphrase export error mismatch: have %v, want %v", err, ErrDecrypt)
+	}
+	if _, _, err := ks.ExportMnemonic(accs[0], "bar"); err != nil {
+		t.Errorf("failed to export with new passphrase: %v", err)
+	}
+	// Raw seeds and plain keys have no mnemonic to export
+	raw, err := ks.ImportSeed(common.FromHex("000102030405060708090a0b0c0d0e0f"), "foo")
+	if err != nil {
+		t.Fatalf("failed to import raw seed: %v", err)
+	}
+	if _, _, err := ks.ExportMnemonic(raw[0], "foo"); err != ErrNoMnemonic {
+		t.Errorf("raw seed export error mismatch: have %v, want %v", err, ErrNoMnemonic)
+	}
+	plain, err := ks.NewAccount("foo")
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	if _, _, err := ks.ExportMnemonic(plain, "foo"); err != ErrNoMnemonic {
+		t.Errorf("plain key export error mismatch: have %v, want %v", err, ErrNoMnemonic)
+	}
+}
+
+// Tests that deleting seed accounts only unpins them, keeping the seed until the
+// wallet itself is deleted.
+func TestSeedWalletDelete(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	second := append(accounts.DerivationPath{}, accounts.DefaultBaseDerivationPath...)
+	second[len(second)-1] = 1
+
+	accs, err := ks.ImportMnemonic(testMnemonic, "", "foo", accounts.DefaultBaseDerivationPath, second)
+	if err != nil {
+		t.Fatalf("failed to import mnemonic: %v", err)
+	}
+	if err := ks.Delete(accs[0], "bar"); err != ErrDecrypt {
+		t.Fatalf("bad passphrase delete error mismatch: have %v, want %v", err, ErrDecrypt)
+	}
+	if err := ks.Delete(accs[0], "foo"); err != nil {
+		t.Fatalf("failed to delete first account: %v", err)
+	}
+	if have := ks.Accounts(); len(have) != 1 || have[0] != accs[1] {
+		t.Fatalf("accounts mismatch after unpin: have %v, want %v", have, accs[1:])
+	}
+	if err := ks.Delete(accs[1], "foo"); err != nil {
+		t.Fatalf("failed to delete second account: %v", err)
+	}
+	if have := ks.Accounts(); len(have) != 0 {
+		t.Fatalf("accounts remaining after unpinning all: %v", have)
+	}
+	// The seed must survive, with its accounts still derivable
+	wallets := ks.Wallets()
+	if len(wallets) != 1 {
+		t.Fatalf("wallet count mismatch after unpinning all accounts: have %d, want 1", len(wallets))
+	}
+	if err := wallets[0].Open("foo"); err != nil {
+		t.Fatalf("failed to open wallet: %v", err)
+	}
+	if account, err := wallets[0].Derive(second, true); err != nil || account.Address != accs[1].Address {
+		t.Fatalf("failed to re-derive account: have %x (%v), want %x", account.Address, err, accs[1].Address)
+	}
+	wallets[0].Close()
+
+	// Deleting the wallet itself must remove the seed file
+	if err := ks.DeleteWallet(wallets[0].URL(), "bar"); err != ErrDecrypt {
+		t.Fatalf("bad passphrase wallet delete error mismatch: have %v, want %v", err, ErrDecrypt)
+	}
+	if err := ks.DeleteWallet(wallets[0].URL(), "foo"); err != nil {
+		t.Fatalf("failed to delete wallet: %v", err)
+	}
+	if wallets := ks.Wallets(); len(wallets) != 0 {
+		t.Fatalf("wallets remaining after deleting the wallet: %v", wallets)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("files remaining after deleting the wallet: %d", len(files))
+	}
+	if err := ks.DeleteWallet(wallets[0].URL(), "foo"); err != accounts.ErrUnknownWallet {
+		t.Errorf("deleted wallet delete error mismatch: have %v, want %v", err, accounts.ErrUnknownWallet)
+	}
+}
+
+// testChainState is a chain state reader reporting a given set of used accounts.
+type testChainState map[common.Address]bool
+
+func (s testChainState) BalanceAt(ctx context.Context, account common.Address, number *big.Int) (*big.Int, error) {
+	if s[account] {
+		return big.NewInt(1), nil
+	}
+	return new(big.Int), nil
+}
+
+func (s testChainState) StorageAt(ctx context.Context, account common.Address, key common.Hash, number *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (s testChainState) CodeAt(ctx context.Context, account common.Address, number *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (s testChainState) NonceAt(ctx context.Context, account common.Address, number *big.Int) (uint64, error) {
+	return 0, nil
+}
+
+// Tests that open seed wallets discover used accounts based on the chain state.
+func TestSeedWalletSelfDerive(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	if _, err := ks.ImportMnemonic(testMnemonic, "", "foo"); err != nil {
+		t.Fatalf("failed to import mnemonic: %v", err)
+	}
+	wallet := ks.Wallets()[0]
+
+	// Mark the first three accounts as used and derive the expected addresses
+	var (
+		seed  = mnemonicToSeed(testMnemonic, "")
+		chain = make(testChainState)
+		addrs []common.Address
+	)
+	for i := 0; i < 4; i++ {
+		path := append(accounts.DerivationPath{}, accounts.DefaultBaseDerivationPath...)
+		path[len(path)-1] = uint32(i)
+
+		key, err := deriveKey(seed, path)
+		if err != nil {
+			t.Fatalf("failed to derive account %d: %v", i, err)
+		}
+		addrs = append(addrs, crypto.PubkeyToAddress(key.PublicKey))
+		if i < 3 {
+			chain[addrs[i]] = true
+		}
+	}
+	wallet.SelfDerive(accounts.DefaultBaseDerivationPath, chain)
+	if accs := wallet.Accounts(); len(accs) != 1 {
+		t.Fatalf("closed wallet self-derived accounts: %v", accs)
+	}
+	if err := wallet.Open("foo"); err != nil {
+		t.Fatalf("failed to open wallet: %v", err)
+	}
+	defer wallet.Close()
+
+	// Self-derivation runs in the background, wait for it to pick up the requests
+	var accs []accounts.Account
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if accs = wallet.Accounts(); len(accs) == len(addrs) {
+			break
+		}
+	}
+	if len(accs) != len(addrs) {
+		t.Fatalf("account count mismatch: have %d, want %d", len(accs), len(addrs))
+	}
+	for i, account := range accs {
+		if account.Address != addrs[i] {
+			t.Errorf("account %d: address mismatch: have %x, want %x", i, account.Address, addrs[i])
+		}
+	}
+	// Self-derived accounts should be unlockable, but not signable until unlocked
+	if _, err := wallet.SignHash(accs[2], testSigData); err != ErrLocked {
+		t.Errorf("locked self-derived signing error mismatch: have %v, want %v", err, ErrLocked)
+	}
+	if err := ks.TimedUnlock(accs[2], "foo", time.Minute); err != nil {
+		t.Fatalf("failed to unlock self-derived account: %v", err)
+	}
+	if _, err := wallet.SignHash(accs[2], testSigData); err != nil {
+		t.Errorf("failed to sign with self-derived account: %v", err)
+	}
+}
+
+// slowChainState is a chain state reader blocking all requests until released.
+type slowChainState struct {
+	testChainState
+	release chan struct{}
+}
+
+func (s *slowChainState) BalanceAt(ctx context.Context, account common.Address, number *big.Int) (*big.Int, error) {
+	<-s.release
+	return s.testChainState.BalanceAt(ctx, account, number)
+}
+
+// Tests that a slow chain backend doesn't stall listing the accounts of a seed
+// wallet while a self-derivation is waiting on it.
+func TestSeedWalletSelfDeriveSlowChain(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	if _, err := ks.ImportMnemonic(testMnemonic, "", "foo"); err != nil {
+		t.Fatalf("failed to import mnemonic: %v", err)
+	}
+	wallet := ks.Wallets()[0]
+
+	chain := &slowChainState{testChainState: make(testChainState), release: make(chan struct{})}
+	wallet.SelfDerive(accounts.DefaultBaseDerivationPath, chain)
+	if err := wallet.Open("foo"); err != nil {
+		t.Fatalf("failed to open wallet: %v", err)
+	}
+	defer wallet.Close()
+
+	// Keep listing the accounts until one of the listings gets stuck deriving
+	stuck := make(chan struct{})
+	go func() {
+		for {
+			done := make(chan struct{})
+			go func() {
+				wallet.Accounts()
+				close(done)
+			}()
+			select {
+			case <-done:
+				time.Sleep(10 * time.Millisecond)
+			case <-time.After(100 * time.Millisecond):
+				close(stuck)
+				return
+			}
+		}
+	}()
+	select {
+	case <-stuck:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("self-derivation never queried the chain")
+	}
+	// Other listings and wallet operations must not wait for the chain
+	done := make(chan struct{})
+	go func() {
+		wallet.Accounts()
+		wallet.Status()
+		wallet.Contains(accounts.Account{Address: common.Address{1}})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("wallet stalled by the chain backend")
+	}
+	close(chain.release)
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/ETSC3259/etsc/common"
 	"github.com/ETSC3259/etsc/common/hexutil"
 	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/crypto"
 	"github.com/ETSC3259/etsc/log"
 	"github.com/ETSC3259/etsc/rlp"
 )
@@ -51,10 +52,12 @@ const (
 	ledgerOpRetrieveAddress  ledgerOpcode = 0x02 // Returns the public key and etsc address for a given BIP 32 path
 	ledgerOpSignTransaction  ledgerOpcode = 0x04 // Signs an etsc transaction after having the user validate the parameters
 	ledgerOpGetConfiguration ledgerOpcode = 0x06 // Returns specific wallet application configuration
+	ledgerOpSignTypedMessage ledgerOpcode = 0x0c // Signs an EIP-712 hashed typed message after having the user validate it
 
 	ledgerP1DirectlyFetchAddress    ledgerParam1 = 0x00 // Return address directly from the wallet
 	ledgerP1InitTransactionData     ledgerParam1 = 0x00 // First transaction data block for signing
 	ledgerP1ContTransactionData     ledgerParam1 = 0x80 // Subsequent transaction data block for signing
+	ledgerP1SignTypedMessageHashes  ledgerParam1 = 0x00 // Typed message is given as domain separator and message hashes
 	ledgerP2DiscardAddressChainCode ledgerParam2 = 0x00 // Do not return the chain code along with the address
 )
 
@@ -168,6 +171,25 @@ func (w *ledgerDriver) SignTx(path accounts.DerivationPath, tx *types.Transactio
 	return w.ledgerSign(path, tx, chainID)
 }
 
+// SignTypedMessage implements usbwallet.driver, sending the EIP-712 domain
+// separator and message hash to the Ledger and waiting for the user to confirm
+// or deny signing it.
+//
+// Note, typed data signing was only added in v1.5.0 of the etsc application,
+// older versions will return an error.
+func (w *ledgerDriver) SignTypedMessage(path accounts.DerivationPath, domainSeparator, messageHash []byte) (common.Address, []byte, error) {
+	// If the etsc app doesn't run, abort
+	if w.offline() {
+		return common.Address{}, nil, accounts.ErrWalletClosed
+	}
+	// Ensure the wallet is capable of signing typed data
+	if w.version[0] < 1 || (w.version[0] == 1 && w.version[1] < 5) {
+		return common.Address{}, nil, fmt.Errorf("Ledger v%d.%d.%d doesn't support signing typed data, please update to v1.5.0 at least", w.version[0], w.version[1], w.version[2])
+	}
+	// All infos gathered and metadata checks out, request signing
+	return w.ledgerSignTypedMessage(path, domainSeparator, messageHash)
+}
+
 // ledgerVersion retrieves the current version of the etsc wallet app running
 // on the Ledger wallet.
 //
@@ -363,6 +385,64 @@ func (w *ledgerDriver) ledgerSign(derivationPath []uint32, tx *types.Transaction
 	return sender, signed, nil
 }
 
+// ledgerSignTypedMessage sends the EIP-712 domain separator and message hash to
+// the Ledger wallet, and waits for the user to confirm or deny signing them.
+//
+// The typed message signing protocol is defined as follows:
+//
+//   CLA | INS | P1 | P2 | Lc  | Le
+//   ----+-----+----+----+-----+---
+//    E0 | 0C  | 00 | 00 | variable | variable
+//
+// Where the input is:
+//
+//   Description                                      | Length
+//   -------------------------------------------------+----------
+//   Number of BIP 32 derivations to perform (max 10) | 1 byte
+//   First derivation index (big endian)              | 4 bytes
+//   ...                                              | 4 bytes
+//   Last derivation index (big endian)               | 4 bytes
+//   Domain separator hash                            | 32 bytes
+//   Message struct hash                              | 32 bytes
+//
+// And the output data is:
+//
+//   Description | Length
+//   ------------+---------
+//   signature V | 1 byte
+//   signature R | 32 bytes
+//   signature S | 32 bytes
+func (w *ledgerDriver) ledgerSignTypedMessage(derivationPath []uint32, domainSeparator, messageHash []byte) (common.Address, []byte, error) {
+	if len(domainSeparator) != 32 || len(messageHash) != 32 {
+		return common.Address{}, nil, errors.New("typed message hashes must be 32 bytes")
+	}
+	// Flatten the derivation path into the Ledger request
+	path := make([]byte, 1+4*len(derivationPath))
+	path[0] = byte(len(derivationPath))
+	for i, component := range derivationPath {
+		binary.BigEndian.PutUint32(path[1+4*i:], component)
+	}
+	payload := append(path, domainSeparator...)
+	payload = append(payload, messageHash...)
+
+	// Send the request and wait for the response
+	reply, err := w.ledgerExchange(ledgerOpSignTypedMessage, ledgerP1SignTypedMessageHashes, 0, payload)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	// Extract the etsc signature and do a sanity validation
+	if len(reply) != 65 {
+		return common.Address{}, nil, errors.New("reply lacks signature")
+	}
+	signature := append(reply[1:], reply[0]-27) // Transform V from 27/28 to 0/1
+
+	pubkey, err := crypto.SigToPub(accounts.TypedDataHash(domainSeparator, messageHash), signature)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	return crypto.PubkeyToAddress(*pubkey), signature, nil
+}
+
 // ledgerExchange performs a data exchange with the Ledger wallet, sending it a
 // message and retrieving the response.
 //
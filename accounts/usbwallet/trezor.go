@@ -159,6 +159,13 @@ func (w *trezorDriver) SignTx(path accounts.DerivationPath, tx *types.Transactio
 	return w.trezorSign(path, tx, chainID)
 }
 
+// SignTypedMessage implements usbwallet.driver, however EIP-712 typed data
+// signing is not supported by the Trezor firmware, so this method will always
+// return an error.
+func (w *trezorDriver) SignTypedMessage(path accounts.DerivationPath, domainSeparator, messageHash []byte) (common.Address, []byte, error) {
+	return common.Address{}, nil, accounts.ErrNotSupported
+}
+
 // trezorDerive sends a derivation request to the Trezor device and returns the
 // etsc address located on that path.
 func (w *trezorDriver) trezorDerive(derivationPath []uint32) (common.Address, error) {
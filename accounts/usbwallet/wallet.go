@@ -66,6 +66,10 @@ type driver interface {
 	// SignTx sends the transaction to the USB device and waits for the user to confirm
 	// or deny the transaction.
 	SignTx(path accounts.DerivationPath, tx *types.Transaction, chainID *big.Int) (common.Address, *types.Transaction, error)
+
+	// SignTypedMessage sends the EIP-712 domain separator and message hash to the
+	// USB device and waits for the user to confirm or deny the signature.
+	SignTypedMessage(path accounts.DerivationPath, domainSeparator, messageHash []byte) (common.Address, []byte, error)
 }
 
 // wallet represents the common functionality shared by all USB hardware
@@ -547,6 +551,51 @@ func (w *wallet) SignTx(account accounts.Account, tx *types.Transaction, chainID
 	return signed, nil
 }
 
+// SignTypedData implements accounts.Wallet. It sends the EIP-712 domain separator
+// and message hash over to the hardware wallet to request a confirmation from the
+// user. It returns either the signature or a failure if the user denied signing.
+//
+// Note, not all devices (or app versions) support typed data signing, in which
+// case an error is returned.
+func (w *wallet) SignTypedData(account accounts.Account, domainSeparator, messageHash []byte) ([]byte, error) {
+	w.stateLock.RLock() // Comms have own mutex, this is for the state fields
+	defer w.stateLock.RUnlock()
+
+	// If the wallet is closed, abort
+	if w.device == nil {
+		return nil, accounts.ErrWalletClosed
+	}
+	// Make sure the requested account is contained within
+	path, ok := w.paths[account.Address]
+	if !ok {
+		return nil, accounts.ErrUnknownAccount
+	}
+	// All infos gathered and metadata checks out, request signing
+	<-w.commsLock
+	defer func() { w.commsLock <- struct{}{} }()
+
+	// Ensure the device isn't screwed with while user confirmation is pending
+	// TODO(karalabe): remove if hotplug lands on Windows
+	w.hub.commsLock.Lock()
+	w.hub.commsPend++
+	w.hub.commsLock.Unlock()
+
+	defer func() {
+		w.hub.commsLock.Lock()
+		w.hub.commsPend--
+		w.hub.commsLock.Unlock()
+	}()
+	// Sign the typed data and verify the signer to avoid hardware fault surprises
+	signer, signature, err := w.driver.SignTypedMessage(path, domainSeparator, messageHash)
+	if err != nil {
+		return nil, err
+	}
+	if signer != account.Address {
+		return nil, fmt.Errorf("signer mismatch: expected %s, got %s", account.Address.Hex(), signer.Hex())
+	}
+	return signature, nil
+}
+
 // SignHashWithPassphrase implements accounts.Wallet, however signing arbitrary
 // data is not supported for Ledger wallets, so this method will always return
 // an error.
@@ -560,3 +609,10 @@ func (w *wallet) SignHashWithPassphrase(account accounts.Account, passphrase str
 func (w *wallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
 	return w.SignTx(account, tx, chainID)
 }
+
+// SignTypedDataWithPassphrase implements accounts.Wallet, attempting to sign the
+// given typed data with the given account using passphrase as extra authentication.
+// Since USB wallets don't rely on passphrases, these are silently ignored.
+func (w *wallet) SignTypedDataWithPassphrase(account accounts.Account, passphrase string, domainSeparator, messageHash []byte) ([]byte, error) {
+	return w.SignTypedData(account, domainSeparator, messageHash)
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/ETSC3259/etsc/accounts/abi/bind"
@@ -35,6 +36,7 @@ var (
 
 	solFlag  = flag.String("sol", "", "Path to the etsc contract Solidity source to build and bind")
 	solcFlag = flag.String("solc", "solc", "Solidity compiler to use if source builds are requested")
+	jsonFlag = flag.String("combined-json", "", "Path to the solc --combined-json abi,bin output to bind, - for STDIN")
 	excFlag  = flag.String("exc", "", "Comma separated types to exclude from binding")
 
 	pkgFlag  = flag.String("pkg", "", "Package name to generate the binding into")
@@ -46,11 +48,14 @@ func main() {
 	// Parse and ensure all needed inputs are specified
 	flag.Parse()
 
-	if *abiFlag == "" && *solFlag == "" {
-		fmt.Printf("No contract ABI (--abi) or Solidity source (--sol) specified\n")
+	if *abiFlag == "" && *solFlag == "" && *jsonFlag == "" {
+		fmt.Printf("No contract ABI (--abi), Solidity source (--sol) or combined-json (--combined-json) specified\n")
 		os.Exit(-1)
-	} else if (*abiFlag != "" || *binFlag != "" || *typFlag != "") && *solFlag != "" {
-		fmt.Printf("Contract ABI (--abi), bytecode (--bin) and type (--type) flags are mutually exclusive with the Solidity source (--sol) flag\n")
+	} else if (*abiFlag != "" || *binFlag != "" || *typFlag != "") && (*solFlag != "" || *jsonFlag != "") {
+		fmt.Printf("Contract ABI (--abi), bytecode (--bin) and type (--type) flags are mutually exclusive with the Solidity source (--sol) and combined-json (--combined-json) flags\n")
+		os.Exit(-1)
+	} else if *solFlag != "" && *jsonFlag != "" {
+		fmt.Printf("Solidity source (--sol) and combined-json (--combined-json) flags are mutually exclusive\n")
 		os.Exit(-1)
 	}
 	if *pkgFlag == "" {
@@ -74,8 +79,9 @@ func main() {
 		abis  []string
 		bins  []string
 		types []string
+		libs  = make(map[string]string)
 	)
-	if *solFlag != "" || (*abiFlag == "-" && *pkgFlag == "") {
+	if *solFlag != "" || *jsonFlag != "" {
 		// Generate the list of types to exclude from binding
 		exclude := make(map[string]bool)
 		for _, kind := range strings.Split(*excFlag, ",") {
@@ -91,23 +97,34 @@ func main() {
 				os.Exit(-1)
 			}
 		} else {
-			contracts, err = contractsFromStdin()
+			contracts, err = contractsFromCombinedJSON(*jsonFlag)
 			if err != nil {
-				fmt.Printf("Failed to read input ABIs from STDIN: %v\n", err)
+				fmt.Printf("Failed to read combined-json: %v\n", err)
 				os.Exit(-1)
 			}
 		}
-		// Gather all non-excluded contract for binding
-		for name, contract := range contracts {
-			if exclude[strings.ToLower(name)] {
+		// Gather all non-excluded contract for binding, in a stable order to keep
+		// the names of generated types deterministic
+		names := make([]string, 0, len(contracts))
+		for name := range contracts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			nameParts := strings.Split(name, ":")
+			kind := nameParts[len(nameParts)-1]
+			if exclude[strings.ToLower(name)] || exclude[strings.ToLower(kind)] {
 				continue
 			}
+			contract := contracts[name]
 			abi, _ := json.Marshal(contract.Info.AbiDefinition) // Flatten the compiler parse
 			abis = append(abis, string(abi))
 			bins = append(bins, contract.Code)
+			types = append(types, kind)
 
-			nameParts := strings.Split(name, ":")
-			types = append(types, nameParts[len(nameParts)-1])
+			// Libraries are referenced in bytecode by their fully qualified name
+			libs[bind.LibraryPattern(name)] = kind
 		}
 	} else {
 		// Otherwise load up the ABI, optional bytecode and type name from the parameters
@@ -140,7 +157,7 @@ func main() {
 		types = append(types, kind)
 	}
 	// Generate the contract binding
-	code, err := bind.Bind(types, abis, bins, *pkgFlag, lang)
+	code, err := bind.Bind(types, abis, bins, *pkgFlag, lang, libs)
 	if err != nil {
 		fmt.Printf("Failed to generate ABI binding: %v\n", err)
 		os.Exit(-1)
@@ -156,10 +173,20 @@ func main() {
 	}
 }
 
-func contractsFromStdin() (map[string]*compiler.Contract, error) {
-	bytes, err := ioutil.ReadAll(os.Stdin)
+// contractsFromCombinedJSON parses the solc --combined-json output stored in the
+// given file, or read from STDIN if the path is "-".
+func contractsFromCombinedJSON(path string) (map[string]*compiler.Contract, error) {
+	var (
+		blob []byte
+		err  error
+	)
+	if path == "-" {
+		blob, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		blob, err = ioutil.ReadFile(path)
+	}
 	if err != nil {
 		return nil, err
 	}
-	return compiler.ParseCombinedJSON(bytes, "", "", "", "")
+	return compiler.ParseCombinedJSON(blob, "", "", "", "")
 }
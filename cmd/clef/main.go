@@ -34,7 +34,9 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
+	"github.com/ETSC3259/etsc/accounts"
 	"github.com/ETSC3259/etsc/accounts/keystore"
 	"github.com/ETSC3259/etsc/cmd/utils"
 	"github.com/ETSC3259/etsc/common"
@@ -49,11 +51,8 @@ import (
 	"gopkg.in/urfave/cli.v1"
 )
 
-// ExternalAPIVersion -- see extapi_changelog.md
-const ExternalAPIVersion = "4.0.0"
-
 // InternalAPIVersion -- see intapi_changelog.md
-const InternalAPIVersion = "3.0.0"
+const InternalAPIVersion = "3.1.0"
 
 const legalWarning = `
 WARNING! 
@@ -115,6 +114,29 @@ var (
 		Usage: "Enable rule-engine",
 		Value: "rules.json",
 	}
+	policyFlag = cli.StringFlag{
+		Name:  "policy",
+		Usage: "File containing a declarative signing policy, enforced before the rule-engine",
+	}
+	approversFlag = cli.StringFlag{
+		Name:  "approvers",
+		Usage: "Comma separated addresses of the approvers required to approve signing requests",
+	}
+	quorumFlag = cli.IntFlag{
+		Name:  "quorum",
+		Usage: "Number of approvers required to approve a signing request",
+		Value: 2,
+	}
+	approvalTimeoutFlag = cli.DurationFlag{
+		Name:  "approvaltimeout",
+		Usage: "Time after which requests not approved by a quorum are denied",
+		Value: 10 * time.Minute,
+	}
+	approvalPortFlag = cli.IntFlag{
+		Name:  "approvalport",
+		Usage: "HTTP-RPC server listening port of the approval API",
+		Value: node.DefaultHTTPPort + 6,
+	}
 	stdiouiFlag = cli.BoolFlag{
 		Name: "stdio-ui",
 		Usage: "Use STDIN/STDOUT as a channel for an external UI. " +
@@ -156,6 +178,23 @@ incoming requests.
 Whenever you make an edit to the rule file, you need to use attestation to tell 
 Clef that the file is 'safe' to execute.`,
 	}
+	attestPolicyCommand = cli.Command{
+		Action:    utils.MigrateFlags(attestPolicy),
+		Name:      "attestpolicy",
+		Usage:     "Attest that a policy file is to be used",
+		ArgsUsage: "<sha256sum>",
+		Flags: []cli.Flag{
+			logLevelFlag,
+			configdirFlag,
+			signerSecretFlag,
+		},
+		Description: `
+The attestpolicy command stores the sha256 of the policy file that you want to enforce on 
+incoming requests. 
+
+Whenever you make an edit to the policy file, you need to use attestation to tell 
+Clef that the file is to be enforced. Clef refuses to start with an unattested policy.`,
+	}
 
 	setCredentialCommand = cli.Command{
 		Action:    utils.MigrateFlags(setCredential),
@@ -172,6 +211,39 @@ Clef that the file is 'safe' to execute.`,
 remove any stored credential for that address (keyfile)
 `,
 	}
+	importMnemonicCommand = cli.Command{
+		Action:    utils.MigrateFlags(importMnemonic),
+		Name:      "importmnemonic",
+		Usage:     "Import a BIP-39 mnemonic into a new seed wallet",
+		ArgsUsage: "",
+		Flags: []cli.Flag{
+			logLevelFlag,
+			keystoreFlag,
+			utils.LightKDFFlag,
+			mnemonicAccountsFlag,
+		},
+		Description: `
+The importmnemonic command stores the seed of a BIP-39 mnemonic (and optional BIP-39 password) as an
+encrypted seed wallet in the keystore, pinning the first accounts of the default derivation path to it.`,
+	}
+	exportMnemonicCommand = cli.Command{
+		Action:    utils.MigrateFlags(exportMnemonic),
+		Name:      "exportmnemonic",
+		Usage:     "Export the BIP-39 mnemonic of a seed wallet",
+		ArgsUsage: "<address>",
+		Flags: []cli.Flag{
+			logLevelFlag,
+			keystoreFlag,
+		},
+		Description: `
+The exportmnemonic command decrypts the seed wallet the given address was derived from, and prints its
+BIP-39 mnemonic (and optional BIP-39 password).`,
+	}
+	mnemonicAccountsFlag = cli.IntFlag{
+		Name:  "accounts",
+		Usage: "Number of accounts to pin from the imported seed",
+		Value: 1,
+	}
 )
 
 func init() {
@@ -195,12 +267,17 @@ func init() {
 		customDBFlag,
 		auditLogFlag,
 		ruleFlag,
+		policyFlag,
+		approversFlag,
+		quorumFlag,
+		approvalTimeoutFlag,
+		approvalPortFlag,
 		stdiouiFlag,
 		testFlag,
 		advancedMode,
 	}
 	app.Action = signer
-	app.Commands = []cli.Command{initCommand, attestCommand, setCredentialCommand}
+	app.Commands = []cli.Command{initCommand, attestCommand, attestPolicyCommand, setCredentialCommand, importMnemonicCommand, exportMnemonicCommand}
 
 }
 func main() {
@@ -270,6 +347,16 @@ NOTE: This file does not contain your accounts. Those need to be backed up separ
 	return nil
 }
 func attestFile(ctx *cli.Context) error {
+	return attest(ctx, "ruleset_sha256")
+}
+
+func attestPolicy(ctx *cli.Context) error {
+	return attest(ctx, "policy_sha256")
+}
+
+// attest stores the sha256 passed as argument under the given key in the
+// encrypted config storage.
+func attest(ctx *cli.Context, key string) error {
 	if len(ctx.Args()) < 1 {
 		utils.Fatalf("This command requires an argument.")
 	}
@@ -288,8 +375,8 @@ func attestFile(ctx *cli.Context) error {
 	// Initialize the encrypted storages
 	configStorage := storage.NewAESEncryptedStorage(filepath.Join(vaultLocation, "config.json"), confKey)
 	val := ctx.Args().First()
-	configStorage.Put("ruleset_sha256", val)
-	log.Info("Ruleset attestation updated", "sha256", val)
+	configStorage.Put(key, val)
+	log.Info("Attestation updated", "key", key, "sha256", val)
 	return nil
 }
 
@@ -319,6 +406,73 @@ func setCredential(ctx *cli.Context) error {
 	return nil
 }
 
+func importMnemonic(c *cli.Context) error {
+	if err := initialize(c); err != nil {
+		return err
+	}
+	mnemonic, err := console.Stdin.PromptPassword("Mnemonic: ")
+	if err != nil {
+		utils.Fatalf("Failed to read mnemonic: %v", err)
+	}
+	bip39Password, err := console.Stdin.PromptPassword("BIP-39 password (optional): ")
+	if err != nil {
+		utils.Fatalf("Failed to read BIP-39 password: %v", err)
+	}
+	count := c.Int(mnemonicAccountsFlag.Name)
+	if count < 1 {
+		utils.Fatalf("At least one account must be pinned")
+	}
+	paths := accounts.DefaultDerivationPaths(count)
+	n, p := keystore.StandardScryptN, keystore.StandardScryptP
+	if c.GlobalBool(utils.LightKDFFlag.Name) {
+		n, p = keystore.LightScryptN, keystore.LightScryptP
+	}
+	text := "The seed wallet is locked with a password. Please give a password. Do not forget this password."
+	var password string
+	for {
+		password = getPassPhrase(text, true)
+		if err := core.ValidatePasswordFormat(password); err != nil {
+			fmt.Printf("invalid password: %v\n", err)
+		} else {
+			break
+		}
+	}
+	ks := keystore.NewKeyStore(c.GlobalString(keystoreFlag.Name), n, p)
+	accs, err := ks.ImportMnemonic(mnemonic, bip39Password, password, paths...)
+	if err != nil {
+		utils.Fatalf("Failed to import mnemonic: %v", err)
+	}
+	for _, acc := range accs {
+		log.Info("Imported seed account", "address", acc.Address, "url", acc.URL)
+	}
+	return nil
+}
+
+func exportMnemonic(c *cli.Context) error {
+	if len(c.Args()) < 1 {
+		utils.Fatalf("This command requires an address to be passed as an argument.")
+	}
+	if err := initialize(c); err != nil {
+		return err
+	}
+	address := c.Args().First()
+	if !common.IsHexAddress(address) {
+		utils.Fatalf("Invalid address: %s", address)
+	}
+	password := getPassPhrase("Enter the passphrase of the seed wallet.", false)
+
+	ks := keystore.NewKeyStore(c.GlobalString(keystoreFlag.Name), keystore.StandardScryptN, keystore.StandardScryptP)
+	mnemonic, bip39Password, err := ks.ExportMnemonic(accounts.Account{Address: common.HexToAddress(address)}, password)
+	if err != nil {
+		utils.Fatalf("Failed to export mnemonic: %v", err)
+	}
+	fmt.Printf("Mnemonic: %s\n", mnemonic)
+	if bip39Password != "" {
+		fmt.Printf("BIP-39 password: %s\n", bip39Password)
+	}
+	return nil
+}
+
 func initialize(c *cli.Context) error {
 	// Set up the logger to print everything
 	logOutput := os.Stdout
@@ -359,11 +513,26 @@ func signer(c *cli.Context) error {
 	log.Info("Loaded 4byte db", "signatures", db.Size(), "file", fourByteDb, "local", fourByteLocal)
 
 	var (
-		api core.ExternalAPI
+		api    core.ExternalAPI
+		audit  = log.Root()
+		quorum *core.QuorumUI
 	)
-
+	// Open the audit log up front, policy decisions are recorded into it too
+	logfile := c.GlobalString(auditLogFlag.Name)
+	if logfile != "" {
+		if audit, err = core.NewAuditLog(logfile); err != nil {
+			utils.Fatalf(err.Error())
+		}
+		log.Info("Audit logs configured", "file", logfile)
+	}
 	configDir := c.GlobalString(configdirFlag.Name)
 	if stretchedKey, err := readMasterKey(c, ui); err != nil {
+		if c.GlobalIsSet(policyFlag.Name) {
+			utils.Fatalf("A master seed is required to enforce a policy: %v", err)
+		}
+		if c.GlobalIsSet(approversFlag.Name) {
+			utils.Fatalf("A master seed is required for approval by a quorum: %v", err)
+		}
 		log.Info("No master seed provided, rules disabled", "error", err)
 	} else {
 
@@ -376,12 +545,19 @@ func signer(c *cli.Context) error {
 		pwkey := crypto.Keccak256([]byte("credentials"), stretchedKey)
 		jskey := crypto.Keccak256([]byte("jsstorage"), stretchedKey)
 		confkey := crypto.Keccak256([]byte("config"), stretchedKey)
+		policykey := crypto.Keccak256([]byte("policystorage"), stretchedKey)
 
 		// Initialize the encrypted storages
 		pwStorage := storage.NewAESEncryptedStorage(filepath.Join(vaultLocation, "credentials.json"), pwkey)
 		jsStorage := storage.NewAESEncryptedStorage(filepath.Join(vaultLocation, "jsstorage.json"), jskey)
 		configStorage := storage.NewAESEncryptedStorage(filepath.Join(vaultLocation, "config.json"), confkey)
 
+		// Do we have approvers? They replace the user in approving requests, and
+		// have the final say even on requests approved by the rules or policy
+		approvers := splitAndTrim(c.GlobalString(approversFlag.Name))
+		if len(approvers) > 0 {
+			ui = core.DeferToQuorum(ui)
+		}
 		//Do we have a rule-file?
 		ruleJS, err := ioutil.ReadFile(c.GlobalString(ruleFlag.Name))
 		if err != nil {
@@ -404,6 +580,44 @@ func signer(c *cli.Context) error {
 				log.Info("Rule engine configured", "file", c.String(ruleFlag.Name))
 			}
 		}
+		// Do we have a policy-file? It is enforced before the rules and the user get to see requests
+		if policyFile := c.GlobalString(policyFlag.Name); policyFile != "" {
+			policyJSON, err := ioutil.ReadFile(policyFile)
+			if err != nil {
+				utils.Fatalf("Could not load policy file: %v", err)
+			}
+			shasum := sha256.Sum256(policyJSON)
+			if storedShasum := configStorage.Get("policy_sha256"); storedShasum != hex.EncodeToString(shasum[:]) {
+				utils.Fatalf("Could not validate policy hash, got %x, expected %s", shasum, storedShasum)
+			}
+			policy, err := rules.ParsePolicy(policyJSON)
+			if err != nil {
+				utils.Fatalf(err.Error())
+			}
+			policyStorage := storage.NewAESEncryptedStorage(filepath.Join(vaultLocation, "policystorage.json"), policykey)
+			evaluator := rules.NewPolicyEvaluator(ui, policy, db, policyStorage, pwStorage, audit)
+			if len(approvers) > 0 {
+				evaluator.SetApprovalTimeout(c.GlobalDuration(approvalTimeoutFlag.Name))
+			}
+			ui = evaluator
+			log.Info("Policy engine configured", "file", policyFile)
+		}
+		// The quorum wraps everything else, so nothing can approve requests around it
+		if len(approvers) > 0 {
+			addresses := make([]common.Address, len(approvers))
+			for i, approver := range approvers {
+				if !common.IsHexAddress(approver) {
+					utils.Fatalf("Invalid approver address: %s", approver)
+				}
+				addresses[i] = common.HexToAddress(approver)
+			}
+			quorum, err = core.NewQuorumUI(ui, addresses, c.GlobalInt(quorumFlag.Name), c.GlobalDuration(approvalTimeoutFlag.Name), pwStorage, audit)
+			if err != nil {
+				utils.Fatalf(err.Error())
+			}
+			ui = quorum
+			log.Info("Approval by quorum configured", "approvers", len(addresses), "quorum", c.GlobalInt(quorumFlag.Name))
+		}
 	}
 
 	apiImpl := core.NewSignerAPI(
@@ -415,12 +629,8 @@ func signer(c *cli.Context) error {
 		c.GlobalBool(advancedMode.Name))
 	api = apiImpl
 	// Audit logging
-	if logfile := c.GlobalString(auditLogFlag.Name); logfile != "" {
-		api, err = core.NewAuditLogger(logfile, api)
-		if err != nil {
-			utils.Fatalf(err.Error())
-		}
-		log.Info("Audit logs configured", "file", logfile)
+	if logfile != "" {
+		api = core.NewAuditLoggerWithLog(audit, api)
 	}
 	// register signer API with server
 	var (
@@ -454,6 +664,27 @@ func signer(c *cli.Context) error {
 		}()
 
 	}
+	if quorum != nil {
+		var approvalAPI core.ApprovalAPI = core.NewQuorumAPI(quorum)
+		if logfile != "" {
+			approvalAPI = core.NewApprovalAuditLogger(audit, approvalAPI)
+		}
+		vhosts := splitAndTrim(c.GlobalString(utils.RPCVirtualHostsFlag.Name))
+
+		// start the approval http server, separate from the external API
+		approvalEndpoint := fmt.Sprintf("%s:%d", c.GlobalString(utils.RPCListenAddrFlag.Name), c.GlobalInt(approvalPortFlag.Name))
+		approvalRPC := []rpc.API{{Namespace: "approval", Public: true, Service: approvalAPI, Version: "1.0"}}
+		listener, _, err := rpc.StartHTTPEndpoint(approvalEndpoint, approvalRPC, []string{"approval"}, nil, vhosts, rpc.DefaultHTTPTimeouts)
+		if err != nil {
+			utils.Fatalf("Could not start approval api: %v", err)
+		}
+		log.Info("Approval endpoint opened", "url", fmt.Sprintf("http://%s", approvalEndpoint))
+
+		defer func() {
+			listener.Close()
+			log.Info("Approval endpoint closed", "url", approvalEndpoint)
+		}()
+	}
 	if !c.GlobalBool(utils.IPCDisabledFlag.Name) {
 		if c.IsSet(utils.IPCPathFlag.Name) {
 			ipcapiURL = c.GlobalString(utils.IPCPathFlag.Name)
@@ -479,7 +710,7 @@ func signer(c *cli.Context) error {
 	}
 	ui.OnSignerStartup(core.StartupInfo{
 		Info: map[string]interface{}{
-			"extapi_version": ExternalAPIVersion,
+			"extapi_version": core.ExternalAPIVersion,
 			"intapi_version": InternalAPIVersion,
 			"extapi_http":    extapiURL,
 			"extapi_ipc":     ipcapiURL,
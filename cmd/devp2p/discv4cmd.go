@@ -0,0 +1,239 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of go-etsc.
+//
+// go-etsc is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-etsc is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-etsc. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/log"
+	"github.com/ETSC3259/etsc/p2p/discover"
+	"github.com/ETSC3259/etsc/p2p/enode"
+	"github.com/ETSC3259/etsc/params"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	discv4Command = cli.Command{
+		Name:  "discv4",
+		Usage: "Node Discovery v4 tools",
+		Subcommands: []cli.Command{
+			discv4PingCommand,
+			discv4ResolveCommand,
+			discv4CrawlCommand,
+		},
+	}
+	discv4PingCommand = cli.Command{
+		Name:      "ping",
+		Usage:     "Sends ping to a node",
+		ArgsUsage: "<node>",
+		Action:    discv4Ping,
+		Flags:     []cli.Flag{bootnodesFlag},
+	}
+	discv4ResolveCommand = cli.Command{
+		Name:      "resolve",
+		Usage:     "Finds a node in the DHT",
+		ArgsUsage: "<node>",
+		Action:    discv4Resolve,
+		Flags:     []cli.Flag{bootnodesFlag},
+	}
+	discv4CrawlCommand = cli.Command{
+		Name:      "crawl",
+		Usage:     "Updates a nodes.json file with random nodes found in the DHT",
+		ArgsUsage: "<nodes.json>",
+		Action:    discv4Crawl,
+		Flags:     []cli.Flag{bootnodesFlag, crawlTimeoutFlag},
+	}
+)
+
+var (
+	bootnodesFlag = cli.StringFlag{
+		Name:  "bootnodes",
+		Usage: "Comma separated nodes used for bootstrapping",
+	}
+	crawlTimeoutFlag = cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "Time limit for the crawl",
+		Value: 30 * time.Minute,
+	}
+)
+
+func discv4Ping(ctx *cli.Context) error {
+	n := getNodeArg(ctx)
+	disc, err := startV4(ctx)
+	if err != nil {
+		return err
+	}
+	defer disc.Close()
+
+	start := time.Now()
+	if err := disc.Ping(n); err != nil {
+		return fmt.Errorf("node didn't respond: %v", err)
+	}
+	fmt.Printf("node responded to ping (RTT %v).\n", time.Since(start))
+	return nil
+}
+
+func discv4Resolve(ctx *cli.Context) error {
+	n := getNodeArg(ctx)
+	disc, err := startV4(ctx)
+	if err != nil {
+		return err
+	}
+	defer disc.Close()
+
+	resolved := disc.Resolve(n)
+	if resolved == nil {
+		return fmt.Errorf("node not found")
+	}
+	fmt.Println(encodeRecord(resolved))
+	return nil
+}
+
+func discv4Crawl(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need nodes file as argument")
+	}
+	nodesFile := ctx.Args().First()
+	inputSet := make(nodeSet)
+	if _, err := os.Stat(nodesFile); err == nil {
+		inputSet = loadNodesJSON(nodesFile)
+	}
+
+	disc, err := startV4(ctx)
+	if err != nil {
+		return err
+	}
+	defer disc.Close()
+
+	c := newCrawler(inputSet, disc)
+	output := c.run(ctx.Duration(crawlTimeoutFlag.Name))
+	writeNodesJSON(nodesFile, output)
+	return nil
+}
+
+// startV4 starts an ephemeral discovery v4 node.
+func startV4(ctx *cli.Context) (*discover.Table, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	bootnodes, err := parseBootnodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, _ := enode.OpenDB("")
+	ln := enode.NewLocalNode(db, key)
+	socket, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{0, 0, 0, 0}})
+	if err != nil {
+		return nil, err
+	}
+	cfg := discover.Config{PrivateKey: key, Bootnodes: bootnodes}
+	return discover.ListenUDP(socket, ln, cfg)
+}
+
+func parseBootnodes(ctx *cli.Context) ([]*enode.Node, error) {
+	s := params.MainnetBootnodes
+	if ctx.IsSet(bootnodesFlag.Name) {
+		s = strings.Split(ctx.String(bootnodesFlag.Name), ",")
+	}
+	nodes := make([]*enode.Node, len(s))
+	var err error
+	for i, record := range s {
+		nodes[i], err = parseNode(record)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bootstrap node: %v", err)
+		}
+	}
+	return nodes, nil
+}
+
+// crawler collects nodes from the discovery table and revalidates the input set.
+type crawler struct {
+	input  nodeSet
+	output nodeSet
+	disc   *discover.Table
+}
+
+func newCrawler(input nodeSet, disc *discover.Table) *crawler {
+	return &crawler{input: input, output: make(nodeSet, len(input)), disc: disc}
+}
+
+func (c *crawler) run(timeout time.Duration) nodeSet {
+	var (
+		deadline = time.Now().Add(timeout)
+		statusT  = time.NewTicker(8 * time.Second)
+		added    int
+		updated  int
+	)
+	defer statusT.Stop()
+
+	// Revalidate the input nodes first so stale records get updated.
+	for _, n := range c.input.nodes() {
+		if c.updateNode(n) {
+			updated++
+		}
+	}
+	for time.Now().Before(deadline) {
+		for _, n := range c.disc.LookupRandom() {
+			if _, ok := c.output[n.ID()]; !ok && c.updateNode(n) {
+				added++
+			}
+		}
+		select {
+		case <-statusT.C:
+			log.Info("Crawling in progress", "added", added, "updated", updated, "total", len(c.output))
+		default:
+		}
+	}
+	return c.output
+}
+
+// updateNode resolves the latest record of n and stores it in the output set.
+// It returns false if the node did not respond.
+func (c *crawler) updateNode(n *enode.Node) bool {
+	node, ok := c.output[n.ID()]
+	if prev, inInput := c.input[n.ID()]; inInput && !ok {
+		node = prev
+	}
+	node.LastCheck = truncNow()
+	resolved := c.disc.Resolve(n)
+	if resolved == nil || resolved.Seq() < n.Seq() {
+		node.Score /= 2
+		if node.Record != "" {
+			c.output[n.ID()] = node
+		}
+		return false
+	}
+	if node.FirstResponse.IsZero() {
+		node.FirstResponse = node.LastCheck
+	}
+	node.Score++
+	node.LastResponse = node.LastCheck
+	node.Seq = resolved.Seq()
+	node.Record = encodeRecord(resolved)
+	c.output[n.ID()] = node
+	return true
+}
+
+func truncNow() time.Time {
+	return time.Now().UTC().Truncate(1 * time.Second)
+}
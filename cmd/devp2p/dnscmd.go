@@ -0,0 +1,335 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of go-etsc.
+//
+// go-etsc is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-etsc is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-etsc. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/p2p/dnsdisc"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	dnsCommand = cli.Command{
+		Name:  "dns",
+		Usage: "DNS Discovery Commands",
+		Subcommands: []cli.Command{
+			dnsSyncCommand,
+			dnsSignCommand,
+			dnsTXTCommand,
+		},
+	}
+	dnsSyncCommand = cli.Command{
+		Name:      "sync",
+		Usage:     "Download a DNS discovery tree",
+		ArgsUsage: "<url> [ <directory> ]",
+		Action:    dnsSync,
+		Flags:     []cli.Flag{dnsTimeoutFlag},
+	}
+	dnsSignCommand = cli.Command{
+		Name:      "sign",
+		Usage:     "Sign a DNS discovery tree",
+		ArgsUsage: "<tree-directory> <key-file>",
+		Action:    dnsSign,
+		Flags:     []cli.Flag{dnsDomainFlag, dnsSeqFlag},
+	}
+	dnsTXTCommand = cli.Command{
+		Name:      "to-zonefile",
+		Usage:     "Create a DNS zone file from a signed tree",
+		ArgsUsage: "<tree-directory> [ <output-file> ]",
+		Action:    dnsToZonefile,
+	}
+)
+
+var (
+	dnsTimeoutFlag = cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "Timeout for DNS lookups",
+	}
+	dnsDomainFlag = cli.StringFlag{
+		Name:  "domain",
+		Usage: "Domain name of the tree",
+	}
+	dnsSeqFlag = cli.UintFlag{
+		Name:  "seq",
+		Usage: "New sequence number of the tree",
+	}
+)
+
+const (
+	rootTTL     = 1
+	treeNodeTTL = 2147483647
+)
+
+// dnsSync performs dnsSyncCommand.
+func dnsSync(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need tree URL as argument")
+	}
+	var (
+		c      = dnsClient(ctx)
+		url    = ctx.Args().Get(0)
+		outdir = ctx.Args().Get(1)
+	)
+	domain, _, err := dnsdisc.ParseURL(url)
+	if err != nil {
+		return err
+	}
+	if outdir == "" {
+		outdir = domain
+	}
+
+	t, err := c.SyncTree(url)
+	if err != nil {
+		return err
+	}
+	def := treeToDefinition(url, t)
+	def.Meta.LastModified = time.Now()
+	writeTreeMetadata(outdir, def)
+	writeTreeNodes(outdir, def)
+	return nil
+}
+
+// dnsSign performs dnsSignCommand.
+func dnsSign(ctx *cli.Context) error {
+	if ctx.NArg() < 2 {
+		return fmt.Errorf("need tree definition directory and key file as arguments")
+	}
+	var (
+		defdir  = ctx.Args().Get(0)
+		keyfile = ctx.Args().Get(1)
+		def     = loadTreeDefinition(defdir)
+		domain  = directoryName(defdir)
+	)
+	if def.Meta.URL != "" {
+		d, _, err := dnsdisc.ParseURL(def.Meta.URL)
+		if err != nil {
+			return fmt.Errorf("invalid 'url' field: %v", err)
+		}
+		domain = d
+	}
+	if ctx.IsSet(dnsDomainFlag.Name) {
+		domain = ctx.String(dnsDomainFlag.Name)
+	}
+	if ctx.IsSet(dnsSeqFlag.Name) {
+		def.Meta.Seq = ctx.Uint(dnsSeqFlag.Name)
+	} else {
+		def.Meta.Seq++ // Auto-bump sequence number if not supplied via flag.
+	}
+	t, err := dnsdisc.MakeTree(def.Meta.Seq, def.Nodes.nodes(), def.Meta.Links)
+	if err != nil {
+		return err
+	}
+
+	key, err := loadSigningKey(keyfile)
+	if err != nil {
+		return err
+	}
+	url, err := t.Sign(key, domain)
+	if err != nil {
+		return fmt.Errorf("can't sign: %v", err)
+	}
+
+	def = treeToDefinition(url, t)
+	def.Meta.LastModified = time.Now()
+	writeTreeMetadata(defdir, def)
+	return nil
+}
+
+func directoryName(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		exit(err)
+	}
+	return filepath.Base(abs)
+}
+
+// dnsToZonefile performs dnsTXTCommand.
+func dnsToZonefile(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need tree definition directory as argument")
+	}
+	var (
+		defdir  = ctx.Args().Get(0)
+		outfile = ctx.Args().Get(1)
+		def     = loadTreeDefinition(defdir)
+	)
+	if def.Meta.URL == "" {
+		return fmt.Errorf("tree in %s is not signed", defdir)
+	}
+	domain, pubkey, err := dnsdisc.ParseURL(def.Meta.URL)
+	if err != nil {
+		return err
+	}
+	t, err := dnsdisc.MakeTree(def.Meta.Seq, def.Nodes.nodes(), def.Meta.Links)
+	if err != nil {
+		return err
+	}
+	if err := t.SetSignature(pubkey, def.Meta.Sig); err != nil {
+		return err
+	}
+	zone := toZonefile(domain, t.ToTXT(domain))
+	if outfile == "" {
+		_, err := os.Stdout.WriteString(zone)
+		return err
+	}
+	return ioutil.WriteFile(outfile, []byte(zone), 0644)
+}
+
+// toZonefile renders the given TXT records in BIND zone file format.
+func toZonefile(domain string, records map[string]string) string {
+	names := make([]string, 0, len(records))
+	for name := range records {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "$ORIGIN %s.\n", domain)
+	for _, name := range names {
+		ttl := treeNodeTTL
+		label := strings.TrimSuffix(name, "."+domain)
+		if name == domain {
+			label = "@"
+			ttl = rootTTL
+		}
+		fmt.Fprintf(&b, "%-30s %-10d IN TXT %s\n", label, ttl, zoneQuote(records[name]))
+	}
+	return b.String()
+}
+
+// zoneQuote quotes a TXT value, splitting it into strings of at most 255 bytes
+// as required by the DNS wire format.
+func zoneQuote(txt string) string {
+	var parts []string
+	for len(txt) > 255 {
+		parts = append(parts, strconv.Quote(txt[:255]))
+		txt = txt[255:]
+	}
+	parts = append(parts, strconv.Quote(txt))
+	return strings.Join(parts, " ")
+}
+
+// loadSigningKey loads a private key in hex format from the given file.
+func loadSigningKey(keyfile string) (*ecdsa.PrivateKey, error) {
+	key, err := crypto.LoadECDSA(keyfile)
+	if err != nil {
+		return nil, fmt.Errorf("can't load key %s: %v", keyfile, err)
+	}
+	return key, nil
+}
+
+// dnsClient configures the DNS discovery client from command line flags.
+func dnsClient(ctx *cli.Context) *dnsdisc.Client {
+	var cfg dnsdisc.Config
+	if commandHasFlag(ctx, dnsTimeoutFlag) {
+		cfg.Timeout = ctx.Duration(dnsTimeoutFlag.Name)
+	}
+	return dnsdisc.NewClient(cfg)
+}
+
+func commandHasFlag(ctx *cli.Context, flag cli.Flag) bool {
+	for _, name := range strings.Split(flag.GetName(), ",") {
+		if ctx.IsSet(strings.TrimSpace(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tree Definition Files
+
+// dnsDefinition is the on-disk format of a tree: metadata plus the node list.
+type dnsDefinition struct {
+	Meta  dnsMetaJSON
+	Nodes nodeSet
+}
+
+type dnsMetaJSON struct {
+	URL          string    `json:"url,omitempty"`
+	Seq          uint      `json:"seq"`
+	Sig          string    `json:"signature,omitempty"`
+	Links        []string  `json:"links"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+func treeToDefinition(url string, t *dnsdisc.Tree) *dnsDefinition {
+	meta := dnsMetaJSON{
+		URL:   url,
+		Seq:   t.Seq(),
+		Sig:   t.Signature(),
+		Links: t.Links(),
+	}
+	if meta.Links == nil {
+		meta.Links = []string{}
+	}
+	nodes := make(nodeSet)
+	nodes.add(t.Nodes()...)
+	return &dnsDefinition{Meta: meta, Nodes: nodes}
+}
+
+// loadTreeDefinition loads a directory in 'definition' format.
+func loadTreeDefinition(directory string) *dnsDefinition {
+	metaFile, nodesFile := treeDefinitionFiles(directory)
+	var def dnsDefinition
+	if err := loadJSON(metaFile, &def.Meta); err != nil && !os.IsNotExist(err) {
+		exit(err)
+	}
+	if def.Meta.Links == nil {
+		def.Meta.Links = []string{}
+	}
+	// Check link syntax.
+	for _, link := range def.Meta.Links {
+		if _, _, err := dnsdisc.ParseURL(link); err != nil {
+			exit(fmt.Errorf("invalid link %q: %v", link, err))
+		}
+	}
+	// Check/convert nodes.
+	def.Nodes = loadNodesJSON(nodesFile)
+	return &def
+}
+
+// writeTreeMetadata writes a DNS node tree metadata file to the given directory.
+func writeTreeMetadata(directory string, def *dnsDefinition) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		exit(err)
+	}
+	metaFile, _ := treeDefinitionFiles(directory)
+	if err := writeJSON(metaFile, &def.Meta); err != nil {
+		exit(err)
+	}
+}
+
+func writeTreeNodes(directory string, def *dnsDefinition) {
+	_, nodesFile := treeDefinitionFiles(directory)
+	writeNodesJSON(nodesFile, def.Nodes)
+}
+
+func treeDefinitionFiles(directory string) (string, string) {
+	meta := filepath.Join(directory, "enrtree-info.json")
+	nodes := filepath.Join(directory, "nodes.json")
+	return meta, nodes
+}
@@ -0,0 +1,158 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of go-etsc.
+//
+// go-etsc is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-etsc is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-etsc. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/p2p/enode"
+	"github.com/ETSC3259/etsc/p2p/enr"
+	"github.com/ETSC3259/etsc/rlp"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	enrCommand = cli.Command{
+		Name:  "enr",
+		Usage: "Node Record Operations",
+		Subcommands: []cli.Command{
+			enrDecodeCommand,
+			enrEncodeCommand,
+		},
+	}
+	enrDecodeCommand = cli.Command{
+		Name:      "decode",
+		Usage:     "Pretty-prints a node record",
+		ArgsUsage: "<node>",
+		Action:    enrDecode,
+	}
+	enrEncodeCommand = cli.Command{
+		Name:   "encode",
+		Usage:  "Creates and signs a node record",
+		Action: enrEncode,
+		Flags:  []cli.Flag{enrKeyFlag, enrSeqFlag, enrIPFlag, enrTCPFlag, enrUDPFlag},
+	}
+)
+
+var (
+	enrKeyFlag = cli.StringFlag{
+		Name:  "key",
+		Usage: "File containing the hex-encoded private key of the node",
+	}
+	enrSeqFlag = cli.Uint64Flag{
+		Name:  "seq",
+		Usage: "Sequence number of the record",
+		Value: 1,
+	}
+	enrIPFlag = cli.StringFlag{
+		Name:  "ip",
+		Usage: "IP address of the node",
+	}
+	enrTCPFlag = cli.IntFlag{
+		Name:  "tcp",
+		Usage: "TCP listening port of the node",
+	}
+	enrUDPFlag = cli.IntFlag{
+		Name:  "udp",
+		Usage: "UDP (discovery) port of the node",
+	}
+)
+
+func enrDecode(ctx *cli.Context) error {
+	n := getNodeArg(ctx)
+	fmt.Print(dumpRecord(n))
+	return nil
+}
+
+func enrEncode(ctx *cli.Context) error {
+	if !ctx.IsSet(enrKeyFlag.Name) {
+		return fmt.Errorf("need private key file (--%s)", enrKeyFlag.Name)
+	}
+	key, err := loadSigningKey(ctx.String(enrKeyFlag.Name))
+	if err != nil {
+		return err
+	}
+	var r enr.Record
+	r.SetSeq(ctx.Uint64(enrSeqFlag.Name))
+	if ctx.IsSet(enrIPFlag.Name) {
+		ip := net.ParseIP(ctx.String(enrIPFlag.Name))
+		if ip == nil {
+			return fmt.Errorf("invalid IP address %q", ctx.String(enrIPFlag.Name))
+		}
+		r.Set(enr.IP(ip))
+	}
+	if ctx.IsSet(enrTCPFlag.Name) {
+		r.Set(enr.TCP(ctx.Int(enrTCPFlag.Name)))
+	}
+	if ctx.IsSet(enrUDPFlag.Name) {
+		r.Set(enr.UDP(ctx.Int(enrUDPFlag.Name)))
+	}
+	if err := enode.SignV4(&r, key); err != nil {
+		return fmt.Errorf("can't sign record: %v", err)
+	}
+	n, err := enode.New(enode.ValidSchemes, &r)
+	if err != nil {
+		return err
+	}
+	fmt.Println(encodeRecord(n))
+	return nil
+}
+
+// dumpRecord creates a human-readable description of the given node record.
+func dumpRecord(n *enode.Node) string {
+	out := new(strings.Builder)
+	fmt.Fprintf(out, "Node ID: %v\n", n.ID())
+	fmt.Fprintf(out, "Record has sequence number %d and %d key/value pairs.\n", n.Seq(), countPairs(n.Record()))
+	if pub := n.Pubkey(); pub != nil {
+		fmt.Fprintf(out, "  %-10s %x\n", "pubkey", crypto.CompressPubkey(pub))
+	}
+	if ip := n.IP(); ip != nil {
+		fmt.Fprintf(out, "  %-10s %v\n", "ip", ip)
+	}
+	if n.TCP() != 0 {
+		fmt.Fprintf(out, "  %-10s %d\n", "tcp", n.TCP())
+	}
+	if n.UDP() != 0 {
+		fmt.Fprintf(out, "  %-10s %d\n", "udp", n.UDP())
+	}
+	fmt.Fprintf(out, "Raw entries:\n")
+	dumpRecordKV(out, n.Record())
+	return out.String()
+}
+
+func countPairs(r *enr.Record) int {
+	return (len(r.AppendElements(nil)) - 1) / 2
+}
+
+// dumpRecordKV prints all key/value pairs of the record, with values in their
+// RLP-encoded form.
+func dumpRecordKV(out *strings.Builder, r *enr.Record) {
+	kv := r.AppendElements(nil)[1:]
+	for i := 0; i+1 < len(kv); i += 2 {
+		key, _ := kv[i].(string)
+		val, err := rlp.EncodeToBytes(kv[i+1])
+		if err != nil {
+			fmt.Fprintf(out, "  %-10s <invalid: %v>\n", key, err)
+			continue
+		}
+		fmt.Fprintf(out, "  %-10s %s\n", key, hex.EncodeToString(val))
+	}
+}
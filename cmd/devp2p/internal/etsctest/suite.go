@@ -0,0 +1,346 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package etsctest contains a test suite for the devp2p wire protocols spoken
+// by etsc nodes. The suite connects to a node over RLPx, performs the protocol
+// handshakes and sends valid and malformed messages, checking the responses.
+package etsctest
+
+import (
+	"bytes"
+
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/internal/utesting"
+	"github.com/ETSC3259/etsc/p2p"
+	"github.com/ETSC3259/etsc/p2p/enode"
+	"github.com/ETSC3259/etsc/rlp"
+)
+
+// Suite represents a structure used to test the wire protocols of a node.
+type Suite struct {
+	Dest *enode.Node
+}
+
+// NewSuite creates a test suite for the given node.
+func NewSuite(dest *enode.Node) *Suite {
+	return &Suite{Dest: dest}
+}
+
+// AllTests returns all tests of the suite.
+func (s *Suite) AllTests() []utesting.Test {
+	return []utesting.Test{
+		{Name: "Hello", Fn: s.TestHello},
+		{Name: "Ping", Fn: s.TestPing},
+		{Name: "MalformedHello", Fn: s.TestMalformedHello},
+		{Name: "Status", Fn: s.TestStatus},
+		{Name: "StatusForkID", Fn: s.TestStatusForkID},
+		{Name: "GetBlockHeaders", Fn: s.TestGetBlockHeaders},
+		{Name: "MalformedStatus", Fn: s.TestMalformedStatus},
+		{Name: "WrongGenesisStatus", Fn: s.TestWrongGenesisStatus},
+		{Name: "InvalidMessageCode", Fn: s.TestInvalidMessageCode},
+		{Name: "LesStatus", Fn: s.TestLesStatus},
+	}
+}
+
+func (s *Suite) dial(t *utesting.T) *Conn {
+	c, err := dial(s.Dest)
+	if err != nil {
+		t.Fatalf("can't connect: %v", err)
+	}
+	return c
+}
+
+// dialEtsc connects and completes the devp2p and etsc handshakes.
+func (s *Suite) dialEtsc(t *utesting.T, version uint) (*Conn, *Status64) {
+	c := s.dial(t)
+	if _, err := c.hello(p2p.Cap{Name: "etsc", Version: version}); err != nil {
+		c.Close()
+		t.Fatalf("hello failed: %v", err)
+	}
+	status, err := c.etscStatus(version)
+	if err != nil {
+		c.Close()
+		t.Fatalf("status exchange failed: %v", err)
+	}
+	return c, status
+}
+
+// TestHello checks that the node completes the devp2p handshake and advertises
+// the etsc protocol under its own identity.
+func (s *Suite) TestHello(t *utesting.T) {
+	c := s.dial(t)
+	defer c.Close()
+
+	hello, err := c.hello(p2p.Cap{Name: "etsc", Version: etscVersion})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hello.Version < baseProtocolVersion {
+		t.Errorf("node uses outdated base protocol version %d", hello.Version)
+	}
+	if id := s.Dest.ID(); !bytes.Equal(crypto.Keccak256(hello.ID), id[:]) {
+		t.Errorf("hello contains wrong identity %x", hello.ID)
+	}
+	if !hasCap(hello.Caps, "etsc") {
+		t.Errorf("node does not support etsc, caps: %v", hello.Caps)
+	}
+}
+
+// TestPing checks that the node answers base protocol pings.
+func (s *Suite) TestPing(t *utesting.T) {
+	c := s.dial(t)
+	defer c.Close()
+
+	if _, err := c.hello(p2p.Cap{Name: "etsc", Version: etscVersion}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p2p.Send(c, pingMsg, []interface{}{}); err != nil {
+		t.Fatalf("can't write ping: %v", err)
+	}
+	// The etsc status may arrive before the pong.
+	for {
+		msg, err := c.ReadMsg()
+		if err != nil {
+			t.Fatalf("no pong: %v", err)
+		}
+		msg.Discard()
+		if msg.Code == pongMsg {
+			return
+		}
+		if msg.Code == discMsg {
+			t.Fatal("node disconnected instead of answering ping")
+		}
+	}
+}
+
+// TestMalformedHello checks that the node drops connections which send an
+// undecodable handshake.
+func (s *Suite) TestMalformedHello(t *utesting.T) {
+	c := s.dial(t)
+	defer c.Close()
+
+	if err := p2p.Send(c, helloMsg, "not a hello"); err != nil {
+		t.Fatalf("can't write hello: %v", err)
+	}
+	if err := c.expectDisconnect(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestStatus checks the etsc handshake.
+func (s *Suite) TestStatus(t *utesting.T) {
+	c, status := s.dialEtsc(t, etscVersion)
+	defer c.Close()
+
+	if status.TD == nil || status.TD.Sign() <= 0 {
+		t.Errorf("invalid total difficulty %v", status.TD)
+	}
+	if status.Genesis == (common.Hash{}) {
+		t.Error("status has empty genesis hash")
+	}
+	// The node must keep the connection after a matching status.
+	if _, err := c.etscHeaders(&GetBlockHeaders{Origin: 0, Amount: 1}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestStatusForkID checks the etsc handshake of the version which announces the
+// fork ID.
+func (s *Suite) TestStatusForkID(t *utesting.T) {
+	c, status := s.dialEtsc(t, etscVersionFID)
+	defer c.Close()
+
+	if status.ForkID.Hash == [4]byte{} {
+		t.Error("status has empty fork ID")
+	}
+}
+
+// TestGetBlockHeaders checks that the node serves headers which are consistent
+// with its status.
+func (s *Suite) TestGetBlockHeaders(t *utesting.T) {
+	c, status := s.dialEtsc(t, etscVersion)
+	defer c.Close()
+
+	headers, err := c.etscHeaders(&GetBlockHeaders{Origin: 0, Amount: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 1 {
+		t.Fatalf("got %d headers, want 1", len(headers))
+	}
+	if hash := headers[0].Hash(); hash != status.Genesis {
+		t.Fatalf("genesis header hash %x does not match status %x", hash, status.Genesis)
+	}
+	// Requests beyond the head must return nothing.
+	headers, err = c.etscHeaders(&GetBlockHeaders{Origin: 1 << 40, Amount: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 0 {
+		t.Fatalf("got %d headers for unknown block", len(headers))
+	}
+}
+
+// TestMalformedStatus checks that the node drops peers which send an
+// undecodable status.
+func (s *Suite) TestMalformedStatus(t *utesting.T) {
+	c := s.dial(t)
+	defer c.Close()
+
+	if _, err := c.hello(p2p.Cap{Name: "etsc", Version: etscVersion}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p2p.Send(c, baseProtocolLength+etscStatusMsg, []interface{}{"garbage"}); err != nil {
+		t.Fatalf("can't write status: %v", err)
+	}
+	if err := c.expectDisconnect(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestWrongGenesisStatus checks that the node drops peers on a different chain.
+func (s *Suite) TestWrongGenesisStatus(t *utesting.T) {
+	c := s.dial(t)
+	defer c.Close()
+
+	if _, err := c.hello(p2p.Cap{Name: "etsc", Version: etscVersion}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := c.readMsg(baseProtocolLength + etscStatusMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status Status
+	if err := msg.Decode(&status); err != nil {
+		t.Fatalf("invalid status: %v", err)
+	}
+	status.Genesis = common.Hash{1}
+	if err := p2p.Send(c, baseProtocolLength+etscStatusMsg, &status); err != nil {
+		t.Fatalf("can't write status: %v", err)
+	}
+	if err := c.expectDisconnect(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestInvalidMessageCode checks that the node drops peers which send messages
+// outside of the negotiated protocols.
+func (s *Suite) TestInvalidMessageCode(t *utesting.T) {
+	c, _ := s.dialEtsc(t, etscVersion)
+	defer c.Close()
+
+	if err := p2p.Send(c, baseProtocolLength+etscProtocolLength+1, []interface{}{}); err != nil {
+		t.Fatalf("can't write message: %v", err)
+	}
+	if err := c.expectDisconnect(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestLesStatus checks the les handshake and a header request. The test is
+// skipped if the node doesn't serve light clients.
+func (s *Suite) TestLesStatus(t *utesting.T) {
+	c := s.dial(t)
+	defer c.Close()
+
+	hello, err := c.hello(p2p.Cap{Name: "les", Version: lesVersion})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasCap(hello.Caps, "les") {
+		t.Log("skipped: node does not serve les")
+		return
+	}
+	msg, err := c.readMsg(baseProtocolLength + lesStatusMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var theirs []lesKeyValue
+	if err := msg.Decode(&theirs); err != nil {
+		t.Fatalf("invalid les status: %v", err)
+	}
+	values := make(map[string]rlp.RawValue)
+	for _, kv := range theirs {
+		values[kv.Key] = kv.Value
+	}
+	for _, key := range []string{"protocolVersion", "networkId", "headTd", "headHash", "headNum", "genesisHash"} {
+		if values[key] == nil {
+			t.Fatalf("les status lacks %q", key)
+		}
+	}
+	var genesis common.Hash
+	if err := rlp.DecodeBytes(values["genesisHash"], &genesis); err != nil {
+		t.Fatalf("invalid genesis hash in les status: %v", err)
+	}
+	// Answer as a client with the same chain.
+	ours := make([]lesKeyValue, 0, 7)
+	for _, key := range []string{"protocolVersion", "networkId", "headTd", "headHash", "headNum", "genesisHash"} {
+		ours = append(ours, lesKeyValue{key, values[key]})
+	}
+	announceType, _ := rlp.EncodeToBytes(uint64(1))
+	ours = append(ours, lesKeyValue{"announceType", announceType})
+	if err := p2p.Send(c, baseProtocolLength+lesStatusMsg, ours); err != nil {
+		t.Fatalf("can't write les status: %v", err)
+	}
+
+	req := struct {
+		ReqID uint64
+		Query GetBlockHeaders
+	}{ReqID: 1, Query: GetBlockHeaders{Origin: 0, Amount: 1}}
+	if err := p2p.Send(c, baseProtocolLength+lesGetBlockHeadersMsg, &req); err != nil {
+		t.Fatalf("can't write header request: %v", err)
+	}
+	for {
+		msg, err := c.ReadMsg()
+		if err != nil {
+			t.Fatalf("no header response: %v", err)
+		}
+		switch msg.Code {
+		case baseProtocolLength + lesAnnounceMsg:
+			msg.Discard()
+			continue
+		case baseProtocolLength + lesBlockHeadersMsg:
+			var resp struct {
+				ReqID, BV uint64
+				Headers   []*types.Header
+			}
+			if err := msg.Decode(&resp); err != nil {
+				t.Fatalf("invalid header response: %v", err)
+			}
+			if resp.ReqID != req.ReqID {
+				t.Fatalf("wrong request ID %d in response", resp.ReqID)
+			}
+			if len(resp.Headers) != 1 || resp.Headers[0].Hash() != genesis {
+				t.Fatalf("wrong headers in response")
+			}
+			return
+		default:
+			msg.Discard()
+			t.Fatalf("unexpected message code %d", msg.Code)
+		}
+	}
+}
+
+func hasCap(caps []p2p.Cap, name string) bool {
+	for _, c := range caps {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package etsctest
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ETSC3259/etsc/consensus/etschash"
+	"github.com/ETSC3259/etsc/core"
+	"github.com/ETSC3259/etsc/etsc"
+	"github.com/ETSC3259/etsc/internal/utesting"
+	"github.com/ETSC3259/etsc/les"
+	"github.com/ETSC3259/etsc/node"
+	"github.com/ETSC3259/etsc/p2p"
+	"github.com/ETSC3259/etsc/params"
+)
+
+// This test runs the suite against a node started on loopback.
+func TestEtscSuite(t *testing.T) {
+	stack, cleanup := runLocalNode(t)
+	defer cleanup()
+
+	suite := NewSuite(stack.Server().Self())
+	for _, test := range suite.AllTests() {
+		t.Run(test.Name, func(t *testing.T) {
+			result := utesting.RunTests([]utesting.Test{test}, os.Stdout)
+			if result[0].Failed {
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// runLocalNode starts a full node serving etsc and les on a random loopback port.
+func runLocalNode(t *testing.T) (*node.Node, func()) {
+	datadir, err := ioutil.TempDir("", "etsctest-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stack, err := node.New(&node.Config{
+		DataDir: datadir,
+		P2P: p2p.Config{
+			ListenAddr:  "127.0.0.1:0",
+			NoDiscovery: true,
+			NoDial:      true,
+			MaxPeers:    10,
+		},
+	})
+	if err != nil {
+		os.RemoveAll(datadir)
+		t.Fatal(err)
+	}
+	config := etsc.DefaultConfig
+	config.NetworkId = 1337
+	config.Genesis = &core.Genesis{
+		Config:     params.AllEtschashProtocolChanges,
+		Difficulty: params.MinimumDifficulty,
+		GasLimit:   params.GenesisGasLimit,
+	}
+	config.Etschash = etschash.Config{PowMode: etschash.ModeFake}
+	config.LightServ = 50
+	config.LightPeers = 5
+	err = stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		fullNode, err := etsc.New(ctx, &config)
+		if fullNode != nil {
+			ls, _ := les.NewLesServer(fullNode, &config)
+			fullNode.AddLesServer(ls)
+		}
+		return fullNode, err
+	})
+	if err != nil {
+		os.RemoveAll(datadir)
+		t.Fatal(err)
+	}
+	if err := stack.Start(); err != nil {
+		os.RemoveAll(datadir)
+		t.Fatal(err)
+	}
+	return stack, func() {
+		stack.Stop()
+		os.RemoveAll(datadir)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package etsctest
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/core/forkid"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/p2p"
+	"github.com/ETSC3259/etsc/p2p/enode"
+	"github.com/ETSC3259/etsc/rlp"
+)
+
+// Message codes of the devp2p base protocol.
+const (
+	helloMsg = 0x00
+	discMsg  = 0x01
+	pingMsg  = 0x02
+	pongMsg  = 0x03
+
+	// Subprotocol message codes start after the base protocol.
+	baseProtocolLength    = 16
+	baseProtocolVersion   = 5
+	snappyProtocolVersion = 5 // first version with compressed payloads
+)
+
+// Message codes of the etsc protocol, relative to the subprotocol offset.
+const (
+	etscStatusMsg          = 0x00
+	etscGetBlockHeadersMsg = 0x03
+	etscBlockHeadersMsg    = 0x04
+	etscProtocolLength     = 17
+)
+
+// Message codes of the les protocol, relative to the subprotocol offset.
+const (
+	lesStatusMsg          = 0x00
+	lesAnnounceMsg        = 0x01
+	lesGetBlockHeadersMsg = 0x02
+	lesBlockHeadersMsg    = 0x03
+)
+
+const (
+	timeout        = 20 * time.Second
+	etscVersion    = 63
+	etscVersionFID = 64 // first version with fork ID in the status message
+	lesVersion     = 2
+)
+
+// Hello is the devp2p protocol handshake message.
+type Hello struct {
+	Version    uint64
+	Name       string
+	Caps       []p2p.Cap
+	ListenPort uint64
+	ID         []byte // secp256k1 public key
+
+	// Ignore additional fields (for forward compatibility).
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+// Status is the etsc protocol handshake message.
+type Status struct {
+	ProtocolVersion uint32
+	NetworkID       uint64
+	TD              *big.Int
+	Head            common.Hash
+	Genesis         common.Hash
+}
+
+// Status64 is the etsc protocol handshake message of versions that carry the
+// fork ID.
+type Status64 struct {
+	ProtocolVersion uint32
+	NetworkID       uint64
+	TD              *big.Int
+	Head            common.Hash
+	Genesis         common.Hash
+	ForkID          forkid.ID
+}
+
+// GetBlockHeaders requests headers by block number.
+type GetBlockHeaders struct {
+	Origin  uint64
+	Amount  uint64
+	Skip    uint64
+	Reverse bool
+}
+
+// lesKeyValue is an entry of the les status message.
+type lesKeyValue struct {
+	Key   string
+	Value rlp.RawValue
+}
+
+// Conn is a raw RLPx connection to the node under test.
+type Conn struct {
+	*p2p.RLPXConn
+	key  *ecdsa.PrivateKey
+	dest *enode.Node
+}
+
+// dial connects to the node and performs the encryption handshake.
+func dial(dest *enode.Node) (*Conn, error) {
+	fd, err := net.DialTimeout("tcp", fmt.Sprintf("%v:%d", dest.IP(), dest.TCP()), timeout)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	c := &Conn{RLPXConn: p2p.NewRLPXConn(fd), key: key, dest: dest}
+	if _, err := c.Handshake(key, dest.Pubkey()); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// hello performs the devp2p protocol handshake, announcing the given capabilities.
+func (c *Conn) hello(caps ...p2p.Cap) (*Hello, error) {
+	ours := &Hello{
+		Version: baseProtocolVersion,
+		Name:    "devp2p-test",
+		Caps:    caps,
+		ID:      crypto.FromECDSAPub(&c.key.PublicKey)[1:],
+	}
+	if err := p2p.Send(c, helloMsg, ours); err != nil {
+		return nil, fmt.Errorf("can't write hello: %v", err)
+	}
+	msg, err := c.readMsg(helloMsg)
+	if err != nil {
+		return nil, err
+	}
+	var theirs Hello
+	if err := msg.Decode(&theirs); err != nil {
+		return nil, fmt.Errorf("invalid hello: %v", err)
+	}
+	// Payloads are compressed from now on if both sides support it.
+	c.SetSnappy(theirs.Version >= snappyProtocolVersion)
+	return &theirs, nil
+}
+
+// readMsg reads the next message, answering pings. It fails if the message
+// isn't of the wanted code or if the remote end disconnects.
+func (c *Conn) readMsg(want uint64) (p2p.Msg, error) {
+	for {
+		msg, err := c.ReadMsg()
+		if err != nil {
+			return msg, fmt.Errorf("can't read message: %v", err)
+		}
+		switch {
+		case msg.Code == pingMsg:
+			msg.Discard()
+			p2p.Send(c, pongMsg, []interface{}{})
+			continue
+		case msg.Code == discMsg:
+			var reason []p2p.DiscReason
+			rlp.Decode(msg.Payload, &reason)
+			return msg, fmt.Errorf("disconnected: %v", reason)
+		case msg.Code != want:
+			msg.Discard()
+			return msg, fmt.Errorf("unexpected message code %d, want %d", msg.Code, want)
+		}
+		return msg, nil
+	}
+}
+
+// expectDisconnect reads messages until the remote end disconnects or closes
+// the connection. It fails if the node keeps the connection open.
+func (c *Conn) expectDisconnect() error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		msg, err := c.ReadMsg()
+		if err != nil {
+			return nil // connection closed
+		}
+		msg.Discard()
+		if msg.Code == discMsg {
+			return nil
+		}
+	}
+	return fmt.Errorf("node did not disconnect within %v", timeout)
+}
+
+// etscStatus reads the remote status and answers it with a status that
+// matches the remote chain.
+func (c *Conn) etscStatus(version uint) (*Status64, error) {
+	msg, err := c.readMsg(baseProtocolLength + etscStatusMsg)
+	if err != nil {
+		return nil, err
+	}
+	var status Status64
+	if version >= etscVersionFID {
+		err = msg.Decode(&status)
+	} else {
+		var s Status
+		err = msg.Decode(&s)
+		status = Status64{s.ProtocolVersion, s.NetworkID, s.TD, s.Head, s.Genesis, forkid.ID{}}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid status: %v", err)
+	}
+	if status.ProtocolVersion != uint32(version) {
+		return nil, fmt.Errorf("wrong protocol version %d in status, want %d", status.ProtocolVersion, version)
+	}
+	var reply interface{} = &status
+	if version < etscVersionFID {
+		reply = &Status{status.ProtocolVersion, status.NetworkID, status.TD, status.Head, status.Genesis}
+	}
+	if err := p2p.Send(c, baseProtocolLength+etscStatusMsg, reply); err != nil {
+		return nil, fmt.Errorf("can't write status: %v", err)
+	}
+	return &status, nil
+}
+
+// etscHeaders requests headers and waits for the response.
+func (c *Conn) etscHeaders(req *GetBlockHeaders) ([]*types.Header, error) {
+	if err := p2p.Send(c, baseProtocolLength+etscGetBlockHeadersMsg, req); err != nil {
+		return nil, fmt.Errorf("can't write header request: %v", err)
+	}
+	msg, err := c.readMsg(baseProtocolLength + etscBlockHeadersMsg)
+	if err != nil {
+		return nil, err
+	}
+	var headers []*types.Header
+	if err := msg.Decode(&headers); err != nil {
+		return nil, fmt.Errorf("invalid headers: %v", err)
+	}
+	return headers, nil
+}
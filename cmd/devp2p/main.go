@@ -0,0 +1,108 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of go-etsc.
+//
+// go-etsc is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-etsc is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-etsc. If not, see <http://www.gnu.org/licenses/>.
+
+// devp2p is a command line tool for working with the p2p networking layer:
+// querying and crawling the discovery network, publishing DNS node lists,
+// inspecting node records and testing the wire protocols of remote nodes.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/ETSC3259/etsc/cmd/utils"
+	"github.com/ETSC3259/etsc/log"
+	"github.com/ETSC3259/etsc/p2p/enode"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// Git SHA1 commit hash of the release (set via linker flags)
+var gitCommit = ""
+
+var app *cli.App
+
+func init() {
+	app = utils.NewApp(gitCommit, "go-etsc devp2p tool")
+	app.Flags = []cli.Flag{
+		verbosityFlag,
+	}
+	app.Before = func(ctx *cli.Context) error {
+		handler := log.StreamHandler(os.Stderr, log.TerminalFormat(false))
+		log.Root().SetHandler(log.LvlFilterHandler(log.Lvl(ctx.GlobalInt(verbosityFlag.Name)), handler))
+		return nil
+	}
+	app.Commands = []cli.Command{
+		enrCommand,
+		discv4Command,
+		dnsCommand,
+		rlpxCommand,
+	}
+}
+
+var verbosityFlag = cli.IntFlag{
+	Name:  "verbosity",
+	Usage: "log level (0-5)",
+	Value: int(log.LvlInfo),
+}
+
+func main() {
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// getNodeArg handles the common case of a single node descriptor argument.
+func getNodeArg(ctx *cli.Context) *enode.Node {
+	if ctx.NArg() != 1 {
+		exit("missing node as command-line argument")
+	}
+	n, err := parseNode(ctx.Args()[0])
+	if err != nil {
+		exit(err)
+	}
+	return n
+}
+
+func exit(err interface{}) {
+	if err == nil {
+		os.Exit(0)
+	}
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func loadJSON(file string, val interface{}) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, val); err != nil {
+		return fmt.Errorf("invalid JSON in %s: %v", file, err)
+	}
+	return nil
+}
+
+func writeJSON(file string, val interface{}) error {
+	data, err := json.MarshalIndent(val, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	return ioutil.WriteFile(file, data, 0644)
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of go-etsc.
+//
+// go-etsc is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-etsc is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-etsc. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ETSC3259/etsc/p2p/enode"
+	"github.com/ETSC3259/etsc/p2p/enr"
+	"github.com/ETSC3259/etsc/rlp"
+)
+
+const enrPrefix = "enr:"
+
+// nodeSet is the on-disk format of a crawled node list.
+type nodeSet map[enode.ID]nodeJSON
+
+type nodeJSON struct {
+	Seq    uint64 `json:"seq"`
+	Record string `json:"record"`
+	Score  int    `json:"score,omitempty"`
+
+	// The first time the node was seen and the last time it responded.
+	FirstResponse time.Time `json:"firstResponse,omitempty"`
+	LastResponse  time.Time `json:"lastResponse,omitempty"`
+	LastCheck     time.Time `json:"lastCheck,omitempty"`
+}
+
+func loadNodesJSON(file string) nodeSet {
+	var nodes nodeSet
+	if err := loadJSON(file, &nodes); err != nil {
+		exit(err)
+	}
+	return nodes
+}
+
+func writeNodesJSON(file string, nodes nodeSet) {
+	if err := writeJSON(file, nodes); err != nil {
+		exit(err)
+	}
+}
+
+// nodes returns the decoded records of all nodes in the set, sorted by ID.
+func (ns nodeSet) nodes() []*enode.Node {
+	result := make([]*enode.Node, 0, len(ns))
+	for _, n := range ns {
+		node, err := parseRecord(n.Record)
+		if err != nil {
+			exit(err)
+		}
+		result = append(result, node)
+	}
+	sort.Sort(nodesByID(result))
+	return result
+}
+
+// add stores the given nodes, replacing existing entries with older records.
+func (ns nodeSet) add(nodes ...*enode.Node) {
+	for _, n := range nodes {
+		v := ns[n.ID()]
+		if v.Record != "" && v.Seq >= n.Seq() {
+			continue
+		}
+		v.Seq = n.Seq()
+		v.Record = encodeRecord(n)
+		ns[n.ID()] = v
+	}
+}
+
+type nodesByID []*enode.Node
+
+func (ns nodesByID) Len() int           { return len(ns) }
+func (ns nodesByID) Swap(i, j int)      { ns[i], ns[j] = ns[j], ns[i] }
+func (ns nodesByID) Less(i, j int) bool { return ns[i].ID().String() < ns[j].ID().String() }
+
+// encodeRecord returns the textual "enr:" form of the node's record.
+func encodeRecord(n *enode.Node) string {
+	enc, err := rlp.EncodeToBytes(n.Record())
+	if err != nil {
+		exit(fmt.Errorf("can't encode record of %v: %v", n.ID(), err))
+	}
+	return enrPrefix + base64.RawURLEncoding.EncodeToString(enc)
+}
+
+// parseRecord decodes a record in "enr:" form.
+func parseRecord(source string) (*enode.Node, error) {
+	if !strings.HasPrefix(source, enrPrefix) {
+		return nil, fmt.Errorf("missing %q prefix", enrPrefix)
+	}
+	enc, err := base64.RawURLEncoding.DecodeString(source[len(enrPrefix):])
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %v", err)
+	}
+	var r enr.Record
+	if err := rlp.DecodeBytes(enc, &r); err != nil {
+		return nil, err
+	}
+	return enode.New(enode.ValidSchemes, &r)
+}
+
+// parseNode parses a node in either enode:// URL or "enr:" form.
+func parseNode(source string) (*enode.Node, error) {
+	if strings.HasPrefix(source, enrPrefix) {
+		return parseRecord(source)
+	}
+	return enode.ParseV4(source)
+}
@@ -0,0 +1,119 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of go-etsc.
+//
+// go-etsc is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-etsc is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-etsc. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/ETSC3259/etsc/cmd/devp2p/internal/etsctest"
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/internal/utesting"
+	"github.com/ETSC3259/etsc/p2p"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	rlpxCommand = cli.Command{
+		Name:  "rlpx",
+		Usage: "RLPx Commands",
+		Subcommands: []cli.Command{
+			rlpxPingCommand,
+			rlpxEtscTestCommand,
+		},
+	}
+	rlpxPingCommand = cli.Command{
+		Name:      "ping",
+		Usage:     "Performs the protocol handshake with a node",
+		ArgsUsage: "<node>",
+		Action:    rlpxPing,
+	}
+	rlpxEtscTestCommand = cli.Command{
+		Name:      "etsc-test",
+		Usage:     "Runs tests against a node",
+		ArgsUsage: "<node>",
+		Action:    rlpxEtscTest,
+		Flags:     []cli.Flag{testPatternFlag},
+	}
+)
+
+var testPatternFlag = cli.StringFlag{
+	Name:  "run",
+	Usage: "Pattern of test suite(s) to run",
+}
+
+func rlpxPing(ctx *cli.Context) error {
+	n := getNodeArg(ctx)
+
+	fd, err := net.Dial("tcp", fmt.Sprintf("%v:%d", n.IP(), n.TCP()))
+	if err != nil {
+		return err
+	}
+	conn := p2p.NewRLPXConn(fd)
+	defer conn.Close()
+
+	ourKey, _ := crypto.GenerateKey()
+	if _, err := conn.Handshake(ourKey, n.Pubkey()); err != nil {
+		return err
+	}
+	ours := &etsctest.Hello{
+		Version: 5,
+		Name:    "devp2p",
+		ID:      crypto.FromECDSAPub(&ourKey.PublicKey)[1:],
+	}
+	if err := p2p.Send(conn, 0x00, ours); err != nil {
+		return fmt.Errorf("can't write hello: %v", err)
+	}
+	msg, err := conn.ReadMsg()
+	if err != nil {
+		return err
+	}
+	defer msg.Discard()
+
+	switch msg.Code {
+	case 0x00:
+		var h etsctest.Hello
+		if err := msg.Decode(&h); err != nil {
+			return fmt.Errorf("invalid handshake: %v", err)
+		}
+		fmt.Printf("%+v\n", h)
+	case 0x01:
+		var reason []p2p.DiscReason
+		if err := msg.Decode(&reason); err != nil || len(reason) == 0 {
+			return fmt.Errorf("remote disconnected")
+		}
+		return fmt.Errorf("remote disconnected: %v", reason[0])
+	default:
+		return fmt.Errorf("invalid message code %d, expected handshake (code zero)", msg.Code)
+	}
+	return nil
+}
+
+func rlpxEtscTest(ctx *cli.Context) error {
+	n := getNodeArg(ctx)
+	tests := etsctest.NewSuite(n).AllTests()
+	if ctx.IsSet(testPatternFlag.Name) {
+		tests = utesting.MatchTests(tests, ctx.String(testPatternFlag.Name))
+	}
+	results := utesting.RunTests(tests, os.Stdout)
+	if fails := utesting.CountFailures(results); fails > 0 {
+		return fmt.Errorf("%v of %v tests passed.", len(tests)-fails, len(tests))
+	}
+	fmt.Printf("all tests passed\n")
+	return nil
+}
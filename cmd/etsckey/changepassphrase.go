@@ -54,8 +54,8 @@ Change the passphrase of a keyfile.`,
 			newPhrase = promptPassphrase(true)
 		}
 
-		// Encrypt the key with the new passphrase.
-		newJson, err := keystore.EncryptKey(key, newPhrase, keystore.StandardScryptN, keystore.StandardScryptP)
+		// Encrypt the key with the new passphrase, keeping the keyfile format.
+		newJson, err := keystore.EncryptKeyFormat(key, newPhrase, key.Format(), keystore.StandardScryptN, keystore.StandardScryptP)
 		if err != nil {
 			utils.Fatalf("Error encrypting with new passphrase: %v", err)
 		}
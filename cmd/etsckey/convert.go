@@ -0,0 +1,119 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of go-etsc.
+//
+// go-etsc is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-etsc is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-etsc. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ETSC3259/etsc/accounts/keystore"
+	"github.com/ETSC3259/etsc/cmd/utils"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	keyVersionFlag = cli.IntFlag{
+		Name:  "keyversion",
+		Usage: "keyfile version to convert to (3 or 4)",
+		Value: 4,
+	}
+	kdfFlag = cli.StringFlag{
+		Name:  "kdf",
+		Usage: "key derivation function of version 4 keyfiles (scrypt, pbkdf2, argon2id)",
+	}
+	labelFlag = cli.StringFlag{
+		Name:  "label",
+		Usage: "descriptive label to store in version 4 keyfiles",
+	}
+	pathFlag = cli.StringFlag{
+		Name:  "path",
+		Usage: "derivation path to store in version 4 keyfiles",
+	}
+	lightKDFFlag = cli.BoolFlag{
+		Name:  "lightkdf",
+		Usage: "use less secure key derivation parameters",
+	}
+)
+
+var commandConvert = cli.Command{
+	Name:      "convert",
+	Usage:     "convert a keyfile to another format",
+	ArgsUsage: "<keyfile>",
+	Description: `
+Convert a keyfile between the version 3 and version 4 formats, keeping its
+passphrase.
+
+Version 4 keyfiles support the scrypt, pbkdf2 and argon2id key derivation
+functions, selected with --kdf, and can carry a descriptive --label and the
+derivation --path of the key. Existing metadata and the KDF are kept unless
+overridden. Converting a keyfile with metadata to version 3 is refused unless
+the metadata is cleared explicitly.`,
+	Flags: []cli.Flag{
+		passphraseFlag,
+		keyVersionFlag,
+		kdfFlag,
+		labelFlag,
+		pathFlag,
+		lightKDFFlag,
+	},
+	Action: func(ctx *cli.Context) error {
+		keyfilepath := ctx.Args().First()
+
+		// Read key from file.
+		keyjson, err := ioutil.ReadFile(keyfilepath)
+		if err != nil {
+			utils.Fatalf("Failed to read the keyfile at '%s': %v", keyfilepath, err)
+		}
+
+		// Decrypt key with passphrase.
+		passphrase := getPassphrase(ctx)
+		key, err := keystore.DecryptKey(keyjson, passphrase)
+		if err != nil {
+			utils.Fatalf("Error decrypting key: %v", err)
+		}
+
+		// Update the metadata and encrypt the key in the requested format.
+		if ctx.IsSet(labelFlag.Name) {
+			key.Label = ctx.String(labelFlag.Name)
+		}
+		if ctx.IsSet(pathFlag.Name) {
+			key.Path = ctx.String(pathFlag.Name)
+		}
+		format := key.Format().Override(keystore.KeyFormat{
+			Version: ctx.Int(keyVersionFlag.Name),
+			KDF:     ctx.String(kdfFlag.Name),
+		})
+		scryptN, scryptP := keystore.StandardScryptN, keystore.StandardScryptP
+		if ctx.Bool(lightKDFFlag.Name) {
+			scryptN, scryptP = keystore.LightScryptN, keystore.LightScryptP
+		}
+		newJson, err := keystore.EncryptKeyFormat(key, passphrase, format, scryptN, scryptP)
+		if err == keystore.ErrKeyMetadata {
+			utils.Fatalf("Keyfile has a label or derivation path, clear them with --label \"\" --path \"\" to convert to version 3")
+		}
+		if err != nil {
+			utils.Fatalf("Error converting key: %v", err)
+		}
+
+		// Then write the new keyfile in place of the old one.
+		if err := ioutil.WriteFile(keyfilepath, newJson, 0600); err != nil {
+			utils.Fatalf("Error writing new keyfile to disk: %v", err)
+		}
+		fmt.Printf("Converted keyfile to version %d\n", format.Version)
+		return nil
+	},
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of go-etsc.
+//
+// go-etsc is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-etsc is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-etsc. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "etsckey-test")
+	if err != nil {
+		t.Fatal("Can't create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	keyfile := filepath.Join(tmpdir, "the-keyfile")
+	passfile := filepath.Join(tmpdir, "the-passfile")
+	if err := ioutil.WriteFile(passfile, []byte("foobar\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Create the key.
+	generate := runEtsckey(t, "generate", keyfile)
+	generate.Expect(`
+!! Unsupported terminal, password will be echoed.
+Passphrase: {{.InputLine "foobar"}}
+Repeat passphrase: {{.InputLine "foobar"}}
+`)
+	_, matches := generate.ExpectRegexp(`Address: (0x[0-9a-fA-F]{40})\n`)
+	address := matches[1]
+	generate.ExpectExit()
+
+	// Convert it to version 4 with metadata, and back again.
+	convert := runEtsckey(t, "convert", "--passwordfile", passfile, "--lightkdf", "--kdf", "argon2id", "--label", "savings", keyfile)
+	convert.Expect("Converted keyfile to version 4\n")
+	convert.ExpectExit()
+
+	inspect := runEtsckey(t, "inspect", "--passwordfile", passfile, keyfile)
+	inspect.ExpectRegexp(`Address: +` + address + `\n`)
+	inspect.ExpectRegexp(`Format: +v4 \(argon2id\)\nLabel: +savings\n`)
+	inspect.ExpectExit()
+
+	// Updating the metadata alone must keep the KDF.
+	convert = runEtsckey(t, "convert", "--passwordfile", passfile, "--lightkdf", "--label", "spending", keyfile)
+	convert.Expect("Converted keyfile to version 4\n")
+	convert.ExpectExit()
+
+	inspect = runEtsckey(t, "inspect", "--passwordfile", passfile, keyfile)
+	inspect.ExpectRegexp(`Format: +v4 \(argon2id\)\nLabel: +spending\n`)
+	inspect.ExpectExit()
+
+	// Converting to version 3 must not drop the metadata unless it's cleared.
+	convert = runEtsckey(t, "convert", "--passwordfile", passfile, "--lightkdf", "--keyversion", "3", keyfile)
+	convert.Expect(`Fatal: Keyfile has a label or derivation path, clear them with --label "" --path "" to convert to version 3` + "\n")
+	convert.ExpectExit()
+
+	convert = runEtsckey(t, "convert", "--passwordfile", passfile, "--lightkdf", "--keyversion", "3", "--label", "", keyfile)
+	convert.Expect("Converted keyfile to version 3\n")
+	convert.ExpectExit()
+
+	inspect = runEtsckey(t, "inspect", "--passwordfile", passfile, keyfile)
+	inspect.ExpectRegexp(`Address: +` + address + `\n`)
+	inspect.ExpectRegexp(`Format: +v3 \(scrypt\)\n`)
+	inspect.ExpectExit()
+}
@@ -31,6 +31,10 @@ type outputInspect struct {
 	Address    string
 	PublicKey  string
 	PrivateKey string
+	Version    int
+	KDF        string
+	Label      string
+	Path       string
 }
 
 var commandInspect = cli.Command{
@@ -68,10 +72,15 @@ make sure to use this feature with great caution!`,
 
 		// Output all relevant information we can retrieve.
 		showPrivate := ctx.Bool("private")
+		format := key.Format()
 		out := outputInspect{
 			Address: key.Address.Hex(),
 			PublicKey: hex.EncodeToString(
 				crypto.FromECDSAPub(&key.PrivateKey.PublicKey)),
+			Version: format.Version,
+			KDF:     format.KDF,
+			Label:   key.Label,
+			Path:    key.Path,
 		}
 		if showPrivate {
 			out.PrivateKey = hex.EncodeToString(crypto.FromECDSA(key.PrivateKey))
@@ -85,6 +94,13 @@ make sure to use this feature with great caution!`,
 			if showPrivate {
 				fmt.Println("Private key:   ", out.PrivateKey)
 			}
+			fmt.Println("Format:        ", fmt.Sprintf("v%d (%s)", out.Version, out.KDF))
+			if out.Label != "" {
+				fmt.Println("Label:         ", out.Label)
+			}
+			if out.Path != "" {
+				fmt.Println("Path:          ", out.Path)
+			}
 		}
 		return nil
 	},
@@ -39,6 +39,7 @@ func init() {
 		commandGenerate,
 		commandInspect,
 		commandChangePassphrase,
+		commandConvert,
 		commandSignMessage,
 		commandVerifyMessage,
 	}
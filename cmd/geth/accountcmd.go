@@ -19,6 +19,7 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"strings"
 
 	"github.com/ETSC3259/etsc/accounts"
 	"github.com/ETSC3259/etsc/accounts/keystore"
@@ -72,7 +73,8 @@ passwordfile as argument containing the wallet password in plaintext.`,
 		Description: `
 
 Manage accounts, list all existing accounts, import a private key into a new
-account, create a new account or update an existing account.
+account, create a new account or update an existing account. Hierarchical
+deterministic seeds can be imported from and exported as BIP-39 mnemonics.
 
 It supports interactive mode, when you are prompted for password as well as
 non-interactive mode where passwords are supplied via a given password file.
@@ -135,6 +137,8 @@ password to file or expose in any other way.
 					utils.DataDirFlag,
 					utils.KeyStoreDirFlag,
 					utils.LightKDFFlag,
+					keyVersionFlag,
+					kdfFlag,
 				},
 				Description: `
     getsc account update <address>
@@ -153,6 +157,12 @@ For non-interactive use the passphrase can be specified with the --password flag
 
 Since only one password can be given, only format update can be performed,
 changing your password is only possible interactively.
+
+The key file keeps its format unless told otherwise. It can be converted between
+the version 3 and version 4 formats with --keyversion, and the key derivation
+function of version 4 key files chosen with --kdf (scrypt, pbkdf2, argon2id):
+
+    getsc account update --keyversion 4 --kdf argon2id <address>
 `,
 			},
 			{
@@ -186,10 +196,73 @@ Note:
 As you can directly copy your encrypted accounts to another etsc instance,
 this import mechanism is not needed when you transfer an account between
 nodes.
+`,
+			},
+			{
+				Name:   "import-mnemonic",
+				Usage:  "Import a BIP-39 mnemonic into a new seed wallet",
+				Action: utils.MigrateFlags(accountImportMnemonic),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.KeyStoreDirFlag,
+					utils.PasswordFileFlag,
+					utils.LightKDFFlag,
+					mnemonicAccountsFlag,
+				},
+				ArgsUsage: "[<mnemonicFile>]",
+				Description: `
+    getsc account import-mnemonic [options] [<mnemonicFile>]
+
+Imports a BIP-39 mnemonic into a new hierarchical deterministic seed wallet and
+pins the first accounts of the default derivation path m/44'/60'/0'/0 to it.
+Prints the addresses.
+
+The mnemonic is prompted for interactively, together with its optional BIP-39
+password. For non-interactive use it can be read from <mnemonicFile>, where the
+first line holds the mnemonic and the optional second line the BIP-39 password.
+
+The seed is saved in encrypted format, you are prompted for a passphrase. Further
+accounts can be derived from the wallet after opening it with this passphrase.
+
+For non-interactive use the passphrase can be specified with the --password flag.
+`,
+			},
+			{
+				Name:      "export-mnemonic",
+				Usage:     "Export the BIP-39 mnemonic of a seed wallet",
+				Action:    utils.MigrateFlags(accountExportMnemonic),
+				ArgsUsage: "<address>",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.KeyStoreDirFlag,
+					utils.PasswordFileFlag,
+				},
+				Description: `
+    getsc account export-mnemonic [options] <address>
+
+Prints the BIP-39 mnemonic (and optional BIP-39 password) of the seed wallet the
+given account was derived from. You are prompted for the passphrase of the seed.
+
+Note, the mnemonic grants full access to all accounts of the seed, make sure it
+is not displayed or stored anywhere it could be seen by others.
 `,
 			},
 		},
 	}
+
+	mnemonicAccountsFlag = cli.IntFlag{
+		Name:  "accounts",
+		Usage: "Number of accounts to pin from the imported seed",
+		Value: 1,
+	}
+	keyVersionFlag = cli.IntFlag{
+		Name:  "keyversion",
+		Usage: "Key file version to convert the account to (3 or 4, default = keep)",
+	}
+	kdfFlag = cli.StringFlag{
+		Name:  "kdf",
+		Usage: "Key derivation function of version 4 key files (scrypt, pbkdf2, argon2id)",
+	}
 )
 
 func accountList(ctx *cli.Context) error {
@@ -317,7 +390,8 @@ func accountCreate(ctx *cli.Context) error {
 }
 
 // accountUpdate transitions an account from a previous format to the current
-// one, also providing the possibility to change the pass-phrase.
+// one or the requested one, also providing the possibility to change the
+// pass-phrase.
 func accountUpdate(ctx *cli.Context) error {
 	if len(ctx.Args()) == 0 {
 		utils.Fatalf("No accounts specified to update")
@@ -325,10 +399,14 @@ func accountUpdate(ctx *cli.Context) error {
 	stack, _ := makeConfigNode(ctx)
 	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
 
+	format := keystore.KeyFormat{
+		Version: ctx.Int(keyVersionFlag.Name),
+		KDF:     ctx.String(kdfFlag.Name),
+	}
 	for _, addr := range ctx.Args() {
 		account, oldPassword := unlockAccount(ctx, ks, addr, 0, nil)
 		newPassword := getPassPhrase("Please give a new password. Do not forget this password.", true, 0, nil)
-		if err := ks.Update(account, oldPassword, newPassword); err != nil {
+		if err := ks.UpdateFormat(account, oldPassword, newPassword, format); err != nil {
 			utils.Fatalf("Could not update the account: %v", err)
 		}
 	}
@@ -377,3 +455,66 @@ func accountImport(ctx *cli.Context) error {
 	fmt.Printf("Address: {%x}\n", acct.Address)
 	return nil
 }
+
+// accountImportMnemonic imports a BIP-39 mnemonic into a new seed wallet in the
+// keystore defined by the CLI flags.
+func accountImportMnemonic(ctx *cli.Context) error {
+	var mnemonic, password string
+	if file := ctx.Args().First(); file != "" {
+		text, err := ioutil.ReadFile(file)
+		if err != nil {
+			utils.Fatalf("Failed to read the mnemonic: %v", err)
+		}
+		lines := strings.Split(strings.Replace(string(text), "\r", "", -1), "\n")
+		mnemonic = lines[0]
+		if len(lines) > 1 {
+			password = lines[1]
+		}
+	} else {
+		var err error
+		if mnemonic, err = console.Stdin.PromptPassword("Mnemonic: "); err != nil {
+			utils.Fatalf("Failed to read the mnemonic: %v", err)
+		}
+		if password, err = console.Stdin.PromptPassword("BIP-39 password (optional): "); err != nil {
+			utils.Fatalf("Failed to read the BIP-39 password: %v", err)
+		}
+	}
+	count := ctx.Int(mnemonicAccountsFlag.Name)
+	if count < 1 {
+		utils.Fatalf("At least one account must be pinned")
+	}
+	paths := accounts.DefaultDerivationPaths(count)
+	stack, _ := makeConfigNode(ctx)
+	passphrase := getPassPhrase("Your new seed wallet is locked with a password. Please give a password. Do not forget this password.", true, 0, utils.MakePasswordList(ctx))
+
+	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	accs, err := ks.ImportMnemonic(mnemonic, password, passphrase, paths...)
+	if err != nil {
+		utils.Fatalf("Could not import the mnemonic: %v", err)
+	}
+	for _, acct := range accs {
+		fmt.Printf("Address: {%x} %s\n", acct.Address, &acct.URL)
+	}
+	return nil
+}
+
+// accountExportMnemonic prints the BIP-39 mnemonic of the seed wallet an account
+// was derived from.
+func accountExportMnemonic(ctx *cli.Context) error {
+	if len(ctx.Args()) == 0 {
+		utils.Fatalf("No account specified to export")
+	}
+	stack, _ := makeConfigNode(ctx)
+	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+
+	account, passphrase := unlockAccount(ctx, ks, ctx.Args().First(), 0, utils.MakePasswordList(ctx))
+	mnemonic, password, err := ks.ExportMnemonic(account, passphrase)
+	if err != nil {
+		utils.Fatalf("Could not export the mnemonic: %v", err)
+	}
+	fmt.Printf("Mnemonic: %s\n", mnemonic)
+	if password != "" {
+		fmt.Printf("BIP-39 password: %s\n", password)
+	}
+	return nil
+}
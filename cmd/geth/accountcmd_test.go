@@ -23,6 +23,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/ETSC3259/etsc/accounts/keystore"
 	"github.com/cespare/cp"
 )
 
@@ -106,6 +107,93 @@ Repeat passphrase: {{.InputLine "foobar2"}}
 `)
 }
 
+func TestAccountUpdateFormat(t *testing.T) {
+	datadir := tmpDatadirWithKeystore(t)
+	getsc := rungetsc(t, "account", "update",
+		"--datadir", datadir, "--lightkdf", "--keyversion", "4", "--kdf", "argon2id",
+		"f466859ead1932d743d622cb74fc058882e8648a")
+	getsc.Expect(`
+Unlocking account f466859ead1932d743d622cb74fc058882e8648a | Attempt 1/3
+!! Unsupported terminal, password will be echoed.
+Passphrase: {{.InputLine "foobar"}}
+Please give a new password. Do not forget this password.
+Passphrase: {{.InputLine "foobar2"}}
+Repeat passphrase: {{.InputLine "foobar2"}}
+`)
+	getsc.ExpectExit()
+
+	keyjson, err := ioutil.ReadFile(filepath.Join(datadir, "keystore", "aaa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keystore.DecryptKey(keyjson, "foobar2")
+	if err != nil {
+		t.Fatalf("failed to decrypt updated key: %v", err)
+	}
+	if format := key.Format(); format != (keystore.KeyFormat{Version: 4, KDF: keystore.KDFArgon2id}) {
+		t.Errorf("key file format mismatch: have %+v", format)
+	}
+}
+
+func TestAccountImportMnemonic(t *testing.T) {
+	getsc := rungetsc(t, "account", "import-mnemonic", "--lightkdf", "--accounts", "2")
+	defer getsc.ExpectExit()
+	getsc.Expect(`
+!! Unsupported terminal, password will be echoed.
+Mnemonic: {{.InputLine "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"}}
+BIP-39 password (optional): {{.InputLine ""}}
+Your new seed wallet is locked with a password. Please give a password. Do not forget this password.
+Passphrase: {{.InputLine "foobar"}}
+Repeat passphrase: {{.InputLine "foobar"}}
+`)
+	getsc.ExpectRegexp(`Address: \{9858effd232b4033e47d90003d41ec34ecaeda94\} keystore://.*/m/44'/60'/0'/0/0
+Address: \{6fac4d18c912343bf86fa7049364dd4e424ab9c0\} keystore://.*/m/44'/60'/0'/0/1
+`)
+	files, err := ioutil.ReadDir(filepath.Join(getsc.Datadir, "keystore"))
+	if len(files) != 1 {
+		t.Errorf("expected one seed file in keystore directory, found %d files (error: %v)", len(files), err)
+	}
+}
+
+func TestAccountImportMnemonicInvalid(t *testing.T) {
+	getsc := rungetsc(t, "account", "import-mnemonic", "--lightkdf")
+	defer getsc.ExpectExit()
+	getsc.Expect(`
+!! Unsupported terminal, password will be echoed.
+Mnemonic: {{.InputLine "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon"}}
+BIP-39 password (optional): {{.InputLine ""}}
+Your new seed wallet is locked with a password. Please give a password. Do not forget this password.
+Passphrase: {{.InputLine "foobar"}}
+Repeat passphrase: {{.InputLine "foobar"}}
+Fatal: Could not import the mnemonic: invalid mnemonic: checksum mismatch
+`)
+}
+
+func TestAccountExportMnemonic(t *testing.T) {
+	datadir := tmpdir(t)
+	mnemonic := filepath.Join(datadir, "mnemonic.txt")
+	if err := ioutil.WriteFile(mnemonic, []byte("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about\nTREZOR\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	password := filepath.Join(datadir, "password.txt")
+	if err := ioutil.WriteFile(password, []byte("foobar"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	getsc := rungetsc(t, "account", "import-mnemonic", "--datadir", datadir, "--lightkdf", "--password", password, mnemonic)
+	_, matches := getsc.ExpectRegexp(`Address: \{([0-9a-f]{40})\} keystore://.*\n`)
+	getsc.ExpectExit()
+
+	getsc = rungetsc(t, "account", "export-mnemonic", "--datadir", datadir, matches[1])
+	defer getsc.ExpectExit()
+	getsc.Expect(`
+Unlocking account ` + matches[1] + ` | Attempt 1/3
+!! Unsupported terminal, password will be echoed.
+Passphrase: {{.InputLine "foobar"}}
+Mnemonic: abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about
+BIP-39 password: TREZOR
+`)
+}
+
 func TestWalletImport(t *testing.T) {
 	getsc := rungetsc(t, "wallet", "import", "--lightkdf", "testdata/guswallet.json")
 	defer getsc.ExpectExit()
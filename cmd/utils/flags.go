@@ -127,6 +127,11 @@ var (
 		Name:  "nousb",
 		Usage: "Disables monitoring for and managing USB hardware wallets",
 	}
+	ExternalSignerFlag = cli.StringFlag{
+		Name:  "signer",
+		Usage: "External signer (url or path to ipc file)",
+		Value: "",
+	}
 	NetworkIdFlag = cli.Uint64Flag{
 		Name:  "networkid",
 		Usage: "Network identifier (integer, 1=Frontier, 2=Morden (disused), 3=Ropsten, 4=Rinkeby)",
@@ -168,6 +173,15 @@ var (
 		Usage: `Blockchain garbage collection mode ("full", "archive")`,
 		Value: "full",
 	}
+	StateDiffsFlag = cli.BoolFlag{
+		Name:  "statediffs",
+		Usage: "Record and persist the state diff of every imported block",
+	}
+	StateDiffRetentionFlag = cli.Uint64Flag{
+		Name:  "statediffs.retention",
+		Usage: "Number of recent blocks to retain state diffs for (0 = keep all)",
+		Value: etsc.DefaultConfig.StateDiffRetention,
+	}
 	LightServFlag = cli.IntFlag{
 		Name:  "lightserv",
 		Usage: "Maximum percentage of time allowed for serving LES requests (0-90)",
@@ -286,6 +300,25 @@ var (
 		Usage: "Maximum amount of time non-executable transaction are queued",
 		Value: etsc.DefaultConfig.TxPool.Lifetime,
 	}
+	TxPoolPrivateSlotsFlag = cli.Uint64Flag{
+		Name:  "txpool.privateslots",
+		Usage: "Maximum number of private transactions kept from the network",
+		Value: etsc.DefaultConfig.TxPool.PrivateSlots,
+	}
+	TxPoolPrivateLifetimeFlag = cli.DurationFlag{
+		Name:  "txpool.privatelifetime",
+		Usage: "Maximum amount of time private transactions are kept from the network",
+		Value: etsc.DefaultConfig.TxPool.PrivateLifetime,
+	}
+	TxPoolPrivateReleaseFlag = cli.BoolFlag{
+		Name:  "txpool.privaterelease",
+		Usage: "Release expired private transactions into the public pool instead of dropping them",
+	}
+	TxPoolBundleSlotsFlag = cli.Uint64Flag{
+		Name:  "txpool.bundleslots",
+		Usage: "Maximum number of transaction bundles awaiting inclusion",
+		Value: etsc.DefaultConfig.TxPool.BundleSlots,
+	}
 	// Performance tuning settings
 	CacheFlag = cli.IntFlag{
 		Name:  "cache",
@@ -378,6 +411,10 @@ var (
 		Name:  "miner.noverify",
 		Usage: "Disable remote sealing verification",
 	}
+	MinerBundlesFlag = cli.BoolFlag{
+		Name:  "miner.bundles",
+		Usage: "Accept transaction bundles for inclusion by the local miner over RPC",
+	}
 	// Account settings
 	UnlockedAccountFlag = cli.StringFlag{
 		Name:  "unlock",
@@ -432,6 +469,11 @@ var (
 		Usage: "Comma separated list of virtual hostnames from which to accept requests (server enforced). Accepts '*' wildcard.",
 		Value: strings.Join(node.DefaultConfig.HTTPVirtualHosts, ","),
 	}
+	RPCEVMTimeoutFlag = cli.DurationFlag{
+		Name:  "rpcevmtimeout",
+		Usage: "Maximum execution time of calls simulated over RPC (0 = no limit)",
+		Value: etsc.DefaultConfig.RPCEVMTimeout,
+	}
 	RPCApiFlag = cli.StringFlag{
 		Name:  "rpcapi",
 		Usage: "API's offered over the HTTP-RPC interface",
@@ -530,6 +572,15 @@ var (
 		Name:  "v5disc",
 		Usage: "Enables the experimental RLPx V5 (Topic Discovery) mechanism",
 	}
+	DiscoveryVersionFlag = cli.IntFlag{
+		Name:  "discovery.version",
+		Usage: "Node discovery protocol used to find peers (4 or 5)",
+		Value: 4,
+	}
+	DNSDiscoveryFlag = cli.StringFlag{
+		Name:  "discovery.dns",
+		Usage: "Comma separated enrtree:// URLs of DNS node lists to find etsc peers in",
+	}
 	NetrestrictFlag = cli.StringFlag{
 		Name:  "netrestrict",
 		Usage: "Restricts network communication to the given IP networks (CIDR masks)",
@@ -947,6 +998,9 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 	} else if forceV5Discovery {
 		cfg.DiscoveryV5 = true
 	}
+	if ctx.GlobalIsSet(DiscoveryVersionFlag.Name) {
+		cfg.DiscoveryVersion = ctx.GlobalInt(DiscoveryVersionFlag.Name)
+	}
 
 	if netrestrict := ctx.GlobalString(NetrestrictFlag.Name); netrestrict != "" {
 		list, err := netutil.ParseNetlist(netrestrict)
@@ -993,6 +1047,9 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(NoUSBFlag.Name) {
 		cfg.NoUSB = ctx.GlobalBool(NoUSBFlag.Name)
 	}
+	if ctx.GlobalIsSet(ExternalSignerFlag.Name) {
+		cfg.ExternalSigner = ctx.GlobalString(ExternalSignerFlag.Name)
+	}
 }
 
 func setGPO(ctx *cli.Context, cfg *gasprice.Config) {
@@ -1045,6 +1102,18 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolLifetimeFlag.Name) {
 		cfg.Lifetime = ctx.GlobalDuration(TxPoolLifetimeFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolPrivateSlotsFlag.Name) {
+		cfg.PrivateSlots = ctx.GlobalUint64(TxPoolPrivateSlotsFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolPrivateLifetimeFlag.Name) {
+		cfg.PrivateLifetime = ctx.GlobalDuration(TxPoolPrivateLifetimeFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolPrivateReleaseFlag.Name) {
+		cfg.PrivateRelease = ctx.GlobalBool(TxPoolPrivateReleaseFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolBundleSlotsFlag.Name) {
+		cfg.BundleSlots = ctx.GlobalUint64(TxPoolBundleSlotsFlag.Name)
+	}
 }
 
 func setEtschash(ctx *cli.Context, cfg *etsc.Config) {
@@ -1146,6 +1215,9 @@ func SetEtscConfig(ctx *cli.Context, stack *node.Node, cfg *etsc.Config) {
 	if ctx.GlobalIsSet(NetworkIdFlag.Name) {
 		cfg.NetworkId = ctx.GlobalUint64(NetworkIdFlag.Name)
 	}
+	if ctx.GlobalIsSet(DNSDiscoveryFlag.Name) {
+		cfg.DiscoveryURLs = splitAndTrim(ctx.GlobalString(DNSDiscoveryFlag.Name))
+	}
 
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheDatabaseFlag.Name) {
 		cfg.DatabaseCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheDatabaseFlag.Name) / 100
@@ -1157,6 +1229,13 @@ func SetEtscConfig(ctx *cli.Context, stack *node.Node, cfg *etsc.Config) {
 	}
 	cfg.NoPruning = ctx.GlobalString(GCModeFlag.Name) == "archive"
 
+	if ctx.GlobalIsSet(StateDiffsFlag.Name) {
+		cfg.StateDiffs = ctx.GlobalBool(StateDiffsFlag.Name)
+	}
+	if ctx.GlobalIsSet(StateDiffRetentionFlag.Name) {
+		cfg.StateDiffRetention = ctx.GlobalUint64(StateDiffRetentionFlag.Name)
+	}
+
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cfg.TrieCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
 	}
@@ -1193,6 +1272,9 @@ func SetEtscConfig(ctx *cli.Context, stack *node.Node, cfg *etsc.Config) {
 	if ctx.GlobalIsSet(MinerNoVerfiyFlag.Name) {
 		cfg.MinerNoverify = ctx.Bool(MinerNoVerfiyFlag.Name)
 	}
+	if ctx.GlobalIsSet(MinerBundlesFlag.Name) {
+		cfg.MinerBundles = ctx.GlobalBool(MinerBundlesFlag.Name)
+	}
 	if ctx.GlobalIsSet(VMEnableDebugFlag.Name) {
 		// TODO(fjl): force-enable this in --dev mode
 		cfg.EnablePreimageRecording = ctx.GlobalBool(VMEnableDebugFlag.Name)
@@ -1206,6 +1288,10 @@ func SetEtscConfig(ctx *cli.Context, stack *node.Node, cfg *etsc.Config) {
 		cfg.EVMInterpreter = ctx.GlobalString(EVMInterpreterFlag.Name)
 	}
 
+	if ctx.GlobalIsSet(RPCEVMTimeoutFlag.Name) {
+		cfg.RPCEVMTimeout = ctx.GlobalDuration(RPCEVMTimeoutFlag.Name)
+	}
+
 	// Override any default configs for hard coded networks.
 	switch {
 	case ctx.GlobalBool(TestnetFlag.Name):
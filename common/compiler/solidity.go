@@ -66,9 +66,10 @@ type Solidity struct {
 // --combined-output format
 type solcOutput struct {
 	Contracts map[string]struct {
-		BinRuntime                                  string `json:"bin-runtime"`
-		SrcMapRuntime                               string `json:"srcmap-runtime"`
-		Bin, SrcMap, Abi, Devdoc, Userdoc, Metadata string
+		BinRuntime            string `json:"bin-runtime"`
+		SrcMapRuntime         string `json:"srcmap-runtime"`
+		Bin, SrcMap, Metadata string
+		Abi, Devdoc, Userdoc  json.RawMessage
 	}
 	Version string
 }
@@ -162,7 +163,8 @@ func (s *Solidity) run(cmd *exec.Cmd, source string) (map[string]*Contract, erro
 // provided source, language and compiler version, and compiler options are all
 // passed through into the Contract structs.
 //
-// The solc output is expected to contain ABI, source mapping, user docs, and dev docs.
+// The solc output is expected to contain the ABI and bytecode, source mapping, user
+// docs and dev docs are optional.
 //
 // Returns an error if the JSON is malformed or missing data, or if the JSON
 // embedded within the JSON is malformed.
@@ -176,16 +178,16 @@ func ParseCombinedJSON(combinedJSON []byte, source string, languageVersion strin
 	contracts := make(map[string]*Contract)
 	for name, info := range output.Contracts {
 		// Parse the individual compilation results.
-		var abi interface{}
-		if err := json.Unmarshal([]byte(info.Abi), &abi); err != nil {
+		abi, err := parseEmbeddedJSON(info.Abi)
+		if err != nil {
 			return nil, fmt.Errorf("solc: error reading abi definition (%v)", err)
 		}
-		var userdoc interface{}
-		if err := json.Unmarshal([]byte(info.Userdoc), &userdoc); err != nil {
+		userdoc, err := parseEmbeddedJSON(info.Userdoc)
+		if err != nil {
 			return nil, fmt.Errorf("solc: error reading user doc: %v", err)
 		}
-		var devdoc interface{}
-		if err := json.Unmarshal([]byte(info.Devdoc), &devdoc); err != nil {
+		devdoc, err := parseEmbeddedJSON(info.Devdoc)
+		if err != nil {
 			return nil, fmt.Errorf("solc: error reading dev doc: %v", err)
 		}
 		contracts[name] = &Contract{
@@ -209,6 +211,27 @@ func ParseCombinedJSON(combinedJSON []byte, source string, languageVersion strin
 	return contracts, nil
 }
 
+// parseEmbeddedJSON decodes a field of the combined-json output. Depending on the
+// compiler version, fields are either JSON encoded into strings or embedded as
+// plain JSON values. Missing fields decode to nil.
+func parseEmbeddedJSON(field json.RawMessage) (interface{}, error) {
+	if len(field) == 0 {
+		return nil, nil
+	}
+	var embedded string
+	if err := json.Unmarshal(field, &embedded); err == nil {
+		if embedded == "" {
+			return nil, nil
+		}
+		field = json.RawMessage(embedded)
+	}
+	var value interface{}
+	if err := json.Unmarshal(field, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
 func slurpFiles(files []string) (string, error) {
 	var concat bytes.Buffer
 	for _, file := range files {
@@ -18,6 +18,7 @@ package compiler
 
 import (
 	"os/exec"
+	"reflect"
 	"testing"
 )
 
@@ -75,3 +76,42 @@ func TestCompileError(t *testing.T) {
 	}
 	t.Logf("error: %v", err)
 }
+
+// Tests that combined-json outputs of both older compilers, embedding the ABI as
+// a JSON string, and newer ones, embedding it directly, can be parsed, even if
+// no docs were requested.
+func TestParseCombinedJSON(t *testing.T) {
+	const combined = `{
+		"contracts": {
+			"lib.sol:Lib": {"abi": "[{\"type\":\"fallback\"}]", "bin": "6001"},
+			"main.sol:Main": {"abi": [{"type": "fallback"}], "bin": "6002", "devdoc": {"methods": {}}}
+		},
+		"version": "0.5.10"
+	}`
+	contracts, err := ParseCombinedJSON([]byte(combined), "", "", "", "")
+	if err != nil {
+		t.Fatalf("failed to parse combined-json: %v", err)
+	}
+	if len(contracts) != 2 {
+		t.Fatalf("contract count mismatch: have %d, want 2", len(contracts))
+	}
+	abi := []interface{}{map[string]interface{}{"type": "fallback"}}
+	for name, code := range map[string]string{"lib.sol:Lib": "0x6001", "main.sol:Main": "0x6002"} {
+		c, ok := contracts[name]
+		if !ok {
+			t.Fatalf("contract %s missing", name)
+		}
+		if c.Code != code {
+			t.Errorf("%s: code mismatch: have %s, want %s", name, c.Code, code)
+		}
+		if !reflect.DeepEqual(c.Info.AbiDefinition, abi) {
+			t.Errorf("%s: abi mismatch: have %v, want %v", name, c.Info.AbiDefinition, abi)
+		}
+	}
+	if contracts["lib.sol:Lib"].Info.DeveloperDoc != nil {
+		t.Errorf("unexpected dev doc: %v", contracts["lib.sol:Lib"].Info.DeveloperDoc)
+	}
+	if contracts["main.sol:Main"].Info.DeveloperDoc == nil {
+		t.Errorf("missing dev doc")
+	}
+}
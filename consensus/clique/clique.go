@@ -20,6 +20,7 @@ package clique
 import (
 	"bytes"
 	"errors"
+	"io"
 	"math/big"
 	"math/rand"
 	"sync"
@@ -136,9 +137,10 @@ var (
 	errRecentlySigned = errors.New("recently signed")
 )
 
-// SignerFn is a signer callback function to request a hash to be signed by a
-// backing account.
-type SignerFn func(accounts.Account, []byte) ([]byte, error)
+// SignerFn is a signer callback function to request a header to be signed by a
+// backing account. The message is the content of the given mime type to sign,
+// which for clique is the RLP encoded header without its seal (see CliqueRLP).
+type SignerFn func(signer accounts.Account, mimeType string, message []byte) ([]byte, error)
 
 // sigHash returns the hash which is used as input for the proof-of-authority
 // signing. It is the hash of the entire header apart from the 65 byte signature
@@ -149,8 +151,26 @@ type SignerFn func(accounts.Account, []byte) ([]byte, error)
 // or not), which could be abused to produce different hashes for the same header.
 func sigHash(header *types.Header) (hash common.Hash) {
 	hasher := sha3.NewKeccak256()
+	encodeSigHeader(hasher, header)
+	hasher.Sum(hash[:0])
+	return hash
+}
 
-	rlp.Encode(hasher, []interface{}{
+// CliqueRLP returns the RLP encoded header without its seal, which is the content
+// hashed by sigHash and thus the message a signer needs to authorize.
+//
+// Note, the method requires the extra data to be at least 65 bytes, otherwise it
+// panics, similarly to sigHash.
+func CliqueRLP(header *types.Header) []byte {
+	b := new(bytes.Buffer)
+	encodeSigHeader(b, header)
+	return b.Bytes()
+}
+
+// encodeSigHeader writes the RLP encoding of the header, excluding the 65 byte
+// signature contained at the end of the extra data, into w.
+func encodeSigHeader(w io.Writer, header *types.Header) {
+	err := rlp.Encode(w, []interface{}{
 		header.ParentHash,
 		header.UncleHash,
 		header.Coinbase,
@@ -167,8 +187,9 @@ func sigHash(header *types.Header) (hash common.Hash) {
 		header.MixDigest,
 		header.Nonce,
 	})
-	hasher.Sum(hash[:0])
-	return hash
+	if err != nil {
+		panic("can't encode: " + err.Error())
+	}
 }
 
 // ecrecover extracts the etsc account address from a signed header.
@@ -646,7 +667,7 @@ func (c *Clique) Seal(chain consensus.ChainReader, block *types.Block, results c
 		log.Trace("Out-of-turn signing requested", "wiggle", common.PrettyDuration(wiggle))
 	}
 	// Sign all the things!
-	sighash, err := signFn(accounts.Account{Address: signer}, sigHash(header).Bytes())
+	sighash, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeClique, CliqueRLP(header))
 	if err != nil {
 		return err
 	}
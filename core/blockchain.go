@@ -71,6 +71,9 @@ type CacheConfig struct {
 	Disabled      bool          // Whetsc to disable trie write caching (archive node)
 	TrieNodeLimit int           // Memory limit (MB) at which to flush the current in-memory trie to disk
 	TrieTimeLimit time.Duration // Time limit after which to flush the current in-memory trie to disk
+
+	StateDiffs         bool   // Whether to record and persist the state diff of every imported block
+	StateDiffRetention uint64 // Number of recent blocks to retain state diffs for (0 = keep all)
 }
 
 // BlockChain represents the canonical chain given a database with a genesis
@@ -101,6 +104,7 @@ type BlockChain struct {
 	chainSideFeed event.Feed
 	chainHeadFeed event.Feed
 	logsFeed      event.Feed
+	stateDiffFeed event.Feed
 	scope         event.SubscriptionScope
 	genesisBlock  *types.Block
 
@@ -622,6 +626,21 @@ func (bc *BlockChain) GetReceiptsByHash(hash common.Hash) types.Receipts {
 	return receipts
 }
 
+// RecordsStateDiffs returns whether the state diffs of imported blocks are
+// recorded and persisted.
+func (bc *BlockChain) RecordsStateDiffs() bool {
+	return bc.cacheConfig.StateDiffs
+}
+
+// GetStateDiffByHash retrieves the state diff recorded for a canonical block.
+func (bc *BlockChain) GetStateDiffByHash(hash common.Hash) *types.StateDiff {
+	number := rawdb.ReadHeaderNumber(bc.db, hash)
+	if number == nil || rawdb.ReadCanonicalHash(bc.db, *number) != hash {
+		return nil
+	}
+	return rawdb.ReadStateDiff(bc.db, hash, *number)
+}
+
 // GetBlocksFromHash returns the block corresponding to hash and up to n-1 ancestors.
 // [deprecated by etsc/62]
 func (bc *BlockChain) GetBlocksFromHash(hash common.Hash, n int) (blocks []*types.Block) {
@@ -1008,6 +1027,10 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 	} else {
 		status = SideStatTy
 	}
+	// Persist the state diff of side blocks too, in case they become canonical later
+	if diff := state.Diff(); diff != nil && bc.cacheConfig.StateDiffs {
+		bc.writeStateDiff(batch, block, diff)
+	}
 	if err := batch.Write(); err != nil {
 		return NonStatTy, err
 	}
@@ -1020,6 +1043,34 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 	return status, nil
 }
 
+// writeStateDiff stores the state diff of a new block and prunes the ones of all
+// the blocks falling out of the retention window.
+func (bc *BlockChain) writeStateDiff(db etscdb.Putter, block *types.Block, diff *types.StateDiff) {
+	number, hash := block.NumberU64(), block.Hash()
+
+	retention := bc.cacheConfig.StateDiffRetention
+	if retention > 0 && number+retention <= bc.CurrentBlock().NumberU64() {
+		return // Side block already outside the retention window
+	}
+	rawdb.WriteStateDiff(db, hash, number, diff)
+
+	hashes := rawdb.ReadStateDiffHashes(bc.db, number)
+	for _, known := range hashes {
+		if known == hash {
+			return
+		}
+	}
+	rawdb.WriteStateDiffHashes(db, number, append(hashes, hash))
+
+	if retention > 0 && number > retention {
+		number -= retention
+		for _, hash := range rawdb.ReadStateDiffHashes(bc.db, number) {
+			rawdb.DeleteStateDiff(bc.db, hash, number)
+		}
+		rawdb.DeleteStateDiffHashes(bc.db, number)
+	}
+}
+
 // InsertChain attempts to insert the given batch of blocks in to the canonical
 // chain or, otherwise, create a fork. If an error is returned it will return
 // the index number of the failing block as well an error describing what went
@@ -1174,6 +1225,9 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 		if err != nil {
 			return i, events, coalescedLogs, err
 		}
+		if bc.cacheConfig.StateDiffs {
+			state.RecordDiff()
+		}
 		// Process block using the parent state as reference point.
 		receipts, logs, usedGas, err := bc.processor.Process(block, state, bc.vmConfig)
 		if err != nil {
@@ -1201,6 +1255,9 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 			coalescedLogs = append(coalescedLogs, logs...)
 			blockInsertTimer.UpdateSince(bstart)
 			events = append(events, ChainEvent{block, block.Hash(), logs})
+			if diff := state.Diff(); diff != nil {
+				events = append(events, StateDiffEvent{block, diff})
+			}
 			lastCanon = block
 
 			// Only count canonical blocks for GC processing time
@@ -1382,6 +1439,22 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 	}
 	batch.Write()
 
+	// Announce the state diffs of the new canonical blocks, except the new head
+	// which is announced by the caller. They are sent synchronously, so that
+	// subscribers see them in order and before the state diff of the head.
+	if bc.cacheConfig.StateDiffs {
+		for i := len(newChain) - 1; i > 0; i-- {
+			diff := rawdb.ReadStateDiff(bc.db, newChain[i].Hash(), newChain[i].NumberU64())
+			if diff == nil {
+				if retention := bc.cacheConfig.StateDiffRetention; retention > 0 && newChain[i].NumberU64()+retention <= newChain[0].NumberU64() {
+					continue // Pruned, outside the retention window
+				}
+				log.Error("State diff of reorged block missing", "number", newChain[i].Number(), "hash", newChain[i].Hash())
+				continue
+			}
+			bc.stateDiffFeed.Send(StateDiffEvent{newChain[i], diff})
+		}
+	}
 	if len(deletedLogs) > 0 {
 		go bc.rmLogsFeed.Send(RemovedLogsEvent{deletedLogs})
 	}
@@ -1414,6 +1487,9 @@ func (bc *BlockChain) PostChainEvents(events []interface{}, logs []*types.Log) {
 
 		case ChainSideEvent:
 			bc.chainSideFeed.Send(ev)
+
+		case StateDiffEvent:
+			bc.stateDiffFeed.Send(ev)
 		}
 	}
 }
@@ -1611,3 +1687,8 @@ func (bc *BlockChain) SubscribeChainSideEvent(ch chan<- ChainSideEvent) event.Su
 func (bc *BlockChain) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
 	return bc.scope.Track(bc.logsFeed.Subscribe(ch))
 }
+
+// SubscribeStateDiffEvent registers a subscription of StateDiffEvent.
+func (bc *BlockChain) SubscribeStateDiffEvent(ch chan<- StateDiffEvent) event.Subscription {
+	return bc.scope.Track(bc.stateDiffFeed.Subscribe(ch))
+}
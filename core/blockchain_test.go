@@ -1373,6 +1373,163 @@ func TestLargeReorgTrieGC(t *testing.T) {
 	}
 }
 
+// Tests that the state diffs of canonical blocks are recorded, pruned beyond
+// the retention window and follow the canonical chain across reorgs.
+func TestStateDiffs(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		funds   = big.NewInt(1000000000)
+		theAddr = common.Address{1}
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{address: {Balance: funds}}}
+		engine  = etschash.NewFaker()
+		signer  = types.NewEIP155Signer(gspec.Config.ChainID)
+	)
+	db := etscdb.NewMemDatabase()
+	genesis := gspec.MustCommit(db)
+
+	transfer := func(i int, block *BlockGen) {
+		block.SetCoinbase(common.Address{0xaa})
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), theAddr, big.NewInt(1000), params.TxGas, nil, nil), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.AddTx(tx)
+	}
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 4, transfer)
+	forks, _ := GenerateChain(gspec.Config, blocks[1], engine, db, 3, func(i int, block *BlockGen) {
+		block.SetCoinbase(common.Address{0xbb})
+	})
+
+	diskdb := etscdb.NewMemDatabase()
+	gspec.MustCommit(diskdb)
+
+	chain, err := NewBlockChain(diskdb, &CacheConfig{StateDiffs: true, StateDiffRetention: 2}, gspec.Config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	diffs := make(chan StateDiffEvent, len(blocks))
+	sub := chain.SubscribeStateDiffEvent(diffs)
+	defer sub.Unsubscribe()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// Ensure the diffs beyond the retention window have been pruned
+	for i, block := range blocks {
+		diff := chain.GetStateDiffByHash(block.Hash())
+		if pruned := i < len(blocks)-2; pruned != (diff == nil) {
+			t.Errorf("block %d: diff presence mismatch: have %v, want %v", block.NumberU64(), diff != nil, !pruned)
+		}
+	}
+	// Ensure the diff of the head block contains the transfer
+	diff := chain.GetStateDiffByHash(blocks[3].Hash())
+	if diff == nil {
+		t.Fatalf("head diff missing")
+	}
+	var recipient *types.AccountDiff
+	for _, account := range diff.Accounts {
+		if account.Address == theAddr {
+			recipient = account
+		}
+	}
+	if recipient == nil {
+		t.Fatalf("recipient missing from diff")
+	}
+	if recipient.PrevBalance.Cmp(big.NewInt(3000)) != 0 || recipient.Balance.Cmp(big.NewInt(4000)) != 0 {
+		t.Errorf("recipient balance mismatch: have %v -> %v, want 3000 -> 4000", recipient.PrevBalance, recipient.Balance)
+	}
+	for i := range blocks {
+		select {
+		case ev := <-diffs:
+			if ev.Block.Hash() != blocks[i].Hash() {
+				t.Errorf("event %d: block mismatch: have %x, want %x", i, ev.Block.Hash(), blocks[i].Hash())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d: timed out", i)
+		}
+	}
+	// Reorg to the longer fork and ensure the diffs follow the canonical chain
+	if _, err := chain.InsertChain(forks); err != nil {
+		t.Fatalf("failed to insert fork: %v", err)
+	}
+	for _, block := range blocks[2:] {
+		if chain.GetStateDiffByHash(block.Hash()) != nil {
+			t.Errorf("block %d: reorged diff still available", block.NumberU64())
+		}
+	}
+	for _, block := range forks[1:] {
+		if chain.GetStateDiffByHash(block.Hash()) == nil {
+			t.Errorf("fork block %d: diff missing", block.NumberU64())
+		}
+	}
+	// Ensure the diffs of the dropped blocks are kept within the retention window
+	// and pruned beyond it, together with the ones of the side blocks
+	if rawdb.ReadStateDiff(diskdb, blocks[3].Hash(), blocks[3].NumberU64()) == nil {
+		t.Errorf("block %d: reorged diff not persisted", blocks[3].NumberU64())
+	}
+	for _, block := range []*types.Block{blocks[2], forks[0]} {
+		if rawdb.ReadStateDiff(diskdb, block.Hash(), block.NumberU64()) != nil {
+			t.Errorf("block %x: diff not pruned", block.Hash())
+		}
+	}
+}
+
+// Tests that the state diffs of side blocks are persisted, so that reorgs deeper
+// than any in-memory cache still announce the diffs of the new canonical blocks.
+func TestStateDiffsDeepReorg(t *testing.T) {
+	var (
+		gspec  = &Genesis{Config: params.TestChainConfig}
+		engine = etschash.NewFaker()
+	)
+	db := etscdb.NewMemDatabase()
+	genesis := gspec.MustCommit(db)
+
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 300, func(i int, block *BlockGen) {
+		block.SetCoinbase(common.Address{0xaa})
+	})
+	forks, _ := GenerateChain(gspec.Config, genesis, engine, db, 301, func(i int, block *BlockGen) {
+		block.SetCoinbase(common.Address{0xbb})
+	})
+	diskdb := etscdb.NewMemDatabase()
+	gspec.MustCommit(diskdb)
+
+	chain, err := NewBlockChain(diskdb, &CacheConfig{StateDiffs: true}, gspec.Config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	diffs := make(chan StateDiffEvent, len(forks))
+	sub := chain.SubscribeStateDiffEvent(diffs)
+	defer sub.Unsubscribe()
+
+	if _, err := chain.InsertChain(forks); err != nil {
+		t.Fatalf("failed to insert fork: %v", err)
+	}
+	for i, block := range forks {
+		if chain.GetStateDiffByHash(block.Hash()) == nil {
+			t.Errorf("fork block %d: diff missing", i)
+		}
+	}
+	// Ensure the diffs are announced in order, the ancestors before the new head
+	for i := range forks {
+		select {
+		case ev := <-diffs:
+			if ev.Block.Hash() != forks[i].Hash() {
+				t.Fatalf("event %d: block mismatch: have %x, want %x", i, ev.Block.Hash(), forks[i].Hash())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d: timed out", i)
+		}
+	}
+}
+
 // Benchmarks large blocks with value transfers to non-existing accounts
 func benchmarkLargeNumberOfValueToNonexisting(b *testing.B, numTxs, numBlocks int, recipientFn func(uint64) common.Address, dataFn func(uint64) []byte) {
 	var (
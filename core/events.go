@@ -46,3 +46,10 @@ type ChainSideEvent struct {
 }
 
 type ChainHeadEvent struct{ Block *types.Block }
+
+// StateDiffEvent is posted when a block becomes canonical, carrying the changes
+// its execution did to the state.
+type StateDiffEvent struct {
+	Block *types.Block
+	Diff  *types.StateDiff
+}
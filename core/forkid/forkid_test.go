@@ -0,0 +1,185 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package forkid
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/core"
+	"github.com/ETSC3259/etsc/params"
+	"github.com/ETSC3259/etsc/rlp"
+)
+
+// TestCreation tests that different genesis and fork rule combinations result in
+// the correct fork ID.
+func TestCreation(t *testing.T) {
+	type testcase struct {
+		head uint64
+		want ID
+	}
+	tests := []struct {
+		name    string
+		config  *params.ChainConfig
+		genesis common.Hash
+		cases   []testcase
+	}{
+		// Mainnet test cases
+		{
+			"mainnet",
+			params.MainnetChainConfig,
+			core.DefaultGenesisBlock().ToBlock(nil).Hash(),
+			[]testcase{
+				{0, ID{Hash: checksumToBytes(0x090ba2cb), Next: 1}},       // Unsynced
+				{1, ID{Hash: checksumToBytes(0x820ae46b), Next: 2}},       // Homestead
+				{2, ID{Hash: checksumToBytes(0x9bff4038), Next: 3}},       // EIP150
+				{3, ID{Hash: checksumToBytes(0xac1a0eaf), Next: 4}},       // EIP155 and EIP158
+				{4, ID{Hash: checksumToBytes(0x5687c667), Next: 0}},       // Byzantium
+				{1000000, ID{Hash: checksumToBytes(0x5687c667), Next: 0}}, // Future Byzantium block
+			},
+		},
+		// Testnet test cases
+		{
+			"testnet",
+			params.TestnetChainConfig,
+			params.TestnetGenesisHash,
+			[]testcase{
+				{0, ID{Hash: checksumToBytes(0x30c7ddbc), Next: 10}},            // Unsynced, homestead and EIP150 at genesis
+				{9, ID{Hash: checksumToBytes(0x30c7ddbc), Next: 10}},            // Last pre EIP155 block
+				{10, ID{Hash: checksumToBytes(0x63760190), Next: 1700000}},      // First EIP155 and EIP158 block
+				{1699999, ID{Hash: checksumToBytes(0x63760190), Next: 1700000}}, // Last pre Byzantium block
+				{1700000, ID{Hash: checksumToBytes(0x3ea159c7), Next: 4230000}}, // First Byzantium block
+				{4229999, ID{Hash: checksumToBytes(0x3ea159c7), Next: 4230000}}, // Last pre Constantinople block
+				{4230000, ID{Hash: checksumToBytes(0x97b544f3), Next: 0}},       // First Constantinople block
+				{5000000, ID{Hash: checksumToBytes(0x97b544f3), Next: 0}},       // Future Constantinople block
+			},
+		},
+		// Rinkeby test cases
+		{
+			"rinkeby",
+			params.RinkebyChainConfig,
+			params.RinkebyGenesisHash,
+			[]testcase{
+				{0, ID{Hash: checksumToBytes(0x3b8e0691), Next: 1}},             // Unsynced, last Frontier block
+				{1, ID{Hash: checksumToBytes(0x60949295), Next: 2}},             // First and last Homestead block
+				{2, ID{Hash: checksumToBytes(0x8bde40dd), Next: 3}},             // First and last EIP150 block
+				{3, ID{Hash: checksumToBytes(0xcb3a64bb), Next: 1035301}},       // First EIP155 and EIP158 block
+				{1035300, ID{Hash: checksumToBytes(0xcb3a64bb), Next: 1035301}}, // Last pre Byzantium block
+				{1035301, ID{Hash: checksumToBytes(0x8d748b57), Next: 0}},       // First Byzantium block
+				{4000000, ID{Hash: checksumToBytes(0x8d748b57), Next: 0}},       // Future Byzantium block
+			},
+		},
+	}
+	for _, tt := range tests {
+		for j, ttt := range tt.cases {
+			if have := newID(tt.config, tt.genesis, ttt.head); have != ttt.want {
+				t.Errorf("%s test %d: fork ID mismatch: have %x, want %x", tt.name, j, have, ttt.want)
+			}
+		}
+	}
+}
+
+// TestValidation tests that a local peer correctly validates and accepts a remote
+// fork ID.
+func TestValidation(t *testing.T) {
+	tests := []struct {
+		head uint64
+		id   ID
+		err  error
+	}{
+		// Local is at genesis, remote announces the same. No future fork is announced.
+		{0, ID{Hash: checksumToBytes(0x30c7ddbc), Next: 0}, nil},
+
+		// Local is at genesis, remote announces the same. Remote also announces the
+		// next fork at block 10, which we know about too.
+		{0, ID{Hash: checksumToBytes(0x30c7ddbc), Next: 10}, nil},
+
+		// Local is fully synced, remote announces the same. No future fork is announced.
+		{4230000, ID{Hash: checksumToBytes(0x97b544f3), Next: 0}, nil},
+
+		// Local is fully synced, remote announces the same. Remote also announces a
+		// future fork we don't know about yet.
+		{4230000, ID{Hash: checksumToBytes(0x97b544f3), Next: 9000000}, nil},
+
+		// Local is on Byzantium, remote announces the same and the upcoming
+		// Constantinople we also know about.
+		{1700000, ID{Hash: checksumToBytes(0x3ea159c7), Next: 4230000}, nil},
+
+		// Local is on Byzantium, remote announces the same but a future fork at a block
+		// we have already passed without forking. Chains are incompatible.
+		{4000000, ID{Hash: checksumToBytes(0x3ea159c7), Next: 3000000}, ErrLocalIncompatibleOrStale},
+
+		// Local is fully synced, remote is on Byzantium and knows about Constantinople.
+		// Remote is simply out of sync, accept.
+		{4230000, ID{Hash: checksumToBytes(0x3ea159c7), Next: 4230000}, nil},
+
+		// Local is fully synced, remote is on EIP158 and knows about Byzantium.
+		// Remote is simply out of sync, accept.
+		{4230000, ID{Hash: checksumToBytes(0x63760190), Next: 1700000}, nil},
+
+		// Local is fully synced, remote is on Byzantium but doesn't know about
+		// Constantinople. Remote needs a software update.
+		{4230000, ID{Hash: checksumToBytes(0x3ea159c7), Next: 0}, ErrRemoteStale},
+
+		// Local is fully synced, remote is on EIP158 but announces a different next
+		// fork. Remote needs a software update.
+		{4230000, ID{Hash: checksumToBytes(0x63760190), Next: 1800000}, ErrRemoteStale},
+
+		// Local is on Byzantium, remote is on Constantinople. Local is out of sync,
+		// accept.
+		{1700000, ID{Hash: checksumToBytes(0x97b544f3), Next: 0}, nil},
+
+		// Local is at genesis, remote is fully synced. Local is out of sync, accept.
+		{0, ID{Hash: checksumToBytes(0x97b544f3), Next: 0}, nil},
+
+		// Remote is on a mainnet fork, chains are incompatible.
+		{4230000, ID{Hash: checksumToBytes(0x5687c667), Next: 0}, ErrLocalIncompatibleOrStale},
+
+		// Remote announces a random checksum, chains are incompatible.
+		{4230000, ID{Hash: checksumToBytes(0xdeadbeef), Next: 0}, ErrLocalIncompatibleOrStale},
+	}
+	for i, tt := range tests {
+		filter := newFilter(params.TestnetChainConfig, params.TestnetGenesisHash, func() uint64 { return tt.head })
+		if err := filter(tt.id); err != tt.err {
+			t.Errorf("test %d: validation error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+// Tests that IDs are properly RLP encoded.
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		id   ID
+		want []byte
+	}{
+		{ID{Hash: checksumToBytes(0), Next: 0}, common.Hex2Bytes("c6840000000080")},
+		{ID{Hash: checksumToBytes(0xdeadbeef), Next: 0xBADDCAFE}, common.Hex2Bytes("ca84deadbeef84baddcafe")},
+		{ID{Hash: checksumToBytes(math.MaxUint32), Next: math.MaxUint64}, common.Hex2Bytes("ce84ffffffff88ffffffffffffffff")},
+	}
+	for i, tt := range tests {
+		have, err := rlp.EncodeToBytes(tt.id)
+		if err != nil {
+			t.Errorf("test %d: failed to encode forkid: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(have, tt.want) {
+			t.Errorf("test %d: RLP mismatch: have %x, want %x", i, have, tt.want)
+		}
+	}
+}
@@ -315,6 +315,73 @@ func DeleteReceipts(db DatabaseDeleter, hash common.Hash, number uint64) {
 	}
 }
 
+// ReadStateDiff retrieves the state diff recorded for a block.
+func ReadStateDiff(db DatabaseReader, hash common.Hash, number uint64) *types.StateDiff {
+	data, _ := db.Get(stateDiffKey(number, hash))
+	if len(data) == 0 {
+		return nil
+	}
+	diff := new(types.StateDiff)
+	if err := rlp.DecodeBytes(data, diff); err != nil {
+		log.Error("Invalid state diff RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return diff
+}
+
+// WriteStateDiff stores the state diff recorded for a block.
+func WriteStateDiff(db DatabaseWriter, hash common.Hash, number uint64, diff *types.StateDiff) {
+	data, err := rlp.EncodeToBytes(diff)
+	if err != nil {
+		log.Crit("Failed to RLP encode state diff", "err", err)
+	}
+	if err := db.Put(stateDiffKey(number, hash), data); err != nil {
+		log.Crit("Failed to store state diff", "err", err)
+	}
+}
+
+// DeleteStateDiff removes the state diff recorded for a block.
+func DeleteStateDiff(db DatabaseDeleter, hash common.Hash, number uint64) {
+	if err := db.Delete(stateDiffKey(number, hash)); err != nil {
+		log.Crit("Failed to delete state diff", "err", err)
+	}
+}
+
+// ReadStateDiffHashes retrieves the hashes of all the blocks, canonical or not,
+// with a state diff recorded at a certain height.
+func ReadStateDiffHashes(db DatabaseReader, number uint64) []common.Hash {
+	data, _ := db.Get(stateDiffHashesKey(number))
+	if len(data) == 0 {
+		return nil
+	}
+	var hashes []common.Hash
+	if err := rlp.DecodeBytes(data, &hashes); err != nil {
+		log.Error("Invalid state diff hashes RLP", "number", number, "err", err)
+		return nil
+	}
+	return hashes
+}
+
+// WriteStateDiffHashes stores the hashes of the blocks with a state diff recorded
+// at a certain height.
+func WriteStateDiffHashes(db DatabaseWriter, number uint64, hashes []common.Hash) {
+	data, err := rlp.EncodeToBytes(hashes)
+	if err != nil {
+		log.Crit("Failed to RLP encode state diff hashes", "err", err)
+	}
+	if err := db.Put(stateDiffHashesKey(number), data); err != nil {
+		log.Crit("Failed to store state diff hashes", "err", err)
+	}
+}
+
+// DeleteStateDiffHashes removes the hashes of the blocks with a state diff
+// recorded at a certain height.
+func DeleteStateDiffHashes(db DatabaseDeleter, number uint64) {
+	if err := db.Delete(stateDiffHashesKey(number)); err != nil {
+		log.Crit("Failed to delete state diff hashes", "err", err)
+	}
+}
+
 // ReadBlock retrieves an entire block corresponding to the hash, assembling it
 // back from the stored header and body. If either the header or body could not
 // be retrieved nil is returned.
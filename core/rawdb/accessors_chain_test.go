@@ -19,6 +19,7 @@ package rawdb
 import (
 	"bytes"
 	"math/big"
+	"reflect"
 	"testing"
 
 	"github.com/ETSC3259/etsc/common"
@@ -317,3 +318,56 @@ func TestBlockReceiptStorage(t *testing.T) {
 		t.Fatalf("deleted receipts returned: %v", rs)
 	}
 }
+
+// Tests that block state diffs can be stored, retrieved and deleted.
+func TestStateDiffStorage(t *testing.T) {
+	db := etscdb.NewMemDatabase()
+
+	diff := &types.StateDiff{
+		Accounts: []*types.AccountDiff{
+			{
+				Address:     common.BytesToAddress([]byte{0x11}),
+				PrevBalance: big.NewInt(1),
+				Balance:     big.NewInt(2),
+				Nonce:       1,
+				Storage:     []*types.StorageDiff{{Key: common.Hash{0x01}, Value: common.Hash{0x02}}},
+			},
+			{
+				Address:     common.BytesToAddress([]byte{0x22}),
+				Deleted:     true,
+				PrevBalance: big.NewInt(3),
+				Balance:     new(big.Int),
+			},
+		},
+	}
+	hash := common.BytesToHash([]byte{0x03, 0x14})
+	if d := ReadStateDiff(db, hash, 1); d != nil {
+		t.Fatalf("non existent state diff returned: %v", d)
+	}
+	// Insert the state diff into the database and check presence
+	WriteStateDiff(db, hash, 1, diff)
+	if d := ReadStateDiff(db, hash, 1); d == nil {
+		t.Fatalf("no state diff returned")
+	} else {
+		rlpHave, _ := rlp.EncodeToBytes(d)
+		rlpWant, _ := rlp.EncodeToBytes(diff)
+		if !bytes.Equal(rlpHave, rlpWant) {
+			t.Fatalf("state diff mismatch: have %v, want %v", d, diff)
+		}
+	}
+	// Delete the state diff and check purge
+	DeleteStateDiff(db, hash, 1)
+	if d := ReadStateDiff(db, hash, 1); d != nil {
+		t.Fatalf("deleted state diff returned: %v", d)
+	}
+	// Track the blocks with diffs at the height and check purge
+	hashes := []common.Hash{hash, {0x15}}
+	WriteStateDiffHashes(db, 1, hashes)
+	if have := ReadStateDiffHashes(db, 1); !reflect.DeepEqual(have, hashes) {
+		t.Fatalf("state diff hashes mismatch: have %v, want %v", have, hashes)
+	}
+	DeleteStateDiffHashes(db, 1)
+	if have := ReadStateDiffHashes(db, 1); have != nil {
+		t.Fatalf("deleted state diff hashes returned: %v", have)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/rlp"
+)
+
+// diffRecorder accumulates the changes done to the state across finalisations,
+// tracking the original value of every field on its first change and its latest
+// value on every subsequent one.
+type diffRecorder struct {
+	accounts map[common.Address]*types.AccountDiff
+	existed  map[common.Address]bool
+	storage  map[common.Address]map[common.Hash]*types.StorageDiff
+}
+
+func newDiffRecorder() *diffRecorder {
+	return &diffRecorder{
+		accounts: make(map[common.Address]*types.AccountDiff),
+		existed:  make(map[common.Address]bool),
+		storage:  make(map[common.Address]map[common.Hash]*types.StorageDiff),
+	}
+}
+
+// copy creates a deep, independent copy of the recorder.
+func (r *diffRecorder) copy() *diffRecorder {
+	cpy := newDiffRecorder()
+	for addr, account := range r.accounts {
+		acc := *account
+		acc.PrevBalance, acc.Balance = new(big.Int).Set(account.PrevBalance), new(big.Int).Set(account.Balance)
+		cpy.accounts[addr] = &acc
+	}
+	for addr, existed := range r.existed {
+		cpy.existed[addr] = existed
+	}
+	for addr, slots := range r.storage {
+		cpy.storage[addr] = make(map[common.Hash]*types.StorageDiff, len(slots))
+		for key, slot := range slots {
+			diff := *slot
+			cpy.storage[addr][key] = &diff
+		}
+	}
+	return cpy
+}
+
+// capture records the changes of a dirty state object about to be finalised.
+// Since the account trie is only updated after this, it still holds the value
+// of the account prior to the changes.
+func (r *diffRecorder) capture(s *StateDB, obj *stateObject, deleted bool) {
+	addr := obj.address
+
+	account := r.accounts[addr]
+	if account == nil {
+		account = &types.AccountDiff{
+			Address:      addr,
+			PrevBalance:  new(big.Int),
+			PrevCodeHash: emptyCode,
+		}
+		if enc, err := s.trie.TryGet(addr[:]); err == nil && len(enc) > 0 {
+			var data Account
+			if err := rlp.DecodeBytes(enc, &data); err == nil {
+				account.PrevNonce = data.Nonce
+				account.PrevBalance = data.Balance
+				account.PrevCodeHash = common.BytesToHash(data.CodeHash)
+				r.existed[addr] = true
+			}
+		}
+		r.accounts[addr] = account
+		r.storage[addr] = make(map[common.Hash]*types.StorageDiff)
+	}
+	for key, value := range obj.dirtyStorage {
+		slot := r.storage[addr][key]
+		if slot == nil {
+			slot = &types.StorageDiff{Key: key, Prev: obj.GetCommittedState(s.db, key)}
+			r.storage[addr][key] = slot
+		}
+		slot.Value = value
+	}
+	if account.Deleted = deleted; deleted {
+		account.Nonce, account.Balance, account.CodeHash = 0, new(big.Int), emptyCode
+	} else {
+		account.Nonce, account.Balance, account.CodeHash = obj.data.Nonce, new(big.Int).Set(obj.data.Balance), common.BytesToHash(obj.data.CodeHash)
+	}
+}
+
+// diff assembles the recorded changes, dropping all accounts and storage slots
+// that ended up with their original values.
+func (r *diffRecorder) diff() *types.StateDiff {
+	diff := new(types.StateDiff)
+	for addr, account := range r.accounts {
+		cpy := *account
+		cpy.Storage = nil
+		for _, slot := range r.storage[addr] {
+			if slot.Prev != slot.Value {
+				cpy.Storage = append(cpy.Storage, &types.StorageDiff{Key: slot.Key, Prev: slot.Prev, Value: slot.Value})
+			}
+		}
+		sort.Sort(storageDiffsByKey(cpy.Storage))
+
+		unchanged := cpy.PrevNonce == cpy.Nonce && cpy.PrevBalance.Cmp(cpy.Balance) == 0 && cpy.PrevCodeHash == cpy.CodeHash
+		if cpy.Deleted && !r.existed[addr] {
+			continue
+		}
+		if !cpy.Deleted && unchanged && len(cpy.Storage) == 0 {
+			continue
+		}
+		diff.Accounts = append(diff.Accounts, &cpy)
+	}
+	sort.Sort(accountDiffsByAddress(diff.Accounts))
+	return diff
+}
+
+// accountDiffsByAddress implements sort.Interface to order account diffs.
+type accountDiffsByAddress []*types.AccountDiff
+
+func (s accountDiffsByAddress) Len() int      { return len(s) }
+func (s accountDiffsByAddress) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s accountDiffsByAddress) Less(i, j int) bool {
+	return bytes.Compare(s[i].Address[:], s[j].Address[:]) < 0
+}
+
+// storageDiffsByKey implements sort.Interface to order storage slot diffs.
+type storageDiffsByKey []*types.StorageDiff
+
+func (s storageDiffsByKey) Len() int           { return len(s) }
+func (s storageDiffsByKey) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s storageDiffsByKey) Less(i, j int) bool { return bytes.Compare(s[i].Key[:], s[j].Key[:]) < 0 }
+
+// RecordDiff starts accumulating the changes done to the state at every
+// finalisation, to be retrieved via Diff. Copies of the state carry on with the
+// changes recorded so far.
+func (self *StateDB) RecordDiff() {
+	self.diff = newDiffRecorder()
+}
+
+// Diff returns the changes finalised since the diff recording was started, or
+// nil if it wasn't.
+func (self *StateDB) Diff() *types.StateDiff {
+	if self.diff == nil {
+		return nil
+	}
+	return self.diff.diff()
+}
@@ -86,6 +86,9 @@ type StateDB struct {
 	journal        *journal
 	validRevisions []revision
 	nextRevisionId int
+
+	// Changes accumulated across finalisations, if recording is enabled.
+	diff *diffRecorder
 }
 
 // Create a new state from a given trie.
@@ -312,6 +315,27 @@ func (self *StateDB) HasSuicided(addr common.Address) bool {
 	return false
 }
 
+// DirtyAccounts returns the addresses of all the accounts touched since the
+// state was last finalised. Reverted changes may still leave an account listed.
+func (self *StateDB) DirtyAccounts() []common.Address {
+	addrs := make([]common.Address, 0, len(self.journal.dirties))
+	for addr := range self.journal.dirties {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// DirtyStorage returns the storage slots of an account written since the state
+// was last finalised, along with their current values. The return value is a
+// copy and is nil for non-existent accounts.
+func (self *StateDB) DirtyStorage(addr common.Address) Storage {
+	stateObject := self.getStateObject(addr)
+	if stateObject == nil {
+		return nil
+	}
+	return stateObject.dirtyStorage.Copy()
+}
+
 /*
  * SETTERS
  */
@@ -536,6 +560,9 @@ func (self *StateDB) Copy() *StateDB {
 	for hash, preimage := range self.preimages {
 		state.preimages[hash] = preimage
 	}
+	if self.diff != nil {
+		state.diff = self.diff.copy()
+	}
 	return state
 }
 
@@ -583,7 +610,11 @@ func (s *StateDB) Finalise(deleteEmptyObjects bool) {
 			continue
 		}
 
-		if stateObject.suicided || (deleteEmptyObjects && stateObject.empty()) {
+		deleted := stateObject.suicided || (deleteEmptyObjects && stateObject.empty())
+		if s.diff != nil {
+			s.diff.capture(s, stateObject, deleted)
+		}
+		if deleted {
 			s.deleteStateObject(stateObject)
 		} else {
 			stateObject.updateRoot(s.db)
@@ -19,6 +19,7 @@ package state
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"math"
 	"math/big"
@@ -167,6 +168,108 @@ func TestCopy(t *testing.T) {
 	}
 }
 
+// Tests that the dirty accounts and storage slots tracked since the last state
+// finalisation are correctly reported, and cleared by the finalisation.
+func TestDirtyAccounts(t *testing.T) {
+	state, _ := New(common.Hash{}, NewDatabase(etscdb.NewMemDatabase()))
+
+	var (
+		addr1 = common.BytesToAddress([]byte{0x01})
+		addr2 = common.BytesToAddress([]byte{0x02})
+		key   = common.BytesToHash([]byte{0xff})
+		value = common.BytesToHash([]byte{0xaa})
+	)
+	state.AddBalance(addr1, big.NewInt(1))
+	state.SetState(addr2, key, value)
+
+	dirties := state.DirtyAccounts()
+	if len(dirties) != 2 {
+		t.Fatalf("dirty account count mismatch: have %d, want %d", len(dirties), 2)
+	}
+	if storage := state.DirtyStorage(addr1); len(storage) != 0 {
+		t.Errorf("unexpected dirty storage: %v", storage)
+	}
+	if storage := state.DirtyStorage(addr2); len(storage) != 1 || storage[key] != value {
+		t.Errorf("dirty storage mismatch: have %v, want %v", storage, Storage{key: value})
+	}
+	if storage := state.DirtyStorage(common.Address{}); storage != nil {
+		t.Errorf("non-existent account has dirty storage: %v", storage)
+	}
+	state.Finalise(false)
+
+	if dirties := state.DirtyAccounts(); len(dirties) != 0 {
+		t.Errorf("dirty accounts not cleared: %v", dirties)
+	}
+}
+
+// Tests that state diffs recorded across several finalisations contain the
+// original and final values of all changed fields, and nothing else.
+func TestStateDiffRecording(t *testing.T) {
+	db := NewDatabase(etscdb.NewMemDatabase())
+	state, _ := New(common.Hash{}, db)
+
+	var (
+		addr1 = common.BytesToAddress([]byte{0x01})
+		addr2 = common.BytesToAddress([]byte{0x02})
+		addr3 = common.BytesToAddress([]byte{0x03})
+		key1  = common.BytesToHash([]byte{0x11})
+		key2  = common.BytesToHash([]byte{0x22})
+	)
+	// Create a base state with a few accounts and commit it
+	state.SetBalance(addr1, big.NewInt(10))
+	state.SetState(addr1, key1, common.Hash{0x01})
+	state.SetState(addr1, key2, common.Hash{0x02})
+	state.SetBalance(addr2, big.NewInt(20))
+	root, _ := state.Commit(false)
+
+	state, _ = New(root, db)
+	if diff := state.Diff(); diff != nil {
+		t.Fatalf("diff returned without recording: %v", diff)
+	}
+	state.RecordDiff()
+
+	// Change a few things across two finalisations, reverting some of them
+	state.AddBalance(addr1, big.NewInt(5))
+	state.SetState(addr1, key1, common.Hash{0xaa})
+	state.SetState(addr1, key2, common.Hash{0xbb})
+	state.Suicide(addr2)
+	state.AddBalance(addr3, big.NewInt(0)) // Touch only, no change
+	state.Finalise(true)
+
+	state.SetNonce(addr1, 1)
+	state.SetState(addr1, key1, common.Hash{0xcc})
+	state.SetState(addr1, key2, common.Hash{0x02})
+	state.Finalise(true)
+
+	want := &types.StateDiff{
+		Accounts: []*types.AccountDiff{
+			{
+				Address:      addr1,
+				PrevNonce:    0,
+				Nonce:        1,
+				PrevBalance:  big.NewInt(10),
+				Balance:      big.NewInt(15),
+				PrevCodeHash: emptyCode,
+				CodeHash:     emptyCode,
+				Storage:      []*types.StorageDiff{{Key: key1, Prev: common.Hash{0x01}, Value: common.Hash{0xcc}}},
+			},
+			{
+				Address:      addr2,
+				Deleted:      true,
+				PrevBalance:  big.NewInt(20),
+				Balance:      new(big.Int),
+				PrevCodeHash: emptyCode,
+				CodeHash:     emptyCode,
+			},
+		},
+	}
+	if have := state.Diff(); !reflect.DeepEqual(have, want) {
+		haveJSON, _ := json.MarshalIndent(have, "", "  ")
+		wantJSON, _ := json.MarshalIndent(want, "", "  ")
+		t.Fatalf("state diff mismatch:\nhave %s\nwant %s", haveJSON, wantJSON)
+	}
+}
+
 func TestSnapshotRandom(t *testing.T) {
 	config := &quick.Config{MaxCount: 1000}
 	err := quick.Check((*snapshotTest).run, config)
@@ -0,0 +1,131 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/core/state"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/core/vm"
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/params"
+)
+
+const (
+	// maxBundleTxs is the maximum number of transactions a single bundle may hold.
+	maxBundleTxs = 64
+
+	// maxBundleDistance is the maximum number of blocks ahead of the current head
+	// a bundle may target.
+	maxBundleDistance = 32
+
+	// maxAccountBundles is the maximum number of bundles awaiting inclusion whose
+	// first transaction is sent by the same account.
+	maxAccountBundles = 16
+)
+
+var (
+	// ErrBundleEmpty is returned if a bundle without any transactions is submitted.
+	ErrBundleEmpty = errors.New("empty bundle")
+
+	// ErrBundleOversized is returned if a bundle holds more transactions than
+	// permitted.
+	ErrBundleOversized = errors.New("oversized bundle")
+
+	// ErrBundleStale is returned if a bundle targets a block that is already part
+	// of the local chain.
+	ErrBundleStale = errors.New("bundle targets past block")
+
+	// ErrBundleDistant is returned if a bundle targets a block too far ahead of
+	// the local chain.
+	ErrBundleDistant = errors.New("bundle targets distant block")
+
+	// ErrBundleAccountFull is returned if the sender of a bundle's first
+	// transaction already has the maximum number of bundles awaiting inclusion.
+	ErrBundleAccountFull = errors.New("bundle quota of account exceeded")
+
+	// ErrBundlePoolFull is returned if the maximum number of bundles awaiting
+	// inclusion is reached.
+	ErrBundlePoolFull = errors.New("bundle pool is full")
+
+	// ErrBundleReverted is returned if a transaction of a bundle is executed,
+	// but fails, invalidating the entire bundle.
+	ErrBundleReverted = errors.New("bundle transaction reverted")
+)
+
+// TxBundle is an ordered group of transactions that must be included into a
+// specific block consecutively and atomically: either all of them or none.
+type TxBundle struct {
+	Txs         types.Transactions // Transactions to include, in execution order
+	BlockNumber uint64             // Number of the block the bundle targets
+}
+
+// Hash returns the unique identifier of the bundle, derived from its target
+// block number and the hashes of its transactions.
+func (b *TxBundle) Hash() common.Hash {
+	blob := make([]byte, 8, 8+len(b.Txs)*common.HashLength)
+	binary.BigEndian.PutUint64(blob, b.BlockNumber)
+	for _, tx := range b.Txs {
+		blob = append(blob, tx.Hash().Bytes()...)
+	}
+	return crypto.Keccak256Hash(blob)
+}
+
+// BundleResult is the outcome of applying a bundle on top of some state.
+type BundleResult struct {
+	State    *state.StateDB // State after executing the bundle
+	Receipts types.Receipts // Receipts of the executed transactions
+	GasUsed  uint64         // Total gas used by the executed transactions
+	Profit   *big.Int       // Balance increase of the block author caused by the bundle
+}
+
+// ApplyBundle attempts to apply all the transactions of a bundle in order on top
+// of the given state database, starting at the given transaction index within the
+// block. As the state is finalised after every transaction, the bundle is executed
+// on a copy of the state, returned in the result if all transactions succeed. If
+// any of them cannot be applied or fails execution, an error is returned along
+// with the receipts of the transactions executed until the failure, and the
+// original state, the gas pool and the used gas counter are left untouched.
+func ApplyBundle(config *params.ChainConfig, bc ChainContext, author *common.Address, gp *GasPool, statedb *state.StateDB, header *types.Header, bundle *TxBundle, index int, usedGas *uint64, cfg vm.Config) (*BundleResult, error) {
+	var (
+		gas    = *gp
+		used   = *usedGas
+		result = &BundleResult{State: statedb.Copy()}
+	)
+	for i, tx := range bundle.Txs {
+		result.State.Prepare(tx.Hash(), common.Hash{}, index+i)
+
+		receipt, _, err := ApplyTransaction(config, bc, author, &gas, result.State, header, tx, &used, cfg)
+		if err != nil {
+			return result, err
+		}
+		result.Receipts = append(result.Receipts, receipt)
+
+		if receipt.Status == types.ReceiptStatusFailed {
+			return result, ErrBundleReverted
+		}
+	}
+	result.GasUsed = used - *usedGas
+	result.Profit = new(big.Int).Sub(result.State.GetBalance(*author), statedb.GetBalance(*author))
+
+	*gp, *usedGas = gas, used
+	return result, nil
+}
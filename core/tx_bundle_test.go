@@ -0,0 +1,92 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/core/state"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/core/vm"
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/etscdb"
+	"github.com/ETSC3259/etsc/params"
+)
+
+// Tests that bundles are applied atomically: either all transactions execute
+// successfully, or the state, gas pool and gas counter are left untouched.
+func TestApplyBundle(t *testing.T) {
+	var (
+		key, _   = crypto.GenerateKey()
+		from     = crypto.PubkeyToAddress(key.PublicKey)
+		author   = common.Address{0xaa}
+		reverter = common.Address{0xbb}
+		header   = &types.Header{Number: big.NewInt(1), GasLimit: 1000000, Difficulty: big.NewInt(1), Time: big.NewInt(0)}
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(etscdb.NewMemDatabase()))
+	statedb.AddBalance(from, big.NewInt(1000000000))
+	statedb.SetCode(reverter, []byte{byte(vm.PUSH1), 0x00, byte(vm.DUP1), byte(vm.REVERT)})
+
+	revert, _ := types.SignTx(types.NewTransaction(1, reverter, big.NewInt(0), 100000, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+
+	tests := []struct {
+		bundle   *TxBundle
+		receipts int
+		err      error
+	}{
+		{&TxBundle{Txs: types.Transactions{transaction(0, 100000, key), transaction(2, 100000, key)}}, 1, ErrNonceTooHigh}, // Inapplicable transaction
+		{&TxBundle{Txs: types.Transactions{transaction(0, 100000, key), revert}}, 2, ErrBundleReverted},                    // Failing transaction
+		{&TxBundle{Txs: types.Transactions{transaction(0, 100000, key), transaction(1, 100000, key)}}, 2, nil},             // Valid bundle
+	}
+	for i, tt := range tests {
+		var (
+			root    = statedb.IntermediateRoot(true)
+			gp      = new(GasPool).AddGas(header.GasLimit)
+			gasUsed = uint64(0)
+		)
+		result, err := ApplyBundle(params.TestChainConfig, nil, &author, gp, statedb, header, tt.bundle, 0, &gasUsed, vm.Config{})
+		if err != tt.err {
+			t.Fatalf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+		if len(result.Receipts) != tt.receipts {
+			t.Errorf("test %d: receipt count mismatch: have %d, want %d", i, len(result.Receipts), tt.receipts)
+		}
+		if err != nil {
+			if have := statedb.IntermediateRoot(true); have != root {
+				t.Errorf("test %d: state not reverted: have %x, want %x", i, have, root)
+			}
+			if gp.Gas() != header.GasLimit || gasUsed != 0 {
+				t.Errorf("test %d: gas not reverted: pool %d, used %d", i, gp.Gas(), gasUsed)
+			}
+			continue
+		}
+		if result.GasUsed != 2*params.TxGas || gasUsed != result.GasUsed {
+			t.Errorf("test %d: gas used mismatch: have %d/%d, want %d", i, result.GasUsed, gasUsed, 2*params.TxGas)
+		}
+		if result.Profit.Cmp(new(big.Int).SetUint64(2*params.TxGas)) != 0 {
+			t.Errorf("test %d: profit mismatch: have %v, want %v", i, result.Profit, 2*params.TxGas)
+		}
+		if have := statedb.IntermediateRoot(true); have != root {
+			t.Errorf("test %d: original state modified: have %x, want %x", i, have, root)
+		}
+		if nonce := result.State.GetNonce(from); nonce != 2 {
+			t.Errorf("test %d: nonce mismatch: have %d, want %d", i, nonce, 2)
+		}
+	}
+}
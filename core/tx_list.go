@@ -400,16 +400,30 @@ type txPricedList struct {
 	all    *txLookup  // Pointer to the map of all transactions
 	items  *priceHeap // Heap of prices of all the stored transactions
 	stales int        // Number of stale price points to (re-heap trigger)
+	bump   uint64     // Minimum price bump percentage to displace a transaction
 }
 
 // newTxPricedList creates a new price-sorted transaction heap.
-func newTxPricedList(all *txLookup) *txPricedList {
+func newTxPricedList(all *txLookup, bump uint64) *txPricedList {
 	return &txPricedList{
 		all:   all,
 		items: new(priceHeap),
+		bump:  bump,
 	}
 }
 
+// outbids checks whether a transaction is priced high enough to displace another
+// one, requiring the same minimum price bump as nonce replacements do. This
+// prevents churning the pool by repeatedly outbidding the cheapest transaction
+// by a single wei.
+func (l *txPricedList) outbids(tx *types.Transaction, old *types.Transaction) bool {
+	if old.GasPrice().Cmp(tx.GasPrice()) >= 0 {
+		return false
+	}
+	threshold := new(big.Int).Div(new(big.Int).Mul(old.GasPrice(), big.NewInt(100+int64(l.bump))), big.NewInt(100))
+	return threshold.Cmp(tx.GasPrice()) <= 0
+}
+
 // Put inserts a new transaction into the heap.
 func (l *txPricedList) Put(tx *types.Transaction) {
 	heap.Push(l.items, tx)
@@ -467,7 +481,8 @@ func (l *txPricedList) Cap(threshold *big.Int, local *accountSet) types.Transact
 }
 
 // Underpriced checks whether a transaction is cheaper than (or as cheap as) the
-// lowest priced transaction currently being tracked.
+// lowest priced transaction currently being tracked, or doesn't outbid it by at
+// least the minimum price bump.
 func (l *txPricedList) Underpriced(tx *types.Transaction, local *accountSet) bool {
 	// Local transactions cannot be underpriced
 	if local.containsTx(tx) {
@@ -489,7 +504,42 @@ func (l *txPricedList) Underpriced(tx *types.Transaction, local *accountSet) boo
 		return false
 	}
 	cheapest := []*types.Transaction(*l.items)[0]
-	return cheapest.GasPrice().Cmp(tx.GasPrice()) >= 0
+	return !l.outbids(tx, cheapest)
+}
+
+// Evictable gathers up to limit non-local transactions that the given one outbids
+// by at least the minimum price bump, in no particular order. Contrary to Discard,
+// the heap is only walked, not modified, it being up to the caller to decide
+// which of the candidates to actually drop from the pool.
+//
+// The heap is walked level by level, so the gathered transactions are roughly
+// the cheapest ones of the pool.
+func (l *txPricedList) Evictable(tx *types.Transaction, local *accountSet, limit int) types.Transactions {
+	var (
+		evictable = make(types.Transactions, 0, limit) // Remote transactions cheap enough to drop
+		items     = []*types.Transaction(*l.items)
+		next      = []int{0} // Heap indices left to visit
+	)
+	for len(next) > 0 && len(evictable) < limit {
+		i := next[0]
+		next = next[1:]
+
+		// Children are never cheaper than their parent, so skip the whole subtree
+		// as soon as a transaction isn't outbid anymore
+		if i >= len(items) || !l.outbids(tx, items[i]) {
+			continue
+		}
+		next = append(next, 2*i+1, 2*i+2)
+
+		// Stale transactions are left for the next reheap to clean up
+		if l.all.Get(items[i].Hash()) == nil {
+			continue
+		}
+		if !local.containsTx(items[i]) {
+			evictable = append(evictable, items[i])
+		}
+	}
+	return evictable
 }
 
 // Discard finds a number of most underpriced transactions, removes them from the
@@ -17,6 +17,7 @@
 package core
 
 import (
+	"math/big"
 	"math/rand"
 	"testing"
 
@@ -49,3 +50,55 @@ func TestStrictTxListAdd(t *testing.T) {
 		}
 	}
 }
+
+// Tests that evictable transactions are gathered without disturbing the price
+// heap, skipping stale and local entries, and that no more than requested are.
+func TestPricedListEvictable(t *testing.T) {
+	local, _ := crypto.GenerateKey()
+	remote, _ := crypto.GenerateKey()
+
+	all := newTxLookup()
+	list := newTxPricedList(all, 10)
+	locals := newAccountSet(types.HomesteadSigner{})
+	locals.add(crypto.PubkeyToAddress(local.PublicKey))
+
+	for i := 0; i < 64; i++ {
+		tx := pricedTransaction(uint64(i), 100000, big.NewInt(int64(i+1)), remote)
+		all.Add(tx)
+		list.Put(tx)
+	}
+	for i := 0; i < 4; i++ {
+		tx := pricedTransaction(uint64(i), 100000, big.NewInt(1), local)
+		all.Add(tx)
+		list.Put(tx)
+	}
+	stale := pricedTransaction(64, 100000, big.NewInt(1), remote)
+	list.Put(stale)
+
+	before := append([]*types.Transaction{}, *list.items...)
+
+	// A price of 33 outbids everything up to 30 by at least 10%
+	evictable := list.Evictable(pricedTransaction(0, 100000, big.NewInt(33), remote), locals, 64)
+	if len(evictable) != 30 {
+		t.Fatalf("evictable count mismatch: have %d, want %d", len(evictable), 30)
+	}
+	for _, tx := range evictable {
+		if tx == stale || tx.GasPrice().Int64() > 30 {
+			t.Errorf("unexpected evictable transaction: nonce %d, price %v", tx.Nonce(), tx.GasPrice())
+		}
+	}
+	evictable = list.Evictable(pricedTransaction(0, 100000, big.NewInt(33), remote), locals, 8)
+	if len(evictable) != 8 {
+		t.Fatalf("limited evictable count mismatch: have %d, want %d", len(evictable), 8)
+	}
+	for _, tx := range evictable {
+		if tx == stale || tx.GasPrice().Int64() > 30 {
+			t.Errorf("unexpected limited evictable transaction: nonce %d, price %v", tx.Nonce(), tx.GasPrice())
+		}
+	}
+	for i, tx := range *list.items {
+		if before[i] != tx {
+			t.Fatalf("price heap modified at index %d", i)
+		}
+	}
+}
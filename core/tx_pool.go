@@ -38,6 +38,10 @@ import (
 const (
 	// chainHeadChanSize is the size of channel listening to ChainHeadEvent.
 	chainHeadChanSize = 10
+
+	// evictionSlack is the number of eviction candidates gathered from a full pool
+	// beyond the ones strictly needed, leaving room to choose victims by fairness.
+	evictionSlack = 16
 )
 
 var (
@@ -56,6 +60,15 @@ var (
 	// with a different one without the required price bump.
 	ErrReplaceUnderpriced = errors.New("replacement transaction underpriced")
 
+	// ErrTxPoolOverflow is returned if the transaction pool is full and the
+	// transaction cannot displace any other, since its sender already holds
+	// more than its fair share of the pool.
+	ErrTxPoolOverflow = errors.New("txpool is full")
+
+	// ErrPrivateLaneFull is returned if a new private transaction is added while
+	// the maximum number of private transactions is already reached.
+	ErrPrivateLaneFull = errors.New("private transaction lane is full")
+
 	// ErrInsufficientFunds is returned if the total cost of executing a transaction
 	// is higher than the balance of the user's account.
 	ErrInsufficientFunds = errors.New("insufficient funds for gas * price + value")
@@ -79,8 +92,9 @@ var (
 )
 
 var (
-	evictionInterval    = time.Minute     // Time interval to check for evictable transactions
-	statsReportInterval = 8 * time.Second // Time interval to report transaction pool stats
+	evictionInterval        = time.Minute     // Time interval to check for evictable transactions
+	privateEvictionInterval = time.Second     // Time interval to check for expired private transactions
+	statsReportInterval     = 8 * time.Second // Time interval to report transaction pool stats
 )
 
 var (
@@ -95,10 +109,24 @@ var (
 	queuedReplaceCounter   = metrics.NewRegisteredCounter("txpool/queued/replace", nil)
 	queuedRateLimitCounter = metrics.NewRegisteredCounter("txpool/queued/ratelimit", nil) // Dropped due to rate limiting
 	queuedNofundsCounter   = metrics.NewRegisteredCounter("txpool/queued/nofunds", nil)   // Dropped due to out-of-funds
+	queuedLifetimeCounter  = metrics.NewRegisteredCounter("txpool/queued/lifetime", nil)  // Dropped due to inactivity
+
+	// Metrics for transactions evicted to make room in a full pool
+	evictOverquotaCounter   = metrics.NewRegisteredCounter("txpool/evict/overquota", nil)   // Sender above its fair share
+	evictFutureCounter      = metrics.NewRegisteredCounter("txpool/evict/future", nil)      // Non-executable and outbid
+	evictUnderpricedCounter = metrics.NewRegisteredCounter("txpool/evict/underpriced", nil) // Executable and outbid
+	evictLocalCounter       = metrics.NewRegisteredCounter("txpool/evict/local", nil)       // Displaced by a local transaction
+
+	// Metrics for the private lane
+	privateDiscardCounter  = metrics.NewRegisteredCounter("txpool/private/discard", nil)
+	privateReplaceCounter  = metrics.NewRegisteredCounter("txpool/private/replace", nil)
+	privateExpiredCounter  = metrics.NewRegisteredCounter("txpool/private/expired", nil)  // Dropped due to expiry
+	privateReleasedCounter = metrics.NewRegisteredCounter("txpool/private/released", nil) // Released into the public pool
 
 	// General tx metrics
 	invalidTxCounter     = metrics.NewRegisteredCounter("txpool/invalid", nil)
 	underpricedTxCounter = metrics.NewRegisteredCounter("txpool/underpriced", nil)
+	overflowTxCounter    = metrics.NewRegisteredCounter("txpool/overflow", nil)
 )
 
 // TxStatus is the current status of a transaction as seen by the pool.
@@ -137,6 +165,12 @@ type TxPoolConfig struct {
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
 	Lifetime time.Duration // Maximum amount of time non-executable transaction are queued
+
+	PrivateSlots    uint64        // Maximum number of private transactions kept from the network
+	PrivateLifetime time.Duration // Maximum amount of time private transactions are kept from the network
+	PrivateRelease  bool          // Whether expired private transactions are released into the public pool
+
+	BundleSlots uint64 // Maximum number of transaction bundles awaiting inclusion
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -154,6 +188,11 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	GlobalQueue:  1024,
 
 	Lifetime: 3 * time.Hour,
+
+	PrivateSlots:    1024,
+	PrivateLifetime: 10 * time.Minute,
+
+	BundleSlots: 1024,
 }
 
 // sanitize checks the provided user configurations and changes anything that's
@@ -172,6 +211,18 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 		log.Warn("Sanitizing invalid txpool price bump", "provided", conf.PriceBump, "updated", DefaultTxPoolConfig.PriceBump)
 		conf.PriceBump = DefaultTxPoolConfig.PriceBump
 	}
+	if conf.PrivateSlots < 1 {
+		log.Warn("Sanitizing invalid txpool private slots", "provided", conf.PrivateSlots, "updated", DefaultTxPoolConfig.PrivateSlots)
+		conf.PrivateSlots = DefaultTxPoolConfig.PrivateSlots
+	}
+	if conf.PrivateLifetime < time.Second {
+		log.Warn("Sanitizing invalid txpool private lifetime", "provided", conf.PrivateLifetime, "updated", DefaultTxPoolConfig.PrivateLifetime)
+		conf.PrivateLifetime = DefaultTxPoolConfig.PrivateLifetime
+	}
+	if conf.BundleSlots < 1 {
+		log.Warn("Sanitizing invalid txpool bundle slots", "provided", conf.BundleSlots, "updated", DefaultTxPoolConfig.BundleSlots)
+		conf.BundleSlots = DefaultTxPoolConfig.BundleSlots
+	}
 	return conf
 }
 
@@ -182,17 +233,23 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 // The pool separates processable transactions (which can be applied to the
 // current state) and future transactions. Transactions move between those
 // two states over time as they are received and processed.
+//
+// Aside from the public transactions, the pool also maintains a private lane of
+// locally submitted transactions which are never announced to the network, only
+// offered to the local miner, and a set of transaction bundles to be included
+// atomically into specific blocks by the local miner.
 type TxPool struct {
-	config       TxPoolConfig
-	chainconfig  *params.ChainConfig
-	chain        blockChain
-	gasPrice     *big.Int
-	txFeed       event.Feed
-	scope        event.SubscriptionScope
-	chainHeadCh  chan ChainHeadEvent
-	chainHeadSub event.Subscription
-	signer       types.Signer
-	mu           sync.RWMutex
+	config        TxPoolConfig
+	chainconfig   *params.ChainConfig
+	chain         blockChain
+	gasPrice      *big.Int
+	txFeed        event.Feed
+	privateTxFeed event.Feed
+	scope         event.SubscriptionScope
+	chainHeadCh   chan ChainHeadEvent
+	chainHeadSub  event.Subscription
+	signer        types.Signer
+	mu            sync.RWMutex
 
 	currentState  *state.StateDB      // Current state in the blockchain head
 	pendingState  *state.ManagedState // Pending state tracking virtual nonces
@@ -206,6 +263,9 @@ type TxPool struct {
 	beats   map[common.Address]time.Time // Last heartbeat from each known account
 	all     *txLookup                    // All transactions to allow lookups
 	priced  *txPricedList                // All transactions sorted by price
+	private *txPrivateLane               // Private transactions kept from the network
+	bundles map[common.Hash]*TxBundle    // Transaction bundles awaiting inclusion
+	bundled map[common.Address]int       // Number of pooled bundles per sender of their first transaction
 
 	wg sync.WaitGroup // for shutdown sync
 
@@ -228,6 +288,9 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		queue:       make(map[common.Address]*txList),
 		beats:       make(map[common.Address]time.Time),
 		all:         newTxLookup(),
+		private:     newTxPrivateLane(),
+		bundles:     make(map[common.Hash]*TxBundle),
+		bundled:     make(map[common.Address]int),
 		chainHeadCh: make(chan ChainHeadEvent, chainHeadChanSize),
 		gasPrice:    new(big.Int).SetUint64(config.PriceLimit),
 	}
@@ -236,7 +299,7 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		log.Info("Setting new local account", "address", addr)
 		pool.locals.add(addr)
 	}
-	pool.priced = newTxPricedList(pool.all)
+	pool.priced = newTxPricedList(pool.all, config.PriceBump)
 	pool.reset(nil, chain.CurrentBlock().Header())
 
 	// If local transactions and journaling is enabled, load from disk
@@ -275,6 +338,9 @@ func (pool *TxPool) loop() {
 	evict := time.NewTicker(evictionInterval)
 	defer evict.Stop()
 
+	private := time.NewTicker(privateEvictionInterval)
+	defer private.Stop()
+
 	journal := time.NewTicker(pool.config.Rejournal)
 	defer journal.Stop()
 
@@ -324,11 +390,18 @@ func (pool *TxPool) loop() {
 				if time.Since(pool.beats[addr]) > pool.config.Lifetime {
 					for _, tx := range pool.queue[addr].Flatten() {
 						pool.removeTx(tx.Hash(), true)
+						queuedLifetimeCounter.Inc(1)
 					}
 				}
 			}
 			pool.mu.Unlock()
 
+		// Handle private transaction expiration
+		case <-private.C:
+			pool.mu.Lock()
+			pool.expirePrivate(time.Now())
+			pool.mu.Unlock()
+
 		// Handle local transaction journal rotation
 		case <-journal.C:
 			if pool.journal != nil {
@@ -433,6 +506,18 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	// Check the queue and move transactions over to the pending if possible
 	// or remove those that have become invalid
 	pool.promoteExecutables(nil)
+
+	// Drop all the private transactions that made it into the chain
+	for _, tx := range pool.private.Forward(pool.currentState.GetNonce) {
+		log.Trace("Removed old private transaction", "hash", tx.Hash())
+	}
+	// Drop all the bundles targeting blocks already part of the chain
+	for hash, bundle := range pool.bundles {
+		if bundle.BlockNumber <= newHead.Number.Uint64() {
+			log.Trace("Removed stale transaction bundle", "hash", hash, "number", bundle.BlockNumber)
+			pool.removeBundle(hash)
+		}
+	}
 }
 
 // Stop terminates the transaction pool.
@@ -456,6 +541,13 @@ func (pool *TxPool) SubscribeNewTxsEvent(ch chan<- NewTxsEvent) event.Subscripti
 	return pool.scope.Track(pool.txFeed.Subscribe(ch))
 }
 
+// SubscribePrivateTxsEvent registers a subscription of NewTxsEvent for the
+// transactions entering the private lane and starts sending event to the given
+// channel. These events must never be relayed to the network.
+func (pool *TxPool) SubscribePrivateTxsEvent(ch chan<- NewTxsEvent) event.Subscription {
+	return pool.scope.Track(pool.privateTxFeed.Subscribe(ch))
+}
+
 // GasPrice returns the current gas price enforced by the transaction pool.
 func (pool *TxPool) GasPrice() *big.Int {
 	pool.mu.RLock()
@@ -539,6 +631,22 @@ func (pool *TxPool) Pending() (map[common.Address]types.Transactions, error) {
 	return pending, nil
 }
 
+// PendingPrivate retrieves all private transactions that are processable on top
+// of the public pending ones, grouped by origin account and sorted by nonce. The
+// returned transaction set is a copy and can be freely modified by calling code.
+func (pool *TxPool) PendingPrivate() (map[common.Address]types.Transactions, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pending := make(map[common.Address]types.Transactions)
+	for addr := range pool.private.lists {
+		if txs := pool.private.Ready(addr, pool.pendingState.GetNonce(addr)); len(txs) > 0 {
+			pending[addr] = txs
+		}
+	}
+	return pending, nil
+}
+
 // Locals retrieves the accounts currently considered local by the pool.
 func (pool *TxPool) Locals() []common.Address {
 	pool.mu.Lock()
@@ -629,24 +737,41 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 		invalidTxCounter.Inc(1)
 		return false, err
 	}
-	// If the transaction pool is full, discard underpriced transactions
-	if uint64(pool.all.Count()) >= pool.config.GlobalSlots+pool.config.GlobalQueue {
-		// If the new transaction is underpriced, don't accept it
-		if !local && pool.priced.Underpriced(tx, pool.locals) {
-			log.Trace("Discarding underpriced transaction", "hash", hash, "price", tx.GasPrice())
-			underpricedTxCounter.Inc(1)
-			return false, ErrUnderpriced
-		}
-		// New transaction is better than our worse ones, make room for it
-		drop := pool.priced.Discard(pool.all.Count()-int(pool.config.GlobalSlots+pool.config.GlobalQueue-1), pool.locals)
-		for _, tx := range drop {
-			log.Trace("Discarding freshly underpriced transaction", "hash", tx.Hash(), "price", tx.GasPrice())
-			underpricedTxCounter.Inc(1)
-			pool.removeTx(tx.Hash(), false)
+	from, _ := types.Sender(pool.signer, tx) // already validated
+
+	// If the transaction pool is full, discard underpriced transactions. Replacements
+	// don't need any room, as the transaction they replace is dropped instead.
+	if uint64(pool.all.Count()) >= pool.config.GlobalSlots+pool.config.GlobalQueue && !pool.replaces(from, tx) {
+		overflow := pool.all.Count() - int(pool.config.GlobalSlots+pool.config.GlobalQueue-1)
+
+		if local {
+			// Local transactions may push out any remote one, make room for it
+			drop := pool.priced.Discard(overflow, pool.locals)
+			for _, tx := range drop {
+				log.Trace("Discarding freshly underpriced transaction", "hash", tx.Hash(), "price", tx.GasPrice())
+				evictLocalCounter.Inc(1)
+				pool.removeTx(tx.Hash(), false)
+			}
+		} else {
+			// If the new transaction is underpriced, don't accept it
+			if pool.priced.Underpriced(tx, pool.locals) {
+				log.Trace("Discarding underpriced transaction", "hash", hash, "price", tx.GasPrice())
+				underpricedTxCounter.Inc(1)
+				return false, ErrUnderpriced
+			}
+			// New transaction is better than our worse ones, try to make room for it
+			if err := pool.evict(tx, from, overflow); err != nil {
+				log.Trace("Discarding unplaceable transaction", "hash", hash, "price", tx.GasPrice(), "err", err)
+				if err == ErrUnderpriced {
+					underpricedTxCounter.Inc(1)
+				} else {
+					overflowTxCounter.Inc(1)
+				}
+				return false, err
+			}
 		}
 	}
 	// If the transaction is replacing an already pending one, do directly
-	from, _ := types.Sender(pool.signer, tx) // already validated
 	if list := pool.pending[from]; list != nil && list.Overlaps(tx) {
 		// Nonce already pending, check if required price bump is met
 		inserted, old := list.Add(tx, pool.config.PriceBump)
@@ -689,6 +814,104 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 	return replace, nil
 }
 
+// evict makes room in a full pool for a new remote transaction by dropping count
+// others that it outbids by at least the minimum price bump. Victims are chosen
+// with per-sender fairness in mind: transactions of accounts holding more than
+// their fair share of slots go first, then non-executable ones, then the cheapest.
+// A sender above its fair share may only displace others above theirs, so that
+// spamming from a single account cannot push out anyone else's transactions.
+//
+// Only a bounded number of candidates is considered, so victims are the fairest
+// among the cheapest few rather than among the entire pool. If not enough
+// transactions can be displaced, nothing is dropped.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) evict(tx *types.Transaction, from common.Address, count int) error {
+	// Gather the transactions the new one could displace price-wise
+	candidates := pool.priced.Evictable(tx, pool.locals, count+evictionSlack)
+	if len(candidates) < count {
+		return ErrUnderpriced
+	}
+	// Tag every candidate with the properties deciding its eviction order
+	var (
+		slots    = make(map[common.Address]int)
+		evictees = make(evictees, 0, len(candidates))
+	)
+	for _, tx := range candidates {
+		addr, _ := types.Sender(pool.signer, tx) // already validated
+		if _, ok := slots[addr]; !ok {
+			slots[addr] = pool.slots(addr)
+		}
+		evictees = append(evictees, evictee{
+			tx:        tx,
+			overquota: uint64(slots[addr]) > pool.config.AccountSlots,
+			future:    pool.queue[addr] != nil && pool.queue[addr].txs.Get(tx.Nonce()) == tx,
+		})
+	}
+	sort.Sort(evictees)
+
+	// Senders above their fair share may only displace others above theirs
+	slots := pool.slots(from)
+	if !pool.replaces(from, tx) {
+		slots++
+	}
+	if uint64(slots) > pool.config.AccountSlots {
+		for i, evictee := range evictees {
+			if !evictee.overquota {
+				evictees = evictees[:i]
+				break
+			}
+		}
+	}
+	if len(evictees) < count {
+		return ErrTxPoolOverflow
+	}
+	// Enough room can be made for the new transaction, drop the worst ones
+	for _, evictee := range evictees[:count] {
+		hash := evictee.tx.Hash()
+		switch {
+		case evictee.overquota:
+			log.Trace("Evicting fairness-exceeding transaction", "hash", hash, "price", evictee.tx.GasPrice())
+			evictOverquotaCounter.Inc(1)
+		case evictee.future:
+			log.Trace("Evicting outbid future transaction", "hash", hash, "price", evictee.tx.GasPrice())
+			evictFutureCounter.Inc(1)
+		default:
+			log.Trace("Evicting outbid executable transaction", "hash", hash, "price", evictee.tx.GasPrice())
+			evictUnderpricedCounter.Inc(1)
+		}
+		pool.removeTx(hash, true)
+	}
+	return nil
+}
+
+// replaces reports whether the transaction takes the nonce of one the account
+// already has pending or queued, in which case adding it doesn't grow the pool.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) replaces(from common.Address, tx *types.Transaction) bool {
+	if list := pool.pending[from]; list != nil && list.Overlaps(tx) {
+		return true
+	}
+	if list := pool.queue[from]; list != nil && list.Overlaps(tx) {
+		return true
+	}
+	return false
+}
+
+// slots returns the number of transactions, both executable and non-executable,
+// the given account currently holds in the pool.
+func (pool *TxPool) slots(addr common.Address) int {
+	var slots int
+	if list := pool.pending[addr]; list != nil {
+		slots += list.Len()
+	}
+	if list := pool.queue[addr]; list != nil {
+		slots += list.Len()
+	}
+	return slots
+}
+
 // enqueueTx inserts a new transaction into the non-executable transaction queue.
 //
 // Note, this method assumes the pool lock is held!
@@ -796,6 +1019,78 @@ func (pool *TxPool) AddRemotes(txs []*types.Transaction) []error {
 	return pool.addTxs(txs, false)
 }
 
+// AddPrivate inserts a single transaction into the private lane of the pool if
+// it is valid. Private transactions are never announced to the network, only
+// offered to the local miner until they are included or their private lifetime
+// expires, at which point they are either dropped or released into the public
+// pool as local transactions.
+func (pool *TxPool) AddPrivate(tx *types.Transaction) error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	// If the transaction is already known, discard it
+	hash := tx.Hash()
+	if pool.all.Get(hash) != nil || pool.private.Get(hash) != nil {
+		log.Trace("Discarding already known private transaction", "hash", hash)
+		return fmt.Errorf("known transaction: %x", hash)
+	}
+	// If the transaction fails basic validation, discard it
+	if err := pool.validateTx(tx, true); err != nil {
+		log.Trace("Discarding invalid private transaction", "hash", hash, "err", err)
+		invalidTxCounter.Inc(1)
+		return err
+	}
+	// Insert the transaction into the private lane, replacing any older one
+	from, _ := types.Sender(pool.signer, tx) // already validated
+
+	if uint64(pool.private.Len()) >= pool.config.PrivateSlots && !pool.private.Overlaps(from, tx) {
+		log.Trace("Discarding private transaction exceeding the lane capacity", "hash", hash)
+		privateDiscardCounter.Inc(1)
+		return ErrPrivateLaneFull
+	}
+	inserted, old := pool.private.Add(from, tx, time.Now().Add(pool.config.PrivateLifetime), pool.config.PriceBump)
+	if !inserted {
+		privateDiscardCounter.Inc(1)
+		return ErrReplaceUnderpriced
+	}
+	if old != nil {
+		privateReplaceCounter.Inc(1)
+	}
+	log.Trace("Pooled new private transaction", "hash", hash, "from", from, "to", tx.To())
+
+	// Notify the local subsystems only, never the network
+	go pool.privateTxFeed.Send(NewTxsEvent{types.Transactions{tx}})
+
+	return nil
+}
+
+// expirePrivate removes all the private transactions whose lifetime passed by
+// the given time, either dropping them or releasing them into the public pool.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) expirePrivate(now time.Time) {
+	expired := pool.private.Expire(now)
+	if len(expired) == 0 {
+		return
+	}
+	if !pool.config.PrivateRelease {
+		log.Debug("Dropped expired private transactions", "count", len(expired))
+		privateExpiredCounter.Inc(int64(len(expired)))
+		return
+	}
+	var released int
+	for i, err := range pool.addTxsLocked(expired, !pool.config.NoLocals) {
+		if err != nil {
+			log.Trace("Failed to release private transaction", "hash", expired[i].Hash(), "err", err)
+			privateExpiredCounter.Inc(1)
+			continue
+		}
+		released++
+	}
+	log.Debug("Released expired private transactions", "count", released, "dropped", len(expired)-released)
+	privateReleasedCounter.Inc(int64(released))
+}
+
 // addTx enqueues a single transaction into the pool if it is valid.
 func (pool *TxPool) addTx(tx *types.Transaction, local bool) error {
 	pool.mu.Lock()
@@ -873,6 +1168,137 @@ func (pool *TxPool) Get(hash common.Hash) *types.Transaction {
 	return pool.all.Get(hash)
 }
 
+// AddBundle inserts a bundle of transactions to be included consecutively and
+// atomically into the block it targets. Bundles are only sanity checked on entry,
+// the miner being responsible for simulating them against the block's state. As
+// only the first transaction is guaranteed to execute on the current state, it's
+// the one required to be funded, its sender owning the bundle.
+func (pool *TxPool) AddBundle(bundle *TxBundle) error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	// Ensure the bundle is sane and targets a near future block
+	if len(bundle.Txs) == 0 {
+		return ErrBundleEmpty
+	}
+	if len(bundle.Txs) > maxBundleTxs {
+		return ErrBundleOversized
+	}
+	head := pool.chain.CurrentBlock().NumberU64()
+	if bundle.BlockNumber <= head {
+		return ErrBundleStale
+	}
+	if bundle.BlockNumber > head+maxBundleDistance {
+		return ErrBundleDistant
+	}
+	for _, tx := range bundle.Txs {
+		if tx.Size() > 32*1024 {
+			return ErrOversizedData
+		}
+		if tx.Value().Sign() < 0 {
+			return ErrNegativeValue
+		}
+		if pool.currentMaxGas < tx.Gas() {
+			return ErrGasLimit
+		}
+		from, err := types.Sender(pool.signer, tx)
+		if err != nil {
+			return ErrInvalidSender
+		}
+		if pool.currentState.GetNonce(from) > tx.Nonce() {
+			return ErrNonceTooLow
+		}
+	}
+	owner, _ := types.Sender(pool.signer, bundle.Txs[0])
+	if pool.currentState.GetBalance(owner).Cmp(bundle.Txs[0].Cost()) < 0 {
+		return ErrInsufficientFunds
+	}
+	// Make sure the bundle is new and there's room for it
+	hash := bundle.Hash()
+	if pool.bundles[hash] != nil {
+		return fmt.Errorf("known bundle: %x", hash)
+	}
+	if pool.bundled[owner] >= maxAccountBundles {
+		return ErrBundleAccountFull
+	}
+	if uint64(len(pool.bundles)) >= pool.config.BundleSlots {
+		return ErrBundlePoolFull
+	}
+	pool.bundles[hash] = bundle
+	pool.bundled[owner]++
+
+	log.Trace("Pooled new transaction bundle", "hash", hash, "number", bundle.BlockNumber, "txs", len(bundle.Txs))
+	return nil
+}
+
+// CancelBundle removes a bundle of transactions from the pool on behalf of the
+// sender of any of its transactions, returning whether it was removed.
+func (pool *TxPool) CancelBundle(hash common.Hash, sender common.Address) bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	bundle := pool.bundles[hash]
+	if bundle == nil {
+		return false
+	}
+	for _, tx := range bundle.Txs {
+		if from, _ := types.Sender(pool.signer, tx); from == sender {
+			pool.removeBundle(hash)
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveBundle drops a bundle of transactions from the pool, e.g. after it failed
+// execution on the block it targets.
+func (pool *TxPool) RemoveBundle(hash common.Hash) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.removeBundle(hash)
+}
+
+// removeBundle drops a bundle of transactions from the pool, releasing the slot
+// of its owner.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) removeBundle(hash common.Hash) {
+	bundle := pool.bundles[hash]
+	if bundle == nil {
+		return
+	}
+	delete(pool.bundles, hash)
+
+	owner, _ := types.Sender(pool.signer, bundle.Txs[0]) // already validated on entry
+	if pool.bundled[owner]--; pool.bundled[owner] <= 0 {
+		delete(pool.bundled, owner)
+	}
+}
+
+// Bundles retrieves all the transaction bundles targeting the given block number.
+func (pool *TxPool) Bundles(number uint64) []*TxBundle {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	var bundles []*TxBundle
+	for _, bundle := range pool.bundles {
+		if bundle.BlockNumber == number {
+			bundles = append(bundles, bundle)
+		}
+	}
+	return bundles
+}
+
+// GetPrivate returns a transaction if it is contained in the private lane of
+// the pool and nil otherwise.
+func (pool *TxPool) GetPrivate(hash common.Hash) *types.Transaction {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.private.Get(hash)
+}
+
 // removeTx removes a single transaction from the queue, moving all subsequent
 // transactions back to the future queue.
 func (pool *TxPool) removeTx(hash common.Hash, outofbound bool) {
@@ -1149,6 +1575,38 @@ func (a addressesByHeartbeat) Len() int           { return len(a) }
 func (a addressesByHeartbeat) Less(i, j int) bool { return a[i].heartbeat.Before(a[j].heartbeat) }
 func (a addressesByHeartbeat) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 
+// evictee is a transaction considered for eviction from a full pool, tagged with
+// the properties deciding its place in the eviction order.
+type evictee struct {
+	tx        *types.Transaction
+	overquota bool // Whether the sender holds more than its fair share of slots
+	future    bool // Whether the transaction is non-executable (queued)
+}
+
+// evictees is a list of eviction candidates, sorted worst first: senders above
+// their fair share before others, future transactions before executable ones,
+// cheaper transactions before pricier ones and higher nonces before lower ones.
+type evictees []evictee
+
+func (e evictees) Len() int      { return len(e) }
+func (e evictees) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+
+func (e evictees) Less(i, j int) bool {
+	if e[i].overquota != e[j].overquota {
+		return e[i].overquota
+	}
+	if e[i].future != e[j].future {
+		return e[i].future
+	}
+	switch e[i].tx.GasPrice().Cmp(e[j].tx.GasPrice()) {
+	case -1:
+		return true
+	case 1:
+		return false
+	}
+	return e[i].tx.Nonce() > e[j].tx.Nonce()
+}
+
 // accountSet is simply a set of addresses to check for existence, and a signer
 // capable of deriving addresses from transactions.
 type accountSet struct {
@@ -1488,6 +1488,297 @@ func TestTransactionPoolStableUnderpricing(t *testing.T) {
 	}
 }
 
+// Tests that a full pool only lets a new transaction displace the cheapest one
+// if it outbids it by at least the minimum replacement price bump, preventing
+// the pool from being churned by one wei increments.
+func TestTransactionPoolUnderpricingBump(t *testing.T) {
+	t.Parallel()
+
+	// Create the pool to test the pricing enforcement with
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(etscdb.NewMemDatabase()))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.GlobalSlots = 4
+	config.GlobalQueue = 0
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	// Create a number of test accounts and fund them
+	keys := make([]*ecdsa.PrivateKey, 5)
+	for i := 0; i < len(keys); i++ {
+		keys[i], _ = crypto.GenerateKey()
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(keys[i].PublicKey), big.NewInt(1000000000))
+	}
+	// Fill up the pool with the same transaction price points
+	price := int64(100)
+	threshold := (price * (100 + int64(config.PriceBump))) / 100
+
+	for i := 0; i < 4; i++ {
+		if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(price), keys[i])); err != nil {
+			t.Fatalf("failed to add original transaction %d: %v", i, err)
+		}
+	}
+	// Ensure that transactions below the price bump are rejected, above accepted
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(threshold-1), keys[4])); err != ErrUnderpriced {
+		t.Fatalf("adding insufficiently bumped transaction error mismatch: have %v, want %v", err, ErrUnderpriced)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(threshold), keys[4])); err != nil {
+		t.Fatalf("failed to add sufficiently bumped transaction: %v", err)
+	}
+	pending, queued := pool.Stats()
+	if pending != 4 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 4)
+	}
+	if queued != 0 {
+		t.Fatalf("queued transactions mismatched: have %d, want %d", queued, 0)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that senders holding more than their fair share of a full pool cannot
+// push out other accounts' transactions, not even by paying more, whereas their
+// own fairness-exceeding transactions are the first to go for anyone else.
+func TestTransactionPoolFairEviction(t *testing.T) {
+	t.Parallel()
+
+	// Create the pool to test the fairness enforcement with
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(etscdb.NewMemDatabase()))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.AccountSlots = 2
+	config.GlobalSlots = 8
+	config.GlobalQueue = 0
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	// Create a number of honest accounts and a spammer, and fund them
+	honest := make([]*ecdsa.PrivateKey, 5)
+	for i := 0; i < len(honest); i++ {
+		honest[i], _ = crypto.GenerateKey()
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(honest[i].PublicKey), big.NewInt(1000000000))
+	}
+	spammer, _ := crypto.GenerateKey()
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(spammer.PublicKey), big.NewInt(1000000000))
+
+	// Fill up the pool with cheap honest and pricier spam transactions
+	for i := 0; i < 4; i++ {
+		if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(1), honest[i])); err != nil {
+			t.Fatalf("failed to add honest transaction %d: %v", i, err)
+		}
+		if err := pool.AddRemote(pricedTransaction(uint64(i), 100000, big.NewInt(5), spammer)); err != nil {
+			t.Fatalf("failed to add spam transaction %d: %v", i, err)
+		}
+	}
+	// Ensure the spammer cannot push out honest transactions, even though it outbids them
+	if err := pool.AddRemote(pricedTransaction(4, 100000, big.NewInt(5), spammer)); err != ErrTxPoolOverflow {
+		t.Fatalf("adding fairness-exceeding transaction error mismatch: have %v, want %v", err, ErrTxPoolOverflow)
+	}
+	for i := 0; i < 4; i++ {
+		if pool.pending[crypto.PubkeyToAddress(honest[i].PublicKey)] == nil {
+			t.Fatalf("honest account %d evicted", i)
+		}
+	}
+	// Ensure a new honest transaction displaces the spammer instead of the cheapest
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(6), honest[4])); err != nil {
+		t.Fatalf("failed to add well priced honest transaction: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		if pool.pending[crypto.PubkeyToAddress(honest[i].PublicKey)] == nil {
+			t.Fatalf("honest account %d evicted", i)
+		}
+	}
+	if pending := pool.pending[crypto.PubkeyToAddress(spammer.PublicKey)].Len(); pending != 3 {
+		t.Fatalf("spammer pending transactions mismatched: have %d, want %d", pending, 3)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that replacing a transaction in a full pool doesn't displace any other
+// account's, not even if the sender already holds its entire fair share.
+func TestTransactionPoolFullReplacement(t *testing.T) {
+	t.Parallel()
+
+	// Create the pool to test the replacements with
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(etscdb.NewMemDatabase()))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.AccountSlots = 2
+	config.GlobalSlots = 4
+	config.GlobalQueue = 0
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	// Fill up the pool with the fair share of two accounts
+	keys := make([]*ecdsa.PrivateKey, 2)
+	for i := 0; i < len(keys); i++ {
+		keys[i], _ = crypto.GenerateKey()
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(keys[i].PublicKey), big.NewInt(1000000000))
+
+		for nonce := uint64(0); nonce < 2; nonce++ {
+			if err := pool.AddRemote(pricedTransaction(nonce, 100000, big.NewInt(1), keys[i])); err != nil {
+				t.Fatalf("failed to add transaction %d of account %d: %v", nonce, i, err)
+			}
+		}
+	}
+	// Ensure replacements are still subject to the price bump
+	if err := pool.AddRemote(pricedTransaction(1, 100000, big.NewInt(1), keys[0])); err != ErrReplaceUnderpriced {
+		t.Fatalf("underpriced replacement error mismatch: have %v, want %v", err, ErrReplaceUnderpriced)
+	}
+	// Ensure a proper replacement is accepted without evicting anything
+	if err := pool.AddRemote(pricedTransaction(1, 100000, big.NewInt(2), keys[0])); err != nil {
+		t.Fatalf("failed to replace transaction: %v", err)
+	}
+	for i, key := range keys {
+		if pending := pool.pending[crypto.PubkeyToAddress(key.PublicKey)].Len(); pending != 2 {
+			t.Fatalf("account %d pending transactions mismatched: have %d, want %d", i, pending, 2)
+		}
+	}
+	if count := pool.all.Count(); count != 4 {
+		t.Fatalf("pooled transactions mismatched: have %d, want %d", count, 4)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that random transaction floods with gapped nonces, replacements, wild
+// prices and locals mixed in never break the internal invariants of the pool,
+// and never grow it beyond its limits unless local transactions force it to.
+func TestTransactionPoolEvictionFuzz(t *testing.T) {
+	t.Parallel()
+
+	// Create the pool to fuzz with small limits to trigger evictions often
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(etscdb.NewMemDatabase()))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.AccountSlots = 4
+	config.AccountQueue = 8
+	config.GlobalSlots = 32
+	config.GlobalQueue = 16
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	// Create a number of test accounts and fund them
+	keys := make([]*ecdsa.PrivateKey, 16)
+	for i := 0; i < len(keys); i++ {
+		keys[i], _ = crypto.GenerateKey()
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(keys[i].PublicKey), big.NewInt(1000000000000))
+	}
+	// Throw random transactions at the pool and check its consistency at every step
+	rand := rand.New(rand.NewSource(0x1459))
+	locals := 0
+
+	for i := 0; i < 2000; i++ {
+		var (
+			key   = keys[rand.Intn(len(keys))]
+			nonce = uint64(rand.Intn(2 * int(config.AccountSlots+config.AccountQueue)))
+			price = big.NewInt(1 + rand.Int63n(100))
+			tx    = pricedTransaction(nonce, 100000, price, key)
+		)
+		if rand.Intn(50) == 0 {
+			if pool.AddLocal(tx) == nil {
+				locals++
+			}
+		} else {
+			pool.AddRemote(tx)
+		}
+		if err := validateTxPoolInternals(pool); err != nil {
+			t.Fatalf("step %d: pool internal state corrupted: %v", i, err)
+		}
+		if limit := int(config.GlobalSlots+config.GlobalQueue) + locals; pool.all.Count() > limit {
+			t.Fatalf("step %d: pool overflown: have %d, want at most %d", i, pool.all.Count(), limit)
+		}
+	}
+}
+
+// Tests that no matter how a number of spammers flood a full pool, transactions
+// from accounts within their fair share are never displaced by a sender above it.
+func TestTransactionPoolSpamFairnessFuzz(t *testing.T) {
+	t.Parallel()
+
+	// Create the pool to fuzz with small limits to trigger evictions often
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(etscdb.NewMemDatabase()))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.AccountSlots = 4
+	config.GlobalSlots = 32
+	config.GlobalQueue = 16
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	// Create a number of honest accounts and spammers, and fund them
+	rand := rand.New(rand.NewSource(0x2019))
+
+	honest := make([]*ecdsa.PrivateKey, 8)
+	for i := 0; i < len(honest); i++ {
+		honest[i], _ = crypto.GenerateKey()
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(honest[i].PublicKey), big.NewInt(1000000000000))
+	}
+	spammers := make([]*ecdsa.PrivateKey, 4)
+	for i := 0; i < len(spammers); i++ {
+		spammers[i], _ = crypto.GenerateKey()
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(spammers[i].PublicKey), big.NewInt(1000000000000))
+	}
+	// Let every honest account place a few executable transactions within its share
+	for _, key := range honest {
+		for nonce := 0; nonce < 1+rand.Intn(int(config.AccountSlots)); nonce++ {
+			if err := pool.AddRemote(pricedTransaction(uint64(nonce), 100000, big.NewInt(1+rand.Int63n(10)), key)); err != nil {
+				t.Fatalf("failed to add honest transaction: %v", err)
+			}
+		}
+	}
+	// Flood the pool with random spam, checking honest transactions after every step
+	for i := 0; i < 2000; i++ {
+		var (
+			key   = spammers[rand.Intn(len(spammers))]
+			from  = crypto.PubkeyToAddress(key.PublicKey)
+			nonce = uint64(rand.Intn(64))
+			price = big.NewInt(1 + rand.Int63n(100))
+		)
+		// Gather the transactions of all other accounts within their fair share
+		pool.mu.RLock()
+		overquota := uint64(pool.slots(from)+1) > config.AccountSlots
+
+		var protected []common.Hash
+		if overquota {
+			for addr := range pool.pending {
+				if addr != from && uint64(pool.slots(addr)) <= config.AccountSlots {
+					for _, tx := range pool.pending[addr].Flatten() {
+						protected = append(protected, tx.Hash())
+					}
+				}
+			}
+		}
+		pool.mu.RUnlock()
+
+		// Inject the spam and ensure none of the protected transactions were dropped
+		pool.AddRemote(pricedTransaction(nonce, 100000, price, key))
+
+		for _, hash := range protected {
+			if pool.Get(hash) == nil {
+				t.Fatalf("step %d: fair share transaction %x displaced by spammer", i, hash)
+			}
+		}
+		if err := validateTxPoolInternals(pool); err != nil {
+			t.Fatalf("step %d: pool internal state corrupted: %v", i, err)
+		}
+	}
+}
+
 // Tests that the pool rejects replacement transactions that don't meet the minimum
 // price bump required.
 func TestTransactionReplacement(t *testing.T) {
@@ -1680,6 +1971,314 @@ func testTransactionJournaling(t *testing.T, nolocals bool) {
 	pool.Stop()
 }
 
+// Tests that private transactions are kept out of the public pool and its event
+// feed, yet are offered on top of the public pending ones, and that they get
+// dropped once included into the chain.
+func TestTransactionPrivateLane(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	// Keep track of public and private transaction events
+	events := make(chan NewTxsEvent, 32)
+	sub := pool.SubscribeNewTxsEvent(events)
+	defer sub.Unsubscribe()
+
+	privates := make(chan NewTxsEvent, 32)
+	privSub := pool.SubscribePrivateTxsEvent(privates)
+	defer privSub.Unsubscribe()
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(from, big.NewInt(1000000000))
+
+	// Add a public and two private transactions continuing it
+	if err := pool.AddRemote(transaction(0, 100000, key)); err != nil {
+		t.Fatalf("failed to add public transaction: %v", err)
+	}
+	private := types.Transactions{transaction(1, 100000, key), transaction(2, 100000, key)}
+	for i, tx := range private {
+		if err := pool.AddPrivate(tx); err != nil {
+			t.Fatalf("failed to add private transaction %d: %v", i, err)
+		}
+	}
+	if err := pool.AddPrivate(private[0]); err == nil {
+		t.Fatalf("duplicate private transaction accepted")
+	}
+	if err := validateEvents(events, 1); err != nil {
+		t.Fatalf("public event firing failed: %v", err)
+	}
+	if err := validateEvents(privates, 2); err != nil {
+		t.Fatalf("private event firing failed: %v", err)
+	}
+	// Ensure the private transactions are hidden from the public views
+	pending, queued := pool.Stats()
+	if pending != 1 || queued != 0 {
+		t.Fatalf("pool stats mismatch: have %d/%d, want %d/%d", pending, queued, 1, 0)
+	}
+	if pool.Get(private[0].Hash()) != nil {
+		t.Fatalf("private transaction publicly retrievable")
+	}
+	if pool.GetPrivate(private[0].Hash()) == nil {
+		t.Fatalf("private transaction not retrievable")
+	}
+	// Ensure the private transactions are offered on top of the public ones
+	ready, _ := pool.PendingPrivate()
+	if len(ready[from]) != 2 || ready[from][0] != private[0] || ready[from][1] != private[1] {
+		t.Fatalf("pending private transactions mismatch: have %v, want %v", ready[from], private)
+	}
+	// Include the public and the first private transaction, ensure the rest remains
+	pool.currentState.SetNonce(from, 2)
+	pool.lockedReset(nil, nil)
+
+	if pool.GetPrivate(private[0].Hash()) != nil {
+		t.Fatalf("included private transaction not dropped")
+	}
+	ready, _ = pool.PendingPrivate()
+	if len(ready[from]) != 1 || ready[from][0] != private[1] {
+		t.Fatalf("pending private transactions mismatch: have %v, want %v", ready[from], private[1:])
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that expired private transactions are either dropped, or released into
+// the public pool and announced, depending on the configuration.
+func TestTransactionPrivateExpiryDrop(t *testing.T)    { testTransactionPrivateExpiry(t, false) }
+func TestTransactionPrivateExpiryRelease(t *testing.T) { testTransactionPrivateExpiry(t, true) }
+
+func testTransactionPrivateExpiry(t *testing.T, release bool) {
+	t.Parallel()
+
+	// Create the pool to test the private expiry with
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(etscdb.NewMemDatabase()))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.PrivateLifetime = time.Hour
+	config.PrivateRelease = release
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	events := make(chan NewTxsEvent, 32)
+	sub := pool.SubscribeNewTxsEvent(events)
+	defer sub.Unsubscribe()
+
+	key, _ := crypto.GenerateKey()
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	tx := transaction(0, 100000, key)
+	if err := pool.AddPrivate(tx); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	// Ensure nothing happens before the lifetime passes
+	pool.mu.Lock()
+	pool.expirePrivate(time.Now())
+	pool.mu.Unlock()
+
+	if pool.GetPrivate(tx.Hash()) == nil {
+		t.Fatalf("private transaction expired prematurely")
+	}
+	// Expire the private transaction and check where it ends up
+	pool.mu.Lock()
+	pool.expirePrivate(time.Now().Add(config.PrivateLifetime))
+	pool.mu.Unlock()
+
+	if pool.GetPrivate(tx.Hash()) != nil {
+		t.Fatalf("expired private transaction not removed from the private lane")
+	}
+	if released := pool.Get(tx.Hash()) != nil; released != release {
+		t.Fatalf("expired private transaction release mismatch: have %v, want %v", released, release)
+	}
+	announced := 0
+	if release {
+		announced = 1
+	}
+	if err := validateEvents(events, announced); err != nil {
+		t.Fatalf("release event firing failed: %v", err)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the private lane is capped, still accepting replacements when full.
+func TestTransactionPrivateSlots(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(etscdb.NewMemDatabase()))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.PrivateSlots = 4
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	key, _ := crypto.GenerateKey()
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	for i := uint64(0); i < config.PrivateSlots; i++ {
+		if err := pool.AddPrivate(transaction(i, 100000, key)); err != nil {
+			t.Fatalf("failed to add private transaction %d: %v", i, err)
+		}
+	}
+	if err := pool.AddPrivate(transaction(config.PrivateSlots, 100000, key)); err != ErrPrivateLaneFull {
+		t.Fatalf("overflowing private transaction error mismatch: have %v, want %v", err, ErrPrivateLaneFull)
+	}
+	if err := pool.AddPrivate(pricedTransaction(0, 100000, big.NewInt(2), key)); err != nil {
+		t.Fatalf("failed to replace private transaction in a full lane: %v", err)
+	}
+	if pending := pool.private.Len(); uint64(pending) != config.PrivateSlots {
+		t.Fatalf("private transaction count mismatch: have %d, want %d", pending, config.PrivateSlots)
+	}
+}
+
+// Tests that transaction bundles are validated on entry, can be cancelled and
+// are dropped once the chain progresses past the block they target.
+func TestTransactionBundles(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(sender, big.NewInt(1000000))
+
+	// Ensure invalid bundles are rejected
+	if err := pool.AddBundle(&TxBundle{BlockNumber: 1}); err != ErrBundleEmpty {
+		t.Fatalf("empty bundle error mismatch: have %v, want %v", err, ErrBundleEmpty)
+	}
+	if err := pool.AddBundle(&TxBundle{Txs: types.Transactions{transaction(0, 100000, key)}}); err != ErrBundleStale {
+		t.Fatalf("stale bundle error mismatch: have %v, want %v", err, ErrBundleStale)
+	}
+	oversized := &TxBundle{BlockNumber: 1}
+	for i := 0; i <= maxBundleTxs; i++ {
+		oversized.Txs = append(oversized.Txs, transaction(uint64(i), 100000, key))
+	}
+	if err := pool.AddBundle(oversized); err != ErrBundleOversized {
+		t.Fatalf("oversized bundle error mismatch: have %v, want %v", err, ErrBundleOversized)
+	}
+	if err := pool.AddBundle(&TxBundle{Txs: types.Transactions{transaction(0, 2000000, key)}, BlockNumber: 1}); err != ErrGasLimit {
+		t.Fatalf("gas limit error mismatch: have %v, want %v", err, ErrGasLimit)
+	}
+	if err := pool.AddBundle(&TxBundle{Txs: types.Transactions{transaction(0, 100000, key)}, BlockNumber: maxBundleDistance + 1}); err != ErrBundleDistant {
+		t.Fatalf("distant bundle error mismatch: have %v, want %v", err, ErrBundleDistant)
+	}
+	unfunded, _ := crypto.GenerateKey()
+	if err := pool.AddBundle(&TxBundle{Txs: types.Transactions{transaction(0, 100000, unfunded), transaction(1, 100000, key)}, BlockNumber: 1}); err != ErrInsufficientFunds {
+		t.Fatalf("unfunded bundle error mismatch: have %v, want %v", err, ErrInsufficientFunds)
+	}
+	pool.currentState.SetNonce(crypto.PubkeyToAddress(unfunded.PublicKey), 1)
+	if err := pool.AddBundle(&TxBundle{Txs: types.Transactions{transaction(0, 100000, key), transaction(0, 100000, unfunded)}, BlockNumber: 1}); err != ErrNonceTooLow {
+		t.Fatalf("stale nonce error mismatch: have %v, want %v", err, ErrNonceTooLow)
+	}
+	// Add a few valid bundles and ensure they are retrievable by block number
+	first := &TxBundle{Txs: types.Transactions{transaction(0, 100000, key), transaction(1, 100000, key)}, BlockNumber: 1}
+	second := &TxBundle{Txs: types.Transactions{transaction(0, 100000, key)}, BlockNumber: 2}
+	third := &TxBundle{Txs: types.Transactions{transaction(1, 100000, key)}, BlockNumber: 2}
+
+	for i, bundle := range []*TxBundle{first, second, third} {
+		if err := pool.AddBundle(bundle); err != nil {
+			t.Fatalf("failed to add bundle %d: %v", i, err)
+		}
+	}
+	if err := pool.AddBundle(first); err == nil {
+		t.Fatalf("duplicate bundle accepted")
+	}
+	if bundles := pool.Bundles(1); len(bundles) != 1 || bundles[0] != first {
+		t.Fatalf("block 1 bundles mismatch: have %v, want %v", bundles, []*TxBundle{first})
+	}
+	if bundles := pool.Bundles(2); len(bundles) != 2 {
+		t.Fatalf("block 2 bundle count mismatch: have %d, want %d", len(bundles), 2)
+	}
+	// Cancel a bundle and ensure only its senders can do so
+	if pool.CancelBundle(third.Hash(), common.Address{1}) {
+		t.Fatalf("cancelled bundle of another sender")
+	}
+	if !pool.CancelBundle(third.Hash(), sender) {
+		t.Fatalf("failed to cancel existing bundle")
+	}
+	if pool.CancelBundle(third.Hash(), sender) {
+		t.Fatalf("cancelled non-existent bundle")
+	}
+	if bundles := pool.Bundles(2); len(bundles) != 1 || bundles[0] != second {
+		t.Fatalf("block 2 bundles mismatch: have %v, want %v", bundles, []*TxBundle{second})
+	}
+	// Progress the chain and ensure stale bundles are dropped
+	pool.lockedReset(nil, &types.Header{Number: big.NewInt(1), GasLimit: 1000000})
+
+	if bundles := pool.Bundles(1); len(bundles) != 0 {
+		t.Fatalf("stale bundles not dropped: %v", bundles)
+	}
+	if bundles := pool.Bundles(2); len(bundles) != 1 {
+		t.Fatalf("future bundles dropped: have %d, want %d", len(bundles), 1)
+	}
+}
+
+// Tests that the number of bundles awaiting inclusion is capped.
+func TestTransactionBundleLimiting(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(etscdb.NewMemDatabase()))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.BundleSlots = 4
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	key, _ := crypto.GenerateKey()
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000))
+
+	for i := uint64(0); i < config.BundleSlots; i++ {
+		if err := pool.AddBundle(&TxBundle{Txs: types.Transactions{transaction(i, 100000, key)}, BlockNumber: 1}); err != nil {
+			t.Fatalf("failed to add bundle %d: %v", i, err)
+		}
+	}
+	bundle := &TxBundle{Txs: types.Transactions{transaction(config.BundleSlots, 100000, key)}, BlockNumber: 1}
+	if err := pool.AddBundle(bundle); err != ErrBundlePoolFull {
+		t.Fatalf("overflow error mismatch: have %v, want %v", err, ErrBundlePoolFull)
+	}
+}
+
+// Tests that the number of bundles owned by a single account is capped, and that
+// removed bundles release the slots of their owner.
+func TestTransactionBundleAccountLimiting(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	other, _ := crypto.GenerateKey()
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000))
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(other.PublicKey), big.NewInt(1000000))
+
+	bundles := make([]*TxBundle, maxAccountBundles)
+	for i := range bundles {
+		bundles[i] = &TxBundle{Txs: types.Transactions{transaction(uint64(i), 100000, key)}, BlockNumber: 1}
+		if err := pool.AddBundle(bundles[i]); err != nil {
+			t.Fatalf("failed to add bundle %d: %v", i, err)
+		}
+	}
+	// Bundles owned by the same account must be rejected, others accepted
+	bundle := &TxBundle{Txs: types.Transactions{transaction(maxAccountBundles, 100000, key)}, BlockNumber: 1}
+	if err := pool.AddBundle(bundle); err != ErrBundleAccountFull {
+		t.Fatalf("account overflow error mismatch: have %v, want %v", err, ErrBundleAccountFull)
+	}
+	if err := pool.AddBundle(&TxBundle{Txs: types.Transactions{transaction(0, 100000, other), transaction(maxAccountBundles, 100000, key)}, BlockNumber: 1}); err != nil {
+		t.Fatalf("failed to add bundle of other account: %v", err)
+	}
+	// Drop a bundle and ensure its owner can submit again
+	pool.RemoveBundle(bundles[0].Hash())
+	if err := pool.AddBundle(bundle); err != nil {
+		t.Fatalf("failed to add bundle after removal: %v", err)
+	}
+}
+
 // TestTransactionStatusCheck tests that the pool can correctly retrieve the
 // pending status of individual transactions.
 func TestTransactionStatusCheck(t *testing.T) {
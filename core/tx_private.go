@@ -0,0 +1,143 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"time"
+
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/core/types"
+)
+
+// txPrivateLane is a set of transactions kept aside from the public pool. They
+// are never announced to the network, only offered to the local miner, until
+// they either get included into the chain or expire.
+type txPrivateLane struct {
+	all     map[common.Hash]*types.Transaction // All private transactions to allow lookups
+	senders map[common.Hash]common.Address     // Sender of each private transaction
+	expiry  map[common.Hash]time.Time          // Deadline after which a transaction expires
+	lists   map[common.Address]*txList         // Private transactions grouped by sender
+}
+
+// newTxPrivateLane creates a new, empty private transaction lane.
+func newTxPrivateLane() *txPrivateLane {
+	return &txPrivateLane{
+		all:     make(map[common.Hash]*types.Transaction),
+		senders: make(map[common.Hash]common.Address),
+		expiry:  make(map[common.Hash]time.Time),
+		lists:   make(map[common.Address]*txList),
+	}
+}
+
+// Get returns a transaction if it is contained in the lane and nil otherwise.
+func (l *txPrivateLane) Get(hash common.Hash) *types.Transaction {
+	return l.all[hash]
+}
+
+// Len returns the number of transactions in the lane.
+func (l *txPrivateLane) Len() int {
+	return len(l.all)
+}
+
+// Overlaps returns whether the transaction would replace one of the same sender
+// already contained in the lane.
+func (l *txPrivateLane) Overlaps(from common.Address, tx *types.Transaction) bool {
+	list := l.lists[from]
+	return list != nil && list.Overlaps(tx)
+}
+
+// Add tries to insert a new transaction into the lane, returning whether the
+// transaction was accepted, and if yes, any previous transaction it replaced.
+// Replacing a private transaction requires the same price bump as in the pool.
+func (l *txPrivateLane) Add(from common.Address, tx *types.Transaction, expiry time.Time, priceBump uint64) (bool, *types.Transaction) {
+	if l.lists[from] == nil {
+		l.lists[from] = newTxList(false)
+	}
+	inserted, old := l.lists[from].Add(tx, priceBump)
+	if !inserted {
+		return false, nil
+	}
+	if old != nil {
+		l.forget(old.Hash())
+	}
+	hash := tx.Hash()
+	l.all[hash], l.senders[hash], l.expiry[hash] = tx, from, expiry
+	return true, old
+}
+
+// Ready retrieves the sequentially increasing list of private transactions of
+// an account starting at the provided nonce. Contrary to txList.Ready, the
+// transactions are not removed from the lane.
+func (l *txPrivateLane) Ready(addr common.Address, start uint64) types.Transactions {
+	list := l.lists[addr]
+	if list == nil {
+		return nil
+	}
+	var ready types.Transactions
+	for nonce := start; ; nonce++ {
+		tx := list.txs.Get(nonce)
+		if tx == nil {
+			break
+		}
+		ready = append(ready, tx)
+	}
+	return ready
+}
+
+// Forward removes all transactions from the lane with a nonce lower than the one
+// reported for their sender, i.e. the ones already included into the chain.
+// Every removed transaction is returned for any post-removal maintenance.
+func (l *txPrivateLane) Forward(nonce func(common.Address) uint64) types.Transactions {
+	var removed types.Transactions
+	for addr, list := range l.lists {
+		for _, tx := range list.Forward(nonce(addr)) {
+			l.forget(tx.Hash())
+			removed = append(removed, tx)
+		}
+		if list.Empty() {
+			delete(l.lists, addr)
+		}
+	}
+	return removed
+}
+
+// Expire removes all transactions from the lane whose deadline passed by the
+// given time, returning them for any post-removal maintenance.
+func (l *txPrivateLane) Expire(now time.Time) types.Transactions {
+	var expired types.Transactions
+	for hash, deadline := range l.expiry {
+		if now.Before(deadline) {
+			continue
+		}
+		tx, from := l.all[hash], l.senders[hash]
+		l.lists[from].Remove(tx)
+		if l.lists[from].Empty() {
+			delete(l.lists, from)
+		}
+		l.forget(hash)
+		expired = append(expired, tx)
+	}
+	return expired
+}
+
+// forget drops all the lookup metadata of a transaction, leaving the sender
+// lists to be maintained by the caller.
+func (l *txPrivateLane) forget(hash common.Hash) {
+	delete(l.all, hash)
+	delete(l.senders, hash)
+	delete(l.expiry, hash)
+}
@@ -0,0 +1,53 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"math/big"
+
+	"github.com/ETSC3259/etsc/common"
+)
+
+// StateDiff is the set of accounts and storage slots changed by a block, along
+// with their values before and after its execution.
+type StateDiff struct {
+	Accounts []*AccountDiff // Changed accounts, ordered by address
+}
+
+// AccountDiff is the change of a single account. Contract code is referenced by
+// hash to keep diffs compact, the code itself being available in the state
+// database.
+type AccountDiff struct {
+	Address common.Address
+	Deleted bool // Whether the account was removed (self destructed or emptied)
+
+	PrevNonce    uint64
+	Nonce        uint64
+	PrevBalance  *big.Int
+	Balance      *big.Int
+	PrevCodeHash common.Hash
+	CodeHash     common.Hash
+
+	Storage []*StorageDiff // Changed storage slots, ordered by key
+}
+
+// StorageDiff is the change of a single storage slot of an account.
+type StorageDiff struct {
+	Key   common.Hash
+	Prev  common.Hash
+	Value common.Hash
+}
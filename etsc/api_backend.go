@@ -19,6 +19,7 @@ package etsc
 import (
 	"context"
 	"math/big"
+	"time"
 
 	"github.com/ETSC3259/etsc/accounts"
 	"github.com/ETSC3259/etsc/common"
@@ -47,6 +48,10 @@ func (b *EtscAPIBackend) ChainConfig() *params.ChainConfig {
 	return b.etsc.chainConfig
 }
 
+func (b *EtscAPIBackend) RPCEVMTimeout() time.Duration {
+	return b.etsc.config.RPCEVMTimeout
+}
+
 func (b *EtscAPIBackend) CurrentBlock() *types.Block {
 	return b.etsc.blockchain.CurrentBlock()
 }
@@ -157,6 +162,10 @@ func (b *EtscAPIBackend) SendTx(ctx context.Context, signedTx *types.Transaction
 	return b.etsc.txPool.AddLocal(signedTx)
 }
 
+func (b *EtscAPIBackend) SendPrivateTx(ctx context.Context, signedTx *types.Transaction) error {
+	return b.etsc.txPool.AddPrivate(signedTx)
+}
+
 func (b *EtscAPIBackend) GetPoolTransactions() (types.Transactions, error) {
 	pending, err := b.etsc.txPool.Pending()
 	if err != nil {
@@ -173,6 +182,10 @@ func (b *EtscAPIBackend) GetPoolTransaction(hash common.Hash) *types.Transaction
 	return b.etsc.txPool.Get(hash)
 }
 
+func (b *EtscAPIBackend) GetPrivatePoolTransaction(hash common.Hash) *types.Transaction {
+	return b.etsc.txPool.GetPrivate(hash)
+}
+
 func (b *EtscAPIBackend) GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error) {
 	return b.etsc.txPool.State().GetNonce(addr), nil
 }
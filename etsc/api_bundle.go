@@ -0,0 +1,158 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package etsc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/common/hexutil"
+	"github.com/ETSC3259/etsc/core"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/core/vm"
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/rlp"
+)
+
+// errPendingUnavailable is returned if a bundle is simulated before the miner
+// assembled its first pending block.
+var errPendingUnavailable = errors.New("pending block not available")
+
+// PublicBundleAPI provides an API to submit, simulate and cancel transaction
+// bundles to be included atomically by the local miner.
+type PublicBundleAPI struct {
+	e *etsc
+}
+
+// NewPublicBundleAPI creates a new transaction bundle API.
+func NewPublicBundleAPI(e *etsc) *PublicBundleAPI {
+	return &PublicBundleAPI{e}
+}
+
+// SendBundleArgs represents the arguments to submit or simulate a bundle.
+type SendBundleArgs struct {
+	Txs         []hexutil.Bytes `json:"txs"`
+	BlockNumber hexutil.Uint64  `json:"blockNumber"`
+}
+
+// bundle decodes the RLP encoded transactions of the arguments into a bundle.
+func (args *SendBundleArgs) bundle() (*core.TxBundle, error) {
+	bundle := &core.TxBundle{BlockNumber: uint64(args.BlockNumber)}
+	for _, encoded := range args.Txs {
+		tx := new(types.Transaction)
+		if err := rlp.DecodeBytes(encoded, tx); err != nil {
+			return nil, err
+		}
+		bundle.Txs = append(bundle.Txs, tx)
+	}
+	return bundle, nil
+}
+
+// SendBundle submits a bundle of signed transactions to be included consecutively
+// and atomically into the given block, returning the bundle's hash.
+func (api *PublicBundleAPI) SendBundle(ctx context.Context, args SendBundleArgs) (common.Hash, error) {
+	bundle, err := args.bundle()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := api.e.TxPool().AddBundle(bundle); err != nil {
+		return common.Hash{}, err
+	}
+	return bundle.Hash(), nil
+}
+
+// CancelBundle removes a previously submitted bundle, returning whether it was
+// still awaiting inclusion. As bundle hashes are known to anyone relaying the
+// bundle, cancelling requires a signature over the bundle hash by the sender of
+// one of its transactions, as produced by etsc_sign:
+//
+//   keccak256("\x19etsc Signed Message:\n32"${bundle hash}).
+func (api *PublicBundleAPI) CancelBundle(hash common.Hash, sig hexutil.Bytes) (bool, error) {
+	if len(sig) != 65 {
+		return false, fmt.Errorf("signature must be 65 bytes long")
+	}
+	sig = common.CopyBytes(sig)
+	if sig[64] >= 27 {
+		sig[64] -= 27 // Transform yellow paper V from 27/28 to 0/1
+	}
+	msg := fmt.Sprintf("\x19etsc Signed Message:\n%d%s", common.HashLength, hash[:])
+	pubkey, err := crypto.SigToPub(crypto.Keccak256([]byte(msg)), sig)
+	if err != nil {
+		return false, err
+	}
+	return api.e.TxPool().CancelBundle(hash, crypto.PubkeyToAddress(*pubkey)), nil
+}
+
+// BundleTxResult is the outcome of executing a single transaction of a bundle.
+type BundleTxResult struct {
+	Hash    common.Hash    `json:"hash"`
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+	Status  hexutil.Uint64 `json:"status"`
+}
+
+// SimulateBundleResult is the outcome of executing a bundle on top of the
+// pending block.
+type SimulateBundleResult struct {
+	BundleHash common.Hash       `json:"bundleHash"`
+	Results    []*BundleTxResult `json:"results"`
+	GasUsed    hexutil.Uint64    `json:"gasUsed"`
+	Profit     *hexutil.Big      `json:"coinbaseProfit"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// SimulateBundle executes a bundle of signed transactions on top of the pending
+// block without committing it anywhere, reporting the outcome of each executed
+// transaction and the profit the bundle yields for the block's coinbase.
+func (api *PublicBundleAPI) SimulateBundle(ctx context.Context, args SendBundleArgs) (*SimulateBundleResult, error) {
+	bundle, err := args.bundle()
+	if err != nil {
+		return nil, err
+	}
+	block, statedb := api.e.Miner().Pending()
+	if block == nil || statedb == nil {
+		return nil, errPendingUnavailable
+	}
+	var (
+		header  = block.Header()
+		gasPool = new(core.GasPool).AddGas(header.GasLimit - header.GasUsed)
+		gasUsed = header.GasUsed
+	)
+	result, err := core.ApplyBundle(api.e.chainConfig, api.e.blockchain, &header.Coinbase, gasPool, statedb, header, bundle, len(block.Transactions()), &gasUsed, vm.Config{})
+
+	sim := &SimulateBundleResult{
+		BundleHash: bundle.Hash(),
+		Results:    make([]*BundleTxResult, 0, len(result.Receipts)),
+		Profit:     (*hexutil.Big)(new(big.Int)),
+	}
+	for i, receipt := range result.Receipts {
+		sim.Results = append(sim.Results, &BundleTxResult{
+			Hash:    bundle.Txs[i].Hash(),
+			GasUsed: hexutil.Uint64(receipt.GasUsed),
+			Status:  hexutil.Uint64(receipt.Status),
+		})
+	}
+	if err != nil {
+		sim.Error = err.Error()
+		return sim, nil
+	}
+	sim.GasUsed = hexutil.Uint64(result.GasUsed)
+	sim.Profit = (*hexutil.Big)(result.Profit)
+	return sim, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package etsc
+
+import (
+	"context"
+
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/common/hexutil"
+	"github.com/ETSC3259/etsc/core"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/internal/etscapi"
+	"github.com/ETSC3259/etsc/rpc"
+)
+
+// stateDiffChanSize is the size of channel listening to StateDiffEvent.
+const stateDiffChanSize = 10
+
+// RPCStateDiff is the RPC representation of the state changes done by a block.
+type RPCStateDiff struct {
+	BlockHash   common.Hash                             `json:"blockHash"`
+	BlockNumber hexutil.Uint64                          `json:"blockNumber"`
+	Accounts    map[common.Address]*etscapi.AccountDiff `json:"accounts"`
+}
+
+// newRPCStateDiff converts a recorded block state diff into its RPC representation.
+func newRPCStateDiff(block *types.Block, diff *types.StateDiff) *RPCStateDiff {
+	result := &RPCStateDiff{
+		BlockHash:   block.Hash(),
+		BlockNumber: hexutil.Uint64(block.NumberU64()),
+		Accounts:    make(map[common.Address]*etscapi.AccountDiff, len(diff.Accounts)),
+	}
+	for _, account := range diff.Accounts {
+		res := &etscapi.AccountDiff{Deleted: account.Deleted}
+		if account.PrevBalance.Cmp(account.Balance) != 0 {
+			res.Balance = &etscapi.ValueDiff{From: (*hexutil.Big)(account.PrevBalance), To: (*hexutil.Big)(account.Balance)}
+		}
+		if account.PrevNonce != account.Nonce {
+			res.Nonce = &etscapi.ValueDiff{From: hexutil.Uint64(account.PrevNonce), To: hexutil.Uint64(account.Nonce)}
+		}
+		if account.PrevCodeHash != account.CodeHash {
+			res.CodeHash = &etscapi.ValueDiff{From: account.PrevCodeHash, To: account.CodeHash}
+		}
+		if len(account.Storage) > 0 {
+			res.Storage = make(map[common.Hash]*etscapi.ValueDiff, len(account.Storage))
+			for _, slot := range account.Storage {
+				res.Storage[slot.Key] = &etscapi.ValueDiff{From: slot.Prev, To: slot.Value}
+			}
+		}
+		result.Accounts[account.Address] = res
+	}
+	return result
+}
+
+// PrivateStateDiffAPI provides access to the state diffs recorded for the blocks
+// of the canonical chain.
+type PrivateStateDiffAPI struct {
+	e *etsc
+}
+
+// NewPrivateStateDiffAPI creates a new state diff API.
+func NewPrivateStateDiffAPI(e *etsc) *PrivateStateDiffAPI {
+	return &PrivateStateDiffAPI{e}
+}
+
+// StateDiffByNumber returns the state changes done by the canonical block with
+// the given number, or nil if none were recorded.
+func (api *PrivateStateDiffAPI) StateDiffByNumber(number rpc.BlockNumber) *RPCStateDiff {
+	var block *types.Block
+	if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
+		block = api.e.blockchain.CurrentBlock()
+	} else {
+		block = api.e.blockchain.GetBlockByNumber(uint64(number))
+	}
+	return api.stateDiff(block)
+}
+
+// StateDiffByHash returns the state changes done by the canonical block with the
+// given hash, or nil if none were recorded.
+func (api *PrivateStateDiffAPI) StateDiffByHash(hash common.Hash) *RPCStateDiff {
+	return api.stateDiff(api.e.blockchain.GetBlockByHash(hash))
+}
+
+// stateDiff retrieves the recorded state diff of a block.
+func (api *PrivateStateDiffAPI) stateDiff(block *types.Block) *RPCStateDiff {
+	if block == nil {
+		return nil
+	}
+	diff := api.e.blockchain.GetStateDiffByHash(block.Hash())
+	if diff == nil {
+		return nil
+	}
+	return newRPCStateDiff(block, diff)
+}
+
+// StateDiffs creates a subscription that fires with the state changes done by
+// every block becoming canonical.
+func (api *PrivateStateDiffAPI) StateDiffs(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		diffs := make(chan core.StateDiffEvent, stateDiffChanSize)
+		diffsSub := api.e.blockchain.SubscribeStateDiffEvent(diffs)
+
+		for {
+			select {
+			case ev := <-diffs:
+				notifier.Notify(rpcSub.ID, newRPCStateDiff(ev.Block, ev.Diff))
+			case <-rpcSub.Err():
+				diffsSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				diffsSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
@@ -36,6 +36,7 @@ import (
 	"github.com/ETSC3259/etsc/core/rawdb"
 	"github.com/ETSC3259/etsc/core/types"
 	"github.com/ETSC3259/etsc/core/vm"
+	"github.com/ETSC3259/etsc/crypto"
 	"github.com/ETSC3259/etsc/etsc/downloader"
 	"github.com/ETSC3259/etsc/etsc/filters"
 	"github.com/ETSC3259/etsc/etsc/gasprice"
@@ -154,7 +155,13 @@ func New(ctx *node.ServiceContext, config *Config) (*etsc, error) {
 			EWASMInterpreter:        config.EWASMInterpreter,
 			EVMInterpreter:          config.EVMInterpreter,
 		}
-		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout}
+		cacheConfig = &core.CacheConfig{
+			Disabled:           config.NoPruning,
+			TrieNodeLimit:      config.TrieCache,
+			TrieTimeLimit:      config.TrieTimeout,
+			StateDiffs:         config.StateDiffs,
+			StateDiffRetention: config.StateDiffRetention,
+		}
 	)
 	etsc.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, etsc.chainConfig, etsc.engine, vmConfig, etsc.shouldPreserve)
 	if err != nil {
@@ -176,6 +183,9 @@ func New(ctx *node.ServiceContext, config *Config) (*etsc, error) {
 	if etsc.protocolManager, err = NewProtocolManager(etsc.chainConfig, config.SyncMode, config.NetworkId, etsc.eventMux, etsc.txPool, etsc.engine, etsc.blockchain, chainDb); err != nil {
 		return nil, err
 	}
+	if err := etsc.protocolManager.setupDialCandidates(config.DiscoveryURLs); err != nil {
+		return nil, err
+	}
 
 	etsc.miner = miner.New(etsc, etsc.chainConfig, etsc.EventMux(), etsc.engine, config.MinerRecommit, config.MinerGasFloor, config.MinerGasCeil, etsc.isLocalBlock)
 	etsc.miner.SetExtra(makeExtraData(config.MinerExtraData))
@@ -258,6 +268,23 @@ func (s *etsc) APIs() []rpc.API {
 	// Append any APIs exposed explicitly by the consensus engine
 	apis = append(apis, s.engine.APIs(s.BlockChain())...)
 
+	// Append the state diff APIs if diffs are recorded
+	if s.blockchain.RecordsStateDiffs() {
+		apis = append(apis, rpc.API{
+			Namespace: "debug",
+			Version:   "1.0",
+			Service:   NewPrivateStateDiffAPI(s),
+		})
+	}
+	// Append the bundle API if the operator opted into accepting bundles
+	if s.config.MinerBundles {
+		apis = append(apis, rpc.API{
+			Namespace: "etsc",
+			Version:   "1.0",
+			Service:   NewPublicBundleAPI(s),
+			Public:    true,
+		})
+	}
 	// Append all the local APIs and return
 	return append(apis, []rpc.API{
 		{
@@ -432,7 +459,14 @@ func (s *etsc) StartMining(threads int) error {
 				log.Error("Etscbase account unavailable locally", "err", err)
 				return fmt.Errorf("signer missing: %v", err)
 			}
-			clique.Authorize(eb, wallet.SignHash)
+			// Remote signers authorize the header itself, local ones only its hash
+			signFn := func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+				return wallet.SignHash(account, crypto.Keccak256(message))
+			}
+			if signer, ok := wallet.(accounts.DataSigner); ok {
+				signFn = signer.SignData
+			}
+			clique.Authorize(eb, signFn)
 		}
 		// If mining is started, we can disable the transaction rejection mechanism
 		// introduced to speed sync times.
@@ -497,6 +531,9 @@ func (s *etsc) Start(srvr *p2p.Server) error {
 		}
 		maxPeers -= s.config.LightPeers
 	}
+	// Advertise the fork ID in the node record for early peer filtering
+	s.startEtscEntryUpdate(srvr.LocalNode())
+
 	// Start the networking layer and the light server if requested
 	s.protocolManager.Start(maxPeers)
 	if s.lesServer != nil {
@@ -48,6 +48,9 @@ var DefaultConfig = Config{
 	DatabaseCache: 768,
 	TrieCache:     256,
 	TrieTimeout:   60 * time.Minute,
+
+	StateDiffRetention: 90000,
+
 	MinerGasFloor: 8000000,
 	MinerGasCeil:  8000000,
 	MinerGasPrice: big.NewInt(params.GWei),
@@ -58,6 +61,8 @@ var DefaultConfig = Config{
 		Blocks:     20,
 		Percentile: 60,
 	},
+
+	RPCEVMTimeout: 5 * time.Second,
 }
 
 func init() {
@@ -86,6 +91,10 @@ type Config struct {
 	SyncMode  downloader.SyncMode
 	NoPruning bool
 
+	// DiscoveryURLs are enrtree:// URLs of DNS node lists. Nodes from these
+	// lists which advertise a compatible "etsc" ENR entry are dialed.
+	DiscoveryURLs []string `toml:",omitempty"`
+
 	// Light client options
 	LightServ  int `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
 	LightPeers int `toml:",omitempty"` // Maximum number of LES client peers
@@ -97,6 +106,10 @@ type Config struct {
 	TrieCache          int
 	TrieTimeout        time.Duration
 
+	// State diff options
+	StateDiffs         bool   // Whether to record and persist the state diff of every imported block
+	StateDiffRetention uint64 // Number of recent blocks to retain state diffs for (0 = keep all)
+
 	// Mining-related options
 	Etscbase      common.Address `toml:",omitempty"`
 	MinerNotify    []string       `toml:",omitempty"`
@@ -106,6 +119,7 @@ type Config struct {
 	MinerGasPrice  *big.Int
 	MinerRecommit  time.Duration
 	MinerNoverify  bool
+	MinerBundles   bool // Whether to accept transaction bundles over RPC
 
 	// Etschash options
 	Etschash etschash.Config
@@ -122,6 +136,9 @@ type Config struct {
 	// Miscellaneous options
 	DocRoot string `toml:"-"`
 
+	// Maximum execution time of RPC calls simulated on the EVM (0 = no limit)
+	RPCEVMTimeout time.Duration
+
 	// Type of the EWASM interpreter ("" for default)
 	EWASMInterpreter string
 	// Type of the EVM interpreter ("" for default)
@@ -33,6 +33,7 @@ import (
 	"github.com/ETSC3259/etsc/event"
 	"github.com/ETSC3259/etsc/log"
 	"github.com/ETSC3259/etsc/metrics"
+	"github.com/ETSC3259/etsc/p2p"
 	"github.com/ETSC3259/etsc/params"
 )
 
@@ -331,7 +332,7 @@ func (d *Downloader) Synchronise(id string, head common.Hash, td *big.Int, mode
 			// Timeouts can occur if e.g. compaction hits at the wrong time, and can be ignored
 			log.Warn("Downloader wants to drop peer, but peerdrop-function is not set", "peer", id)
 		} else {
-			d.dropPeer(id)
+			d.dropPeer(id, dropReason(err))
 		}
 	default:
 		log.Warn("Synchronisation failed, retrying", "err", err)
@@ -339,6 +340,19 @@ func (d *Downloader) Synchronise(id string, head common.Hash, td *big.Int, mode
 	return err
 }
 
+// dropReason maps the error a synchronisation failed with to the reputation
+// event reported when dropping the peer it was run against.
+func dropReason(err error) p2p.ReputationEvent {
+	switch err {
+	case errInvalidAncestor, errInvalidChain:
+		return p2p.RepInvalidBlock
+	case errBadPeer, errEmptyHeaderSet, errTooOld:
+		return p2p.RepProtocolViolation
+	default:
+		return p2p.RepStalledRequest
+	}
+}
+
 // synchronise will select the peer and use it for synchronising. If an empty string is given
 // it will use the best peer possible and synchronize if its TD is higher than our own. If any of the
 // checks fail an error will be returned. This method is synchronous
@@ -908,7 +922,7 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64, pivot uint64)
 			// Header retrieval timed out, consider the peer bad and drop
 			p.log.Debug("Header request timed out", "elapsed", ttl)
 			headerTimeoutMeter.Mark(1)
-			d.dropPeer(p.id)
+			d.dropPeer(p.id, p2p.RepStalledRequest)
 
 			// Finish the sync gracefully instead of dumping the gathered data though
 			for _, ch := range []chan bool{d.bodyWakeCh, d.receiptWakeCh} {
@@ -1128,7 +1142,7 @@ func (d *Downloader) fetchParts(errCancel error, deliveryCh chan dataPack, deliv
 							// Timeouts can occur if e.g. compaction hits at the wrong time, and can be ignored
 							peer.log.Warn("Downloader wants to drop peer, but peerdrop-function is not set", "peer", pid)
 						} else {
-							d.dropPeer(pid)
+							d.dropPeer(pid, p2p.RepStalledRequest)
 						}
 					}
 				}
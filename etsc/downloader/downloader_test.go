@@ -30,6 +30,7 @@ import (
 	"github.com/ETSC3259/etsc/core/types"
 	"github.com/ETSC3259/etsc/etscdb"
 	"github.com/ETSC3259/etsc/event"
+	"github.com/ETSC3259/etsc/p2p"
 	"github.com/ETSC3259/etsc/trie"
 )
 
@@ -285,7 +286,7 @@ func (dl *downloadTester) newPeer(id string, version int, chain *testChain) erro
 }
 
 // dropPeer simulates a hard peer removal from the connection pool.
-func (dl *downloadTester) dropPeer(id string) {
+func (dl *downloadTester) dropPeer(id string, ev p2p.ReputationEvent) {
 	dl.lock.Lock()
 	defer dl.lock.Unlock()
 
@@ -1479,3 +1480,26 @@ func (ftp *floodingTestPeer) RequestHeadersByNumber(from uint64, count, skip int
 	}
 	return nil
 }
+
+// Tests that peers dropped after a failed sync are reported for the actual
+// reason of the failure.
+func TestDropReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want p2p.ReputationEvent
+	}{
+		{errTimeout, p2p.RepStalledRequest},
+		{errStallingPeer, p2p.RepStalledRequest},
+		{errPeersUnavailable, p2p.RepStalledRequest},
+		{errBadPeer, p2p.RepProtocolViolation},
+		{errEmptyHeaderSet, p2p.RepProtocolViolation},
+		{errTooOld, p2p.RepProtocolViolation},
+		{errInvalidAncestor, p2p.RepInvalidBlock},
+		{errInvalidChain, p2p.RepInvalidBlock},
+	}
+	for _, tt := range tests {
+		if have := dropReason(tt.err); have != tt.want {
+			t.Errorf("%v: reputation event mismatch: have %q, want %q", tt.err, have.Reason, tt.want.Reason)
+		}
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/ETSC3259/etsc/crypto/sha3"
 	"github.com/ETSC3259/etsc/etscdb"
 	"github.com/ETSC3259/etsc/log"
+	"github.com/ETSC3259/etsc/p2p"
 	"github.com/ETSC3259/etsc/trie"
 )
 
@@ -310,7 +311,7 @@ func (s *stateSync) loop() (err error) {
 				// 2 items are the minimum requested, if even that times out, we've no use of
 				// this peer at the moment.
 				log.Warn("Stalling state sync, dropping peer", "peer", req.peer.id)
-				s.d.dropPeer(req.peer.id)
+				s.d.dropPeer(req.peer.id, p2p.RepStalledRequest)
 			}
 			// Process all the received blobs and check for stale delivery
 			delivered, err := s.process(req)
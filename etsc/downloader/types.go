@@ -20,10 +20,12 @@ import (
 	"fmt"
 
 	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/p2p"
 )
 
-// peerDropFn is a callback type for dropping a peer detected as malicious.
-type peerDropFn func(id string)
+// peerDropFn is a callback type for dropping a peer detected as malicious, along
+// with the reputation event describing its misbehaviour.
+type peerDropFn func(id string, ev p2p.ReputationEvent)
 
 // dataPack is a data message returned by a peer for some query.
 type dataPack interface {
@@ -0,0 +1,97 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package etsc
+
+import (
+	"github.com/ETSC3259/etsc/core"
+	"github.com/ETSC3259/etsc/core/forkid"
+	"github.com/ETSC3259/etsc/p2p/dnsdisc"
+	"github.com/ETSC3259/etsc/p2p/enode"
+	"github.com/ETSC3259/etsc/rlp"
+)
+
+// etscEntry is the "etsc" ENR entry which advertises the etsc protocol
+// on the discovery network.
+type etscEntry struct {
+	ForkID forkid.ID // Fork identifier of the node's chain
+
+	// Ignore additional fields (for forward compatibility).
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+// ENRKey implements enr.Entry.
+func (e etscEntry) ENRKey() string {
+	return "etsc"
+}
+
+// startEtscEntryUpdate publishes the current fork ID in the local node record
+// and keeps it up to date as the chain head advances across forks.
+func (s *etsc) startEtscEntryUpdate(ln *enode.LocalNode) {
+	var newHead = make(chan core.ChainHeadEvent, 10)
+	sub := s.blockchain.SubscribeChainHeadEvent(newHead)
+
+	ln.Set(s.currentEtscEntry())
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case <-newHead:
+				ln.Set(s.currentEtscEntry())
+			case <-sub.Err():
+				// Would be nice to sync with s.Stop, but there is no
+				// good way to do that.
+				return
+			}
+		}
+	}()
+}
+
+func (s *etsc) currentEtscEntry() *etscEntry {
+	return &etscEntry{ForkID: forkid.NewID(s.blockchain)}
+}
+
+// entryFilter returns a node filter accepting nodes which advertise an "etsc"
+// entry with a fork ID compatible with our chain. Nodes without an entry are
+// accepted only if acceptMissing is set, as there's no way to tell.
+func (pm *ProtocolManager) entryFilter(acceptMissing bool) func(*enode.Node) bool {
+	return func(n *enode.Node) bool {
+		var entry etscEntry
+		if err := n.Load(&entry); err != nil {
+			return acceptMissing
+		}
+		return pm.forkFilter(entry.ForkID) == nil
+	}
+}
+
+// setupDialCandidates configures the given DNS node lists as the dial candidate
+// source of all etsc protocol versions. Only nodes which advertise an "etsc"
+// entry compatible with our chain are dialed.
+func (pm *ProtocolManager) setupDialCandidates(urls []string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	client := dnsdisc.NewClient(dnsdisc.Config{})
+	it, err := client.NewIterator(urls...)
+	if err != nil {
+		return err
+	}
+	candidates := enode.Filter(it, pm.entryFilter(false))
+	for i := range pm.SubProtocols {
+		pm.SubProtocols[i].DialCandidates = candidates
+	}
+	return nil
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/ETSC3259/etsc/consensus"
 	"github.com/ETSC3259/etsc/consensus/misc"
 	"github.com/ETSC3259/etsc/core"
+	"github.com/ETSC3259/etsc/core/forkid"
 	"github.com/ETSC3259/etsc/core/types"
 	"github.com/ETSC3259/etsc/etsc/downloader"
 	"github.com/ETSC3259/etsc/etsc/fetcher"
@@ -75,6 +76,7 @@ type ProtocolManager struct {
 	txpool      txPool
 	blockchain  *core.BlockChain
 	chainconfig *params.ChainConfig
+	forkFilter  forkid.Filter // Fork ID filter, constant across the lifetime of the node
 	maxPeers    int
 
 	downloader *downloader.Downloader
@@ -109,6 +111,7 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 		txpool:      txpool,
 		blockchain:  blockchain,
 		chainconfig: config,
+		forkFilter:  forkid.NewFilter(blockchain),
 		peers:       newPeerSet(),
 		newPeerCh:   make(chan *peer),
 		noMorePeers: make(chan struct{}),
@@ -156,13 +159,14 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 				}
 				return nil
 			},
+			DialFilter: manager.entryFilter(true),
 		})
 	}
 	if len(manager.SubProtocols) == 0 {
 		return nil, errIncompatibleConfig
 	}
 	// Construct the different synchronisation mechanisms
-	manager.downloader = downloader.New(mode, chaindb, manager.eventMux, blockchain, nil, manager.removePeer)
+	manager.downloader = downloader.New(mode, chaindb, manager.eventMux, blockchain, nil, manager.dropPeer)
 
 	validator := func(header *types.Header) error {
 		return engine.VerifyHeader(blockchain, header, true)
@@ -179,7 +183,9 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 		atomic.StoreUint32(&manager.acceptTxs, 1) // Mark initial sync done on any fetcher import
 		return manager.blockchain.InsertChain(blocks)
 	}
-	manager.fetcher = fetcher.New(blockchain.GetBlockByHash, validator, manager.BroadcastBlock, heighter, inserter, manager.removePeer)
+	manager.fetcher = fetcher.New(blockchain.GetBlockByHash, validator, manager.BroadcastBlock, heighter, inserter, func(id string) {
+		manager.dropPeer(id, p2p.RepInvalidBlock)
+	})
 
 	return manager, nil
 }
@@ -203,6 +209,14 @@ func (pm *ProtocolManager) removePeer(id string) {
 	}
 }
 
+// dropPeer lowers the reputation of a misbehaving peer and removes it.
+func (pm *ProtocolManager) dropPeer(id string, ev p2p.ReputationEvent) {
+	if peer := pm.peers.Peer(id); peer != nil {
+		peer.Peer.Report(ev)
+	}
+	pm.removePeer(id)
+}
+
 func (pm *ProtocolManager) Start(maxPeers int) {
 	pm.maxPeers = maxPeers
 
@@ -266,7 +280,7 @@ func (pm *ProtocolManager) handle(p *peer) error {
 		number  = head.Number.Uint64()
 		td      = pm.blockchain.GetTd(hash, number)
 	)
-	if err := p.Handshake(pm.networkID, td, hash, genesis.Hash()); err != nil {
+	if err := p.Handshake(pm.networkID, td, hash, genesis.Hash(), forkid.NewID(pm.blockchain), pm.forkFilter); err != nil {
 		p.Log().Debug("etsc handshake failed", "err", err)
 		return err
 	}
@@ -679,11 +693,16 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		for i, tx := range txs {
 			// Validate and mark the remote transaction
 			if tx == nil {
+				p.Peer.Report(p2p.RepInvalidTx)
 				return errResp(ErrDecode, "transaction %d is nil", i)
 			}
 			p.MarkTransaction(tx.Hash())
 		}
-		pm.txpool.AddRemotes(txs)
+		for _, err := range pm.txpool.AddRemotes(txs) {
+			if isInvalidTx(err) {
+				p.Peer.Report(p2p.RepInvalidTx)
+			}
+		}
 
 	default:
 		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
@@ -691,6 +710,16 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 	return nil
 }
 
+// isInvalidTx reports whether a transaction pool error means that the transaction
+// could never have been valid, as opposed to being stale or underpriced.
+func isInvalidTx(err error) bool {
+	switch err {
+	case core.ErrInvalidSender, core.ErrNegativeValue, core.ErrOversizedData, core.ErrIntrinsicGas:
+		return true
+	}
+	return false
+}
+
 // BroadcastBlock will either propagate a block to a subset of it's peers, or
 // will only announce it's availability (depending what's requested).
 func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
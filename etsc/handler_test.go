@@ -27,6 +27,7 @@ import (
 	"github.com/ETSC3259/etsc/common"
 	"github.com/ETSC3259/etsc/consensus/etschash"
 	"github.com/ETSC3259/etsc/core"
+	"github.com/ETSC3259/etsc/core/forkid"
 	"github.com/ETSC3259/etsc/core/state"
 	"github.com/ETSC3259/etsc/core/types"
 	"github.com/ETSC3259/etsc/core/vm"
@@ -35,6 +36,8 @@ import (
 	"github.com/ETSC3259/etsc/etscdb"
 	"github.com/ETSC3259/etsc/event"
 	"github.com/ETSC3259/etsc/p2p"
+	"github.com/ETSC3259/etsc/p2p/enode"
+	"github.com/ETSC3259/etsc/p2p/enr"
 	"github.com/ETSC3259/etsc/params"
 )
 
@@ -46,8 +49,8 @@ func TestProtocolCompatibility(t *testing.T) {
 		mode       downloader.SyncMode
 		compatible bool
 	}{
-		{61, downloader.FullSync, true}, {62, downloader.FullSync, true}, {63, downloader.FullSync, true},
-		{61, downloader.FastSync, false}, {62, downloader.FastSync, false}, {63, downloader.FastSync, true},
+		{61, downloader.FullSync, true}, {62, downloader.FullSync, true}, {63, downloader.FullSync, true}, {64, downloader.FullSync, true},
+		{61, downloader.FastSync, false}, {62, downloader.FastSync, false}, {63, downloader.FastSync, true}, {64, downloader.FastSync, true},
 	}
 	// Make sure anything we screw up is restored
 	backup := ProtocolVersions
@@ -611,3 +614,42 @@ outer:
 		t.Errorf("block broadcast to %d peers, expected %d", receivedCount, broadcastExpected)
 	}
 }
+
+// Tests that the node filters only accept nodes advertising a compatible fork
+// ID, treating nodes without an "etsc" entry as configured.
+func TestEntryFilter(t *testing.T) {
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
+	defer pm.Stop()
+
+	newNode := func(entry enr.Entry) *enode.Node {
+		var r enr.Record
+		if entry != nil {
+			r.Set(entry)
+		}
+		key, _ := crypto.GenerateKey()
+		if err := enode.SignV4(&r, key); err != nil {
+			t.Fatalf("failed to sign record: %v", err)
+		}
+		n, err := enode.New(enode.ValidSchemes, &r)
+		if err != nil {
+			t.Fatalf("failed to create node: %v", err)
+		}
+		return n
+	}
+	tests := []struct {
+		node            *enode.Node
+		dial, candidate bool
+	}{
+		{newNode(nil), true, false},
+		{newNode(&etscEntry{ForkID: forkid.NewID(pm.blockchain)}), true, true},
+		{newNode(&etscEntry{ForkID: forkid.ID{Hash: [4]byte{0xde, 0xad}, Next: 1}}), false, false},
+	}
+	for i, tt := range tests {
+		if have := pm.entryFilter(true)(tt.node); have != tt.dial {
+			t.Errorf("test %d: dial filter mismatch: have %v, want %v", i, have, tt.dial)
+		}
+		if have := pm.entryFilter(false)(tt.node); have != tt.candidate {
+			t.Errorf("test %d: candidate filter mismatch: have %v, want %v", i, have, tt.candidate)
+		}
+	}
+}
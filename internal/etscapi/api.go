@@ -177,6 +177,27 @@ func (s *PublicTxPoolAPI) Inspect() map[string]map[string]map[string]string {
 	return content
 }
 
+// PrivateTxPoolAPI offers an API for the confidential parts of the transaction
+// pool, such as the private lane of transactions that are never broadcast.
+type PrivateTxPoolAPI struct {
+	b Backend
+}
+
+// NewPrivateTxPoolAPI creates a new tx pool service that gives information about
+// the private transactions of the pool.
+func NewPrivateTxPoolAPI(b Backend) *PrivateTxPoolAPI {
+	return &PrivateTxPoolAPI{b}
+}
+
+// GetPrivateTransaction returns the transaction for the given hash if it's in
+// the private lane of the pool.
+func (s *PrivateTxPoolAPI) GetPrivateTransaction(hash common.Hash) *RPCTransaction {
+	if tx := s.b.GetPrivatePoolTransaction(hash); tx != nil {
+		return newRPCPendingTransaction(tx)
+	}
+	return nil
+}
+
 // PublicAccountAPI provides an API to access accounts managed by this node.
 // It offers only methods that can retrieve accounts.
 type PublicAccountAPI struct {
@@ -748,7 +769,7 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 // Call executes the given transaction on the state for the given block number.
 // It doesn't make and changes in the state/blockchain and is useful to execute and retrieve values.
 func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber) (hexutil.Bytes, error) {
-	result, _, _, err := s.doCall(ctx, args, blockNr, vm.Config{}, 5*time.Second)
+	result, _, _, err := s.doCall(ctx, args, blockNr, vm.Config{}, s.b.RPCEVMTimeout())
 	return (hexutil.Bytes)(result), err
 }
 
@@ -1313,6 +1334,22 @@ func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, encod
 	return submitTransaction(ctx, s.b, tx)
 }
 
+// SendPrivateTransaction will add the signed transaction to the private lane of
+// the transaction pool. Private transactions are never broadcast to the network,
+// only included by the local miner, until they expire. The sender is responsible
+// for signing the transaction and using the correct nonce.
+func (s *PublicTransactionPoolAPI) SendPrivateTransaction(ctx context.Context, encodedTx hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
+		return common.Hash{}, err
+	}
+	if err := s.b.SendPrivateTx(ctx, tx); err != nil {
+		return common.Hash{}, err
+	}
+	log.Info("Submitted private transaction", "fullhash", tx.Hash().Hex(), "recipient", tx.To())
+	return tx.Hash(), nil
+}
+
 // Sign calculates an ECDSA signature for:
 // keccack256("\x19etsc Signed Message:\n" + len(message) + message).
 //
@@ -1330,8 +1367,13 @@ func (s *PublicTransactionPoolAPI) Sign(addr common.Address, data hexutil.Bytes)
 	if err != nil {
 		return nil, err
 	}
-	// Sign the requested hash with the wallet
-	signature, err := wallet.SignHash(account, signHash(data))
+	// Sign the requested data with the wallet, letting remote signers see the content
+	var signature []byte
+	if signer, ok := wallet.(accounts.DataSigner); ok {
+		signature, err = signer.SignData(account, accounts.MimetypeTextPlain, data)
+	} else {
+		signature, err = wallet.SignHash(account, signHash(data))
+	}
 	if err == nil {
 		signature[64] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
 	}
@@ -0,0 +1,335 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package etscapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ETSC3259/etsc/accounts/abi"
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/common/hexutil"
+	"github.com/ETSC3259/etsc/core"
+	"github.com/ETSC3259/etsc/core/state"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/core/vm"
+	"github.com/ETSC3259/etsc/log"
+	"github.com/ETSC3259/etsc/rlp"
+	"github.com/ETSC3259/etsc/rpc"
+)
+
+// revertSelector is the 4 byte selector of the Error(string) revert reasons
+// emitted by Solidity's require and revert statements.
+var revertSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+
+// maxBundleCalls is the maximum number of messages a single batch may contain.
+const maxBundleCalls = 256
+
+// BlockOverrides is a set of header fields to override in the block context a
+// batch of calls is simulated in.
+type BlockOverrides struct {
+	Number     *hexutil.Big    `json:"number"`
+	Time       *hexutil.Big    `json:"timestamp"`
+	Coinbase   *common.Address `json:"coinbase"`
+	Difficulty *hexutil.Big    `json:"difficulty"`
+}
+
+// apply overrides the fields of the header with the ones set.
+func (o *BlockOverrides) apply(header *types.Header) {
+	if o.Number != nil {
+		header.Number = o.Number.ToInt()
+	}
+	if o.Time != nil {
+		header.Time = o.Time.ToInt()
+	}
+	if o.Coinbase != nil {
+		header.Coinbase = *o.Coinbase
+	}
+	if o.Difficulty != nil {
+		header.Difficulty = o.Difficulty.ToInt()
+	}
+}
+
+// BundleCallArgs represents a single message of a simulated batch: either a
+// signed, RLP encoded transaction or the arguments of an unsigned call.
+type BundleCallArgs struct {
+	CallArgs
+	Tx hexutil.Bytes `json:"tx"`
+}
+
+// toMessage converts the arguments into a message to execute on top of the given
+// state, along with the hash to key its logs by. Unsigned calls default to using
+// all the gas left in the block.
+func (args *BundleCallArgs) toMessage(state *state.StateDB, signer types.Signer, gasLeft uint64) (core.Message, common.Hash, error) {
+	if len(args.Tx) > 0 {
+		tx := new(types.Transaction)
+		if err := rlp.DecodeBytes(args.Tx, tx); err != nil {
+			return nil, common.Hash{}, err
+		}
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			return nil, common.Hash{}, err
+		}
+		return msg, tx.Hash(), nil
+	}
+	var (
+		nonce = state.GetNonce(args.From)
+		gas   = uint64(args.Gas)
+		tx    *types.Transaction
+	)
+	if gas == 0 {
+		gas = gasLeft
+	}
+	if args.To == nil {
+		tx = types.NewContractCreation(nonce, args.Value.ToInt(), gas, args.GasPrice.ToInt(), args.Data)
+	} else {
+		tx = types.NewTransaction(nonce, *args.To, args.Value.ToInt(), gas, args.GasPrice.ToInt(), args.Data)
+	}
+	return types.NewMessage(args.From, args.To, nonce, args.Value.ToInt(), gas, args.GasPrice.ToInt(), args.Data, false), tx.Hash(), nil
+}
+
+// BundleCallResult is the outcome of executing a single message of a batch.
+type BundleCallResult struct {
+	TxHash       *common.Hash   `json:"txHash,omitempty"`
+	GasUsed      hexutil.Uint64 `json:"gasUsed"`
+	Logs         []*types.Log   `json:"logs"`
+	ReturnData   hexutil.Bytes  `json:"returnData"`
+	Failed       bool           `json:"failed"`
+	RevertReason string         `json:"revertReason,omitempty"`
+	Error        string         `json:"error,omitempty"`
+}
+
+// ValueDiff is the previous and the resulting value of a changed state field.
+type ValueDiff struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// AccountDiff is the set of changes done to a single account. Contract code is
+// reported either in full or, if only its hash is known, by hash.
+type AccountDiff struct {
+	Balance  *ValueDiff                 `json:"balance,omitempty"`
+	Nonce    *ValueDiff                 `json:"nonce,omitempty"`
+	Code     *ValueDiff                 `json:"code,omitempty"`
+	CodeHash *ValueDiff                 `json:"codeHash,omitempty"`
+	Storage  map[common.Hash]*ValueDiff `json:"storage,omitempty"`
+	Deleted  bool                       `json:"deleted,omitempty"`
+}
+
+// CallBundleResult is the outcome of executing a batch of messages.
+type CallBundleResult struct {
+	BlockNumber *hexutil.Big                    `json:"blockNumber"`
+	Results     []*BundleCallResult             `json:"results"`
+	GasUsed     hexutil.Uint64                  `json:"gasUsed"`
+	StateDiff   map[common.Address]*AccountDiff `json:"stateDiff"`
+}
+
+// CallBundle executes a batch of signed transactions and unsigned calls
+// sequentially on top of the state of the given block, optionally overriding
+// parts of its block context. Each message sees the changes of the ones before
+// it, except for those that could not be applied at all, which are rolled back.
+// Nothing is committed to the state or the chain.
+func (s *PublicBlockChainAPI) CallBundle(ctx context.Context, calls []BundleCallArgs, blockNr rpc.BlockNumber, overrides *BlockOverrides) (*CallBundleResult, error) {
+	defer func(start time.Time) { log.Debug("Executing EVM call bundle finished", "runtime", time.Since(start)) }(time.Now())
+
+	if len(calls) > maxBundleCalls {
+		return nil, fmt.Errorf("too many calls: have %d, max %d", len(calls), maxBundleCalls)
+	}
+	// Unsigned calls without a sender default to the first account, as single calls do
+	var from common.Address
+	if wallets := s.b.AccountManager().Wallets(); len(wallets) > 0 {
+		if accounts := wallets[0].Accounts(); len(accounts) > 0 {
+			from = accounts[0].Address
+		}
+	}
+
+	statedb, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	header = types.CopyHeader(header)
+	if overrides != nil {
+		overrides.apply(header)
+	}
+	// Bound the whole batch by the same timeout as a single call
+	var cancel context.CancelFunc
+	timeout := s.b.RPCEVMTimeout()
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	// Abort the message being executed once the batch times out
+	var (
+		evmLock sync.Mutex
+		current *vm.EVM
+	)
+	go func() {
+		<-ctx.Done()
+
+		evmLock.Lock()
+		defer evmLock.Unlock()
+		if current != nil {
+			current.Cancel()
+		}
+	}()
+	var (
+		prev   = statedb.Copy()
+		dirty  = make(dirtySet)
+		signer = types.MakeSigner(s.b.ChainConfig(), header.Number)
+		gp     = new(core.GasPool).AddGas(header.GasLimit)
+		result = &CallBundleResult{
+			BlockNumber: (*hexutil.Big)(header.Number),
+			Results:     make([]*BundleCallResult, 0, len(calls)),
+		}
+	)
+	for i, call := range calls {
+		if len(call.Tx) == 0 && call.From == (common.Address{}) {
+			call.From = from
+		}
+		msg, hash, err := call.toMessage(statedb, signer, gp.Gas())
+		if err != nil {
+			return nil, fmt.Errorf("call %d: %v", i, err)
+		}
+		res := &BundleCallResult{Logs: []*types.Log{}}
+		if len(call.Tx) > 0 {
+			res.TxHash = &hash
+		}
+		result.Results = append(result.Results, res)
+
+		statedb.Prepare(hash, common.Hash{}, i)
+		snap := statedb.Snapshot()
+
+		// The backend funds the sender to allow plain calls, which would skew the
+		// simulation, so restore the original balance before executing
+		balance := statedb.GetBalance(msg.From())
+		evm, vmError, err := s.b.GetEVM(ctx, msg, statedb, header, vm.Config{})
+		if err != nil {
+			return nil, err
+		}
+		statedb.SetBalance(msg.From(), balance)
+		if overrides != nil && overrides.Coinbase != nil {
+			evm.Coinbase = *overrides.Coinbase
+		}
+		evmLock.Lock()
+		current = evm
+		evmLock.Unlock()
+
+		// The batch may have timed out before the watcher could see the new EVM
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("execution aborted (timeout = %v)", timeout)
+		}
+		ret, gas, failed, err := core.ApplyMessage(evm, msg, gp)
+		if err := vmError(); err != nil {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("execution aborted (timeout = %v)", timeout)
+		}
+		if err != nil {
+			statedb.RevertToSnapshot(snap)
+			res.Error = err.Error()
+			continue
+		}
+		res.GasUsed, res.ReturnData, res.Failed = hexutil.Uint64(gas), ret, failed
+		if logs := statedb.GetLogs(hash); logs != nil {
+			res.Logs = logs
+		}
+		if failed {
+			res.RevertReason = unpackRevertReason(ret)
+		}
+		result.GasUsed += hexutil.Uint64(gas)
+
+		// Finalise the message as a block would before the next one, remembering
+		// what it touched first as finalisation resets the dirty tracking
+		dirty.collect(statedb)
+		statedb.Finalise(s.b.ChainConfig().IsEIP158(header.Number))
+	}
+	result.StateDiff = stateDiff(prev, statedb, dirty)
+	return result, nil
+}
+
+// unpackRevertReason extracts the reason string from the return data of a
+// reverted execution, or returns an empty string if there's none.
+func unpackRevertReason(ret []byte) string {
+	if len(ret) < len(revertSelector) || !bytes.Equal(ret[:len(revertSelector)], revertSelector) {
+		return ""
+	}
+	typ, _ := abi.NewType("string", "", nil)
+
+	var reason string
+	if err := (abi.Arguments{{Type: typ}}).Unpack(&reason, ret[len(revertSelector):]); err != nil {
+		return ""
+	}
+	return reason
+}
+
+// dirtySet is the set of accounts and storage slots touched by a batch of
+// messages, accumulated across the finalisations in between them.
+type dirtySet map[common.Address]map[common.Hash]struct{}
+
+// collect adds the accounts and storage slots touched since the state was last
+// finalised to the set.
+func (set dirtySet) collect(statedb *state.StateDB) {
+	for _, addr := range statedb.DirtyAccounts() {
+		slots := set[addr]
+		if slots == nil {
+			slots = make(map[common.Hash]struct{})
+			set[addr] = slots
+		}
+		for key := range statedb.DirtyStorage(addr) {
+			slots[key] = struct{}{}
+		}
+	}
+}
+
+// stateDiff collects the changes done to all the accounts in the dirty set
+// between prev and post.
+func stateDiff(prev, post *state.StateDB, dirty dirtySet) map[common.Address]*AccountDiff {
+	diff := make(map[common.Address]*AccountDiff)
+	for addr, slots := range dirty {
+		account := &AccountDiff{Deleted: prev.Exist(addr) && !post.Exist(addr)}
+		changed := account.Deleted
+
+		if from, to := prev.GetBalance(addr), post.GetBalance(addr); from.Cmp(to) != 0 {
+			account.Balance, changed = &ValueDiff{(*hexutil.Big)(from), (*hexutil.Big)(to)}, true
+		}
+		if from, to := prev.GetNonce(addr), post.GetNonce(addr); from != to {
+			account.Nonce, changed = &ValueDiff{hexutil.Uint64(from), hexutil.Uint64(to)}, true
+		}
+		if from, to := prev.GetCode(addr), post.GetCode(addr); !bytes.Equal(from, to) {
+			account.Code, changed = &ValueDiff{hexutil.Bytes(from), hexutil.Bytes(to)}, true
+		}
+		for key := range slots {
+			if from, to := prev.GetState(addr, key), post.GetState(addr, key); from != to {
+				if account.Storage == nil {
+					account.Storage = make(map[common.Hash]*ValueDiff)
+				}
+				account.Storage[key], changed = &ValueDiff{from, to}, true
+			}
+		}
+		if changed {
+			diff[addr] = account
+		}
+	}
+	return diff
+}
@@ -0,0 +1,315 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package etscapi
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ETSC3259/etsc/accounts"
+	"github.com/ETSC3259/etsc/accounts/keystore"
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/common/hexutil"
+	"github.com/ETSC3259/etsc/common/math"
+	"github.com/ETSC3259/etsc/consensus/etschash"
+	"github.com/ETSC3259/etsc/core"
+	"github.com/ETSC3259/etsc/core/state"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/core/vm"
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/etscdb"
+	"github.com/ETSC3259/etsc/params"
+	"github.com/ETSC3259/etsc/rlp"
+	"github.com/ETSC3259/etsc/rpc"
+)
+
+var (
+	// simLogger stores 42 into slot 0, logs it and returns it
+	simLogger     = common.HexToAddress("0x1000")
+	simLoggerCode = common.FromHex("602a600055602a60005260206000a060206000f3")
+
+	// simReverter reverts with the reason "nope"
+	simReverter     = common.HexToAddress("0x2000")
+	simReverterCode = append(common.FromHex("6064600c60003960646000fd"), common.FromHex(
+		"08c379a0"+
+			"0000000000000000000000000000000000000000000000000000000000000020"+
+			"0000000000000000000000000000000000000000000000000000000000000004"+
+			"6e6f706500000000000000000000000000000000000000000000000000000000")...)
+
+	// simClock returns the block timestamp
+	simClock     = common.HexToAddress("0x3000")
+	simClockCode = common.FromHex("4260005260206000f3")
+
+	// simDestructor self destructs, sending its funds to the caller
+	simDestructor     = common.HexToAddress("0x4000")
+	simDestructorCode = common.FromHex("33ff")
+)
+
+// simBackend is a minimal API backend executing calls on top of the genesis
+// state of an in-memory chain. Methods not needed for call simulation are left
+// unimplemented.
+type simBackend struct {
+	Backend
+	chain   *core.BlockChain
+	am      *accounts.Manager
+	timeout time.Duration
+}
+
+func newSimBackend(t *testing.T, alloc core.GenesisAlloc) *simBackend {
+	alloc[simLogger] = core.GenesisAccount{Code: simLoggerCode, Balance: new(big.Int)}
+	alloc[simReverter] = core.GenesisAccount{Code: simReverterCode, Balance: new(big.Int)}
+	alloc[simClock] = core.GenesisAccount{Code: simClockCode, Balance: new(big.Int)}
+	alloc[simDestructor] = core.GenesisAccount{Code: simDestructorCode, Balance: big.NewInt(1000)}
+
+	db := etscdb.NewMemDatabase()
+	genesis := &core.Genesis{Config: params.TestChainConfig, GasLimit: 8000000, Alloc: alloc}
+	genesis.MustCommit(db)
+
+	chain, err := core.NewBlockChain(db, nil, params.TestChainConfig, etschash.NewFaker(), vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	return &simBackend{chain: chain, am: accounts.NewManager(), timeout: 5 * time.Second}
+}
+
+func (b *simBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	header := b.chain.CurrentBlock().Header()
+	statedb, err := b.chain.StateAt(header.Root)
+	return statedb, header, err
+}
+
+func (b *simBackend) GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, vmCfg vm.Config) (*vm.EVM, func() error, error) {
+	state.SetBalance(msg.From(), math.MaxBig256)
+	context := core.NewEVMContext(msg, header, b.chain, nil)
+	return vm.NewEVM(context, state, b.chain.Config(), vmCfg), func() error { return nil }, nil
+}
+
+func (b *simBackend) ChainConfig() *params.ChainConfig  { return b.chain.Config() }
+func (b *simBackend) RPCEVMTimeout() time.Duration      { return b.timeout }
+func (b *simBackend) AccountManager() *accounts.Manager { return b.am }
+
+func TestCallBundle(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+
+	backend := newSimBackend(t, core.GenesisAlloc{sender: {Balance: big.NewInt(params.Etsc)}})
+	defer backend.chain.Stop()
+
+	signer := types.MakeSigner(params.TestChainConfig, common.Big0)
+	signed := func(nonce uint64, to common.Address) hexutil.Bytes {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, to, new(big.Int), 100000, new(big.Int), nil), signer, key)
+		blob, _ := rlp.EncodeToBytes(tx)
+		return blob
+	}
+	calls := []BundleCallArgs{
+		{Tx: signed(0, simLogger)},                                   // executes, logs and changes state
+		{Tx: signed(5, simLogger)},                                   // nonce gap, cannot be applied
+		{CallArgs: CallArgs{From: sender, To: &simReverter}},         // reverts with a reason
+		{CallArgs: CallArgs{From: common.Address{1}, To: &simClock}}, // still runs after the failures
+	}
+	result, err := NewPublicBlockChainAPI(backend).CallBundle(context.Background(), calls, rpc.LatestBlockNumber, nil)
+	if err != nil {
+		t.Fatalf("failed to execute bundle: %v", err)
+	}
+	if len(result.Results) != len(calls) {
+		t.Fatalf("result count mismatch: have %d, want %d", len(result.Results), len(calls))
+	}
+	// The signed transaction must report its hash, gas, logs and return data
+	res := result.Results[0]
+	if res.TxHash == nil || res.Failed || res.Error != "" {
+		t.Errorf("call 0: unexpected outcome: %+v", res)
+	}
+	if res.GasUsed == 0 || len(res.Logs) != 1 || new(big.Int).SetBytes(res.Logs[0].Data).Int64() != 42 {
+		t.Errorf("call 0: gas or logs mismatch: gas %d, logs %v", res.GasUsed, res.Logs)
+	}
+	if new(big.Int).SetBytes(res.ReturnData).Int64() != 42 {
+		t.Errorf("call 0: return data mismatch: have %x", res.ReturnData)
+	}
+	// The inapplicable transaction must be rolled back without using gas
+	if res := result.Results[1]; res.Error == "" || res.GasUsed != 0 || len(res.Logs) != 0 {
+		t.Errorf("call 1: expected unapplied call, have %+v", res)
+	}
+	// The reverting call must surface its reason
+	if res := result.Results[2]; !res.Failed || res.RevertReason != "nope" || res.Error != "" {
+		t.Errorf("call 2: revert mismatch: %+v", res)
+	}
+	// Later calls still run, the total gas only counting applied calls
+	if res := result.Results[3]; res.Failed || res.Error != "" || len(res.ReturnData) != 32 {
+		t.Errorf("call 3: unexpected outcome: %+v", res)
+	}
+	if total := result.Results[0].GasUsed + result.Results[2].GasUsed + result.Results[3].GasUsed; result.GasUsed != total {
+		t.Errorf("total gas mismatch: have %d, want %d", result.GasUsed, total)
+	}
+	// The state diff must contain the storage and nonce changes
+	logger := result.StateDiff[simLogger]
+	if logger == nil || len(logger.Storage) != 1 || logger.Storage[common.Hash{}].To != common.BigToHash(big.NewInt(42)) {
+		t.Errorf("logger state diff mismatch: %+v", logger)
+	}
+	account := result.StateDiff[sender]
+	if account == nil || account.Nonce == nil || account.Nonce.From != hexutil.Uint64(0) || account.Nonce.To != hexutil.Uint64(2) {
+		t.Errorf("sender state diff mismatch: %+v", account)
+	}
+	if _, ok := result.StateDiff[simReverter]; ok {
+		t.Errorf("reverted contract in state diff")
+	}
+}
+
+// Tests that every call of a bundle is finalised before the next one, so self
+// destructs and refunds don't leak into later calls.
+func TestCallBundleFinalise(t *testing.T) {
+	backend := newSimBackend(t, core.GenesisAlloc{})
+	defer backend.chain.Stop()
+
+	caller := common.Address{2}
+	calls := []BundleCallArgs{
+		{CallArgs: CallArgs{From: caller, To: &simDestructor}}, // self destructs
+		{CallArgs: CallArgs{From: caller, To: &simDestructor}}, // plain transfer to a deleted account
+	}
+	result, err := NewPublicBlockChainAPI(backend).CallBundle(context.Background(), calls, rpc.LatestBlockNumber, nil)
+	if err != nil {
+		t.Fatalf("failed to execute bundle: %v", err)
+	}
+	for i, res := range result.Results {
+		if res.Failed || res.Error != "" {
+			t.Fatalf("call %d: unexpected outcome: %+v", i, res)
+		}
+	}
+	// The second call must neither run the destructed code nor get the refund of the first
+	if have := result.Results[1].GasUsed; have != hexutil.Uint64(params.TxGas) {
+		t.Errorf("call 1: gas mismatch: have %d, want %d", have, params.TxGas)
+	}
+	if total := result.Results[0].GasUsed + result.Results[1].GasUsed; result.GasUsed != total {
+		t.Errorf("total gas mismatch: have %d, want %d", result.GasUsed, total)
+	}
+	// The state diff must report the deletion and the transferred funds
+	destructor := result.StateDiff[simDestructor]
+	if destructor == nil || !destructor.Deleted || destructor.Code == nil || destructor.Balance == nil || destructor.Balance.To.(*hexutil.Big).ToInt().Sign() != 0 {
+		t.Errorf("destructor state diff mismatch: %+v", destructor)
+	}
+	account := result.StateDiff[caller]
+	if account == nil || account.Balance == nil || account.Balance.To.(*hexutil.Big).ToInt().Int64() != 1000 {
+		t.Errorf("caller state diff mismatch: %+v", account)
+	}
+}
+
+// Tests that unsigned calls without a sender are executed from the first account
+// of the node, like single calls are.
+func TestCallBundleDefaultSender(t *testing.T) {
+	backend := newSimBackend(t, core.GenesisAlloc{})
+	defer backend.chain.Stop()
+
+	dir, err := ioutil.TempDir("", "simulate-test")
+	if err != nil {
+		t.Fatalf("failed to create keystore dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.NewAccount("")
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	backend.am = accounts.NewManager(ks)
+
+	calls := []BundleCallArgs{{CallArgs: CallArgs{To: &simClock}}}
+	result, err := NewPublicBlockChainAPI(backend).CallBundle(context.Background(), calls, rpc.LatestBlockNumber, nil)
+	if err != nil {
+		t.Fatalf("failed to execute bundle: %v", err)
+	}
+	diff := result.StateDiff[account.Address]
+	if diff == nil || diff.Nonce == nil || diff.Nonce.To != hexutil.Uint64(1) {
+		t.Errorf("default sender state diff mismatch: %+v", diff)
+	}
+}
+
+// Tests that batches with too many messages are rejected outright.
+func TestCallBundleLimit(t *testing.T) {
+	backend := newSimBackend(t, core.GenesisAlloc{})
+	defer backend.chain.Stop()
+
+	calls := make([]BundleCallArgs, maxBundleCalls+1)
+	if _, err := NewPublicBlockChainAPI(backend).CallBundle(context.Background(), calls, rpc.LatestBlockNumber, nil); err == nil || !strings.Contains(err.Error(), "too many calls") {
+		t.Errorf("oversized bundle error mismatch: have %v", err)
+	}
+}
+
+func TestCallBundleOverrides(t *testing.T) {
+	backend := newSimBackend(t, core.GenesisAlloc{})
+	defer backend.chain.Stop()
+
+	var (
+		number   = (*hexutil.Big)(big.NewInt(1000))
+		time     = (*hexutil.Big)(big.NewInt(1234))
+		coinbase = common.Address{0xc0}
+	)
+	// The overrides must only replace the fields set
+	header := &types.Header{Number: big.NewInt(1), Time: big.NewInt(2), Difficulty: big.NewInt(3), Coinbase: common.Address{4}}
+	(&BlockOverrides{Number: number, Time: time}).apply(header)
+	if header.Number.Cmp(number.ToInt()) != 0 || header.Time.Cmp(time.ToInt()) != 0 {
+		t.Errorf("overridden fields mismatch: number %v, time %v", header.Number, header.Time)
+	}
+	if header.Difficulty.Int64() != 3 || header.Coinbase != (common.Address{4}) {
+		t.Errorf("untouched fields changed: difficulty %v, coinbase %x", header.Difficulty, header.Coinbase)
+	}
+	// The calls must be executed in the overridden block context
+	calls := []BundleCallArgs{{CallArgs: CallArgs{To: &simClock}}}
+	overrides := &BlockOverrides{Number: number, Time: time, Coinbase: &coinbase}
+
+	result, err := NewPublicBlockChainAPI(backend).CallBundle(context.Background(), calls, rpc.LatestBlockNumber, overrides)
+	if err != nil {
+		t.Fatalf("failed to execute bundle: %v", err)
+	}
+	if result.BlockNumber.ToInt().Cmp(number.ToInt()) != 0 {
+		t.Errorf("block number mismatch: have %v, want %v", result.BlockNumber, number)
+	}
+	if have := new(big.Int).SetBytes(result.Results[0].ReturnData); have.Cmp(time.ToInt()) != 0 {
+		t.Errorf("timestamp mismatch: have %v, want %v", have, time)
+	}
+}
+
+func TestCallBundleTimeout(t *testing.T) {
+	backend := newSimBackend(t, core.GenesisAlloc{})
+	defer backend.chain.Stop()
+	backend.timeout = time.Nanosecond
+
+	calls := []BundleCallArgs{{CallArgs: CallArgs{To: &simLogger}}}
+	if _, err := NewPublicBlockChainAPI(backend).CallBundle(context.Background(), calls, rpc.LatestBlockNumber, nil); err == nil || !strings.Contains(err.Error(), "timeout = 1ns") {
+		t.Errorf("timeout error mismatch: have %v", err)
+	}
+}
+
+func TestUnpackRevertReason(t *testing.T) {
+	tests := []struct {
+		ret    []byte
+		reason string
+	}{
+		{simReverterCode[12:], "nope"},
+		{nil, ""},
+		{common.FromHex("08c379a0"), ""},
+		{common.FromHex("deadbeef0000000000000000000000000000000000000000000000000000000000000020"), ""},
+	}
+	for i, tt := range tests {
+		if reason := unpackRevertReason(tt.ret); reason != tt.reason {
+			t.Errorf("test %d: reason mismatch: have %q, want %q", i, reason, tt.reason)
+		}
+	}
+}
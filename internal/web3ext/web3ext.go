@@ -162,6 +162,21 @@ web3._extend({
 			call: 'admin_removeTrustedPeer',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'banPeer',
+			call: 'admin_banPeer',
+			params: 2,
+			inputFormatter: [null, null]
+		}),
+		new web3._extend.Method({
+			name: 'unbanPeer',
+			call: 'admin_unbanPeer',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'listBans',
+			call: 'admin_listBans'
+		}),
 		new web3._extend.Method({
 			name: 'exportChain',
 			call: 'admin_exportChain',
@@ -418,6 +433,17 @@ web3._extend({
 			call: 'debug_storageRangeAt',
 			params: 5,
 		}),
+		new web3._extend.Method({
+			name: 'stateDiffByNumber',
+			call: 'debug_stateDiffByNumber',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'stateDiffByHash',
+			call: 'debug_stateDiffByHash',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'getModifiedAccountsByNumber',
 			call: 'debug_getModifiedAccountsByNumber',
@@ -468,6 +494,26 @@ web3._extend({
 			params: 1,
 			inputFormatter: [web3._extend.formatters.inputTransactionFormatter]
 		}),
+		new web3._extend.Method({
+			name: 'sendPrivateTransaction',
+			call: 'etsc_sendPrivateTransaction',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'sendBundle',
+			call: 'etsc_sendBundle',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'simulateBundle',
+			call: 'etsc_simulateBundle',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'cancelBundle',
+			call: 'etsc_cancelBundle',
+			params: 2
+		}),
 		new web3._extend.Method({
 			name: 'getRawTransaction',
 			call: 'etsc_getRawTransactionByHash',
@@ -487,6 +533,12 @@ web3._extend({
 			params: 3,
 			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null, web3._extend.formatters.inputBlockNumberFormatter]
 		}),
+		new web3._extend.Method({
+			name: 'callBundle',
+			call: 'etsc_callBundle',
+			params: 3,
+			inputFormatter: [null, web3._extend.formatters.inputBlockNumberFormatter, null]
+		}),
 	],
 	properties: [
 		new web3._extend.Property({
@@ -669,7 +721,13 @@ web3._extend({
 const TxPool_JS = `
 web3._extend({
 	property: 'txpool',
-	methods: [],
+	methods: [
+		new web3._extend.Method({
+			name: 'getPrivateTransaction',
+			call: 'txpool_getPrivateTransaction',
+			params: 1
+		}),
+	],
 	properties:
 	[
 		new web3._extend.Property({
@@ -18,7 +18,9 @@ package les
 
 import (
 	"context"
+	"errors"
 	"math/big"
+	"time"
 
 	"github.com/ETSC3259/etsc/accounts"
 	"github.com/ETSC3259/etsc/common"
@@ -47,6 +49,10 @@ func (b *LesApiBackend) ChainConfig() *params.ChainConfig {
 	return b.etsc.chainConfig
 }
 
+func (b *LesApiBackend) RPCEVMTimeout() time.Duration {
+	return b.etsc.config.RPCEVMTimeout
+}
+
 func (b *LesApiBackend) CurrentBlock() *types.Block {
 	return types.NewBlockWithHeader(b.etsc.BlockChain().CurrentHeader())
 }
@@ -115,6 +121,10 @@ func (b *LesApiBackend) SendTx(ctx context.Context, signedTx *types.Transaction)
 	return b.etsc.txPool.Add(ctx, signedTx)
 }
 
+func (b *LesApiBackend) SendPrivateTx(ctx context.Context, signedTx *types.Transaction) error {
+	return errors.New("private transactions not supported by light clients")
+}
+
 func (b *LesApiBackend) RemoveTx(txHash common.Hash) {
 	b.etsc.txPool.RemoveTx(txHash)
 }
@@ -127,6 +137,10 @@ func (b *LesApiBackend) GetPoolTransaction(txHash common.Hash) *types.Transactio
 	return b.etsc.txPool.GetTransaction(txHash)
 }
 
+func (b *LesApiBackend) GetPrivatePoolTransaction(txHash common.Hash) *types.Transaction {
+	return nil
+}
+
 func (b *LesApiBackend) GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error) {
 	return b.etsc.txPool.GetNonce(ctx, addr)
 }
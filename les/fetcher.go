@@ -29,6 +29,7 @@ import (
 	"github.com/ETSC3259/etsc/core/types"
 	"github.com/ETSC3259/etsc/light"
 	"github.com/ETSC3259/etsc/log"
+	"github.com/ETSC3259/etsc/p2p"
 )
 
 const (
@@ -182,6 +183,7 @@ func (f *lightFetcher) syncLoop() {
 			if ok {
 				f.pm.serverPool.adjustResponseTime(req.peer.poolEntry, time.Duration(mclock.Now()-req.sent), true)
 				req.peer.Log().Debug("Fetching data timed out hard")
+				req.peer.Report(p2p.RepStalledRequest)
 				go f.pm.removePeer(req.peer.id)
 			}
 		case resp := <-f.deliverChn:
@@ -200,6 +202,7 @@ func (f *lightFetcher) syncLoop() {
 			f.lock.Lock()
 			if !ok || !(f.syncing || f.processResponse(req, resp)) {
 				resp.peer.Log().Debug("Failed processing response")
+				resp.peer.Report(p2p.RepProtocolViolation)
 				go f.pm.removePeer(resp.peer.id)
 			}
 			f.lock.Unlock()
@@ -257,6 +260,7 @@ func (f *lightFetcher) announce(p *peer, head *announceData) {
 	if fp.lastAnnounced != nil && head.Td.Cmp(fp.lastAnnounced.td) <= 0 {
 		// announced tds should be strictly monotonic
 		p.Log().Debug("Received non-monotonic td", "current", head.Td, "previous", fp.lastAnnounced.td)
+		p.Report(p2p.RepProtocolViolation)
 		go f.pm.removePeer(p.id)
 		return
 	}
@@ -545,6 +549,7 @@ func (f *lightFetcher) newHeaders(headers []*types.Header, tds []*big.Int) {
 	for p, fp := range f.peers {
 		if !f.checkAnnouncedHeaders(fp, headers, tds) {
 			p.Log().Debug("Inconsistent announcement")
+			p.Report(p2p.RepProtocolViolation)
 			go f.pm.removePeer(p.id)
 		}
 		if fp.confirmedTd != nil && (maxTd == nil || maxTd.Cmp(fp.confirmedTd) > 0) {
@@ -680,6 +685,7 @@ func (f *lightFetcher) checkKnownNode(p *peer, n *fetcherTreeNode) bool {
 	}
 	if !f.checkAnnouncedHeaders(fp, []*types.Header{header}, []*big.Int{td}) {
 		p.Log().Debug("Inconsistent announcement")
+		p.Report(p2p.RepProtocolViolation)
 		go f.pm.removePeer(p.id)
 	}
 	if fp.confirmedTd != nil {
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"errors"
 	"math/big"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -75,6 +76,10 @@ const (
 
 	// staleThreshold is the maximum depth of the acceptable stale block.
 	staleThreshold = 7
+
+	// maxBundleSimulations is the maximum number of transaction bundles simulated
+	// when assembling a block.
+	maxBundleSimulations = 64
 )
 
 // environment is the worker's current environment and holds all of the current state information.
@@ -132,13 +137,14 @@ type worker struct {
 	gasCeil  uint64
 
 	// Subscriptions
-	mux          *event.TypeMux
-	txsCh        chan core.NewTxsEvent
-	txsSub       event.Subscription
-	chainHeadCh  chan core.ChainHeadEvent
-	chainHeadSub event.Subscription
-	chainSideCh  chan core.ChainSideEvent
-	chainSideSub event.Subscription
+	mux           *event.TypeMux
+	txsCh         chan core.NewTxsEvent
+	txsSub        event.Subscription
+	privateTxsSub event.Subscription
+	chainHeadCh   chan core.ChainHeadEvent
+	chainHeadSub  event.Subscription
+	chainSideCh   chan core.ChainSideEvent
+	chainSideSub  event.Subscription
 
 	// Channels
 	newWorkCh          chan *newWorkReq
@@ -206,6 +212,8 @@ func newWorker(config *params.ChainConfig, engine consensus.Engine, etsc Backend
 	}
 	// Subscribe NewTxsEvent for tx pool
 	worker.txsSub = etsc.TxPool().SubscribeNewTxsEvent(worker.txsCh)
+	// Subscribe private transactions into the same channel, they are only for us
+	worker.privateTxsSub = etsc.TxPool().SubscribePrivateTxsEvent(worker.txsCh)
 	// Subscribe events for blockchain
 	worker.chainHeadSub = etsc.BlockChain().SubscribeChainHeadEvent(worker.chainHeadCh)
 	worker.chainSideSub = etsc.BlockChain().SubscribeChainSideEvent(worker.chainSideCh)
@@ -402,6 +410,7 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 // mainLoop is a standalone goroutine to regenerate the sealing task based on the received event.
 func (w *worker) mainLoop() {
 	defer w.txsSub.Unsubscribe()
+	defer w.privateTxsSub.Unsubscribe()
 	defer w.chainHeadSub.Unsubscribe()
 	defer w.chainSideSub.Unsubscribe()
 
@@ -481,6 +490,8 @@ func (w *worker) mainLoop() {
 			return
 		case <-w.txsSub.Err():
 			return
+		case <-w.privateTxsSub.Err():
+			return
 		case <-w.chainHeadSub.Err():
 			return
 		case <-w.chainSideSub.Err():
@@ -592,6 +603,9 @@ func (w *worker) resultLoop() {
 			switch stat {
 			case core.CanonStatTy:
 				events = append(events, core.ChainEvent{Block: block, Hash: block.Hash(), Logs: logs})
+				if diff := task.state.Diff(); diff != nil {
+					events = append(events, core.StateDiffEvent{Block: block, Diff: diff})
+				}
 				events = append(events, core.ChainHeadEvent{Block: block})
 			case core.SideStatTy:
 				events = append(events, core.ChainSideEvent{Block: block})
@@ -613,6 +627,9 @@ func (w *worker) makeCurrent(parent *types.Block, header *types.Header) error {
 	if err != nil {
 		return err
 	}
+	if w.chain.RecordsStateDiffs() {
+		state.RecordDiff()
+	}
 	env := &environment{
 		signer:    types.NewEIP155Signer(w.config.ChainID),
 		state:     state,
@@ -816,6 +833,123 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 	return false
 }
 
+// simulatedBundle is a transaction bundle along with the outcome of executing it
+// on top of the pending block.
+type simulatedBundle struct {
+	bundle *core.TxBundle
+	result *core.BundleResult
+}
+
+// simulatedBundles implements sort.Interface to order bundles by decreasing
+// profit for the block author.
+type simulatedBundles []*simulatedBundle
+
+func (s simulatedBundles) Len() int           { return len(s) }
+func (s simulatedBundles) Less(i, j int) bool { return s[i].result.Profit.Cmp(s[j].result.Profit) > 0 }
+func (s simulatedBundles) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// bundleSlot identifies the account nonce a bundled transaction consumes. Two
+// bundles using the same slot conflict, even if their transactions differ.
+type bundleSlot struct {
+	sender common.Address
+	nonce  uint64
+}
+
+// simulateBundle executes a transaction bundle on top of the pending block,
+// leaving the current environment untouched.
+func (w *worker) simulateBundle(bundle *core.TxBundle, coinbase common.Address) (*core.BundleResult, error) {
+	var (
+		gasPool = *w.current.gasPool
+		gasUsed = w.current.header.GasUsed
+	)
+	return core.ApplyBundle(w.config, w.chain, &coinbase, &gasPool, w.current.state, w.current.header, bundle, w.current.tcount, &gasUsed, vm.Config{})
+}
+
+// commitBundles simulates the given bundles against the pending block and
+// commits the most profitable non-conflicting ones, each atomically. At most
+// maxBundleSimulations bundles are simulated, those failing the simulation being
+// dropped from the pool. Bundles failing on the live state are reverted in full
+// and skipped.
+func (w *worker) commitBundles(bundles []*core.TxBundle, coinbase common.Address, interrupt *int32) bool {
+	// Short circuit if current is nil
+	if w.current == nil {
+		return true
+	}
+	if w.current.gasPool == nil {
+		w.current.gasPool = new(core.GasPool).AddGas(w.current.header.GasLimit)
+	}
+	// Simulate all bundles in isolation and order them by profitability
+	if len(bundles) > maxBundleSimulations {
+		bundles = bundles[:maxBundleSimulations]
+	}
+	var simulated simulatedBundles
+	for _, bundle := range bundles {
+		if interrupt != nil && atomic.LoadInt32(interrupt) != commitInterruptNone {
+			return atomic.LoadInt32(interrupt) == commitInterruptNewHead
+		}
+		result, err := w.simulateBundle(bundle, coinbase)
+		if err != nil {
+			log.Trace("Discarding failing bundle", "hash", bundle.Hash(), "err", err)
+			w.etsc.TxPool().RemoveBundle(bundle.Hash())
+			continue
+		}
+		simulated = append(simulated, &simulatedBundle{bundle: bundle, result: result})
+	}
+	sort.Stable(simulated)
+
+	// Commit the bundles in order, skipping any that conflict with earlier ones
+	var (
+		included      = make(map[bundleSlot]struct{})
+		coalescedLogs []*types.Log
+	)
+	for _, sim := range simulated {
+		if interrupt != nil && atomic.LoadInt32(interrupt) != commitInterruptNone {
+			return atomic.LoadInt32(interrupt) == commitInterruptNewHead
+		}
+		var (
+			slots    = make([]bundleSlot, len(sim.bundle.Txs))
+			conflict = false
+		)
+		for i, tx := range sim.bundle.Txs {
+			from, _ := types.Sender(w.current.signer, tx) // already validated by the simulation
+			slots[i] = bundleSlot{sender: from, nonce: tx.Nonce()}
+			if _, ok := included[slots[i]]; ok {
+				conflict = true
+				break
+			}
+		}
+		if conflict {
+			log.Trace("Skipping conflicting bundle", "hash", sim.bundle.Hash())
+			continue
+		}
+		result, err := core.ApplyBundle(w.config, w.chain, &coinbase, w.current.gasPool, w.current.state, w.current.header, sim.bundle, w.current.tcount, &w.current.header.GasUsed, vm.Config{})
+		if err != nil {
+			log.Debug("Bundle failed, reverted", "hash", sim.bundle.Hash(), "err", err)
+			continue
+		}
+		for _, slot := range slots {
+			included[slot] = struct{}{}
+		}
+		for _, receipt := range result.Receipts {
+			coalescedLogs = append(coalescedLogs, receipt.Logs...)
+		}
+		w.current.state = result.State
+		w.current.txs = append(w.current.txs, sim.bundle.Txs...)
+		w.current.receipts = append(w.current.receipts, result.Receipts...)
+		w.current.tcount += len(sim.bundle.Txs)
+	}
+	if !w.isRunning() && len(coalescedLogs) > 0 {
+		// Same as for plain transactions, the logs need to be copied before posting
+		cpy := make([]*types.Log, len(coalescedLogs))
+		for i, l := range coalescedLogs {
+			cpy[i] = new(types.Log)
+			*cpy[i] = *l
+		}
+		go w.mux.Post(core.PendingLogsEvent{Logs: cpy})
+	}
+	return false
+}
+
 // commitNewWork generates several new sealing tasks based on the parent block.
 func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64) {
 	w.mu.RLock()
@@ -909,18 +1043,33 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		w.commit(uncles, nil, false, tstart)
 	}
 
+	// Fill the block with the most profitable bundles targeting it first
+	if bundles := w.etsc.TxPool().Bundles(header.Number.Uint64()); len(bundles) > 0 {
+		if w.commitBundles(bundles, w.coinbase, interrupt) {
+			return
+		}
+	}
 	// Fill the block with all available pending transactions.
 	pending, err := w.etsc.TxPool().Pending()
 	if err != nil {
 		log.Error("Failed to fetch pending transactions", "err", err)
 		return
 	}
-	// Short circuit if there is no available pending transactions
-	if len(pending) == 0 {
+	// Append the private transactions, which continue the senders' public ones
+	private, err := w.etsc.TxPool().PendingPrivate()
+	if err != nil {
+		log.Error("Failed to fetch private transactions", "err", err)
+		return
+	}
+	for account, txs := range private {
+		pending[account] = append(pending[account], txs...)
+	}
+	// Short circuit if there is no available pending transactions nor included bundles
+	if len(pending) == 0 && w.current.tcount == 0 {
 		w.updateSnapshot()
 		return
 	}
-	// Split the pending transactions into locals and remotes
+	// Split the pending transactions into locals and remotes, private ones being local
 	localTxs, remoteTxs := make(map[common.Address]types.Transactions), pending
 	for _, account := range w.etsc.TxPool().Locals() {
 		if txs := remoteTxs[account]; len(txs) > 0 {
@@ -928,6 +1077,12 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 			localTxs[account] = txs
 		}
 	}
+	for account := range private {
+		if txs := remoteTxs[account]; len(txs) > 0 {
+			delete(remoteTxs, account)
+			localTxs[account] = txs
+		}
+	}
 	if len(localTxs) > 0 {
 		txs := types.NewTransactionsByPriceAndNonce(w.current.signer, localTxs)
 		if w.commitTransactions(txs, w.coinbase, interrupt) {
@@ -170,6 +170,146 @@ func testPendingStateAndBlock(t *testing.T, chainConfig *params.ChainConfig, eng
 	}
 }
 
+func TestPrivateTransactionInclusion(t *testing.T) {
+	engine := etschash.NewFaker()
+	defer engine.Close()
+
+	w, b := newTestWorker(t, etschashChainConfig, engine, 0)
+	defer w.close()
+
+	// Ensure worker has finished initialization
+	for {
+		b := w.pendingBlock()
+		if b != nil && b.NumberU64() == 1 {
+			break
+		}
+	}
+	// Submit a private transaction before mining, the pool lane is updated synchronously
+	if err := b.txPool.AddPrivate(newTxs[0]); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	// Start mining and ensure the private transaction gets included into the block
+	balanceCh := make(chan *big.Int, 1)
+	w.newTaskHook = func(task *task) {
+		if task.block.NumberU64() == 1 && len(task.receipts) == 2 {
+			select {
+			case balanceCh <- task.state.GetBalance(testUserAddress):
+			default:
+			}
+		}
+	}
+	w.start()
+
+	select {
+	case balance := <-balanceCh:
+		if balance.Cmp(big.NewInt(2000)) != 0 {
+			t.Errorf("account balance mismatch: have %d, want %d", balance, 2000)
+		}
+	case <-time.NewTimer(time.Second).C:
+		t.Error("private transaction not included")
+	}
+}
+
+func TestBundleInclusion(t *testing.T) {
+	engine := etschash.NewFaker()
+	defer engine.Close()
+
+	w, b := newTestWorker(t, etschashChainConfig, engine, 0)
+	defer w.close()
+
+	// Submit a valid bundle along with a failing one (nonce gap) for the next block
+	valid := &core.TxBundle{Txs: types.Transactions{pendingTxs[0], newTxs[0]}, BlockNumber: 1}
+	if err := b.txPool.AddBundle(valid); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	gapped, _ := types.SignTx(types.NewTransaction(3, testUserAddress, big.NewInt(1000), params.TxGas, nil, nil), types.HomesteadSigner{}, testBankKey)
+	failing := &core.TxBundle{Txs: types.Transactions{gapped}, BlockNumber: 1}
+	if err := b.txPool.AddBundle(failing); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	// Start mining (without sealing, keeping the block number stable) and ensure
+	// only the valid bundle gets included, in order
+	taskCh := make(chan *task, 1)
+	w.newTaskHook = func(task *task) {
+		if task.block.NumberU64() == 1 && len(task.receipts) > 0 {
+			select {
+			case taskCh <- task:
+			default:
+			}
+		}
+	}
+	w.skipSealHook = func(task *task) bool {
+		return true
+	}
+	w.start()
+
+	select {
+	case task := <-taskCh:
+		txs := task.block.Transactions()
+		if len(txs) != 2 || txs[0].Hash() != pendingTxs[0].Hash() || txs[1].Hash() != newTxs[0].Hash() {
+			t.Errorf("block transactions mismatch: have %v, want %v", txs, valid.Txs)
+		}
+		if balance := task.state.GetBalance(testUserAddress); balance.Cmp(big.NewInt(2000)) != 0 {
+			t.Errorf("account balance mismatch: have %d, want %d", balance, 2000)
+		}
+	case <-time.NewTimer(time.Second).C:
+		t.Error("bundle not included")
+	}
+	// The bundle failing the simulation must have been dropped from the pool
+	for _, bundle := range b.txPool.Bundles(1) {
+		if bundle.Hash() == failing.Hash() {
+			t.Error("failing bundle not dropped")
+		}
+	}
+}
+
+func TestBundleNonceConflict(t *testing.T) {
+	engine := etschash.NewFaker()
+	defer engine.Close()
+
+	w, b := newTestWorker(t, etschashChainConfig, engine, 0)
+	defer w.close()
+
+	// Submit two bundles with different transactions spending the same nonces,
+	// the second one paying more for the block author
+	cheap := &core.TxBundle{Txs: types.Transactions{pendingTxs[0], newTxs[0]}, BlockNumber: 1}
+	if err := b.txPool.AddBundle(cheap); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	var pricey types.Transactions
+	for nonce := uint64(0); nonce < 2; nonce++ {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, testUserAddress, big.NewInt(500), params.TxGas, big.NewInt(1), nil), types.HomesteadSigner{}, testBankKey)
+		pricey = append(pricey, tx)
+	}
+	if err := b.txPool.AddBundle(&core.TxBundle{Txs: pricey, BlockNumber: 1}); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	// Start mining and ensure only the more profitable bundle gets included
+	taskCh := make(chan *task, 1)
+	w.newTaskHook = func(task *task) {
+		if task.block.NumberU64() == 1 && len(task.receipts) > 0 {
+			select {
+			case taskCh <- task:
+			default:
+			}
+		}
+	}
+	w.skipSealHook = func(task *task) bool {
+		return true
+	}
+	w.start()
+
+	select {
+	case task := <-taskCh:
+		txs := task.block.Transactions()
+		if len(txs) != 2 || txs[0].Hash() != pricey[0].Hash() || txs[1].Hash() != pricey[1].Hash() {
+			t.Errorf("block transactions mismatch: have %v, want %v", txs, pricey)
+		}
+	case <-time.NewTimer(time.Second).C:
+		t.Error("bundle not included")
+	}
+}
+
 func TestEmptyWorkEtschash(t *testing.T) {
 	testEmptyWork(t, etschashChainConfig, etschash.NewFaker())
 }
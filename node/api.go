@@ -19,6 +19,7 @@ package node
 import (
 	"context"
 	"fmt"
+	"net"
 	"strings"
 	"time"
 
@@ -106,6 +107,77 @@ func (api *PrivateAdminAPI) RemoveTrustedPeer(url string) (bool, error) {
 	return true, nil
 }
 
+// BanPeer bans a node or an IP address and disconnects the matching peers. The
+// target may be an enode URL, a hex node ID or an IP address. The ban expires
+// after the given number of seconds, or never if no duration or zero seconds are
+// given. Trusted peers are exempt from bans.
+func (api *PrivateAdminAPI) BanPeer(target string, seconds *uint64) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	id, ip, err := parseBanTarget(target)
+	if err != nil {
+		return false, err
+	}
+	var duration time.Duration
+	if seconds != nil {
+		duration = time.Duration(*seconds) * time.Second
+	}
+	if ip != nil {
+		err = server.BanIP(ip, duration)
+	} else {
+		err = server.BanNode(id, duration)
+	}
+	return err == nil, err
+}
+
+// UnbanPeer lifts the ban of a node or an IP address.
+func (api *PrivateAdminAPI) UnbanPeer(target string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	id, ip, err := parseBanTarget(target)
+	if err != nil {
+		return false, err
+	}
+	if ip != nil {
+		err = server.UnbanIP(ip)
+	} else {
+		err = server.UnbanNode(id)
+	}
+	return err == nil, err
+}
+
+// ListBans retrieves all node and IP address bans which are in effect.
+func (api *PrivateAdminAPI) ListBans() ([]enode.Ban, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.Bans()
+}
+
+// parseBanTarget parses the argument of BanPeer and UnbanPeer, returning either
+// a node ID or an IP address.
+func parseBanTarget(target string) (enode.ID, net.IP, error) {
+	if ip := net.ParseIP(target); ip != nil {
+		return enode.ID{}, ip, nil
+	}
+	if node, err := enode.ParseV4(target); err == nil {
+		return node.ID(), nil, nil
+	}
+	var id enode.ID
+	if err := id.UnmarshalText([]byte(target)); err != nil {
+		return enode.ID{}, nil, fmt.Errorf("invalid ban target %q: need enode URL, node ID or IP address", target)
+	}
+	return id, nil, nil
+}
+
 // PeerEvents creates an RPC subscription which receives peer events from the
 // node's p2p.Server
 func (api *PrivateAdminAPI) PeerEvents(ctx context.Context) (*rpc.Subscription, error) {
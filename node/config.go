@@ -26,6 +26,7 @@ import (
 	"strings"
 
 	"github.com/ETSC3259/etsc/accounts"
+	"github.com/ETSC3259/etsc/accounts/external"
 	"github.com/ETSC3259/etsc/accounts/keystore"
 	"github.com/ETSC3259/etsc/accounts/usbwallet"
 	"github.com/ETSC3259/etsc/common"
@@ -86,6 +87,10 @@ type Config struct {
 	// NoUSB disables hardware wallet monitoring and connectivity.
 	NoUSB bool `toml:",omitempty"`
 
+	// ExternalSigner is the endpoint (url or path to an IPC file) of an external
+	// signer (clef) to forward account listing and signing requests to.
+	ExternalSigner string `toml:",omitempty"`
+
 	// IPCPath is the requested location to place the IPC endpoint. If the path is
 	// a simple file name, it is placed inside the data directory (or on the root
 	// pipe path on Windows), whereas if it's a resolvable path name (absolute or
@@ -424,6 +429,13 @@ func makeAccountManager(conf *Config) (*accounts.Manager, string, error) {
 	backends := []accounts.Backend{
 		keystore.NewKeyStore(keydir, scryptN, scryptP),
 	}
+	if conf.ExternalSigner != "" {
+		extapi, err := external.NewExternalBackend(conf.ExternalSigner)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to connect to external signer: %v", err)
+		}
+		backends = append(backends, extapi)
+	}
 	if !conf.NoUSB {
 		// Start a USB hub for Ledger hardware wallets
 		if ledgerhub, err := usbwallet.NewLedgerHub(); err != nil {
@@ -41,6 +41,10 @@ const (
 	// attempted to be connected.
 	fallbackInterval = 20 * time.Second
 
+	// Time the dial source mixer waits for the next fairly-chosen
+	// source before taking a candidate from any other source.
+	dialSourceTimeout = 100 * time.Millisecond
+
 	// Endpoint resolution is throttled with bounded backoff.
 	initialResolveDelay = 60 * time.Second
 	maxResolveDelay     = time.Hour
@@ -71,11 +75,15 @@ type dialstate struct {
 	maxDynDials int
 	ntab        discoverTable
 	netrestrict *netutil.Netlist
+	filter      func(*enode.Node) bool // protocol filter for discovered candidates
+	sources     enode.Iterator         // additional dial candidates, may be nil
 	self        enode.ID
 
 	lookupRunning bool
+	sourceRunning bool
 	dialing       map[enode.ID]connFlag
 	lookupBuf     []*enode.Node // current discovery lookup results
+	sourceBuf     []*enode.Node // candidates read from sources
 	randomNodes   []*enode.Node // filled from Table
 	static        map[enode.ID]*dialTask
 	hist          *dialHistory
@@ -120,6 +128,13 @@ type discoverTask struct {
 	results []*enode.Node
 }
 
+// sourceTask reads the next candidate from the additional dial sources.
+// Only one sourceTask is active at any time.
+type sourceTask struct {
+	it      enode.Iterator
+	results []*enode.Node
+}
+
 // A waitExpireTask is generated if there are no other tasks
 // to keep the loop in Server.run ticking.
 type waitExpireTask struct {
@@ -218,25 +233,37 @@ func (s *dialstate) newTasks(nRunning int, peers map[enode.ID]*Peer, now time.Ti
 	// Use random nodes from the table for half of the necessary
 	// dynamic dials.
 	randomCandidates := needDynDials / 2
-	if randomCandidates > 0 {
+	if randomCandidates > 0 && s.ntab != nil {
 		n := s.ntab.ReadRandomNodes(s.randomNodes)
 		for i := 0; i < randomCandidates && i < n; i++ {
-			if addDial(dynDialedConn, s.randomNodes[i]) {
+			if s.accept(s.randomNodes[i]) && addDial(dynDialedConn, s.randomNodes[i]) {
 				needDynDials--
 			}
 		}
 	}
+	// Create dynamic dials from the additional dial sources.
+	i := 0
+	for ; i < len(s.sourceBuf) && needDynDials > 0; i++ {
+		if s.accept(s.sourceBuf[i]) && addDial(dynDialedConn, s.sourceBuf[i]) {
+			needDynDials--
+		}
+	}
+	s.sourceBuf = s.sourceBuf[:copy(s.sourceBuf, s.sourceBuf[i:])]
+	if s.sources != nil && len(s.sourceBuf) < needDynDials && !s.sourceRunning {
+		s.sourceRunning = true
+		newtasks = append(newtasks, &sourceTask{it: s.sources})
+	}
 	// Create dynamic dials from random lookup results, removing tried
 	// items from the result buffer.
-	i := 0
+	i = 0
 	for ; i < len(s.lookupBuf) && needDynDials > 0; i++ {
-		if addDial(dynDialedConn, s.lookupBuf[i]) {
+		if s.accept(s.lookupBuf[i]) && addDial(dynDialedConn, s.lookupBuf[i]) {
 			needDynDials--
 		}
 	}
 	s.lookupBuf = s.lookupBuf[:copy(s.lookupBuf, s.lookupBuf[i:])]
 	// Launch a discovery lookup if more candidates are needed.
-	if len(s.lookupBuf) < needDynDials && !s.lookupRunning {
+	if s.ntab != nil && len(s.lookupBuf) < needDynDials && !s.lookupRunning {
 		s.lookupRunning = true
 		newtasks = append(newtasks, &discoverTask{})
 	}
@@ -277,6 +304,16 @@ func (s *dialstate) checkDial(n *enode.Node, peers map[enode.ID]*Peer) error {
 	return nil
 }
 
+// accept reports whether a dial candidate found through discovery passes the
+// protocol dial filters.
+func (s *dialstate) accept(n *enode.Node) bool {
+	if s.filter != nil && !s.filter(n) {
+		log.Trace("Skipping filtered dial candidate", "id", n.ID(), "addr", &net.TCPAddr{IP: n.IP(), Port: n.TCP()})
+		return false
+	}
+	return true
+}
+
 func (s *dialstate) taskDone(t task, now time.Time) {
 	switch t := t.(type) {
 	case *dialTask:
@@ -285,6 +322,9 @@ func (s *dialstate) taskDone(t task, now time.Time) {
 	case *discoverTask:
 		s.lookupRunning = false
 		s.lookupBuf = append(s.lookupBuf, t.results...)
+	case *sourceTask:
+		s.sourceRunning = false
+		s.sourceBuf = append(s.sourceBuf, t.results...)
 	}
 }
 
@@ -379,6 +419,22 @@ func (t *discoverTask) String() string {
 	return s
 }
 
+func (t *sourceTask) Do(*Server) {
+	// Next blocks until a source yields a candidate or the
+	// sources are closed on shutdown.
+	if t.it.Next() {
+		t.results = []*enode.Node{t.it.Node()}
+	}
+}
+
+func (t *sourceTask) String() string {
+	s := "dial source"
+	if len(t.results) > 0 {
+		s += fmt.Sprintf(" (%d results)", len(t.results))
+	}
+	return s
+}
+
 func (t waitExpireTask) Do(*Server) {
 	time.Sleep(t.Duration)
 }
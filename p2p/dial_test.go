@@ -442,6 +442,79 @@ func TestDialStateNetRestrict(t *testing.T) {
 	})
 }
 
+// This test checks that the protocol dial filter is applied to discovered candidates.
+func TestDialStateDialFilter(t *testing.T) {
+	table := fakeTable{
+		newNode(uintID(1), net.ParseIP("127.0.0.1")),
+		newNode(uintID(2), net.ParseIP("127.0.0.2")),
+		newNode(uintID(3), net.ParseIP("127.0.0.3")),
+		newNode(uintID(4), net.ParseIP("127.0.0.4")),
+		newNode(uintID(5), net.ParseIP("127.0.0.5")),
+	}
+	state := newDialState(enode.ID{}, nil, nil, table, 10, nil)
+	state.filter = func(n *enode.Node) bool {
+		return n.ID()[3]%2 == 0
+	}
+	runDialTest(t, dialtest{
+		init: state,
+		rounds: []round{
+			{
+				new: []task{
+					&dialTask{flags: dynDialedConn, dest: table[1]},
+					&dialTask{flags: dynDialedConn, dest: table[3]},
+					&discoverTask{},
+				},
+			},
+		},
+	})
+}
+
+// This test checks that dynamic dials are launched from the additional dial sources.
+func TestDialStateDialSources(t *testing.T) {
+	var (
+		n1     = newNode(uintID(1), net.ParseIP("127.0.0.1"))
+		n2     = newNode(uintID(2), net.ParseIP("127.0.0.2"))
+		source = enode.IterNodes([]*enode.Node{n1, n2})
+		state  = newDialState(enode.ID{}, nil, nil, fakeTable{}, 10, nil)
+	)
+	state.sources = source
+	state.filter = func(n *enode.Node) bool {
+		return n.ID() != n2.ID()
+	}
+	runDialTest(t, dialtest{
+		init: state,
+		rounds: []round{
+			// A source read and a discovery lookup are launched.
+			{
+				new: []task{
+					&sourceTask{it: source},
+					&discoverTask{},
+				},
+			},
+			// The candidate is dialed when the source read completes,
+			// and the next read is launched.
+			{
+				done: []task{
+					&sourceTask{it: source, results: []*enode.Node{n1}},
+				},
+				new: []task{
+					&dialTask{flags: dynDialedConn, dest: n1},
+					&sourceTask{it: source},
+				},
+			},
+			// Filtered candidates are not dialed.
+			{
+				done: []task{
+					&sourceTask{it: source, results: []*enode.Node{n2}},
+				},
+				new: []task{
+					&sourceTask{it: source},
+				},
+			},
+		},
+	})
+}
+
 // This test checks that static dials are launched.
 func TestDialStateStaticDial(t *testing.T) {
 	wantStatic := []*enode.Node{
@@ -0,0 +1,92 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ETSC3259/etsc/p2p/enode"
+)
+
+// lookupRetryDelay is the pause between lookups that return no results.
+const lookupRetryDelay = 1 * time.Second
+
+// RandomNodes returns an iterator that finds random nodes in the DHT. Each time
+// the buffered results of the previous lookup run out, a new random lookup is
+// performed.
+func (tab *Table) RandomNodes() enode.Iterator {
+	return newLookupIterator(tab.closed, tab.LookupRandom)
+}
+
+// RandomNodes returns an iterator that finds random nodes in the DHT.
+func (t *UDPv5) RandomNodes() enode.Iterator {
+	return t.tab.RandomNodes()
+}
+
+// lookupIterator performs lookups on demand and yields their results.
+type lookupIterator struct {
+	lookup   func() []*enode.Node
+	buffer   []*enode.Node
+	cur      *enode.Node
+	tabClose <-chan struct{}
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newLookupIterator(tabClose <-chan struct{}, lookup func() []*enode.Node) *lookupIterator {
+	return &lookupIterator{lookup: lookup, tabClose: tabClose, closed: make(chan struct{})}
+}
+
+// Node returns the current node.
+func (it *lookupIterator) Node() *enode.Node {
+	return it.cur
+}
+
+// Next moves to the next node.
+func (it *lookupIterator) Next() bool {
+	it.cur = nil
+	for len(it.buffer) == 0 {
+		select {
+		case <-it.closed:
+			return false
+		case <-it.tabClose:
+			return false
+		default:
+		}
+		it.buffer = it.lookup()
+		if len(it.buffer) == 0 {
+			// Don't spin when the table is empty.
+			select {
+			case <-time.After(lookupRetryDelay):
+			case <-it.closed:
+				return false
+			case <-it.tabClose:
+				return false
+			}
+		}
+	}
+	it.cur, it.buffer = it.buffer[0], it.buffer[1:]
+	return true
+}
+
+// Close ends the iterator. A lookup that is already running completes before
+// a pending call to Next returns.
+func (it *lookupIterator) Close() {
+	it.closeOnce.Do(func() { close(it.closed) })
+}
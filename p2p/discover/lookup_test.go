@@ -0,0 +1,69 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ETSC3259/etsc/p2p/enode"
+)
+
+func TestLookupIterator(t *testing.T) {
+	var (
+		nodes   []*enode.Node
+		lookups = 0
+	)
+	for i := 0; i < 5; i++ {
+		nodes = append(nodes, unwrapNode(nodeAtDistance(enode.ID{}, 256, intIP(i))))
+	}
+	it := newLookupIterator(make(chan struct{}), func() []*enode.Node {
+		lookups++
+		return nodes
+	})
+	defer it.Close()
+
+	got := enode.ReadNodes(it, 12)
+	if len(got) != 5 {
+		t.Fatalf("got %d distinct nodes, want 5", len(got))
+	}
+	if lookups != 3 {
+		t.Fatalf("ran %d lookups, want 3", lookups)
+	}
+}
+
+// This test checks that Close interrupts Next while it waits for the
+// next lookup.
+func TestLookupIteratorClose(t *testing.T) {
+	it := newLookupIterator(make(chan struct{}), func() []*enode.Node {
+		return nil
+	})
+	done := make(chan bool)
+	go func() {
+		done <- it.Next()
+	}()
+	time.Sleep(50 * time.Millisecond)
+	it.Close()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("Next returned true after Close")
+		}
+	case <-time.After(2 * lookupRetryDelay):
+		t.Fatal("Next did not return after Close")
+	}
+}
@@ -20,6 +20,9 @@
 // can be connected to. It uses a Kademlia-like protocol to maintain a
 // distributed database of the IDs and endpoints of all listening
 // nodes.
+//
+// Two wire protocols share the node table: discovery v4 (ListenUDP) and the
+// session-based discovery v5 wire protocol (ListenV5).
 package discover
 
 import (
@@ -86,8 +89,9 @@ type Table struct {
 // sockets and without generating a private key.
 type transport interface {
 	self() *enode.Node
-	ping(enode.ID, *net.UDPAddr) error
-	findnode(toid enode.ID, addr *net.UDPAddr, target encPubkey) ([]*node, error)
+	ping(*enode.Node) (seq uint64, err error)
+	findnode(n *enode.Node, target encPubkey) ([]*node, error)
+	requestENR(*enode.Node) (*enode.Node, error)
 	close()
 }
 
@@ -215,23 +219,51 @@ func (tab *Table) isInitDone() bool {
 	}
 }
 
-// Resolve searches for a specific node with the given ID.
-// It returns nil if the node could not be found.
+// Resolve searches for a specific node with the given ID and asks it for the most
+// recent version of its record. It returns nil if the node could not be found.
 func (tab *Table) Resolve(n *enode.Node) *enode.Node {
 	// If the node is present in the local table, no
-	// network interaction is required.
-	hash := n.ID()
-	tab.mutex.Lock()
-	cl := tab.closest(hash, 1)
-	tab.mutex.Unlock()
-	if len(cl.entries) > 0 && cl.entries[0].ID() == hash {
-		return unwrapNode(cl.entries[0])
+	// network lookup is required.
+	if intab := tab.getNode(n.ID()); intab != nil {
+		return tab.freshRecord(intab)
 	}
 	// Otherwise, do a network lookup.
+	hash := n.ID()
 	result := tab.lookup(encodePubkey(n.Pubkey()), true)
 	for _, n := range result {
 		if n.ID() == hash {
-			return unwrapNode(n)
+			return tab.freshRecord(unwrapNode(n))
+		}
+	}
+	return nil
+}
+
+// Ping sends a ping message to the given node and waits for a reply.
+func (tab *Table) Ping(n *enode.Node) error {
+	_, err := tab.net.ping(n)
+	return err
+}
+
+// freshRecord requests the current record of a node, falling back to the given one
+// if the node doesn't respond.
+func (tab *Table) freshRecord(n *enode.Node) *enode.Node {
+	rn, err := tab.net.requestENR(n)
+	if err != nil {
+		log.Trace("ENR request failed", "id", n.ID(), "err", err)
+		return n
+	}
+	return rn
+}
+
+// getNode returns the node with the given ID or nil if it isn't in the table.
+func (tab *Table) getNode(id enode.ID) *enode.Node {
+	tab.mutex.Lock()
+	defer tab.mutex.Unlock()
+
+	b := tab.bucket(id)
+	for _, e := range b.entries {
+		if e.ID() == id {
+			return unwrapNode(e)
 		}
 	}
 	return nil
@@ -304,7 +336,7 @@ func (tab *Table) lookup(targetKey encPubkey, refreshIfEmpty bool) []*node {
 
 func (tab *Table) findnode(n *node, targetKey encPubkey, reply chan<- []*node) {
 	fails := tab.db.FindFails(n.ID())
-	r, err := tab.net.findnode(n.ID(), n.addr(), targetKey)
+	r, err := tab.net.findnode(unwrapNode(n), targetKey)
 	if err != nil || len(r) == 0 {
 		fails++
 		tab.db.UpdateFindFails(n.ID(), fails)
@@ -451,15 +483,25 @@ func (tab *Table) doRevalidate(done chan<- struct{}) {
 	}
 
 	// Ping the selected node and wait for a pong.
-	err := tab.net.ping(last.ID(), last.addr())
+	seq, err := tab.net.ping(unwrapNode(last))
+
+	// Fetch the node's record if it announced a newer one.
+	if err == nil && seq > last.Seq() {
+		if n, rerr := tab.net.requestENR(unwrapNode(last)); rerr != nil {
+			log.Debug("ENR request failed", "id", last.ID(), "addr", last.addr(), "err", rerr)
+		} else {
+			last = &node{Node: *n, addedAt: last.addedAt}
+			tab.db.UpdateNode(n)
+		}
+	}
 
 	tab.mutex.Lock()
 	defer tab.mutex.Unlock()
 	b := tab.buckets[bi]
 	if err == nil {
 		// The node responded, move it to the front.
-		log.Debug("Revalidated node", "b", bi, "id", last.ID())
-		b.bump(last)
+		log.Debug("Revalidated node", "b", bi, "id", last.ID(), "seq", last.Seq())
+		tab.bumpInBucket(b, last)
 		return
 	}
 	// No reply received, pick a replacement or delete the node if there aren't
@@ -534,12 +576,33 @@ func (tab *Table) len() (n int) {
 // bucket returns the bucket for the given node ID hash.
 func (tab *Table) bucket(id enode.ID) *bucket {
 	d := enode.LogDist(tab.self().ID(), id)
+	return tab.bucketAtDistance(d)
+}
+
+// bucketAtDistance returns the bucket for the given log distance from the local node.
+func (tab *Table) bucketAtDistance(d int) *bucket {
 	if d <= bucketMinDistance {
 		return tab.buckets[0]
 	}
 	return tab.buckets[d-bucketMinDistance-1]
 }
 
+// nodesAtDistance returns the table entries at the given log distance from the local
+// node. The caller must not hold tab.mutex.
+func (tab *Table) nodesAtDistance(d int) []*enode.Node {
+	tab.mutex.Lock()
+	defer tab.mutex.Unlock()
+
+	self := tab.self().ID()
+	var nodes []*enode.Node
+	for _, n := range tab.bucketAtDistance(d).entries {
+		if enode.LogDist(self, n.ID()) == d {
+			nodes = append(nodes, unwrapNode(n))
+		}
+	}
+	return nodes
+}
+
 // add attempts to add the given node to its corresponding bucket. If the bucket has space
 // available, adding the node succeeds immediately. Otherwise, the node is added if the
 // least recently active node in the bucket does not respond to a ping packet.
@@ -671,6 +734,29 @@ func (b *bucket) bump(n *node) bool {
 	return false
 }
 
+// bumpInBucket moves n to the front of the bucket entry list, replacing the stored
+// version of the node. If the node's IP has changed and the new one doesn't fit into
+// the table limits, the previous version is kept.
+func (tab *Table) bumpInBucket(b *bucket, n *node) bool {
+	for i := range b.entries {
+		if b.entries[i].ID() == n.ID() {
+			if !n.IP().Equal(b.entries[i].IP()) {
+				// Endpoint has changed, ensure that the new IP fits into table limits.
+				tab.removeIP(b, b.entries[i].IP())
+				if !tab.addIP(b, n.IP()) {
+					// It doesn't, put the previous one back.
+					tab.addIP(b, b.entries[i].IP())
+					n = b.entries[i]
+				}
+			}
+			copy(b.entries[1:], b.entries[:i])
+			b.entries[0] = n
+			return true
+		}
+	}
+	return false
+}
+
 // bumpOrAdd moves n to the front of the bucket entry list or adds it if the list isn't
 // full. The return value is true if n is in the bucket.
 func (tab *Table) bumpOrAdd(b *bucket, n *node) bool {
@@ -166,6 +166,40 @@ func TestTable_BucketIPLimit(t *testing.T) {
 	}
 }
 
+// This checks that revalidation fetches the record of nodes announcing
+// a higher ENR sequence number.
+func TestTable_revalidateSyncRecord(t *testing.T) {
+	transport := newPingRecorder()
+	tab, db := newTestTable(transport)
+	defer tab.Close()
+	defer db.Close()
+
+	<-tab.initDone
+
+	// Insert a node.
+	var r enr.Record
+	r.Set(enr.IP(net.IP{127, 0, 0, 1}))
+	r.Set(enr.UDP(30303))
+	id := enode.ID{1}
+	n1 := wrapNode(enode.SignNull(&r, id))
+	tab.add(n1)
+
+	// Update the node record.
+	r.Set(enr.WithEntry("foo", "bar"))
+	n2 := enode.SignNull(&r, id)
+	transport.updateRecord(n2)
+
+	tab.doRevalidate(make(chan struct{}, 1))
+	intable := tab.getNode(id)
+	if intable.Seq() != n2.Seq() {
+		t.Fatalf("table contains old record with seq %d, want seq %d", intable.Seq(), n2.Seq())
+	}
+	var foo string
+	if err := intable.Load(enr.WithEntry("foo", &foo)); err != nil || foo != "bar" {
+		t.Fatalf("table record missing updated entry: %v", err)
+	}
+}
+
 func TestTable_closest(t *testing.T) {
 	t.Parallel()
 
@@ -514,15 +548,15 @@ func (tn *preminedTestnet) self() *enode.Node {
 	return nullNode
 }
 
-func (tn *preminedTestnet) findnode(toid enode.ID, toaddr *net.UDPAddr, target encPubkey) ([]*node, error) {
+func (tn *preminedTestnet) findnode(n *enode.Node, target encPubkey) ([]*node, error) {
 	// current log distance is encoded in port number
-	// fmt.Println("findnode query at dist", toaddr.Port)
-	if toaddr.Port == 0 {
+	// fmt.Println("findnode query at dist", n.UDP())
+	if n.UDP() == 0 {
 		panic("query to node at distance 0")
 	}
-	next := toaddr.Port - 1
+	next := n.UDP() - 1
 	var result []*node
-	for i, ekey := range tn.dists[toaddr.Port] {
+	for i, ekey := range tn.dists[n.UDP()] {
 		key, _ := decodePubkey(ekey)
 		node := wrapNode(enode.NewV4(key, net.ParseIP("127.0.0.1"), i, next))
 		result = append(result, node)
@@ -532,7 +566,8 @@ func (tn *preminedTestnet) findnode(toid enode.ID, toaddr *net.UDPAddr, target e
 
 func (*preminedTestnet) close()                                        {}
 func (*preminedTestnet) waitping(from enode.ID) error                  { return nil }
-func (*preminedTestnet) ping(toid enode.ID, toaddr *net.UDPAddr) error { return nil }
+func (*preminedTestnet) ping(n *enode.Node) (uint64, error)            { return 0, nil }
+func (*preminedTestnet) requestENR(n *enode.Node) (*enode.Node, error) { return n, nil }
 
 // mine generates a testnet struct literal with nodes at
 // various distances to the given target.
@@ -86,6 +86,7 @@ func fillBucket(tab *Table, n *node) (last *node) {
 type pingRecorder struct {
 	mu           sync.Mutex
 	dead, pinged map[enode.ID]bool
+	records      map[enode.ID]*enode.Node
 	n            *enode.Node
 }
 
@@ -95,17 +96,26 @@ func newPingRecorder() *pingRecorder {
 	n := enode.SignNull(&r, enode.ID{})
 
 	return &pingRecorder{
-		dead:   make(map[enode.ID]bool),
-		pinged: make(map[enode.ID]bool),
-		n:      n,
+		dead:    make(map[enode.ID]bool),
+		pinged:  make(map[enode.ID]bool),
+		records: make(map[enode.ID]*enode.Node),
+		n:       n,
 	}
 }
 
+// updateRecord updates a node record. Future calls to ping and
+// requestENR will return this record.
+func (t *pingRecorder) updateRecord(n *enode.Node) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.records[n.ID()] = n
+}
+
 func (t *pingRecorder) self() *enode.Node {
 	return nullNode
 }
 
-func (t *pingRecorder) findnode(toid enode.ID, toaddr *net.UDPAddr, target encPubkey) ([]*node, error) {
+func (t *pingRecorder) findnode(n *enode.Node, target encPubkey) ([]*node, error) {
 	return nil, nil
 }
 
@@ -113,16 +123,29 @@ func (t *pingRecorder) waitping(from enode.ID) error {
 	return nil // remote always pings
 }
 
-func (t *pingRecorder) ping(toid enode.ID, toaddr *net.UDPAddr) error {
+func (t *pingRecorder) ping(n *enode.Node) (uint64, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	toid := n.ID()
 	t.pinged[toid] = true
 	if t.dead[toid] {
-		return errTimeout
-	} else {
-		return nil
+		return 0, errTimeout
+	}
+	if t.records[toid] != nil {
+		return t.records[toid].Seq(), nil
+	}
+	return 0, nil
+}
+
+func (t *pingRecorder) requestENR(n *enode.Node) (*enode.Node, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.dead[n.ID()] || t.records[n.ID()] == nil {
+		return nil, errTimeout
 	}
+	return t.records[n.ID()], nil
 }
 
 func (t *pingRecorder) close() {}
@@ -29,6 +29,7 @@ import (
 	"github.com/ETSC3259/etsc/crypto"
 	"github.com/ETSC3259/etsc/log"
 	"github.com/ETSC3259/etsc/p2p/enode"
+	"github.com/ETSC3259/etsc/p2p/enr"
 	"github.com/ETSC3259/etsc/p2p/netutil"
 	"github.com/ETSC3259/etsc/rlp"
 )
@@ -43,6 +44,7 @@ var (
 	errTimeout          = errors.New("RPC timeout")
 	errClockWarp        = errors.New("reply deadline too far in the future")
 	errClosed           = errors.New("socket closed")
+	errInvalidRecord    = errors.New("invalid record in ENR response")
 )
 
 // Timeouts
@@ -62,6 +64,8 @@ const (
 	pongPacket
 	findnodePacket
 	neighborsPacket
+	enrRequestPacket
+	enrResponsePacket
 )
 
 // RPC request structures
@@ -71,6 +75,7 @@ type (
 		From, To   rpcEndpoint
 		Expiration uint64
 		// Ignore additional fields (for forward compatibility).
+		// The first one holds the sender's ENR sequence number (EIP-868).
 		Rest []rlp.RawValue `rlp:"tail"`
 	}
 
@@ -84,6 +89,7 @@ type (
 		ReplyTok   []byte // This contains the hash of the ping packet.
 		Expiration uint64 // Absolute timestamp at which the packet becomes invalid.
 		// Ignore additional fields (for forward compatibility).
+		// The first one holds the sender's ENR sequence number (EIP-868).
 		Rest []rlp.RawValue `rlp:"tail"`
 	}
 
@@ -103,6 +109,21 @@ type (
 		Rest []rlp.RawValue `rlp:"tail"`
 	}
 
+	// enrRequest queries for the remote node's record.
+	enrRequest struct {
+		Expiration uint64
+		// Ignore additional fields (for forward compatibility).
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// enrResponse is the reply to enrRequest.
+	enrResponse struct {
+		ReplyTok []byte // Hash of the enrRequest packet.
+		Record   enr.Record
+		// Ignore additional fields (for forward compatibility).
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
 	rpcNode struct {
 		IP  net.IP // len 4 for IPv4 or 16 for IPv6
 		UDP uint16 // for discovery protocol
@@ -127,6 +148,22 @@ func makeEndpoint(addr *net.UDPAddr, tcpPort uint16) rpcEndpoint {
 	return rpcEndpoint{IP: ip, UDP: uint16(addr.Port), TCP: tcpPort}
 }
 
+// seqRest encodes an ENR sequence number as the trailing field of ping and pong.
+func seqRest(seq uint64) []rlp.RawValue {
+	enc, _ := rlp.EncodeToBytes(seq)
+	return []rlp.RawValue{enc}
+}
+
+// restSeq decodes the ENR sequence number from the trailing fields of ping and
+// pong. Zero is returned if the sender doesn't support EIP-868.
+func restSeq(rest []rlp.RawValue) uint64 {
+	var seq uint64
+	if len(rest) == 0 || rlp.DecodeBytes(rest[0], &seq) != nil {
+		return 0
+	}
+	return seq
+}
+
 func (t *udp) nodeFromRPC(sender *net.UDPAddr, rn rpcNode) (*node, error) {
 	if rn.UDP <= 1024 {
 		return nil, errors.New("low port")
@@ -284,19 +321,23 @@ func (t *udp) ourEndpoint() rpcEndpoint {
 	return makeEndpoint(a, uint16(n.TCP()))
 }
 
-// ping sends a ping message to the given node and waits for a reply.
-func (t *udp) ping(toid enode.ID, toaddr *net.UDPAddr) error {
-	return <-t.sendPing(toid, toaddr, nil)
+// ping sends a ping message to the given node and waits for a reply. It returns
+// the ENR sequence number announced in the pong.
+func (t *udp) ping(n *enode.Node) (seq uint64, err error) {
+	toaddr := &net.UDPAddr{IP: n.IP(), Port: n.UDP()}
+	err = <-t.sendPing(n.ID(), toaddr, func(p *pong) { seq = restSeq(p.Rest) })
+	return seq, err
 }
 
 // sendPing sends a ping message to the given node and invokes the callback
 // when the reply arrives.
-func (t *udp) sendPing(toid enode.ID, toaddr *net.UDPAddr, callback func()) <-chan error {
+func (t *udp) sendPing(toid enode.ID, toaddr *net.UDPAddr, callback func(*pong)) <-chan error {
 	req := &ping{
 		Version:    4,
 		From:       t.ourEndpoint(),
 		To:         makeEndpoint(toaddr, 0), // TODO: maybe use known TCP port from DB
 		Expiration: uint64(time.Now().Add(expiration).Unix()),
+		Rest:       seqRest(t.localNode.Node().Seq()),
 	}
 	packet, hash, err := encodePacket(t.priv, pingPacket, req)
 	if err != nil {
@@ -307,7 +348,7 @@ func (t *udp) sendPing(toid enode.ID, toaddr *net.UDPAddr, callback func()) <-ch
 	errc := t.pending(toid, pongPacket, func(p interface{}) bool {
 		ok := bytes.Equal(p.(*pong).ReplyTok, hash)
 		if ok && callback != nil {
-			callback()
+			callback(p.(*pong))
 		}
 		return ok
 	})
@@ -320,15 +361,20 @@ func (t *udp) waitping(from enode.ID) error {
 	return <-t.pending(from, pingPacket, func(interface{}) bool { return true })
 }
 
-// findnode sends a findnode request to the given node and waits until
-// the node has sent up to k neighbors.
-func (t *udp) findnode(toid enode.ID, toaddr *net.UDPAddr, target encPubkey) ([]*node, error) {
-	// If we haven't seen a ping from the destination node for a while, it won't remember
-	// our endpoint proof and reject findnode. Solicit a ping first.
+// ensureBond solicits a ping from a node if we haven't seen a ping from it for a while.
+// Without it, the node won't remember our endpoint proof and rejects our queries.
+func (t *udp) ensureBond(toid enode.ID, toaddr *net.UDPAddr) {
 	if time.Since(t.db.LastPingReceived(toid)) > bondExpiration {
-		t.ping(toid, toaddr)
+		<-t.sendPing(toid, toaddr, nil)
 		t.waitping(toid)
 	}
+}
+
+// findnode sends a findnode request to the given node and waits until
+// the node has sent up to k neighbors.
+func (t *udp) findnode(n *enode.Node, target encPubkey) ([]*node, error) {
+	toid, toaddr := n.ID(), &net.UDPAddr{IP: n.IP(), Port: n.UDP()}
+	t.ensureBond(toid, toaddr)
 
 	nodes := make([]*node, 0, bucketSize)
 	nreceived := 0
@@ -352,6 +398,52 @@ func (t *udp) findnode(toid enode.ID, toaddr *net.UDPAddr, target encPubkey) ([]
 	return nodes, <-errc
 }
 
+// requestENR sends an ENR request to the given node and waits for its record. If
+// the returned record isn't newer than the one we have, n is returned.
+func (t *udp) requestENR(n *enode.Node) (*enode.Node, error) {
+	addr := &net.UDPAddr{IP: n.IP(), Port: n.UDP()}
+	t.ensureBond(n.ID(), addr)
+
+	req := &enrRequest{
+		Expiration: uint64(time.Now().Add(expiration).Unix()),
+	}
+	packet, hash, err := encodePacket(t.priv, enrRequestPacket, req)
+	if err != nil {
+		return nil, err
+	}
+	var record *enr.Record
+	errc := t.pending(n.ID(), enrResponsePacket, func(r interface{}) bool {
+		resp := r.(*enrResponse)
+		if !bytes.Equal(resp.ReplyTok, hash) {
+			return false
+		}
+		record = &resp.Record
+		return true
+	})
+	t.write(addr, req.name(), packet)
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	// Verify the response record.
+	rn, err := enode.New(enode.ValidSchemes, record)
+	if err != nil {
+		return nil, err
+	}
+	if rn.ID() != n.ID() {
+		return nil, errInvalidRecord
+	}
+	if rn.Seq() <= n.Seq() {
+		return n, nil
+	}
+	if err := rn.ValidateComplete(); err != nil {
+		return nil, err
+	}
+	if err := netutil.CheckRelayIP(addr.IP, rn.IP()); err != nil {
+		return nil, err
+	}
+	return rn, nil
+}
+
 // pending adds a reply callback to the pending reply queue.
 // see the documentation of type pending for a detailed explanation.
 func (t *udp) pending(id enode.ID, ptype byte, callback func(interface{}) bool) <-chan error {
@@ -607,6 +699,10 @@ func decodePacket(buf []byte) (packet, encPubkey, []byte, error) {
 		req = new(findnode)
 	case neighborsPacket:
 		req = new(neighbors)
+	case enrRequestPacket:
+		req = new(enrRequest)
+	case enrResponsePacket:
+		req = new(enrResponse)
 	default:
 		return nil, fromKey, hash, fmt.Errorf("unknown type: %d", ptype)
 	}
@@ -627,11 +723,12 @@ func (req *ping) handle(t *udp, from *net.UDPAddr, fromKey encPubkey, mac []byte
 		To:         makeEndpoint(from, req.From.TCP),
 		ReplyTok:   mac,
 		Expiration: uint64(time.Now().Add(expiration).Unix()),
+		Rest:       seqRest(t.localNode.Node().Seq()),
 	})
 	n := wrapNode(enode.NewV4(key, from.IP, int(req.From.TCP), from.Port))
 	t.handleReply(n.ID(), pingPacket, req)
 	if time.Since(t.db.LastPongReceived(n.ID())) > bondExpiration {
-		t.sendPing(n.ID(), from, func() { t.tab.addThroughPing(n) })
+		t.sendPing(n.ID(), from, func(*pong) { t.tab.addThroughPing(n) })
 	} else {
 		t.tab.addThroughPing(n)
 	}
@@ -710,6 +807,32 @@ func (req *neighbors) handle(t *udp, from *net.UDPAddr, fromKey encPubkey, mac [
 
 func (req *neighbors) name() string { return "NEIGHBORS/v4" }
 
+func (req *enrRequest) handle(t *udp, from *net.UDPAddr, fromKey encPubkey, mac []byte) error {
+	if expired(req.Expiration) {
+		return errExpired
+	}
+	if time.Since(t.db.LastPongReceived(fromKey.id())) > bondExpiration {
+		// Like findnode, the record is only sent to nodes that proved their endpoint.
+		return errUnknownNode
+	}
+	t.send(from, enrResponsePacket, &enrResponse{
+		ReplyTok: mac,
+		Record:   *t.localNode.Node().Record(),
+	})
+	return nil
+}
+
+func (req *enrRequest) name() string { return "ENRREQUEST/v4" }
+
+func (req *enrResponse) handle(t *udp, from *net.UDPAddr, fromKey encPubkey, mac []byte) error {
+	if !t.handleReply(fromKey.id(), enrResponsePacket, req) {
+		return errUnsolicitedReply
+	}
+	return nil
+}
+
+func (req *enrResponse) name() string { return "ENRRESPONSE/v4" }
+
 func expired(ts uint64) bool {
 	return time.Unix(int64(ts), 0).Before(time.Now())
 }
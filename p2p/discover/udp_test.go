@@ -37,6 +37,7 @@ import (
 	"github.com/ETSC3259/etsc/common"
 	"github.com/ETSC3259/etsc/crypto"
 	"github.com/ETSC3259/etsc/p2p/enode"
+	"github.com/ETSC3259/etsc/p2p/enr"
 	"github.com/ETSC3259/etsc/rlp"
 )
 
@@ -138,9 +139,10 @@ func TestUDP_pingTimeout(t *testing.T) {
 	test := newUDPTest(t)
 	defer test.table.Close()
 
+	key := newkey()
 	toaddr := &net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 2222}
-	toid := enode.ID{1, 2, 3, 4}
-	if err := test.udp.ping(toid, toaddr); err != errTimeout {
+	tonode := enode.NewV4(&key.PublicKey, toaddr.IP, 0, toaddr.Port)
+	if _, err := test.udp.ping(tonode); err != errTimeout {
 		t.Error("expected timeout error, got", err)
 	}
 }
@@ -222,10 +224,11 @@ func TestUDP_findnodeTimeout(t *testing.T) {
 	test := newUDPTest(t)
 	defer test.table.Close()
 
+	key := newkey()
 	toaddr := &net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 2222}
-	toid := enode.ID{1, 2, 3, 4}
+	tonode := enode.NewV4(&key.PublicKey, toaddr.IP, 0, toaddr.Port)
 	target := encPubkey{4, 5, 6, 7}
-	result, err := test.udp.findnode(toid, toaddr, target)
+	result, err := test.udp.findnode(tonode, target)
 	if err != errTimeout {
 		t.Error("expected timeout error, got", err)
 	}
@@ -284,8 +287,8 @@ func TestUDP_findnodeMultiReply(t *testing.T) {
 	// queue a pending findnode request
 	resultc, errc := make(chan []*node), make(chan error)
 	go func() {
-		rid := encodePubkey(&test.remotekey.PublicKey).id()
-		ns, err := test.udp.findnode(rid, test.remoteaddr, testTarget)
+		rnode := enode.NewV4(&test.remotekey.PublicKey, test.remoteaddr.IP, 0, test.remoteaddr.Port)
+		ns, err := test.udp.findnode(rnode, testTarget)
 		if err != nil && len(ns) == 0 {
 			errc <- err
 		} else {
@@ -395,6 +398,89 @@ func TestUDP_successfulPing(t *testing.T) {
 	}
 }
 
+// This test checks that ENR requests (EIP-868) are answered after the
+// endpoint proof and that ping and pong carry the record sequence number.
+func TestUDP_EIP868(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+
+	test.udp.localNode.Set(enr.WithEntry("foo", "bar"))
+	wantNode := test.udp.localNode.Node()
+
+	// ENR requests aren't allowed before endpoint proof.
+	test.packetIn(errUnknownNode, enrRequestPacket, &enrRequest{Expiration: futureExp})
+
+	// Perform endpoint proof and check for sequence number in packet tail.
+	test.packetIn(nil, pingPacket, &ping{From: testRemote, To: testLocalAnnounced, Version: 4, Expiration: futureExp})
+	test.waitPacketOut(func(p *pong) {
+		if seq := restSeq(p.Rest); seq != wantNode.Seq() {
+			t.Errorf("wrong sequence number in pong: %d, want %d", seq, wantNode.Seq())
+		}
+	})
+	hash, _ := test.waitPacketOut(func(p *ping) {
+		if seq := restSeq(p.Rest); seq != wantNode.Seq() {
+			t.Errorf("wrong sequence number in ping: %d, want %d", seq, wantNode.Seq())
+		}
+	})
+	test.packetIn(nil, pongPacket, &pong{ReplyTok: hash, Expiration: futureExp})
+
+	// Request should work now.
+	test.packetIn(nil, enrRequestPacket, &enrRequest{Expiration: futureExp})
+	test.waitPacketOut(func(p *enrResponse) {
+		n, err := enode.New(enode.ValidSchemes, &p.Record)
+		if err != nil {
+			t.Fatalf("invalid record: %v", err)
+		}
+		if !reflect.DeepEqual(n, wantNode) {
+			t.Fatalf("wrong node in enrResponse: %v", n)
+		}
+	})
+}
+
+// This test checks that requestENR returns the remote record if it is newer.
+func TestUDP_requestENR(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+
+	var r enr.Record
+	r.Set(enr.IP(test.remoteaddr.IP))
+	r.Set(enr.UDP(test.remoteaddr.Port))
+	if err := enode.SignV4(&r, test.remotekey); err != nil {
+		t.Fatal(err)
+	}
+	known, _ := enode.New(enode.ValidSchemes, &r)
+	r.Set(enr.WithEntry("foo", "bar"))
+	if err := enode.SignV4(&r, test.remotekey); err != nil {
+		t.Fatal(err)
+	}
+	// Pretend the remote node pinged us recently so no endpoint proof is needed.
+	test.udp.db.UpdateLastPingReceived(known.ID(), time.Now())
+
+	type result struct {
+		n   *enode.Node
+		err error
+	}
+	resultc := make(chan result, 1)
+	go func() {
+		n, err := test.udp.requestENR(known)
+		resultc <- result{n, err}
+	}()
+	hash, _ := test.waitPacketOut(func(p *enrRequest) {})
+	test.packetIn(nil, enrResponsePacket, &enrResponse{ReplyTok: hash, Record: r})
+
+	res := <-resultc
+	if res.err != nil {
+		t.Fatalf("requestENR error: %v", res.err)
+	}
+	if res.n.Seq() != r.Seq() {
+		t.Errorf("wrong record returned: seq %d, want %d", res.n.Seq(), r.Seq())
+	}
+	var foo string
+	if err := res.n.Load(enr.WithEntry("foo", &foo)); err != nil || foo != "bar" {
+		t.Errorf("record missing updated entry: %v", err)
+	}
+}
+
 var testPackets = []struct {
 	input      string
 	wantPacket interface{}
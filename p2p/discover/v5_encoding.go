@@ -0,0 +1,649 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/common/math"
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/p2p/enode"
+	"github.com/ETSC3259/etsc/p2p/enr"
+	"github.com/ETSC3259/etsc/rlp"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// Discovery v5 packets start with a static header
+//
+//     protocol-id || version || flag || nonce || authdata-size || authdata
+//
+// which is followed by the message, encrypted with AES-GCM using the session key
+// and the complete header as additional data. There are three kinds of packets:
+//
+// Message packets (flag 0) carry the sender's node ID as authdata. When the
+// recipient has no session with the sender or can't decrypt the message, it
+// replies with a WHOAREYOU packet.
+//
+// WHOAREYOU packets (flag 1) carry id-nonce || enr-seq as authdata and no message.
+// Their nonce is the nonce of the packet which could not be decrypted.
+//
+// Handshake packets (flag 2) answer a WHOAREYOU challenge. Their authdata is
+//
+//     src-id || sig-size || eph-key-size || id-signature || eph-pubkey || record
+//
+// and they carry the message which triggered the challenge, encrypted with the
+// newly derived session key.
+
+// Errors
+var (
+	errInvalidHeader       = errors.New("invalid packet header")
+	errInvalidAuthData     = errors.New("invalid auth data")
+	errUnexpectedHandshake = errors.New("unexpected handshake")
+	errNoRecord            = errors.New("no record for handshake")
+	errInvalidIDSignature  = errors.New("invalid ID signature")
+	errMessageDecrypt      = errors.New("cannot decrypt message")
+	errMessageTooShort     = errors.New("message too short")
+)
+
+const (
+	v5ProtocolID    = "discv5"
+	v5Version       = 1
+	v5MaxPacketSize = 1280
+
+	flagMessage   = 0
+	flagWhoareyou = 1
+	flagHandshake = 2
+
+	v5NonceSize            = 12
+	v5IDNonceSize          = 16
+	v5KeySize              = 16 // AES-128
+	v5SigSize              = 64
+	v5HeaderSize           = len(v5ProtocolID) + 2 + 1 + v5NonceSize + 2
+	v5WhoareyouAuthSize    = v5IDNonceSize + 8
+	v5HandshakeAuthMinSize = len(enode.ID{}) + 2
+	v5RandomPacketMsgSize  = 20
+
+	v5SessionCacheSize   = 1024
+	v5ChallengeCacheSize = 1024
+
+	idSignatureText  = "discovery v5 identity proof"
+	keyAgreementText = "discovery v5 key agreement"
+)
+
+// v5Nonce is the nonce of a discovery v5 packet.
+type v5Nonce [v5NonceSize]byte
+
+// Discovery v5 message types.
+const (
+	pingV5Msg byte = iota + 1
+	pongV5Msg
+	findnodeV5Msg
+	nodesV5Msg
+	talkRequestV5Msg
+	talkResponseV5Msg
+
+	unknownV5Msg   = 0xfe
+	whoareyouV5Msg = 0xff
+)
+
+// v5Message is implemented by all discovery v5 messages.
+type v5Message interface {
+	name() string
+	kind() byte
+	requestID() []byte
+	setRequestID([]byte)
+}
+
+// Discovery v5 messages
+type (
+	// pingV5 checks whether the recipient is alive and informs it about
+	// the sender's record sequence number.
+	pingV5 struct {
+		ReqID  []byte
+		ENRSeq uint64
+	}
+
+	// pongV5 is the reply to pingV5. It mirrors the sender's UDP endpoint.
+	pongV5 struct {
+		ReqID  []byte
+		ENRSeq uint64
+		ToIP   net.IP // the sender's IP as seen by the recipient
+		ToPort uint16 // the sender's UDP port as seen by the recipient
+	}
+
+	// findnodeV5 asks for nodes at the given log distances. Distance zero
+	// requests the recipient's own record.
+	findnodeV5 struct {
+		ReqID     []byte
+		Distances []uint
+	}
+
+	// nodesV5 is the reply to findnodeV5. It may be spread across multiple
+	// packets, Total is the number of packets in the reply.
+	nodesV5 struct {
+		ReqID []byte
+		Total uint8
+		Nodes []*enr.Record
+	}
+
+	// talkRequestV5 carries an application-level request.
+	talkRequestV5 struct {
+		ReqID    []byte
+		Protocol string
+		Message  []byte
+	}
+
+	// talkResponseV5 is the reply to talkRequestV5.
+	talkResponseV5 struct {
+		ReqID   []byte
+		Message []byte
+	}
+
+	// whoareyouV5 is the challenge sent in response to a packet which could
+	// not be decrypted.
+	whoareyouV5 struct {
+		Nonce     v5Nonce             // nonce of the packet being answered
+		IDNonce   [v5IDNonceSize]byte // random value signed by the handshake
+		RecordSeq uint64              // highest record sequence number known
+
+		// These fields are not part of the encoding:
+		ChallengeData []byte      // the encoded packet, used as key derivation salt
+		Node          *enode.Node // record of the node the challenge refers to
+	}
+
+	// unknownV5 stands in for a message packet that could not be decrypted.
+	unknownV5 struct {
+		Nonce v5Nonce
+	}
+)
+
+func (p *pingV5) name() string                   { return "PING/v5" }
+func (p *pingV5) kind() byte                     { return pingV5Msg }
+func (p *pingV5) requestID() []byte              { return p.ReqID }
+func (p *pingV5) setRequestID(id []byte)         { p.ReqID = id }
+func (p *pongV5) name() string                   { return "PONG/v5" }
+func (p *pongV5) kind() byte                     { return pongV5Msg }
+func (p *pongV5) requestID() []byte              { return p.ReqID }
+func (p *pongV5) setRequestID(id []byte)         { p.ReqID = id }
+func (p *findnodeV5) name() string               { return "FINDNODE/v5" }
+func (p *findnodeV5) kind() byte                 { return findnodeV5Msg }
+func (p *findnodeV5) requestID() []byte          { return p.ReqID }
+func (p *findnodeV5) setRequestID(id []byte)     { p.ReqID = id }
+func (p *nodesV5) name() string                  { return "NODES/v5" }
+func (p *nodesV5) kind() byte                    { return nodesV5Msg }
+func (p *nodesV5) requestID() []byte             { return p.ReqID }
+func (p *nodesV5) setRequestID(id []byte)        { p.ReqID = id }
+func (p *talkRequestV5) name() string            { return "TALKREQ/v5" }
+func (p *talkRequestV5) kind() byte              { return talkRequestV5Msg }
+func (p *talkRequestV5) requestID() []byte       { return p.ReqID }
+func (p *talkRequestV5) setRequestID(id []byte)  { p.ReqID = id }
+func (p *talkResponseV5) name() string           { return "TALKRESP/v5" }
+func (p *talkResponseV5) kind() byte             { return talkResponseV5Msg }
+func (p *talkResponseV5) requestID() []byte      { return p.ReqID }
+func (p *talkResponseV5) setRequestID(id []byte) { p.ReqID = id }
+func (p *whoareyouV5) name() string              { return "WHOAREYOU/v5" }
+func (p *whoareyouV5) kind() byte                { return whoareyouV5Msg }
+func (p *whoareyouV5) requestID() []byte         { return nil }
+func (p *whoareyouV5) setRequestID([]byte)       {}
+func (p *unknownV5) name() string                { return "UNKNOWN/v5" }
+func (p *unknownV5) kind() byte                  { return unknownV5Msg }
+func (p *unknownV5) requestID() []byte           { return nil }
+func (p *unknownV5) setRequestID([]byte)         {}
+
+// decodeV5Message decodes the plaintext of a message packet.
+func decodeV5Message(kind byte, input []byte) (v5Message, error) {
+	var msg v5Message
+	switch kind {
+	case pingV5Msg:
+		msg = new(pingV5)
+	case pongV5Msg:
+		msg = new(pongV5)
+	case findnodeV5Msg:
+		msg = new(findnodeV5)
+	case nodesV5Msg:
+		msg = new(nodesV5)
+	case talkRequestV5Msg:
+		msg = new(talkRequestV5)
+	case talkResponseV5Msg:
+		msg = new(talkResponseV5)
+	default:
+		return nil, fmt.Errorf("unknown message type %d", kind)
+	}
+	if err := rlp.DecodeBytes(input, msg); err != nil {
+		return nil, err
+	}
+	if len(msg.requestID()) > 8 {
+		return nil, fmt.Errorf("invalid request ID length %d", len(msg.requestID()))
+	}
+	return msg, nil
+}
+
+// v5SessionID identifies a session. Sessions are bound to the remote endpoint.
+type v5SessionID struct {
+	id   enode.ID
+	addr string
+}
+
+// v5Session holds the keys of an established session.
+type v5Session struct {
+	writeKey []byte
+	readKey  []byte
+}
+
+// v5Codec encodes and decodes discovery v5 packets. It keeps track of sessions
+// and of the challenges sent to other nodes. It is safe for concurrent use.
+type v5Codec struct {
+	localnode  *enode.LocalNode
+	privkey    *ecdsa.PrivateKey
+	sessions   *lru.Cache // v5SessionID -> *v5Session
+	challenges *lru.Cache // v5SessionID -> *whoareyouV5
+}
+
+func newV5Codec(ln *enode.LocalNode, key *ecdsa.PrivateKey) *v5Codec {
+	sessions, _ := lru.New(v5SessionCacheSize)
+	challenges, _ := lru.New(v5ChallengeCacheSize)
+	return &v5Codec{localnode: ln, privkey: key, sessions: sessions, challenges: challenges}
+}
+
+// session returns the session with the given node, or nil if there is none.
+func (c *v5Codec) session(id enode.ID, addr string) *v5Session {
+	if s, ok := c.sessions.Get(v5SessionID{id, addr}); ok {
+		return s.(*v5Session)
+	}
+	return nil
+}
+
+// encode encodes a message packet for the given node. If challenge is non-nil, a
+// handshake packet answering the challenge is created and a new session is
+// established. If there is no session with the node, a random packet is
+// returned which makes the recipient send a WHOAREYOU challenge.
+func (c *v5Codec) encode(id enode.ID, addr string, msg v5Message, challenge *whoareyouV5) ([]byte, v5Nonce, error) {
+	if challenge != nil {
+		return c.encodeHandshake(id, addr, msg, challenge)
+	}
+	if s := c.session(id, addr); s != nil {
+		return c.encodeMessage(s.writeKey, msg)
+	}
+	return c.encodeRandom()
+}
+
+// encodeWhoareyou creates a WHOAREYOU challenge in reply to the packet with the given
+// nonce. The challenge is remembered until the node answers it with a handshake.
+func (c *v5Codec) encodeWhoareyou(id enode.ID, addr string, nonce v5Nonce, n *enode.Node) ([]byte, error) {
+	w := &whoareyouV5{Nonce: nonce, Node: n}
+	if n != nil {
+		w.RecordSeq = n.Seq()
+	}
+	if _, err := crand.Read(w.IDNonce[:]); err != nil {
+		return nil, err
+	}
+	auth := make([]byte, v5WhoareyouAuthSize)
+	copy(auth, w.IDNonce[:])
+	binary.BigEndian.PutUint64(auth[v5IDNonceSize:], w.RecordSeq)
+	packet := encodeV5Header(flagWhoareyou, nonce, auth)
+	w.ChallengeData = packet
+	c.challenges.Add(v5SessionID{id, addr}, w)
+	return packet, nil
+}
+
+func (c *v5Codec) encodeMessage(key []byte, msg v5Message) ([]byte, v5Nonce, error) {
+	nonce, err := randomV5Nonce()
+	if err != nil {
+		return nil, nonce, err
+	}
+	id := c.localnode.ID()
+	header := encodeV5Header(flagMessage, nonce, id[:])
+	packet, err := sealV5Message(key, header, nonce, msg)
+	return packet, nonce, err
+}
+
+// encodeRandom creates a message packet with random content. It is sent instead of
+// a message when there is no session with the recipient.
+func (c *v5Codec) encodeRandom() ([]byte, v5Nonce, error) {
+	nonce, err := randomV5Nonce()
+	if err != nil {
+		return nil, nonce, err
+	}
+	id := c.localnode.ID()
+	packet := encodeV5Header(flagMessage, nonce, id[:])
+	body := make([]byte, v5RandomPacketMsgSize)
+	crand.Read(body)
+	return append(packet, body...), nonce, nil
+}
+
+func (c *v5Codec) encodeHandshake(toID enode.ID, addr string, msg v5Message, challenge *whoareyouV5) ([]byte, v5Nonce, error) {
+	var nonce v5Nonce
+	if challenge.Node == nil {
+		return nil, nonce, errNoRecord
+	}
+	var remotePubkey ecdsa.PublicKey
+	if err := challenge.Node.Load((*enode.Secp256k1)(&remotePubkey)); err != nil {
+		return nil, nonce, fmt.Errorf("can't find secp256k1 key for recipient: %v", err)
+	}
+	ephkey, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, nonce, err
+	}
+	ephpub := crypto.CompressPubkey(&ephkey.PublicKey)
+	sig, err := makeIDSignature(c.privkey, challenge.ChallengeData, ephpub, toID)
+	if err != nil {
+		return nil, nonce, err
+	}
+	var record []byte
+	if self := c.localnode.Node(); challenge.RecordSeq < self.Seq() {
+		if record, err = rlp.EncodeToBytes(self.Record()); err != nil {
+			return nil, nonce, err
+		}
+	}
+
+	// Assemble the auth data and derive the session keys.
+	fromID := c.localnode.ID()
+	auth := make([]byte, 0, v5HandshakeAuthMinSize+len(sig)+len(ephpub)+len(record))
+	auth = append(auth, fromID[:]...)
+	auth = append(auth, byte(len(sig)), byte(len(ephpub)))
+	auth = append(auth, sig...)
+	auth = append(auth, ephpub...)
+	auth = append(auth, record...)
+	initiatorKey, recipientKey := deriveV5Keys(ecdh(ephkey, &remotePubkey), fromID, toID, challenge.ChallengeData)
+
+	if nonce, err = randomV5Nonce(); err != nil {
+		return nil, nonce, err
+	}
+	header := encodeV5Header(flagHandshake, nonce, auth)
+	packet, err := sealV5Message(initiatorKey, header, nonce, msg)
+	if err != nil {
+		return nil, nonce, err
+	}
+	c.sessions.Add(v5SessionID{toID, addr}, &v5Session{writeKey: initiatorKey, readKey: recipientKey})
+	return packet, nonce, nil
+}
+
+// decode decodes a packet received from the given address. For handshake packets,
+// the sender's node record is returned along with the message. Message packets
+// which can't be decrypted are returned as *unknownV5.
+func (c *v5Codec) decode(input []byte, addr string) (enode.ID, *enode.Node, v5Message, error) {
+	var src enode.ID
+	if len(input) < v5HeaderSize {
+		return src, nil, nil, errPacketTooSmall
+	}
+	if !bytes.Equal(input[:len(v5ProtocolID)], []byte(v5ProtocolID)) {
+		return src, nil, nil, errInvalidHeader
+	}
+	if binary.BigEndian.Uint16(input[len(v5ProtocolID):]) != v5Version {
+		return src, nil, nil, errInvalidHeader
+	}
+	var (
+		flag     = input[len(v5ProtocolID)+2]
+		nonce    v5Nonce
+		authsize = int(binary.BigEndian.Uint16(input[v5HeaderSize-2:]))
+	)
+	copy(nonce[:], input[len(v5ProtocolID)+3:])
+	if len(input) < v5HeaderSize+authsize {
+		return src, nil, nil, errPacketTooSmall
+	}
+	header, body := input[:v5HeaderSize+authsize], input[v5HeaderSize+authsize:]
+	auth := header[v5HeaderSize:]
+
+	switch flag {
+	case flagWhoareyou:
+		if len(auth) != v5WhoareyouAuthSize || len(body) != 0 {
+			return src, nil, nil, errInvalidAuthData
+		}
+		w := &whoareyouV5{
+			Nonce:         nonce,
+			RecordSeq:     binary.BigEndian.Uint64(auth[v5IDNonceSize:]),
+			ChallengeData: common.CopyBytes(input),
+		}
+		copy(w.IDNonce[:], auth)
+		return src, nil, w, nil
+
+	case flagMessage:
+		if len(auth) != len(src) {
+			return src, nil, nil, errInvalidAuthData
+		}
+		copy(src[:], auth)
+		s := c.session(src, addr)
+		if s == nil {
+			return src, nil, &unknownV5{Nonce: nonce}, nil
+		}
+		msg, err := openV5Message(s.readKey, header, nonce, body)
+		if err == errMessageDecrypt {
+			// The remote end may have lost its session, issue a new challenge.
+			return src, nil, &unknownV5{Nonce: nonce}, nil
+		}
+		return src, nil, msg, err
+
+	case flagHandshake:
+		return c.decodeHandshake(addr, header, auth, nonce, body)
+
+	default:
+		return src, nil, nil, errInvalidHeader
+	}
+}
+
+func (c *v5Codec) decodeHandshake(addr string, header, auth []byte, nonce v5Nonce, body []byte) (enode.ID, *enode.Node, v5Message, error) {
+	var src enode.ID
+	if len(auth) < v5HandshakeAuthMinSize {
+		return src, nil, nil, errInvalidAuthData
+	}
+	copy(src[:], auth)
+	sigsize, keysize := int(auth[len(src)]), int(auth[len(src)+1])
+	rest := auth[v5HandshakeAuthMinSize:]
+	if len(rest) < sigsize+keysize {
+		return src, nil, nil, errInvalidAuthData
+	}
+	sig, ephpub, record := rest[:sigsize], rest[sigsize:sigsize+keysize], rest[sigsize+keysize:]
+
+	sid := v5SessionID{src, addr}
+	cv, ok := c.challenges.Get(sid)
+	if !ok {
+		return src, nil, nil, errUnexpectedHandshake
+	}
+	challenge := cv.(*whoareyouV5)
+
+	// Verify the sender's record and ID signature.
+	n, err := handshakeNode(src, record, challenge.Node)
+	if err != nil {
+		return src, nil, nil, err
+	}
+	var pubkey ecdsa.PublicKey
+	if err := n.Load((*enode.Secp256k1)(&pubkey)); err != nil {
+		return src, nil, nil, fmt.Errorf("no secp256k1 key in record: %v", err)
+	}
+	if !verifyIDSignature(&pubkey, sig, challenge.ChallengeData, ephpub, c.localnode.ID()) {
+		return src, nil, nil, errInvalidIDSignature
+	}
+
+	// Derive the session keys and decrypt the message.
+	eph, err := crypto.DecompressPubkey(ephpub)
+	if err != nil {
+		return src, nil, nil, fmt.Errorf("invalid ephemeral key: %v", err)
+	}
+	initiatorKey, recipientKey := deriveV5Keys(ecdh(c.privkey, eph), src, c.localnode.ID(), challenge.ChallengeData)
+	msg, err := openV5Message(initiatorKey, header, nonce, body)
+	if err != nil {
+		return src, nil, nil, err
+	}
+	c.challenges.Remove(sid)
+	c.sessions.Add(sid, &v5Session{writeKey: recipientKey, readKey: initiatorKey})
+	return src, n, msg, nil
+}
+
+// handshakeNode returns the record of a handshake sender. If the handshake doesn't
+// include a record, the record known when the challenge was sent is used.
+func handshakeNode(src enode.ID, record []byte, known *enode.Node) (*enode.Node, error) {
+	if len(record) == 0 {
+		if known == nil {
+			return nil, errNoRecord
+		}
+		return known, nil
+	}
+	var r enr.Record
+	if err := rlp.DecodeBytes(record, &r); err != nil {
+		return nil, fmt.Errorf("invalid record: %v", err)
+	}
+	n, err := enode.New(enode.ValidSchemes, &r)
+	if err != nil {
+		return nil, err
+	}
+	if n.ID() != src {
+		return nil, errInvalidRecord
+	}
+	if known != nil && n.Seq() < known.Seq() {
+		return known, nil
+	}
+	return n, nil
+}
+
+func encodeV5Header(flag byte, nonce v5Nonce, auth []byte) []byte {
+	header := make([]byte, v5HeaderSize, v5HeaderSize+len(auth))
+	copy(header, v5ProtocolID)
+	binary.BigEndian.PutUint16(header[len(v5ProtocolID):], v5Version)
+	header[len(v5ProtocolID)+2] = flag
+	copy(header[len(v5ProtocolID)+3:], nonce[:])
+	binary.BigEndian.PutUint16(header[v5HeaderSize-2:], uint16(len(auth)))
+	return append(header, auth...)
+}
+
+// sealV5Message encrypts msg and appends it to the header.
+func sealV5Message(key, header []byte, nonce v5Nonce, msg v5Message) ([]byte, error) {
+	enc, err := rlp.EncodeToBytes(msg)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := append([]byte{msg.kind()}, enc...)
+	aead, err := newV5AEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	packet := make([]byte, len(header), len(header)+len(plaintext)+aead.Overhead())
+	copy(packet, header)
+	packet = aead.Seal(packet, nonce[:], plaintext, header)
+	if len(packet) > v5MaxPacketSize {
+		return nil, fmt.Errorf("packet too large (%d bytes)", len(packet))
+	}
+	return packet, nil
+}
+
+// openV5Message decrypts the message of a packet.
+func openV5Message(key, header []byte, nonce v5Nonce, ciphertext []byte) (v5Message, error) {
+	aead, err := newV5AEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce[:], ciphertext, header)
+	if err != nil {
+		return nil, errMessageDecrypt
+	}
+	if len(plaintext) == 0 {
+		return nil, errMessageTooShort
+	}
+	return decodeV5Message(plaintext[0], plaintext[1:])
+}
+
+func newV5AEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomV5Nonce() (n v5Nonce, err error) {
+	_, err = crand.Read(n[:])
+	return n, err
+}
+
+// idSignatureHash computes the hash signed by the handshake initiator.
+func idSignatureHash(h hash.Hash, challenge, ephkey []byte, destID enode.ID) []byte {
+	h.Write([]byte(idSignatureText))
+	h.Write(challenge)
+	h.Write(ephkey)
+	h.Write(destID[:])
+	return h.Sum(nil)
+}
+
+// makeIDSignature creates the ID nonce signature of a handshake.
+func makeIDSignature(key *ecdsa.PrivateKey, challenge, ephkey []byte, destID enode.ID) ([]byte, error) {
+	sig, err := crypto.Sign(idSignatureHash(sha256.New(), challenge, ephkey, destID), key)
+	if err != nil {
+		return nil, err
+	}
+	return sig[:v5SigSize], nil // remove recovery id
+}
+
+// verifyIDSignature checks the ID nonce signature of a handshake.
+func verifyIDSignature(pubkey *ecdsa.PublicKey, sig, challenge, ephkey []byte, destID enode.ID) bool {
+	if len(sig) != v5SigSize {
+		return false
+	}
+	hash := idSignatureHash(sha256.New(), challenge, ephkey, destID)
+	return crypto.VerifySignature(crypto.CompressPubkey(pubkey), hash, sig)
+}
+
+// deriveV5Keys creates the session keys of a handshake between the initiator n1
+// and the recipient n2.
+func deriveV5Keys(secret []byte, n1, n2 enode.ID, challenge []byte) (initiatorKey, recipientKey []byte) {
+	info := make([]byte, 0, len(keyAgreementText)+2*len(n1))
+	info = append(info, keyAgreementText...)
+	info = append(info, n1[:]...)
+	info = append(info, n2[:]...)
+	kdf := hkdfSHA256(secret, challenge, info, 2*v5KeySize)
+	return kdf[:v5KeySize], kdf[v5KeySize:]
+}
+
+// hkdfSHA256 implements the HMAC-based key derivation function of RFC 5869.
+func hkdfSHA256(secret, salt, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	var out, prev []byte
+	for i := byte(1); len(out) < length; i++ {
+		expand := hmac.New(sha256.New, prk)
+		expand.Write(prev)
+		expand.Write(info)
+		expand.Write([]byte{i})
+		prev = expand.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:length]
+}
+
+// ecdh computes the compressed shared point of key agreement.
+func ecdh(privkey *ecdsa.PrivateKey, pubkey *ecdsa.PublicKey) []byte {
+	x, y := pubkey.Curve.ScalarMult(pubkey.X, pubkey.Y, math.PaddedBigBytes(privkey.D, 32))
+	if x == nil {
+		return nil
+	}
+	secret := make([]byte, 33)
+	secret[0] = 0x02 | byte(y.Bit(0))
+	math.ReadBits(x, secret[1:])
+	return secret
+}
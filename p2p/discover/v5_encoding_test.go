@@ -0,0 +1,192 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/p2p/enode"
+)
+
+type v5CodecTest struct {
+	codec *v5Codec
+	node  *enode.Node
+	addr  string
+}
+
+func newV5CodecTest(t *testing.T, ip net.IP, port int) *v5CodecTest {
+	db, err := enode.OpenDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := newkey()
+	ln := enode.NewLocalNode(db, key)
+	ln.SetStaticIP(ip)
+	ln.SetFallbackUDP(port)
+	addr := &net.UDPAddr{IP: ip, Port: port}
+	return &v5CodecTest{codec: newV5Codec(ln, key), node: ln.Node(), addr: addr.String()}
+}
+
+// handshake runs a handshake initiated by a and returns the message received by b.
+func (a *v5CodecTest) handshake(t *testing.T, b *v5CodecTest, msg v5Message) v5Message {
+	// The first packet can't be decrypted by b, which issues a challenge.
+	packet, nonce, err := a.codec.encode(b.node.ID(), b.addr, msg, nil)
+	if err != nil {
+		t.Fatal("can't encode random packet:", err)
+	}
+	src, _, unknown, err := b.codec.decode(packet, a.addr)
+	if err != nil {
+		t.Fatal("can't decode random packet:", err)
+	}
+	if src != a.node.ID() {
+		t.Fatalf("wrong source ID %v, want %v", src, a.node.ID())
+	}
+	if p, ok := unknown.(*unknownV5); !ok || p.Nonce != nonce {
+		t.Fatalf("random packet decoded as %v, want unknown packet with nonce %x", unknown, nonce)
+	}
+	challenge, err := b.codec.encodeWhoareyou(a.node.ID(), a.addr, nonce, nil)
+	if err != nil {
+		t.Fatal("can't encode WHOAREYOU:", err)
+	}
+
+	// a answers the challenge with a handshake.
+	_, _, w, err := a.codec.decode(challenge, b.addr)
+	if err != nil {
+		t.Fatal("can't decode WHOAREYOU:", err)
+	}
+	whoareyou := w.(*whoareyouV5)
+	if whoareyou.Nonce != nonce {
+		t.Fatalf("wrong WHOAREYOU nonce %x, want %x", whoareyou.Nonce, nonce)
+	}
+	whoareyou.Node = b.node
+	packet, _, err = a.codec.encode(b.node.ID(), b.addr, msg, whoareyou)
+	if err != nil {
+		t.Fatal("can't encode handshake:", err)
+	}
+	src, n, received, err := b.codec.decode(packet, a.addr)
+	if err != nil {
+		t.Fatal("can't decode handshake:", err)
+	}
+	if src != a.node.ID() || n == nil || n.ID() != a.node.ID() {
+		t.Fatalf("wrong handshake sender %v (node %v), want %v", src, n, a.node.ID())
+	}
+	return received
+}
+
+func TestV5Codec_handshake(t *testing.T) {
+	t.Parallel()
+	a := newV5CodecTest(t, net.IP{127, 0, 0, 1}, 30303)
+	b := newV5CodecTest(t, net.IP{127, 0, 0, 2}, 30304)
+
+	ping := &pingV5{ReqID: []byte{1, 2, 3}, ENRSeq: 5}
+	if got := a.handshake(t, b, ping); !reflect.DeepEqual(got, ping) {
+		t.Fatalf("wrong message after handshake:\ngot:  %#v\nwant: %#v", got, ping)
+	}
+
+	// Both ends use the session now.
+	pong := &pongV5{ReqID: []byte{1, 2, 3}, ENRSeq: 1, ToIP: net.IP{127, 0, 0, 1}, ToPort: 30303}
+	packet, _, err := b.codec.encode(a.node.ID(), a.addr, pong, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, got, err := a.codec.decode(packet, b.addr); err != nil {
+		t.Fatal("can't decode response:", err)
+	} else if !reflect.DeepEqual(got, pong) {
+		t.Fatalf("wrong response:\ngot:  %#v\nwant: %#v", got, pong)
+	}
+	packet, _, err = a.codec.encode(b.node.ID(), b.addr, ping, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, got, err := b.codec.decode(packet, a.addr); err != nil {
+		t.Fatal("can't decode message:", err)
+	} else if !reflect.DeepEqual(got, ping) {
+		t.Fatalf("wrong message:\ngot:  %#v\nwant: %#v", got, ping)
+	}
+}
+
+func TestV5Codec_tampered(t *testing.T) {
+	t.Parallel()
+	a := newV5CodecTest(t, net.IP{127, 0, 0, 1}, 30303)
+	b := newV5CodecTest(t, net.IP{127, 0, 0, 2}, 30304)
+	a.handshake(t, b, &pingV5{ReqID: []byte{1}})
+
+	packet, _, err := a.codec.encode(b.node.ID(), b.addr, &findnodeV5{ReqID: []byte{2}, Distances: []uint{256}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pos := range []int{
+		len(v5ProtocolID) + 3, // nonce
+		v5HeaderSize + 31,     // source ID
+		len(packet) - 1,       // message
+	} {
+		tampered := common.CopyBytes(packet)
+		tampered[pos] ^= 0x01
+		if _, _, msg, err := b.codec.decode(tampered, a.addr); err != nil {
+			t.Errorf("byte %d modified: unexpected error %v", pos, err)
+		} else if _, ok := msg.(*unknownV5); !ok {
+			t.Errorf("byte %d modified: decoded as %v, want unknown packet", pos, msg.name())
+		}
+	}
+	// Sessions are bound to the remote endpoint.
+	if _, _, msg, err := b.codec.decode(packet, "127.0.0.1:30305"); err != nil {
+		t.Error("unexpected error:", err)
+	} else if _, ok := msg.(*unknownV5); !ok {
+		t.Errorf("packet from other endpoint decoded as %v, want unknown packet", msg.name())
+	}
+}
+
+func TestV5Codec_invalidHeader(t *testing.T) {
+	t.Parallel()
+	a := newV5CodecTest(t, net.IP{127, 0, 0, 1}, 30303)
+
+	tests := []struct {
+		input []byte
+		err   error
+	}{
+		{input: []byte("discv5"), err: errPacketTooSmall},
+		{input: encodeV5Header(flagMessage, v5Nonce{}, make([]byte, 32))[:30], err: errPacketTooSmall},
+		{input: append([]byte("discv4"), make([]byte, 40)...), err: errInvalidHeader},
+		{input: encodeV5Header(flagMessage, v5Nonce{}, make([]byte, 20)), err: errInvalidAuthData},
+		{input: encodeV5Header(flagWhoareyou, v5Nonce{}, make([]byte, 10)), err: errInvalidAuthData},
+		{input: encodeV5Header(flagHandshake, v5Nonce{}, make([]byte, 40)), err: errUnexpectedHandshake},
+		{input: encodeV5Header(3, v5Nonce{}, nil), err: errInvalidHeader},
+	}
+	for i, test := range tests {
+		if _, _, _, err := a.codec.decode(test.input, "127.0.0.2:30304"); err != test.err {
+			t.Errorf("test %d: got error %v, want %v", i, err, test.err)
+		}
+	}
+}
+
+// This test checks the key derivation function against RFC 5869, test case 1.
+func TestHKDF(t *testing.T) {
+	var (
+		ikm  = bytes.Repeat([]byte{0x0b}, 22)
+		salt = common.FromHex("000102030405060708090a0b0c")
+		info = common.FromHex("f0f1f2f3f4f5f6f7f8f9")
+		want = "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865"
+	)
+	if okm := hkdfSHA256(ikm, salt, info, 42); hex.EncodeToString(okm) != want {
+		t.Errorf("wrong output: %x", okm)
+	}
+}
@@ -0,0 +1,589 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"crypto/ecdsa"
+	crand "crypto/rand"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ETSC3259/etsc/log"
+	"github.com/ETSC3259/etsc/p2p/enode"
+	"github.com/ETSC3259/etsc/p2p/enr"
+	"github.com/ETSC3259/etsc/p2p/netutil"
+)
+
+// Errors
+var (
+	errChallengeRepeated = errors.New("repeated WHOAREYOU challenge")
+	errLowPort           = errors.New("low port")
+	errDistanceMismatch  = errors.New("record not at requested distance")
+	errDuplicateRecord   = errors.New("duplicate record")
+	errNotWhitelisted    = errors.New("not contained in netrestrict whitelist")
+)
+
+const (
+	v5RespTimeout       = 700 * time.Millisecond // covers the handshake round trip
+	v5LookupDistances   = 3                      // number of distances in a lookup FINDNODE
+	v5FindnodeLimit     = bucketSize             // maximum number of nodes in a NODES reply
+	v5NodesPerPacket    = 3                      // records per NODES packet
+	v5MaxNodesResponses = 10                     // maximum number of NODES packets accepted per request
+	v5CallQueueSize     = v5MaxNodesResponses
+)
+
+// TalkRequestHandler handles TALKREQ messages of an application protocol. The
+// returned message is sent back in the TALKRESP. Handlers run on the packet
+// processing goroutine and must not block.
+type TalkRequestHandler func(id enode.ID, addr *net.UDPAddr, msg []byte) []byte
+
+// UDPv5 implements the discovery v5 wire protocol.
+type UDPv5 struct {
+	conn        conn
+	netrestrict *netutil.Netlist
+	priv        *ecdsa.PrivateKey
+	localNode   *enode.LocalNode
+	db          *enode.DB
+	tab         *Table
+	codec       *v5Codec
+
+	mu          sync.Mutex
+	activeCalls map[string]*v5Call  // calls by request ID
+	callNonces  map[v5Nonce]*v5Call // calls by nonce of the last packet sent
+	talk        map[string]TalkRequestHandler
+
+	closing chan struct{}
+	wg      sync.WaitGroup
+}
+
+// v5Call is a request waiting for responses.
+type v5Call struct {
+	node      *enode.Node
+	addr      *net.UDPAddr
+	req       v5Message
+	respKind  byte
+	nonce     v5Nonce
+	handshake bool // set when a WHOAREYOU challenge was answered for the call
+	resp      chan v5Message
+}
+
+// ListenV5 starts the discovery v5 protocol on the given connection. The node
+// table is shared with discovery v4 through the node database of ln.
+func ListenV5(c conn, ln *enode.LocalNode, cfg Config) (*UDPv5, error) {
+	t := &UDPv5{
+		conn:        c,
+		netrestrict: cfg.NetRestrict,
+		priv:        cfg.PrivateKey,
+		localNode:   ln,
+		db:          ln.Database(),
+		codec:       newV5Codec(ln, cfg.PrivateKey),
+		activeCalls: make(map[string]*v5Call),
+		callNonces:  make(map[v5Nonce]*v5Call),
+		talk:        make(map[string]TalkRequestHandler),
+		closing:     make(chan struct{}),
+	}
+	tab, err := newTable(t, t.db, cfg.Bootnodes)
+	if err != nil {
+		return nil, err
+	}
+	t.tab = tab
+
+	t.wg.Add(1)
+	go t.readLoop(cfg.Unhandled)
+	return t, nil
+}
+
+// Self returns the local node.
+func (t *UDPv5) Self() *enode.Node {
+	return t.localNode.Node()
+}
+
+// Close shuts down the listener and the node table.
+func (t *UDPv5) Close() {
+	t.tab.Close()
+}
+
+// Resolve searches for a specific node with the given ID and asks it for the most
+// recent version of its record. It returns nil if the node could not be found.
+func (t *UDPv5) Resolve(n *enode.Node) *enode.Node {
+	return t.tab.Resolve(n)
+}
+
+// LookupRandom finds random nodes in the network.
+func (t *UDPv5) LookupRandom() []*enode.Node {
+	return t.tab.LookupRandom()
+}
+
+// ReadRandomNodes fills the given slice with random nodes from the table.
+func (t *UDPv5) ReadRandomNodes(buf []*enode.Node) int {
+	return t.tab.ReadRandomNodes(buf)
+}
+
+// Ping sends a ping message to the given node and waits for a reply.
+func (t *UDPv5) Ping(n *enode.Node) error {
+	_, err := t.ping(n)
+	return err
+}
+
+// RequestENR requests the record of the given node. If the node doesn't have a
+// newer record, n is returned.
+func (t *UDPv5) RequestENR(n *enode.Node) (*enode.Node, error) {
+	return t.requestENR(n)
+}
+
+// FindNode asks the given node for the nodes at the given log distances from it.
+func (t *UDPv5) FindNode(n *enode.Node, distances []uint) ([]*enode.Node, error) {
+	nodes, err := t.findnodeDistances(n, distances)
+	return unwrapNodes(nodes), err
+}
+
+// RegisterTalkHandler sets the handler for TALKREQ messages of the given protocol.
+// Requests for protocols without a handler are answered with an empty response.
+func (t *UDPv5) RegisterTalkHandler(protocol string, handler TalkRequestHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.talk[protocol] = handler
+}
+
+// TalkRequest sends a TALKREQ message to the given node and waits for its response.
+func (t *UDPv5) TalkRequest(n *enode.Node, protocol string, request []byte) ([]byte, error) {
+	c, err := t.call(n, &talkRequestV5{Protocol: protocol, Message: request}, talkResponseV5Msg)
+	if err != nil {
+		return nil, err
+	}
+	var resp []byte
+	err = t.waitResponses(c, func(m v5Message) bool {
+		resp = m.(*talkResponseV5).Message
+		return true
+	})
+	return resp, err
+}
+
+func (t *UDPv5) self() *enode.Node {
+	return t.localNode.Node()
+}
+
+func (t *UDPv5) close() {
+	close(t.closing)
+	t.conn.Close()
+	t.wg.Wait()
+}
+
+// ping sends a ping message to the given node and waits for a reply. It returns
+// the ENR sequence number announced in the pong.
+func (t *UDPv5) ping(n *enode.Node) (uint64, error) {
+	c, err := t.call(n, &pingV5{ENRSeq: t.localNode.Node().Seq()}, pongV5Msg)
+	if err != nil {
+		return 0, err
+	}
+	var seq uint64
+	err = t.waitResponses(c, func(m v5Message) bool {
+		pong := m.(*pongV5)
+		seq = pong.ENRSeq
+		t.localNode.UDPEndpointStatement(c.addr, &net.UDPAddr{IP: pong.ToIP, Port: int(pong.ToPort)})
+		t.db.UpdateLastPongReceived(n.ID(), time.Now())
+		return true
+	})
+	return seq, err
+}
+
+// findnode asks the given node for nodes close to target.
+func (t *UDPv5) findnode(n *enode.Node, target encPubkey) ([]*node, error) {
+	return t.findnodeDistances(n, lookupDistances(target.id(), n.ID()))
+}
+
+// requestENR fetches the record of the given node using FINDNODE at distance zero.
+func (t *UDPv5) requestENR(n *enode.Node) (*enode.Node, error) {
+	nodes, err := t.findnodeDistances(n, []uint{0})
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) != 1 {
+		return nil, errInvalidRecord
+	}
+	if rn := unwrapNode(nodes[0]); rn.Seq() > n.Seq() {
+		return rn, nil
+	}
+	return n, nil
+}
+
+// findnodeDistances sends a FINDNODE request and collects the records of all NODES
+// replies. Invalid records are skipped.
+func (t *UDPv5) findnodeDistances(n *enode.Node, distances []uint) ([]*node, error) {
+	c, err := t.call(n, &findnodeV5{Distances: distances}, nodesV5Msg)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		nodes    []*node
+		seen     = make(map[enode.ID]bool)
+		received int
+	)
+	err = t.waitResponses(c, func(m v5Message) bool {
+		resp := m.(*nodesV5)
+		for _, r := range resp.Nodes {
+			rn, err := t.verifyResponseNode(c, r, distances, seen)
+			if err != nil {
+				log.Trace("Invalid record in NODES response", "id", n.ID(), "addr", c.addr, "err", err)
+				continue
+			}
+			nodes = append(nodes, wrapNode(rn))
+		}
+		received++
+		return received >= int(resp.Total) || received >= v5MaxNodesResponses
+	})
+	return nodes, err
+}
+
+// verifyResponseNode checks a record received in a NODES reply.
+func (t *UDPv5) verifyResponseNode(c *v5Call, r *enr.Record, distances []uint, seen map[enode.ID]bool) (*enode.Node, error) {
+	n, err := enode.New(enode.ValidSchemes, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := n.ValidateComplete(); err != nil {
+		return nil, err
+	}
+	if err := netutil.CheckRelayIP(c.addr.IP, n.IP()); err != nil {
+		return nil, err
+	}
+	if t.netrestrict != nil && !t.netrestrict.Contains(n.IP()) {
+		return nil, errNotWhitelisted
+	}
+	if n.UDP() <= 1024 {
+		return nil, errLowPort
+	}
+	if !containsUint(uint(enode.LogDist(c.node.ID(), n.ID())), distances) {
+		return nil, errDistanceMismatch
+	}
+	if seen[n.ID()] {
+		return nil, errDuplicateRecord
+	}
+	seen[n.ID()] = true
+	return n, nil
+}
+
+// lookupDistances computes the FINDNODE distances for a lookup of target. It asks
+// for the log distance between target and dest and the distances next to it.
+func lookupDistances(target, dest enode.ID) []uint {
+	td := enode.LogDist(target, dest)
+	dists := []uint{uint(td)}
+	for i := 1; len(dists) < v5LookupDistances; i++ {
+		if td+i <= hashBits {
+			dists = append(dists, uint(td+i))
+		}
+		if td-i > 0 && len(dists) < v5LookupDistances {
+			dists = append(dists, uint(td-i))
+		}
+	}
+	return dists
+}
+
+func containsUint(x uint, xs []uint) bool {
+	for _, v := range xs {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// call sends a request to the given node. Responses are delivered to the call
+// through waitResponses.
+func (t *UDPv5) call(n *enode.Node, req v5Message, respKind byte) (*v5Call, error) {
+	reqid := make([]byte, 8)
+	if _, err := crand.Read(reqid); err != nil {
+		return nil, err
+	}
+	req.setRequestID(reqid)
+	c := &v5Call{
+		node:     n,
+		addr:     &net.UDPAddr{IP: n.IP(), Port: n.UDP()},
+		req:      req,
+		respKind: respKind,
+		resp:     make(chan v5Message, v5CallQueueSize),
+	}
+	t.mu.Lock()
+	t.activeCalls[string(reqid)] = c
+	t.mu.Unlock()
+
+	t.localNode.UDPContact(c.addr)
+	if err := t.sendCall(c, nil); err != nil {
+		t.callDone(c)
+		return nil, err
+	}
+	return c, nil
+}
+
+// sendCall sends the request of a call, answering the given challenge if it is non-nil.
+func (t *UDPv5) sendCall(c *v5Call, challenge *whoareyouV5) error {
+	packet, nonce, err := t.codec.encode(c.node.ID(), c.addr.String(), c.req, challenge)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	delete(t.callNonces, c.nonce)
+	c.nonce = nonce
+	t.callNonces[nonce] = c
+	t.mu.Unlock()
+	return t.write(c.addr, c.req.name(), packet)
+}
+
+// waitResponses passes the responses of a call to fn until it returns true. It
+// returns errTimeout if that doesn't happen within v5RespTimeout.
+func (t *UDPv5) waitResponses(c *v5Call, fn func(v5Message) (done bool)) error {
+	defer t.callDone(c)
+
+	timeout := time.NewTimer(v5RespTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case resp := <-c.resp:
+			if fn(resp) {
+				return nil
+			}
+		case <-timeout.C:
+			return errTimeout
+		case <-t.closing:
+			return errClosed
+		}
+	}
+}
+
+func (t *UDPv5) callDone(c *v5Call) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.activeCalls, string(c.req.requestID()))
+	if t.callNonces[c.nonce] == c {
+		delete(t.callNonces, c.nonce)
+	}
+}
+
+// sendResponse sends a response message to the given node.
+func (t *UDPv5) sendResponse(toID enode.ID, toaddr *net.UDPAddr, msg v5Message) error {
+	packet, _, err := t.codec.encode(toID, toaddr.String(), msg, nil)
+	if err != nil {
+		return err
+	}
+	return t.write(toaddr, msg.name(), packet)
+}
+
+func (t *UDPv5) write(toaddr *net.UDPAddr, what string, packet []byte) error {
+	_, err := t.conn.WriteToUDP(packet, toaddr)
+	log.Trace(">> "+what, "addr", toaddr, "err", err)
+	return err
+}
+
+// readLoop runs in its own goroutine. it handles incoming UDP packets.
+func (t *UDPv5) readLoop(unhandled chan<- ReadPacket) {
+	defer t.wg.Done()
+	if unhandled != nil {
+		defer close(unhandled)
+	}
+
+	buf := make([]byte, v5MaxPacketSize)
+	for {
+		nbytes, from, err := t.conn.ReadFromUDP(buf)
+		if netutil.IsTemporaryError(err) {
+			// Ignore temporary read errors.
+			log.Debug("Temporary UDP read error", "err", err)
+			continue
+		} else if err != nil {
+			// Shut down the loop for permament errors.
+			log.Debug("UDP read error", "err", err)
+			return
+		}
+		if t.handlePacket(from, buf[:nbytes]) != nil && unhandled != nil {
+			select {
+			case unhandled <- ReadPacket{buf[:nbytes], from}:
+			default:
+			}
+		}
+	}
+}
+
+// handlePacket decodes and processes a packet. Only decoding errors are returned,
+// so packets of other protocols sharing the socket can be passed on.
+func (t *UDPv5) handlePacket(from *net.UDPAddr, input []byte) error {
+	fromID, fromNode, msg, err := t.codec.decode(input, from.String())
+	if err != nil {
+		log.Debug("Bad discv5 packet", "addr", from, "err", err)
+		return err
+	}
+	if fromNode != nil {
+		// The handshake proved that the node is reachable at its endpoint.
+		if fromNode.IP().Equal(from.IP) && fromNode.UDP() == from.Port {
+			t.tab.addThroughPing(wrapNode(fromNode))
+		}
+	}
+	err = t.handle(msg, fromID, from)
+	log.Trace("<< "+msg.name(), "id", fromID, "addr", from, "err", err)
+	return nil
+}
+
+func (t *UDPv5) handle(msg v5Message, fromID enode.ID, from *net.UDPAddr) error {
+	switch p := msg.(type) {
+	case *unknownV5:
+		return t.handleUnknown(p, fromID, from)
+	case *whoareyouV5:
+		return t.handleWhoareyou(p, from)
+	case *pingV5:
+		return t.handlePing(p, fromID, from)
+	case *findnodeV5:
+		return t.handleFindnode(p, fromID, from)
+	case *talkRequestV5:
+		return t.handleTalkRequest(p, fromID, from)
+	default:
+		return t.handleResponse(msg, fromID, from)
+	}
+}
+
+// handleUnknown answers a packet that could not be decrypted with a challenge.
+func (t *UDPv5) handleUnknown(p *unknownV5, fromID enode.ID, from *net.UDPAddr) error {
+	n := t.tab.getNode(fromID)
+	if n == nil {
+		n = t.db.Node(fromID)
+	}
+	packet, err := t.codec.encodeWhoareyou(fromID, from.String(), p.Nonce, n)
+	if err != nil {
+		return err
+	}
+	return t.write(from, "WHOAREYOU/v5", packet)
+}
+
+// handleWhoareyou resends the request of a call as a handshake packet.
+func (t *UDPv5) handleWhoareyou(p *whoareyouV5, from *net.UDPAddr) error {
+	t.mu.Lock()
+	c := t.callNonces[p.Nonce]
+	t.mu.Unlock()
+	if c == nil || !c.addr.IP.Equal(from.IP) || c.addr.Port != from.Port {
+		return errUnsolicitedReply
+	}
+	if c.handshake {
+		return errChallengeRepeated
+	}
+	c.handshake = true
+	p.Node = c.node
+	return t.sendCall(c, p)
+}
+
+// handleResponse delivers a response to the call waiting for it.
+func (t *UDPv5) handleResponse(msg v5Message, fromID enode.ID, from *net.UDPAddr) error {
+	t.mu.Lock()
+	c := t.activeCalls[string(msg.requestID())]
+	t.mu.Unlock()
+	if c == nil || c.respKind != msg.kind() || c.node.ID() != fromID {
+		return errUnsolicitedReply
+	}
+	if !c.addr.IP.Equal(from.IP) || c.addr.Port != from.Port {
+		return errUnsolicitedReply
+	}
+	select {
+	case c.resp <- msg:
+	default:
+		// The call is already done or has received too many responses.
+	}
+	return nil
+}
+
+func (t *UDPv5) handlePing(p *pingV5, fromID enode.ID, from *net.UDPAddr) error {
+	ip := from.IP
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return t.sendResponse(fromID, from, &pongV5{
+		ReqID:  p.ReqID,
+		ENRSeq: t.localNode.Node().Seq(),
+		ToIP:   ip,
+		ToPort: uint16(from.Port),
+	})
+}
+
+func (t *UDPv5) handleFindnode(p *findnodeV5, fromID enode.ID, from *net.UDPAddr) error {
+	nodes := t.collectTableNodes(from.IP, p.Distances, v5FindnodeLimit)
+	for _, resp := range packNodes(p.ReqID, nodes) {
+		if err := t.sendResponse(fromID, from, resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectTableNodes returns up to limit table entries at the given distances which
+// may be relayed to rip.
+func (t *UDPv5) collectTableNodes(rip net.IP, distances []uint, limit int) []*enode.Node {
+	var (
+		nodes     []*enode.Node
+		processed = make(map[uint]bool)
+	)
+	for _, dist := range distances {
+		if processed[dist] || dist > uint(hashBits) {
+			continue
+		}
+		processed[dist] = true
+		if dist == 0 {
+			nodes = append(nodes, t.self())
+			continue
+		}
+		for _, n := range t.tab.nodesAtDistance(int(dist)) {
+			if netutil.CheckRelayIP(rip, n.IP()) != nil {
+				continue
+			}
+			nodes = append(nodes, n)
+			if len(nodes) >= limit {
+				return nodes
+			}
+		}
+	}
+	return nodes
+}
+
+// packNodes splits a NODES reply into packets of at most v5NodesPerPacket records.
+func packNodes(reqid []byte, nodes []*enode.Node) []*nodesV5 {
+	if len(nodes) == 0 {
+		return []*nodesV5{{ReqID: reqid, Total: 1}}
+	}
+	total := uint8((len(nodes) + v5NodesPerPacket - 1) / v5NodesPerPacket)
+	var resp []*nodesV5
+	for len(nodes) > 0 {
+		p := &nodesV5{ReqID: reqid, Total: total}
+		items := v5NodesPerPacket
+		if len(nodes) < items {
+			items = len(nodes)
+		}
+		for _, n := range nodes[:items] {
+			p.Nodes = append(p.Nodes, n.Record())
+		}
+		nodes = nodes[items:]
+		resp = append(resp, p)
+	}
+	return resp
+}
+
+func (t *UDPv5) handleTalkRequest(p *talkRequestV5, fromID enode.ID, from *net.UDPAddr) error {
+	t.mu.Lock()
+	handler := t.talk[p.Protocol]
+	t.mu.Unlock()
+
+	var resp []byte
+	if handler != nil {
+		resp = handler(fromID, from, p.Message)
+	}
+	return t.sendResponse(fromID, from, &talkResponseV5{ReqID: p.ReqID, Message: resp})
+}
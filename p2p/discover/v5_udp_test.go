@@ -0,0 +1,228 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"net"
+	"testing"
+
+	"github.com/ETSC3259/etsc/p2p/enode"
+	"github.com/ETSC3259/etsc/p2p/enr"
+)
+
+func startLocalhostV5(t *testing.T) *UDPv5 {
+	db, err := enode.OpenDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{PrivateKey: newkey()}
+	ln := enode.NewLocalNode(db, cfg.PrivateKey)
+	socket, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	realaddr := socket.LocalAddr().(*net.UDPAddr)
+	ln.SetStaticIP(realaddr.IP)
+	ln.SetFallbackUDP(realaddr.Port)
+	udp, err := ListenV5(socket, ln, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return udp
+}
+
+func signedTestNode(t *testing.T, key *ecdsa.PrivateKey, ip net.IP, port int) *enode.Node {
+	var r enr.Record
+	r.Set(enr.IP(ip))
+	r.Set(enr.UDP(port))
+	if err := enode.SignV4(&r, key); err != nil {
+		t.Fatal(err)
+	}
+	n, err := enode.New(enode.ValidSchemes, &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestUDPv5_pingHandshake(t *testing.T) {
+	t.Parallel()
+	node1, node2 := startLocalhostV5(t), startLocalhostV5(t)
+	defer node1.Close()
+	defer node2.Close()
+
+	seq, err := node1.ping(node2.Self())
+	if err != nil {
+		t.Fatal("ping failed:", err)
+	}
+	if seq != node2.Self().Seq() {
+		t.Errorf("wrong sequence number in pong: got %d, want %d", seq, node2.Self().Seq())
+	}
+	// The handshake established a session on both ends, node2 can
+	// reach node1 without another challenge.
+	addr1 := &net.UDPAddr{IP: node1.Self().IP(), Port: node1.Self().UDP()}
+	if node2.codec.session(node1.Self().ID(), addr1.String()) == nil {
+		t.Fatal("no session on recipient side")
+	}
+	if err := node2.Ping(node1.Self()); err != nil {
+		t.Fatal("ping in other direction failed:", err)
+	}
+}
+
+func TestUDPv5_pingTimeout(t *testing.T) {
+	t.Parallel()
+	node := startLocalhostV5(t)
+	defer node.Close()
+
+	dead := signedTestNode(t, newkey(), net.IP{127, 0, 0, 1}, 1)
+	if err := node.Ping(dead); err != errTimeout {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
+
+func TestUDPv5_findnode(t *testing.T) {
+	t.Parallel()
+	node1, node2 := startLocalhostV5(t), startLocalhostV5(t)
+	defer node1.Close()
+	defer node2.Close()
+
+	// Put some nodes into the table of node2 and count them by distance.
+	var nodes []*enode.Node
+	bydist := make(map[int]int)
+	for i := 0; i < 12; i++ {
+		n := signedTestNode(t, newkey(), net.IP{127, 0, 1, byte(i)}, 30303)
+		nodes = append(nodes, n)
+		bydist[enode.LogDist(node2.Self().ID(), n.ID())]++
+	}
+	node2.tab.stuff(wrapNodes(nodes))
+
+	for _, dist := range []int{256, 255} {
+		result, err := node1.FindNode(node2.Self(), []uint{uint(dist)})
+		if err != nil {
+			t.Fatalf("findnode at distance %d failed: %v", dist, err)
+		}
+		// node1 may show up in the result because the handshake added it
+		// to the table of node2.
+		var found int
+		for _, n := range result {
+			if d := enode.LogDist(node2.Self().ID(), n.ID()); d != dist {
+				t.Errorf("result node %v at wrong distance %d, want %d", n.ID(), d, dist)
+			}
+			if n.ID() != node1.Self().ID() {
+				found++
+			}
+		}
+		if found != bydist[dist] {
+			t.Errorf("wrong number of results at distance %d: got %d, want %d", dist, found, bydist[dist])
+		}
+	}
+}
+
+func TestUDPv5_requestENR(t *testing.T) {
+	t.Parallel()
+	node1, node2 := startLocalhostV5(t), startLocalhostV5(t)
+	defer node1.Close()
+	defer node2.Close()
+
+	// Unchanged record.
+	old := node2.Self()
+	n, err := node1.RequestENR(old)
+	if err != nil {
+		t.Fatal("ENR request failed:", err)
+	}
+	if n != old {
+		t.Errorf("got different node for unchanged record: %v", n)
+	}
+
+	// Updated record.
+	node2.localNode.Set(enr.WithEntry("foo", "bar"))
+	n, err = node1.RequestENR(old)
+	if err != nil {
+		t.Fatal("ENR request failed:", err)
+	}
+	if n.Seq() != node2.Self().Seq() || n.Seq() <= old.Seq() {
+		t.Errorf("wrong sequence number %d, want %d", n.Seq(), node2.Self().Seq())
+	}
+	var foo string
+	if err := n.Load(enr.WithEntry("foo", &foo)); err != nil || foo != "bar" {
+		t.Errorf("updated record lacks new entry (err %v)", err)
+	}
+}
+
+func TestUDPv5_talkRequest(t *testing.T) {
+	t.Parallel()
+	node1, node2 := startLocalhostV5(t), startLocalhostV5(t)
+	defer node1.Close()
+	defer node2.Close()
+
+	requester := make(chan enode.ID, 1)
+	node2.RegisterTalkHandler("echo", func(id enode.ID, addr *net.UDPAddr, msg []byte) []byte {
+		requester <- id
+		return append([]byte("echo: "), msg...)
+	})
+
+	resp, err := node1.TalkRequest(node2.Self(), "echo", []byte("hello"))
+	if err != nil {
+		t.Fatal("talk request failed:", err)
+	}
+	if !bytes.Equal(resp, []byte("echo: hello")) {
+		t.Errorf("wrong response %q", resp)
+	}
+	if id := <-requester; id != node1.Self().ID() {
+		t.Errorf("handler called with wrong ID %v, want %v", id, node1.Self().ID())
+	}
+
+	// Unknown protocols get an empty response.
+	resp, err = node1.TalkRequest(node2.Self(), "unknown", []byte("hello"))
+	if err != nil {
+		t.Fatal("talk request failed:", err)
+	}
+	if len(resp) != 0 {
+		t.Errorf("non-empty response %q for unknown protocol", resp)
+	}
+}
+
+func TestLookupDistances(t *testing.T) {
+	tests := []struct {
+		target, dest enode.ID
+		want         []uint
+	}{
+		{enode.ID{0x80}, enode.ID{}, []uint{256, 255, 254}},
+		{enode.ID{}, enode.ID{31: 0x04}, []uint{3, 4, 2}},
+		{enode.ID{}, enode.ID{31: 0x01}, []uint{1, 2, 3}},
+		{enode.ID{}, enode.ID{}, []uint{0, 1, 2}},
+	}
+	for _, test := range tests {
+		if got := lookupDistances(test.target, test.dest); !uintsEqual(got, test.want) {
+			t.Errorf("lookupDistances(%v, %v) = %v, want %v", test.target, test.dest, got, test.want)
+		}
+	}
+}
+
+func uintsEqual(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,326 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsdisc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ETSC3259/etsc/common/mclock"
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/log"
+	"github.com/ETSC3259/etsc/p2p/enode"
+	"github.com/ETSC3259/etsc/p2p/enr"
+)
+
+const (
+	signingKeySeed = 0x111111
+	nodesSeed1     = 0x2945237
+	nodesSeed2     = 0x4567299
+)
+
+func TestClientSyncTree(t *testing.T) {
+	nodes := testNodes(nodesSeed1, 30)
+	tree, url := makeTestTree("n", nodes, nil)
+	r := mapResolver(tree.ToTXT("n"))
+
+	c := NewClient(Config{Resolver: r, Logger: testlog(t)})
+	stree, err := c.SyncTree(url)
+	if err != nil {
+		t.Fatal("sync error:", err)
+	}
+	if !reflect.DeepEqual(sortByID(stree.Nodes()), sortByID(nodes)) {
+		t.Errorf("wrong nodes in synced tree")
+	}
+	if !reflect.DeepEqual(stree.Links(), tree.Links()) {
+		t.Errorf("wrong links in synced tree: %v", stree.Links())
+	}
+	if stree.Seq() != tree.Seq() {
+		t.Errorf("synced tree has wrong seq: %d", stree.Seq())
+	}
+	if stree.Signature() != tree.Signature() {
+		t.Errorf("synced tree has wrong signature")
+	}
+}
+
+// In this test, syncing the tree fails because it contains an invalid ENR entry.
+func TestClientSyncTreeBadNode(t *testing.T) {
+	r := make(mapResolver)
+	tree, url := makeTestTree("n", testNodes(nodesSeed1, 1), nil)
+	for name, txt := range tree.ToTXT("n") {
+		r[name] = txt
+	}
+	// Replace the node record with garbage of the right hash.
+	badEntry := "enr:-EX4QBKQcSrA66dvrGadUn_8y8JWBZPnVa7h5-tB6lVJaXC2qQ6r8vVLk06j07MnH1O2kNYhv5vFphr0vz9M97cFHiOAgmlkgnY0"
+	badHash := subdomain(&enrEntry{tree.Nodes()[0]})
+	r[badHash+".n"] = badEntry
+	r["n"] = (&rootEntry{eroot: badHash, lroot: tree.root.lroot, seq: 1}).String()
+
+	c := NewClient(Config{Resolver: r, Logger: testlog(t)})
+	if _, err := c.SyncTree(url); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// This test checks that the client rejects entries whose content doesn't match
+// their hash.
+func TestClientSyncTreeHashMismatch(t *testing.T) {
+	nodes := testNodes(nodesSeed1, 2)
+	tree, url := makeTestTree("n", nodes, nil)
+	r := mapResolver(tree.ToTXT("n"))
+
+	// Swap the content of the two leaves.
+	h1 := subdomain(&enrEntry{nodes[0]}) + ".n"
+	h2 := subdomain(&enrEntry{nodes[1]}) + ".n"
+	r[h1], r[h2] = r[h2], r[h1]
+
+	c := NewClient(Config{Resolver: r, Logger: testlog(t)})
+	_, err := c.SyncTree(url)
+	if ne, ok := err.(nameError); !ok || ne.err != errHashMismatch {
+		t.Fatalf("wrong error %v, want hash mismatch", err)
+	}
+}
+
+// This test checks that the client rejects a root signed by the wrong key.
+func TestClientSyncTreeBadSignature(t *testing.T) {
+	tree, _ := makeTestTree("n", testNodes(nodesSeed1, 2), nil)
+	r := mapResolver(tree.ToTXT("n"))
+
+	otherKey := testKey(nodesSeed2)
+	url := newLinkEntry("n", &otherKey.PublicKey).String()
+	c := NewClient(Config{Resolver: r, Logger: testlog(t)})
+	_, err := c.SyncTree(url)
+	if ee, ok := err.(entryError); !ok || ee.err != errInvalidSig {
+		t.Fatalf("wrong error %v, want invalid signature", err)
+	}
+}
+
+// This test checks that randomIterator finds all entries.
+func TestIterator(t *testing.T) {
+	nodes := testNodes(nodesSeed1, 30)
+	tree, url := makeTestTree("n", nodes, nil)
+	r := mapResolver(tree.ToTXT("n"))
+	c := NewClient(Config{Resolver: r, Logger: testlog(t)})
+
+	it, err := c.NewIterator(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	checkIterator(t, it, nodes)
+}
+
+// This test checks that the iterator follows links to other trees.
+func TestIteratorLinks(t *testing.T) {
+	nodes := testNodes(nodesSeed1, 40)
+	tree1, url1 := makeTestTree("t1", nodes[:10], nil)
+	tree2, url2 := makeTestTree("t2", nodes[10:], []string{url1})
+	r := newMapResolver(tree1.ToTXT("t1"), tree2.ToTXT("t2"))
+	c := NewClient(Config{Resolver: r, Logger: testlog(t)})
+
+	it, err := c.NewIterator(url2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	checkIterator(t, it, nodes)
+}
+
+// This test verifies that the iterator picks up changes to the tree
+// after the recheck interval.
+func TestIteratorNodeUpdates(t *testing.T) {
+	var (
+		clock    = new(mclock.Simulated)
+		nodes    = testNodes(nodesSeed1, 30)
+		resolver = newMapResolver()
+		c        = NewClient(Config{
+			Resolver:        resolver,
+			Logger:          testlog(t),
+			RecheckInterval: 20 * time.Minute,
+		})
+	)
+	c.clock = clock
+	tree1, url := makeTestTree("n", nodes[:25], nil)
+	it, err := c.NewIterator(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+
+	// Sync the original tree.
+	resolver.add(tree1.ToTXT("n"))
+	checkIterator(t, it, nodes[:25])
+
+	// Update the tree and advance the clock past the recheck interval.
+	// The new nodes must appear.
+	tree2, _ := makeTestTree("n", nodes, nil)
+	resolver.clear()
+	resolver.add(tree2.ToTXT("n"))
+	clock.Run(c.cfg.RecheckInterval + 1*time.Second)
+	checkIterator(t, it, nodes)
+}
+
+// This test checks that Close unblocks a pending call to Next.
+func TestIteratorClose(t *testing.T) {
+	nodes := testNodes(nodesSeed1, 3)
+	tree, url := makeTestTree("n", nodes, nil)
+	r := mapResolver(tree.ToTXT("n"))
+	// Make the tree unreachable so the iterator keeps waiting.
+	delete(r, "n")
+
+	c := NewClient(Config{Resolver: r, Logger: testlog(t)})
+	it, err := c.NewIterator(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan bool)
+	go func() {
+		done <- it.Next()
+	}()
+	time.Sleep(50 * time.Millisecond)
+	it.Close()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("Next returned true after Close")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Next did not return after Close")
+	}
+}
+
+func checkIterator(t *testing.T, it enode.Iterator, wantNodes []*enode.Node) {
+	t.Helper()
+
+	var (
+		want     = make(map[enode.ID]*enode.Node)
+		maxCalls = len(wantNodes) * 20
+		calls    = 0
+	)
+	for _, n := range wantNodes {
+		want[n.ID()] = n
+	}
+	for ; len(want) > 0 && calls < maxCalls; calls++ {
+		if !it.Next() {
+			t.Fatalf("Next returned false (call %d)", calls)
+		}
+		delete(want, it.Node().ID())
+	}
+	if len(want) > 0 {
+		t.Fatalf("iterator returned %d/%d nodes after %d calls", len(wantNodes)-len(want), len(wantNodes), calls)
+	}
+}
+
+func makeTestTree(domain string, nodes []*enode.Node, links []string) (*Tree, string) {
+	tree, err := MakeTree(1, nodes, links)
+	if err != nil {
+		panic(err)
+	}
+	url, err := tree.Sign(testKey(signingKeySeed), domain)
+	if err != nil {
+		panic(err)
+	}
+	return tree, url
+}
+
+// testKeys creates deterministic private keys for testing.
+func testKeys(seed int64, n int) []*ecdsa.PrivateKey {
+	rand := rand.New(rand.NewSource(seed))
+	keys := make([]*ecdsa.PrivateKey, n)
+	for i := 0; i < n; i++ {
+		b := make([]byte, 32)
+		rand.Read(b)
+		key, err := crypto.ToECDSA(b)
+		if err != nil {
+			panic("can't generate key: " + err.Error())
+		}
+		keys[i] = key
+	}
+	return keys
+}
+
+func testKey(seed int64) *ecdsa.PrivateKey {
+	return testKeys(seed, 1)[0]
+}
+
+func testNodes(seed int64, n int) []*enode.Node {
+	keys := testKeys(seed, n)
+	nodes := make([]*enode.Node, n)
+	for i, key := range keys {
+		record := new(enr.Record)
+		record.SetSeq(uint64(i))
+		enode.SignV4(record, key)
+		n, err := enode.New(enode.ValidSchemes, record)
+		if err != nil {
+			panic(err)
+		}
+		nodes[i] = n
+	}
+	return nodes
+}
+
+func testNode(seed int64) *enode.Node {
+	return testNodes(seed, 1)[0]
+}
+
+func sortByID(nodes []*enode.Node) []*enode.Node {
+	sorted := make([]*enode.Node, len(nodes))
+	copy(sorted, nodes)
+	sort.Sort(nodesByID(sorted))
+	return sorted
+}
+
+func testlog(t *testing.T) log.Logger {
+	l := log.New()
+	l.SetHandler(log.DiscardHandler())
+	return l
+}
+
+// mapResolver is an in-memory DNS resolver for testing.
+type mapResolver map[string]string
+
+func newMapResolver(maps ...map[string]string) mapResolver {
+	mr := make(mapResolver)
+	for _, m := range maps {
+		mr.add(m)
+	}
+	return mr
+}
+
+func (mr mapResolver) clear() {
+	for k := range mr {
+		delete(mr, k)
+	}
+}
+
+func (mr mapResolver) add(m map[string]string) {
+	for k, v := range m {
+		mr[k] = v
+	}
+}
+
+func (mr mapResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if record, ok := mr[name]; ok {
+		return []string{record}, nil
+	}
+	return nil, nil
+}
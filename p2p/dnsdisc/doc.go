@@ -0,0 +1,28 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package dnsdisc implements node discovery via DNS (EIP-1459).
+//
+// Node lists are published as a Merkle tree of TXT records. The root record at the
+// tree's domain name is signed and points to the roots of two subtrees: one holding
+// node records and one holding links to other trees. All other records are named by
+// the hash of their content, so a client which trusts the root key can verify every
+// entry it downloads.
+//
+// Trees are referenced by enrtree URLs of the form
+//
+//	enrtree://<base32 public key>@<domain>
+package dnsdisc
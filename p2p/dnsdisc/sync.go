@@ -0,0 +1,364 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsdisc
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/ETSC3259/etsc/common/mclock"
+	"github.com/ETSC3259/etsc/p2p/enode"
+)
+
+const (
+	rootRecheckFailCount = 5               // update root if this many leaf requests fail
+	syncRetryDelay       = 5 * time.Second // pause after a failed request
+)
+
+// clientTree is a full tree being synced.
+type clientTree struct {
+	c   *Client
+	loc *linkEntry // link to this tree
+
+	lastRootCheck mclock.AbsTime // last revalidation of root
+	nextSync      mclock.AbsTime // earliest time of the next request, set after errors
+	leafFailCount int
+
+	root  *rootEntry
+	enrs  *subtreeSync
+	links *subtreeSync
+
+	curLinks     map[string]*linkEntry // links of the last complete link tree sync
+	newLinks     map[string]*linkEntry // links found by the current link tree sync
+	linksChanged bool                  // set when curLinks was replaced
+}
+
+func newClientTree(c *Client, loc *linkEntry) *clientTree {
+	return &clientTree{c: c, loc: loc}
+}
+
+// syncAll retrieves all entries of the tree.
+func (ct *clientTree) syncAll(dest map[string]entry) error {
+	ctx := context.Background()
+	if err := ct.updateRoot(ctx); err != nil {
+		return err
+	}
+	for _, ts := range []*subtreeSync{ct.links, ct.enrs} {
+		for !ts.done() {
+			hash, e, err := ts.resolveNext(ctx, len(ts.missing)-1)
+			if err != nil {
+				return err
+			}
+			dest[hash] = e
+		}
+	}
+	return nil
+}
+
+// syncRandom retrieves a single entry of the tree. The link tree is synced first, then
+// random entries of the node tree are fetched. The returned node is nil if the entry
+// wasn't a node record.
+func (ct *clientTree) syncRandom(ctx context.Context) (*enode.Node, error) {
+	if ct.rootUpdateDue() {
+		if err := ct.updateRoot(ctx); err != nil {
+			return nil, err
+		}
+	}
+	// Sync the link tree first.
+	if !ct.links.done() {
+		return nil, ct.syncNextLink(ctx)
+	}
+	// Sync the next random entry of the node tree. Once every node has been visited,
+	// start over. This is cheap because entries are cached by the client.
+	if ct.enrs.done() {
+		ct.enrs = newSubtreeSync(ct.c, ct.loc, ct.root.eroot, false)
+	}
+	return ct.syncNextRandomENR(ctx)
+}
+
+// canSyncRandom reports whether syncRandom can make progress right now.
+func (ct *clientTree) canSyncRandom() bool {
+	if ct.c.clock.Now() < ct.nextSync {
+		return false
+	}
+	if ct.rootUpdateDue() {
+		return true
+	}
+	// The leaf count check matters: once the node tree is fully synced without
+	// finding any leaves, the tree is empty and can't provide nodes.
+	return !ct.links.done() || !ct.enrs.done() || ct.enrs.leaves != 0
+}
+
+// nextWake returns the time at which a tree that can't be synced right now
+// becomes usable again.
+func (ct *clientTree) nextWake() mclock.AbsTime {
+	if now := ct.c.clock.Now(); now < ct.nextSync {
+		return ct.nextSync
+	}
+	return ct.lastRootCheck.Add(ct.c.cfg.RecheckInterval)
+}
+
+func (ct *clientTree) syncNextLink(ctx context.Context) error {
+	_, e, err := ct.links.resolveNext(ctx, len(ct.links.missing)-1)
+	if err != nil {
+		ct.leafFailCount++
+		return err
+	}
+	ct.leafFailCount = 0
+	if le, ok := e.(*linkEntry); ok {
+		ct.newLinks[le.str] = le
+	}
+	if ct.links.done() {
+		ct.curLinks, ct.newLinks = ct.newLinks, make(map[string]*linkEntry)
+		ct.linksChanged = true
+	}
+	return nil
+}
+
+func (ct *clientTree) syncNextRandomENR(ctx context.Context) (*enode.Node, error) {
+	index := rand.Intn(len(ct.enrs.missing))
+	_, e, err := ct.enrs.resolveNext(ctx, index)
+	if err != nil {
+		ct.leafFailCount++
+		return nil, err
+	}
+	ct.leafFailCount = 0
+	if ee, ok := e.(*enrEntry); ok {
+		return ee.node, nil
+	}
+	return nil, nil
+}
+
+func (ct *clientTree) String() string {
+	return ct.loc.String()
+}
+
+// updateRoot ensures that the given tree has an up-to-date root.
+func (ct *clientTree) updateRoot(ctx context.Context) error {
+	ct.lastRootCheck = ct.c.clock.Now()
+	root, err := ct.c.resolveRoot(ctx, ct.loc)
+	if err != nil {
+		return err
+	}
+	ct.root = &root
+	ct.leafFailCount = 0
+
+	// Invalidate subtrees if changed.
+	if ct.links == nil || root.lroot != ct.links.root {
+		ct.links = newSubtreeSync(ct.c, ct.loc, root.lroot, true)
+		ct.newLinks = make(map[string]*linkEntry)
+	}
+	if ct.enrs == nil || root.eroot != ct.enrs.root {
+		ct.enrs = newSubtreeSync(ct.c, ct.loc, root.eroot, false)
+	}
+	return nil
+}
+
+// rootUpdateDue returns true when a root update is needed.
+func (ct *clientTree) rootUpdateDue() bool {
+	tooManyFailures := ct.leafFailCount > rootRecheckFailCount
+	scheduledCheck := ct.c.clock.Now() >= ct.lastRootCheck.Add(ct.c.cfg.RecheckInterval)
+	return ct.root == nil || tooManyFailures || scheduledCheck
+}
+
+// subtreeSync is the sync of an ENR or link subtree.
+type subtreeSync struct {
+	c       *Client
+	loc     *linkEntry
+	root    string
+	missing []string // missing tree node hashes
+	link    bool     // true if this sync is for the link tree
+	leaves  int      // counter of synced leaves
+}
+
+func newSubtreeSync(c *Client, loc *linkEntry, root string, link bool) *subtreeSync {
+	return &subtreeSync{c, loc, root, []string{root}, link, 0}
+}
+
+func (ts *subtreeSync) done() bool {
+	return len(ts.missing) == 0
+}
+
+// resolveNext fetches the missing entry at the given index. On success, the entry
+// is removed from the missing list and the children of branches are added to it.
+func (ts *subtreeSync) resolveNext(ctx context.Context, index int) (string, entry, error) {
+	hash := ts.missing[index]
+	e, err := ts.c.resolveEntry(ctx, ts.loc.domain, hash)
+	if err != nil {
+		return hash, nil, err
+	}
+	switch e.(type) {
+	case *enrEntry:
+		if ts.link {
+			return hash, nil, errENRInLinkTree
+		}
+		ts.leaves++
+	case *linkEntry:
+		if !ts.link {
+			return hash, nil, errLinkInENRTree
+		}
+		ts.leaves++
+	}
+	last := len(ts.missing) - 1
+	ts.missing[index] = ts.missing[last]
+	ts.missing = ts.missing[:last]
+	if b, ok := e.(*branchEntry); ok {
+		ts.missing = append(ts.missing, b.children...)
+	}
+	return hash, e, nil
+}
+
+// randomIterator traverses a set of trees and returns nodes found in them.
+type randomIterator struct {
+	cur      *enode.Node
+	ctx      context.Context
+	cancelFn context.CancelFunc
+	c        *Client
+
+	roots map[string]*linkEntry  // trees added by the user
+	trees map[string]*clientTree // all trees, including linked ones
+}
+
+func newRandomIterator(c *Client) *randomIterator {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &randomIterator{
+		c:        c,
+		ctx:      ctx,
+		cancelFn: cancel,
+		roots:    make(map[string]*linkEntry),
+		trees:    make(map[string]*clientTree),
+	}
+}
+
+// Node returns the current node.
+func (it *randomIterator) Node() *enode.Node {
+	return it.cur
+}
+
+// Close closes the iterator.
+func (it *randomIterator) Close() {
+	it.cancelFn()
+}
+
+// Next moves the iterator to the next node.
+func (it *randomIterator) Next() bool {
+	it.cur = it.nextNode()
+	return it.cur != nil
+}
+
+// addTree adds a root tree to the iterator.
+func (it *randomIterator) addTree(url string) error {
+	le, err := parseLink(url)
+	if err != nil {
+		return fmt.Errorf("invalid enrtree URL: %v", err)
+	}
+	it.roots[le.str] = le
+	it.rebuildTrees()
+	return nil
+}
+
+// nextNode syncs random tree entries until it finds a node.
+func (it *randomIterator) nextNode() *enode.Node {
+	for {
+		ct := it.pickTree()
+		if ct == nil {
+			return nil
+		}
+		n, err := ct.syncRandom(it.ctx)
+		if ct.linksChanged {
+			ct.linksChanged = false
+			it.rebuildTrees()
+		}
+		if err != nil {
+			if it.ctx.Err() != nil {
+				return nil // context canceled.
+			}
+			ct.nextSync = it.c.clock.Now().Add(syncRetryDelay)
+			it.c.cfg.Logger.Debug("Error in DNS random node sync", "tree", ct.loc.domain, "err", err)
+			continue
+		}
+		if n != nil {
+			return n
+		}
+	}
+}
+
+// pickTree returns a random tree that can be synced. If no tree is ready, it waits
+// until one becomes ready. It returns nil when the iterator is closed.
+func (it *randomIterator) pickTree() *clientTree {
+	for {
+		if it.ctx.Err() != nil || len(it.trees) == 0 {
+			return nil
+		}
+		var (
+			ready []*clientTree
+			wake  mclock.AbsTime
+		)
+		for _, ct := range it.trees {
+			if ct.canSyncRandom() {
+				ready = append(ready, ct)
+			} else if w := ct.nextWake(); wake == 0 || w < wake {
+				wake = w
+			}
+		}
+		if len(ready) > 0 {
+			return ready[rand.Intn(len(ready))]
+		}
+		select {
+		case <-it.c.clock.After(time.Duration(wake - it.c.clock.Now())):
+		case <-it.ctx.Done():
+			return nil
+		}
+	}
+}
+
+// rebuildTrees updates the set of synced trees to contain the root trees and all trees
+// reachable from them through links.
+func (it *randomIterator) rebuildTrees() {
+	var (
+		keep  = make(map[string]*linkEntry)
+		queue = make([]*linkEntry, 0, len(it.roots))
+	)
+	for _, le := range it.roots {
+		queue = append(queue, le)
+	}
+	for len(queue) > 0 {
+		le := queue[0]
+		queue = queue[1:]
+		if keep[le.str] != nil {
+			continue
+		}
+		keep[le.str] = le
+		if ct := it.trees[le.str]; ct != nil {
+			for _, link := range ct.curLinks {
+				queue = append(queue, link)
+			}
+		}
+	}
+	for url := range it.trees {
+		if keep[url] == nil {
+			delete(it.trees, url)
+		}
+	}
+	for url, le := range keep {
+		if it.trees[url] == nil {
+			it.trees[url] = newClientTree(it.c, le)
+		}
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"fmt"
+	"net"
 	"os"
 	"sync"
 	"time"
@@ -47,6 +48,11 @@ const (
 	dbDiscoverFindFails = dbDiscoverRoot + ":findfail"
 	dbLocalRoot         = ":local"
 	dbLocalSeq          = dbLocalRoot + ":seq"
+
+	// Bans are kept outside of the node entries so they survive node expiration.
+	dbBanPrefix     = "ban:"
+	dbBanNodePrefix = dbBanPrefix + "n:"
+	dbBanIPPrefix   = dbBanPrefix + "ip:"
 )
 
 var (
@@ -262,6 +268,9 @@ func (db *DB) expirer() {
 			if err := db.expireNodes(); err != nil {
 				log.Error("Failed to expire nodedb items", "err", err)
 			}
+			if err := db.expireBans(); err != nil {
+				log.Error("Failed to expire nodedb bans", "err", err)
+			}
 		case <-db.quit:
 			return
 		}
@@ -388,6 +397,138 @@ func nextNode(it iterator.Iterator) *Node {
 	return nil
 }
 
+// Ban is an entry of the ban list. Exactly one of ID and IP is set.
+type Ban struct {
+	ID    ID        `json:"id,omitempty"`
+	IP    net.IP    `json:"ip,omitempty"`
+	Until time.Time `json:"until"` // zero for permanent bans
+}
+
+// Permanent reports whether the ban never expires.
+func (b Ban) Permanent() bool {
+	return b.Until.IsZero()
+}
+
+func banNodeKey(id ID) []byte {
+	return append([]byte(dbBanNodePrefix), id[:]...)
+}
+
+func banIPKey(ip net.IP) []byte {
+	return append([]byte(dbBanIPPrefix), ip.To16()...)
+}
+
+// storeBan stores a ban expiring at the given time, or a permanent ban if the
+// time is zero.
+func (db *DB) storeBan(key []byte, until time.Time) error {
+	expiry := int64(-1)
+	if !until.IsZero() {
+		expiry = until.Unix()
+	}
+	return db.storeInt64(key, expiry)
+}
+
+// fetchBan retrieves the ban stored in the given key. The returned flag is false
+// if there is no such ban or if it has already expired.
+func (db *DB) fetchBan(key []byte, now time.Time) (until time.Time, banned bool) {
+	blob, err := db.lvl.Get(key, nil)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return decodeBan(blob, now)
+}
+
+func decodeBan(blob []byte, now time.Time) (until time.Time, banned bool) {
+	expiry, read := binary.Varint(blob)
+	switch {
+	case read <= 0:
+		return time.Time{}, false
+	case expiry < 0:
+		return time.Time{}, true
+	default:
+		until = time.Unix(expiry, 0)
+		return until, now.Before(until)
+	}
+}
+
+// BanNode bans a node until the given time. A zero time bans it permanently.
+func (db *DB) BanNode(id ID, until time.Time) error {
+	return db.storeBan(banNodeKey(id), until)
+}
+
+// UnbanNode removes the ban of a node.
+func (db *DB) UnbanNode(id ID) error {
+	return db.lvl.Delete(banNodeKey(id), nil)
+}
+
+// NodeBan retrieves the expiry time of a node's ban. The returned time is zero
+// for permanent bans, banned is false if the node isn't banned.
+func (db *DB) NodeBan(id ID) (until time.Time, banned bool) {
+	return db.fetchBan(banNodeKey(id), time.Now())
+}
+
+// BanIP bans an IP address until the given time. A zero time bans it permanently.
+func (db *DB) BanIP(ip net.IP, until time.Time) error {
+	return db.storeBan(banIPKey(ip), until)
+}
+
+// UnbanIP removes the ban of an IP address.
+func (db *DB) UnbanIP(ip net.IP) error {
+	return db.lvl.Delete(banIPKey(ip), nil)
+}
+
+// IPBan retrieves the expiry time of an IP address' ban. The returned time is
+// zero for permanent bans, banned is false if the address isn't banned.
+func (db *DB) IPBan(ip net.IP) (until time.Time, banned bool) {
+	return db.fetchBan(banIPKey(ip), time.Now())
+}
+
+// Bans returns all bans which are currently in effect.
+func (db *DB) Bans() []Ban {
+	var (
+		now  = time.Now()
+		bans []Ban
+		it   = db.lvl.NewIterator(util.BytesPrefix([]byte(dbBanPrefix)), nil)
+	)
+	defer it.Release()
+
+	for it.Next() {
+		until, banned := decodeBan(it.Value(), now)
+		if !banned {
+			continue
+		}
+		ban := Ban{Until: until}
+		switch key := it.Key(); {
+		case bytes.HasPrefix(key, []byte(dbBanNodePrefix)) && len(key) == len(dbBanNodePrefix)+len(ID{}):
+			copy(ban.ID[:], key[len(dbBanNodePrefix):])
+		case bytes.HasPrefix(key, []byte(dbBanIPPrefix)) && len(key) == len(dbBanIPPrefix)+net.IPv6len:
+			ban.IP = append(net.IP(nil), key[len(dbBanIPPrefix):]...)
+			if ip4 := ban.IP.To4(); ip4 != nil {
+				ban.IP = ip4
+			}
+		default:
+			continue
+		}
+		bans = append(bans, ban)
+	}
+	return bans
+}
+
+// expireBans deletes all bans which have expired.
+func (db *DB) expireBans() error {
+	now := time.Now()
+	it := db.lvl.NewIterator(util.BytesPrefix([]byte(dbBanPrefix)), nil)
+	defer it.Release()
+
+	for it.Next() {
+		if _, banned := decodeBan(it.Value(), now); !banned {
+			if err := db.lvl.Delete(it.Key(), nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // close flushes and closes the database files.
 func (db *DB) Close() {
 	close(db.quit)
@@ -370,3 +370,69 @@ func TestDBExpiration(t *testing.T) {
 		}
 	}
 }
+
+func TestDBBans(t *testing.T) {
+	db, _ := OpenDB("")
+	defer db.Close()
+
+	var (
+		now       = time.Now().Truncate(time.Second)
+		permanent = ID{1}
+		temporary = ID{2}
+		expired   = ID{3}
+		ip        = net.IP{10, 3, 58, 6}
+	)
+	db.BanNode(permanent, time.Time{})
+	db.BanNode(temporary, now.Add(time.Hour))
+	db.BanNode(expired, now.Add(-time.Second))
+	db.BanIP(ip, now.Add(time.Hour))
+
+	if until, banned := db.NodeBan(permanent); !banned || !until.IsZero() {
+		t.Errorf("permanent ban: got (%v, %t)", until, banned)
+	}
+	if until, banned := db.NodeBan(temporary); !banned || !until.Equal(now.Add(time.Hour)) {
+		t.Errorf("temporary ban: got (%v, %t)", until, banned)
+	}
+	if _, banned := db.NodeBan(expired); banned {
+		t.Errorf("expired ban still in effect")
+	}
+	if _, banned := db.NodeBan(ID{4}); banned {
+		t.Errorf("unknown node is banned")
+	}
+	if _, banned := db.IPBan(ip); !banned {
+		t.Errorf("IP not banned")
+	}
+	if _, banned := db.IPBan(net.IP{10, 3, 58, 7}); banned {
+		t.Errorf("wrong IP banned")
+	}
+
+	want := []Ban{
+		{IP: ip, Until: now.Add(time.Hour)},
+		{ID: permanent},
+		{ID: temporary, Until: now.Add(time.Hour)},
+	}
+	if bans := db.Bans(); !reflect.DeepEqual(bans, want) {
+		t.Errorf("wrong ban list:\ngot  %v\nwant %v", bans, want)
+	}
+
+	// Bans must survive node expiration, expired bans are removed.
+	db.UpdateNode(nodeDBExpirationNodes[1].node)
+	if err := db.expireNodes(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.expireBans(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.lvl.Get(banNodeKey(expired), nil); err == nil {
+		t.Errorf("expired ban not deleted")
+	}
+	if _, banned := db.NodeBan(permanent); !banned {
+		t.Errorf("permanent ban deleted by expiration")
+	}
+
+	db.UnbanNode(permanent)
+	db.UnbanIP(ip)
+	if bans := db.Bans(); len(bans) != 1 || bans[0].ID != temporary {
+		t.Errorf("wrong ban list after unban: %v", bans)
+	}
+}
@@ -105,6 +105,20 @@ type Peer struct {
 	running map[string]*protoRW
 	log     log.Logger
 	created mclock.AbsTime
+	traffic *peerTraffic
+
+	// reputation receives the events submitted through Report. It is
+	// nil for peers which aren't managed by a Server.
+	reputation *reputation
+
+	// disconnectBanned drops all the server's peers matching a predicate. It
+	// is used to disconnect every peer of an address banned through Report.
+	disconnectBanned func(match func(*Peer) bool)
+
+	// evicted is set by the server loop when the peer is being dropped to
+	// make room for a higher priority connection. It is only accessed by
+	// that loop.
+	evicted bool
 
 	wg       sync.WaitGroup
 	protoErr chan error
@@ -176,12 +190,32 @@ func (p *Peer) Inbound() bool {
 	return p.rw.is(inboundConn)
 }
 
+// Report submits a reputation event about the peer. When the peer's score drops
+// below the ban threshold it is banned temporarily and disconnected. If its IP
+// address gets banned, all other peers from that address are disconnected too.
+// Trusted peers are never banned.
+func (p *Peer) Report(ev ReputationEvent) {
+	if p.rw.is(trustedConn) {
+		return
+	}
+	ip := remoteIP(p.rw.fd)
+	if p.reputation.report(p.ID(), ip, ev) {
+		p.log.Debug("Peer banned", "reason", ev.Reason)
+		p.Disconnect(DiscUselessPeer)
+
+		if p.disconnectBanned != nil && p.reputation.ipBanned(ip) {
+			p.disconnectBanned(func(peer *Peer) bool { return ip.Equal(remoteIP(peer.rw.fd)) })
+		}
+	}
+}
+
 func newPeer(conn *conn, protocols []Protocol) *Peer {
 	protomap := matchProtocols(protocols, conn.caps, conn)
 	p := &Peer{
 		rw:       conn,
 		running:  protomap,
 		created:  mclock.Now(),
+		traffic:  newPeerTraffic(),
 		disc:     make(chan DiscReason),
 		protoErr: make(chan error, len(protomap)+1), // protocols + pingLoop
 		closed:   make(chan struct{}),
@@ -241,6 +275,7 @@ loop:
 	close(p.closed)
 	p.rw.close(reason)
 	p.wg.Wait()
+	p.traffic.reset()
 	return remoteRequested, err
 }
 
@@ -298,6 +333,7 @@ func (p *Peer) handle(msg Msg) error {
 		if err != nil {
 			return fmt.Errorf("msg code out of range: %v", msg.Code)
 		}
+		p.traffic.add(true, proto.Protocol, msg.Code-proto.offset, msg.Size)
 		select {
 		case proto.in <- msg:
 			return nil
@@ -352,6 +388,7 @@ func (p *Peer) startProtocols(writeStart <-chan struct{}, writeErr chan<- error)
 		proto.closed = p.closed
 		proto.wstart = writeStart
 		proto.werr = writeErr
+		proto.traffic = p.traffic
 		var rw MsgReadWriter = proto
 		if p.events != nil {
 			rw = newMsgEventer(rw, p.events, p.ID(), proto.Name)
@@ -390,16 +427,22 @@ type protoRW struct {
 	werr   chan<- error    // for write results
 	offset uint64
 	w      MsgWriter
+
+	traffic *peerTraffic // accounts for written messages, may be nil
 }
 
 func (rw *protoRW) WriteMsg(msg Msg) (err error) {
 	if msg.Code >= rw.Length {
 		return newPeerError(errInvalidMsgCode, "not handled")
 	}
+	code, size := msg.Code, msg.Size
 	msg.Code += rw.offset
 	select {
 	case <-rw.wstart:
 		err = rw.w.WriteMsg(msg)
+		if err == nil {
+			rw.traffic.add(false, rw.Protocol, code, size)
+		}
 		// Report write status back to Peer.run. It will initiate
 		// shutdown if the error is non-nil and unblock the next write
 		// otherwise. The calling protocol code should exit for errors
@@ -436,7 +479,9 @@ type PeerInfo struct {
 		Trusted       bool   `json:"trusted"`
 		Static        bool   `json:"static"`
 	} `json:"network"`
-	Protocols map[string]interface{} `json:"protocols"` // Sub-protocol specific metadata fields
+	Protocols  map[string]interface{} `json:"protocols"`  // Sub-protocol specific metadata fields
+	Traffic    PeerTrafficInfo        `json:"traffic"`    // Message and byte counters of this session
+	Reputation float64                `json:"reputation"` // Current reputation score of the node
 }
 
 // Info gathers and returns a collection of metadata known about a peer.
@@ -448,11 +493,12 @@ func (p *Peer) Info() *PeerInfo {
 	}
 	// Assemble the generic peer metadata
 	info := &PeerInfo{
-		Enode:     p.Node().String(),
-		ID:        p.ID().String(),
-		Name:      p.Name(),
-		Caps:      caps,
-		Protocols: make(map[string]interface{}),
+		Enode:      p.Node().String(),
+		ID:         p.ID().String(),
+		Name:       p.Name(),
+		Caps:       caps,
+		Protocols:  make(map[string]interface{}),
+		Reputation: p.reputation.score(p.ID()),
 	}
 	info.Network.LocalAddress = p.LocalAddr().String()
 	info.Network.RemoteAddress = p.RemoteAddr().String()
@@ -460,6 +506,10 @@ func (p *Peer) Info() *PeerInfo {
 	info.Network.Trusted = p.rw.is(trustedConn)
 	info.Network.Static = p.rw.is(staticDialedConn)
 
+	info.Traffic.HandshakeRTT = p.rw.handshakeRTT
+	info.Traffic.Connected = time.Duration(mclock.Now() - p.created)
+	info.Traffic.Protocols = p.traffic.snapshot()
+
 	// Gather all the running protocol infos
 	for _, proto := range p.running {
 		protoInfo := interface{}("unknown")
@@ -24,6 +24,8 @@ import (
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/ETSC3259/etsc/rlp"
 )
 
 var discard = Protocol{
@@ -120,6 +122,64 @@ func TestPeerProtoEncodeMsg(t *testing.T) {
 	}
 }
 
+// This test checks that sub-protocol messages are accounted for in both
+// directions and that the counters are cleared when the peer disconnects.
+func TestPeerTraffic(t *testing.T) {
+	var (
+		size1, _ = rlp.EncodeToBytes([]uint{1})
+		size2, _ = rlp.EncodeToBytes([]string{"foo", "bar"})
+	)
+	proto := Protocol{
+		Name:    "a",
+		Version: 3,
+		Length:  5,
+		Run: func(peer *Peer, rw MsgReadWriter) error {
+			for i := 0; i < 2; i++ {
+				if err := ExpectMsg(rw, 1, []uint{1}); err != nil {
+					t.Error(err)
+				}
+			}
+			if err := SendItems(rw, 4, "foo", "bar"); err != nil {
+				t.Errorf("write error: %v", err)
+			}
+			want := map[string]*ProtocolTraffic{
+				"a": {
+					Version: 3,
+					Ingress: map[uint64]MsgTraffic{1: {Messages: 2, Bytes: 2 * uint64(len(size1))}},
+					Egress:  map[uint64]MsgTraffic{4: {Messages: 1, Bytes: uint64(len(size2))}},
+				},
+			}
+			info := peer.Info()
+			if !reflect.DeepEqual(info.Traffic.Protocols, want) {
+				t.Errorf("wrong traffic info:\ngot  %+v\nwant %+v", info.Traffic.Protocols["a"], want["a"])
+			}
+			if info.Traffic.Connected <= 0 {
+				t.Errorf("wrong connection time %v", info.Traffic.Connected)
+			}
+			return nil
+		},
+	}
+	closer, rw, peer, errc := testPeer([]Protocol{proto})
+	defer closer()
+
+	Send(rw, baseProtocolLength+1, []uint{1})
+	Send(rw, baseProtocolLength+1, []uint{1})
+	if err := ExpectMsg(rw, baseProtocolLength+4, []string{"foo", "bar"}); err != nil {
+		t.Error(err)
+	}
+	select {
+	case err := <-errc:
+		if err != errProtocolReturned {
+			t.Errorf("peer returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("receive timeout")
+	}
+	if protos := peer.traffic.snapshot(); len(protos) != 0 {
+		t.Errorf("traffic counters not cleared after disconnect: %v", protos)
+	}
+}
+
 func TestPeerPing(t *testing.T) {
 	closer, rw, _, _ := testPeer(nil)
 	defer closer()
@@ -56,6 +56,17 @@ type Protocol struct {
 
 	// Attributes contains protocol specific information for the node record.
 	Attributes []enr.Entry
+
+	// DialFilter is an optional predicate for dial candidates found through
+	// discovery. Candidates rejected by the filter of any protocol are not
+	// dialed. Static nodes and bootnodes are not filtered.
+	DialFilter func(*enode.Node) bool
+
+	// DialCandidates, if non-nil, is a way to tell Server about protocol-specific nodes
+	// that should be dialed. The server continuously reads nodes from the iterator and
+	// attempts to create connections to them. The iterator is closed when the server
+	// shuts down.
+	DialCandidates enode.Iterator
 }
 
 func (p Protocol) cap() Cap {
@@ -0,0 +1,207 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ETSC3259/etsc/common/mclock"
+	"github.com/ETSC3259/etsc/log"
+	"github.com/ETSC3259/etsc/p2p/enode"
+	"github.com/ETSC3259/etsc/p2p/netutil"
+)
+
+// ReputationEvent is a change of a peer's reputation reported by a protocol.
+type ReputationEvent struct {
+	Score  float64 // Added to the peer's score, negative for misbehaviour
+	Reason string  // Human-readable description for logs
+}
+
+// Reputation events shared by the protocols. Protocols may define their own events
+// as long as the scores are in the same order of magnitude.
+var (
+	RepUsefulResponse    = ReputationEvent{Score: 1, Reason: "useful response"}
+	RepInvalidTx         = ReputationEvent{Score: -5, Reason: "invalid transaction"}
+	RepStalledRequest    = ReputationEvent{Score: -10, Reason: "stalled request"}
+	RepProtocolViolation = ReputationEvent{Score: -40, Reason: "protocol violation"}
+	RepInvalidBlock      = ReputationEvent{Score: -60, Reason: "invalid block"}
+)
+
+const (
+	reputationHalfLife       = 30 * time.Minute // Time after which scores have decayed to half their value
+	reputationMaxScore       = 100              // Upper bound of the score, limits the credit of long-lived peers
+	reputationBanThreshold   = -100             // Nodes reaching this score are banned
+	reputationIPBanThreshold = -300             // IP addresses reaching this score are banned
+	reputationBanDuration    = time.Hour        // Duration of automatic bans
+	reputationMaxTracked     = 4096             // Number of scores kept in memory before pruning
+)
+
+// reputation keeps decaying scores of nodes and their IP addresses and bans them
+// when the score drops below a threshold. Scores are kept in memory only, the
+// resulting bans are stored in the node database.
+type reputation struct {
+	db    *enode.DB
+	clock mclock.Clock
+	log   log.Logger
+
+	mu    sync.Mutex
+	nodes map[enode.ID]*repScore
+	ips   map[string]*repScore
+}
+
+// repScore is an exponentially decaying score.
+type repScore struct {
+	value   float64
+	updated mclock.AbsTime
+}
+
+// current decays the score to the given time and returns it.
+func (s *repScore) current(now mclock.AbsTime) float64 {
+	if dt := time.Duration(now - s.updated); dt > 0 {
+		s.value *= math.Exp2(-float64(dt) / float64(reputationHalfLife))
+		s.updated = now
+	}
+	return s.value
+}
+
+// add adds delta to the decayed score and returns the new value.
+func (s *repScore) add(now mclock.AbsTime, delta float64) float64 {
+	s.value = math.Min(s.current(now)+delta, reputationMaxScore)
+	return s.value
+}
+
+func newReputation(db *enode.DB, clock mclock.Clock, log log.Logger) *reputation {
+	return &reputation{
+		db:    db,
+		clock: clock,
+		log:   log,
+		nodes: make(map[enode.ID]*repScore),
+		ips:   make(map[string]*repScore),
+	}
+}
+
+// report applies an event to the scores of a node and its IP address. It returns
+// true if the event caused the node or the address to be banned.
+//
+// Addresses in LAN ranges are never scored because many nodes may legitimately
+// share them.
+func (r *reputation) report(id enode.ID, ip net.IP, ev ReputationEvent) (banned bool) {
+	if r == nil {
+		return false
+	}
+	now := r.clock.Now()
+	until := time.Now().Add(reputationBanDuration)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ns := r.nodes[id]
+	if ns == nil {
+		ns = &repScore{updated: now}
+		r.nodes[id] = ns
+	}
+	if score := ns.add(now, ev.Score); score <= reputationBanThreshold {
+		r.log.Debug("Banning node", "id", id, "score", score, "reason", ev.Reason, "until", until)
+		if err := r.db.BanNode(id, until); err != nil {
+			r.log.Warn("Failed to store node ban", "id", id, "err", err)
+		}
+		delete(r.nodes, id)
+		banned = true
+	}
+	if ip != nil && !netutil.IsLAN(ip) {
+		key := string(ip.To16())
+		is := r.ips[key]
+		if is == nil {
+			is = &repScore{updated: now}
+			r.ips[key] = is
+		}
+		if score := is.add(now, ev.Score); score <= reputationIPBanThreshold {
+			r.log.Debug("Banning IP address", "ip", ip, "score", score, "reason", ev.Reason, "until", until)
+			if err := r.db.BanIP(ip, until); err != nil {
+				r.log.Warn("Failed to store IP ban", "ip", ip, "err", err)
+			}
+			delete(r.ips, key)
+			banned = true
+		}
+	}
+	if len(r.nodes)+len(r.ips) > reputationMaxTracked {
+		r.prune(now)
+	}
+	return banned
+}
+
+// prune drops all scores which have decayed close to zero.
+func (r *reputation) prune(now mclock.AbsTime) {
+	for id, s := range r.nodes {
+		if math.Abs(s.current(now)) < 1 {
+			delete(r.nodes, id)
+		}
+	}
+	for ip, s := range r.ips {
+		if math.Abs(s.current(now)) < 1 {
+			delete(r.ips, ip)
+		}
+	}
+}
+
+// score returns the current score of a node.
+func (r *reputation) score(id enode.ID) float64 {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s := r.nodes[id]; s != nil {
+		return s.current(r.clock.Now())
+	}
+	return 0
+}
+
+// forget drops the scores of a node and an IP address. Both arguments are optional.
+func (r *reputation) forget(id enode.ID, ip net.IP) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.nodes, id)
+	if ip != nil {
+		delete(r.ips, string(ip.To16()))
+	}
+}
+
+// banned reports whether the node or the IP address is banned.
+func (r *reputation) banned(id enode.ID, ip net.IP) bool {
+	if r == nil {
+		return false
+	}
+	if _, banned := r.db.NodeBan(id); banned {
+		return true
+	}
+	return r.ipBanned(ip)
+}
+
+// ipBanned reports whether the IP address is banned.
+func (r *reputation) ipBanned(ip net.IP) bool {
+	if r == nil || ip == nil {
+		return false
+	}
+	_, banned := r.db.IPBan(ip)
+	return banned
+}
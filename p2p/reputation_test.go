@@ -0,0 +1,126 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"math"
+	"net"
+	"testing"
+
+	"github.com/ETSC3259/etsc/common/mclock"
+	"github.com/ETSC3259/etsc/log"
+	"github.com/ETSC3259/etsc/p2p/enode"
+)
+
+func newTestReputation(t *testing.T) (*reputation, *mclock.Simulated) {
+	db, err := enode.OpenDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := new(mclock.Simulated)
+	return newReputation(db, clock, log.Root()), clock
+}
+
+func TestReputationDecay(t *testing.T) {
+	rep, clock := newTestReputation(t)
+	defer rep.db.Close()
+
+	id := randomID()
+	rep.report(id, nil, ReputationEvent{Score: -60})
+	if s := rep.score(id); s != -60 {
+		t.Fatalf("wrong initial score %v", s)
+	}
+	clock.Run(reputationHalfLife)
+	if s := rep.score(id); math.Abs(s+30) > 1e-9 {
+		t.Fatalf("wrong score after half-life: %v, want -30", s)
+	}
+	clock.Run(2 * reputationHalfLife)
+	if s := rep.score(id); math.Abs(s+7.5) > 1e-9 {
+		t.Fatalf("wrong score after three half-lives: %v, want -7.5", s)
+	}
+
+	// Positive scores are capped.
+	for i := 0; i < 2*reputationMaxScore; i++ {
+		rep.report(id, nil, RepUsefulResponse)
+	}
+	if s := rep.score(id); s != reputationMaxScore {
+		t.Fatalf("score not capped: %v", s)
+	}
+}
+
+func TestReputationBan(t *testing.T) {
+	rep, _ := newTestReputation(t)
+	defer rep.db.Close()
+
+	var (
+		ip    = net.IP{203, 0, 113, 7}
+		lanIP = net.IP{192, 168, 0, 2}
+		ids   = []enode.ID{randomID(), randomID(), randomID()}
+	)
+	// The first invalid block isn't enough to ban the node, the second is.
+	if rep.report(ids[0], ip, RepInvalidBlock) {
+		t.Fatal("node banned after first offence")
+	}
+	if !rep.report(ids[0], ip, RepInvalidBlock) {
+		t.Fatal("node not banned after second offence")
+	}
+	if !rep.banned(ids[0], nil) {
+		t.Fatal("ban not stored")
+	}
+	if rep.score(ids[0]) != 0 {
+		t.Fatal("score not reset after ban")
+	}
+	if rep.ipBanned(ip) {
+		t.Fatal("IP banned too early")
+	}
+	// Misbehaving nodes sharing the address get the address banned.
+	rep.report(ids[1], ip, RepInvalidBlock)
+	rep.report(ids[1], ip, RepInvalidBlock)
+	if !rep.report(ids[2], ip, RepInvalidBlock) {
+		t.Fatal("no ban reported after IP score dropped below threshold")
+	}
+	if !rep.ipBanned(ip) || !rep.banned(randomID(), ip) {
+		t.Fatal("IP not banned")
+	}
+	if rep.banned(ids[2], nil) {
+		t.Fatal("node banned for a single offence")
+	}
+
+	// LAN addresses are never scored.
+	for i := 0; i < 10; i++ {
+		rep.report(randomID(), lanIP, RepInvalidBlock)
+		rep.report(randomID(), lanIP, RepInvalidBlock)
+	}
+	if rep.ipBanned(lanIP) {
+		t.Fatal("LAN IP banned")
+	}
+}
+
+func TestReputationPrune(t *testing.T) {
+	rep, clock := newTestReputation(t)
+	defer rep.db.Close()
+
+	for i := 0; i < reputationMaxTracked; i++ {
+		rep.report(randomID(), nil, RepUsefulResponse)
+	}
+	clock.Run(10 * reputationHalfLife)
+	id := randomID()
+	rep.report(id, nil, RepStalledRequest)
+	if len(rep.nodes) != 1 || rep.nodes[id] == nil {
+		t.Fatalf("decayed scores not pruned, %d remaining", len(rep.nodes))
+	}
+}
@@ -121,6 +121,54 @@ func (t *rlpx) close(err error) {
 	t.fd.Close()
 }
 
+// RLPXConn is a raw RLPx connection. Unlike connections managed by Server, it
+// doesn't run the devp2p protocol handshake or any subprotocols: all messages,
+// including the base protocol messages, are sent and received as is. This is
+// meant for tools which need to send arbitrary messages, such as protocol
+// conformance tests.
+type RLPXConn struct {
+	t *rlpx
+}
+
+// NewRLPXConn wraps the given network connection. The encryption handshake
+// must be performed before messages can be sent.
+func NewRLPXConn(fd net.Conn) *RLPXConn {
+	return &RLPXConn{t: newRLPX(fd).(*rlpx)}
+}
+
+// Handshake performs the encryption handshake. If remote is non-nil, the
+// handshake is initiated towards the given public key. Otherwise the
+// connection acts as the recipient. It returns the remote public key.
+func (c *RLPXConn) Handshake(prv *ecdsa.PrivateKey, remote *ecdsa.PublicKey) (*ecdsa.PublicKey, error) {
+	return c.t.doEncHandshake(prv, remote)
+}
+
+// ReadMsg reads a message from the connection.
+func (c *RLPXConn) ReadMsg() (Msg, error) {
+	return c.t.ReadMsg()
+}
+
+// WriteMsg writes a message to the connection.
+func (c *RLPXConn) WriteMsg(msg Msg) error {
+	return c.t.WriteMsg(msg)
+}
+
+// SetSnappy enables or disables snappy compression of message payloads. Server
+// enables compression after the protocol handshake if the remote end announces
+// base protocol version 5 or later.
+func (c *RLPXConn) SetSnappy(snappy bool) {
+	c.t.rmu.Lock()
+	c.t.wmu.Lock()
+	c.t.rw.snappy = snappy
+	c.t.wmu.Unlock()
+	c.t.rmu.Unlock()
+}
+
+// Close closes the underlying network connection.
+func (c *RLPXConn) Close() error {
+	return c.t.fd.Close()
+}
+
 func (t *rlpx) doProtoHandshake(our *protoHandshake) (their *protoHandshake, err error) {
 	// Writing our handshake happens concurrently, we prefer
 	// returning the handshake read error. If the remote side
@@ -135,8 +183,10 @@ func (t *rlpx) doProtoHandshake(our *protoHandshake) (their *protoHandshake, err
 	if err := <-werr; err != nil {
 		return nil, fmt.Errorf("write error: %v", err)
 	}
-	// If the protocol version supports Snappy encoding, upgrade immediately
-	t.rw.snappy = their.Version >= snappyProtocolVersion
+	// If both protocol versions support Snappy encoding, upgrade immediately.
+	// Peers running an older version never compress, so the check has to
+	// consider both sides to keep the connection symmetric.
+	t.rw.snappy = our.Version >= snappyProtocolVersion && their.Version >= snappyProtocolVersion
 
 	return their, nil
 }
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"crypto/ecdsa"
 	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -221,6 +222,116 @@ func TestProtocolHandshake(t *testing.T) {
 	wg.Wait()
 }
 
+// This test checks that Snappy compression is only enabled when both sides of
+// the connection announce a base protocol version that supports it, and that
+// messages are transferred intact in either case.
+func TestProtocolHandshakeSnappy(t *testing.T) {
+	tests := []struct {
+		v0, v1 uint64
+		snappy bool
+	}{
+		{v0: 4, v1: 4, snappy: false},
+		{v0: 4, v1: snappyProtocolVersion, snappy: false},
+		{v0: snappyProtocolVersion, v1: 4, snappy: false},
+		{v0: snappyProtocolVersion, v1: snappyProtocolVersion, snappy: true},
+		{v0: snappyProtocolVersion + 1, v1: snappyProtocolVersion, snappy: true},
+	}
+	for _, test := range tests {
+		if err := testProtocolHandshakeSnappy(test.v0, test.v1, test.snappy); err != nil {
+			t.Errorf("versions %d/%d: %v", test.v0, test.v1, err)
+		}
+	}
+}
+
+func testProtocolHandshakeSnappy(v0, v1 uint64, wantSnappy bool) error {
+	var (
+		prv0, _ = crypto.GenerateKey()
+		hs0     = &protoHandshake{Version: v0, ID: crypto.FromECDSAPub(&prv0.PublicKey)[1:]}
+		prv1, _ = crypto.GenerateKey()
+		hs1     = &protoHandshake{Version: v1, ID: crypto.FromECDSAPub(&prv1.PublicKey)[1:]}
+		payload = []interface{}{strings.Repeat("compressible", 1000)}
+	)
+	fd0, fd1, err := pipes.TCPPipe()
+	if err != nil {
+		return err
+	}
+	defer fd0.Close()
+	defer fd1.Close()
+
+	run := func(fd net.Conn, prv *ecdsa.PrivateKey, dial *ecdsa.PublicKey, hs *protoHandshake, code uint64) error {
+		c := newRLPX(fd).(*rlpx)
+		if _, err := c.doEncHandshake(prv, dial); err != nil {
+			return fmt.Errorf("enc handshake failed: %v", err)
+		}
+		if _, err := c.doProtoHandshake(hs); err != nil {
+			return fmt.Errorf("proto handshake failed: %v", err)
+		}
+		if c.rw.snappy != wantSnappy {
+			return fmt.Errorf("snappy = %t, want %t", c.rw.snappy, wantSnappy)
+		}
+		// Both sides send a message and expect to receive the other one.
+		werr := make(chan error, 1)
+		go func() { werr <- Send(c, code, payload) }()
+		if err := ExpectMsg(c, code^1, payload); err != nil {
+			return fmt.Errorf("receive error: %v", err)
+		}
+		return <-werr
+	}
+	errc := make(chan error, 2)
+	go func() { errc <- run(fd0, prv0, &prv1.PublicKey, hs0, 0x10) }()
+	go func() { errc <- run(fd1, prv1, nil, hs1, 0x11) }()
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// This test checks that RLPXConn transfers arbitrary messages, including
+// base protocol messages, without interpreting them.
+func TestRLPXConn(t *testing.T) {
+	var (
+		prv0, _ = crypto.GenerateKey()
+		prv1, _ = crypto.GenerateKey()
+		wg      sync.WaitGroup
+	)
+	fd0, fd1, err := pipes.TCPPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		c := NewRLPXConn(fd0)
+		defer c.Close()
+		if _, err := c.Handshake(prv0, &prv1.PublicKey); err != nil {
+			t.Errorf("dial side handshake failed: %v", err)
+			return
+		}
+		if err := Send(c, handshakeMsg, []byte("not a hello")); err != nil {
+			t.Errorf("dial side write failed: %v", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		c := NewRLPXConn(fd1)
+		defer c.Close()
+		rpubkey, err := c.Handshake(prv1, nil)
+		if err != nil {
+			t.Errorf("listen side handshake failed: %v", err)
+			return
+		}
+		if !reflect.DeepEqual(rpubkey, &prv0.PublicKey) {
+			t.Errorf("listen side remote pubkey mismatch: got %v, want %v", rpubkey, &prv0.PublicKey)
+		}
+		if err := ExpectMsg(c, handshakeMsg, []byte("not a hello")); err != nil {
+			t.Errorf("listen side read failed: %v", err)
+		}
+	}()
+	wg.Wait()
+}
+
 func TestProtocolHandshakeErrors(t *testing.T) {
 	our := &protoHandshake{Version: 3, Caps: []Cap{{"foo", 2}, {"bar", 3}}, Name: "quux"}
 	tests := []struct {
@@ -376,6 +487,78 @@ func TestRLPXFrameRW(t *testing.T) {
 	}
 }
 
+// newTestFrameRWPair creates two frame codecs which read and write each other's
+// frames through conn.
+func newTestFrameRWPair(conn io.ReadWriter) (*rlpxFrameRW, *rlpxFrameRW) {
+	var (
+		aesSecret      = make([]byte, 16)
+		macSecret      = make([]byte, 16)
+		egressMACinit  = make([]byte, 32)
+		ingressMACinit = make([]byte, 32)
+	)
+	for _, s := range [][]byte{aesSecret, macSecret, egressMACinit, ingressMACinit} {
+		rand.Read(s)
+	}
+	s1 := secrets{AES: aesSecret, MAC: macSecret, EgressMAC: sha3.NewKeccak256(), IngressMAC: sha3.NewKeccak256()}
+	s1.EgressMAC.Write(egressMACinit)
+	s1.IngressMAC.Write(ingressMACinit)
+	s2 := secrets{AES: aesSecret, MAC: macSecret, EgressMAC: sha3.NewKeccak256(), IngressMAC: sha3.NewKeccak256()}
+	s2.EgressMAC.Write(ingressMACinit)
+	s2.IngressMAC.Write(egressMACinit)
+	return newRLPXFrameRW(conn, s1), newRLPXFrameRW(conn, s2)
+}
+
+func TestRLPXFrameRWSnappy(t *testing.T) {
+	conn := new(bytes.Buffer)
+	rw1, rw2 := newTestFrameRWPair(conn)
+	rw1.snappy, rw2.snappy = true, true
+
+	// Compressible payloads must shrink on the wire and arrive intact.
+	wmsg := []interface{}{strings.Repeat("test", 1024)}
+	wantPayload, _ := rlp.EncodeToBytes(wmsg)
+	if err := Send(rw1, 8, wmsg); err != nil {
+		t.Fatalf("WriteMsg error: %v", err)
+	}
+	if conn.Len() >= len(wantPayload) {
+		t.Errorf("frame not compressed: %d bytes on the wire for %d byte payload", conn.Len(), len(wantPayload))
+	}
+	msg, err := rw2.ReadMsg()
+	if err != nil {
+		t.Fatalf("ReadMsg error: %v", err)
+	}
+	if msg.Code != 8 {
+		t.Errorf("msg code mismatch: got %d, want 8", msg.Code)
+	}
+	if msg.Size != uint32(len(wantPayload)) {
+		t.Errorf("msg size mismatch: got %d, want %d", msg.Size, len(wantPayload))
+	}
+	payload, _ := ioutil.ReadAll(msg.Payload)
+	if !bytes.Equal(payload, wantPayload) {
+		t.Fatalf("msg payload mismatch:\ngot  %x\nwant %x", payload, wantPayload)
+	}
+
+	// Messages that can't be sent as a plain frame are rejected before compression.
+	err = rw1.WriteMsg(Msg{Code: 8, Size: maxUint24 + 1, Payload: bytes.NewReader(nil)})
+	if err != errPlainMessageTooLarge {
+		t.Errorf("oversized write: got error %v, want %v", err, errPlainMessageTooLarge)
+	}
+	if conn.Len() != 0 {
+		t.Errorf("oversized write produced %d bytes of output", conn.Len())
+	}
+
+	// Frames which claim to decompress to more than the limit must be rejected
+	// without decompressing them.
+	bomb := make([]byte, binary.MaxVarintLen32+16)
+	n := binary.PutUvarint(bomb, uint64(maxUint24)+1)
+	rw1.snappy = false
+	if err := rw1.WriteMsg(Msg{Code: 8, Size: uint32(n + 16), Payload: bytes.NewReader(bomb[:n+16])}); err != nil {
+		t.Fatalf("WriteMsg error: %v", err)
+	}
+	if _, err := rw2.ReadMsg(); err != errPlainMessageTooLarge {
+		t.Errorf("decompression bomb: got error %v, want %v", err, errPlainMessageTooLarge)
+	}
+}
+
 type handshakeAuthTest struct {
 	input       string
 	isPlain     bool
@@ -80,6 +80,21 @@ type Config struct {
 	// Setting DialRatio to zero defaults it to 3.
 	DialRatio int `toml:",omitempty"`
 
+	// MaxInboundPeers limits the number of inbound connections. Zero defaults
+	// it to the slots which aren't reserved for dialing by DialRatio.
+	MaxInboundPeers int `toml:",omitempty"`
+
+	// MaxStaticPeers limits the number of connected static nodes. Zero means
+	// static nodes are only limited by MaxPeers. Static nodes evict dialed and
+	// inbound peers when the server is full.
+	MaxStaticPeers int `toml:",omitempty"`
+
+	// MaxInboundPerSubnet24 and MaxInboundPerSubnet16 limit the number of inbound
+	// peers from a single IPv4 /24 or /16 network. Zero selects the default
+	// limit, negative values disable it. LAN addresses are exempt.
+	MaxInboundPerSubnet24 int `toml:",omitempty"`
+	MaxInboundPerSubnet16 int `toml:",omitempty"`
+
 	// NoDiscovery can be used to disable the peer discovery mechanism.
 	// Disabling is useful for protocol debugging (manual topology).
 	NoDiscovery bool
@@ -88,6 +103,11 @@ type Config struct {
 	// protocol should be started or not.
 	DiscoveryV5 bool `toml:",omitempty"`
 
+	// DiscoveryVersion selects the protocol used to find dial candidates: 4 for
+	// discovery v4, which is the default if unset, or 5 for the discovery v5 wire
+	// protocol. It is unrelated to the topic discovery enabled by DiscoveryV5.
+	DiscoveryVersion int `toml:",omitempty"`
+
 	// Name sets the node name of this server.
 	// Use common.MakeName to create a name that follows existing conventions.
 	Name string `toml:"-"`
@@ -123,6 +143,12 @@ type Config struct {
 	// each peer.
 	Protocols []Protocol `toml:"-"`
 
+	// DialSources are additional sources of dynamic dial candidates. Nodes from
+	// all sources, including the dial candidates of protocols, are mixed fairly
+	// and dialed in addition to the nodes found through discovery. The server
+	// closes the iterators when it shuts down.
+	DialSources []enode.Iterator `toml:"-"`
+
 	// If ListenAddr is set to a non-nil address, the server
 	// will listen for incoming connections.
 	//
@@ -165,12 +191,15 @@ type Server struct {
 	running bool
 
 	nodedb       *enode.DB
+	reputation   *reputation
 	localnode    *enode.LocalNode
 	ntab         discoverTable
+	dialsrc      *enode.FairMix // mix of DialSources and protocol dial candidates
 	listener     net.Listener
 	ourHandshake *protoHandshake
 	lastLookup   time.Time
 	DiscV5       *discv5.Network
+	DiscV5Wire   *discover.UDPv5 // set if DiscoveryVersion is 5
 
 	// These are for Peers, PeerCount (and nothing else).
 	peerOp     chan peerOpFunc
@@ -216,6 +245,8 @@ type conn struct {
 	cont  chan error // The run loop uses cont to signal errors to SetupConn.
 	caps  []Cap      // valid after the protocol handshake
 	name  string     // valid after the protocol handshake
+
+	handshakeRTT time.Duration // duration of the protocol handshake
 }
 
 type transport interface {
@@ -345,6 +376,95 @@ func (srv *Server) RemoveTrustedPeer(node *enode.Node) {
 	}
 }
 
+// BanNode bans the given node for duration d and disconnects it. A zero duration
+// bans the node permanently. Trusted peers are exempt from bans.
+func (srv *Server) BanNode(id enode.ID, d time.Duration) error {
+	rep, err := srv.banList()
+	if err != nil {
+		return err
+	}
+	if err := rep.db.BanNode(id, banExpiry(d)); err != nil {
+		return err
+	}
+	rep.forget(id, nil)
+	srv.disconnectBanned(func(p *Peer) bool { return p.ID() == id })
+	return nil
+}
+
+// BanIP bans all nodes connecting from the given IP address for duration d and
+// disconnects them. A zero duration bans the address permanently. Trusted peers
+// are exempt from bans.
+func (srv *Server) BanIP(ip net.IP, d time.Duration) error {
+	rep, err := srv.banList()
+	if err != nil {
+		return err
+	}
+	if err := rep.db.BanIP(ip, banExpiry(d)); err != nil {
+		return err
+	}
+	rep.forget(enode.ID{}, ip)
+	srv.disconnectBanned(func(p *Peer) bool { return ip.Equal(remoteIP(p.rw.fd)) })
+	return nil
+}
+
+// UnbanNode lifts the ban of a node and resets its reputation.
+func (srv *Server) UnbanNode(id enode.ID) error {
+	rep, err := srv.banList()
+	if err != nil {
+		return err
+	}
+	rep.forget(id, nil)
+	return rep.db.UnbanNode(id)
+}
+
+// UnbanIP lifts the ban of an IP address and resets its reputation.
+func (srv *Server) UnbanIP(ip net.IP) error {
+	rep, err := srv.banList()
+	if err != nil {
+		return err
+	}
+	rep.forget(enode.ID{}, ip)
+	return rep.db.UnbanIP(ip)
+}
+
+// Bans returns all bans which are currently in effect.
+func (srv *Server) Bans() ([]enode.Ban, error) {
+	rep, err := srv.banList()
+	if err != nil {
+		return nil, err
+	}
+	return rep.db.Bans(), nil
+}
+
+// banList returns the reputation tracker if the server is running.
+func (srv *Server) banList() (*reputation, error) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	if !srv.running {
+		return nil, errServerStopped
+	}
+	return srv.reputation, nil
+}
+
+// disconnectBanned disconnects all peers matching the given predicate, except
+// for trusted ones.
+func (srv *Server) disconnectBanned(match func(*Peer) bool) {
+	for _, p := range srv.Peers() {
+		if !p.rw.is(trustedConn) && match(p) {
+			p.Disconnect(DiscUselessPeer)
+		}
+	}
+}
+
+// banExpiry converts a ban duration into its expiry time. Zero durations mean
+// the ban is permanent.
+func banExpiry(d time.Duration) time.Time {
+	if d == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d)
+}
+
 // SubscribePeers subscribes the given channel to peer events
 func (srv *Server) SubscribeEvents(ch chan *PeerEvent) event.Subscription {
 	return srv.peerFeed.Subscribe(ch)
@@ -362,6 +482,13 @@ func (srv *Server) Self() *enode.Node {
 	return ln.Node()
 }
 
+// LocalNode returns the local node record. It is nil until the server is started.
+func (srv *Server) LocalNode() *enode.LocalNode {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	return srv.localnode
+}
+
 // Stop terminates the server and all active peer connections.
 // It blocks until all active connections have been closed.
 func (srv *Server) Stop() {
@@ -456,13 +583,73 @@ func (srv *Server) Start() (err error) {
 		return err
 	}
 
+	sources := srv.setupDialSources()
 	dynPeers := srv.maxDialedConns()
 	dialer := newDialState(srv.localnode.ID(), srv.StaticNodes, srv.BootstrapNodes, srv.ntab, dynPeers, srv.NetRestrict)
+	dialer.filter = srv.dialFilter()
+	dialer.sources = sources
 	srv.loopWG.Add(1)
 	go srv.run(dialer)
 	return nil
 }
 
+// setupDialSources mixes the configured dial sources and the dial candidates of all
+// protocols into a single iterator. It returns nil if there are no such sources.
+func (srv *Server) setupDialSources() enode.Iterator {
+	var (
+		sources []enode.Iterator
+		added   = make(map[enode.Iterator]bool)
+	)
+	addSource := func(it enode.Iterator) {
+		// Protocols with multiple versions usually share one iterator.
+		if it != nil && !added[it] {
+			added[it] = true
+			sources = append(sources, it)
+		}
+	}
+	for _, it := range srv.DialSources {
+		addSource(it)
+	}
+	for _, p := range srv.Protocols {
+		addSource(p.DialCandidates)
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+	srv.dialsrc = enode.NewFairMix(dialSourceTimeout)
+	for _, it := range sources {
+		srv.dialsrc.AddSource(it)
+	}
+	return srv.dialsrc
+}
+
+// dialFilter combines the dial filters of all protocols with the ban list. It
+// returns nil if there is nothing to filter.
+func (srv *Server) dialFilter() func(*enode.Node) bool {
+	var filters []func(*enode.Node) bool
+	if srv.reputation != nil {
+		filters = append(filters, func(n *enode.Node) bool {
+			return !srv.reputation.banned(n.ID(), n.IP())
+		})
+	}
+	for _, p := range srv.Protocols {
+		if p.DialFilter != nil {
+			filters = append(filters, p.DialFilter)
+		}
+	}
+	if len(filters) == 0 {
+		return nil
+	}
+	return func(n *enode.Node) bool {
+		for _, filter := range filters {
+			if !filter(n) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
 func (srv *Server) setupLocalNode() error {
 	// Create the devp2p handshake.
 	pubkey := crypto.FromECDSAPub(&srv.PrivateKey.PublicKey)
@@ -478,6 +665,7 @@ func (srv *Server) setupLocalNode() error {
 		return err
 	}
 	srv.nodedb = db
+	srv.reputation = newReputation(db, mclock.System{}, srv.log)
 	srv.localnode = enode.NewLocalNode(db, srv.PrivateKey)
 	srv.localnode.SetFallbackIP(net.IP{127, 0, 0, 1})
 	srv.localnode.Set(capsByNameAndVersion(srv.ourHandshake.Caps))
@@ -512,6 +700,11 @@ func (srv *Server) setupDiscovery() error {
 	if srv.NoDiscovery && !srv.DiscoveryV5 {
 		return nil
 	}
+	switch srv.DiscoveryVersion {
+	case 0, 4, 5:
+	default:
+		return fmt.Errorf("unsupported discovery version %d", srv.DiscoveryVersion)
+	}
 
 	addr, err := net.ResolveUDPAddr("udp", srv.ListenAddr)
 	if err != nil {
@@ -530,7 +723,7 @@ func (srv *Server) setupDiscovery() error {
 	}
 	srv.localnode.SetFallbackUDP(realaddr.Port)
 
-	// Discovery V4
+	// Discovery V4 or the V5 wire protocol
 	var unhandled chan discover.ReadPacket
 	var sconn *sharedUDPConn
 	if !srv.NoDiscovery {
@@ -544,11 +737,19 @@ func (srv *Server) setupDiscovery() error {
 			Bootnodes:   srv.BootstrapNodes,
 			Unhandled:   unhandled,
 		}
-		ntab, err := discover.ListenUDP(conn, srv.localnode, cfg)
-		if err != nil {
-			return err
+		if srv.DiscoveryVersion == 5 {
+			ntab, err := discover.ListenV5(conn, srv.localnode, cfg)
+			if err != nil {
+				return err
+			}
+			srv.ntab, srv.DiscV5Wire = ntab, ntab
+		} else {
+			ntab, err := discover.ListenUDP(conn, srv.localnode, cfg)
+			if err != nil {
+				return err
+			}
+			srv.ntab = ntab
 		}
-		srv.ntab = ntab
 	}
 	// Discovery V5
 	if srv.DiscoveryV5 {
@@ -609,7 +810,6 @@ func (srv *Server) run(dialstate dialer) {
 
 	var (
 		peers        = make(map[enode.ID]*Peer)
-		inboundCount = 0
 		trusted      = make(map[enode.ID]bool, len(srv.TrustedNodes))
 		taskdone     = make(chan task, maxActiveDialTasks)
 		runningTasks []task
@@ -714,17 +914,25 @@ running:
 			}
 			// TODO: track in-progress inbound node IDs (pre-Peer) to avoid dialing them.
 			select {
-			case c.cont <- srv.encHandshakeChecks(peers, inboundCount, c):
+			case c.cont <- srv.encHandshakeChecks(peers, c):
 			case <-srv.quit:
 				break running
 			}
 		case c := <-srv.addpeer:
 			// At this point the connection is past the protocol handshake.
 			// Its capabilities are known and the remote identity is verified.
-			err := srv.protoHandshakeChecks(peers, inboundCount, c)
+			victim, err := srv.protoHandshakeChecks(peers, c)
 			if err == nil {
+				// Make room for the connection if the server is full.
+				if victim != nil {
+					victim.log.Debug("Evicting peer for higher priority connection", "class", victim.rw.slotClass(), "for", c.slotClass())
+					victim.evicted = true
+					victim.Disconnect(DiscTooManyPeers)
+				}
 				// The handshakes are done and it passed all checks.
 				p := newPeer(c, srv.Protocols)
+				p.reputation = srv.reputation
+				p.disconnectBanned = srv.disconnectBanned
 				// If message events are enabled, pass the peerFeed
 				// to the peer
 				if srv.EnableMsgEvents {
@@ -734,9 +942,6 @@ running:
 				srv.log.Debug("Adding p2p peer", "name", name, "addr", c.fd.RemoteAddr(), "peers", len(peers)+1)
 				go srv.runPeer(p)
 				peers[c.node.ID()] = p
-				if p.Inbound() {
-					inboundCount++
-				}
 			}
 			// The dialer logic relies on the assumption that
 			// dial tasks complete after the peer has been added or
@@ -751,9 +956,6 @@ running:
 			d := common.PrettyDuration(mclock.Now() - pd.created)
 			pd.log.Debug("Removing p2p peer", "duration", d, "peers", len(peers)-1, "req", pd.requested, "err", pd.err)
 			delete(peers, pd.ID())
-			if pd.Inbound() {
-				inboundCount--
-			}
 		}
 	}
 
@@ -763,6 +965,9 @@ running:
 	if srv.ntab != nil {
 		srv.ntab.Close()
 	}
+	if srv.dialsrc != nil {
+		srv.dialsrc.Close()
+	}
 	if srv.DiscV5 != nil {
 		srv.DiscV5.Close()
 	}
@@ -780,36 +985,52 @@ running:
 	}
 }
 
-func (srv *Server) protoHandshakeChecks(peers map[enode.ID]*Peer, inboundCount int, c *conn) error {
+// protoHandshakeChecks decides whether a connection which completed both
+// handshakes can be added as a peer. If a lower priority peer has to make room
+// for it, that peer is returned.
+func (srv *Server) protoHandshakeChecks(peers map[enode.ID]*Peer, c *conn) (*Peer, error) {
 	// Drop connections with no matching protocols.
 	if len(srv.Protocols) > 0 && countMatchingProtocols(srv.Protocols, c.caps) == 0 {
-		return DiscUselessPeer
+		return nil, DiscUselessPeer
 	}
 	// Repeat the encryption handshake checks because the
 	// peer set might have changed between the handshakes.
-	return srv.encHandshakeChecks(peers, inboundCount, c)
+	if err := srv.identityChecks(peers, c); err != nil {
+		return nil, err
+	}
+	return srv.checkSlot(peers, c)
+}
+
+func (srv *Server) encHandshakeChecks(peers map[enode.ID]*Peer, c *conn) error {
+	if _, err := srv.checkSlot(peers, c); err != nil {
+		return err
+	}
+	return srv.identityChecks(peers, c)
 }
 
-func (srv *Server) encHandshakeChecks(peers map[enode.ID]*Peer, inboundCount int, c *conn) error {
+// identityChecks rejects duplicate, self and banned connections.
+func (srv *Server) identityChecks(peers map[enode.ID]*Peer, c *conn) error {
 	switch {
-	case !c.is(trustedConn|staticDialedConn) && len(peers) >= srv.MaxPeers:
-		return DiscTooManyPeers
-	case !c.is(trustedConn) && c.is(inboundConn) && inboundCount >= srv.maxInboundConns():
-		return DiscTooManyPeers
 	case peers[c.node.ID()] != nil:
 		return DiscAlreadyConnected
 	case c.node.ID() == srv.localnode.ID():
 		return DiscSelf
+	case !c.is(trustedConn) && srv.reputation.banned(c.node.ID(), remoteIP(c.fd)):
+		return DiscUselessPeer
 	default:
 		return nil
 	}
 }
 
 func (srv *Server) maxInboundConns() int {
+	if srv.MaxInboundPeers > 0 {
+		return srv.MaxInboundPeers
+	}
 	return srv.MaxPeers - srv.maxDialedConns()
 }
 func (srv *Server) maxDialedConns() int {
-	if srv.NoDiscovery || srv.NoDial {
+	// Without discovery, dynamic dials are only made if there are other sources.
+	if srv.NoDial || (srv.NoDiscovery && srv.dialsrc == nil) {
 		return 0
 	}
 	r := srv.DialRatio
@@ -864,10 +1085,9 @@ func (srv *Server) listenLoop() {
 			}
 		}
 
-		var ip net.IP
-		if tcp, ok := fd.RemoteAddr().(*net.TCPAddr); ok {
-			ip = tcp.IP
-		}
+		// Connections from banned addresses are rejected after the encryption
+		// handshake, once trusted nodes can be told apart.
+		ip := remoteIP(fd)
 		fd = newMeteredConn(fd, true, ip)
 		srv.log.Trace("Accepted connection", "addr", fd.RemoteAddr())
 		go func() {
@@ -930,8 +1150,11 @@ func (srv *Server) setupConn(c *conn, flags connFlag, dialDest *enode.Node) erro
 		clog.Trace("Rejected peer before protocol handshake", "err", err)
 		return err
 	}
-	// Run the protocol handshake
+	// Run the protocol handshake. Both sides send their handshake at once,
+	// so the time it takes is a good approximation of the round trip time.
+	start := time.Now()
 	phs, err := c.doProtoHandshake(srv.ourHandshake)
+	c.handshakeRTT = time.Since(start)
 	if err != nil {
 		clog.Trace("Failed proto handshake", "err", err)
 		return err
@@ -952,6 +1175,14 @@ func (srv *Server) setupConn(c *conn, flags connFlag, dialDest *enode.Node) erro
 	return nil
 }
 
+// remoteIP returns the IP address of the remote end of a TCP connection.
+func remoteIP(conn net.Conn) net.IP {
+	if tcp, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return tcp.IP
+	}
+	return nil
+}
+
 func nodeFromConn(pubkey *ecdsa.PublicKey, conn net.Conn) *enode.Node {
 	var ip net.IP
 	var port int
@@ -1027,6 +1258,7 @@ type NodeInfo struct {
 	} `json:"ports"`
 	ListenAddr string                 `json:"listenAddr"`
 	Protocols  map[string]interface{} `json:"protocols"`
+	Slots      map[string]SlotInfo    `json:"slots"` // Peer slot occupancy by class
 }
 
 // NodeInfo gathers and returns a collection of metadata known about the host.
@@ -1047,6 +1279,13 @@ func (srv *Server) NodeInfo() *NodeInfo {
 		info.ENR = "0x" + hex.EncodeToString(enc)
 	}
 
+	srv.lock.Lock()
+	running := srv.running
+	srv.lock.Unlock()
+	if running {
+		info.Slots = srv.slotsInfo(srv.Peers())
+	}
+
 	// Gather all the running protocol infos (only once per protocol type)
 	for _, proto := range srv.Protocols {
 		if _, ok := info.Protocols[proto.Name]; !ok {
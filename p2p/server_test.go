@@ -121,6 +121,83 @@ func TestServerListen(t *testing.T) {
 	}
 }
 
+func TestServerDiscoveryVersion(t *testing.T) {
+	for _, version := range []int{4, 5} {
+		srv := &Server{Config: Config{
+			MaxPeers:         10,
+			ListenAddr:       "127.0.0.1:0",
+			PrivateKey:       newkey(),
+			DiscoveryVersion: version,
+		}}
+		if err := srv.Start(); err != nil {
+			t.Fatalf("version %d: could not start server: %v", version, err)
+		}
+		if (srv.DiscV5Wire != nil) != (version == 5) {
+			t.Errorf("version %d: wrong discovery v5 wire listener %v", version, srv.DiscV5Wire)
+		}
+		srv.Stop()
+	}
+
+	srv := &Server{Config: Config{
+		MaxPeers:         10,
+		ListenAddr:       "127.0.0.1:0",
+		PrivateKey:       newkey(),
+		DiscoveryVersion: 6,
+	}}
+	if err := srv.Start(); err == nil {
+		srv.Stop()
+		t.Fatal("server started with unsupported discovery version")
+	}
+}
+
+// This test checks that nodes from the dial sources and protocol dial candidates
+// are dialed, and that the server closes the sources on shutdown.
+func TestServerDialSources(t *testing.T) {
+	var (
+		n1     = enode.NewV4(&newkey().PublicKey, net.ParseIP("127.0.0.1"), 30303, 0)
+		n2     = enode.NewV4(&newkey().PublicKey, net.ParseIP("127.0.0.2"), 30303, 0)
+		dialed = make(chan enode.ID, 10)
+		src    = enode.CycleNodes([]*enode.Node{n1})
+	)
+	srv := &Server{Config: Config{
+		MaxPeers:    10,
+		PrivateKey:  newkey(),
+		NoDiscovery: true,
+		DialSources: []enode.Iterator{src},
+		Protocols: []Protocol{{
+			Name:           "test",
+			DialCandidates: enode.CycleNodes([]*enode.Node{n2}),
+		}},
+		Dialer: dialerFunc(func(n *enode.Node) (net.Conn, error) {
+			dialed <- n.ID()
+			return nil, errors.New("dial refused")
+		}),
+	}}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start server: %v", err)
+	}
+	want := map[enode.ID]bool{n1.ID(): true, n2.ID(): true}
+	timeout := time.After(5 * time.Second)
+	for len(want) > 0 {
+		select {
+		case id := <-dialed:
+			delete(want, id)
+		case <-timeout:
+			t.Fatalf("nodes not dialed: %v", want)
+		}
+	}
+	srv.Stop()
+	if src.Next() {
+		t.Error("dial source not closed on shutdown")
+	}
+}
+
+type dialerFunc func(*enode.Node) (net.Conn, error)
+
+func (f dialerFunc) Dial(n *enode.Node) (net.Conn, error) {
+	return f(n)
+}
+
 func TestServerDial(t *testing.T) {
 	// run a one-shot TCP server to handle the connection.
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
@@ -414,6 +491,145 @@ func TestServerAtCap(t *testing.T) {
 	}
 }
 
+func TestServerBans(t *testing.T) {
+	remoteKey := newkey()
+	srv := &Server{
+		Config: Config{
+			PrivateKey: newkey(),
+			MaxPeers:   10,
+			NoDial:     true,
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	newconn := func(id enode.ID) *conn {
+		fd, _ := net.Pipe()
+		tx := newTestTransport(&remoteKey.PublicKey, fd)
+		node := enode.SignNull(new(enr.Record), id)
+		return &conn{fd: fd, transport: tx, flags: inboundConn, node: node, cont: make(chan error)}
+	}
+
+	// Banned nodes are rejected after the encryption handshake.
+	banned := randomID()
+	if err := srv.BanNode(banned, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.checkpoint(newconn(banned), srv.posthandshake); err != DiscUselessPeer {
+		t.Errorf("wrong error for banned node: %v", err)
+	}
+	if bans, _ := srv.Bans(); len(bans) != 1 || bans[0].ID != banned {
+		t.Errorf("wrong ban list: %v", bans)
+	}
+	if err := srv.UnbanNode(banned); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.checkpoint(newconn(banned), srv.posthandshake); err != nil {
+		t.Errorf("unexpected error for unbanned node: %v", err)
+	}
+
+	// Peers which misbehave get banned and disconnected.
+	id := randomID()
+	if err := srv.checkpoint(newconn(id), srv.addpeer); err != nil {
+		t.Fatalf("could not add conn: %v", err)
+	}
+	peers := srv.Peers()
+	if len(peers) != 1 {
+		t.Fatalf("wrong peer count %d", len(peers))
+	}
+	peers[0].Report(RepInvalidBlock)
+	peers[0].Report(RepInvalidBlock)
+	if _, ok := srv.nodedb.NodeBan(id); !ok {
+		t.Error("misbehaving peer not banned")
+	}
+	select {
+	case <-peers[0].closed:
+	case <-time.After(time.Second):
+		t.Error("banned peer not disconnected")
+	}
+}
+
+func TestServerIPBanDisconnects(t *testing.T) {
+	remoteKey := newkey()
+	srv := &Server{
+		Config: Config{
+			PrivateKey:            newkey(),
+			MaxPeers:              10,
+			MaxInboundPerSubnet24: -1,
+			MaxInboundPerSubnet16: -1,
+			NoDial:                true,
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	// Connect a few peers from the same public address, the last one trusted.
+	ip := net.ParseIP("1.2.3.4")
+	newconn := func(flags connFlag) *conn {
+		fd, _ := net.Pipe()
+		tx := newTestTransport(&remoteKey.PublicKey, fd)
+		node := enode.SignNull(new(enr.Record), randomID())
+		return &conn{fd: addrConn{fd, &net.TCPAddr{IP: ip, Port: 30303}}, transport: tx, flags: flags, node: node, cont: make(chan error)}
+	}
+	var (
+		peers   = make([]*Peer, 0, 4)
+		trusted *Peer
+	)
+	for i := 0; i < 5; i++ {
+		flags := inboundConn
+		if i == 4 {
+			flags |= trustedConn
+		}
+		if err := srv.checkpoint(newconn(flags), srv.addpeer); err != nil {
+			t.Fatalf("could not add conn %d: %v", i, err)
+		}
+	}
+	for _, p := range srv.Peers() {
+		if p.rw.is(trustedConn) {
+			trusted = p
+		} else {
+			peers = append(peers, p)
+		}
+	}
+	// Misbehaviour of the first ones bans them and eventually the address, which
+	// must drop the remaining well behaved peer too.
+	for _, p := range peers[:3] {
+		p.Report(RepInvalidBlock)
+		p.Report(RepInvalidBlock)
+	}
+
+	if _, ok := srv.nodedb.IPBan(ip); !ok {
+		t.Fatal("misbehaving address not banned")
+	}
+	for i, p := range peers {
+		select {
+		case <-p.closed:
+		case <-time.After(time.Second):
+			t.Errorf("peer %d from banned address not disconnected", i)
+		}
+	}
+	// Trusted peers must be exempt from bans, both when connected and when
+	// connecting from the banned address.
+	if err := srv.BanNode(trusted.ID(), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-trusted.closed:
+		t.Errorf("trusted peer disconnected")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := srv.checkpoint(newconn(inboundConn), srv.posthandshake); err != DiscUselessPeer {
+		t.Errorf("wrong error for conn from banned address: %v", err)
+	}
+	if err := srv.checkpoint(newconn(inboundConn|trustedConn), srv.posthandshake); err != nil {
+		t.Errorf("trusted conn from banned address rejected: %v", err)
+	}
+}
+
 func TestServerPeerLimits(t *testing.T) {
 	srvkey := newkey()
 	clientkey := newkey()
@@ -478,6 +694,154 @@ func TestServerPeerLimits(t *testing.T) {
 	conn.Close()
 }
 
+func TestServerSlotEviction(t *testing.T) {
+	remoteKey := newkey()
+	srv := &Server{
+		Config: Config{
+			PrivateKey: newkey(),
+			MaxPeers:   4,
+			NoDial:     true,
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	newconn := func(flags connFlag) *conn {
+		fd, _ := net.Pipe()
+		tx := newTestTransport(&remoteKey.PublicKey, fd)
+		node := enode.SignNull(new(enr.Record), randomID())
+		return &conn{fd: fd, transport: tx, flags: flags, node: node, cont: make(chan error)}
+	}
+	waitSlots := func(want map[slotClass]int) {
+		t.Helper()
+		var info map[string]SlotInfo
+		for start := time.Now(); time.Since(start) < 2*time.Second; time.Sleep(10 * time.Millisecond) {
+			info = srv.NodeInfo().Slots
+			ok := true
+			for class, n := range want {
+				if info[class.String()].Used != n {
+					ok = false
+				}
+			}
+			if ok {
+				return
+			}
+		}
+		t.Fatalf("slot occupancy mismatch: got %v, want %v", info, want)
+	}
+
+	// Fill up the peer set with inbound connections.
+	for i := 0; i < 4; i++ {
+		if err := srv.checkpoint(newconn(inboundConn), srv.addpeer); err != nil {
+			t.Fatalf("could not add inbound conn %d: %v", i, err)
+		}
+	}
+	if err := srv.checkpoint(newconn(inboundConn), srv.posthandshake); err != DiscTooManyPeers {
+		t.Fatal("wrong error for inbound conn at cap:", err)
+	}
+	// Static and dialed connections push out inbound peers.
+	if err := srv.checkpoint(newconn(staticDialedConn), srv.addpeer); err != nil {
+		t.Fatal("could not add static conn:", err)
+	}
+	waitSlots(map[slotClass]int{inboundSlot: 3, staticSlot: 1})
+	if err := srv.checkpoint(newconn(dynDialedConn), srv.addpeer); err != nil {
+		t.Fatal("could not add dialed conn:", err)
+	}
+	waitSlots(map[slotClass]int{inboundSlot: 2, dialedSlot: 1, staticSlot: 1})
+
+	// Dialed peers can't evict each other, but static peers evict them
+	// once no inbound peers are left.
+	if err := srv.checkpoint(newconn(staticDialedConn), srv.addpeer); err != nil {
+		t.Fatal("could not add static conn:", err)
+	}
+	if err := srv.checkpoint(newconn(staticDialedConn), srv.addpeer); err != nil {
+		t.Fatal("could not add static conn:", err)
+	}
+	waitSlots(map[slotClass]int{inboundSlot: 0, dialedSlot: 1, staticSlot: 3})
+	if err := srv.checkpoint(newconn(dynDialedConn), srv.posthandshake); err != DiscTooManyPeers {
+		t.Fatal("wrong error for dialed conn at cap:", err)
+	}
+	if err := srv.checkpoint(newconn(staticDialedConn), srv.addpeer); err != nil {
+		t.Fatal("could not add static conn:", err)
+	}
+	waitSlots(map[slotClass]int{dialedSlot: 0, staticSlot: 4})
+
+	// With nothing left to evict, static peers exceed the limit.
+	if err := srv.checkpoint(newconn(staticDialedConn), srv.addpeer); err != nil {
+		t.Fatal("could not add static conn:", err)
+	}
+	waitSlots(map[slotClass]int{staticSlot: 5})
+}
+
+func TestServerStaticLimit(t *testing.T) {
+	srv := &Server{Config: Config{MaxPeers: 10, MaxStaticPeers: 1, NoDial: true}}
+	peers := make(map[enode.ID]*Peer)
+	static := &conn{flags: staticDialedConn}
+	if _, err := srv.checkSlot(peers, static); err != nil {
+		t.Fatal("unexpected error for first static conn:", err)
+	}
+	peers[randomID()] = &Peer{rw: static}
+	if _, err := srv.checkSlot(peers, &conn{flags: staticDialedConn}); err != DiscTooManyPeers {
+		t.Fatal("wrong error for static conn over limit:", err)
+	}
+	if _, err := srv.checkSlot(peers, &conn{flags: trustedConn | staticDialedConn}); err != nil {
+		t.Fatal("unexpected error for trusted conn:", err)
+	}
+}
+
+// addrConn is a net.Conn with a fake remote address.
+type addrConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c addrConn) RemoteAddr() net.Addr { return c.addr }
+
+func TestServerInboundSubnets(t *testing.T) {
+	srv := &Server{Config: Config{MaxPeers: 50, MaxInboundPerSubnet24: 2, MaxInboundPerSubnet16: 3}}
+	peers := make(map[enode.ID]*Peer)
+	inbound := func(ip string) *conn {
+		fd := addrConn{addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 30303}}
+		return &conn{fd: fd, flags: inboundConn}
+	}
+	add := func(ip string) error {
+		c := inbound(ip)
+		if _, err := srv.checkSlot(peers, c); err != nil {
+			return err
+		}
+		peers[randomID()] = &Peer{rw: c}
+		return nil
+	}
+
+	tests := []struct {
+		ip      string
+		wantErr error
+	}{
+		{"1.2.3.4", nil},
+		{"1.2.3.5", nil},
+		{"1.2.3.6", DiscTooManyPeers}, // /24 limit
+		{"1.2.4.1", nil},
+		{"1.2.5.1", DiscTooManyPeers}, // /16 limit
+		{"1.3.0.1", nil},
+		{"192.168.0.1", nil}, // LAN addresses are exempt
+		{"192.168.0.2", nil},
+		{"192.168.0.3", nil},
+	}
+	for _, test := range tests {
+		if err := add(test.ip); err != test.wantErr {
+			t.Errorf("%s: got error %v, want %v", test.ip, err, test.wantErr)
+		}
+	}
+
+	// Disabling the limits admits more peers from the same network.
+	srv.MaxInboundPerSubnet24, srv.MaxInboundPerSubnet16 = -1, -1
+	if err := add("1.2.3.6"); err != nil {
+		t.Error("unexpected error with limits disabled:", err)
+	}
+}
+
 func TestServerSetupConn(t *testing.T) {
 	var (
 		clientkey, srvkey = newkey(), newkey()
@@ -0,0 +1,235 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"net"
+
+	"github.com/ETSC3259/etsc/p2p/enode"
+	"github.com/ETSC3259/etsc/p2p/netutil"
+)
+
+const (
+	defaultInboundPerSubnet24 = 3 // Default limit of inbound peers from a single /24 network
+	defaultInboundPerSubnet16 = 8 // Default limit of inbound peers from a single /16 network
+)
+
+// slotClass is the class of peer slot occupied by a connection. Classes are
+// ordered by priority, peers of a higher class may evict lower class peers when
+// the server is full.
+type slotClass int
+
+const (
+	inboundSlot slotClass = iota
+	dialedSlot
+	staticSlot
+	trustedSlot
+	numSlotClasses
+)
+
+var slotClassNames = [numSlotClasses]string{
+	inboundSlot: "inbound",
+	dialedSlot:  "dialed",
+	staticSlot:  "static",
+	trustedSlot: "trusted",
+}
+
+func (c slotClass) String() string {
+	return slotClassNames[c]
+}
+
+// slotClass returns the slot class of the connection.
+func (c *conn) slotClass() slotClass {
+	switch {
+	case c.is(trustedConn):
+		return trustedSlot
+	case c.is(staticDialedConn):
+		return staticSlot
+	case c.is(inboundConn):
+		return inboundSlot
+	default:
+		return dialedSlot
+	}
+}
+
+// SlotInfo reports the occupancy of a peer slot class.
+type SlotInfo struct {
+	Used  int `json:"used"`
+	Limit int `json:"limit"` // -1 if the class isn't limited
+}
+
+// slotCounts holds the number of occupied slots per class.
+type slotCounts [numSlotClasses]int
+
+func (sc slotCounts) total() int {
+	n := 0
+	for _, c := range sc {
+		n += c
+	}
+	return n
+}
+
+// countSlots counts the slots used by the given peers. Peers which are being
+// evicted don't occupy a slot anymore.
+func countSlots(peers map[enode.ID]*Peer) (sc slotCounts) {
+	for _, p := range peers {
+		if !p.evicted {
+			sc[p.rw.slotClass()]++
+		}
+	}
+	return sc
+}
+
+// slotLimit returns the maximum number of peers in the given class, or -1 if
+// the class is only limited by MaxPeers.
+func (srv *Server) slotLimit(class slotClass) int {
+	switch class {
+	case inboundSlot:
+		return srv.maxInboundConns()
+	case dialedSlot:
+		// Without dialing, dynamic connections can only be made through
+		// the API and aren't limited separately.
+		if n := srv.maxDialedConns(); n > 0 {
+			return n
+		}
+	case staticSlot:
+		if srv.MaxStaticPeers > 0 {
+			return srv.MaxStaticPeers
+		}
+	}
+	return -1
+}
+
+// subnetLimit returns the configured limit of inbound peers per network, or -1
+// if the limit is disabled.
+func subnetLimit(configured, def int) int {
+	switch {
+	case configured < 0:
+		return -1
+	case configured == 0:
+		return def
+	default:
+		return configured
+	}
+}
+
+// checkSlot decides whether the connection may occupy a peer slot. If the server
+// is full but the connection has priority over an existing peer, that peer is
+// returned for eviction.
+//
+// Trusted peers are never limited. Static peers may exceed MaxPeers if there
+// is no lower class peer to evict.
+func (srv *Server) checkSlot(peers map[enode.ID]*Peer, c *conn) (evict *Peer, err error) {
+	class := c.slotClass()
+	if class == trustedSlot {
+		return nil, nil
+	}
+	used := countSlots(peers)
+	if limit := srv.slotLimit(class); limit >= 0 && used[class] >= limit {
+		return nil, DiscTooManyPeers
+	}
+	if class == inboundSlot && !srv.checkInboundSubnets(peers, remoteIP(c.fd)) {
+		return nil, DiscTooManyPeers
+	}
+	if used.total() < srv.MaxPeers {
+		return nil, nil
+	}
+	if victim := evictionCandidate(peers, class); victim != nil {
+		return victim, nil
+	}
+	if class == staticSlot {
+		return nil, nil
+	}
+	return nil, DiscTooManyPeers
+}
+
+// checkInboundSubnets reports whether another inbound peer from the network of
+// the given IPv4 address is acceptable.
+func (srv *Server) checkInboundSubnets(peers map[enode.ID]*Peer, ip net.IP) bool {
+	if ip.To4() == nil || netutil.IsLAN(ip) {
+		return true
+	}
+	limits := []struct {
+		bits  uint
+		limit int
+	}{
+		{24, subnetLimit(srv.MaxInboundPerSubnet24, defaultInboundPerSubnet24)},
+		{16, subnetLimit(srv.MaxInboundPerSubnet16, defaultInboundPerSubnet16)},
+	}
+	for _, l := range limits {
+		if l.limit < 0 {
+			continue
+		}
+		n := 0
+		for _, p := range peers {
+			if !p.evicted && p.rw.slotClass() == inboundSlot && netutil.SameNet(l.bits, ip, remoteIP(p.rw.fd)) {
+				n++
+			}
+		}
+		if n >= l.limit {
+			return false
+		}
+	}
+	return true
+}
+
+// evictionCandidate selects a peer of a lower class than the given one which
+// can be dropped to make room. Peers of the lowest class are preferred, within
+// a class the peer with the worst reputation loses, and among equals the most
+// recently connected one.
+func evictionCandidate(peers map[enode.ID]*Peer, class slotClass) *Peer {
+	var victim *Peer
+	var victimScore float64
+	for _, p := range peers {
+		pc := p.rw.slotClass()
+		if p.evicted || pc >= class || pc >= staticSlot {
+			continue
+		}
+		score := p.reputation.score(p.ID())
+		if victim == nil {
+			victim, victimScore = p, score
+			continue
+		}
+		vc := victim.rw.slotClass()
+		switch {
+		case pc != vc:
+			if pc < vc {
+				victim, victimScore = p, score
+			}
+		case score != victimScore:
+			if score < victimScore {
+				victim, victimScore = p, score
+			}
+		case p.created > victim.created:
+			victim, victimScore = p, score
+		}
+	}
+	return victim
+}
+
+// slotsInfo reports the slot occupancy of the given peers.
+func (srv *Server) slotsInfo(peers []*Peer) map[string]SlotInfo {
+	var used slotCounts
+	for _, p := range peers {
+		used[p.rw.slotClass()]++
+	}
+	info := make(map[string]SlotInfo, numSlotClasses)
+	for class := slotClass(0); class < numSlotClasses; class++ {
+		info[class.String()] = SlotInfo{Used: used[class], Limit: srv.slotLimit(class)}
+	}
+	return info
+}
@@ -0,0 +1,141 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of the go-etsc library.
+//
+// The go-etsc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-etsc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-etsc library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ETSC3259/etsc/metrics"
+)
+
+const (
+	MetricsInboundMessages  = "p2p/InboundMessages"  // Prefix of the per message code inbound meters
+	MetricsOutboundMessages = "p2p/OutboundMessages" // Prefix of the per message code outbound meters
+)
+
+// MsgTraffic counts the messages of a single message code and their total
+// (uncompressed) payload size.
+type MsgTraffic struct {
+	Messages uint64 `json:"messages"`
+	Bytes    uint64 `json:"bytes"`
+}
+
+// ProtocolTraffic contains the traffic of a single sub-protocol in both
+// directions, broken down by message code. Codes are relative to the protocol,
+// i.e. they match the constants defined by the protocol implementation.
+type ProtocolTraffic struct {
+	Version uint                  `json:"version"`
+	Ingress map[uint64]MsgTraffic `json:"ingress"`
+	Egress  map[uint64]MsgTraffic `json:"egress"`
+}
+
+// PeerTrafficInfo is the traffic summary of a connected peer, reported in
+// PeerInfo.
+type PeerTrafficInfo struct {
+	HandshakeRTT time.Duration               `json:"handshakeRTT"` // Duration of the protocol handshake
+	Connected    time.Duration               `json:"connected"`    // Time since the peer was added
+	Protocols    map[string]*ProtocolTraffic `json:"protocols"`    // Sub-protocol message counters
+}
+
+// peerTraffic tracks the sub-protocol messages exchanged with a single peer.
+// The counters live as long as the peer, they are dropped on disconnect.
+type peerTraffic struct {
+	mu     sync.Mutex
+	protos map[string]*ProtocolTraffic
+}
+
+func newPeerTraffic() *peerTraffic {
+	return &peerTraffic{protos: make(map[string]*ProtocolTraffic)}
+}
+
+// add accounts for a message of the given protocol. It is a no-op for nil
+// receivers so protocol read/writers created in tests don't need a tracker.
+func (t *peerTraffic) add(ingress bool, proto Protocol, code uint64, size uint32) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	pt := t.protos[proto.Name]
+	if pt == nil {
+		pt = &ProtocolTraffic{
+			Version: proto.Version,
+			Ingress: make(map[uint64]MsgTraffic),
+			Egress:  make(map[uint64]MsgTraffic),
+		}
+		t.protos[proto.Name] = pt
+	}
+	counters := pt.Egress
+	if ingress {
+		counters = pt.Ingress
+	}
+	mt := counters[code]
+	mt.Messages++
+	mt.Bytes += uint64(size)
+	counters[code] = mt
+	t.mu.Unlock()
+
+	markMsgMeters(ingress, proto, code, size)
+}
+
+// snapshot returns a deep copy of the current counters.
+func (t *peerTraffic) snapshot() map[string]*ProtocolTraffic {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	protos := make(map[string]*ProtocolTraffic, len(t.protos))
+	for name, pt := range t.protos {
+		cpy := &ProtocolTraffic{
+			Version: pt.Version,
+			Ingress: make(map[uint64]MsgTraffic, len(pt.Ingress)),
+			Egress:  make(map[uint64]MsgTraffic, len(pt.Egress)),
+		}
+		for code, mt := range pt.Ingress {
+			cpy.Ingress[code] = mt
+		}
+		for code, mt := range pt.Egress {
+			cpy.Egress[code] = mt
+		}
+		protos[name] = cpy
+	}
+	return protos
+}
+
+// reset clears all counters.
+func (t *peerTraffic) reset() {
+	t.mu.Lock()
+	t.protos = make(map[string]*ProtocolTraffic)
+	t.mu.Unlock()
+}
+
+// markMsgMeters bumps the meters of a message code, aggregated over all peers.
+// The meters are labelled by protocol name, version and message code, e.g.
+// "p2p/InboundMessages/etsc/63/0x03" counts the bytes and the "/packets"
+// meter below it the number of messages.
+func markMsgMeters(ingress bool, proto Protocol, code uint64, size uint32) {
+	if !metrics.Enabled {
+		return
+	}
+	prefix := MetricsOutboundMessages
+	if ingress {
+		prefix = MetricsInboundMessages
+	}
+	name := fmt.Sprintf("%s/%s/%d/%#02x", prefix, proto.Name, proto.Version, code)
+	metrics.GetOrRegisterMeter(name, nil).Mark(int64(size))
+	metrics.GetOrRegisterMeter(name+"/packets", nil).Mark(1)
+}
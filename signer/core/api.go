@@ -30,12 +30,16 @@ import (
 	"github.com/ETSC3259/etsc/accounts/usbwallet"
 	"github.com/ETSC3259/etsc/common"
 	"github.com/ETSC3259/etsc/common/hexutil"
+	"github.com/ETSC3259/etsc/core/types"
 	"github.com/ETSC3259/etsc/crypto"
 	"github.com/ETSC3259/etsc/internal/etscapi"
 	"github.com/ETSC3259/etsc/log"
 	"github.com/ETSC3259/etsc/rlp"
 )
 
+// ExternalAPIVersion -- see extapi_changelog.md
+const ExternalAPIVersion = "4.2.0"
+
 // numberOfAccountsToDerive For hardware wallets, the number of accounts to derive
 const numberOfAccountsToDerive = 10
 
@@ -49,12 +53,18 @@ type ExternalAPI interface {
 	SignTransaction(ctx context.Context, args SendTxArgs, methodSelector *string) (*etscapi.SignTransactionResult, error)
 	// Sign - request to sign the given data (plus prefix)
 	Sign(ctx context.Context, addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error)
+	// SignTypedData - request to sign the given EIP-712 typed structured data
+	SignTypedData(ctx context.Context, addr common.MixedcaseAddress, typedData TypedData) (hexutil.Bytes, error)
+	// SignData - request to sign the given data of a specific content type
+	SignData(ctx context.Context, contentType string, addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error)
 	// Export - request to export an account
 	Export(ctx context.Context, addr common.Address) (json.RawMessage, error)
 	// Import - request to import an account
 	// Should be moved to Internal API, in next phase when we have
 	// bi-directional communication
 	//Import(ctx context.Context, keyJSON json.RawMessage) (Account, error)
+	// Version - request the version of the external API
+	Version(ctx context.Context) (string, error)
 }
 
 // SignerUI specifies what method a UI needs to implement to be able to be used as a UI for the signer
@@ -170,11 +180,13 @@ type (
 		NewPassword string `json:"new_password"`
 	}
 	SignDataRequest struct {
-		Address common.MixedcaseAddress `json:"address"`
-		Rawdata hexutil.Bytes           `json:"raw_data"`
-		Message string                  `json:"message"`
-		Hash    hexutil.Bytes           `json:"hash"`
-		Meta    Metadata                `json:"meta"`
+		ContentType string                  `json:"content_type"`
+		Address     common.MixedcaseAddress `json:"address"`
+		Rawdata     hexutil.Bytes           `json:"raw_data"`
+		Message     string                  `json:"message"`
+		Messages    []*NameValueType        `json:"messages,omitempty"`
+		Hash        hexutil.Bytes           `json:"hash"`
+		Meta        Metadata                `json:"meta"`
 	}
 	SignDataResponse struct {
 		Approved bool `json:"approved"`
@@ -521,11 +533,99 @@ func (api *SignerAPI) SignTransaction(ctx context.Context, args SendTxArgs, meth
 // https://github.com/ETSC3259/etsc/wiki/Management-APIs#personal_sign
 func (api *SignerAPI) Sign(ctx context.Context, addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error) {
 	sighash, msg := SignHash(data)
+	req := &SignDataRequest{ContentType: accounts.MimetypeTextPlain, Address: addr, Rawdata: data, Message: msg, Hash: sighash, Meta: MetadataFromContext(ctx)}
+	return api.signData(req)
+}
+
+// SignData signs the hash of the provided data, interpreted according to its
+// content type. Plain text is signed exactly like Sign does, whereas clique
+// headers (RLP encoded, excluding the seal) are decoded for the UI and their
+// seal hash is signed, allowing a node to have its blocks sealed remotely.
+//
+// Note, the produced signature has a V value of 27 or 28 for legacy reasons.
+func (api *SignerAPI) SignData(ctx context.Context, contentType string, addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error) {
+	switch contentType {
+	case accounts.MimetypeTextPlain:
+		return api.Sign(ctx, addr, data)
+
+	case accounts.MimetypeClique:
+		header := new(types.Header)
+		if err := rlp.DecodeBytes(data, header); err != nil {
+			return nil, fmt.Errorf("invalid clique header: %v", err)
+		}
+		sighash := crypto.Keccak256(data)
+		req := &SignDataRequest{
+			ContentType: accounts.MimetypeClique,
+			Address:     addr,
+			Rawdata:     data,
+			Message:     fmt.Sprintf("clique header %d [0x%x]", header.Number, sighash),
+			Hash:        sighash,
+			Meta:        MetadataFromContext(ctx),
+		}
+		return api.signData(req)
+
+	default:
+		return nil, fmt.Errorf("unsupported content type: %q", contentType)
+	}
+}
+
+// signData asks the UI to approve the given data signing request, and signs its
+// hash with the requested account if approved.
+func (api *SignerAPI) signData(req *SignDataRequest) (hexutil.Bytes, error) {
 	// We make the request prior to looking up if we actually have the account, to prevent
 	// account-enumeration via the API
-	req := &SignDataRequest{Address: addr, Rawdata: data, Message: msg, Hash: sighash, Meta: MetadataFromContext(ctx)}
 	res, err := api.UI.ApproveSignData(req)
+	if err != nil {
+		return nil, err
+	}
+	if !res.Approved {
+		return nil, ErrRequestDenied
+	}
+	// Look up the wallet containing the requested signer
+	account := accounts.Account{Address: req.Address.Address()}
+	wallet, err := api.am.Find(account)
+	if err != nil {
+		return nil, err
+	}
+	// Assemble sign the data with the wallet
+	signature, err := wallet.SignHashWithPassphrase(account, res.Password, req.Hash)
+	if err != nil {
+		api.UI.ShowError(err.Error())
+		return nil, err
+	}
+	signature[64] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
+	return signature, nil
+}
 
+// SignTypedData signs EIP-712 typed structured data. The request is validated and
+// hashed, and the decoded domain and message fields are shown to the UI for
+// approval before the wallet is asked to sign.
+func (api *SignerAPI) SignTypedData(ctx context.Context, addr common.MixedcaseAddress, typedData TypedData) (hexutil.Bytes, error) {
+	if err := typedData.Validate(); err != nil {
+		return nil, err
+	}
+	domainSeparator, messageHash, err := typedData.Hashes()
+	if err != nil {
+		return nil, err
+	}
+	messages, err := typedData.Format()
+	if err != nil {
+		return nil, err
+	}
+	rawData := append([]byte{0x19, 0x01}, domainSeparator...)
+	rawData = append(rawData, messageHash...)
+
+	// We make the request prior to looking up if we actually have the account, to prevent
+	// account-enumeration via the API
+	req := &SignDataRequest{
+		ContentType: DataTyped,
+		Address:     addr,
+		Rawdata:     rawData,
+		Messages:    messages,
+		Hash:        accounts.TypedDataHash(domainSeparator, messageHash),
+		Meta:        MetadataFromContext(ctx),
+	}
+	res, err := api.UI.ApproveSignData(req)
 	if err != nil {
 		return nil, err
 	}
@@ -538,8 +638,8 @@ func (api *SignerAPI) Sign(ctx context.Context, addr common.MixedcaseAddress, da
 	if err != nil {
 		return nil, err
 	}
-	// Assemble sign the data with the wallet
-	signature, err := wallet.SignHashWithPassphrase(account, res.Password, sighash)
+	// Assemble sign the typed data with the wallet
+	signature, err := wallet.SignTypedDataWithPassphrase(account, res.Password, domainSeparator, messageHash)
 	if err != nil {
 		api.UI.ShowError(err.Error())
 		return nil, err
@@ -560,6 +660,11 @@ func SignHash(data []byte) ([]byte, string) {
 	return crypto.Keccak256([]byte(msg)), msg
 }
 
+// Version returns the version of the external API served by the signer.
+func (api *SignerAPI) Version(ctx context.Context) (string, error) {
+	return ExternalAPIVersion, nil
+}
+
 // Export returns encrypted private key associated with the given address in web3 keystore format.
 func (api *SignerAPI) Export(ctx context.Context, addr common.Address) (json.RawMessage, error) {
 	res, err := api.UI.ApproveExport(&ExportRequest{Address: addr, Meta: MetadataFromContext(ctx)})
@@ -578,6 +683,10 @@ func (api *SignerAPI) Export(ctx context.Context, addr common.Address) (json.Raw
 	if wallet.URL().Scheme != keystore.KeyStoreScheme {
 		return nil, fmt.Errorf("Account is not a keystore-account")
 	}
+	// Seed wallets hold many accounts in a single file, refuse to leak the others
+	if accs := wallet.Accounts(); len(accs) != 1 || accs[0].URL != wallet.URL() {
+		return nil, fmt.Errorf("Account is derived from a seed wallet")
+	}
 	return ioutil.ReadFile(wallet.URL().Path)
 }
 
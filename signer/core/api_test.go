@@ -28,11 +28,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ETSC3259/etsc/accounts"
 	"github.com/ETSC3259/etsc/accounts/keystore"
 	"github.com/ETSC3259/etsc/cmd/utils"
 	"github.com/ETSC3259/etsc/common"
 	"github.com/ETSC3259/etsc/common/hexutil"
 	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/crypto"
 	"github.com/ETSC3259/etsc/internal/etscapi"
 	"github.com/ETSC3259/etsc/rlp"
 )
@@ -284,6 +286,57 @@ func TestSignData(t *testing.T) {
 		t.Errorf("Expected 65 byte signature (got %d bytes)", len(h))
 	}
 }
+
+func TestSignDataClique(t *testing.T) {
+	api, control := setup(t)
+	createAccount(control, api, t)
+	control <- "A"
+	list, err := api.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := common.NewMixedcaseAddress(list[0])
+
+	header := &types.Header{
+		Difficulty: big.NewInt(2),
+		Number:     big.NewInt(1),
+		GasLimit:   4700000,
+		Time:       big.NewInt(1),
+		Extra:      make([]byte, 32),
+	}
+	data, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.SignData(context.Background(), "application/x-unknown", a, data); err == nil {
+		t.Errorf("Expected error for unsupported content type")
+	}
+	if _, err := api.SignData(context.Background(), accounts.MimetypeClique, a, []byte("not a header")); err == nil {
+		t.Errorf("Expected error for invalid clique header")
+	}
+	control <- "No way"
+	if _, err := api.SignData(context.Background(), accounts.MimetypeClique, a, data); err != ErrRequestDenied {
+		t.Errorf("Expected ErrRequestDenied! %v", err)
+	}
+	control <- "Y"
+	control <- "a_long_password"
+	sig, err := api.SignData(context.Background(), accounts.MimetypeClique, a, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sig) != 65 {
+		t.Fatalf("Expected 65 byte signature (got %d bytes)", len(sig))
+	}
+	sig[64] -= 27
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(data), sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer := crypto.PubkeyToAddress(*pubkey); signer != a.Address() {
+		t.Errorf("Signer mismatch: have %x, want %x", signer, a.Address())
+	}
+}
+
 func mkTestTx(from common.MixedcaseAddress) SendTxArgs {
 	to := common.NewMixedcaseAddress(common.HexToAddress("0x1337"))
 	gas := hexutil.Uint64(21000)
@@ -71,6 +71,22 @@ func (l *AuditLogger) Sign(ctx context.Context, addr common.MixedcaseAddress, da
 	return b, e
 }
 
+func (l *AuditLogger) SignTypedData(ctx context.Context, addr common.MixedcaseAddress, typedData TypedData) (hexutil.Bytes, error) {
+	l.log.Info("SignTypedData", "type", "request", "metadata", MetadataFromContext(ctx).String(),
+		"addr", addr.String(), "primaryType", typedData.PrimaryType)
+	b, e := l.api.SignTypedData(ctx, addr, typedData)
+	l.log.Info("SignTypedData", "type", "response", "data", common.Bytes2Hex(b), "error", e)
+	return b, e
+}
+
+func (l *AuditLogger) SignData(ctx context.Context, contentType string, addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error) {
+	l.log.Info("SignData", "type", "request", "metadata", MetadataFromContext(ctx).String(),
+		"addr", addr.String(), "contentType", contentType, "data", common.Bytes2Hex(data))
+	b, e := l.api.SignData(ctx, contentType, addr, data)
+	l.log.Info("SignData", "type", "response", "data", common.Bytes2Hex(b), "error", e)
+	return b, e
+}
+
 func (l *AuditLogger) Export(ctx context.Context, addr common.Address) (json.RawMessage, error) {
 	l.log.Info("Export", "type", "request", "metadata", MetadataFromContext(ctx).String(),
 		"addr", addr.Hex())
@@ -90,12 +106,72 @@ func (l *AuditLogger) Export(ctx context.Context, addr common.Address) (json.Raw
 //}
 
 func NewAuditLogger(path string, api ExternalAPI) (*AuditLogger, error) {
-	l := log.New("api", "signer")
+	l, err := NewAuditLog(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuditLoggerWithLog(l, api), nil
+}
+
+// NewAuditLoggerWithLog creates an audit logger emitting into an already opened
+// audit log, which may be shared with other auditing components.
+func NewAuditLoggerWithLog(l log.Logger, api ExternalAPI) *AuditLogger {
+	return &AuditLogger{l.New("api", "signer"), api}
+}
+
+// NewAuditLog opens the given file as an audit log. Besides the API calls, other
+// components (e.g. the policy engine) record their decisions into it.
+func NewAuditLog(path string) (log.Logger, error) {
+	l := log.New()
 	handler, err := log.FileHandler(path, log.LogfmtFormat())
 	if err != nil {
 		return nil, err
 	}
 	l.SetHandler(handler)
 	l.Info("Configured", "audit log", path)
-	return &AuditLogger{l, api}, nil
+	return l, nil
+}
+
+func (l *AuditLogger) Version(ctx context.Context) (string, error) {
+	l.log.Info("Version", "type", "request", "metadata", MetadataFromContext(ctx).String())
+	data, err := l.api.Version(ctx)
+	l.log.Info("Version", "type", "response", "data", data, "error", err)
+	return data, err
+}
+
+// ApprovalAuditLogger wraps the approval API of a quorum, logging every action of
+// the approvers into the audit log.
+type ApprovalAuditLogger struct {
+	log log.Logger
+	api ApprovalAPI
+}
+
+// NewApprovalAuditLogger creates an audit logger for the approval API, emitting
+// into the given audit log.
+func NewApprovalAuditLogger(l log.Logger, api ApprovalAPI) *ApprovalAuditLogger {
+	return &ApprovalAuditLogger{l.New("api", "approval"), api}
+}
+
+func (l *ApprovalAuditLogger) Pending(ctx context.Context, timestamp int64, signature hexutil.Bytes) ([]*ApprovalRequest, error) {
+	l.log.Info("Pending", "type", "request", "metadata", MetadataFromContext(ctx).String(),
+		"timestamp", timestamp)
+	res, e := l.api.Pending(ctx, timestamp, signature)
+	l.log.Info("Pending", "type", "response", "requests", len(res), "error", e)
+	return res, e
+}
+
+func (l *ApprovalAuditLogger) Approve(ctx context.Context, id common.Hash, signature hexutil.Bytes) error {
+	l.log.Info("Approve", "type", "request", "metadata", MetadataFromContext(ctx).String(),
+		"id", id.Hex(), "signature", common.Bytes2Hex(signature))
+	e := l.api.Approve(ctx, id, signature)
+	l.log.Info("Approve", "type", "response", "error", e)
+	return e
+}
+
+func (l *ApprovalAuditLogger) Reject(ctx context.Context, id common.Hash, signature hexutil.Bytes) error {
+	l.log.Info("Reject", "type", "request", "metadata", MetadataFromContext(ctx).String(),
+		"id", id.Hex(), "signature", common.Bytes2Hex(signature))
+	e := l.api.Reject(ctx, id, signature)
+	l.log.Info("Reject", "type", "response", "error", e)
+	return e
 }
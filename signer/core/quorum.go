@@ -0,0 +1,403 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of go-etsc.
+//
+// go-etsc is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-etsc is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-etsc. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/common/hexutil"
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/internal/etscapi"
+	"github.com/ETSC3259/etsc/log"
+	"github.com/ETSC3259/etsc/signer/storage"
+)
+
+// authValidity is the maximum clock drift accepted for the timestamps signed by
+// approvers to authenticate listing the pending requests.
+const authValidity = time.Minute
+
+var (
+	ErrUnauthorized    = errors.New("not an approver")
+	ErrUnknownRequest  = errors.New("unknown or expired request")
+	ErrAlreadyApproved = errors.New("request already approved by approver")
+	ErrAuthExpired     = errors.New("authentication timestamp expired")
+)
+
+// ApprovalAPI defines the API through which approvers act on the requests
+// awaiting a quorum. Every call is authenticated by a signature of the approver
+// over a message specific to the call, made like account_sign (i.e. with the
+// personal message prefix):
+//
+//   pending <unix timestamp>  to list the pending requests
+//   approve <request id>      to approve a request
+//   reject <request id>       to reject a request
+type ApprovalAPI interface {
+	// Pending - request to list the requests awaiting approval
+	Pending(ctx context.Context, timestamp int64, signature hexutil.Bytes) ([]*ApprovalRequest, error)
+	// Approve - request to approve a pending request
+	Approve(ctx context.Context, id common.Hash, signature hexutil.Bytes) error
+	// Reject - request to reject a pending request
+	Reject(ctx context.Context, id common.Hash, signature hexutil.Bytes) error
+}
+
+// ApprovalRequest is a signing request awaiting approval by a quorum.
+type ApprovalRequest struct {
+	ID        common.Hash      `json:"id"`
+	Method    string           `json:"method"` // UI method of the request, e.g. ApproveTx
+	Request   interface{}      `json:"request"`
+	Approvals []common.Address `json:"approvals"`
+	Quorum    int              `json:"quorum"`
+	Expires   time.Time        `json:"expires"`
+}
+
+// pendingApproval is a request in the approval queue.
+type pendingApproval struct {
+	request   *ApprovalRequest
+	approvals map[common.Address]bool
+	result    chan bool // Receives the outcome, buffered to never block approvers
+}
+
+// QuorumUI is a SignerUI which requires signing and export requests to be
+// approved by a quorum of M out of N approvers. Requests are first passed on to
+// the next UI (e.g. a rule engine or policy), which may reject or modify them,
+// but whose approval is never sufficient. Requests it approves are queued and
+// exposed through the ApprovalAPI. A request is approved once the quorum is
+// reached, and denied if any approver rejects it or it times out. All other
+// interactions are passed on to the next UI.
+//
+// The QuorumUI must be the outermost UI, so that nothing approves requests
+// around it. The UI innermost in the chain it wraps is expected to defer all
+// decisions to the quorum, see DeferToQuorum.
+type QuorumUI struct {
+	next        SignerUI
+	approvers   map[common.Address]bool
+	quorum      int
+	timeout     time.Duration
+	credentials storage.Storage // Keystore passwords, used once a quorum is reached
+	audit       log.Logger
+
+	pending map[common.Hash]*pendingApproval
+	nonce   uint64
+	lock    sync.Mutex
+}
+
+// NewQuorumUI creates a UI requiring quorum out of the given approvers to approve
+// requests, within the given timeout.
+func NewQuorumUI(next SignerUI, approvers []common.Address, quorum int, timeout time.Duration, credentials storage.Storage, audit log.Logger) (*QuorumUI, error) {
+	set := make(map[common.Address]bool)
+	for _, approver := range approvers {
+		set[approver] = true
+	}
+	if quorum < 1 || quorum > len(set) {
+		return nil, fmt.Errorf("invalid quorum %d of %d approvers", quorum, len(set))
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("invalid approval timeout %v", timeout)
+	}
+	return &QuorumUI{
+		next:        next,
+		approvers:   set,
+		quorum:      quorum,
+		timeout:     timeout,
+		credentials: credentials,
+		audit:       audit.New("api", "quorum"),
+		pending:     make(map[common.Hash]*pendingApproval),
+	}, nil
+}
+
+// await queues the request and blocks until it is approved by a quorum, or is
+// rejected or expires.
+func (ui *QuorumUI) await(method string, request interface{}) bool {
+	ui.lock.Lock()
+	ui.nonce++
+	id, err := approvalID(method, request, ui.nonce)
+	if err != nil {
+		ui.lock.Unlock()
+		log.Warn("Failed to queue request for approval", "err", err)
+		return false
+	}
+	pending := &pendingApproval{
+		request: &ApprovalRequest{
+			ID:      id,
+			Method:  method,
+			Request: request,
+			Quorum:  ui.quorum,
+			Expires: time.Now().Add(ui.timeout),
+		},
+		approvals: make(map[common.Address]bool),
+		result:    make(chan bool, 1),
+	}
+	ui.pending[id] = pending
+	ui.lock.Unlock()
+
+	ui.audit.Info(method, "type", "queued", "id", id, "quorum", ui.quorum, "expires", pending.request.Expires)
+	ui.next.ShowInfo(fmt.Sprintf("Request %x awaiting approval by %d of %d approvers", id, ui.quorum, len(ui.approvers)))
+
+	timer := time.NewTimer(ui.timeout)
+	defer timer.Stop()
+
+	select {
+	case approved := <-pending.result:
+		return approved
+	case <-timer.C:
+		ui.lock.Lock()
+		defer ui.lock.Unlock()
+
+		// The outcome may have been decided while acquiring the lock
+		select {
+		case approved := <-pending.result:
+			return approved
+		default:
+		}
+		delete(ui.pending, id)
+		ui.audit.Info(method, "type", "expired", "id", id, "approvals", len(pending.approvals))
+		return false
+	}
+}
+
+// approvalID derives a unique identifier for a request.
+func approvalID(method string, request interface{}, nonce uint64) (common.Hash, error) {
+	blob, err := json.Marshal(request)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	var salt [16]byte
+	binary.BigEndian.PutUint64(salt[:8], nonce)
+	binary.BigEndian.PutUint64(salt[8:], uint64(time.Now().UnixNano()))
+	return crypto.Keccak256Hash([]byte(method), blob, salt[:]), nil
+}
+
+// recoverApprover returns the approver which signed the given message.
+func (ui *QuorumUI) recoverApprover(message string, signature hexutil.Bytes) (common.Address, error) {
+	if len(signature) != 65 {
+		return common.Address{}, fmt.Errorf("invalid signature length %d", len(signature))
+	}
+	sig := common.CopyBytes(signature)
+	if sig[64] >= 27 {
+		sig[64] -= 27 // Accept signatures with V 27/28 as produced by account_sign
+	}
+	hash, _ := SignHash([]byte(message))
+	pubkey, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	approver := crypto.PubkeyToAddress(*pubkey)
+	if !ui.approvers[approver] {
+		return common.Address{}, ErrUnauthorized
+	}
+	return approver, nil
+}
+
+// decide records the decision of an approver on a pending request.
+func (ui *QuorumUI) decide(id common.Hash, approve bool, signature hexutil.Bytes) error {
+	action := "reject"
+	if approve {
+		action = "approve"
+	}
+	approver, err := ui.recoverApprover(fmt.Sprintf("%s %s", action, id.Hex()), signature)
+	if err != nil {
+		return err
+	}
+	ui.lock.Lock()
+	defer ui.lock.Unlock()
+
+	pending, ok := ui.pending[id]
+	if !ok {
+		return ErrUnknownRequest
+	}
+	method := pending.request.Method
+	if !approve {
+		delete(ui.pending, id)
+		ui.audit.Info(method, "type", "rejected", "id", id, "approver", approver)
+		pending.result <- false
+		return nil
+	}
+	if pending.approvals[approver] {
+		return ErrAlreadyApproved
+	}
+	pending.approvals[approver] = true
+	pending.request.Approvals = append(pending.request.Approvals, approver)
+	ui.audit.Info(method, "type", "approved", "id", id, "approver", approver, "approvals", len(pending.approvals), "quorum", ui.quorum)
+
+	if len(pending.approvals) >= ui.quorum {
+		delete(ui.pending, id)
+		ui.audit.Info(method, "type", "quorum", "id", id, "approvers", pending.request.Approvals)
+		pending.result <- true
+	}
+	return nil
+}
+
+// list returns the pending requests, ordered by expiration.
+func (ui *QuorumUI) list(timestamp int64, signature hexutil.Bytes) ([]*ApprovalRequest, error) {
+	if drift := time.Since(time.Unix(timestamp, 0)); drift > authValidity || drift < -authValidity {
+		return nil, ErrAuthExpired
+	}
+	if _, err := ui.recoverApprover(fmt.Sprintf("pending %d", timestamp), signature); err != nil {
+		return nil, err
+	}
+	ui.lock.Lock()
+	defer ui.lock.Unlock()
+
+	requests := make([]*ApprovalRequest, 0, len(ui.pending))
+	for _, pending := range ui.pending {
+		request := *pending.request
+		request.Approvals = append([]common.Address{}, request.Approvals...)
+		requests = append(requests, &request)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].Expires.Before(requests[j].Expires)
+	})
+	return requests, nil
+}
+
+func (ui *QuorumUI) lookupPassword(address common.Address) string {
+	return ui.credentials.Get(strings.ToLower(address.String()))
+}
+
+func (ui *QuorumUI) ApproveTx(request *SignTxRequest) (SignTxResponse, error) {
+	response, err := ui.next.ApproveTx(request)
+	if err != nil || !response.Approved {
+		return response, err
+	}
+	// The approvers vote on the transaction as approved by the next UI, which
+	// is the one going to be signed
+	approval := *request
+	approval.Transaction = response.Transaction
+	if !ui.await("ApproveTx", &approval) {
+		return SignTxResponse{Transaction: response.Transaction, Approved: false}, nil
+	}
+	if response.Password == "" {
+		response.Password = ui.lookupPassword(response.Transaction.From.Address())
+	}
+	return response, nil
+}
+
+func (ui *QuorumUI) ApproveSignData(request *SignDataRequest) (SignDataResponse, error) {
+	response, err := ui.next.ApproveSignData(request)
+	if err != nil || !response.Approved {
+		return response, err
+	}
+	if !ui.await("ApproveSignData", request) {
+		return SignDataResponse{Approved: false}, nil
+	}
+	if response.Password == "" {
+		response.Password = ui.lookupPassword(request.Address.Address())
+	}
+	return response, nil
+}
+
+func (ui *QuorumUI) ApproveExport(request *ExportRequest) (ExportResponse, error) {
+	response, err := ui.next.ApproveExport(request)
+	if err != nil || !response.Approved {
+		return response, err
+	}
+	return ExportResponse{Approved: ui.await("ApproveExport", request)}, nil
+}
+
+func (ui *QuorumUI) ApproveImport(request *ImportRequest) (ImportResponse, error) {
+	return ui.next.ApproveImport(request)
+}
+
+func (ui *QuorumUI) ApproveListing(request *ListRequest) (ListResponse, error) {
+	return ui.next.ApproveListing(request)
+}
+
+func (ui *QuorumUI) ApproveNewAccount(request *NewAccountRequest) (NewAccountResponse, error) {
+	return ui.next.ApproveNewAccount(request)
+}
+
+func (ui *QuorumUI) ShowError(message string) {
+	ui.next.ShowError(message)
+}
+
+func (ui *QuorumUI) ShowInfo(message string) {
+	ui.next.ShowInfo(message)
+}
+
+func (ui *QuorumUI) OnApprovedTx(tx etscapi.SignTransactionResult) {
+	ui.next.OnApprovedTx(tx)
+}
+
+func (ui *QuorumUI) OnSignerStartup(info StartupInfo) {
+	ui.next.OnSignerStartup(info)
+}
+
+func (ui *QuorumUI) OnInputRequired(info UserInputRequest) (UserInputResponse, error) {
+	return ui.next.OnInputRequired(info)
+}
+
+// quorumDeferUI is a SignerUI approving all signing and export requests, leaving
+// the decision to the QuorumUI wrapping it.
+type quorumDeferUI struct {
+	SignerUI
+}
+
+// DeferToQuorum wraps the UI to approve all signing and export requests reaching
+// it, leaving the decision to a QuorumUI further out in the chain. The approvers
+// thus replace the user, who's still consulted for all other interactions.
+func DeferToQuorum(next SignerUI) SignerUI {
+	return &quorumDeferUI{next}
+}
+
+func (ui *quorumDeferUI) ApproveTx(request *SignTxRequest) (SignTxResponse, error) {
+	return SignTxResponse{Transaction: request.Transaction, Approved: true}, nil
+}
+
+func (ui *quorumDeferUI) ApproveSignData(request *SignDataRequest) (SignDataResponse, error) {
+	return SignDataResponse{Approved: true}, nil
+}
+
+func (ui *quorumDeferUI) ApproveExport(request *ExportRequest) (ExportResponse, error) {
+	return ExportResponse{Approved: true}, nil
+}
+
+// QuorumAPI is the implementation of ApprovalAPI, exposing the approval queue of
+// a QuorumUI to the approvers.
+type QuorumAPI struct {
+	ui *QuorumUI
+}
+
+// NewQuorumAPI creates the approval API of the given quorum UI.
+func NewQuorumAPI(ui *QuorumUI) *QuorumAPI {
+	return &QuorumAPI{ui: ui}
+}
+
+// Pending returns the requests awaiting approval. The signature must be made by
+// an approver over "pending <timestamp>", with the timestamp at most a minute off.
+func (api *QuorumAPI) Pending(ctx context.Context, timestamp int64, signature hexutil.Bytes) ([]*ApprovalRequest, error) {
+	return api.ui.list(timestamp, signature)
+}
+
+// Approve adds the approval of the approver which signed "approve <id>" to the
+// request. The request is approved once the quorum is reached.
+func (api *QuorumAPI) Approve(ctx context.Context, id common.Hash, signature hexutil.Bytes) error {
+	return api.ui.decide(id, true, signature)
+}
+
+// Reject denies the request on behalf of the approver which signed "reject <id>".
+func (api *QuorumAPI) Reject(ctx context.Context, id common.Hash, signature hexutil.Bytes) error {
+	return api.ui.decide(id, false, signature)
+}
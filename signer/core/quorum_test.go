@@ -0,0 +1,193 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of go-etsc.
+//
+// go-etsc is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-etsc is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-etsc. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ETSC3259/etsc/accounts"
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/common/hexutil"
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/log"
+	"github.com/ETSC3259/etsc/signer/storage"
+)
+
+// approverSign signs the message like account_sign does.
+func approverSign(t *testing.T, key *ecdsa.PrivateKey, message string) hexutil.Bytes {
+	hash, _ := SignHash([]byte(message))
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+	return sig
+}
+
+// newTestQuorum creates a 2-of-3 quorum UI with a password stored for from.
+func newTestQuorum(t *testing.T, timeout time.Duration, from common.Address) (*QuorumUI, *QuorumAPI, []*ecdsa.PrivateKey) {
+	keys := make([]*ecdsa.PrivateKey, 3)
+	approvers := make([]common.Address, 3)
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i], approvers[i] = key, crypto.PubkeyToAddress(key.PublicKey)
+	}
+	credentials := storage.NewEphemeralStorage()
+	credentials.Put(strings.ToLower(from.String()), "a_long_password")
+
+	audit := log.New()
+	audit.SetHandler(log.DiscardHandler())
+
+	ui, err := NewQuorumUI(DeferToQuorum(&HeadlessUI{}), approvers, 2, timeout, credentials, audit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ui, NewQuorumAPI(ui), keys
+}
+
+// awaitPending waits for a request to be queued, returning its id.
+func awaitPending(t *testing.T, api *QuorumAPI, key *ecdsa.PrivateKey) common.Hash {
+	for i := 0; i < 100; i++ {
+		now := time.Now().Unix()
+		requests, err := api.Pending(context.Background(), now, approverSign(t, key, fmt.Sprintf("pending %d", now)))
+		if err != nil {
+			t.Fatalf("failed to list pending requests: %v", err)
+		}
+		if len(requests) > 0 {
+			return requests[0].ID
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("request not queued")
+	return common.Hash{}
+}
+
+func TestQuorumApproval(t *testing.T) {
+	from := common.HexToAddress("0x000000000000000000000000000000000000f00d")
+	ui, api, keys := newTestQuorum(t, time.Minute, from)
+
+	done := make(chan SignTxResponse)
+	go func() {
+		response, _ := ui.ApproveTx(&SignTxRequest{Transaction: mkTestTx(common.NewMixedcaseAddress(from))})
+		done <- response
+	}()
+	id := awaitPending(t, api, keys[0])
+	approve := fmt.Sprintf("approve %s", id.Hex())
+
+	// Outsiders and wrongly signed approvals must be refused
+	outsider, _ := crypto.GenerateKey()
+	if err := api.Approve(context.Background(), id, approverSign(t, outsider, approve)); err != ErrUnauthorized {
+		t.Errorf("outsider approval error mismatch: have %v, want %v", err, ErrUnauthorized)
+	}
+	if err := api.Approve(context.Background(), id, approverSign(t, keys[0], "approve "+common.Hash{}.Hex())); err != ErrUnauthorized {
+		t.Errorf("mismatching approval error mismatch: have %v, want %v", err, ErrUnauthorized)
+	}
+	// A single approval must not be enough, nor must it count twice
+	if err := api.Approve(context.Background(), id, approverSign(t, keys[0], approve)); err != nil {
+		t.Fatalf("failed to approve: %v", err)
+	}
+	if err := api.Approve(context.Background(), id, approverSign(t, keys[0], approve)); err != ErrAlreadyApproved {
+		t.Errorf("duplicate approval error mismatch: have %v, want %v", err, ErrAlreadyApproved)
+	}
+	select {
+	case <-done:
+		t.Fatalf("request approved before quorum")
+	case <-time.After(50 * time.Millisecond):
+	}
+	now := time.Now().Unix()
+	requests, err := api.Pending(context.Background(), now, approverSign(t, keys[2], fmt.Sprintf("pending %d", now)))
+	if err != nil || len(requests) != 1 || len(requests[0].Approvals) != 1 {
+		t.Fatalf("pending requests mismatch: %v, %v", requests, err)
+	}
+	// The second approval reaches the quorum and releases the request
+	if err := api.Approve(context.Background(), id, approverSign(t, keys[1], approve)); err != nil {
+		t.Fatalf("failed to approve: %v", err)
+	}
+	select {
+	case response := <-done:
+		if !response.Approved || response.Password != "a_long_password" {
+			t.Errorf("response mismatch: approved %v, password %q", response.Approved, response.Password)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("request not approved on quorum")
+	}
+	if err := api.Approve(context.Background(), id, approverSign(t, keys[2], approve)); err != ErrUnknownRequest {
+		t.Errorf("late approval error mismatch: have %v, want %v", err, ErrUnknownRequest)
+	}
+}
+
+func TestQuorumRejection(t *testing.T) {
+	from := common.HexToAddress("0x000000000000000000000000000000000000f00d")
+	ui, api, keys := newTestQuorum(t, time.Minute, from)
+
+	done := make(chan SignDataResponse)
+	go func() {
+		response, _ := ui.ApproveSignData(&SignDataRequest{ContentType: accounts.MimetypeTextPlain, Address: common.NewMixedcaseAddress(from)})
+		done <- response
+	}()
+	id := awaitPending(t, api, keys[0])
+	if err := api.Approve(context.Background(), id, approverSign(t, keys[0], "approve "+id.Hex())); err != nil {
+		t.Fatalf("failed to approve: %v", err)
+	}
+	// A single rejection must veto the request
+	if err := api.Reject(context.Background(), id, approverSign(t, keys[1], "reject "+id.Hex())); err != nil {
+		t.Fatalf("failed to reject: %v", err)
+	}
+	select {
+	case response := <-done:
+		if response.Approved {
+			t.Errorf("rejected request approved")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("request not rejected")
+	}
+}
+
+func TestQuorumTimeout(t *testing.T) {
+	ui, api, keys := newTestQuorum(t, 100*time.Millisecond, common.Address{})
+
+	if response, _ := ui.ApproveExport(&ExportRequest{}); response.Approved {
+		t.Errorf("expired request approved")
+	}
+	now := time.Now().Unix()
+	requests, err := api.Pending(context.Background(), now, approverSign(t, keys[0], fmt.Sprintf("pending %d", now)))
+	if err != nil || len(requests) != 0 {
+		t.Errorf("expired request still pending: %v, %v", requests, err)
+	}
+	// Stale authentication must be refused
+	stale := now - 3600
+	if _, err := api.Pending(context.Background(), stale, approverSign(t, keys[0], fmt.Sprintf("pending %d", stale))); err != ErrAuthExpired {
+		t.Errorf("stale authentication error mismatch: have %v, want %v", err, ErrAuthExpired)
+	}
+}
+
+func TestQuorumConfig(t *testing.T) {
+	approvers := []common.Address{{1}, {2}, {2}}
+	for _, quorum := range []int{0, 3} {
+		if _, err := NewQuorumUI(DeferToQuorum(&HeadlessUI{}), approvers, quorum, time.Minute, storage.NewEphemeralStorage(), log.New()); err == nil {
+			t.Errorf("expected error for quorum %d of %v", quorum, approvers)
+		}
+	}
+}
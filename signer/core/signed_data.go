@@ -0,0 +1,537 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of go-etsc.
+//
+// go-etsc is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-etsc is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-etsc. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/common/hexutil"
+	"github.com/ETSC3259/etsc/common/math"
+	"github.com/ETSC3259/etsc/crypto"
+)
+
+// DataTyped is the content type of EIP-712 typed structured data a SignDataRequest
+// asks to be signed, besides the ones defined by the accounts package.
+const DataTyped = "data/typed"
+
+// eip712Domain is the name of the struct type describing the signing domain.
+const eip712Domain = "EIP712Domain"
+
+// TypedData is a request to sign EIP-712 typed structured data. It consists of
+// the definitions of all struct types used, the name of the type of the message
+// being signed, the signing domain and the message itself.
+type TypedData struct {
+	Types       Types            `json:"types"`
+	PrimaryType string           `json:"primaryType"`
+	Domain      TypedDataDomain  `json:"domain"`
+	Message     TypedDataMessage `json:"message"`
+}
+
+// Type is a single named member of a struct type.
+type Type struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Types maps the name of each struct type to its ordered list of members.
+type Types map[string][]Type
+
+// TypedDataMessage is the JSON-decoded value of a struct. Integers may be given
+// either as JSON numbers or, if they do not fit into one, as decimal or hex
+// strings. Byte arrays are given as hex strings.
+type TypedDataMessage map[string]interface{}
+
+// TypedDataDomain is the signing domain of a typed data request, all fields of
+// which are optional. The fields present must match the ones declared by the
+// EIP712Domain type.
+type TypedDataDomain struct {
+	Name              string   `json:"name,omitempty"`
+	Version           string   `json:"version,omitempty"`
+	ChainId           *big.Int `json:"chainId,omitempty"`
+	VerifyingContract string   `json:"verifyingContract,omitempty"`
+	Salt              string   `json:"salt,omitempty"`
+}
+
+// Map returns the fields of the domain which are set, keyed by their member
+// names within the EIP712Domain type.
+func (domain *TypedDataDomain) Map() TypedDataMessage {
+	fields := make(TypedDataMessage)
+	if domain.Name != "" {
+		fields["name"] = domain.Name
+	}
+	if domain.Version != "" {
+		fields["version"] = domain.Version
+	}
+	if domain.ChainId != nil {
+		fields["chainId"] = domain.ChainId
+	}
+	if domain.VerifyingContract != "" {
+		fields["verifyingContract"] = domain.VerifyingContract
+	}
+	if domain.Salt != "" {
+		fields["salt"] = domain.Salt
+	}
+	return fields
+}
+
+// NameValueType is a decoded, human readable field of typed data. The value is
+// either a string, or a list of further fields for structs and arrays.
+type NameValueType struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+	Typ   string      `json:"type"`
+}
+
+// Pprint returns a pretty-printed, indented representation of the field and all
+// its nested fields.
+func (nvt *NameValueType) Pprint(depth int) string {
+	output := new(bytes.Buffer)
+	output.WriteString(strings.Repeat(" ", depth*2))
+	output.WriteString(fmt.Sprintf("%s [%s]: ", nvt.Name, nvt.Typ))
+	if nvts, ok := nvt.Value.([]*NameValueType); ok {
+		output.WriteString("\n")
+		for _, next := range nvts {
+			output.WriteString(next.Pprint(depth + 1))
+		}
+	} else {
+		output.WriteString(fmt.Sprintf("%q\n", nvt.Value))
+	}
+	return output.String()
+}
+
+var (
+	typeNameRegexp  = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$]*$`)
+	arraySuffixRegx = regexp.MustCompile(`\[([0-9]*)\]$`)
+)
+
+// Validate checks that the type definitions are well formed, that the primary
+// type is defined and that every referenced type is either a defined struct or
+// an atomic Solidity type. The message contents are checked during hashing.
+func (typedData *TypedData) Validate() error {
+	if _, ok := typedData.Types[eip712Domain]; !ok {
+		return fmt.Errorf("missing %s type definition", eip712Domain)
+	}
+	if typedData.PrimaryType == "" {
+		return errors.New("missing primary type")
+	}
+	if _, ok := typedData.Types[typedData.PrimaryType]; !ok {
+		return fmt.Errorf("primary type %q is not defined", typedData.PrimaryType)
+	}
+	for name, members := range typedData.Types {
+		if !typeNameRegexp.MatchString(name) || isAtomicType(name) {
+			return fmt.Errorf("invalid type name %q", name)
+		}
+		seen := make(map[string]bool)
+		for _, member := range members {
+			if member.Name == "" {
+				return fmt.Errorf("type %s has a member without a name", name)
+			}
+			if seen[member.Name] {
+				return fmt.Errorf("type %s has duplicate member %q", name, member.Name)
+			}
+			seen[member.Name] = true
+
+			elem := member.Type
+			for arraySuffixRegx.MatchString(elem) {
+				elem = elem[:strings.LastIndex(elem, "[")]
+			}
+			if _, ok := typedData.Types[elem]; !ok && !isAtomicType(elem) {
+				return fmt.Errorf("type %s member %q has unknown type %q", name, member.Name, member.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// HashStruct returns the EIP-712 hash of the given struct value of the named type:
+//
+//	keccak256(typeHash ‖ encodeData(data)).
+func (typedData *TypedData) HashStruct(primaryType string, data TypedDataMessage) ([]byte, error) {
+	encoded, err := typedData.EncodeData(primaryType, data)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256(encoded), nil
+}
+
+// Hashes returns the hash of the domain separator and the hash of the message
+// struct, from which the final digest to sign is derived.
+func (typedData *TypedData) Hashes() (domainSeparator []byte, messageHash []byte, err error) {
+	if domainSeparator, err = typedData.HashStruct(eip712Domain, typedData.Domain.Map()); err != nil {
+		return nil, nil, err
+	}
+	if messageHash, err = typedData.HashStruct(typedData.PrimaryType, typedData.Message); err != nil {
+		return nil, nil, err
+	}
+	return domainSeparator, messageHash, nil
+}
+
+// Dependencies returns the names of all struct types the given type references,
+// directly or transitively, including itself.
+func (typedData *TypedData) Dependencies(primaryType string, found []string) []string {
+	for strings.HasSuffix(primaryType, "]") {
+		primaryType = primaryType[:strings.LastIndex(primaryType, "[")]
+	}
+	for _, name := range found {
+		if name == primaryType {
+			return found
+		}
+	}
+	if _, ok := typedData.Types[primaryType]; !ok {
+		return found
+	}
+	found = append(found, primaryType)
+	for _, member := range typedData.Types[primaryType] {
+		found = typedData.Dependencies(member.Type, found)
+	}
+	return found
+}
+
+// EncodeType returns the EIP-712 encoding of the type: its own definition
+// followed by the definitions of all referenced struct types, sorted by name.
+//
+//	Mail(Person from,Person to,string contents)Person(string name,address wallet)
+func (typedData *TypedData) EncodeType(primaryType string) []byte {
+	deps := typedData.Dependencies(primaryType, nil)
+	if len(deps) > 0 {
+		sort.Strings(deps[1:])
+	}
+	var buffer bytes.Buffer
+	for _, dep := range deps {
+		buffer.WriteString(dep)
+		buffer.WriteString("(")
+		for i, member := range typedData.Types[dep] {
+			if i > 0 {
+				buffer.WriteString(",")
+			}
+			buffer.WriteString(member.Type)
+			buffer.WriteString(" ")
+			buffer.WriteString(member.Name)
+		}
+		buffer.WriteString(")")
+	}
+	return buffer.Bytes()
+}
+
+// TypeHash returns the keccak256 hash of the encoding of the given type.
+func (typedData *TypedData) TypeHash(primaryType string) []byte {
+	return crypto.Keccak256(typedData.EncodeType(primaryType))
+}
+
+// EncodeData returns the EIP-712 encoding of the given struct value of the named
+// type: its type hash followed by the 32 byte encoding of each member in order.
+// Every declared member must be present, and no others.
+func (typedData *TypedData) EncodeData(primaryType string, data map[string]interface{}) ([]byte, error) {
+	members, ok := typedData.Types[primaryType]
+	if !ok {
+		return nil, fmt.Errorf("unknown struct type %q", primaryType)
+	}
+	if len(data) > len(members) {
+		return nil, fmt.Errorf("%s has more fields than its type defines", primaryType)
+	}
+	buffer := bytes.NewBuffer(typedData.TypeHash(primaryType))
+	for _, member := range members {
+		value, ok := data[member.Name]
+		if !ok {
+			return nil, fmt.Errorf("%s is missing field %q", primaryType, member.Name)
+		}
+		encoded, err := typedData.encodeValue(member.Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", primaryType, member.Name, err)
+		}
+		buffer.Write(encoded)
+	}
+	return buffer.Bytes(), nil
+}
+
+// encodeValue returns the 32 byte encoding of a single value of the given type.
+// Dynamic values, arrays and structs are encoded as their keccak256 hash.
+func (typedData *TypedData) encodeValue(encType string, value interface{}) ([]byte, error) {
+	// Arrays are encoded as the hash of the concatenated encodings of their elements
+	if elemType, size, ok := parseArrayType(encType); ok {
+		elems, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid %s value %v", encType, value)
+		}
+		if size >= 0 && len(elems) != size {
+			return nil, fmt.Errorf("invalid %s length %d", encType, len(elems))
+		}
+		var buffer bytes.Buffer
+		for i, elem := range elems {
+			encoded, err := typedData.encodeValue(elemType, elem)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %v", i, err)
+			}
+			buffer.Write(encoded)
+		}
+		return crypto.Keccak256(buffer.Bytes()), nil
+	}
+	// Structs are encoded as their struct hash
+	if _, ok := typedData.Types[encType]; ok {
+		fields, ok := asStruct(value)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s value %v", encType, value)
+		}
+		return typedData.HashStruct(encType, fields)
+	}
+	switch {
+	case encType == "string":
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid string value %v", value)
+		}
+		return crypto.Keccak256([]byte(str)), nil
+
+	case encType == "bytes":
+		blob, err := parseBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.Keccak256(blob), nil
+
+	case encType == "bool":
+		flag, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("invalid bool value %v", value)
+		}
+		if flag {
+			return math.PaddedBigBytes(common.Big1, 32), nil
+		}
+		return math.PaddedBigBytes(common.Big0, 32), nil
+
+	case encType == "address":
+		str, ok := value.(string)
+		if !ok || !common.IsHexAddress(str) {
+			return nil, fmt.Errorf("invalid address value %v", value)
+		}
+		return common.LeftPadBytes(common.HexToAddress(str).Bytes(), 32), nil
+
+	case strings.HasPrefix(encType, "bytes"):
+		size, err := strconv.Atoi(encType[len("bytes"):])
+		if err != nil || size < 1 || size > 32 {
+			return nil, fmt.Errorf("unknown type %q", encType)
+		}
+		blob, err := parseBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(blob) != size {
+			return nil, fmt.Errorf("invalid %s length %d", encType, len(blob))
+		}
+		return common.RightPadBytes(blob, 32), nil
+
+	case strings.HasPrefix(encType, "int") || strings.HasPrefix(encType, "uint"):
+		integer, err := parseInteger(encType, value)
+		if err != nil {
+			return nil, err
+		}
+		return math.PaddedBigBytes(math.U256(integer), 32), nil
+	}
+	return nil, fmt.Errorf("unknown type %q", encType)
+}
+
+// Format returns the decoded domain and message as human readable fields, in
+// the order of their type definitions, for the user to review before signing.
+func (typedData *TypedData) Format() ([]*NameValueType, error) {
+	domain, err := typedData.formatData(eip712Domain, typedData.Domain.Map())
+	if err != nil {
+		return nil, err
+	}
+	message, err := typedData.formatData(typedData.PrimaryType, typedData.Message)
+	if err != nil {
+		return nil, err
+	}
+	return []*NameValueType{
+		{Name: eip712Domain, Value: domain, Typ: "domain"},
+		{Name: typedData.PrimaryType, Value: message, Typ: "primary type"},
+	}, nil
+}
+
+// formatData returns the members of a struct value as human readable fields.
+func (typedData *TypedData) formatData(primaryType string, data map[string]interface{}) ([]*NameValueType, error) {
+	var output []*NameValueType
+	for _, member := range typedData.Types[primaryType] {
+		value, err := typedData.formatValue(member.Type, data[member.Name])
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", primaryType, member.Name, err)
+		}
+		output = append(output, &NameValueType{Name: member.Name, Value: value, Typ: member.Type})
+	}
+	return output, nil
+}
+
+// formatValue returns a single value of the given type in human readable form.
+func (typedData *TypedData) formatValue(encType string, value interface{}) (interface{}, error) {
+	if elemType, _, ok := parseArrayType(encType); ok {
+		elems, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid %s value %v", encType, value)
+		}
+		output := make([]*NameValueType, 0, len(elems))
+		for i, elem := range elems {
+			formatted, err := typedData.formatValue(elemType, elem)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %v", i, err)
+			}
+			output = append(output, &NameValueType{Name: fmt.Sprintf("[%d]", i), Value: formatted, Typ: elemType})
+		}
+		return output, nil
+	}
+	if _, ok := typedData.Types[encType]; ok {
+		fields, ok := asStruct(value)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s value %v", encType, value)
+		}
+		return typedData.formatData(encType, fields)
+	}
+	switch {
+	case encType == "address":
+		if str, ok := value.(string); ok && common.IsHexAddress(str) {
+			return common.HexToAddress(str).Hex(), nil
+		}
+	case encType == "bytes" || strings.HasPrefix(encType, "bytes"):
+		if blob, err := parseBytes(value); err == nil {
+			return hexutil.Encode(blob), nil
+		}
+	case strings.HasPrefix(encType, "int") || strings.HasPrefix(encType, "uint"):
+		if integer, err := parseInteger(encType, value); err == nil {
+			return integer.String(), nil
+		}
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+// isAtomicType returns whether the given type is one of the Solidity value types
+// or dynamic byte types supported by EIP-712.
+func isAtomicType(encType string) bool {
+	switch encType {
+	case "address", "bool", "bytes", "string":
+		return true
+	}
+	for _, prefix := range []string{"bytes", "uint", "int"} {
+		if !strings.HasPrefix(encType, prefix) {
+			continue
+		}
+		size, err := strconv.Atoi(encType[len(prefix):])
+		if err != nil {
+			return false
+		}
+		if prefix == "bytes" {
+			return size >= 1 && size <= 32
+		}
+		return size >= 8 && size <= 256 && size%8 == 0
+	}
+	return false
+}
+
+// parseArrayType splits an array type into its element type and size, which is
+// -1 for dynamically sized arrays.
+func parseArrayType(encType string) (string, int, bool) {
+	match := arraySuffixRegx.FindStringSubmatchIndex(encType)
+	if match == nil {
+		return "", 0, false
+	}
+	elemType := encType[:match[0]]
+	if match[2] == match[3] {
+		return elemType, -1, true
+	}
+	size, err := strconv.Atoi(encType[match[2]:match[3]])
+	if err != nil {
+		return "", 0, false
+	}
+	return elemType, size, true
+}
+
+// asStruct converts a JSON-decoded struct value into a field map.
+func asStruct(value interface{}) (map[string]interface{}, bool) {
+	switch fields := value.(type) {
+	case map[string]interface{}:
+		return fields, true
+	case TypedDataMessage:
+		return fields, true
+	}
+	return nil, false
+}
+
+// parseBytes decodes a hex encoded byte array value.
+func parseBytes(value interface{}) ([]byte, error) {
+	switch blob := value.(type) {
+	case []byte:
+		return blob, nil
+	case hexutil.Bytes:
+		return blob, nil
+	case string:
+		decoded, err := hexutil.Decode(blob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bytes value %q: %v", blob, err)
+		}
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("invalid bytes value %v", value)
+}
+
+// parseInteger decodes an integer value of the given int or uint type, checking
+// that it fits into the type's size. JSON numbers are only accepted as long as
+// they can be represented exactly, larger values must be passed as strings.
+func parseInteger(encType string, value interface{}) (*big.Int, error) {
+	signed := strings.HasPrefix(encType, "int")
+	size, err := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(encType, "u"), "int"))
+	if err != nil || size < 8 || size > 256 || size%8 != 0 {
+		return nil, fmt.Errorf("unknown type %q", encType)
+	}
+	var integer *big.Int
+	switch v := value.(type) {
+	case *big.Int:
+		integer = new(big.Int).Set(v)
+	case float64:
+		if v != float64(int64(v)) || v > 1<<53 || v < -(1<<53) {
+			return nil, fmt.Errorf("invalid %s value %v, pass large integers as strings", encType, v)
+		}
+		integer = big.NewInt(int64(v))
+	case json.Number:
+		var ok bool
+		if integer, ok = new(big.Int).SetString(string(v), 10); !ok {
+			return nil, fmt.Errorf("invalid %s value %v", encType, v)
+		}
+	case string:
+		var ok bool
+		if integer, ok = math.ParseBig256(v); !ok {
+			return nil, fmt.Errorf("invalid %s value %q", encType, v)
+		}
+	default:
+		return nil, fmt.Errorf("invalid %s value %v", encType, value)
+	}
+	// Ensure the integer fits into the requested type
+	min, max := new(big.Int), new(big.Int).Lsh(common.Big1, uint(size))
+	if signed {
+		max.Rsh(max, 1)
+		min.Neg(max)
+	}
+	if integer.Cmp(min) < 0 || integer.Cmp(max) >= 0 {
+		return nil, fmt.Errorf("%s value %v out of range", encType, integer)
+	}
+	return integer, nil
+}
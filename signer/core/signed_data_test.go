@@ -0,0 +1,243 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of go-etsc.
+//
+// go-etsc is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-etsc is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-etsc. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/common/hexutil"
+	"github.com/ETSC3259/etsc/crypto"
+)
+
+// mailTypedData is the example request from the EIP-712 specification.
+const mailTypedData = `{
+	"types": {
+		"EIP712Domain": [
+			{"name": "name", "type": "string"},
+			{"name": "version", "type": "string"},
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"Person": [
+			{"name": "name", "type": "string"},
+			{"name": "wallet", "type": "address"}
+		],
+		"Mail": [
+			{"name": "from", "type": "Person"},
+			{"name": "to", "type": "Person"},
+			{"name": "contents", "type": "string"}
+		]
+	},
+	"primaryType": "Mail",
+	"domain": {
+		"name": "Ether Mail",
+		"version": "1",
+		"chainId": 1,
+		"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+	},
+	"message": {
+		"from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+		"to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+		"contents": "Hello, Bob!"
+	}
+}`
+
+func mailTestData(t *testing.T) TypedData {
+	var typedData TypedData
+	if err := json.Unmarshal([]byte(mailTypedData), &typedData); err != nil {
+		t.Fatalf("failed to unmarshal typed data: %v", err)
+	}
+	return typedData
+}
+
+// Tests that the EIP-712 specification example hashes to the published values.
+func TestTypedDataHashing(t *testing.T) {
+	typedData := mailTestData(t)
+	if err := typedData.Validate(); err != nil {
+		t.Fatalf("validation failed: %v", err)
+	}
+	if have, want := string(typedData.EncodeType("Mail")), "Mail(Person from,Person to,string contents)Person(string name,address wallet)"; have != want {
+		t.Errorf("type encoding mismatch: have %s, want %s", have, want)
+	}
+	if have, want := common.Bytes2Hex(typedData.TypeHash("Mail")), "a0cedeb2dc280ba39b857546d74f5549c3a1d7bdc2dd96bf881f76108e23dac2"; have != want {
+		t.Errorf("type hash mismatch: have %s, want %s", have, want)
+	}
+	domainSeparator, messageHash, err := typedData.Hashes()
+	if err != nil {
+		t.Fatalf("hashing failed: %v", err)
+	}
+	if have, want := common.Bytes2Hex(domainSeparator), "f2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f"; have != want {
+		t.Errorf("domain separator mismatch: have %s, want %s", have, want)
+	}
+	if have, want := common.Bytes2Hex(messageHash), "c52c0ee5d84264471806290a3f2c4cecfc5490626bf912d01f240d7a274b371e"; have != want {
+		t.Errorf("message hash mismatch: have %s, want %s", have, want)
+	}
+	digest := crypto.Keccak256([]byte{0x19, 0x01}, domainSeparator, messageHash)
+	if have, want := common.Bytes2Hex(digest), "be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2"; have != want {
+		t.Errorf("digest mismatch: have %s, want %s", have, want)
+	}
+}
+
+// Tests that malformed type definitions and messages are rejected.
+func TestTypedDataErrors(t *testing.T) {
+	tests := []struct {
+		mutate func(*TypedData)
+		fail   string
+	}{
+		{func(td *TypedData) { delete(td.Types, "EIP712Domain") }, "missing EIP712Domain"},
+		{func(td *TypedData) { td.PrimaryType = "Letter" }, "not defined"},
+		{func(td *TypedData) { td.Types["Person"][1].Type = "addr" }, "unknown type"},
+		{func(td *TypedData) { td.Types["Person"][1].Name = "name" }, "duplicate member"},
+		{func(td *TypedData) { td.Types["uint256"] = nil }, "invalid type name"},
+		{func(td *TypedData) { delete(td.Message, "contents") }, "missing field"},
+		{func(td *TypedData) { td.Message["bcc"] = "Alice" }, "more fields"},
+		{func(td *TypedData) { td.Message["contents"] = 42.0 }, "invalid string"},
+		{func(td *TypedData) { td.Message["to"].(map[string]interface{})["wallet"] = "0x1234" }, "invalid address"},
+		{func(td *TypedData) { td.Domain.Salt = "0x00" }, "more fields"},
+		{func(td *TypedData) { td.Domain.Version = "" }, "missing field"},
+	}
+	for i, tt := range tests {
+		typedData := mailTestData(t)
+		tt.mutate(&typedData)
+
+		err := typedData.Validate()
+		if err == nil {
+			_, _, err = typedData.Hashes()
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.fail) {
+			t.Errorf("test %d: error mismatch: have %v, want %q", i, err, tt.fail)
+		}
+	}
+}
+
+// Tests the encoding of the atomic and array types.
+func TestTypedDataValueEncoding(t *testing.T) {
+	typedData := TypedData{Types: Types{"S": {{Name: "x", Type: "uint8"}}}}
+	tests := []struct {
+		typ   string
+		value interface{}
+		want  string
+		fail  bool
+	}{
+		{typ: "bool", value: true, want: "0000000000000000000000000000000000000000000000000000000000000001"},
+		{typ: "uint8", value: 255.0, want: "00000000000000000000000000000000000000000000000000000000000000ff"},
+		{typ: "uint8", value: 256.0, fail: true},
+		{typ: "uint8", value: -1.0, fail: true},
+		{typ: "int8", value: -1.0, want: "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"},
+		{typ: "int8", value: "-128", want: "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff80"},
+		{typ: "int8", value: 128.0, fail: true},
+		{typ: "uint256", value: "0x10", want: "0000000000000000000000000000000000000000000000000000000000000010"},
+		{typ: "uint256", value: 1.5, fail: true},
+		{typ: "uint256", value: 1e20, fail: true},
+		{typ: "bytes4", value: "0xdeadbeef", want: "deadbeef00000000000000000000000000000000000000000000000000000000"},
+		{typ: "bytes4", value: "0xdead", fail: true},
+		{typ: "bytes", value: "0x", want: "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+		{typ: "string", value: "", want: "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+		{typ: "uint8[]", value: []interface{}{}, want: "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+		{typ: "uint8[2]", value: []interface{}{1.0}, fail: true},
+		{typ: "uint7", value: 1.0, fail: true},
+		{typ: "S[]", value: []interface{}{map[string]interface{}{"x": 1.0}}, want: common.Bytes2Hex(crypto.Keccak256(crypto.Keccak256(
+			typedData.TypeHash("S"), common.LeftPadBytes([]byte{1}, 32))))},
+	}
+	for i, tt := range tests {
+		have, err := typedData.encodeValue(tt.typ, tt.value)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("test %d: %s %v: expected error, got %x", i, tt.typ, tt.value, have)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: %s %v: unexpected error: %v", i, tt.typ, tt.value, err)
+			continue
+		}
+		if common.Bytes2Hex(have) != tt.want {
+			t.Errorf("test %d: %s %v: encoding mismatch: have %x, want %s", i, tt.typ, tt.value, have, tt.want)
+		}
+	}
+}
+
+// Tests that the decoded fields shown to the user match the message.
+func TestTypedDataFormat(t *testing.T) {
+	typedData := mailTestData(t)
+	messages, err := typedData.Format()
+	if err != nil {
+		t.Fatalf("formatting failed: %v", err)
+	}
+	var output bytes.Buffer
+	for _, nvt := range messages {
+		output.WriteString(nvt.Pprint(0))
+	}
+	want := `EIP712Domain [domain]: 
+  name [string]: "Ether Mail"
+  version [string]: "1"
+  chainId [uint256]: "1"
+  verifyingContract [address]: "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+Mail [primary type]: 
+  from [Person]: 
+    name [string]: "Cow"
+    wallet [address]: "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"
+  to [Person]: 
+    name [string]: "Bob"
+    wallet [address]: "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"
+  contents [string]: "Hello, Bob!"
+`
+	if output.String() != want {
+		t.Errorf("formatted output mismatch:\nhave:\n%s\nwant:\n%s", output.String(), want)
+	}
+}
+
+func TestSignTypedData(t *testing.T) {
+	api, control := setup(t)
+	createAccount(control, api, t)
+	control <- "A"
+	list, err := api.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := common.NewMixedcaseAddress(list[0])
+	typedData := mailTestData(t)
+
+	control <- "No way"
+	sig, err := api.SignTypedData(context.Background(), a, typedData)
+	if sig != nil || err != ErrRequestDenied {
+		t.Errorf("Expected ErrRequestDenied, got %x, %v", sig, err)
+	}
+	control <- "Y"
+	control <- "a_long_password"
+	sig, err = api.SignTypedData(context.Background(), a, typedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sig) != 65 {
+		t.Fatalf("Expected 65 byte signature (got %d bytes)", len(sig))
+	}
+	// Recover the signer from the specification's digest
+	sig[64] -= 27
+	pubkey, err := crypto.SigToPub(hexutil.MustDecode("0xbe609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2"), sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer := crypto.PubkeyToAddress(*pubkey); signer != list[0] {
+		t.Errorf("Signer mismatch: have %x, want %x", signer, list[0])
+	}
+}
@@ -0,0 +1,616 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of go-etsc.
+//
+// go-etsc is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-etsc is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-etsc. If not, see <http://www.gnu.org/licenses/>.
+
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/common/math"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/internal/etscapi"
+	"github.com/ETSC3259/etsc/log"
+	"github.com/ETSC3259/etsc/signer/core"
+	"github.com/ETSC3259/etsc/signer/storage"
+)
+
+// Policy is a declarative set of limits every signing request has to satisfy.
+// Restrictions which are left empty are not enforced. Values are given in wei,
+// as decimal or hex strings, times of day in UTC.
+type Policy struct {
+	// Recipients, if not empty, are the only addresses transactions may be sent
+	// to, optionally with their own value limits.
+	Recipients map[common.Address]*RecipientPolicy `json:"recipients"`
+	// ContractCreation permits deploying contracts if recipients are restricted.
+	ContractCreation bool `json:"contractCreation"`
+
+	MaxValue    *math.HexOrDecimal256 `json:"maxValue"`    // Maximum value of a single transaction
+	DailyValue  *math.HexOrDecimal256 `json:"dailyValue"`  // Maximum value of all transactions per day
+	MaxGasPrice *math.HexOrDecimal256 `json:"maxGasPrice"` // Maximum gas price of a transaction
+
+	// Methods, if not empty, are the only contract methods that may be called,
+	// given as text signatures, e.g. "transfer(address,uint256)". The selector
+	// of the call data is resolved via the 4byte database.
+	Methods []string `json:"methods"`
+
+	RateLimits  []*RateLimit  `json:"rateLimits"`  // Maximum number of transactions per period
+	TimeWindows []*TimeWindow `json:"timeWindows"` // Times of the week when signing is allowed
+
+	// SignData, if not empty, are the only content types data may be signed for.
+	SignData []string `json:"signData"`
+
+	// AutoApprove approves requests satisfying the policy without consulting the
+	// next handler (rule file or user). Data signing is only auto approved for the
+	// content types explicitly listed in SignData.
+	AutoApprove bool `json:"autoApprove"`
+}
+
+// RecipientPolicy are the limits on transactions sent to a single recipient.
+type RecipientPolicy struct {
+	MaxValue   *math.HexOrDecimal256 `json:"maxValue"`   // Maximum value of a single transaction
+	DailyValue *math.HexOrDecimal256 `json:"dailyValue"` // Maximum value of all transactions per day
+}
+
+// RateLimit caps the number of transactions signed within a fixed period, e.g.
+// {"count": 10, "period": "1h"}.
+type RateLimit struct {
+	Count  uint64 `json:"count"`
+	Period string `json:"period"`
+
+	period time.Duration
+}
+
+// TimeWindow is a daily span of time signing is allowed in, on the listed days
+// of the week (or every day if none are listed), e.g.
+// {"days": ["mon", "tue"], "from": "09:00", "to": "17:30"}. Windows ending
+// before they start span midnight.
+type TimeWindow struct {
+	Days []string `json:"days"`
+	From string   `json:"from"`
+	To   string   `json:"to"`
+
+	days     map[time.Weekday]bool
+	from, to time.Duration
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParsePolicy parses and validates a JSON encoded policy. YAML isn't supported:
+// there's no YAML parser among the dependencies, and the policy is a security
+// boundary, so its format is kept strict (unknown fields are rejected) and
+// dependency free rather than offering a second syntax for the same thing.
+func ParsePolicy(data []byte) (*Policy, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	policy := new(Policy)
+	if err := dec.Decode(policy); err != nil {
+		return nil, fmt.Errorf("invalid policy: %v", err)
+	}
+	for _, method := range policy.Methods {
+		if !strings.HasSuffix(method, ")") || strings.IndexByte(method, '(') <= 0 {
+			return nil, fmt.Errorf("invalid method signature %q", method)
+		}
+	}
+	for _, limit := range policy.RateLimits {
+		period, err := time.ParseDuration(limit.Period)
+		if err != nil || period < time.Second {
+			return nil, fmt.Errorf("invalid rate limit period %q", limit.Period)
+		}
+		if limit.Count == 0 {
+			return nil, fmt.Errorf("invalid rate limit count %d", limit.Count)
+		}
+		limit.period = period
+	}
+	for _, window := range policy.TimeWindows {
+		window.days = make(map[time.Weekday]bool)
+		for _, day := range window.Days {
+			weekday, ok := weekdays[strings.ToLower(day)]
+			if !ok {
+				return nil, fmt.Errorf("invalid day %q", day)
+			}
+			window.days[weekday] = true
+		}
+		var err error
+		if window.from, err = parseTimeOfDay(window.From); err != nil {
+			return nil, err
+		}
+		if window.to, err = parseTimeOfDay(window.To); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+// parseTimeOfDay parses a "15:04" formatted time of day into its offset from
+// midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// contains checks whether the given time falls into the window.
+func (w *TimeWindow) contains(now time.Time) bool {
+	now = now.UTC()
+	if len(w.days) > 0 && !w.days[now.Weekday()] {
+		return false
+	}
+	offset := now.Sub(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+	if w.from <= w.to {
+		return offset >= w.from && offset < w.to
+	}
+	return offset >= w.from || offset < w.to
+}
+
+const (
+	// policyReservationTimeout is the time an approved transaction holds its share
+	// of the limits while waiting to be signed. Failed signings aren't reported
+	// back, so the reservations of transactions never signed expire instead.
+	policyReservationTimeout = 5 * time.Minute
+
+	// policyWindowsKey is the storage key of the index of all usage counters,
+	// mapped to the unix time their window ends at, used to prune expired ones.
+	policyWindowsKey = "policy/windows"
+)
+
+// reservation is an approved transaction awaiting signing, whose value and count
+// are withheld from the limits until it's accounted.
+type reservation struct {
+	hash  common.Hash     // Hash of the unsigned transaction, to match the signed one
+	to    *common.Address // Recipient of the transaction, nil for contract creations
+	value *big.Int        // Value transferred by the transaction
+	time  time.Time       // Time of approval, the transaction is accounted at
+}
+
+// valueKeys returns the storage keys of the daily value counters the
+// reservation is accounted under.
+func (r *reservation) valueKeys() []string {
+	keys := []string{dailyValueKey(r.time, nil)}
+	if r.to != nil {
+		keys = append(keys, dailyValueKey(r.time, r.to))
+	}
+	return keys
+}
+
+// policyUI provides an implementation of SignerUI that checks every request
+// against a declarative policy before handing it to the next handler (or
+// approving it directly). The amounts and counts the limits are enforced on
+// are persisted in the given storage once a transaction is signed, and all
+// decisions are audit logged.
+type policyUI struct {
+	next        core.SignerUI // The next handler, for rule based or manual processing
+	policy      *Policy
+	db          *core.AbiDb
+	state       storage.Storage // Persistent usage counters of the limits
+	credentials storage.Storage
+	audit       log.Logger
+
+	pending []*reservation   // Transactions approved, but not signed yet
+	timeout time.Duration    // Time after which reservations of unsigned transactions expire
+	now     func() time.Time // Current time, overridable for testing
+	lock    sync.Mutex       // Serializes checking and accounting of transactions
+}
+
+func NewPolicyEvaluator(next core.SignerUI, policy *Policy, db *core.AbiDb, state, credentials storage.Storage, audit log.Logger) *policyUI {
+	return &policyUI{
+		next:        next,
+		policy:      policy,
+		db:          db,
+		state:       state,
+		credentials: credentials,
+		audit:       audit.New("api", "policy"),
+		timeout:     policyReservationTimeout,
+		now:         time.Now,
+	}
+}
+
+// SetApprovalTimeout accounts for the transactions approved by the policy having
+// to be approved by a quorum afterwards, within the given timeout, keeping their
+// reservations for that much longer.
+func (p *policyUI) SetApprovalTimeout(timeout time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.timeout = policyReservationTimeout + timeout
+}
+
+// checkTx verifies that the transaction satisfies the policy at the given time,
+// returning the violated limit if not.
+func (p *policyUI) checkTx(tx *core.SendTxArgs, now time.Time) error {
+	if err := p.checkTime(now); err != nil {
+		return err
+	}
+	value := (*big.Int)(&tx.Value)
+	if p.policy.MaxGasPrice != nil && tx.GasPrice.ToInt().Cmp((*big.Int)(p.policy.MaxGasPrice)) > 0 {
+		return fmt.Errorf("gas price %v exceeds limit %v", tx.GasPrice.ToInt(), (*big.Int)(p.policy.MaxGasPrice))
+	}
+	if p.policy.MaxValue != nil && value.Cmp((*big.Int)(p.policy.MaxValue)) > 0 {
+		return fmt.Errorf("value %v exceeds limit %v", value, (*big.Int)(p.policy.MaxValue))
+	}
+	if p.policy.DailyValue != nil {
+		if total := new(big.Int).Add(p.spent(dailyValueKey(now, nil)), value); total.Cmp((*big.Int)(p.policy.DailyValue)) > 0 {
+			return fmt.Errorf("daily value %v exceeds limit %v", total, (*big.Int)(p.policy.DailyValue))
+		}
+	}
+	for _, limit := range p.policy.RateLimits {
+		if count := p.counted(rateLimitKey(now, limit)); count >= limit.Count {
+			return fmt.Errorf("rate limit of %d transactions per %v reached", limit.Count, limit.period)
+		}
+	}
+	// Contract creations are only subject to the recipient restriction
+	if tx.To == nil {
+		if len(p.policy.Recipients) > 0 && !p.policy.ContractCreation {
+			return fmt.Errorf("contract creation not allowed")
+		}
+		return nil
+	}
+	to := tx.To.Address()
+	if len(p.policy.Recipients) > 0 {
+		recipient, ok := p.policy.Recipients[to]
+		if !ok {
+			return fmt.Errorf("recipient %v not allowed", to.Hex())
+		}
+		if recipient != nil && recipient.MaxValue != nil && value.Cmp((*big.Int)(recipient.MaxValue)) > 0 {
+			return fmt.Errorf("value %v to %v exceeds limit %v", value, to.Hex(), (*big.Int)(recipient.MaxValue))
+		}
+		if recipient != nil && recipient.DailyValue != nil {
+			if total := new(big.Int).Add(p.spent(dailyValueKey(now, &to)), value); total.Cmp((*big.Int)(recipient.DailyValue)) > 0 {
+				return fmt.Errorf("daily value %v to %v exceeds limit %v", total, to.Hex(), (*big.Int)(recipient.DailyValue))
+			}
+		}
+	}
+	return p.checkMethod(tx)
+}
+
+// checkTime verifies that the given time falls into one of the time windows.
+func (p *policyUI) checkTime(now time.Time) error {
+	if len(p.policy.TimeWindows) == 0 {
+		return nil
+	}
+	for _, window := range p.policy.TimeWindows {
+		if window.contains(now) {
+			return nil
+		}
+	}
+	return fmt.Errorf("outside of allowed time windows")
+}
+
+// checkMethod verifies that the call data of the transaction invokes one of the
+// allowed methods.
+func (p *policyUI) checkMethod(tx *core.SendTxArgs) error {
+	if len(p.policy.Methods) == 0 {
+		return nil
+	}
+	data := txData(tx)
+	if len(data) == 0 {
+		return nil
+	}
+	if len(data) < 4 {
+		return fmt.Errorf("invalid call data of %d bytes", len(data))
+	}
+	method, err := p.db.LookupMethodSelector(data[:4])
+	if err != nil {
+		return fmt.Errorf("unknown method selector %x", data[:4])
+	}
+	// The database may contain user submitted entries, don't trust them blindly
+	if !bytes.Equal(crypto.Keccak256([]byte(method))[:4], data[:4]) {
+		return fmt.Errorf("method %q does not match selector %x", method, data[:4])
+	}
+	for _, allowed := range p.policy.Methods {
+		if method == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("method %q not allowed", method)
+}
+
+// txData returns the call data of the transaction.
+func txData(tx *core.SendTxArgs) []byte {
+	if tx.Data != nil {
+		return *tx.Data
+	} else if tx.Input != nil {
+		return *tx.Input
+	}
+	return nil
+}
+
+// unsignedHash returns the hash of a transaction without its signature, to
+// match requests with the transactions eventually signed for them.
+func unsignedHash(tx *types.Transaction) common.Hash {
+	if tx.To() == nil {
+		return types.NewContractCreation(tx.Nonce(), tx.Value(), tx.Gas(), tx.GasPrice(), tx.Data()).Hash()
+	}
+	return types.NewTransaction(tx.Nonce(), *tx.To(), tx.Value(), tx.Gas(), tx.GasPrice(), tx.Data()).Hash()
+}
+
+// reserve checks the transaction against the policy and, if it complies,
+// withholds its value and count from the limits until it's signed. Checking and
+// reserving is atomic, so concurrent requests can't exceed the limits.
+func (p *policyUI) reserve(tx *core.SendTxArgs) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := p.now()
+	p.expire(now)
+	if err := p.checkTx(tx, now); err != nil {
+		return err
+	}
+	// Reserve under the hash of the transaction the signer will sign
+	var unsigned *types.Transaction
+	if tx.To == nil {
+		unsigned = types.NewContractCreation(uint64(tx.Nonce), tx.Value.ToInt(), uint64(tx.Gas), tx.GasPrice.ToInt(), txData(tx))
+	} else {
+		unsigned = types.NewTransaction(uint64(tx.Nonce), tx.To.Address(), tx.Value.ToInt(), uint64(tx.Gas), tx.GasPrice.ToInt(), txData(tx))
+	}
+	res := &reservation{hash: unsigned.Hash(), to: unsigned.To(), value: unsigned.Value(), time: now}
+	p.pending = append(p.pending, res)
+	return nil
+}
+
+// expire drops the reservations of transactions which haven't been signed in
+// time, presumably because signing failed.
+func (p *policyUI) expire(now time.Time) {
+	pending := p.pending[:0]
+	for _, res := range p.pending {
+		if now.Sub(res.time) < p.timeout {
+			pending = append(pending, res)
+		}
+	}
+	for i := len(pending); i < len(p.pending); i++ {
+		p.pending[i] = nil
+	}
+	p.pending = pending
+}
+
+// settle accounts a signed transaction against the limits, releasing its
+// reservation. Transactions signed after their reservation expired are still
+// accounted, at the time they were signed.
+func (p *policyUI) settle(tx *types.Transaction) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	hash := unsignedHash(tx)
+	for i, res := range p.pending {
+		if res.hash == hash {
+			p.pending = append(p.pending[:i], p.pending[i+1:]...)
+			p.record(res)
+			return
+		}
+	}
+	p.record(&reservation{hash: hash, to: tx.To(), value: tx.Value(), time: p.now()})
+}
+
+// record persists a signed transaction into the usage counters, pruning the
+// counters of all windows which have ended.
+func (p *policyUI) record(res *reservation) {
+	windows := make(map[string]int64)
+	if blob := p.state.Get(policyWindowsKey); blob != "" {
+		if err := json.Unmarshal([]byte(blob), &windows); err != nil {
+			log.Warn("Failed to load policy counter index", "err", err)
+		}
+	}
+	if res.value.Sign() > 0 {
+		day := res.time.UTC()
+		end := time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, time.UTC).Unix()
+		for _, key := range res.valueKeys() {
+			p.state.Put(key, new(big.Int).Add(p.stored(key), res.value).String())
+			windows[key] = end
+		}
+	}
+	for _, limit := range p.policy.RateLimits {
+		key := rateLimitKey(res.time, limit)
+		p.state.Put(key, fmt.Sprint(p.stored(key).Uint64()+1))
+
+		period := int64(limit.period / time.Second)
+		windows[key] = (res.time.Unix()/period + 1) * period
+	}
+	now := p.now().Unix()
+	for key, end := range windows {
+		if end <= now {
+			p.state.Del(key)
+			delete(windows, key)
+		}
+	}
+	blob, _ := json.Marshal(windows)
+	p.state.Put(policyWindowsKey, string(blob))
+}
+
+// stored returns the number persisted under the given key.
+func (p *policyUI) stored(key string) *big.Int {
+	value, ok := new(big.Int).SetString(p.state.Get(key), 10)
+	if !ok {
+		return new(big.Int)
+	}
+	return value
+}
+
+// spent returns the value accounted under the given key, including the value of
+// the transactions awaiting signing.
+func (p *policyUI) spent(key string) *big.Int {
+	value := p.stored(key)
+	for _, res := range p.pending {
+		for _, k := range res.valueKeys() {
+			if k == key {
+				value.Add(value, res.value)
+			}
+		}
+	}
+	return value
+}
+
+// counted returns the number of transactions accounted under the given key,
+// including the transactions awaiting signing.
+func (p *policyUI) counted(key string) uint64 {
+	count := p.stored(key).Uint64()
+	for _, res := range p.pending {
+		for _, limit := range p.policy.RateLimits {
+			if rateLimitKey(res.time, limit) == key {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// dailyValueKey is the storage key of the value transferred at the given day,
+// either in total or to the given recipient.
+func dailyValueKey(now time.Time, to *common.Address) string {
+	key := "policy/value/" + now.UTC().Format("2006-01-02")
+	if to != nil {
+		key += "/" + strings.ToLower(to.Hex())
+	}
+	return key
+}
+
+// rateLimitKey is the storage key of the transaction count within the period of
+// the rate limit the given time falls into.
+func rateLimitKey(now time.Time, limit *RateLimit) string {
+	return fmt.Sprintf("policy/count/%d/%d", int64(limit.period/time.Second), now.Unix()/int64(limit.period/time.Second))
+}
+
+func (p *policyUI) lookupPassword(address common.Address) string {
+	return p.credentials.Get(strings.ToLower(address.String()))
+}
+
+func (p *policyUI) logTx(decision, reason string, request *core.SignTxRequest, tx *core.SendTxArgs) {
+	to := "<contract creation>"
+	if tx.To != nil {
+		to = tx.To.Address().Hex()
+	}
+	p.audit.Info("ApproveTx", "type", "decision", "metadata", request.Meta.String(), "decision", decision,
+		"reason", reason, "from", tx.From.Address().Hex(), "to", to, "value", tx.Value.ToInt(), "gasPrice", tx.GasPrice.ToInt())
+}
+
+func (p *policyUI) ApproveTx(request *core.SignTxRequest) (core.SignTxResponse, error) {
+	if p.policy.AutoApprove {
+		if err := p.reserve(&request.Transaction); err != nil {
+			p.logTx("reject", err.Error(), request, &request.Transaction)
+			return core.SignTxResponse{Transaction: request.Transaction, Approved: false}, nil
+		}
+		p.logTx("approve", "within policy", request, &request.Transaction)
+		return core.SignTxResponse{
+			Transaction: request.Transaction,
+			Approved:    true,
+			Password:    p.lookupPassword(request.Transaction.From.Address()),
+		}, nil
+	}
+	// Don't hold the lock while the next handler decides, it may well be waiting
+	// for a human, blocking every other request meanwhile
+	p.lock.Lock()
+	err := p.checkTx(&request.Transaction, p.now())
+	p.lock.Unlock()
+
+	if err != nil {
+		p.logTx("reject", err.Error(), request, &request.Transaction)
+		return core.SignTxResponse{Transaction: request.Transaction, Approved: false}, nil
+	}
+	p.logTx("forward", "within policy", request, &request.Transaction)
+
+	response, err := p.next.ApproveTx(request)
+	if err != nil || !response.Approved {
+		return response, err
+	}
+	// The next handler may have modified the transaction, and other transactions
+	// may have been approved in the meantime, it must still comply
+	if err := p.reserve(&response.Transaction); err != nil {
+		p.logTx("reject", "after approval: "+err.Error(), request, &response.Transaction)
+		return core.SignTxResponse{Transaction: response.Transaction, Approved: false}, nil
+	}
+	p.logTx("approve", "approved by next handler", request, &response.Transaction)
+	return response, nil
+}
+
+func (p *policyUI) ApproveSignData(request *core.SignDataRequest) (core.SignDataResponse, error) {
+	logData := func(decision, reason string) {
+		p.audit.Info("ApproveSignData", "type", "decision", "metadata", request.Meta.String(), "decision", decision,
+			"reason", reason, "addr", request.Address.Address().Hex(), "contentType", request.ContentType)
+	}
+	if err := p.checkTime(p.now()); err != nil {
+		logData("reject", err.Error())
+		return core.SignDataResponse{Approved: false}, nil
+	}
+	if len(p.policy.SignData) == 0 {
+		logData("forward", "content type not restricted")
+		return p.next.ApproveSignData(request)
+	}
+	for _, contentType := range p.policy.SignData {
+		if request.ContentType != contentType {
+			continue
+		}
+		if p.policy.AutoApprove {
+			logData("approve", "within policy")
+			return core.SignDataResponse{Approved: true, Password: p.lookupPassword(request.Address.Address())}, nil
+		}
+		logData("forward", "within policy")
+		return p.next.ApproveSignData(request)
+	}
+	logData("reject", "content type not allowed")
+	return core.SignDataResponse{Approved: false}, nil
+}
+
+func (p *policyUI) ApproveExport(request *core.ExportRequest) (core.ExportResponse, error) {
+	return p.next.ApproveExport(request)
+}
+
+func (p *policyUI) ApproveImport(request *core.ImportRequest) (core.ImportResponse, error) {
+	return p.next.ApproveImport(request)
+}
+
+func (p *policyUI) ApproveListing(request *core.ListRequest) (core.ListResponse, error) {
+	return p.next.ApproveListing(request)
+}
+
+func (p *policyUI) ApproveNewAccount(request *core.NewAccountRequest) (core.NewAccountResponse, error) {
+	return p.next.ApproveNewAccount(request)
+}
+
+func (p *policyUI) ShowError(message string) {
+	p.next.ShowError(message)
+}
+
+func (p *policyUI) ShowInfo(message string) {
+	p.next.ShowInfo(message)
+}
+
+func (p *policyUI) OnApprovedTx(tx etscapi.SignTransactionResult) {
+	// Transactions are only accounted once signed, so failed signings don't count
+	if tx.Tx != nil {
+		p.settle(tx.Tx)
+	}
+	p.next.OnApprovedTx(tx)
+}
+
+func (p *policyUI) OnSignerStartup(info core.StartupInfo) {
+	p.next.OnSignerStartup(info)
+}
+
+func (p *policyUI) OnInputRequired(info core.UserInputRequest) (core.UserInputResponse, error) {
+	return p.next.OnInputRequired(info)
+}
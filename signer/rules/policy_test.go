@@ -0,0 +1,310 @@
+// Copyright 2018 The go-etsc Authors
+// This file is part of go-etsc.
+//
+// go-etsc is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-etsc is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-etsc. If not, see <http://www.gnu.org/licenses/>.
+
+package rules
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ETSC3259/etsc/common"
+	"github.com/ETSC3259/etsc/common/hexutil"
+	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/crypto"
+	"github.com/ETSC3259/etsc/internal/etscapi"
+	"github.com/ETSC3259/etsc/log"
+	"github.com/ETSC3259/etsc/signer/core"
+	"github.com/ETSC3259/etsc/signer/storage"
+)
+
+var (
+	policyFrom      = common.HexToAddress("0x000000000000000000000000000000000000f00d")
+	policyRecipient = common.HexToAddress("0x00000000000000000000000000000000deadbeef")
+	policyStranger  = common.HexToAddress("0x0000000000000000000000000000000000001337")
+)
+
+const testPolicy = `{
+	"recipients": {
+		"0x00000000000000000000000000000000deadbeef": {"maxValue": "100", "dailyValue": "150"},
+		"0x0000000000000000000000000000000000001337": null
+	},
+	"maxValue": "1000",
+	"dailyValue": "0x12c",
+	"maxGasPrice": "20",
+	"methods": ["transfer(address,uint256)"],
+	"rateLimits": [{"count": 5, "period": "1h"}],
+	"timeWindows": [{"days": ["mon", "tue", "wed", "thu", "fri"], "from": "09:00", "to": "17:00"}],
+	"signData": ["application/x-clique-header"],
+	"autoApprove": true
+}`
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("failed to parse policy: %v", err)
+	}
+	if len(policy.Recipients) != 2 || policy.Recipients[policyRecipient] == nil {
+		t.Errorf("recipients mismatch: %v", policy.Recipients)
+	}
+	if (*big.Int)(policy.DailyValue).Int64() != 300 {
+		t.Errorf("daily value mismatch: have %v, want 300", (*big.Int)(policy.DailyValue))
+	}
+	if policy.RateLimits[0].period != time.Hour {
+		t.Errorf("rate limit period mismatch: have %v, want %v", policy.RateLimits[0].period, time.Hour)
+	}
+	if window := policy.TimeWindows[0]; len(window.days) != 5 || window.from != 9*time.Hour || window.to != 17*time.Hour {
+		t.Errorf("time window mismatch: %+v", window)
+	}
+	invalid := []string{
+		`{"unknown": true}`,
+		`{"maxValue": "lots"}`,
+		`{"methods": ["transfer"]}`,
+		`{"rateLimits": [{"count": 1, "period": "1ms"}]}`,
+		`{"rateLimits": [{"count": 0, "period": "1h"}]}`,
+		`{"timeWindows": [{"days": ["someday"], "from": "09:00", "to": "17:00"}]}`,
+		`{"timeWindows": [{"from": "9am", "to": "17:00"}]}`,
+	}
+	for _, data := range invalid {
+		if _, err := ParsePolicy([]byte(data)); err == nil {
+			t.Errorf("expected error for policy %s", data)
+		}
+	}
+}
+
+// policyDenyUI is a next handler denying everything, which tolerates being
+// notified about signed transactions.
+type policyDenyUI struct {
+	alwaysDenyUI
+}
+
+func (policyDenyUI) OnApprovedTx(tx etscapi.SignTransactionResult) {}
+
+// newTestPolicyEvaluator creates a policy evaluator in front of a UI denying
+// everything, with the clock set to a Monday noon.
+func newTestPolicyEvaluator(t *testing.T, data string, state storage.Storage) *policyUI {
+	policy, err := ParsePolicy([]byte(data))
+	if err != nil {
+		t.Fatalf("failed to parse policy: %v", err)
+	}
+	db, err := core.NewEmptyAbiDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	transfer := "transfer(address,uint256)"
+	db.AddSignature(transfer, crypto.Keccak256([]byte(transfer))[:4])
+	db.AddSignature("approve(address,uint256)", crypto.Keccak256([]byte("approve(address,uint256)"))[:4])
+	db.AddSignature(transfer, []byte{0xde, 0xad, 0xbe, 0xef})
+
+	audit := log.New()
+	audit.SetHandler(log.DiscardHandler())
+
+	p := NewPolicyEvaluator(&policyDenyUI{}, policy, db, state, storage.NewEphemeralStorage(), audit)
+	p.now = func() time.Time { return time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC) }
+	return p
+}
+
+func policyTx(to *common.Address, value, gasPrice int64, data []byte) *core.SignTxRequest {
+	tx := core.SendTxArgs{
+		From:     common.NewMixedcaseAddress(policyFrom),
+		Gas:      21000,
+		GasPrice: hexutil.Big(*big.NewInt(gasPrice)),
+		Value:    hexutil.Big(*big.NewInt(value)),
+	}
+	if to != nil {
+		addr := common.NewMixedcaseAddress(*to)
+		tx.To = &addr
+	}
+	if data != nil {
+		input := hexutil.Bytes(data)
+		tx.Data = &input
+	}
+	return &core.SignTxRequest{Transaction: tx}
+}
+
+// policySign notifies the policy evaluator about the transaction of the request
+// having been signed.
+func policySign(p *policyUI, request *core.SignTxRequest) {
+	tx := request.Transaction
+	signed := types.NewTransaction(uint64(tx.Nonce), tx.To.Address(), tx.Value.ToInt(), uint64(tx.Gas), tx.GasPrice.ToInt(), txData(&tx))
+	p.OnApprovedTx(etscapi.SignTransactionResult{Tx: signed})
+}
+
+func TestPolicyTransactions(t *testing.T) {
+	p := newTestPolicyEvaluator(t, testPolicy, storage.NewEphemeralStorage())
+
+	transfer := crypto.Keccak256([]byte("transfer(address,uint256)"))[:4]
+	approve := crypto.Keccak256([]byte("approve(address,uint256)"))[:4]
+
+	tests := []struct {
+		request  *core.SignTxRequest
+		approved bool
+	}{
+		{policyTx(&policyRecipient, 100, 20, nil), true},                          // within limits
+		{policyTx(&policyRecipient, 101, 20, nil), false},                         // recipient value limit
+		{policyTx(&policyRecipient, 10, 21, nil), false},                          // gas price limit
+		{policyTx(&policyFrom, 10, 20, nil), false},                               // unknown recipient
+		{policyTx(nil, 0, 20, []byte{0x60, 0x60}), false},                         // contract creation
+		{policyTx(&policyStranger, 1001, 20, nil), false},                         // global value limit
+		{policyTx(&policyStranger, 0, 20, transfer), true},                        // allowed method
+		{policyTx(&policyStranger, 0, 20, approve), false},                        // disallowed method
+		{policyTx(&policyStranger, 0, 20, []byte{0xaa}), false},                   // invalid call data
+		{policyTx(&policyStranger, 0, 20, []byte{0xaa, 0xbb, 0xcc, 0xdd}), false}, // unknown selector
+		{policyTx(&policyStranger, 0, 20, []byte{0xde, 0xad, 0xbe, 0xef}), false}, // forged selector
+		{policyTx(&policyRecipient, 50, 20, nil), true},                           // recipient daily limit reached
+		{policyTx(&policyRecipient, 1, 20, nil), false},                           // recipient daily limit exceeded
+		{policyTx(&policyStranger, 150, 20, nil), true},                           // global daily limit reached
+		{policyTx(&policyStranger, 1, 20, nil), false},                            // global daily limit exceeded
+		{policyTx(&policyStranger, 0, 20, nil), true},                             // rate limit reached
+		{policyTx(&policyStranger, 0, 20, nil), false},                            // rate limit exceeded
+	}
+	for i, tt := range tests {
+		response, err := p.ApproveTx(tt.request)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %v", i, err)
+		}
+		if response.Approved != tt.approved {
+			t.Errorf("test %d: approval mismatch: have %v, want %v", i, response.Approved, tt.approved)
+		}
+	}
+	// Limits reset on the next day and in the next period respectively
+	p.now = func() time.Time { return time.Date(2018, 10, 2, 12, 0, 0, 0, time.UTC) }
+	if response, _ := p.ApproveTx(policyTx(&policyRecipient, 100, 20, nil)); !response.Approved {
+		t.Errorf("limits not reset on the next day")
+	}
+}
+
+func TestPolicyPersistence(t *testing.T) {
+	state := storage.NewEphemeralStorage()
+
+	p := newTestPolicyEvaluator(t, testPolicy, state)
+	request := policyTx(&policyRecipient, 100, 20, nil)
+	if response, _ := p.ApproveTx(request); !response.Approved {
+		t.Fatalf("transaction within limits denied")
+	}
+	policySign(p, request)
+
+	// A restarted evaluator must continue with the limits already used up
+	p = newTestPolicyEvaluator(t, testPolicy, state)
+	if response, _ := p.ApproveTx(policyTx(&policyRecipient, 100, 20, nil)); response.Approved {
+		t.Errorf("daily limit not persisted")
+	}
+}
+
+func TestPolicySigningFailure(t *testing.T) {
+	state := storage.NewEphemeralStorage()
+
+	// An approved transaction holds its share of the limits until signed...
+	p := newTestPolicyEvaluator(t, testPolicy, state)
+	if response, _ := p.ApproveTx(policyTx(&policyRecipient, 100, 20, nil)); !response.Approved {
+		t.Fatalf("transaction within limits denied")
+	}
+	if response, _ := p.ApproveTx(policyTx(&policyRecipient, 100, 20, nil)); response.Approved {
+		t.Errorf("reserved value not accounted")
+	}
+	// ...but it isn't persisted, and if signing fails the reservation expires
+	if restarted := newTestPolicyEvaluator(t, testPolicy, state); restarted.spent(dailyValueKey(restarted.now(), nil)).Sign() != 0 {
+		t.Errorf("value of unsigned transaction persisted")
+	}
+	now := p.now().Add(policyReservationTimeout)
+	p.now = func() time.Time { return now }
+
+	request := policyTx(&policyRecipient, 100, 20, nil)
+	if response, _ := p.ApproveTx(request); !response.Approved {
+		t.Fatalf("expired reservation still accounted")
+	}
+	policySign(p, request)
+	if len(p.pending) != 0 {
+		t.Errorf("reservations not released: have %d, want 0", len(p.pending))
+	}
+	if spent := p.spent(dailyValueKey(now, &policyRecipient)); spent.Int64() != 100 {
+		t.Errorf("signed value mismatch: have %v, want 100", spent)
+	}
+}
+
+func TestPolicyPruning(t *testing.T) {
+	state := storage.NewEphemeralStorage()
+	p := newTestPolicyEvaluator(t, testPolicy, state)
+
+	var days []time.Time
+	for day := 1; day <= 3; day++ {
+		now := time.Date(2018, 10, day, 12, 0, 0, 0, time.UTC)
+		p.now = func() time.Time { return now }
+
+		request := policyTx(&policyRecipient, 10, 20, nil)
+		if response, _ := p.ApproveTx(request); !response.Approved {
+			t.Fatalf("day %d: transaction within limits denied", day)
+		}
+		policySign(p, request)
+		days = append(days, now)
+	}
+	// Only the counters of the current day and period may be retained
+	for i, day := range days {
+		keys := []string{dailyValueKey(day, nil), dailyValueKey(day, &policyRecipient), rateLimitKey(day, p.policy.RateLimits[0])}
+		for _, key := range keys {
+			if retained := state.Get(key) != ""; retained != (i == len(days)-1) {
+				t.Errorf("counter %s retention mismatch: have %v, want %v", key, retained, i == len(days)-1)
+			}
+		}
+	}
+}
+
+// blockingUI is a next handler which approves transactions only once released.
+type blockingUI struct {
+	policyDenyUI
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (ui *blockingUI) ApproveTx(request *core.SignTxRequest) (core.SignTxResponse, error) {
+	ui.entered <- struct{}{}
+	<-ui.release
+	return core.SignTxResponse{Transaction: request.Transaction, Approved: true}, nil
+}
+
+func TestPolicyForwardingConcurrency(t *testing.T) {
+	p := newTestPolicyEvaluator(t, `{"dailyValue": "150"}`, storage.NewEphemeralStorage())
+	ui := &blockingUI{entered: make(chan struct{}), release: make(chan struct{})}
+	p.next = ui
+
+	// Both requests must reach the next handler while the other is pending
+	results := make(chan bool, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			response, _ := p.ApproveTx(policyTx(&policyRecipient, 100, 1, nil))
+			results <- response.Approved
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-ui.entered:
+		case <-time.After(time.Second):
+			t.Fatalf("request %d blocked while another one is forwarded", i)
+		}
+	}
+	close(ui.release)
+
+	// Only one of them may be approved in the end, as both exceed the daily limit
+	approved := 0
+	for i := 0; i < 2; i++ {
+		if <-results {
+			approved++
+		}
+	}
+	if approved != 1 {
+		t.Errorf("approved transaction count mismatch: have %d, want 1", approved)
+	}
+}
@@ -17,16 +17,21 @@
 package rules
 
 import (
+	"context"
+	"crypto/ecdsa"
 	"fmt"
 	"math/big"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ETSC3259/etsc/accounts"
 	"github.com/ETSC3259/etsc/common"
 	"github.com/ETSC3259/etsc/common/hexutil"
 	"github.com/ETSC3259/etsc/core/types"
+	"github.com/ETSC3259/etsc/crypto"
 	"github.com/ETSC3259/etsc/internal/etscapi"
+	"github.com/ETSC3259/etsc/log"
 	"github.com/ETSC3259/etsc/signer/core"
 	"github.com/ETSC3259/etsc/signer/storage"
 )
@@ -656,3 +661,130 @@ function ApproveSignData(r){
 		t.Fatalf("Expected approved")
 	}
 }
+
+func TestSignTypedData(t *testing.T) {
+
+	js := `function ApproveSignData(r){
+    if(r.content_type != "data/typed"){
+        return "Reject"
+    }
+    // Approve only mails sent to Bob
+    var mail = r.messages[1].value
+    for(var i = 0; i < mail.length; i++){
+        if(mail[i].name == "to" && mail[i].value[0].value == "Bob"){
+            return "Approve"
+        }
+    }
+    return "Reject"
+}`
+	r, err := initRuleEngine(js)
+	if err != nil {
+		t.Errorf("Couldn't create evaluator %v", err)
+		return
+	}
+	typedData := core.TypedData{
+		Types: core.Types{
+			"EIP712Domain": {{Name: "name", Type: "string"}},
+			"Person":       {{Name: "name", Type: "string"}},
+			"Mail":         {{Name: "to", Type: "Person"}, {Name: "contents", Type: "string"}},
+		},
+		PrimaryType: "Mail",
+		Domain:      core.TypedDataDomain{Name: "Ether Mail"},
+	}
+	addr, _ := mixAddr("0x694267f14675d7e1b9494fd8d72fefe1755710fa")
+
+	for _, to := range []string{"Bob", "Alice"} {
+		typedData.Message = core.TypedDataMessage{
+			"to":       map[string]interface{}{"name": to},
+			"contents": "Hello!",
+		}
+		messages, err := typedData.Format()
+		if err != nil {
+			t.Fatalf("Failed to format typed data: %v", err)
+		}
+		resp, err := r.ApproveSignData(&core.SignDataRequest{
+			ContentType: core.DataTyped,
+			Address:     *addr,
+			Messages:    messages,
+			Meta:        core.Metadata{Remote: "remoteip", Local: "localip", Scheme: "inproc"},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if resp.Approved != (to == "Bob") {
+			t.Errorf("Mail to %s: approval mismatch: have %v", to, resp.Approved)
+		}
+	}
+}
+
+func TestRuleApprovalAwaitsQuorum(t *testing.T) {
+	r, err := NewRuleEvaluator(core.DeferToQuorum(&dummyUI{}), storage.NewEphemeralStorage(), storage.NewEphemeralStorage())
+	if err != nil {
+		t.Fatalf("failed to create js engine: %v", err)
+	}
+	if err = r.Init(`function ApproveTx(r){ return "Approve" }`); err != nil {
+		t.Fatalf("failed to load bootstrap js: %v", err)
+	}
+	keys := make([]*ecdsa.PrivateKey, 2)
+	approvers := make([]common.Address, 2)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		approvers[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+	sign := func(key *ecdsa.PrivateKey, message string) hexutil.Bytes {
+		hash, _ := core.SignHash([]byte(message))
+		sig, err := crypto.Sign(hash, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig[64] += 27
+		return sig
+	}
+	audit := log.New()
+	audit.SetHandler(log.DiscardHandler())
+
+	quorum, err := core.NewQuorumUI(r, approvers, 2, time.Minute, storage.NewEphemeralStorage(), audit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := core.NewQuorumAPI(quorum)
+
+	done := make(chan core.SignTxResponse, 1)
+	go func() {
+		response, _ := quorum.ApproveTx(dummyTxWithV(1))
+		done <- response
+	}()
+	// The rule approves the transaction, but it must still wait for the quorum
+	var pending []*core.ApprovalRequest
+	for i := 0; i < 100 && len(pending) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+
+		now := time.Now().Unix()
+		if pending, err = api.Pending(context.Background(), now, sign(keys[0], fmt.Sprintf("pending %d", now))); err != nil {
+			t.Fatalf("failed to list pending requests: %v", err)
+		}
+	}
+	if len(pending) != 1 {
+		t.Fatalf("rule approved transaction not queued for quorum")
+	}
+	id := pending[0].ID
+	if err := api.Approve(context.Background(), id, sign(keys[0], "approve "+id.Hex())); err != nil {
+		t.Fatalf("failed to approve: %v", err)
+	}
+	select {
+	case <-done:
+		t.Fatalf("rule approved transaction signed before quorum")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := api.Approve(context.Background(), id, sign(keys[1], "approve "+id.Hex())); err != nil {
+		t.Fatalf("failed to approve: %v", err)
+	}
+	select {
+	case response := <-done:
+		if !response.Approved {
+			t.Errorf("transaction denied on quorum")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("transaction not approved on quorum")
+	}
+}
@@ -99,6 +99,25 @@ func (s *AESEncryptedStorage) Get(key string) string {
 }
 
 // readEncryptedStorage reads the file with encrypted creds
+// Del removes the value stored by key, if any. 0-length keys results in no-op
+func (s *AESEncryptedStorage) Del(key string) {
+	if len(key) == 0 {
+		return
+	}
+	data, err := s.readEncryptedStorage()
+	if err != nil {
+		log.Warn("Failed to read encrypted storage", "err", err, "file", s.filename)
+		return
+	}
+	if _, exist := data[key]; !exist {
+		return
+	}
+	delete(data, key)
+	if err = s.writeEncryptedStorage(data); err != nil {
+		log.Warn("Failed to write entry", "err", err)
+	}
+}
+
 func (s *AESEncryptedStorage) readEncryptedStorage() (map[string]storedCredential, error) {
 	creds := make(map[string]storedCredential)
 	raw, err := ioutil.ReadFile(s.filename)
@@ -113,6 +113,10 @@ func TestEnd2End(t *testing.T) {
 	if v := s2.Get("bazonk"); v != "foobar" {
 		t.Errorf("Expected bazonk->foobar, got '%v'", v)
 	}
+	s1.Del("bazonk")
+	if v := s2.Get("bazonk"); v != "" {
+		t.Errorf("Expected bazonk to be deleted, got '%v'", v)
+	}
 }
 
 func TestSwappedKeys(t *testing.T) {
@@ -693,6 +693,7 @@ func (whisper *Whisper) runMessageLoop(p *Peer, rw p2p.MsgReadWriter) error {
 			var envelopes []*Envelope
 			if err := packet.Decode(&envelopes); err != nil {
 				log.Warn("failed to decode envelopes, peer will be disconnected", "peer", p.peer.ID(), "err", err)
+				p.peer.Report(p2p.RepProtocolViolation)
 				return errors.New("invalid envelopes")
 			}
 
@@ -709,6 +710,7 @@ func (whisper *Whisper) runMessageLoop(p *Peer, rw p2p.MsgReadWriter) error {
 			}
 
 			if trouble {
+				p.peer.Report(p2p.RepProtocolViolation)
 				return errors.New("invalid envelope")
 			}
 		case powRequirementCode:
@@ -716,11 +718,13 @@ func (whisper *Whisper) runMessageLoop(p *Peer, rw p2p.MsgReadWriter) error {
 			i, err := s.Uint()
 			if err != nil {
 				log.Warn("failed to decode powRequirementCode message, peer will be disconnected", "peer", p.peer.ID(), "err", err)
+				p.peer.Report(p2p.RepProtocolViolation)
 				return errors.New("invalid powRequirementCode message")
 			}
 			f := math.Float64frombits(i)
 			if math.IsInf(f, 0) || math.IsNaN(f) || f < 0.0 {
 				log.Warn("invalid value in powRequirementCode message, peer will be disconnected", "peer", p.peer.ID(), "err", err)
+				p.peer.Report(p2p.RepProtocolViolation)
 				return errors.New("invalid value in powRequirementCode message")
 			}
 			p.powRequirement = f
@@ -733,6 +737,7 @@ func (whisper *Whisper) runMessageLoop(p *Peer, rw p2p.MsgReadWriter) error {
 
 			if err != nil {
 				log.Warn("failed to decode bloom filter exchange message, peer will be disconnected", "peer", p.peer.ID(), "err", err)
+				p.peer.Report(p2p.RepProtocolViolation)
 				return errors.New("invalid bloom filter exchange message")
 			}
 			p.setBloomFilter(bloom)